@@ -9,11 +9,14 @@ import (
 	"github.com/pkg/errors"
 	kingpin "gopkg.in/alecthomas/kingpin.v2"
 
+	"github.com/kopia/kopia/fs"
 	"github.com/kopia/kopia/internal/serverapi"
+	"github.com/kopia/kopia/internal/units"
 	"github.com/kopia/kopia/repo"
 	"github.com/kopia/kopia/repo/blob"
 	"github.com/kopia/kopia/repo/content"
 	"github.com/kopia/kopia/repo/logging"
+	"github.com/kopia/kopia/snapshot/snapshotfs"
 )
 
 var log = logging.GetContextLoggerFunc("kopia/cli")
@@ -29,10 +32,11 @@ var (
 	policyCommands     = app.Command("policy", "Commands to manipulate snapshotting policies.").Alias("policies")
 	serverCommands     = app.Command("server", "Commands to control HTTP API server.")
 	manifestCommands   = app.Command("manifest", "Low-level commands to manipulate manifest items.").Hidden()
-	contentCommands    = app.Command("content", "Commands to manipulate content in repository.").Alias("contents").Hidden()
+	contentCommands    = app.Command("content", "Commands to manipulate content in repository.").Alias("contents").Alias("block").Hidden()
 	blobCommands       = app.Command("blob", "Commands to manipulate BLOBs.").Hidden()
 	indexCommands      = app.Command("index", "Commands to manipulate content index.").Hidden()
 	benchmarkCommands  = app.Command("benchmark", "Commands to test performance of algorithms.").Hidden()
+	migrateCommands    = app.Command("migrate", "Commands to import snapshots from other backup tools.")
 )
 
 func helpFullAction(ctx *kingpin.ParseContext) error {
@@ -66,11 +70,76 @@ func serverAction(act func(ctx context.Context, cli *serverapi.Client) error) fu
 }
 
 func repositoryAction(act func(ctx context.Context, rep *repo.Repository) error) func(ctx *kingpin.ParseContext) error {
-	return maybeRepositoryAction(act, true)
+	return maybeRepositoryAction(act, true, nil)
 }
 
 func optionalRepositoryAction(act func(ctx context.Context, rep *repo.Repository) error) func(ctx *kingpin.ParseContext) error {
-	return maybeRepositoryAction(act, false)
+	return maybeRepositoryAction(act, false, nil)
+}
+
+// offlineCapableRepositoryAction is like repositoryAction, but opens the repository using only local data
+// when the offline flag is set.
+func offlineCapableRepositoryAction(offline *bool, act func(ctx context.Context, rep *repo.Repository) error) func(ctx *kingpin.ParseContext) error {
+	return maybeRepositoryAction(act, true, offline)
+}
+
+// maxReportedUncachedContents is the maximum number of uncached contents listed when an entry can't be used offline.
+const maxReportedUncachedContents = 20
+
+// verifyAvailableOffline returns an error listing contents of the entry which are not cached locally
+// when the repository was opened offline.
+func verifyAvailableOffline(ctx context.Context, rep *repo.Repository, e fs.Entry) error {
+	if !rep.IsOffline() {
+		return nil
+	}
+
+	missing, err := snapshotfs.FindUncachedContents(ctx, rep, e)
+	if err != nil {
+		return errors.Wrap(err, "unable to determine cached contents")
+	}
+
+	if len(missing) == 0 {
+		return nil
+	}
+
+	printStderr("Contents not available in the local cache:\n")
+
+	for i, cid := range missing {
+		if i >= maxReportedUncachedContents {
+			printStderr("  ... and %v more\n", len(missing)-i)
+			break
+		}
+
+		printStderr("  %v\n", cid)
+	}
+
+	return errors.Errorf("%v contents are not cached locally, connect to the storage to access them", len(missing))
+}
+
+// printStorageFullGuidance explains how to free up space after a write failed because the storage is full.
+func printStorageFullGuidance(ctx context.Context, rep *repo.Repository) {
+	printStderr("\nThe repository storage is full.\n")
+
+	var count, total int64
+
+	if err := rep.Blobs.ListBlobs(ctx, "", func(bm blob.Metadata) error {
+		count++
+		total += bm.Length
+
+		return nil
+	}); err == nil {
+		printStderr("The repository uses %v in %v blobs.\n", units.BytesStringBase10(total), count)
+	}
+
+	printStderr(`
+To free up space, remove snapshots no longer needed and unused data:
+
+  kopia snapshot expire --all --delete
+  kopia snapshot gc --delete
+  kopia blob gc --delete=yes
+
+Alternatively, add space to the storage or synchronize the repository to a larger one using 'kopia repository sync-to'.
+`)
 }
 
 func rootContext() context.Context {
@@ -87,7 +156,7 @@ func rootContext() context.Context {
 	return ctx
 }
 
-func maybeRepositoryAction(act func(ctx context.Context, rep *repo.Repository) error, required bool) func(ctx *kingpin.ParseContext) error {
+func maybeRepositoryAction(act func(ctx context.Context, rep *repo.Repository) error, required bool, offline *bool) func(ctx *kingpin.ParseContext) error {
 	return func(kpc *kingpin.ParseContext) error {
 		return withProfiling(func() error {
 			ctx := rootContext()
@@ -105,12 +174,21 @@ func maybeRepositoryAction(act func(ctx context.Context, rep *repo.Repository) e
 				go http.ListenAndServe(*metricsListenAddr, mux) // nolint:errcheck
 			}
 
-			rep, err := openRepository(ctx, nil, required)
+			var opts *repo.Options
+			if offline != nil && *offline {
+				opts = &repo.Options{Offline: true}
+			}
+
+			rep, err := openRepository(ctx, opts, required)
 			if err != nil && required {
 				return errors.Wrap(err, "open repository")
 			}
 
 			err = act(ctx, rep)
+			if errors.Is(err, blob.ErrStorageFull) && rep != nil {
+				printStorageFullGuidance(ctx, rep)
+			}
+
 			if rep != nil && required {
 				if cerr := rep.Close(ctx); cerr != nil {
 					return errors.Wrap(cerr, "unable to close repository")
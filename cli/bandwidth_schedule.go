@@ -0,0 +1,108 @@
+package cli
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/kopia/kopia/repo/blob/throttling"
+	"github.com/kopia/kopia/snapshot"
+	"github.com/kopia/kopia/snapshot/policy"
+)
+
+// bandwidthScheduleInterval is how often bandwidth windows of throttling policies are re-evaluated.
+const bandwidthScheduleInterval = time.Minute
+
+// storageBandwidthLimiter limits the bandwidth of the storage of the repository opened by the command.
+var storageBandwidthLimiter = throttling.NewLimiter()
+
+// bandwidth applies throttling policies of sources being snapshotted to storageBandwidthLimiter.
+var bandwidth = newBandwidthSchedule(storageBandwidthLimiter)
+
+// bandwidthSchedule applies throttling policies of sources being snapshotted to the storage bandwidth limiter.
+// Policies of finished sources remain in effect until their data is flushed. When multiple sources are
+// snapshotted in parallel, the most restrictive limits apply.
+type bandwidthSchedule struct {
+	limiter *throttling.Limiter
+
+	mu       sync.Mutex
+	active   map[snapshot.SourceInfo]policy.ThrottlingPolicy
+	finished map[snapshot.SourceInfo]bool
+}
+
+func (s *bandwidthSchedule) start(si snapshot.SourceInfo, p policy.ThrottlingPolicy) {
+	s.mu.Lock()
+	s.active[si] = p
+	delete(s.finished, si)
+	s.mu.Unlock()
+
+	s.apply(time.Now())
+}
+
+func (s *bandwidthSchedule) finish(si snapshot.SourceInfo) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.finished[si] = true
+}
+
+// flushed removes policies of finished sources after their data has been written.
+func (s *bandwidthSchedule) flushed() {
+	s.mu.Lock()
+	for si := range s.finished {
+		delete(s.active, si)
+	}
+
+	s.finished = map[snapshot.SourceInfo]bool{}
+	s.mu.Unlock()
+
+	s.apply(time.Now())
+}
+
+// apply sets the limits of all active policies in effect at the provided time.
+func (s *bandwidthSchedule) apply(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var upload, download int64
+
+	for _, p := range s.active {
+		u, d := p.LimitsAt(now)
+		upload = minSpeedLimit(upload, u)
+		download = minSpeedLimit(download, d)
+	}
+
+	s.limiter.SetLimits(upload, download)
+}
+
+// run re-evaluates bandwidth windows until the context is canceled.
+func (s *bandwidthSchedule) run(ctx context.Context) {
+	t := time.NewTicker(bandwidthScheduleInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-t.C:
+			s.apply(now)
+		}
+	}
+}
+
+func newBandwidthSchedule(l *throttling.Limiter) *bandwidthSchedule {
+	return &bandwidthSchedule{
+		limiter:  l,
+		active:   map[snapshot.SourceInfo]policy.ThrottlingPolicy{},
+		finished: map[snapshot.SourceInfo]bool{},
+	}
+}
+
+// minSpeedLimit returns the more restrictive of two speed limits, where zero means unlimited.
+func minSpeedLimit(a, b int64) int64 {
+	if a <= 0 || (b > 0 && b < a) {
+		return b
+	}
+
+	return a
+}
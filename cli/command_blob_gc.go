@@ -2,15 +2,11 @@ package cli
 
 import (
 	"context"
-	"time"
 
-	"github.com/pkg/errors"
-	"golang.org/x/sync/errgroup"
-
-	"github.com/kopia/kopia/internal/stats"
 	"github.com/kopia/kopia/internal/units"
 	"github.com/kopia/kopia/repo"
-	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/content"
+	"github.com/kopia/kopia/repo/lock"
 )
 
 var (
@@ -18,77 +14,57 @@ var (
 	blobGarbageCollectCommandDelete = blobGarbageCollectCommand.Flag("delete", "Whether to delete unused blobs").String()
 	blobGarbageCollectParallel      = blobGarbageCollectCommand.Flag("parallel", "Number of parallel blob scans").Default("16").Int()
 	blobGarbageCollectMinAge        = blobGarbageCollectCommand.Flag("min-age", "Garbage-collect blobs with minimum age").Default("24h").Duration()
+	blobGarbageCollectGracePeriod   = blobGarbageCollectCommand.Flag("grace-period", "Minimum time between scheduling unused blobs for deletion and deleting them, must exceed index cache duration of all clients").Default("1h").Duration()
 )
 
 func runBlobGarbageCollectCommand(ctx context.Context, rep *repo.Repository) error {
-	const deleteQueueSize = 100
-
-	var unreferenced, deleted stats.CountSum
-
-	var eg errgroup.Group
-
-	unused := make(chan blob.Metadata, deleteQueueSize)
-
-	if *blobGarbageCollectCommandDelete == "yes" {
-		// start goroutines to delete blobs as they come.
-		for i := 0; i < *blobGarbageCollectParallel; i++ {
-			eg.Go(func() error {
-				for bm := range unused {
-					if err := rep.Blobs.DeleteBlob(ctx, bm.BlobID); err != nil {
-						return errors.Wrapf(err, "unable to delete blob %q", bm.BlobID)
-					}
-					cnt, del := deleted.Add(bm.Length)
-					if cnt%100 == 0 {
-						printStderr("  deleted %v unreferenced blobs (%v)\n", cnt, units.BytesStringBase10(del))
-					}
-				}
-
-				return nil
-			})
-		}
-	}
-
-	// iterate unreferenced blobs and count them + optionally send to the channel to be deleted
-	printStderr("Looking for unreferenced blobs...\n")
+	dryRun := *blobGarbageCollectCommandDelete != "yes"
 
-	if err := rep.Content.IterateUnreferencedBlobs(ctx, *blobGarbageCollectParallel, func(bm blob.Metadata) error {
-		if age := time.Since(bm.Timestamp); age < *blobGarbageCollectMinAge {
-			printStderr("  preserving %v because it's too new (age: %v)\n", bm.BlobID, age)
-			return nil
+	if !dryRun {
+		lockedCtx, release, err := lockRepository(ctx, rep, lock.Exclusive, "blob gc")
+		if err != nil {
+			return err
 		}
 
-		unreferenced.Add(bm.Length)
-
-		if *blobGarbageCollectCommandDelete == "yes" {
-			unused <- bm
-		}
+		defer release()
 
-		return nil
-	}); err != nil {
-		return errors.Wrap(err, "error looking for unreferenced blobs")
+		ctx = lockedCtx
 	}
 
-	close(unused)
-
-	unreferencedCount, unreferencedSize := unreferenced.Approximate()
-	printStderr("Found %v blobs to delete (%v)\n", unreferencedCount, units.BytesStringBase10(unreferencedSize))
+	printStderr("Looking for unreferenced blobs...\n")
 
-	// wait for all delete workers to finish.
-	if err := eg.Wait(); err != nil {
+	st, err := rep.Content.DeleteUnreferencedBlobs(ctx, content.BlobGCOptions{
+		MinAge:      *blobGarbageCollectMinAge,
+		GracePeriod: *blobGarbageCollectGracePeriod,
+		Parallel:    *blobGarbageCollectParallel,
+		DryRun:      dryRun,
+	})
+	if err != nil {
 		return err
 	}
 
-	if *blobGarbageCollectCommandDelete != "yes" {
-		if unreferencedCount > 0 {
+	if st.TooRecentCount > 0 {
+		printStderr("Preserving %v unreferenced blobs because they are too new (%v)\n", st.TooRecentCount, units.BytesStringBase10(st.TooRecentBytes))
+	}
+
+	if st.PendingCount > 0 {
+		printStderr("Waiting for grace period to delete %v blobs (%v)\n", st.PendingCount, units.BytesStringBase10(st.PendingBytes))
+	}
+
+	if dryRun {
+		printStderr("Found %v blobs to schedule for deletion (%v) and %v blobs to delete (%v)\n",
+			st.TombstonedCount, units.BytesStringBase10(st.TombstonedBytes),
+			st.DeletedCount, units.BytesStringBase10(st.DeletedBytes))
+
+		if st.TombstonedCount+st.DeletedCount > 0 {
 			printStderr("Pass --delete=yes to delete.\n")
 		}
 
 		return nil
 	}
 
-	del, cnt := deleted.Approximate()
-
-	printStderr("Deleted total %v unreferenced blobs (%v)\n", del, units.BytesStringBase10(cnt))
+	printStderr("Scheduled %v unreferenced blobs for deletion after %v (%v)\n", st.TombstonedCount, *blobGarbageCollectGracePeriod, units.BytesStringBase10(st.TombstonedBytes))
+	printStderr("Deleted total %v unreferenced blobs (%v)\n", st.DeletedCount, units.BytesStringBase10(st.DeletedBytes))
 
 	return nil
 }
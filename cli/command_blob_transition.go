@@ -0,0 +1,39 @@
+package cli
+
+import (
+	"context"
+
+	"github.com/kopia/kopia/internal/units"
+	"github.com/kopia/kopia/repo"
+)
+
+var (
+	blobTransitionCommand = blobCommands.Command("transition", "Move old data pack blobs to the storage class specified in the repository policy")
+	blobTransitionDryRun  = blobTransitionCommand.Flag("dry-run", "Only list blobs that would be transitioned").Bool()
+)
+
+func runBlobTransitionCommand(ctx context.Context, rep *repo.Repository) error {
+	blobs, err := rep.Content.TransitionOldPacks(ctx, *blobTransitionDryRun)
+	if err != nil {
+		return err
+	}
+
+	var total int64
+
+	for _, b := range blobs {
+		total += b.Length
+	}
+
+	if *blobTransitionDryRun {
+		printStderr("Would transition %v blobs (%v) to %v\n", len(blobs), units.BytesStringBase10(total), rep.Content.Format.StorageClasses.OldData)
+		return nil
+	}
+
+	printStderr("Transitioned %v blobs (%v) to %v\n", len(blobs), units.BytesStringBase10(total), rep.Content.Format.StorageClasses.OldData)
+
+	return nil
+}
+
+func init() {
+	blobTransitionCommand.Action(repositoryAction(runBlobTransitionCommand))
+}
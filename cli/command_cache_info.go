@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"path/filepath"
+	"sort"
 
 	"github.com/pkg/errors"
 
@@ -53,6 +54,22 @@ func runCacheInfoCommand(ctx context.Context, rep *repo.Repository) error {
 		fmt.Printf("%v: %v files %v%v\n", subdir, fileCount, units.BytesStringBase10(totalFileSize), maybeLimit)
 	}
 
+	pins, err := rep.Content.PinnedContents(ctx)
+	if err != nil {
+		return errors.Wrap(err, "unable to list pinned contents")
+	}
+
+	var pinNames []string
+	for n := range pins {
+		pinNames = append(pinNames, n)
+	}
+
+	sort.Strings(pinNames)
+
+	for _, n := range pinNames {
+		fmt.Printf("pinned %v: %v contents\n", n, pins[n])
+	}
+
 	return nil
 }
 
@@ -0,0 +1,69 @@
+package cli
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/snapshot/snapshotfs"
+)
+
+// pinProgressInterval is the number of contents between progress reports when pinning.
+const pinProgressInterval = 1000
+
+var (
+	cachePinCommand = cacheCommands.Command("pin", "Download all contents of a snapshot directory into the local cache and keep them there")
+	cachePinPath    = cachePinCommand.Arg("object-path", "Path of the snapshot directory").Required().String()
+
+	cacheUnpinCommand = cacheCommands.Command("unpin", "Allow contents of a pinned snapshot directory to be removed from the local cache")
+	cacheUnpinPath    = cacheUnpinCommand.Arg("object-path", "Path of the snapshot directory").Required().String()
+)
+
+func runCachePinCommand(ctx context.Context, rep *repo.Repository) error {
+	oid, err := parseObjectID(ctx, rep, *cachePinPath)
+	if err != nil {
+		return err
+	}
+
+	contentIDs, err := snapshotfs.ReferencedContents(ctx, rep, oid)
+	if err != nil {
+		return errors.Wrap(err, "unable to find contents")
+	}
+
+	printStderr("Pinning %v contents of %v...\n", len(contentIDs), oid)
+
+	if err := rep.Content.PinContents(ctx, oid.String(), contentIDs, func(done int) {
+		if done%pinProgressInterval == 0 {
+			printStderr("Pinned %v of %v contents.\n", done, len(contentIDs))
+		}
+	}); err != nil {
+		return errors.Wrap(err, "unable to pin contents")
+	}
+
+	printStderr("Pinned %v contents.\n", len(contentIDs))
+
+	return nil
+}
+
+func runCacheUnpinCommand(ctx context.Context, rep *repo.Repository) error {
+	oid, err := parseObjectID(ctx, rep, *cacheUnpinPath)
+	if err != nil {
+		return err
+	}
+
+	if err := rep.Content.UnpinContents(ctx, oid.String()); err != nil {
+		return err
+	}
+
+	printStderr("Unpinned %v.\n", oid)
+
+	return nil
+}
+
+func init() {
+	cachePinCommand.GetArg("object-path").HintAction(completeSnapshotRoots)
+	cacheUnpinCommand.GetArg("object-path").HintAction(completeSnapshotRoots)
+	cachePinCommand.Action(repositoryAction(runCachePinCommand))
+	cacheUnpinCommand.Action(repositoryAction(runCacheUnpinCommand))
+}
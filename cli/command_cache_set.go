@@ -16,6 +16,8 @@ var (
 	cacheSetContentCacheSizeMB     = cacheSetParamsCommand.Flag("content-cache-size-mb", "Size of local content cache").PlaceHolder("MB").Default("-1").Int64()
 	cacheSetMaxMetadataCacheSizeMB = cacheSetParamsCommand.Flag("metadata-cache-size-mb", "Size of local metadata cache").PlaceHolder("MB").Default("-1").Int64()
 	cacheSetMaxListCacheDuration   = cacheSetParamsCommand.Flag("max-list-cache-duration", "Duration of index cache").Default("-1ns").Duration()
+	cacheSetMaxFormatCacheDuration = cacheSetParamsCommand.Flag("max-format-cache-duration", "Duration for which the cached repository format is used (0 - indefinitely)").Default("-1ns").Duration()
+	cacheSetManifestMirror         = cacheSetParamsCommand.Flag("manifest-mirror", "Keep a local copy of manifests for instant and offline snapshot listing").Enum("true", "false")
 )
 
 func runCacheSetCommand(ctx context.Context, rep *repo.Repository) error {
@@ -49,6 +51,18 @@ func runCacheSetCommand(ctx context.Context, rep *repo.Repository) error {
 		changed++
 	}
 
+	if v := *cacheSetMaxFormatCacheDuration; v != -1 {
+		log(ctx).Infof("changing format cache duration to %v", v)
+		opts.MaxFormatCacheDurationSec = int(v.Seconds())
+		changed++
+	}
+
+	if v := *cacheSetManifestMirror; v != "" {
+		log(ctx).Infof("setting manifest mirror to %v", v)
+		opts.ManifestMirror = v == "true"
+		changed++
+	}
+
 	if changed == 0 {
 		return errors.Errorf("no changes")
 	}
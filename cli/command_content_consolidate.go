@@ -0,0 +1,71 @@
+package cli
+
+import (
+	"context"
+
+	"github.com/kopia/kopia/internal/units"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/content"
+	"github.com/kopia/kopia/repo/lock"
+)
+
+var (
+	contentConsolidateCommand          = contentCommands.Command("consolidate", "Merge small packs, such as those written by small incremental snapshots, into full-size packs to reduce the number of blobs and storage requests")
+	contentConsolidateSmallPackPercent = contentConsolidateCommand.Flag("small-pack-percent", "Consolidate packs smaller than the percentage of the maximum pack size").Default("50").Int()
+	contentConsolidateMinPacks         = contentConsolidateCommand.Flag("min-packs", "Minimum number of small packs to consolidate").Default("10").Int()
+	contentConsolidateMinAge           = contentConsolidateCommand.Flag("min-age", "Minimum age of consolidated packs to delete").Default("24h").Duration()
+	contentConsolidateGracePeriod      = contentConsolidateCommand.Flag("grace-period", "Minimum time between scheduling consolidated packs for deletion and deleting them, must exceed index cache duration of all clients").Default("1h").Duration()
+	contentConsolidateParallel         = contentConsolidateCommand.Flag("parallel", "Number of parallel workers").Default("16").Int()
+	contentConsolidateDryRun           = contentConsolidateCommand.Flag("dry-run", "Do not actually consolidate, only print what would happen").Short('n').Bool()
+)
+
+func runContentConsolidateCommand(ctx context.Context, rep *repo.Repository) error {
+	if !*contentConsolidateDryRun {
+		lockedCtx, release, err := lockRepository(ctx, rep, lock.Exclusive, "content consolidate")
+		if err != nil {
+			return err
+		}
+
+		defer release()
+
+		ctx = lockedCtx
+	}
+
+	st, err := rep.Content.ConsolidateSmallPacks(ctx, content.PackConsolidationOptions{
+		SmallPackPercent: *contentConsolidateSmallPackPercent,
+		MinPackCount:     *contentConsolidateMinPacks,
+		BlobGC: content.BlobGCOptions{
+			MinAge:      *contentConsolidateMinAge,
+			GracePeriod: *contentConsolidateGracePeriod,
+			Parallel:    *contentConsolidateParallel,
+		},
+		Parallel: *contentConsolidateParallel,
+		DryRun:   *contentConsolidateDryRun,
+	})
+	if err != nil {
+		return err
+	}
+
+	printStderr("Found %v small packs (%v).\n", st.PackCount, units.BytesStringBase10(st.PackBytes))
+
+	switch {
+	case st.RewrittenCount == 0:
+		printStderr("Not consolidating fewer than %v small packs or packs whose contents would not fill a pack that is not small.\n", *contentConsolidateMinPacks)
+	case *contentConsolidateDryRun:
+		printStderr("Would rewrite %v contents (%v).\n", st.RewrittenCount, units.BytesStringBase10(st.RewrittenBytes))
+	default:
+		printStderr("Rewrote %v contents (%v).\n", st.RewrittenCount, units.BytesStringBase10(st.RewrittenBytes))
+	}
+
+	if !*contentConsolidateDryRun {
+		printStderr("Scheduled %v unreferenced packs for deletion after %v (%v), deleted %v packs (%v).\n",
+			st.BlobGC.TombstonedCount, *contentConsolidateGracePeriod, units.BytesStringBase10(st.BlobGC.TombstonedBytes),
+			st.BlobGC.DeletedCount, units.BytesStringBase10(st.BlobGC.DeletedBytes))
+	}
+
+	return nil
+}
+
+func init() {
+	contentConsolidateCommand.Action(repositoryAction(runContentConsolidateCommand))
+}
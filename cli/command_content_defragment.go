@@ -0,0 +1,68 @@
+package cli
+
+import (
+	"context"
+
+	"github.com/kopia/kopia/internal/units"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/content"
+	"github.com/kopia/kopia/repo/lock"
+)
+
+var (
+	contentDefragmentCommand         = contentCommands.Command("defragment", "Rewrite contents in use from packs containing mostly deleted contents and delete the packs")
+	contentDefragmentMinWastePercent = contentDefragmentCommand.Flag("min-waste-percent", "Minimum percentage of deleted data in a pack to rewrite it").Default("50").Int()
+	contentDefragmentMinWasteMB      = contentDefragmentCommand.Flag("min-waste-mb", "Minimum amount of deleted data in a pack to rewrite it").Default("0").Int64()
+	contentDefragmentDeletedMinAge   = contentDefragmentCommand.Flag("deleted-min-age", "Minimum age of deleted contents to drop from indexes, must exceed the duration of snapshots").Default("24h").Duration()
+	contentDefragmentMinAge          = contentDefragmentCommand.Flag("min-age", "Minimum age of unreferenced packs to delete").Default("24h").Duration()
+	contentDefragmentGracePeriod     = contentDefragmentCommand.Flag("grace-period", "Minimum time between scheduling unreferenced packs for deletion and deleting them, must exceed index cache duration of all clients").Default("1h").Duration()
+	contentDefragmentParallel        = contentDefragmentCommand.Flag("parallel", "Number of parallel workers").Default("16").Int()
+	contentDefragmentDryRun          = contentDefragmentCommand.Flag("dry-run", "Do not actually rewrite, only print what would happen").Short('n').Bool()
+)
+
+func runContentDefragmentCommand(ctx context.Context, rep *repo.Repository) error {
+	if !*contentDefragmentDryRun {
+		lockedCtx, release, err := lockRepository(ctx, rep, lock.Exclusive, "content defragment")
+		if err != nil {
+			return err
+		}
+
+		defer release()
+
+		ctx = lockedCtx
+	}
+
+	st, err := rep.Content.RewriteWastefulPacks(ctx, content.PackRewriteOptions{
+		MinWastePercent:      *contentDefragmentMinWastePercent,
+		MinWasteBytes:        *contentDefragmentMinWasteMB << 20, //nolint:gomnd
+		DeletedContentMinAge: *contentDefragmentDeletedMinAge,
+		BlobGC: content.BlobGCOptions{
+			MinAge:      *contentDefragmentMinAge,
+			GracePeriod: *contentDefragmentGracePeriod,
+			Parallel:    *contentDefragmentParallel,
+		},
+		Parallel: *contentDefragmentParallel,
+		DryRun:   *contentDefragmentDryRun,
+	})
+	if err != nil {
+		return err
+	}
+
+	printStderr("Found %v packs (%v) with %v of deleted contents.\n", st.PackCount, units.BytesStringBase10(st.PackBytes), units.BytesStringBase10(st.WasteBytes))
+
+	if *contentDefragmentDryRun {
+		printStderr("Would rewrite %v contents (%v).\n", st.RewrittenCount, units.BytesStringBase10(st.RewrittenBytes))
+		return nil
+	}
+
+	printStderr("Rewrote %v contents (%v).\n", st.RewrittenCount, units.BytesStringBase10(st.RewrittenBytes))
+	printStderr("Scheduled %v unreferenced packs for deletion after %v (%v), deleted %v packs (%v).\n",
+		st.BlobGC.TombstonedCount, *contentDefragmentGracePeriod, units.BytesStringBase10(st.BlobGC.TombstonedBytes),
+		st.BlobGC.DeletedCount, units.BytesStringBase10(st.BlobGC.DeletedBytes))
+
+	return nil
+}
+
+func init() {
+	contentDefragmentCommand.Action(repositoryAction(runContentDefragmentCommand))
+}
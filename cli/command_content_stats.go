@@ -5,17 +5,27 @@ import (
 	"fmt"
 	"strconv"
 
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/fs"
 	"github.com/kopia/kopia/internal/units"
 	"github.com/kopia/kopia/repo"
 	"github.com/kopia/kopia/repo/content"
+	"github.com/kopia/kopia/snapshot/snapshotfs"
 )
 
 var (
 	contentStatsCommand = contentCommands.Command("stats", "Content statistics")
 	contentStatsRaw     = contentStatsCommand.Flag("raw", "Raw numbers").Short('r').Bool()
+	contentStatsPath    = contentStatsCommand.Flag("path", "Attribute unique and shared bytes to subtrees of the given snapshot directory").PlaceHolder("OBJECT-ID[/PATH]").String()
+	contentStatsDepth   = contentStatsCommand.Flag("max-depth", "Maximum depth of subtrees reported with --path").Default("1").Int()
 )
 
 func runContentStatsCommand(ctx context.Context, rep *repo.Repository) error {
+	if *contentStatsPath != "" {
+		return runContentStatsForPath(ctx, rep)
+	}
+
 	var sizeThreshold uint32 = 10
 
 	countMap := map[uint32]int{}
@@ -80,6 +90,46 @@ func runContentStatsCommand(ctx context.Context, rep *repo.Repository) error {
 	return nil
 }
 
+func runContentStatsForPath(ctx context.Context, rep *repo.Repository) error {
+	oid, err := parseObjectID(ctx, rep, *contentStatsPath)
+	if err != nil {
+		return err
+	}
+
+	dir, ok := snapshotfs.DirectoryEntry(rep, oid, nil).(fs.Directory)
+	if !ok {
+		return errors.Errorf("%v is not a directory", *contentStatsPath)
+	}
+
+	stats, err := snapshotfs.CalculateSubtreeStats(ctx, rep, dir, *contentStatsDepth)
+	if err != nil {
+		return err
+	}
+
+	sizeToString := units.BytesStringBase10
+	if *contentStatsRaw {
+		sizeToString = func(l int64) string { return strconv.FormatInt(l, 10) }
+	}
+
+	fmt.Printf("%12v %12v %12v %9v  %v\n", "UNIQUE", "SHARED", "TOTAL", "CONTENTS", "PATH")
+
+	for _, s := range stats {
+		p := s.Path
+		if p == "" {
+			p = "."
+		}
+
+		fmt.Printf("%12v %12v %12v %9v  %v\n",
+			sizeToString(s.UniqueBytes),
+			sizeToString(s.SharedBytes()),
+			sizeToString(s.TotalBytes),
+			s.ContentCount,
+			p)
+	}
+
+	return nil
+}
+
 func init() {
 	contentStatsCommand.Action(repositoryAction(runContentStatsCommand))
 }
@@ -1,7 +1,9 @@
 package cli
 
 import (
+	"bytes"
 	"context"
+	"os"
 	"sync/atomic"
 
 	"github.com/pkg/errors"
@@ -17,12 +19,62 @@ var (
 	contentVerifyIDs      = contentVerifyCommand.Arg("id", "IDs of blocks to show (or 'all')").Required().Strings()
 	contentVerifyParallel = contentVerifyCommand.Flag("parallel", "Parallelism").Default("16").Int()
 	contentVerifyFull     = contentVerifyCommand.Flag("full", "Full verification (including download)").Bool()
+	contentVerifyReplica  = contentVerifyCommand.Flag("replica-config", "Config file of a connection to a replica of the repository, such as a bucket replicated by the provider, to read each content from and compare").ExistingFile()
 )
 
+// openReplica opens the repository replica described by the provided config file without using any cache,
+// so that all contents are read from the replica.
+func openReplica(ctx context.Context, rep *repo.Repository, configFile string) (*repo.Repository, error) {
+	f, err := os.Open(configFile) //nolint:gosec
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to open replica config")
+	}
+	defer f.Close() //nolint:errcheck
+
+	var lc repo.LocalConfig
+	if err := lc.Load(f); err != nil {
+		return nil, errors.Wrap(err, "unable to load replica config")
+	}
+
+	st, err := blob.NewStorage(ctx, lc.Storage)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to open replica storage")
+	}
+
+	pass, err := getPasswordFromFlags(ctx, false, true)
+	if err != nil {
+		return nil, errors.Wrap(err, "get password")
+	}
+
+	replica, err := repo.OpenWithConfig(ctx, st, &lc, pass, &repo.Options{}, content.CachingOptions{})
+	if err != nil {
+		st.Close(ctx) //nolint:errcheck
+		return nil, errors.Wrap(err, "unable to open replica")
+	}
+
+	if !bytes.Equal(replica.UniqueID, rep.UniqueID) {
+		replica.Close(ctx) //nolint:errcheck
+		return nil, errors.New("replica config is for a different repository")
+	}
+
+	return replica, nil
+}
+
 func runContentVerifyCommand(ctx context.Context, rep *repo.Repository) error {
 	blobMap := map[blob.ID]blob.Metadata{}
 
-	if !*contentVerifyFull {
+	var replica *repo.Repository
+
+	if *contentVerifyReplica != "" {
+		r, err := openReplica(ctx, rep, *contentVerifyReplica)
+		if err != nil {
+			return err
+		}
+
+		defer r.Close(ctx) //nolint:errcheck
+
+		replica = r
+	} else if !*contentVerifyFull {
 		printStderr("Listing blobs...\n")
 
 		if err := rep.Blobs.ListBlobs(ctx, "", func(bm blob.Metadata) error {
@@ -40,7 +92,7 @@ func runContentVerifyCommand(ctx context.Context, rep *repo.Repository) error {
 
 	for _, contentID := range toContentIDs(*contentVerifyIDs) {
 		if contentID == "all" {
-			return verifyAllContents(ctx, rep, blobMap)
+			return verifyAllContents(ctx, rep, replica, blobMap)
 		}
 
 		ci, err := rep.Content.ContentInfo(ctx, contentID)
@@ -48,7 +100,7 @@ func runContentVerifyCommand(ctx context.Context, rep *repo.Repository) error {
 			return errors.Wrapf(err, "unable to get content info: %v", contentID)
 		}
 
-		if err := contentVerify(ctx, rep, &ci, blobMap); err != nil {
+		if err := contentVerify(ctx, rep, replica, &ci, blobMap); err != nil {
 			return err
 		}
 	}
@@ -56,7 +108,7 @@ func runContentVerifyCommand(ctx context.Context, rep *repo.Repository) error {
 	return nil
 }
 
-func verifyAllContents(ctx context.Context, rep *repo.Repository, blobMap map[blob.ID]blob.Metadata) error {
+func verifyAllContents(ctx context.Context, rep, replica *repo.Repository, blobMap map[blob.ID]blob.Metadata) error {
 	var totalCount, successCount, errorCount int32
 
 	printStderr("Verifying all contents...\n")
@@ -64,7 +116,7 @@ func verifyAllContents(ctx context.Context, rep *repo.Repository, blobMap map[bl
 	err := rep.Content.IterateContents(ctx, content.IterateOptions{
 		Parallel: *contentVerifyParallel,
 	}, func(ci content.Info) error {
-		if err := contentVerify(ctx, rep, &ci, blobMap); err != nil {
+		if err := contentVerify(ctx, rep, replica, &ci, blobMap); err != nil {
 			log(ctx).Errorf("error %v", err)
 			atomic.AddInt32(&errorCount, 1)
 		} else {
@@ -91,7 +143,11 @@ func verifyAllContents(ctx context.Context, rep *repo.Repository, blobMap map[bl
 	return errors.Errorf("encountered %v errors", errorCount)
 }
 
-func contentVerify(ctx context.Context, r *repo.Repository, ci *content.Info, blobMap map[blob.ID]blob.Metadata) error {
+func contentVerify(ctx context.Context, r, replica *repo.Repository, ci *content.Info, blobMap map[blob.ID]blob.Metadata) error {
+	if replica != nil {
+		return verifyReplicaContent(ctx, r, replica, ci)
+	}
+
 	if *contentVerifyFull {
 		if _, err := r.Content.GetContent(ctx, ci.ID); err != nil {
 			return errors.Wrapf(err, "content %v is invalid", ci.ID)
@@ -112,6 +168,25 @@ func contentVerify(ctx context.Context, r *repo.Repository, ci *content.Info, bl
 	return nil
 }
 
+// verifyReplicaContent verifies that the content can be read from the replica and matches the original.
+func verifyReplicaContent(ctx context.Context, r, replica *repo.Repository, ci *content.Info) error {
+	want, err := r.Content.GetContent(ctx, ci.ID)
+	if err != nil {
+		return errors.Wrapf(err, "content %v is invalid", ci.ID)
+	}
+
+	got, err := replica.Content.GetContent(ctx, ci.ID)
+	if err != nil {
+		return errors.Wrapf(err, "content %v can't be read from the replica", ci.ID)
+	}
+
+	if !bytes.Equal(got, want) {
+		return errors.Errorf("content %v differs in the replica", ci.ID)
+	}
+
+	return nil
+}
+
 func init() {
 	contentVerifyCommand.Action(repositoryAction(runContentVerifyCommand))
 }
@@ -0,0 +1,193 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+
+	"github.com/pkg/errors"
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+
+	"github.com/kopia/kopia/internal/server"
+	"github.com/kopia/kopia/internal/serverapi"
+	"github.com/kopia/kopia/repo"
+)
+
+var (
+	daemonCommands = app.Command("daemon", "Commands to control background daemon which keeps the repository connected and snapshots scheduled.")
+	daemonSocket   = daemonCommands.Flag("socket", "Path of the daemon control socket (defaults to repository config file name with '.sock' suffix)").String()
+	useDaemon      = app.Flag("daemon", "Perform 'snapshot create' and 'snapshot list' without command-specific flags using the daemon when it's running, instead of opening the repository").Default("true").Bool()
+
+	daemonStartCommand         = daemonCommands.Command("start", "Run the daemon in the foreground")
+	daemonStartRefreshInterval = daemonStartCommand.Flag("refresh-interval", "Frequency for refreshing repository status").Default("10s").Duration()
+
+	daemonStatusCommand = daemonCommands.Command("status", "Show status of the daemon")
+	daemonStopCommand   = daemonCommands.Command("stop", "Stop the daemon")
+)
+
+func init() {
+	setupConnectOptions(daemonStartCommand)
+	daemonStartCommand.Action(optionalRepositoryAction(runDaemonStart))
+	daemonStatusCommand.Action(noRepositoryAction(runDaemonStatus))
+	daemonStopCommand.Action(noRepositoryAction(runDaemonStop))
+}
+
+func daemonSocketPath() string {
+	if *daemonSocket != "" {
+		return *daemonSocket
+	}
+
+	return repositoryConfigFileName() + ".sock"
+}
+
+// isDaemonRunning determines whether a daemon is accepting connections on the given socket.
+func isDaemonRunning(socketPath string) bool {
+	conn, err := net.Dial("unix", socketPath)
+	if err != nil {
+		return false
+	}
+
+	conn.Close() //nolint:errcheck
+
+	return true
+}
+
+// errDaemonUnsupported is returned by commands performed using the daemon when the request can only be handled locally.
+var errDaemonUnsupported = errors.New("not supported by the daemon")
+
+// daemonCapableAction returns an action that performs the command using the daemon when it's running and none of the
+// command's own flags were provided, so that the command doesn't pay the cost of opening the repository, and runs
+// the local action otherwise.
+func daemonCapableAction(cmd *kingpin.CmdClause, remote func(ctx context.Context, cli *serverapi.Client) error, local kingpin.Action) kingpin.Action {
+	return func(kpc *kingpin.ParseContext) error {
+		if !*useDaemon || hasCommandFlags(kpc, cmd) || !isDaemonRunning(daemonSocketPath()) {
+			return local(kpc)
+		}
+
+		cli, err := serverapi.NewClient(serverapi.ClientOptions{BaseURL: "unix:" + daemonSocketPath()})
+		if err != nil {
+			return errors.Wrap(err, "unable to create daemon client")
+		}
+
+		err = remote(rootContext(), cli)
+		if errors.Is(err, errDaemonUnsupported) {
+			return local(kpc)
+		}
+
+		return err
+	}
+}
+
+// hasCommandFlags returns true if any of the command's own flags were provided on the command line or in the environment.
+func hasCommandFlags(kpc *kingpin.ParseContext, cmd *kingpin.CmdClause) bool {
+	for _, e := range kpc.Elements {
+		if f, ok := e.Clause.(*kingpin.FlagClause); ok && cmd.GetFlag(f.Model().Name) == f {
+			return true
+		}
+	}
+
+	for _, f := range cmd.Model().Flags {
+		if cmd.GetFlag(f.Name).HasEnvarValue() {
+			return true
+		}
+	}
+
+	return false
+}
+
+func runDaemonStart(ctx context.Context, rep *repo.Repository) error {
+	socketPath := daemonSocketPath()
+
+	if isDaemonRunning(socketPath) {
+		return errors.Errorf("daemon is already running at %v", socketPath)
+	}
+
+	// remove socket left behind by a daemon that did not shut down cleanly.
+	if err := os.Remove(socketPath); err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "unable to remove stale daemon socket")
+	}
+
+	l, err := listenDaemonSocket(socketPath)
+	if err != nil {
+		return errors.Wrap(err, "listen error")
+	}
+	defer l.Close() //nolint:errcheck
+
+	srv, err := server.New(ctx, rep, server.Options{
+		ConfigFile:      repositoryConfigFileName(),
+		ConnectOptions:  connectOptions(),
+		RefreshInterval: *daemonStartRefreshInterval,
+	})
+	if err != nil {
+		return errors.Wrap(err, "unable to initialize daemon")
+	}
+
+	if err = srv.SetRepository(ctx, rep); err != nil {
+		return errors.Wrap(err, "error connecting to repository")
+	}
+
+	httpServer := &http.Server{Handler: srv.APIHandlers()}
+	srv.OnShutdown = httpServer.Shutdown
+
+	onCtrlC(func() {
+		log(ctx).Infof("Shutting down...")
+
+		if err = httpServer.Shutdown(ctx); err != nil {
+			log(ctx).Warningf("unable to shut down: %v", err)
+		}
+	})
+
+	fmt.Fprintf(os.Stderr, "DAEMON SOCKET: %v\n", socketPath)
+
+	if err = httpServer.Serve(l); err != http.ErrServerClosed {
+		return err
+	}
+
+	return srv.SetRepository(ctx, nil)
+}
+
+func daemonClient() (*serverapi.Client, error) {
+	socketPath := daemonSocketPath()
+
+	if !isDaemonRunning(socketPath) {
+		return nil, errors.Errorf("daemon is not running at %v", socketPath)
+	}
+
+	return serverapi.NewClient(serverapi.ClientOptions{BaseURL: "unix:" + socketPath})
+}
+
+func runDaemonStatus(ctx context.Context) error {
+	cli, err := daemonClient()
+	if err != nil {
+		return err
+	}
+
+	var status serverapi.StatusResponse
+	if err := cli.Get(ctx, "repo/status", &status); err != nil {
+		return err
+	}
+
+	var sources serverapi.SourcesResponse
+	if err := cli.Get(ctx, "sources", &sources); err != nil {
+		return err
+	}
+
+	fmt.Printf("Daemon socket:    %v\n", daemonSocketPath())
+	fmt.Printf("Connected:        %v\n", status.Connected)
+	fmt.Printf("Config file:      %v\n", status.ConfigFile)
+	fmt.Printf("Storage:          %v\n", status.Storage)
+	fmt.Printf("Sources:          %v\n", len(sources.Sources))
+
+	return nil
+}
+
+func runDaemonStop(ctx context.Context) error {
+	cli, err := daemonClient()
+	if err != nil {
+		return err
+	}
+
+	return cli.Post(ctx, "shutdown", &serverapi.Empty{}, &serverapi.Empty{})
+}
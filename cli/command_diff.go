@@ -70,5 +70,7 @@ func defaultDiffCommand() string {
 }
 
 func init() {
+	diffCommand.GetArg("object-path1").HintAction(completeSnapshotRoots)
+	diffCommand.GetArg("object-path2").HintAction(completeSnapshotRoots)
 	diffCommand.Action(repositoryAction(runDiffCommand))
 }
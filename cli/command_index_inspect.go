@@ -0,0 +1,78 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/content"
+)
+
+var (
+	blockIndexInspectCommand   = indexCommands.Command("inspect", "Inspect entries stored in index blobs")
+	blockIndexInspectBlobIDs   = blockIndexInspectCommand.Arg("blobs", "Names of index blobs to inspect").Strings()
+	blockIndexInspectAll       = blockIndexInspectCommand.Flag("all", "Inspect all active index blobs").Bool()
+	blockIndexInspectPrefix    = blockIndexInspectCommand.Flag("prefix", "Only show entries for contents with the provided prefix").String()
+	blockIndexInspectContentID = blockIndexInspectCommand.Flag("content-id", "Only show entries for the provided content IDs").Strings()
+)
+
+func runInspectIndexAction(ctx context.Context, rep *repo.Repository) error {
+	var blobIDs []blob.ID
+
+	for _, b := range *blockIndexInspectBlobIDs {
+		blobIDs = append(blobIDs, blob.ID(b))
+	}
+
+	if *blockIndexInspectAll {
+		blks, err := rep.Content.IndexBlobs(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, b := range blks {
+			blobIDs = append(blobIDs, b.BlobID)
+		}
+	}
+
+	if len(blobIDs) == 0 {
+		return errors.New("no index blobs to inspect, provide blob names or --all")
+	}
+
+	contentIDs := map[content.ID]bool{}
+	for _, cid := range *blockIndexInspectContentID {
+		contentIDs[content.ID(cid)] = true
+	}
+
+	for _, blobID := range blobIDs {
+		if err := rep.Content.IterateIndexBlobContents(ctx, blobID, content.ID(*blockIndexInspectPrefix), func(ci content.Info) error {
+			if len(contentIDs) > 0 && !contentIDs[ci.ID] {
+				return nil
+			}
+
+			printIndexEntry(blobID, ci)
+
+			return nil
+		}); err != nil {
+			return errors.Wrapf(err, "error inspecting index blob %v", blobID)
+		}
+	}
+
+	return nil
+}
+
+func printIndexEntry(indexBlobID blob.ID, ci content.Info) {
+	state := "created"
+	if ci.Deleted {
+		state = "deleted"
+	}
+
+	fmt.Printf("%v %v %v %v %v %v+%v\n",
+		indexBlobID, ci.ID, formatTimestampPrecise(ci.Timestamp()), state, ci.PackBlobID, ci.PackOffset, ci.Length)
+}
+
+func init() {
+	blockIndexInspectCommand.Action(repositoryAction(runInspectIndexAction))
+}
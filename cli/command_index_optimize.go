@@ -19,6 +19,7 @@ func runOptimizeCommand(ctx context.Context, rep *repo.Repository) error {
 		MaxSmallBlobs:        *optimizeMaxSmallBlobs,
 		AllIndexes:           *optimizeAllIndexes,
 		SkipDeletedOlderThan: *optimizeSkipDeletedOlderThan,
+		IncludeRecentEpochs:  true,
 	})
 }
 
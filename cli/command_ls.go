@@ -38,6 +38,7 @@ func runLSCommand(ctx context.Context, rep *repo.Repository) error {
 }
 
 func init() {
+	lsCommand.GetArg("object-path").HintAction(completeSnapshotRoots)
 	lsCommand.Action(repositoryAction(runLSCommand))
 }
 
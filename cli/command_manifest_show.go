@@ -49,7 +49,7 @@ func showManifestItems(ctx context.Context, rep *repo.Repository) error {
 			printStderr("// label %v:%v\n", k, v)
 		}
 
-		if showerr := showContentWithFlags(bytes.NewReader(b), false, true); showerr != nil {
+		if showerr := showContentWithFlags(bytes.NewReader(b), false, true, false); showerr != nil {
 			return showerr
 		}
 	}
@@ -0,0 +1,206 @@
+package cli
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/fs/archivefs"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/snapshot"
+	"github.com/kopia/kopia/snapshot/policy"
+	"github.com/kopia/kopia/snapshot/snapshotfs"
+)
+
+var (
+	migrateArchivesCommand         = migrateCommands.Command("from-archives", "Import a directory of dated tar/zip archives or duplicity full backups as historical snapshots.")
+	migrateArchivesDir             = migrateArchivesCommand.Arg("directory", "Directory containing archives").Required().ExistingDir()
+	migrateArchivesSource          = migrateArchivesCommand.Flag("source", "Source the archives were created from ('user@host:path' or a local path)").Required().String()
+	migrateArchivesStripComponents = migrateArchivesCommand.Flag("strip-components", "Strip N leading components from archive entry names").Default("0").Int()
+	migrateArchivesDryRun          = migrateArchivesCommand.Flag("dry-run", "Only show the archives and timestamps that would be imported").Bool()
+)
+
+// archiveTimestampRegexp matches dates such as 2020-01-02, 20200102, 2020-01-02T03-04-05 or 20200102_030405 in archive names.
+// A trailing 'Z' (as used by duplicity) denotes UTC.
+var archiveTimestampRegexp = regexp.MustCompile(`(\d{4})-?(\d{2})-?(\d{2})(?:[T_\-.]?(\d{2})[:\-]?(\d{2})(?:[:\-]?(\d{2}))?)?(Z)?`)
+
+// duplicityFullFirstVolumeRegexp matches the first volume of a duplicity full backup, which is imported
+// together with the subsequent volumes. Incremental backups can't be imported.
+var duplicityFullFirstVolumeRegexp = regexp.MustCompile(`^duplicity-full\.[^.]+\.vol1\.difftar`)
+
+type datedArchive struct {
+	path      string
+	timestamp time.Time
+}
+
+func runMigrateArchivesCommand(ctx context.Context, rep *repo.Repository) error {
+	si, err := snapshot.ParseSourceInfo(*migrateArchivesSource, rep.Hostname, rep.Username)
+	if err != nil {
+		return errors.Wrap(err, "invalid source")
+	}
+
+	if si.Path == "" {
+		return errors.New("source must include a path")
+	}
+
+	archives, err := findDatedArchives(ctx, *migrateArchivesDir)
+	if err != nil {
+		return err
+	}
+
+	if len(archives) == 0 {
+		return errors.Errorf("no supported archives found in %v", *migrateArchivesDir)
+	}
+
+	if *migrateArchivesDryRun {
+		for _, a := range archives {
+			printStdout("%v %v\n", formatTimestamp(a.timestamp), a.path)
+		}
+
+		return nil
+	}
+
+	uploader := snapshotfs.NewUploader(rep)
+	uploader.Progress = progress
+	onCtrlC(uploader.Cancel)
+
+	progress.StartShared()
+	defer progress.FinishShared()
+
+	for _, a := range archives {
+		if uploader.IsCancelled() {
+			printStderr("\rImport canceled\n")
+			break
+		}
+
+		if err := migrateSingleArchive(ctx, uploader, rep, si, a); err != nil {
+			return errors.Wrapf(err, "unable to import %v", a.path)
+		}
+	}
+
+	return nil
+}
+
+// findDatedArchives returns all supported archives in a given directory sorted by their timestamp.
+func findDatedArchives(ctx context.Context, dir string) ([]datedArchive, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to list archives")
+	}
+
+	var result []datedArchive
+
+	for _, e := range entries {
+		if !e.Mode().IsRegular() || !archivefs.IsSupported(e.Name()) {
+			continue
+		}
+
+		if strings.Contains(e.Name(), ".difftar") && !duplicityFullFirstVolumeRegexp.MatchString(e.Name()) {
+			log(ctx).Debugf("skipping duplicity volume %v", e.Name())
+			continue
+		}
+
+		ts, ok := parseArchiveTimestamp(e.Name())
+		if !ok {
+			// fall back to modification time of the archive itself.
+			ts = e.ModTime()
+		}
+
+		result = append(result, datedArchive{filepath.Join(dir, e.Name()), ts})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].timestamp.Before(result[j].timestamp)
+	})
+
+	return result, nil
+}
+
+// parseArchiveTimestamp extracts local date and optional time of day embedded in the provided file name.
+func parseArchiveTimestamp(fname string) (time.Time, bool) {
+	m := archiveTimestampRegexp.FindStringSubmatch(fname)
+	if m == nil {
+		return time.Time{}, false
+	}
+
+	layout, value := "20060102", m[1]+m[2]+m[3]
+
+	if m[4] != "" {
+		layout, value = layout+"1504", value+m[4]+m[5]
+
+		if m[6] != "" {
+			layout, value = layout+"05", value+m[6]
+		}
+	}
+
+	loc := time.Local
+	if m[7] != "" {
+		loc = time.UTC
+	}
+
+	t, err := time.ParseInLocation(layout, value, loc)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return t, true
+}
+
+func migrateSingleArchive(ctx context.Context, uploader *snapshotfs.Uploader, rep *repo.Repository, si snapshot.SourceInfo, a datedArchive) error {
+	existing, err := findPreviousSnapshotManifestWithStartTime(ctx, rep, si, a.timestamp)
+	if err != nil {
+		return err
+	}
+
+	if existing != nil {
+		printStderr("\ralready imported %v at %v\n", a.path, formatTimestamp(a.timestamp))
+		return nil
+	}
+
+	printStderr("\rimporting %v as snapshot of %v at %v\n", a.path, si, formatTimestamp(a.timestamp))
+
+	arch, err := archivefs.Open(ctx, a.path, *migrateArchivesStripComponents)
+	if err != nil {
+		return err
+	}
+	defer arch.Close() //nolint:errcheck
+
+	previous, err := snapshot.FindPreviousManifests(ctx, rep, si, &a.timestamp)
+	if err != nil {
+		return err
+	}
+
+	policyTree, err := policy.TreeForSource(ctx, rep, si)
+	if err != nil {
+		return errors.Wrap(err, "unable to get policy tree")
+	}
+
+	man, err := uploader.Upload(ctx, arch.Root(), policyTree, si, previous...)
+	if err != nil {
+		return err
+	}
+
+	if man.IncompleteReason != "" {
+		return nil
+	}
+
+	man.EndTime = a.timestamp.Add(man.EndTime.Sub(man.StartTime))
+	man.StartTime = a.timestamp
+	man.Description = "imported from " + filepath.Base(a.path)
+
+	if _, err := snapshot.SaveSnapshot(ctx, rep, man); err != nil {
+		return errors.Wrap(err, "cannot save manifest")
+	}
+
+	return nil
+}
+
+func init() {
+	migrateArchivesCommand.Action(repositoryAction(runMigrateArchivesCommand))
+}
@@ -0,0 +1,149 @@
+package cli
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/restic"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/snapshot"
+	"github.com/kopia/kopia/snapshot/policy"
+	"github.com/kopia/kopia/snapshot/snapshotfs"
+)
+
+var (
+	migrateResticCommand   = migrateCommands.Command("from-restic", "Import snapshots from a restic repository stored on a local filesystem.")
+	migrateResticPath      = migrateResticCommand.Arg("path", "Path to the restic repository").Required().ExistingDir()
+	migrateResticPassword  = migrateResticCommand.Flag("restic-password", "Password of the restic repository").Envar("RESTIC_PASSWORD").String()
+	migrateResticSnapshots = migrateResticCommand.Flag("snapshot", "Restic snapshot IDs (or unique prefixes) to import, all by default").Strings()
+	migrateResticHostname  = migrateResticCommand.Flag("hostname", "Override hostname of imported snapshots").String()
+	migrateResticUsername  = migrateResticCommand.Flag("username", "Override username of imported snapshots").String()
+)
+
+func runMigrateResticCommand(ctx context.Context, rep *repo.Repository) error {
+	pass := *migrateResticPassword
+	if pass == "" {
+		var err error
+
+		if pass, err = askPass("Enter password of the restic repository: "); err != nil {
+			return err
+		}
+	}
+
+	rr, err := restic.Open(ctx, *migrateResticPath, pass)
+	if err != nil {
+		return errors.Wrap(err, "unable to open restic repository")
+	}
+
+	snapshots, err := rr.ListSnapshots(ctx)
+	if err != nil {
+		return errors.Wrap(err, "unable to list restic snapshots")
+	}
+
+	uploader := snapshotfs.NewUploader(rep)
+	uploader.Progress = progress
+	onCtrlC(uploader.Cancel)
+
+	progress.StartShared()
+	defer progress.FinishShared()
+
+	for _, s := range snapshots {
+		if uploader.IsCancelled() {
+			printStderr("\rImport canceled\n")
+			break
+		}
+
+		if !shouldMigrateResticSnapshot(s) {
+			continue
+		}
+
+		if err := migrateResticSnapshot(ctx, uploader, rr, rep, s); err != nil {
+			return errors.Wrapf(err, "unable to import restic snapshot %v", s.ID)
+		}
+	}
+
+	return nil
+}
+
+func shouldMigrateResticSnapshot(s *restic.Snapshot) bool {
+	if len(*migrateResticSnapshots) == 0 {
+		return true
+	}
+
+	for _, prefix := range *migrateResticSnapshots {
+		if strings.HasPrefix(string(s.ID), prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func migrateResticSnapshot(ctx context.Context, uploader *snapshotfs.Uploader, rr *restic.Repository, rep *repo.Repository, s *restic.Snapshot) error {
+	root, rootPath, err := rr.SnapshotRoot(ctx, s)
+	if err != nil {
+		return err
+	}
+
+	si := snapshot.SourceInfo{
+		Host:     s.Hostname,
+		UserName: s.Username,
+		Path:     rootPath,
+	}
+
+	if h := *migrateResticHostname; h != "" {
+		si.Host = h
+	}
+
+	if u := *migrateResticUsername; u != "" {
+		si.UserName = u
+	}
+
+	existing, err := findPreviousSnapshotManifestWithStartTime(ctx, rep, si, s.Time)
+	if err != nil {
+		return err
+	}
+
+	if existing != nil {
+		printStderr("\ralready imported %v at %v\n", si, formatTimestamp(s.Time))
+		return nil
+	}
+
+	printStderr("\rimporting restic snapshot %v of %v at %v\n", s.ID, si, formatTimestamp(s.Time))
+
+	previous, err := snapshot.FindPreviousManifests(ctx, rep, si, &s.Time)
+	if err != nil {
+		return err
+	}
+
+	var policyTree *policy.Tree
+
+	man, err := uploader.Upload(ctx, root, policyTree, si, previous...)
+	if err != nil {
+		return err
+	}
+
+	if man.IncompleteReason != "" {
+		return nil
+	}
+
+	man.EndTime = s.Time.Add(man.EndTime.Sub(man.StartTime))
+	man.StartTime = s.Time
+	man.Description = "imported from restic snapshot " + string(s.ID)
+
+	if len(s.Tags) > 0 {
+		man.Description += " (tags: " + strings.Join(s.Tags, ",") + ")"
+	}
+
+	if _, err := snapshot.SaveSnapshot(ctx, rep, man); err != nil {
+		return errors.Wrap(err, "cannot save manifest")
+	}
+
+	return nil
+}
+
+func init() {
+	migrateResticCommand.Action(repositoryAction(runMigrateResticCommand))
+}
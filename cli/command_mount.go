@@ -9,15 +9,17 @@ import (
 	"github.com/kopia/kopia/fs/cachefs"
 	"github.com/kopia/kopia/fs/loggingfs"
 	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/snapshot"
 	"github.com/kopia/kopia/snapshot/snapshotfs"
 )
 
 var (
 	mountCommand = app.Command("mount", "Mount repository object as a local filesystem.")
 
-	mountObjectID = mountCommand.Arg("path", "Identifier of the directory to mount.").Required().String()
+	mountObjectID = mountCommand.Arg("path", "Identifier of the directory to mount, path of a snapshot source to browse all its snapshots or 'all'.").Required().String()
 	mountPoint    = mountCommand.Arg("mountPoint", "Mount point").Required().String()
 	mountTraceFS  = mountCommand.Flag("trace-fs", "Trace filesystem operations").Bool()
+	mountOffline  = mountCommand.Flag("offline", "Mount using only locally cached data, without accessing the repository storage").Bool()
 )
 
 func runMountCommand(ctx context.Context, rep *repo.Repository) error {
@@ -26,11 +28,15 @@ func runMountCommand(ctx context.Context, rep *repo.Repository) error {
 	if *mountObjectID == "all" {
 		entry = snapshotfs.AllSourcesEntry(rep)
 	} else {
-		oid, err := parseObjectID(ctx, rep, *mountObjectID)
+		d, err := mountedDirectory(ctx, rep, *mountObjectID)
 		if err != nil {
 			return err
 		}
-		entry = snapshotfs.DirectoryEntry(rep, oid, nil)
+		entry = d
+	}
+
+	if err := verifyAvailableOffline(ctx, rep, entry); err != nil {
+		return err
 	}
 
 	if *mountTraceFS {
@@ -49,7 +55,33 @@ func runMountCommand(ctx context.Context, rep *repo.Repository) error {
 	}
 }
 
+// mountedDirectory returns the directory identified by the provided object path or, when the path
+// identifies a snapshot source, the directory containing all snapshots of the source.
+func mountedDirectory(ctx context.Context, rep *repo.Repository, path string) (fs.Directory, error) {
+	oid, err := parseObjectID(ctx, rep, path)
+	if err == nil {
+		return snapshotfs.DirectoryEntry(rep, oid, nil), nil
+	}
+
+	src, serr := snapshot.ParseSourceInfo(path, rep.Hostname, rep.Username)
+	if serr != nil || src.Path == "" {
+		return nil, err
+	}
+
+	snapshots, serr := snapshot.ListSnapshots(ctx, rep, src)
+	if serr != nil {
+		return nil, errors.Wrapf(serr, "unable to list snapshots of %v", src)
+	}
+
+	if len(snapshots) == 0 {
+		return nil, err
+	}
+
+	return snapshotfs.SourceSnapshotsEntry(rep, src), nil
+}
+
 func init() {
+	mountCommand.GetArg("path").HintAction(completeSnapshotRoots)
 	setupFSCacheFlags(mountCommand)
-	mountCommand.Action(repositoryAction(runMountCommand))
+	mountCommand.Action(offlineCapableRepositoryAction(mountOffline, runMountCommand))
 }
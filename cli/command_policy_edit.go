@@ -55,6 +55,7 @@ var (
 )
 
 func init() {
+	policyEditCommand.GetArg("target").HintAction(completePolicyTargets)
 	policyEditCommand.Action(repositoryAction(editPolicy))
 }
 
@@ -0,0 +1,197 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/snapshot/policy"
+)
+
+const (
+	policyBundleFormatJSON = "json"
+	policyBundleFormatYAML = "yaml"
+)
+
+var (
+	policyExportCommand = policyCommands.Command("export", "Export all policies to a single file.")
+	policyExportOutput  = policyExportCommand.Flag("output", "File to write the policies to, standard output if not provided").Short('o').String()
+	policyExportFormat  = policyExportCommand.Flag("format", "Format of the file, determined by its extension if not provided").Enum(policyBundleFormatJSON, policyBundleFormatYAML)
+	policyExportUseVars = policyExportCommand.Flag("use-variables", "Replace local hostname, username and home directory in targets with {{.Hostname}}, {{.Username}} and {{.HomeDir}}").Bool()
+)
+
+func init() {
+	policyExportCommand.Action(repositoryAction(exportPolicies))
+}
+
+func exportPolicies(ctx context.Context, rep *repo.Repository) error {
+	var vars *policy.TargetVariables
+
+	if *policyExportUseVars {
+		v := policy.LocalTargetVariables(rep)
+		vars = &v
+	}
+
+	b, err := policy.ExportPolicies(ctx, rep, vars)
+	if err != nil {
+		return err
+	}
+
+	data, err := marshalPolicyBundle(b, policyBundleFormat(*policyExportFormat, *policyExportOutput))
+	if err != nil {
+		return err
+	}
+
+	if *policyExportOutput == "" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+
+	if err := ioutil.WriteFile(*policyExportOutput, data, 0600); err != nil {
+		return errors.Wrap(err, "unable to write policies")
+	}
+
+	printStderr("Exported %v policies to %v\n", len(b.Policies), *policyExportOutput)
+
+	return nil
+}
+
+// policyBundleFormat returns the explicitly requested format or the format implied by the file extension.
+func policyBundleFormat(explicit, filename string) string {
+	if explicit != "" {
+		return explicit
+	}
+
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yaml", ".yml":
+		return policyBundleFormatYAML
+	default:
+		return policyBundleFormatJSON
+	}
+}
+
+func marshalPolicyBundle(b *policy.Bundle, format string) ([]byte, error) {
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to serialize policies")
+	}
+
+	if format != policyBundleFormatYAML {
+		return append(data, '\n'), nil
+	}
+
+	// policies only define JSON field names, so the YAML document is converted from JSON.
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+
+	var v interface{}
+
+	if err := d.Decode(&v); err != nil {
+		return nil, errors.Wrap(err, "unable to convert policies")
+	}
+
+	data, err = yaml.Marshal(jsonNumbersToYAML(v))
+
+	return data, errors.Wrap(err, "unable to serialize policies")
+}
+
+func unmarshalPolicyBundle(data []byte, format string) (*policy.Bundle, error) {
+	if format == policyBundleFormatYAML {
+		var v interface{}
+
+		if err := yaml.Unmarshal(data, &v); err != nil {
+			return nil, errors.Wrap(err, "unable to parse policies")
+		}
+
+		v, err := yamlToJSON(v)
+		if err != nil {
+			return nil, err
+		}
+
+		if data, err = json.Marshal(v); err != nil {
+			return nil, errors.Wrap(err, "unable to convert policies")
+		}
+	}
+
+	b := &policy.Bundle{}
+
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.DisallowUnknownFields()
+
+	if err := d.Decode(b); err != nil {
+		return nil, errors.Wrap(err, "unable to parse policies")
+	}
+
+	return b, nil
+}
+
+// jsonNumbersToYAML replaces JSON numbers with integers or floats, which are emitted by YAML as plain numbers.
+func jsonNumbersToYAML(v interface{}) interface{} {
+	switch v := v.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+
+		f, _ := v.Float64()
+
+		return f
+
+	case map[string]interface{}:
+		for k, e := range v {
+			v[k] = jsonNumbersToYAML(e)
+		}
+
+	case []interface{}:
+		for i, e := range v {
+			v[i] = jsonNumbersToYAML(e)
+		}
+	}
+
+	return v
+}
+
+// yamlToJSON converts maps with arbitrary keys parsed from YAML to maps with string keys that can be serialized as JSON.
+func yamlToJSON(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		result := map[string]interface{}{}
+
+		for k, e := range v {
+			ks, ok := k.(string)
+			if !ok {
+				ks = fmt.Sprint(k)
+			}
+
+			c, err := yamlToJSON(e)
+			if err != nil {
+				return nil, err
+			}
+
+			result[ks] = c
+		}
+
+		return result, nil
+
+	case []interface{}:
+		for i, e := range v {
+			c, err := yamlToJSON(e)
+			if err != nil {
+				return nil, err
+			}
+
+			v[i] = c
+		}
+	}
+
+	return v, nil
+}
@@ -0,0 +1,65 @@
+package cli
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/kopia/kopia/snapshot/policy"
+)
+
+func TestPolicyBundleRoundTrip(t *testing.T) {
+	keep := 7
+	enabled := true
+
+	b := &policy.Bundle{
+		Policies: map[string]*policy.Policy{
+			"(global)": {
+				RetentionPolicy: policy.RetentionPolicy{KeepDaily: &keep},
+			},
+			"user@host:/some/path": {
+				FilesPolicy: policy.FilesPolicy{
+					IgnoreRules: []string{"*.tmp", "cache/"},
+					MaxFileSize: 10000000000,
+				},
+				CompressionPolicy: policy.CompressionPolicy{
+					CompressorName:      "zstd",
+					AdaptiveCompression: &enabled,
+				},
+			},
+		},
+	}
+
+	for _, format := range []string{policyBundleFormatJSON, policyBundleFormatYAML} {
+		data, err := marshalPolicyBundle(b, format)
+		if err != nil {
+			t.Fatalf("unable to marshal %v: %v", format, err)
+		}
+
+		b2, err := unmarshalPolicyBundle(data, format)
+		if err != nil {
+			t.Fatalf("unable to unmarshal %v: %v\n%s", format, err, data)
+		}
+
+		if !reflect.DeepEqual(b, b2) {
+			t.Errorf("%v bundle does not round-trip:\n%s", format, data)
+		}
+	}
+}
+
+func TestPolicyBundleFormat(t *testing.T) {
+	cases := []struct {
+		explicit, filename, want string
+	}{
+		{"", "", policyBundleFormatJSON},
+		{"", "policies.json", policyBundleFormatJSON},
+		{"", "policies.YAML", policyBundleFormatYAML},
+		{"", "policies.yml", policyBundleFormatYAML},
+		{policyBundleFormatJSON, "policies.yml", policyBundleFormatJSON},
+	}
+
+	for _, tc := range cases {
+		if got := policyBundleFormat(tc.explicit, tc.filename); got != tc.want {
+			t.Errorf("invalid format for %q %q: %v, want %v", tc.explicit, tc.filename, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package cli
+
+import (
+	"context"
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/snapshot/policy"
+)
+
+var (
+	policyImportCommand     = policyCommands.Command("import", "Import policies from a file created by 'policy export', targets may use {{.Hostname}}, {{.Username}} and {{.HomeDir}} variables.")
+	policyImportFile        = policyImportCommand.Arg("file", "File to read the policies from").Required().ExistingFile()
+	policyImportFormat      = policyImportCommand.Flag("format", "Format of the file, determined by its extension if not provided").Enum(policyBundleFormatJSON, policyBundleFormatYAML)
+	policyImportDeleteOther = policyImportCommand.Flag("delete-other", "Remove policies of targets not present in the file").Bool()
+	policyImportDryRun      = policyImportCommand.Flag("dry-run", "Only print the changes that would be made").Bool()
+)
+
+func init() {
+	policyImportCommand.Action(repositoryAction(importPolicies))
+}
+
+// authoritativePoliciesLoader returns the function loading the bundle of authoritative policies served by the server
+// or nil if the file is not provided. The file is read each time, so that the policies can be changed without restarting the server.
+func authoritativePoliciesLoader(filename string) func() (*policy.Bundle, error) {
+	if filename == "" {
+		return nil
+	}
+
+	return func() (*policy.Bundle, error) {
+		data, err := ioutil.ReadFile(filename) //nolint:gosec
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to read policies")
+		}
+
+		return unmarshalPolicyBundle(data, policyBundleFormat("", filename))
+	}
+}
+
+func importPolicies(ctx context.Context, rep *repo.Repository) error {
+	data, err := ioutil.ReadFile(*policyImportFile)
+	if err != nil {
+		return errors.Wrap(err, "unable to read policies")
+	}
+
+	b, err := unmarshalPolicyBundle(data, policyBundleFormat(*policyImportFormat, *policyImportFile))
+	if err != nil {
+		return err
+	}
+
+	res, err := policy.ImportPolicies(ctx, rep, b, policy.ImportOptions{
+		RemoveOther: *policyImportDeleteOther,
+		DryRun:      *policyImportDryRun,
+		Variables:   policy.LocalTargetVariables(rep),
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(res.Set) == 0 && len(res.Removed) == 0 {
+		printStderr("No changes.\n")
+		return nil
+	}
+
+	verb := "Set"
+	if *policyImportDryRun {
+		verb = "Would set"
+	}
+
+	for _, si := range res.Set {
+		printStderr("%v policy for %v\n", verb, si)
+	}
+
+	verb = "Removed"
+	if *policyImportDryRun {
+		verb = "Would remove"
+	}
+
+	for _, si := range res.Removed {
+		printStderr("%v policy for %v\n", verb, si)
+	}
+
+	return nil
+}
@@ -14,6 +14,7 @@ var (
 )
 
 func init() {
+	policyRemoveCommand.GetArg("target").HintAction(completePolicyTargets)
 	policyRemoveCommand.Action(repositoryAction(removePolicy))
 }
 
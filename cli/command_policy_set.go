@@ -8,8 +8,10 @@ import (
 
 	"github.com/pkg/errors"
 
+	"github.com/kopia/kopia/internal/units"
 	"github.com/kopia/kopia/repo"
 	"github.com/kopia/kopia/repo/compression"
+	"github.com/kopia/kopia/repo/splitter"
 	"github.com/kopia/kopia/snapshot/policy"
 )
 
@@ -23,6 +25,7 @@ var (
 	// Frequency
 	policySetInterval   = policySetCommand.Flag("snapshot-interval", "Interval between snapshots").DurationList()
 	policySetTimesOfDay = policySetCommand.Flag("snapshot-time", "Times of day when to take snapshot (HH:mm)").Strings()
+	policySetPriority   = policySetCommand.Flag("upload-priority", "Relative share of upload throughput when the server snapshots multiple sources at the same time (or 'inherit')").PlaceHolder("N").String()
 
 	// Expiration policies.
 	policySetKeepLatest  = policySetCommand.Flag("keep-latest", "Number of most recent backups to keep per source (or 'inherit')").PlaceHolder("N").String()
@@ -37,6 +40,12 @@ var (
 	policySetRemoveIgnore = policySetCommand.Flag("remove-ignore", "List of paths to remove from the ignore list").PlaceHolder("PATTERN").Strings()
 	policySetClearIgnore  = policySetCommand.Flag("clear-ignore", "Clear list of paths in the ignore list").Bool()
 
+	// Mount points.
+	policySetOneFileSystem       = policySetCommand.Flag("one-file-system", "Don't descend into directories on other file systems ('true', 'false', 'inherit')").Enum(booleanEnumValues...)
+	policySetAddIncludedMount    = policySetCommand.Flag("add-included-mount", "Path of a mount point to snapshot despite --one-file-system, relative to the target").PlaceHolder("PATH").Strings()
+	policySetRemoveIncludedMount = policySetCommand.Flag("remove-included-mount", "Path to remove from the included mount points").PlaceHolder("PATH").Strings()
+	policySetClearIncludedMounts = policySetCommand.Flag("clear-included-mounts", "Clear the list of included mount points").Bool()
+
 	// Name of compression algorithm.
 	policySetCompressionAlgorithm = policySetCommand.Flag("compression", "Compression algorithm").Enum(supportedCompressionAlgorithms()...)
 	policySetCompressionMinSize   = policySetCommand.Flag("compression-min-size", "Min size of file to attempt compression for").String()
@@ -52,6 +61,17 @@ var (
 	policySetRemoveNeverCompress = policySetCommand.Flag("remove-never-compress", "List of extensions to remove from the never compress list").PlaceHolder("PATTERN").Strings()
 	policySetClearNeverCompress  = policySetCommand.Flag("clear-never-compress", "Clear list of extensions in the never compress list").Bool()
 
+	// Compression algorithms for particular extensions.
+	policySetExtensionCompression      = policySetCommand.Flag("extension-compression", "Compression algorithm for files with the given extensions or extension classes ('archives', 'media', 'text'), 'inherit' removes the setting").PlaceHolder("EXT[,EXT...]=ALGORITHM").Strings()
+	policySetClearExtensionCompression = policySetCommand.Flag("clear-extension-compression", "Clear compression algorithms for particular extensions").Bool()
+
+	policySetAdaptiveCompression = policySetCommand.Flag("adaptive-compression", "Skip compression of chunks whose samples don't compress well ('true', 'false', 'inherit')").Enum(booleanEnumValues...)
+
+	// Directory listings.
+	policySetMetadataCompressionAlgorithm = policySetCommand.Flag("metadata-compression", "Compression algorithm for directory listings, enabling it changes object IDs of all directories").Enum(supportedCompressionAlgorithms()...)
+	policySetDeltaEncodeDirectories       = policySetCommand.Flag("delta-encode-directories", "Store changed directories as differences against the previous snapshot ('true', 'false', 'inherit')").Enum(booleanEnumValues...)
+	policySetInlineFilesMaxSize           = policySetCommand.Flag("inline-files-max-size", "Store files up to this size inline in directory listings (0 disables, or 'inherit')").PlaceHolder("N").String()
+
 	// Dot-ignore files to look at.
 	policySetAddDotIgnore    = policySetCommand.Flag("add-dot-ignore", "List of paths to add to the dot-ignore list").PlaceHolder("FILENAME").Strings()
 	policySetRemoveDotIgnore = policySetCommand.Flag("remove-dot-ignore", "List of paths to remove from the dot-ignore list").PlaceHolder("FILENAME").Strings()
@@ -61,9 +81,49 @@ var (
 	// Error handling behavior.
 	policyIgnoreFileErrors      = policySetCommand.Flag("ignore-file-errors", "Ignore errors reading files while traversing ('true', 'false', 'inherit')").Enum(booleanEnumValues...)
 	policyIgnoreDirectoryErrors = policySetCommand.Flag("ignore-dir-errors", "Ignore errors reading directories while traversing ('true', 'false', 'inherit").Enum(booleanEnumValues...)
+	policyIOTimeout             = policySetCommand.Flag("io-timeout", "Number of seconds after which an unresponsive file system fails the file or directory being read, 0 to disable ('inherit' to inherit from parent)").PlaceHolder("SECONDS").String()
+
+	// Change detection.
+	policySetChangeDetection = policySetCommand.Flag("change-detection", "How to detect changed files ('metadata', 'rehash', 'inherit')").Enum(policy.ChangeDetectionMetadata, policy.ChangeDetectionRehash, inheritPolicyString)
+	policySetFullRehashEvery = policySetCommand.Flag("full-rehash-every", "Rehash all files every N snapshots (or 'inherit')").PlaceHolder("N").String()
+
+	// Bandwidth throttling.
+	policySetMaxUploadSpeed   = policySetCommand.Flag("max-upload-speed", "Limit upload speed to N bytes per second outside of bandwidth windows (0 is unlimited)").PlaceHolder("N").String()
+	policySetMaxDownloadSpeed = policySetCommand.Flag("max-download-speed", "Limit download speed to N bytes per second outside of bandwidth windows (0 is unlimited)").PlaceHolder("N").String()
+	policySetBandwidthWindows = policySetCommand.Flag("bandwidth-window", "Replace bandwidth windows with the provided ones (or 'inherit'), speeds are in bytes per second, 0 or 'unlimited' removes the limit").PlaceHolder("HH:MM-HH:MM=UPLOAD[/DOWNLOAD]").Strings()
+
+	// Screening of sensitive files.
+	policySetScreening              = policySetCommand.Flag("screening", "What to do with files with sensitive contents, such as private keys ('none', 'flag', 'skip', 'inherit')").Enum(policy.ScreeningNone, policy.ScreeningFlag, policy.ScreeningSkip, inheritPolicyString)
+	policySetAddScreeningName       = policySetCommand.Flag("add-screening-name", "List of names of sensitive files to add to the built-in ones").PlaceHolder("PATTERN").Strings()
+	policySetRemoveScreeningName    = policySetCommand.Flag("remove-screening-name", "List of names of sensitive files to remove").PlaceHolder("PATTERN").Strings()
+	policySetClearScreeningNames    = policySetCommand.Flag("clear-screening-names", "Clear list of names of sensitive files").Bool()
+	policySetAddScreeningPattern    = policySetCommand.Flag("add-screening-pattern", "List of regular expressions matching sensitive contents to add to the built-in ones").PlaceHolder("REGEX").Strings()
+	policySetRemoveScreeningPattern = policySetCommand.Flag("remove-screening-pattern", "List of regular expressions matching sensitive contents to remove").PlaceHolder("REGEX").Strings()
+	policySetClearScreeningPatterns = policySetCommand.Flag("clear-screening-patterns", "Clear list of regular expressions matching sensitive contents").Bool()
+
+	// Detection of anomalous changes.
+	policySetAnomaly                = policySetCommand.Flag("anomaly", "What to do with snapshots modifying unusually many files ('none', 'warn', 'fail', 'inherit')").Enum(policy.AnomalyNone, policy.AnomalyWarn, policy.AnomalyFail, inheritPolicyString)
+	policySetAnomalyModifiedPercent = policySetCommand.Flag("anomaly-modified-percent", "Minimum percentage of modified files considered anomalous (or 'inherit')").PlaceHolder("N").String()
+	policySetAnomalyHistoryFactor   = policySetCommand.Flag("anomaly-history-factor", "How many times the percentage of modified files must exceed the average of previous snapshots (or 'inherit')").PlaceHolder("N").String()
+	policySetAnomalyMinFiles        = policySetCommand.Flag("anomaly-min-files", "Minimum number of files in a snapshot for the anomaly detection to apply (or 'inherit')").PlaceHolder("N").String()
+
+	// Canary files.
+	policySetCanary        = policySetCommand.Flag("canary", "What to do with snapshots where canary files were modified or removed ('none', 'warn', 'fail', 'inherit')").Enum(policy.AnomalyNone, policy.AnomalyWarn, policy.AnomalyFail, inheritPolicyString)
+	policySetAddCanary     = policySetCommand.Flag("add-canary", "List of names of canary files to add").PlaceHolder("PATTERN").Strings()
+	policySetRemoveCanary  = policySetCommand.Flag("remove-canary", "List of names of canary files to remove").PlaceHolder("PATTERN").Strings()
+	policySetClearCanaries = policySetCommand.Flag("clear-canaries", "Clear list of names of canary files").Bool()
+
+	// Data encrypted at the source.
+	policySetEncryptedData         = policySetCommand.Flag("encrypted-data", "Files contain data encrypted at the source, which is stored uncompressed in large chunks ('true', 'false', 'inherit')").Enum(booleanEnumValues...)
+	policySetEncryptedDataSplitter = policySetCommand.Flag("encrypted-data-splitter", "Splitter used for files containing encrypted data (or 'inherit')").Enum(append(splitter.SupportedAlgorithms(), inheritPolicyString)...)
+
+	// File system snapshots.
+	policySetFilesystemSnapshot = policySetCommand.Flag("filesystem-snapshot", "Read files from a temporary snapshot of the file system containing the source ('lvm', 'btrfs', 'zfs', 'none', 'inherit')").Enum(policy.FilesystemSnapshotLVM, policy.FilesystemSnapshotBtrfs, policy.FilesystemSnapshotZFS, policy.FilesystemSnapshotNone, inheritPolicyString)
+	policySetLVMSnapshotSize    = policySetCommand.Flag("lvm-snapshot-size", "Size of LVM snapshot volumes holding changes made during snapshots, such as '1G' or '10%ORIGIN' (or 'inherit')").String()
 
 	// General policy.
-	policySetInherit = policySetCommand.Flag(inheritPolicyString, "Enable or disable inheriting policies from the parent").BoolList()
+	policySetInherit  = policySetCommand.Flag(inheritPolicyString, "Enable or disable inheriting policies from the parent").BoolList()
+	policySetEnforced = policySetCommand.Flag("enforced", "Prevent more specific policies from overriding values set by this policy ('true', 'false')").Enum("true", "false")
 )
 
 const (
@@ -71,6 +131,7 @@ const (
 )
 
 func init() {
+	policySetCommand.GetArg("target").HintAction(completePolicyTargets)
 	policySetCommand.Action(repositoryAction(setPolicy))
 }
 
@@ -110,7 +171,9 @@ func setPolicyFromFlags(p *policy.Policy, changeCount *int) error {
 		return errors.Wrap(err, "retention policy")
 	}
 
-	setFilesPolicyFromFlags(&p.FilesPolicy, changeCount)
+	if err := setFilesPolicyFromFlags(&p.FilesPolicy, changeCount); err != nil {
+		return errors.Wrap(err, "files policy")
+	}
 
 	if err := setErrorHandlingPolicyFromFlags(&p.ErrorHandlingPolicy, changeCount); err != nil {
 		return errors.Wrap(err, "error handling policy")
@@ -124,6 +187,30 @@ func setPolicyFromFlags(p *policy.Policy, changeCount *int) error {
 		return errors.Wrap(err, "scheduling policy")
 	}
 
+	if err := setChangeDetectionPolicyFromFlags(&p.ChangeDetectionPolicy, changeCount); err != nil {
+		return errors.Wrap(err, "change detection policy")
+	}
+
+	if err := setThrottlingPolicyFromFlags(&p.ThrottlingPolicy, changeCount); err != nil {
+		return errors.Wrap(err, "throttling policy")
+	}
+
+	if err := setScreeningPolicyFromFlags(&p.ScreeningPolicy, changeCount); err != nil {
+		return errors.Wrap(err, "screening policy")
+	}
+
+	if err := setAnomalyPolicyFromFlags(&p.AnomalyPolicy, changeCount); err != nil {
+		return errors.Wrap(err, "anomaly policy")
+	}
+
+	setCanaryPolicyFromFlags(&p.CanaryPolicy, changeCount)
+
+	if err := setEncryptedDataPolicyFromFlags(&p.EncryptedDataPolicy, changeCount); err != nil {
+		return errors.Wrap(err, "encrypted data policy")
+	}
+
+	setFilesystemSnapshotPolicyFromFlags(&p.FilesystemSnapshotPolicy, changeCount)
+
 	if err := applyPolicyNumber64("maximum file size", &p.FilesPolicy.MaxFileSize, *policySetMaxFileSize, changeCount); err != nil {
 		return errors.Wrap(err, "maximum file size")
 	}
@@ -135,10 +222,18 @@ func setPolicyFromFlags(p *policy.Policy, changeCount *int) error {
 		p.NoParent = !inherit
 	}
 
+	if v := *policySetEnforced; v != "" {
+		*changeCount++
+
+		p.Enforced = v == "true"
+
+		printStderr(" - setting enforced to %v\n", p.Enforced)
+	}
+
 	return nil
 }
 
-func setFilesPolicyFromFlags(fp *policy.FilesPolicy, changeCount *int) {
+func setFilesPolicyFromFlags(fp *policy.FilesPolicy, changeCount *int) error {
 	if *policySetClearDotIgnore {
 		*changeCount++
 
@@ -158,6 +253,39 @@ func setFilesPolicyFromFlags(fp *policy.FilesPolicy, changeCount *int) {
 	} else {
 		fp.IgnoreRules = addRemoveDedupeAndSort("ignored files", fp.IgnoreRules, *policySetAddIgnore, *policySetRemoveIgnore, changeCount)
 	}
+
+	if *policySetClearIncludedMounts {
+		*changeCount++
+
+		fp.IncludedMounts = nil
+
+		printStderr(" - removing all included mount points\n")
+	} else {
+		fp.IncludedMounts = addRemoveDedupeAndSort("included mount points", fp.IncludedMounts, *policySetAddIncludedMount, *policySetRemoveIncludedMount, changeCount)
+	}
+
+	switch {
+	case *policySetOneFileSystem == "":
+	case *policySetOneFileSystem == inheritPolicyString:
+		*changeCount++
+
+		fp.OneFileSystem = nil
+
+		printStderr(" - inherit one file system behavior from parent\n")
+	default:
+		val, err := strconv.ParseBool(*policySetOneFileSystem)
+		if err != nil {
+			return err
+		}
+
+		*changeCount++
+
+		fp.OneFileSystem = &val
+
+		printStderr(" - setting one file system to %v\n", val)
+	}
+
+	return nil
 }
 
 func setErrorHandlingPolicyFromFlags(fp *policy.ErrorHandlingPolicy, changeCount *int) error {
@@ -203,7 +331,7 @@ func setErrorHandlingPolicyFromFlags(fp *policy.ErrorHandlingPolicy, changeCount
 		printStderr(" - setting ignore directory read errors to %v\n", val)
 	}
 
-	return nil
+	return applyPolicyNumber("I/O timeout in seconds", &fp.IOTimeoutSeconds, *policyIOTimeout, changeCount)
 }
 
 func setRetentionPolicyFromFlags(rp *policy.RetentionPolicy, changeCount *int) error {
@@ -269,7 +397,7 @@ func setSchedulingPolicyFromFlags(sp *policy.SchedulingPolicy, changeCount *int)
 		}
 	}
 
-	return nil
+	return applyPolicyNumber("upload priority", &sp.UploadPriority, *policySetPriority, changeCount)
 }
 
 func setCompressionPolicyFromFlags(p *policy.CompressionPolicy, changeCount *int) error {
@@ -317,9 +445,354 @@ func setCompressionPolicyFromFlags(p *policy.CompressionPolicy, changeCount *int
 			p.NeverCompress, *policySetAddNeverCompress, *policySetRemoveNeverCompress, changeCount)
 	}
 
+	switch {
+	case *policySetAdaptiveCompression == "":
+	case *policySetAdaptiveCompression == inheritPolicyString:
+		*changeCount++
+
+		p.AdaptiveCompression = nil
+
+		printStderr(" - inherit adaptive compression from parent\n")
+	default:
+		val, err := strconv.ParseBool(*policySetAdaptiveCompression)
+		if err != nil {
+			return err
+		}
+
+		*changeCount++
+
+		p.AdaptiveCompression = &val
+
+		printStderr(" - setting adaptive compression to %v\n", val)
+	}
+
+	if err := setExtensionCompressionFromFlags(p, changeCount); err != nil {
+		return err
+	}
+
+	if v := *policySetMetadataCompressionAlgorithm; v != "" {
+		*changeCount++
+
+		if v == inheritPolicyString {
+			printStderr(" - resetting metadata compression algorithm to default value inherited from parent\n")
+
+			p.MetadataCompressorName = ""
+		} else {
+			printStderr(" - setting metadata compression algorithm to %v\n", v)
+
+			p.MetadataCompressorName = compression.Name(v)
+		}
+	}
+
+	switch {
+	case *policySetDeltaEncodeDirectories == "":
+	case *policySetDeltaEncodeDirectories == inheritPolicyString:
+		*changeCount++
+
+		p.DeltaEncodeDirectories = nil
+
+		printStderr(" - inherit directory delta encoding from parent\n")
+	default:
+		val, err := strconv.ParseBool(*policySetDeltaEncodeDirectories)
+		if err != nil {
+			return err
+		}
+
+		*changeCount++
+
+		p.DeltaEncodeDirectories = &val
+
+		printStderr(" - setting delta encoding of directories to %v\n", val)
+	}
+
+	if err := applyOptionalPolicyNumber64("maximum size of files stored inline", &p.InlineFilesMaxSize, *policySetInlineFilesMaxSize, changeCount); err != nil {
+		return errors.Wrap(err, "maximum size of files stored inline")
+	}
+
 	return nil
 }
 
+func setChangeDetectionPolicyFromFlags(p *policy.ChangeDetectionPolicy, changeCount *int) error {
+	if v := *policySetChangeDetection; v != "" {
+		*changeCount++
+
+		if v == inheritPolicyString {
+			printStderr(" - resetting change detection mode to default value inherited from parent\n")
+
+			p.Mode = ""
+		} else {
+			printStderr(" - setting change detection mode to %v\n", v)
+
+			p.Mode = v
+		}
+	}
+
+	return applyPolicyNumber("number of snapshots between full rehashes", &p.FullRehashEvery, *policySetFullRehashEvery, changeCount)
+}
+
+func setScreeningPolicyFromFlags(p *policy.ScreeningPolicy, changeCount *int) error {
+	if v := *policySetScreening; v != "" {
+		*changeCount++
+
+		if v == inheritPolicyString {
+			printStderr(" - resetting screening action to default value inherited from parent\n")
+
+			p.Action = ""
+		} else {
+			printStderr(" - setting screening action to %v\n", v)
+
+			p.Action = v
+		}
+	}
+
+	if *policySetClearScreeningNames {
+		*changeCount++
+
+		printStderr(" - removing all names of sensitive files\n")
+
+		p.NamePatterns = nil
+	} else {
+		p.NamePatterns = addRemoveDedupeAndSort("names of sensitive files", p.NamePatterns, *policySetAddScreeningName, *policySetRemoveScreeningName, changeCount)
+	}
+
+	for _, pattern := range *policySetAddScreeningPattern {
+		if err := policy.ValidateContentPattern(pattern); err != nil {
+			return err
+		}
+	}
+
+	if *policySetClearScreeningPatterns {
+		*changeCount++
+
+		printStderr(" - removing all patterns of sensitive contents\n")
+
+		p.ContentPatterns = nil
+	} else {
+		p.ContentPatterns = addRemoveDedupeAndSort("patterns of sensitive contents", p.ContentPatterns, *policySetAddScreeningPattern, *policySetRemoveScreeningPattern, changeCount)
+	}
+
+	return nil
+}
+
+func setAnomalyPolicyFromFlags(p *policy.AnomalyPolicy, changeCount *int) error {
+	if v := *policySetAnomaly; v != "" {
+		*changeCount++
+
+		if v == inheritPolicyString {
+			printStderr(" - resetting anomaly action to default value inherited from parent\n")
+
+			p.Action = ""
+		} else {
+			printStderr(" - setting anomaly action to %v\n", v)
+
+			p.Action = v
+		}
+	}
+
+	if err := applyPolicyNumber("percentage of modified files considered anomalous", &p.ModifiedFilesPercent, *policySetAnomalyModifiedPercent, changeCount); err != nil {
+		return err
+	}
+
+	if err := applyPolicyNumber("anomaly history factor", &p.HistoryFactor, *policySetAnomalyHistoryFactor, changeCount); err != nil {
+		return err
+	}
+
+	return applyPolicyNumber("minimum number of files for anomaly detection", &p.MinFileCount, *policySetAnomalyMinFiles, changeCount)
+}
+
+func setCanaryPolicyFromFlags(p *policy.CanaryPolicy, changeCount *int) {
+	if v := *policySetCanary; v != "" {
+		*changeCount++
+
+		if v == inheritPolicyString {
+			printStderr(" - resetting canary action to default value inherited from parent\n")
+
+			p.Action = ""
+		} else {
+			printStderr(" - setting canary action to %v\n", v)
+
+			p.Action = v
+		}
+	}
+
+	if *policySetClearCanaries {
+		*changeCount++
+
+		printStderr(" - removing all canary files\n")
+
+		p.Files = nil
+	} else {
+		p.Files = addRemoveDedupeAndSort("canary files", p.Files, *policySetAddCanary, *policySetRemoveCanary, changeCount)
+	}
+}
+
+func setEncryptedDataPolicyFromFlags(p *policy.EncryptedDataPolicy, changeCount *int) error {
+	switch {
+	case *policySetEncryptedData == "":
+	case *policySetEncryptedData == inheritPolicyString:
+		*changeCount++
+
+		p.Encrypted = nil
+
+		printStderr(" - inherit encrypted data setting from parent\n")
+	default:
+		val, err := strconv.ParseBool(*policySetEncryptedData)
+		if err != nil {
+			return err
+		}
+
+		*changeCount++
+
+		p.Encrypted = &val
+
+		printStderr(" - setting encrypted data to %v\n", val)
+	}
+
+	if v := *policySetEncryptedDataSplitter; v != "" {
+		*changeCount++
+
+		if v == inheritPolicyString {
+			printStderr(" - resetting encrypted data splitter to default value inherited from parent\n")
+
+			p.Splitter = ""
+		} else {
+			printStderr(" - setting encrypted data splitter to %v\n", v)
+
+			p.Splitter = v
+		}
+	}
+
+	return nil
+}
+
+func setFilesystemSnapshotPolicyFromFlags(p *policy.FilesystemSnapshotPolicy, changeCount *int) {
+	if v := *policySetFilesystemSnapshot; v != "" {
+		*changeCount++
+
+		if v == inheritPolicyString {
+			printStderr(" - resetting file system snapshot type to default value inherited from parent\n")
+
+			p.Type = ""
+		} else {
+			printStderr(" - setting file system snapshot type to %v\n", v)
+
+			p.Type = v
+		}
+	}
+
+	if v := *policySetLVMSnapshotSize; v != "" {
+		*changeCount++
+
+		if v == inheritPolicyString {
+			printStderr(" - resetting LVM snapshot size to default value inherited from parent\n")
+
+			p.LVMSnapshotSize = ""
+		} else {
+			printStderr(" - setting LVM snapshot size to %v\n", v)
+
+			p.LVMSnapshotSize = v
+		}
+	}
+}
+
+func setThrottlingPolicyFromFlags(p *policy.ThrottlingPolicy, changeCount *int) error {
+	if err := applyPolicyNumber64("maximum upload speed", &p.MaxUploadBytesPerSecond, *policySetMaxUploadSpeed, changeCount); err != nil {
+		return err
+	}
+
+	if err := applyPolicyNumber64("maximum download speed", &p.MaxDownloadBytesPerSecond, *policySetMaxDownloadSpeed, changeCount); err != nil {
+		return err
+	}
+
+	if len(*policySetBandwidthWindows) == 0 {
+		return nil
+	}
+
+	var windows []policy.BandwidthWindow
+
+	for _, s := range *policySetBandwidthWindows {
+		if s == inheritPolicyString {
+			windows = nil
+			break
+		}
+
+		w, err := parseBandwidthWindow(s)
+		if err != nil {
+			return err
+		}
+
+		windows = append(windows, w)
+	}
+
+	*changeCount++
+
+	p.Windows = windows
+
+	if windows == nil {
+		printStderr(" - resetting bandwidth windows to default value inherited from parent\n")
+	}
+
+	for _, w := range windows {
+		printStderr(" - setting bandwidth during %v to upload %v, download %v\n", w, speedLimitString(w.MaxUploadBytesPerSecond), speedLimitString(w.MaxDownloadBytesPerSecond))
+	}
+
+	return nil
+}
+
+// parseBandwidthWindow parses the bandwidth window in the HH:MM-HH:MM=UPLOAD[/DOWNLOAD] format,
+// when the download speed is not specified it's the same as upload speed.
+func parseBandwidthWindow(s string) (policy.BandwidthWindow, error) {
+	var w policy.BandwidthWindow
+
+	parts := strings.SplitN(s, "=", 2) //nolint:gomnd
+	if len(parts) != 2 {
+		return w, errors.Errorf("invalid bandwidth window %q, must be HH:MM-HH:MM=UPLOAD[/DOWNLOAD]", s)
+	}
+
+	if err := w.ParseWindow(parts[0]); err != nil {
+		return w, err
+	}
+
+	speeds := strings.SplitN(parts[1], "/", 2) //nolint:gomnd
+
+	var err error
+
+	if w.MaxUploadBytesPerSecond, err = parseSpeedLimit(speeds[0]); err != nil {
+		return w, err
+	}
+
+	w.MaxDownloadBytesPerSecond = w.MaxUploadBytesPerSecond
+
+	if len(speeds) > 1 {
+		if w.MaxDownloadBytesPerSecond, err = parseSpeedLimit(speeds[1]); err != nil {
+			return w, err
+		}
+	}
+
+	return w, nil
+}
+
+func parseSpeedLimit(s string) (int64, error) {
+	if s == "unlimited" {
+		return 0, nil
+	}
+
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || v < 0 {
+		return 0, errors.Errorf("invalid speed %q, must be a number of bytes per second or 'unlimited'", s)
+	}
+
+	return v, nil
+}
+
+func speedLimitString(bytesPerSecond int64) string {
+	if bytesPerSecond <= 0 {
+		return "unlimited"
+	}
+
+	return units.BytesStringBase10(bytesPerSecond) + "/s"
+}
+
 func addRemoveDedupeAndSort(desc string, base, add, remove []string, changeCount *int) []string {
 	entries := map[string]bool{}
 	for _, b := range base {
@@ -410,6 +883,83 @@ func applyPolicyNumber64(desc string, val *int64, str string, changeCount *int)
 	return nil
 }
 
+// applyOptionalPolicyNumber64 sets the value of an inheritable number, where zero overrides the value of the parent.
+func applyOptionalPolicyNumber64(desc string, val **int64, str string, changeCount *int) error {
+	if str == "" {
+		// not changed
+		return nil
+	}
+
+	if str == inheritPolicyString || str == "default" {
+		*changeCount++
+
+		printStderr(" - resetting %v to a default value inherited from parent.\n", desc)
+
+		*val = nil
+
+		return nil
+	}
+
+	v, err := strconv.ParseInt(str, 10, 64)
+	if err != nil {
+		return errors.Wrapf(err, "can't parse the %v %q", desc, str)
+	}
+
+	*changeCount++
+
+	printStderr(" - setting %v to %v.\n", desc, v)
+	*val = &v
+
+	return nil
+}
+
+func setExtensionCompressionFromFlags(p *policy.CompressionPolicy, changeCount *int) error {
+	if *policySetClearExtensionCompression {
+		*changeCount++
+
+		p.ExtensionCompressors = nil
+
+		printStderr(" - removing all compression algorithms for particular extensions\n")
+	}
+
+	for _, v := range *policySetExtensionCompression {
+		parts := strings.SplitN(v, "=", 2) //nolint:gomnd
+
+		if len(parts) != 2 { //nolint:gomnd
+			return errors.Errorf("invalid extension compression %q, expected EXT[,EXT...]=ALGORITHM", v)
+		}
+
+		algorithm := parts[1]
+		if !containsString(supportedCompressionAlgorithms(), algorithm) {
+			return errors.Errorf("unsupported compression algorithm %q", algorithm)
+		}
+
+		for _, ext := range strings.Split(parts[0], ",") {
+			if _, isClass := policy.ExtensionClasses[ext]; !isClass && !strings.HasPrefix(ext, ".") {
+				return errors.Errorf("invalid extension %q, must start with a dot or be one of the extension classes", ext)
+			}
+
+			*changeCount++
+
+			if algorithm == inheritPolicyString {
+				printStderr(" - resetting compression algorithm for %v to default value inherited from parent\n", ext)
+				delete(p.ExtensionCompressors, ext)
+
+				continue
+			}
+
+			if p.ExtensionCompressors == nil {
+				p.ExtensionCompressors = map[string]compression.Name{}
+			}
+
+			printStderr(" - setting compression algorithm for %v to %v\n", ext, algorithm)
+			p.ExtensionCompressors[strings.ToLower(ext)] = compression.Name(algorithm)
+		}
+	}
+
+	return nil
+}
+
 func supportedCompressionAlgorithms() []string {
 	var res []string
 	for name := range compression.ByName {
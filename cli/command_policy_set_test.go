@@ -182,3 +182,47 @@ func TestSetErrorHandlingPolicyFromFlags(t *testing.T) {
 func newBool(b bool) *bool {
 	return &b
 }
+
+func TestParseBandwidthWindow(t *testing.T) {
+	for _, tc := range []struct {
+		arg     string
+		want    policy.BandwidthWindow
+		wantErr bool
+	}{
+		{
+			arg:  "00:00-06:00=unlimited",
+			want: policy.BandwidthWindow{Start: policy.TimeOfDay{Hour: 0}, End: policy.TimeOfDay{Hour: 6}},
+		},
+		{
+			arg: "22:30-6:00=1000000",
+			want: policy.BandwidthWindow{
+				Start:                     policy.TimeOfDay{Hour: 22, Minute: 30},
+				End:                       policy.TimeOfDay{Hour: 6},
+				MaxUploadBytesPerSecond:   1000000,
+				MaxDownloadBytesPerSecond: 1000000,
+			},
+		},
+		{
+			arg: "8:00-17:00=500000/unlimited",
+			want: policy.BandwidthWindow{
+				Start:                   policy.TimeOfDay{Hour: 8},
+				End:                     policy.TimeOfDay{Hour: 17},
+				MaxUploadBytesPerSecond: 500000,
+			},
+		},
+		{arg: "8:00-17:00", wantErr: true},
+		{arg: "8:00-17:00=fast", wantErr: true},
+		{arg: "8:00-17:00=-1", wantErr: true},
+		{arg: "8:00=100", wantErr: true},
+	} {
+		got, err := parseBandwidthWindow(tc.arg)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("unexpected error for %q: %v", tc.arg, err)
+			continue
+		}
+
+		if !tc.wantErr && !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("unexpected window for %q: %+v, want %+v", tc.arg, got, tc.want)
+		}
+	}
+}
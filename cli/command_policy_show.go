@@ -3,6 +3,7 @@ package cli
 import (
 	"context"
 	"fmt"
+	"sort"
 
 	"github.com/pkg/errors"
 
@@ -19,6 +20,7 @@ var (
 )
 
 func init() {
+	policyShowCommand.GetArg("target").HintAction(completePolicyTargets)
 	policyShowCommand.Action(repositoryAction(showPolicy))
 }
 
@@ -45,13 +47,16 @@ func showPolicy(ctx context.Context, rep *repo.Repository) error {
 }
 
 func getDefinitionPoint(parents []*policy.Policy, match func(p *policy.Policy) bool) string {
+	// enforced policies take precedence over more specific ones.
 	for i, p := range parents {
-		if match(p) {
-			if i == 0 {
-				return "(defined for this target)"
-			}
+		if p.Enforced && match(p) {
+			return definitionPoint(i, p) + " (enforced)"
+		}
+	}
 
-			return "inherited from " + p.Target().String()
+	for i, p := range parents {
+		if match(p) {
+			return definitionPoint(i, p)
 		}
 
 		if p.NoParent {
@@ -62,6 +67,14 @@ func getDefinitionPoint(parents []*policy.Policy, match func(p *policy.Policy) b
 	return "(default)"
 }
 
+func definitionPoint(i int, p *policy.Policy) string {
+	if i == 0 {
+		return "(defined for this target)"
+	}
+
+	return "inherited from " + p.Target().String()
+}
+
 func containsString(s []string, v string) bool {
 	for _, item := range s {
 		if item == v {
@@ -84,6 +97,22 @@ func printPolicy(p *policy.Policy, parents []*policy.Policy) {
 	printSchedulingPolicy(p, parents)
 	printStdout("\n")
 	printCompressionPolicy(p, parents)
+	printStdout("\n")
+	printMetadataCompressionPolicy(p, parents)
+	printStdout("\n")
+	printChangeDetectionPolicy(p, parents)
+	printStdout("\n")
+	printThrottlingPolicy(p, parents)
+	printStdout("\n")
+	printScreeningPolicy(p, parents)
+	printStdout("\n")
+	printAnomalyPolicy(p, parents)
+	printStdout("\n")
+	printCanaryPolicy(p, parents)
+	printStdout("\n")
+	printEncryptedDataPolicy(p, parents)
+	printStdout("\n")
+	printFilesystemSnapshotPolicy(p, parents)
 }
 
 func printRetentionPolicy(p *policy.Policy, parents []*policy.Policy) {
@@ -154,6 +183,23 @@ func printFilesPolicy(p *policy.Policy, parents []*policy.Policy) {
 				return pol.FilesPolicy.MaxFileSize != 0
 			}))
 	}
+
+	printStdout("  One file system:    %10v  %v\n",
+		p.FilesPolicy.OneFileSystemOrDefault(false),
+		getDefinitionPoint(parents, func(pol *policy.Policy) bool {
+			return pol.FilesPolicy.OneFileSystem != nil
+		}))
+
+	if len(p.FilesPolicy.IncludedMounts) > 0 {
+		printStdout("  Included mount points:\n")
+	}
+
+	for _, m := range p.FilesPolicy.IncludedMounts {
+		m := m
+		printStdout("    %-30v %v\n", m, getDefinitionPoint(parents, func(pol *policy.Policy) bool {
+			return containsString(pol.FilesPolicy.IncludedMounts, m)
+		}))
+	}
 }
 
 func printErrorHandlingPolicy(p *policy.Policy, parents []*policy.Policy) {
@@ -170,6 +216,17 @@ func printErrorHandlingPolicy(p *policy.Policy, parents []*policy.Policy) {
 		getDefinitionPoint(parents, func(pol *policy.Policy) bool {
 			return pol.ErrorHandlingPolicy.IgnoreDirectoryErrors != nil
 		}))
+
+	ioTimeout := "none"
+	if t := p.ErrorHandlingPolicy.IOTimeout(); t > 0 {
+		ioTimeout = t.String()
+	}
+
+	printStdout("  I/O timeout:                   %5v       %v\n",
+		ioTimeout,
+		getDefinitionPoint(parents, func(pol *policy.Policy) bool {
+			return pol.ErrorHandlingPolicy.IOTimeoutSeconds != nil
+		}))
 }
 
 func printSchedulingPolicy(p *policy.Policy, parents []*policy.Policy) {
@@ -207,6 +264,152 @@ func printSchedulingPolicy(p *policy.Policy, parents []*policy.Policy) {
 	if !any {
 		printStdout("  None\n")
 	}
+
+	if n := p.SchedulingPolicy.UploadPriority; n != nil {
+		printStdout("  Upload priority:     %10v  %v\n", *n, getDefinitionPoint(parents, func(pol *policy.Policy) bool {
+			return pol.SchedulingPolicy.UploadPriority != nil
+		}))
+	}
+}
+
+func printChangeDetectionPolicy(p *policy.Policy, parents []*policy.Policy) {
+	printStdout("Change detection:\n")
+	printStdout("  Mode:                %10v  %v\n", p.ChangeDetectionPolicy.Mode, getDefinitionPoint(parents, func(pol *policy.Policy) bool {
+		return pol.ChangeDetectionPolicy.Mode != ""
+	}))
+
+	if n := p.ChangeDetectionPolicy.FullRehashEvery; n != nil && *n > 0 {
+		printStdout("  Snapshots per full rehash:%5v  %v\n", *n, getDefinitionPoint(parents, func(pol *policy.Policy) bool {
+			return pol.ChangeDetectionPolicy.FullRehashEvery != nil
+		}))
+	}
+}
+
+func printThrottlingPolicy(p *policy.Policy, parents []*policy.Policy) {
+	printStdout("Bandwidth:\n")
+	printStdout("  Max upload speed:    %10v  %v\n", speedLimitString(p.ThrottlingPolicy.MaxUploadBytesPerSecond), getDefinitionPoint(parents, func(pol *policy.Policy) bool {
+		return pol.ThrottlingPolicy.MaxUploadBytesPerSecond != 0
+	}))
+	printStdout("  Max download speed:  %10v  %v\n", speedLimitString(p.ThrottlingPolicy.MaxDownloadBytesPerSecond), getDefinitionPoint(parents, func(pol *policy.Policy) bool {
+		return pol.ThrottlingPolicy.MaxDownloadBytesPerSecond != 0
+	}))
+
+	if len(p.ThrottlingPolicy.Windows) == 0 {
+		return
+	}
+
+	printStdout("  Bandwidth windows:                %v\n", getDefinitionPoint(parents, func(pol *policy.Policy) bool {
+		return len(pol.ThrottlingPolicy.Windows) != 0
+	}))
+
+	for _, w := range p.ThrottlingPolicy.Windows {
+		printStdout("    %-11v upload %v, download %v\n", w, speedLimitString(w.MaxUploadBytesPerSecond), speedLimitString(w.MaxDownloadBytesPerSecond))
+	}
+}
+
+func printScreeningPolicy(p *policy.Policy, parents []*policy.Policy) {
+	if !p.ScreeningPolicy.Enabled() {
+		printStdout("Screening of sensitive files disabled.\n")
+		return
+	}
+
+	printStdout("Screening of sensitive files:\n")
+	printStdout("  Action:              %10v  %v\n", p.ScreeningPolicy.Action, getDefinitionPoint(parents, func(pol *policy.Policy) bool {
+		return pol.ScreeningPolicy.Action != ""
+	}))
+
+	if len(p.ScreeningPolicy.NamePatterns) > 0 {
+		printStdout("  Additional sensitive file names:\n")
+	}
+
+	for _, pattern := range p.ScreeningPolicy.NamePatterns {
+		pattern := pattern
+		printStdout("    %-30v %v\n", pattern, getDefinitionPoint(parents, func(pol *policy.Policy) bool {
+			return containsString(pol.ScreeningPolicy.NamePatterns, pattern)
+		}))
+	}
+
+	if len(p.ScreeningPolicy.ContentPatterns) > 0 {
+		printStdout("  Additional sensitive contents:\n")
+	}
+
+	for _, pattern := range p.ScreeningPolicy.ContentPatterns {
+		pattern := pattern
+		printStdout("    %-30v %v\n", pattern, getDefinitionPoint(parents, func(pol *policy.Policy) bool {
+			return containsString(pol.ScreeningPolicy.ContentPatterns, pattern)
+		}))
+	}
+}
+
+func printAnomalyPolicy(p *policy.Policy, parents []*policy.Policy) {
+	if !p.AnomalyPolicy.Enabled() {
+		printStdout("Anomaly detection disabled.\n")
+		return
+	}
+
+	printStdout("Anomaly detection:\n")
+	printStdout("  Action:              %10v  %v\n", p.AnomalyPolicy.Action, getDefinitionPoint(parents, func(pol *policy.Policy) bool {
+		return pol.AnomalyPolicy.Action != ""
+	}))
+	printStdout("  Modified files:      %9v%%  %v\n", valueOrNotSet(p.AnomalyPolicy.ModifiedFilesPercent), getDefinitionPoint(parents, func(pol *policy.Policy) bool {
+		return pol.AnomalyPolicy.ModifiedFilesPercent != nil
+	}))
+	printStdout("  Times typical:       %10v  %v\n", valueOrNotSet(p.AnomalyPolicy.HistoryFactor), getDefinitionPoint(parents, func(pol *policy.Policy) bool {
+		return pol.AnomalyPolicy.HistoryFactor != nil
+	}))
+	printStdout("  Minimum files:       %10v  %v\n", valueOrNotSet(p.AnomalyPolicy.MinFileCount), getDefinitionPoint(parents, func(pol *policy.Policy) bool {
+		return pol.AnomalyPolicy.MinFileCount != nil
+	}))
+}
+
+func printEncryptedDataPolicy(p *policy.Policy, parents []*policy.Policy) {
+	if !p.EncryptedDataPolicy.EncryptedOrDefault(false) {
+		printStdout("Files don't contain encrypted data.\n")
+		return
+	}
+
+	printStdout("Files contain encrypted data, stored uncompressed. %v\n", getDefinitionPoint(parents, func(pol *policy.Policy) bool {
+		return pol.EncryptedDataPolicy.Encrypted != nil
+	}))
+	printStdout("  Splitter:  %10v  %v\n", p.EncryptedDataPolicy.Splitter, getDefinitionPoint(parents, func(pol *policy.Policy) bool {
+		return pol.EncryptedDataPolicy.Splitter != ""
+	}))
+}
+
+func printFilesystemSnapshotPolicy(p *policy.Policy, parents []*policy.Policy) {
+	if !p.FilesystemSnapshotPolicy.Enabled() {
+		printStdout("Files are not read from a file system snapshot.\n")
+		return
+	}
+
+	printStdout("Files are read from a %v snapshot. %v\n", p.FilesystemSnapshotPolicy.Type, getDefinitionPoint(parents, func(pol *policy.Policy) bool {
+		return pol.FilesystemSnapshotPolicy.Type != ""
+	}))
+
+	if p.FilesystemSnapshotPolicy.Type == policy.FilesystemSnapshotLVM {
+		printStdout("  LVM snapshot size:  %10v  %v\n", p.FilesystemSnapshotPolicy.LVMSnapshotSize, getDefinitionPoint(parents, func(pol *policy.Policy) bool {
+			return pol.FilesystemSnapshotPolicy.LVMSnapshotSize != ""
+		}))
+	}
+}
+
+func printCanaryPolicy(p *policy.Policy, parents []*policy.Policy) {
+	if !p.CanaryPolicy.Enabled() {
+		printStdout("No canary files.\n")
+		return
+	}
+
+	printStdout("Canary files:\n")
+	printStdout("  Action:              %10v  %v\n", p.CanaryPolicy.Action, getDefinitionPoint(parents, func(pol *policy.Policy) bool {
+		return pol.CanaryPolicy.Action != ""
+	}))
+
+	for _, pattern := range p.CanaryPolicy.Files {
+		pattern := pattern
+		printStdout("    %-30v %v\n", pattern, getDefinitionPoint(parents, func(pol *policy.Policy) bool {
+			return containsString(pol.CanaryPolicy.Files, pattern)
+		}))
+	}
 }
 
 func printCompressionPolicy(p *policy.Policy, parents []*policy.Policy) {
@@ -217,6 +420,11 @@ func printCompressionPolicy(p *policy.Policy, parents []*policy.Policy) {
 		}))
 	} else {
 		printStdout("Compression disabled.\n")
+	}
+
+	printExtensionCompressors(p, parents)
+
+	if p.CompressionPolicy.CompressorName == "" || p.CompressionPolicy.CompressorName == "none" {
 		return
 	}
 
@@ -255,6 +463,64 @@ func printCompressionPolicy(p *policy.Policy, parents []*policy.Policy) {
 	default:
 		printStdout("  Compress files of all sizes.\n")
 	}
+
+	if p.CompressionPolicy.AdaptiveCompressionOrDefault(false) {
+		printStdout("  Skip compression of chunks whose samples don't compress well. %v\n", getDefinitionPoint(parents, func(pol *policy.Policy) bool {
+			return pol.CompressionPolicy.AdaptiveCompression != nil
+		}))
+	}
+}
+
+func printExtensionCompressors(p *policy.Policy, parents []*policy.Policy) {
+	var keys []string
+
+	for k := range p.CompressionPolicy.ExtensionCompressors {
+		keys = append(keys, k)
+	}
+
+	if len(keys) == 0 {
+		return
+	}
+
+	sort.Strings(keys)
+
+	printStdout("  Compressors for particular extensions:\n")
+
+	for _, k := range keys {
+		k := k
+		printStdout("    %-12v %-18v %v\n", k, p.CompressionPolicy.ExtensionCompressors[k], getDefinitionPoint(parents, func(pol *policy.Policy) bool {
+			_, ok := pol.CompressionPolicy.ExtensionCompressors[k]
+			return ok
+		}))
+	}
+}
+
+func printMetadataCompressionPolicy(p *policy.Policy, parents []*policy.Policy) {
+	printStdout("Directory listings:\n")
+
+	comp := p.CompressionPolicy.MetadataCompressorName
+	if comp == "" {
+		comp = "none"
+	}
+
+	printStdout("  Compressor:          %10v  %v\n", comp, getDefinitionPoint(parents, func(pol *policy.Policy) bool {
+		return pol.CompressionPolicy.MetadataCompressorName != ""
+	}))
+
+	printStdout("  Delta encoding:      %10v  %v\n",
+		p.CompressionPolicy.DeltaEncodeDirectoriesOrDefault(false),
+		getDefinitionPoint(parents, func(pol *policy.Policy) bool {
+			return pol.CompressionPolicy.DeltaEncodeDirectories != nil
+		}))
+
+	inline := "disabled"
+	if v := p.CompressionPolicy.InlineFilesMaxSizeOrDefault(0); v > 0 {
+		inline = units.BytesStringBase10(v)
+	}
+
+	printStdout("  Inline files up to:  %10v  %v\n", inline, getDefinitionPoint(parents, func(pol *policy.Policy) bool {
+		return pol.CompressionPolicy.InlineFilesMaxSize != nil
+	}))
 }
 
 func valueOrNotSet(p *int) string {
@@ -0,0 +1,39 @@
+package cli
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/blob/s3"
+	"github.com/kopia/kopia/repo/lock"
+)
+
+var appendOnlyPolicyCommand = repositoryCommands.Command("append-only-policy", "Print the storage access policy for credentials that can add data to the repository, but not delete or overwrite it.")
+
+func runAppendOnlyPolicyCommand(ctx context.Context, rep *repo.Repository) error {
+	ci := rep.Blobs.ConnectionInfo()
+
+	opt, ok := ci.Config.(*s3.Options)
+	if !ok {
+		return errors.Errorf("append-only policies are not supported for %q storage", ci.Type)
+	}
+
+	// lock blobs are rewritten and removed by all clients.
+	pol, err := s3.AppendOnlyPolicy(opt, []blob.ID{lock.BlobPrefix})
+	if err != nil {
+		return err
+	}
+
+	printStdout("%s\n", pol)
+	printStderr("\nAttach the policy to the credentials of clients and connect them with --append-only.\n")
+	printStderr("The policy can't prevent overwriting objects, enable versioning or object lock on bucket %q to be able to recover overwritten data.\n", opt.BucketName)
+
+	return nil
+}
+
+func init() {
+	appendOnlyPolicyCommand.Action(repositoryAction(runAppendOnlyPolicyCommand))
+}
@@ -13,6 +13,11 @@ import (
 	"gopkg.in/alecthomas/kingpin.v2"
 )
 
+const (
+	overrideHostnameEnvar = "KOPIA_OVERRIDE_HOSTNAME"
+	overrideUsernameEnvar = "KOPIA_OVERRIDE_USERNAME"
+)
+
 var (
 	connectCommand                = repositoryCommands.Command("connect", "Connect to a repository.")
 	connectPersistCredentials     bool
@@ -20,6 +25,13 @@ var (
 	connectMaxCacheSizeMB         int64
 	connectMaxMetadataCacheSizeMB int64
 	connectMaxListCacheDuration   time.Duration
+	connectMaxFormatCacheDuration time.Duration
+	connectListConsistencyDelay   time.Duration
+	connectDetectListConsistency  bool
+	connectManifestMirror         bool
+	connectLocalReplica           string
+	connectAppendOnly             bool
+	connectRequestLimits          = requestLimitsFlag{}
 	connectHostname               string
 	connectUsername               string
 	connectCheckForUpdates        bool
@@ -33,8 +45,15 @@ func setupConnectOptions(cmd *kingpin.CmdClause) {
 	cmd.Flag("content-cache-size-mb", "Size of local content cache").PlaceHolder("MB").Default("5000").Int64Var(&connectMaxCacheSizeMB)
 	cmd.Flag("metadata-cache-size-mb", "Size of local metadata cache").PlaceHolder("MB").Default("5000").Int64Var(&connectMaxMetadataCacheSizeMB)
 	cmd.Flag("max-list-cache-duration", "Duration of index cache").Default("600s").Hidden().DurationVar(&connectMaxListCacheDuration)
-	cmd.Flag("override-hostname", "Override hostname used by this repository connection").Hidden().StringVar(&connectHostname)
-	cmd.Flag("override-username", "Override username used by this repository connection").Hidden().StringVar(&connectUsername)
+	cmd.Flag("max-format-cache-duration", "Duration for which the cached repository format is used before re-reading it, so that format upgrades by other clients are noticed (0 - indefinitely)").Default("0s").DurationVar(&connectMaxFormatCacheDuration)
+	cmd.Flag("list-consistency-delay", "Maximum time for newly written blobs to appear in storage listings, set for storage with eventually-consistent listings (at most 40m for repositories using epoch index format)").Default("0s").DurationVar(&connectListConsistencyDelay)
+	cmd.Flag("detect-list-consistency-delay", "Measure the list consistency delay of the storage when connecting unless it's provided").Default("true").BoolVar(&connectDetectListConsistency)
+	cmd.Flag("manifest-mirror", "Keep a local copy of manifests for instant and offline snapshot listing").BoolVar(&connectManifestMirror)
+	cmd.Flag("local-replica", "Path of a local filesystem copy of the repository to read data from before using the storage").PlaceHolder("PATH").StringVar(&connectLocalReplica)
+	cmd.Flag("append-only", "Never delete or overwrite blobs, for storage credentials that only allow adding data").BoolVar(&connectAppendOnly)
+	cmd.Flag("request-limit", "Limit storage requests of a class (get, put, list or delete) to the provided rate and optional concurrency, such as get=100:16, to avoid throttling by the provider (can be repeated)").PlaceHolder("CLASS=PER_SECOND[:MAX_CONCURRENT]").SetValue(connectRequestLimits)
+	cmd.Flag("override-hostname", "Override hostname used by this repository connection, for stable identity of containers and ephemeral machines").Envar(overrideHostnameEnvar).StringVar(&connectHostname)
+	cmd.Flag("override-username", "Override username used by this repository connection").Envar(overrideUsernameEnvar).StringVar(&connectUsername)
 	cmd.Flag("check-for-updates", "Periodically check for Kopia updates on GitHub").Default("true").Envar(checkForUpdatesEnvar).BoolVar(&connectCheckForUpdates)
 }
 
@@ -46,9 +65,17 @@ func connectOptions() *repo.ConnectOptions {
 			MaxCacheSizeBytes:         connectMaxCacheSizeMB << 20,         //nolint:gomnd
 			MaxMetadataCacheSizeBytes: connectMaxMetadataCacheSizeMB << 20, //nolint:gomnd
 			MaxListCacheDurationSec:   int(connectMaxListCacheDuration.Seconds()),
+			MaxFormatCacheDurationSec: int(connectMaxFormatCacheDuration.Seconds()),
+			ListConsistencyDelaySec:   int(connectListConsistencyDelay.Seconds()),
+			ManifestMirror:            connectManifestMirror,
 		},
 		HostnameOverride: connectHostname,
 		UsernameOverride: connectUsername,
+		LocalReplicaPath: connectLocalReplica,
+		AppendOnly:       connectAppendOnly,
+		RequestLimits:    connectRequestLimits,
+
+		DetectListConsistencyDelay: connectDetectListConsistency,
 	}
 }
 
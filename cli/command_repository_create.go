@@ -21,6 +21,7 @@ var (
 	createBlockHashFormat       = createCommand.Flag("block-hash", "Content hash algorithm.").PlaceHolder("ALGO").Default(hashing.DefaultAlgorithm).Enum(hashing.SupportedAlgorithms()...)
 	createBlockEncryptionFormat = createCommand.Flag("encryption", "Content encryption algorithm.").PlaceHolder("ALGO").Default(encryption.DefaultAlgorithm).Enum(encryption.SupportedAlgorithms(false)...)
 	createSplitter              = createCommand.Flag("object-splitter", "The splitter to use for new objects in the repository").Default(splitter.DefaultAlgorithm).Enum(splitter.SupportedAlgorithms()...)
+	createFormatVersion         = createCommand.Flag("format-version", "Repository format version to use, older versions can be opened by older clients (0 - latest, currently 2 with epoch-based index management)").Default("0").Int()
 
 	createOnly = createCommand.Flag("create-only", "Create repository, but don't connect to it.").Short('c').Bool()
 )
@@ -34,6 +35,7 @@ func newRepositoryOptionsFromFlags() *repo.NewRepositoryOptions {
 		BlockFormat: content.FormattingOptions{
 			Hash:       *createBlockHashFormat,
 			Encryption: *createBlockEncryptionFormat,
+			Version:    *createFormatVersion,
 		},
 
 		ObjectFormat: object.Format{
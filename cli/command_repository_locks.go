@@ -0,0 +1,105 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/lock"
+)
+
+var (
+	locksCommands = repositoryCommands.Command("locks", "Commands to manage cooperative repository locks.")
+
+	locksListCommand = locksCommands.Command("list", "List locks held on the repository").Alias("ls").Default()
+
+	locksBreakCommand = locksCommands.Command("break", "Forcibly remove locks held by other clients")
+	locksBreakIDs     = locksBreakCommand.Arg("id", "IDs of locks to remove").Strings()
+	locksBreakExpired = locksBreakCommand.Flag("expired", "Remove all expired locks").Bool()
+)
+
+func runLocksListCommand(ctx context.Context, rep *repo.Repository) error {
+	locks, err := lock.List(ctx, rep.Blobs, rep.Content)
+	if err != nil {
+		return err
+	}
+
+	now := rep.Time()
+
+	for _, l := range locks {
+		state := "active"
+		if l.Expired(now, lock.DefaultExpiration) {
+			state = "expired"
+		}
+
+		fmt.Printf("%v %-9v %-7v %v@%v pid:%v since %v, refreshed %v: %v\n",
+			l.BlobID, l.Kind, state, l.Username, l.Hostname, l.PID,
+			formatTimestamp(l.Acquired), formatTimestamp(l.Heartbeat), l.Purpose)
+	}
+
+	return nil
+}
+
+func runLocksBreakCommand(ctx context.Context, rep *repo.Repository) error {
+	var ids []blob.ID
+
+	for _, id := range *locksBreakIDs {
+		ids = append(ids, blob.ID(id))
+	}
+
+	if *locksBreakExpired {
+		locks, err := lock.List(ctx, rep.Blobs, rep.Content)
+		if err != nil {
+			return err
+		}
+
+		for _, l := range locks {
+			if l.Expired(rep.Time(), lock.DefaultExpiration) {
+				ids = append(ids, l.BlobID)
+			}
+		}
+	}
+
+	for _, id := range ids {
+		if err := lock.Break(ctx, rep.Blobs, id); err != nil {
+			return err
+		}
+
+		printStderr("Removed lock %v\n", id)
+	}
+
+	return nil
+}
+
+// lockRepository acquires a repository lock and returns a context that is canceled when the lock is lost
+// along with a function that releases the lock.
+func lockRepository(ctx context.Context, rep *repo.Repository, kind lock.Kind, purpose string) (context.Context, func(), error) {
+	l, err := rep.AcquireLock(ctx, kind, purpose)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	lockedCtx, cancel := l.Context(ctx)
+
+	return lockedCtx, func() {
+		cancel()
+		releaseRepositoryLock(ctx, l)
+	}, nil
+}
+
+// releaseRepositoryLock releases the provided lock, errors are only logged since the lock expires on its own.
+func releaseRepositoryLock(ctx context.Context, l *lock.Lock) {
+	if err := l.Err(); err != nil {
+		log(ctx).Errorf("%v aborted: %v", l.Info().Purpose, err)
+	}
+
+	if err := l.Release(ctx); err != nil {
+		log(ctx).Warningf("unable to release repository lock: %v", err)
+	}
+}
+
+func init() {
+	locksListCommand.Action(repositoryAction(runLocksListCommand))
+	locksBreakCommand.Action(repositoryAction(runLocksBreakCommand))
+}
@@ -0,0 +1,79 @@
+package cli
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/content"
+)
+
+const defaultStorageClassName = "default"
+
+var (
+	setStorageClassesCommand = repositoryCommands.Command("set-storage-classes", "Sets storage classes of blobs written to the repository.")
+
+	setStorageClassesIndex      = setStorageClassesCommand.Flag("index", "Storage class of index blobs ('default' to use the default class)").String()
+	setStorageClassesMetadata   = setStorageClassesCommand.Flag("metadata", "Storage class of metadata pack blobs ('default' to use the default class)").String()
+	setStorageClassesData       = setStorageClassesCommand.Flag("data", "Storage class of data pack blobs ('default' to use the default class)").String()
+	setStorageClassesOldData    = setStorageClassesCommand.Flag("old-data", "Storage class old data pack blobs are transitioned to ('default' to disable transitions)").String()
+	setStorageClassesOldDataAge = setStorageClassesCommand.Flag("old-data-age-days", "Age of data pack blobs transitioned to old data storage class").Default("-1").Int()
+)
+
+func runSetStorageClassesCommand(ctx context.Context, rep *repo.Repository) error {
+	p := content.StorageClassPolicy{}
+	if rep.Content.Format.StorageClasses != nil {
+		p = *rep.Content.Format.StorageClasses
+	}
+
+	changed := 0
+
+	for _, c := range []struct {
+		name  string
+		flag  string
+		value *string
+	}{
+		{"index", *setStorageClassesIndex, &p.Index},
+		{"metadata", *setStorageClassesMetadata, &p.Metadata},
+		{"data", *setStorageClassesData, &p.Data},
+		{"old data", *setStorageClassesOldData, &p.OldData},
+	} {
+		switch c.flag {
+		case "":
+			continue
+
+		case defaultStorageClassName:
+			log(ctx).Infof("using default storage class for %v", c.name)
+
+			*c.value = ""
+
+		default:
+			log(ctx).Infof("setting storage class for %v to %v", c.name, c.flag)
+
+			*c.value = c.flag
+		}
+
+		changed++
+	}
+
+	if v := *setStorageClassesOldDataAge; v != -1 {
+		log(ctx).Infof("setting age of old data to %v days", v)
+		p.OldDataAgeDays = v
+		changed++
+	}
+
+	if changed == 0 {
+		return errors.Errorf("no changes")
+	}
+
+	if p == (content.StorageClassPolicy{}) {
+		return rep.SetStorageClassPolicy(ctx, nil)
+	}
+
+	return rep.SetStorageClassPolicy(ctx, &p)
+}
+
+func init() {
+	setStorageClassesCommand.Action(repositoryAction(runSetStorageClassesCommand))
+}
@@ -42,6 +42,18 @@ func runStatusCommand(ctx context.Context, rep *repo.Repository) error {
 	fmt.Printf("Format version:      %v\n", rep.Content.Format.Version)
 	fmt.Printf("Max pack length:     %v\n", units.BytesStringBase2(int64(rep.Content.Format.MaxPackSize)))
 
+	if kp := rep.Content.Format.KeyPurposes; kp != nil {
+		fmt.Printf("Key purposes:        content=%q index=%q manifest=%q cache=%q\n", kp.ContentID, kp.Index, kp.Manifest, kp.LocalCache)
+	}
+
+	if sc := rep.Content.Format.StorageClasses; sc != nil {
+		fmt.Printf("Storage classes:     index=%q metadata=%q data=%q\n", sc.Index, sc.Metadata, sc.Data)
+
+		if sc.OldData != "" {
+			fmt.Printf("Old data:            %q after %v days\n", sc.OldData, sc.OldDataAgeDays)
+		}
+	}
+
 	if *statusReconnectToken {
 		pass := ""
 
@@ -0,0 +1,215 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/units"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/content"
+)
+
+var (
+	syncCommand = repositoryCommands.Command("sync-to", "Synchronizes the contents of this repository to another location")
+
+	syncDelete   = syncCommand.Flag("delete", "Delete blobs from the destination that are not present in the source").Bool()
+	syncDryRun   = syncCommand.Flag("dry-run", "Only print the actions that would be taken").Short('n').Bool()
+	syncParallel = syncCommand.Flag("parallel", "Number of blobs to copy in parallel").Default("8").Int()
+)
+
+func runSyncCommandWithStorage(ctx context.Context, dst blob.Storage) error {
+	rep, err := openRepository(ctx, nil, true)
+	if err != nil {
+		return errors.Wrap(err, "open repository")
+	}
+
+	defer rep.Close(ctx) //nolint:errcheck
+
+	// open the source storage directly, so that providers can copy blobs between storages server-side.
+	src, err := blob.NewStorage(ctx, rep.Blobs.ConnectionInfo())
+	if err != nil {
+		return errors.Wrap(err, "unable to open source storage")
+	}
+
+	defer src.Close(ctx) //nolint:errcheck
+
+	if err := ensureSyncDestinationCompatible(ctx, src, dst); err != nil {
+		return err
+	}
+
+	printStderr("Listing blobs...\n")
+
+	srcBlobs, err := blob.ListAllBlobs(ctx, src, "")
+	if err != nil {
+		return errors.Wrap(err, "unable to list source blobs")
+	}
+
+	dstBlobs := map[blob.ID]blob.Metadata{}
+
+	if err := dst.ListBlobs(ctx, "", func(bm blob.Metadata) error {
+		dstBlobs[bm.BlobID] = bm
+		return nil
+	}); err != nil {
+		return errors.Wrap(err, "unable to list destination blobs")
+	}
+
+	// pack blobs are copied before index blobs referencing them and the format blob is copied last,
+	// so that the destination is usable at all times.
+	var packs, others, format []blob.Metadata
+
+	for _, bm := range srcBlobs {
+		if d, ok := dstBlobs[bm.BlobID]; !ok || d.Length != bm.Length {
+			switch {
+			case bm.BlobID == repo.FormatBlobID:
+				format = append(format, bm)
+			case isPackBlobID(bm.BlobID):
+				packs = append(packs, bm)
+			default:
+				others = append(others, bm)
+			}
+		}
+
+		delete(dstBlobs, bm.BlobID)
+	}
+
+	for _, blobs := range [][]blob.Metadata{packs, others, format} {
+		if err := syncCopyBlobs(ctx, dst, src, blobs); err != nil {
+			return err
+		}
+	}
+
+	if *syncDelete {
+		return syncDeleteBlobs(ctx, dst, dstBlobs)
+	}
+
+	if len(dstBlobs) > 0 {
+		printStderr("Found %v extra blobs in the destination, pass --delete to remove them.\n", len(dstBlobs))
+	}
+
+	return nil
+}
+
+// ensureSyncDestinationCompatible returns an error unless the destination is empty or contains the same repository.
+func ensureSyncDestinationCompatible(ctx context.Context, src, dst blob.Storage) error {
+	srcFormat, err := src.GetBlob(ctx, repo.FormatBlobID, 0, -1)
+	if err != nil {
+		return errors.Wrap(err, "unable to read source format blob")
+	}
+
+	dstFormat, err := dst.GetBlob(ctx, repo.FormatBlobID, 0, -1)
+
+	switch {
+	case err == blob.ErrBlobNotFound:
+		return nil
+	case err != nil:
+		return errors.Wrap(err, "unable to read destination format blob")
+	case !bytes.Equal(srcFormat, dstFormat):
+		return errors.New("destination contains a different repository")
+	default:
+		return nil
+	}
+}
+
+func isPackBlobID(id blob.ID) bool {
+	for _, prefix := range content.PackBlobIDPrefixes {
+		if strings.HasPrefix(string(id), string(prefix)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func syncCopyBlobs(ctx context.Context, dst, src blob.Storage, blobs []blob.Metadata) error {
+	if len(blobs) == 0 {
+		return nil
+	}
+
+	var totalBytes int64
+	for _, bm := range blobs {
+		totalBytes += bm.Length
+	}
+
+	printStderr("Copying %v blobs (%v)...\n", len(blobs), units.BytesStringBase10(totalBytes))
+
+	if *syncDryRun {
+		for _, bm := range blobs {
+			printStderr("  would copy %v (%v)\n", bm.BlobID, units.BytesStringBase10(bm.Length))
+		}
+
+		return nil
+	}
+
+	var (
+		wg                  sync.WaitGroup
+		copied, serverSide  int32
+		copiedBytes, failed int64
+		ch                  = make(chan blob.Metadata)
+	)
+
+	for i := 0; i < *syncParallel; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for bm := range ch {
+				usedServerSide, err := blob.CopyBlob(ctx, dst, src, bm.BlobID)
+				if err != nil {
+					log(ctx).Errorf("unable to copy %v: %v", bm.BlobID, err)
+					atomic.AddInt64(&failed, 1)
+
+					continue
+				}
+
+				if usedServerSide {
+					atomic.AddInt32(&serverSide, 1)
+				}
+
+				if n := atomic.AddInt32(&copied, 1); n%100 == 0 {
+					printStderr("  copied %v of %v blobs...\n", n, len(blobs))
+				}
+
+				atomic.AddInt64(&copiedBytes, bm.Length)
+			}
+		}()
+	}
+
+	for _, bm := range blobs {
+		ch <- bm
+	}
+
+	close(ch)
+	wg.Wait()
+
+	printStderr("Copied %v blobs (%v), %v of them server-side.\n", copied, units.BytesStringBase10(copiedBytes), serverSide)
+
+	if failed > 0 {
+		return errors.Errorf("unable to copy %v blobs", failed)
+	}
+
+	return nil
+}
+
+func syncDeleteBlobs(ctx context.Context, dst blob.Storage, blobs map[blob.ID]blob.Metadata) error {
+	printStderr("Deleting %v extra blobs...\n", len(blobs))
+
+	for id := range blobs {
+		if *syncDryRun {
+			printStderr("  would delete %v\n", id)
+			continue
+		}
+
+		if err := dst.DeleteBlob(ctx, id); err != nil && err != blob.ErrBlobNotFound {
+			return errors.Wrapf(err, "unable to delete %v", id)
+		}
+	}
+
+	return nil
+}
@@ -8,10 +8,20 @@ import (
 
 var (
 	upgradeCommand = repositoryCommands.Command("upgrade", "Upgrade repository format.")
+	upgradeDryRun  = upgradeCommand.Flag("dry-run", "Only show pending format migrations").Bool()
 )
 
 func runUpgradeCommand(ctx context.Context, rep *repo.Repository) error {
-	return rep.Upgrade(ctx)
+	current, latest := rep.FormatVersion()
+	printStderr("Repository format version: %v, latest supported: %v\n", current, latest)
+
+	if current < latest && !*upgradeDryRun {
+		printStderr("NOTE: After the upgrade, clients running older versions of kopia won't be able to open the repository.\n")
+	}
+
+	return rep.Upgrade(ctx, repo.UpgradeOptions{
+		DryRun: *upgradeDryRun,
+	})
 }
 
 func init() {
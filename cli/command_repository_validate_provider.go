@@ -0,0 +1,34 @@
+package cli
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/providervalidation"
+	"github.com/kopia/kopia/repo"
+)
+
+var (
+	validateProviderCommand       = repositoryCommands.Command("validate-provider", "Validate that the storage provider meets the requirements of kopia.")
+	validateProviderNumBlobs      = validateProviderCommand.Flag("num-blobs", "Number of test blobs to write").Default("5").Int()
+	validateProviderMaxBlobLength = validateProviderCommand.Flag("max-blob-length", "Maximum length of test blobs").Default("1048576").Int()
+)
+
+func runValidateProviderCommand(ctx context.Context, rep *repo.Repository) error {
+	opt := providervalidation.DefaultOptions
+	opt.NumBlobs = *validateProviderNumBlobs
+	opt.MaxBlobLength = *validateProviderMaxBlobLength
+
+	if err := providervalidation.ValidateProvider(ctx, rep.Blobs, opt); err != nil {
+		return errors.Wrap(err, "storage provider validation failed")
+	}
+
+	printStderr("Storage provider meets the requirements of kopia.\n")
+
+	return nil
+}
+
+func init() {
+	validateProviderCommand.Action(repositoryAction(runValidateProviderCommand))
+}
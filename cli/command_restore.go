@@ -2,11 +2,17 @@ package cli
 
 import (
 	"context"
+	"fmt"
+	"time"
 
+	"github.com/pkg/errors"
 	kingpin "gopkg.in/alecthomas/kingpin.v2"
 
 	"github.com/kopia/kopia/fs/localfs"
+	"github.com/kopia/kopia/internal/rsync"
+	"github.com/kopia/kopia/internal/units"
 	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/object"
 	"github.com/kopia/kopia/snapshot/snapshotfs"
 )
 
@@ -30,6 +36,32 @@ Similarly, the following command will restore the contents of a subdirectory
 directory named 'sd2'
 
 'restore kffbb7c28ea6c34d6cbe555d1cf80faa9/subdir1/subdir2 sd2'
+
+Instead of a directory ID, a snapshot source followed by '@latest' or '@' and
+a date (YYYY-MM-DD, optionally followed by THH:MM:SS) can be used to refer to
+the latest snapshot of the source taken until that time, for example:
+
+'restore /home/user/projects@2020-05-01/subdir1 sd1'
+
+Instead of a local target path, the contents can be streamed directly to a
+remote host over SSH using --rsync. Only files whose size or modification time
+differ are transferred, so repeated restores to the same location are fast.
+When kopia is installed on the remote host, only the changed parts of those
+files are transferred using rsync's delta algorithm:
+
+'restore kffbb7c28ea6c34d6cbe555d1cf80faa9 --rsync user@host:/srv/data'
+
+To rehearse a restore, for example during disaster recovery drills, use
+--verify-only instead of a target path. All data is downloaded, decrypted and
+verified as during a restore, but nothing is written:
+
+'restore kffbb7c28ea6c34d6cbe555d1cf80faa9 --verify-only'
+
+Data in archival storage tiers, such as S3 Glacier or Azure Archive, must be
+restored before it can be read. Use --from-archive to request the restore and
+wait until all data required by the restore can be read:
+
+'restore kffbb7c28ea6c34d6cbe555d1cf80faa9 d1 --from-archive'
 `
 	restoreCommandSourcePathHelp = `Source directory ID/path in the form of a
 directory ID and optionally a sub-directory path. For example,
@@ -41,35 +73,183 @@ directory ID and optionally a sub-directory path. For example,
 var (
 	restoreCommand           = app.Command("restore", restoreCommandHelp)
 	restoreCommandSourcePath = restoreCommand.Arg("source-path", restoreCommandSourcePathHelp).Required().String()
-	restoreCommandTargetPath = restoreCommand.Arg("target-path", "Path of the directory for the contents to be restored").Required().String()
+	restoreCommandTargetPath = restoreCommand.Arg("target-path", "Path of the directory for the contents to be restored").String()
+	restoreRsyncTarget       = restoreCommand.Flag("rsync", "Restore directly to a remote directory over SSH ([user@]host:path)").String()
+	restoreRsyncDelete       = restoreCommand.Flag("rsync-delete", "Delete remote files that are not present in the snapshot").Bool()
+	restoreSSHCommand        = restoreCommand.Flag("ssh-command", "SSH command used to connect to the remote host").Default("ssh").String()
+	restoreRsyncRemoteKopia  = restoreCommand.Flag("rsync-remote-kopia", "Command to run kopia on the remote host for delta transfer of changed files, empty to always copy whole files").Default("kopia").String()
+	restoreFromArchive       = restoreCommand.Flag("from-archive", "Request restore of data stored in archival storage tiers and wait until it can be read").Bool()
+	restoreArchiveDays       = restoreCommand.Flag("archive-restore-days", "Number of days archived data remains readable after restore").Default("7").Int()
+	restoreArchivePoll       = restoreCommand.Flag("archive-poll-interval", "Interval between checks whether archived data can be read").Default("15m").Duration()
+	restoreOffline           = restoreCommand.Flag("offline", "Restore using only locally cached data, without accessing the repository storage").Bool()
+	restorePreflight         = restoreCommand.Flag("preflight", "Estimate the amount of data to download before restoring").Bool()
+	restoreConfirmAbove      = restoreCommand.Flag("confirm-download-above", "With --preflight, ask for confirmation when more than this amount of data must be downloaded (0 never asks)").Default("1GB").Bytes()
+	restoreVerifyOnly        = restoreCommand.Flag("verify-only", "Read and verify all data required by the restore without writing anything, reporting throughput and files that can't be restored").Bool()
 
 	restoreOverwriteDirectories = true
 	restoreOverwriteFiles       = true
+	restoreInPlaceMinSize       int64
 )
 
 func addRestoreFlags(cmd *kingpin.CmdClause) {
 	cmd.Flag("overwrite-directories", "Overwrite existing directories").BoolVar(&restoreOverwriteDirectories)
 	cmd.Flag("overwrite-files", "Specifies whether or not to overwrite already existing files").
 		BoolVar(&restoreOverwriteFiles)
+	cmd.Flag("in-place-min-size", "Update existing files of at least this many bytes in place, rewriting only chunks that differ (0 disables)").
+		Default("0").Int64Var(&restoreInPlaceMinSize)
 }
 
 func restoreOptions() localfs.CopyOptions {
 	return localfs.CopyOptions{
 		OverwriteDirectories: restoreOverwriteDirectories,
 		OverwriteFiles:       restoreOverwriteFiles,
+		InPlaceUpdateMinSize: restoreInPlaceMinSize,
 	}
 }
 
 func runRestoreCommand(ctx context.Context, rep *repo.Repository) error {
+	if *restoreVerifyOnly && (*restoreCommandTargetPath != "" || *restoreRsyncTarget != "") {
+		return errors.New("target path can't be specified together with --verify-only")
+	}
+
 	oid, err := parseObjectID(ctx, rep, *restoreCommandSourcePath)
 	if err != nil {
 		return err
 	}
 
+	if err := verifyAvailableOffline(ctx, rep, snapshotfs.DirectoryEntry(rep, oid, nil)); err != nil {
+		return err
+	}
+
+	if *restorePreflight && !rep.IsOffline() {
+		if err := restorePreflightCheck(ctx, rep, oid); err != nil {
+			return err
+		}
+	}
+
+	if *restoreFromArchive {
+		if err := restoreFromArchiveTiers(ctx, rep, oid); err != nil {
+			return err
+		}
+	}
+
+	if *restoreVerifyOnly {
+		return restoreVerify(ctx, rep, oid)
+	}
+
+	if *restoreRsyncTarget != "" {
+		if *restoreCommandTargetPath != "" {
+			return errors.New("target path can't be specified together with --rsync")
+		}
+
+		return restoreRsync(ctx, rep, oid, *restoreRsyncTarget)
+	}
+
+	if *restoreCommandTargetPath == "" {
+		return errors.New("target path must be specified")
+	}
+
 	return snapshotfs.RestoreRoot(ctx, rep, *restoreCommandTargetPath, oid, restoreOptions())
 }
 
+// restorePreflightSampleBytes is the amount of data downloaded to measure the throughput of the storage.
+const restorePreflightSampleBytes = 4 << 20
+
+func restorePreflightCheck(ctx context.Context, rep *repo.Repository, oid object.ID) error {
+	printStderr("Estimating the amount of data to download...\n")
+
+	est, err := snapshotfs.EstimateRestore(ctx, rep, oid, restorePreflightSampleBytes)
+	if err != nil {
+		return errors.Wrap(err, "unable to estimate restore")
+	}
+
+	printStderr("%v contents (%v) are in the local cache, %v contents (%v) must be downloaded",
+		est.CachedContentCount, units.BytesStringBase10(est.CachedBytes),
+		est.ContentCount-est.CachedContentCount, units.BytesStringBase10(est.DownloadBytes))
+
+	if d := est.EstimatedDownloadTime(); d > 0 {
+		printStderr(", which takes about %v at %v/s", d.Round(time.Second), units.BytesStringBase10(int64(est.BytesPerSecond)))
+	}
+
+	printStderr(".\n")
+
+	if threshold := int64(*restoreConfirmAbove); threshold > 0 && est.DownloadBytes > threshold {
+		if !askForConfirmation(fmt.Sprintf("More than %v must be downloaded, continue?", units.BytesStringBase10(threshold))) {
+			return errors.New("restore canceled")
+		}
+	}
+
+	return nil
+}
+
+func restoreFromArchiveTiers(ctx context.Context, rep *repo.Repository, oid object.ID) error {
+	printStderr("Requesting restore of archived data...\n")
+
+	return snapshotfs.RestoreFromArchive(ctx, rep, oid, snapshotfs.ArchiveRestoreOptions{
+		Days:         *restoreArchiveDays,
+		PollInterval: *restoreArchivePoll,
+		Progress: func(ready, total int) {
+			if ready < total {
+				printStderr("%v of %v pack blobs can be read, checking again in %v.\n", ready, total, *restoreArchivePoll)
+			} else {
+				printStderr("All %v pack blobs can be read, restoring.\n", total)
+			}
+		},
+	})
+}
+
+func restoreRsync(ctx context.Context, rep *repo.Repository, oid object.ID, target string) error {
+	dest, err := rsync.Dial(ctx, target, *restoreSSHCommand)
+	if err != nil {
+		return err
+	}
+	defer dest.Close() //nolint:errcheck
+
+	opt := rsync.Options{
+		Delete: *restoreRsyncDelete,
+	}
+
+	if *restoreRsyncRemoteKopia != "" {
+		opt.Remote = dest.Remote(*restoreRsyncRemoteKopia)
+	}
+
+	stats, err := rsync.Sync(ctx, dest.Client, dest.Path, snapshotfs.DirectoryEntry(rep, oid, nil), opt)
+	if err != nil {
+		return errors.Wrap(err, "unable to restore to remote host")
+	}
+
+	printStderr("Restored to %v: %v files copied and %v updated (%v transferred, %v matched), %v up-to-date, %v deleted.\n",
+		target, stats.FilesCopied, stats.FilesPatched, units.BytesStringBase10(stats.BytesCopied),
+		units.BytesStringBase10(stats.BytesMatched), stats.FilesSkipped, stats.Deleted)
+
+	return nil
+}
+
+func restoreVerify(ctx context.Context, rep *repo.Repository, oid object.ID) error {
+	printStderr("Verifying restore of %v without writing files...\n", oid)
+
+	stats, err := snapshotfs.VerifyRestore(ctx, snapshotfs.DirectoryEntry(rep, oid, nil))
+	if err != nil {
+		return err
+	}
+
+	for _, f := range stats.Failures {
+		printStderr("unable to restore %v: %v\n", f.Path, f.Error)
+	}
+
+	printStderr("Verified %v files (%v), %v directories and %v symlinks in %v at %v/s.\n",
+		stats.Files, units.BytesStringBase10(stats.Bytes), stats.Directories, stats.Symlinks,
+		stats.Duration.Round(time.Millisecond), units.BytesStringBase10(int64(stats.BytesPerSecond())))
+
+	if len(stats.Failures) > 0 {
+		return errors.Errorf("%v entries can't be restored", len(stats.Failures))
+	}
+
+	return nil
+}
+
 func init() {
+	restoreCommand.GetArg("source-path").HintAction(completeSnapshotRoots)
 	addRestoreFlags(restoreCommand)
-	restoreCommand.Action(repositoryAction(runRestoreCommand))
+	restoreCommand.Action(offlineCapableRepositoryAction(restoreOffline, runRestoreCommand))
 }
@@ -0,0 +1,34 @@
+package cli
+
+import (
+	"context"
+	"os"
+
+	"github.com/kopia/kopia/internal/rsync"
+)
+
+var (
+	rsyncReceiverCommands = app.Command(rsync.ReceiverCommand, "Receiving side of 'restore --rsync' delta transfers, invoked over SSH.").Hidden()
+
+	rsyncReceiverSignatureCommand   = rsyncReceiverCommands.Command("signature", "Write block signature of a file to stdout")
+	rsyncReceiverSignatureBlockSize = rsyncReceiverSignatureCommand.Flag("block-size", "Block size").Required().Int()
+	rsyncReceiverSignatureBasis     = rsyncReceiverSignatureCommand.Arg("basis", "Basis file").Required().String()
+
+	rsyncReceiverPatchCommand   = rsyncReceiverCommands.Command("patch", "Create a file from the basis file and delta read from stdin")
+	rsyncReceiverPatchBlockSize = rsyncReceiverPatchCommand.Flag("block-size", "Block size").Required().Int()
+	rsyncReceiverPatchBasis     = rsyncReceiverPatchCommand.Arg("basis", "Basis file").Required().String()
+	rsyncReceiverPatchTarget    = rsyncReceiverPatchCommand.Arg("target", "Target file").Required().String()
+)
+
+func init() {
+	rsyncReceiverSignatureCommand.Action(noRepositoryAction(runRsyncReceiverSignature))
+	rsyncReceiverPatchCommand.Action(noRepositoryAction(runRsyncReceiverPatch))
+}
+
+func runRsyncReceiverSignature(ctx context.Context) error {
+	return rsync.WriteFileSignature(*rsyncReceiverSignatureBasis, *rsyncReceiverSignatureBlockSize, os.Stdout)
+}
+
+func runRsyncReceiverPatch(ctx context.Context) error {
+	return rsync.ApplyFileDelta(*rsyncReceiverPatchBasis, *rsyncReceiverPatchTarget, *rsyncReceiverPatchBlockSize, os.Stdin)
+}
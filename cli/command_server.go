@@ -1,25 +1,62 @@
 package cli
 
 import (
+	"crypto/tls"
+
 	"github.com/kopia/kopia/internal/serverapi"
 
 	"github.com/pkg/errors"
 )
 
 var (
-	serverAddress  = serverCommands.Flag("address", "Server address").Default("http://127.0.0.1:51515").String()
+	serverAddress  = serverCommands.Flag("address", "Server address (defaults to the daemon socket if the daemon is running, "+defaultServerAddress+" otherwise)").String()
 	serverUsername = serverCommands.Flag("server-username", "HTTP server username (basic auth)").Envar("KOPIA_SERVER_USERNAME").Default("kopia").String()
 	serverPassword = serverCommands.Flag("server-password", "HTTP server password (basic auth)").Envar("KOPIA_SERVER_PASSWORD").String()
+
+	serverClientCertFile = serverCommands.Flag("client-cert-file", "TLS client certificate PEM file used to authenticate to the server").String()
+	serverClientKeyFile  = serverCommands.Flag("client-key-file", "TLS client key PEM file used to authenticate to the server").String()
 )
 
-func serverAPIClientOptions() (serverapi.ClientOptions, error) {
-	if *serverAddress == "" {
-		return serverapi.ClientOptions{}, errors.Errorf("missing server address")
+const defaultServerAddress = "http://127.0.0.1:51515"
+
+// serverListenAddress returns the address 'server start' listens on.
+func serverListenAddress() string {
+	if *serverAddress != "" {
+		return *serverAddress
+	}
+
+	return defaultServerAddress
+}
+
+// serverClientAddress returns the address API clients connect to, preferring the daemon
+// when no address was provided, so that commands don't need to connect to the repository themselves.
+func serverClientAddress() string {
+	if *serverAddress != "" {
+		return *serverAddress
+	}
+
+	if p := daemonSocketPath(); isDaemonRunning(p) {
+		return "unix:" + p
 	}
 
-	return serverapi.ClientOptions{
-		BaseURL:  *serverAddress,
+	return defaultServerAddress
+}
+
+func serverAPIClientOptions() (serverapi.ClientOptions, error) {
+	opts := serverapi.ClientOptions{
+		BaseURL:  serverClientAddress(),
 		Username: *serverUsername,
 		Password: *serverPassword,
-	}, nil
+	}
+
+	if *serverClientCertFile != "" || *serverClientKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(*serverClientCertFile, *serverClientKeyFile)
+		if err != nil {
+			return serverapi.ClientOptions{}, errors.Wrap(err, "unable to load client certificate")
+		}
+
+		opts.ClientCertificates = []tls.Certificate{cert}
+	}
+
+	return opts, nil
 }
@@ -0,0 +1,133 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/discovery"
+	"github.com/kopia/kopia/internal/serverapi"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/snapshot"
+)
+
+var (
+	agentRegisterCommand  = serverCommands.Command("agent-register", "Register this machine with the server and report snapshot sources discovered on it")
+	agentRegisterHostname = agentRegisterCommand.Flag("hostname", "Override the hostname the machine is registered as").String()
+	agentRegisterUsername = agentRegisterCommand.Flag("username", "Override the username the machine is registered as").String()
+	agentRegisterEvery    = agentRegisterCommand.Flag("every", "Keep re-registering the machine at the provided interval").Duration()
+
+	agentListCommand = serverCommands.Command("agents", "List machines registered with the server")
+
+	agentEnableSourceCommand = serverCommands.Command("enable-source", "Enable snapshotting of a source on a registered machine")
+	agentEnableSourceTarget  = agentEnableSourceCommand.Arg("source", "Source to enable (user@host:/path)").Required().String()
+)
+
+func init() {
+	agentRegisterCommand.Action(serverAction(runAgentRegister))
+	agentListCommand.Action(serverAction(runAgentList))
+	agentEnableSourceCommand.Action(serverAction(runAgentEnableSource))
+}
+
+func discoverAgentInfo(ctx context.Context) *serverapi.AgentInfo {
+	info := &serverapi.AgentInfo{
+		Hostname:        *agentRegisterHostname,
+		Username:        *agentRegisterUsername,
+		OS:              runtime.GOOS,
+		Volumes:         discovery.Volumes(),
+		HomeDirectories: discovery.HomeDirectories(),
+	}
+
+	if info.Hostname == "" {
+		info.Hostname = repo.GetDefaultHostName(ctx)
+	}
+
+	if info.Username == "" {
+		info.Username = repo.GetDefaultUserName(ctx)
+	}
+
+	return info
+}
+
+func runAgentRegister(ctx context.Context, cli *serverapi.Client) error {
+	for {
+		info := discoverAgentInfo(ctx)
+
+		if err := cli.RegisterAgent(ctx, info); err != nil {
+			return errors.Wrap(err, "unable to register agent")
+		}
+
+		printStderr("Registered %v@%v with %v volumes and %v home directories.\n",
+			info.Username, info.Hostname, len(info.Volumes), len(info.HomeDirectories))
+
+		if *agentRegisterEvery <= 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(*agentRegisterEvery):
+		}
+	}
+}
+
+func runAgentList(ctx context.Context, cli *serverapi.Client) error {
+	resp, err := cli.ListAgents(ctx)
+	if err != nil {
+		return errors.Wrap(err, "unable to list agents")
+	}
+
+	for _, a := range resp.Agents {
+		fmt.Printf("%v@%v (%v) last seen %v\n", a.Username, a.Hostname, a.OS, formatTimestamp(a.LastSeen))
+
+		printAgentPaths("volumes", a.Volumes)
+		printAgentPaths("home directories", a.HomeDirectories)
+
+		var enabled []string
+		for _, src := range a.Sources {
+			enabled = append(enabled, src.Path)
+		}
+
+		printAgentPaths("enabled sources", enabled)
+	}
+
+	return nil
+}
+
+func printAgentPaths(title string, paths []string) {
+	if len(paths) == 0 {
+		fmt.Printf("  %v: (none)\n", title)
+		return
+	}
+
+	fmt.Printf("  %v: %v\n", title, strings.Join(paths, ", "))
+}
+
+func runAgentEnableSource(ctx context.Context, cli *serverapi.Client) error {
+	src, err := snapshot.ParseSourceInfo(*agentEnableSourceTarget, "", "")
+	if err != nil {
+		return errors.Wrap(err, "invalid source")
+	}
+
+	if src.Host == "" || src.UserName == "" || src.Path == "" {
+		return errors.Errorf("source must be specified as user@host:/path")
+	}
+
+	resp, err := cli.EnableAgentSource(ctx, &serverapi.EnableAgentSourceRequest{Source: src})
+	if err != nil {
+		return errors.Wrap(err, "unable to enable source")
+	}
+
+	if resp.Created {
+		printStderr("Enabled %v.\n", src)
+	} else {
+		printStderr("%v is already enabled.\n", src)
+	}
+
+	return nil
+}
@@ -7,17 +7,30 @@ import (
 	"encoding/hex"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
 	"strings"
+	"time"
 
 	"contrib.go.opencensus.io/exporter/prometheus"
 	"github.com/pkg/errors"
 	prom "github.com/prometheus/client_golang/prometheus"
 
+	"github.com/kopia/kopia/internal/s3gateway"
 	"github.com/kopia/kopia/internal/server"
 	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/content"
+)
+
+// defaults of periodic pack rewrites and consolidations, matching those of 'kopia content defragment' and 'kopia content consolidate'.
+const (
+	defaultPackRewriteDeletedMinAge          = 24 * time.Hour
+	defaultPackRewriteMinAge                 = 24 * time.Hour
+	defaultPackRewriteGracePeriod            = time.Hour
+	defaultPackRewriteParallel               = 4
+	defaultPackConsolidationSmallPackPercent = 50
 )
 
 var (
@@ -26,6 +39,30 @@ var (
 	serverStartUI              = serverStartCommand.Flag("ui", "Start the server with HTML UI (EXPERIMENTAL)").Bool()
 	serverStartRefreshInterval = serverStartCommand.Flag("refresh-interval", "Frequency for refreshing repository status").Default("10s").Duration()
 
+	serverStartQuotaPerSourceMB = serverStartCommand.Flag("quota-per-source-mb", "Maximum amount of new data (in MB) each source can upload per quota period").PlaceHolder("MB").Default("0").Int64()
+	serverStartQuotaPerUserMB   = serverStartCommand.Flag("quota-per-user-mb", "Maximum amount of new data (in MB) all sources of each user can upload per quota period").PlaceHolder("MB").Default("0").Int64()
+	serverStartQuotaPeriod      = serverStartCommand.Flag("quota-period", "Period over which upload quotas are enforced").Default("24h").Duration()
+
+	serverStartMaxConcurrentSnapshots = serverStartCommand.Flag("max-concurrent-snapshots", "Maximum number of sources snapshotted at the same time, sharing upload throughput according to their upload priorities").Default("1").Int()
+
+	serverStartSigningKey = serverStartCommand.Flag("signing-key", "Sign snapshots with the private key from the provided file").Envar("KOPIA_SIGNING_KEY").ExistingFile()
+
+	serverStartAuthoritativePolicies = serverStartCommand.Flag("authoritative-policies", "Apply policies from the provided bundle created by 'policy export' to the repository on each refresh, reverting changes made by clients").ExistingFile()
+
+	serverStartRestoreTestInterval = serverStartCommand.Flag("restore-test-interval", "Periodically read randomly selected files from recent snapshots to verify they can be restored, 0 to disable").Default("0").Duration()
+	serverStartRestoreTestFiles    = serverStartCommand.Flag("restore-test-files", "Number of files read by each periodic restore test").Default("5").Int()
+
+	serverStartPackRewriteInterval        = serverStartCommand.Flag("pack-rewrite-interval", "Periodically rewrite contents in use from packs containing mostly deleted contents and delete the packs, 0 to disable").Default("0").Duration()
+	serverStartPackRewriteMinWastePercent = serverStartCommand.Flag("pack-rewrite-min-waste-percent", "Minimum percentage of deleted data in a pack to rewrite it").Default("50").Int()
+
+	serverStartPackConsolidationInterval = serverStartCommand.Flag("pack-consolidation-interval", "Periodically merge small packs into full-size ones to reduce the number of storage requests, 0 to disable").Default("0").Duration()
+	serverStartPackConsolidationMinPacks = serverStartCommand.Flag("pack-consolidation-min-packs", "Minimum number of small packs to consolidate").Default("10").Int()
+
+	serverStartAnonymousContents = serverStartCommand.Flag("anonymous-content-access", "Serve content blocks at /api/v1/contents/ without authentication, so that they can be cached by a CDN").Bool()
+
+	serverStartS3GatewayAddress = serverStartCommand.Flag("s3-gateway-address", "Expose snapshots as read-only buckets using S3-compatible API at the provided address").String()
+	serverStartS3GatewayRegion  = serverStartCommand.Flag("s3-gateway-region", "Region reported by the S3-compatible gateway").Default("us-east-1").String()
+
 	serverStartRandomPassword = serverStartCommand.Flag("random-password", "Generate random password and print to stderr").Hidden().Bool()
 	serverStartAutoShutdown   = serverStartCommand.Flag("auto-shutdown", "Auto shutdown the server if API requests not received within given time").Hidden().Duration()
 )
@@ -36,10 +73,57 @@ func init() {
 }
 
 func runServer(ctx context.Context, rep *repo.Repository) error {
+	if *serverStartTenantsFile != "" {
+		if rep != nil {
+			log(ctx).Warningf("ignoring connected repository, serving tenants from %v", *serverStartTenantsFile)
+		}
+
+		return runMultiTenantServer(ctx)
+	}
+
+	if err := loadSnapshotSigningKey(*serverStartSigningKey); err != nil {
+		return err
+	}
+
 	srv, err := server.New(ctx, rep, server.Options{
 		ConfigFile:      repositoryConfigFileName(),
 		ConnectOptions:  connectOptions(),
 		RefreshInterval: *serverStartRefreshInterval,
+		QuotaPerSource:  *serverStartQuotaPerSourceMB << 20, //nolint:gomnd
+		QuotaPerUser:    *serverStartQuotaPerUserMB << 20,   //nolint:gomnd
+		QuotaPeriod:     *serverStartQuotaPeriod,
+
+		MaxConcurrentSnapshots: *serverStartMaxConcurrentSnapshots,
+		SigningKey:             snapshotSigningKey,
+
+		LoadAuthoritativePolicies: authoritativePoliciesLoader(*serverStartAuthoritativePolicies),
+
+		RestoreTestInterval: *serverStartRestoreTestInterval,
+		RestoreTestFiles:    *serverStartRestoreTestFiles,
+
+		PackRewriteInterval: *serverStartPackRewriteInterval,
+		PackRewrite: content.PackRewriteOptions{
+			MinWastePercent:      *serverStartPackRewriteMinWastePercent,
+			DeletedContentMinAge: defaultPackRewriteDeletedMinAge,
+			BlobGC: content.BlobGCOptions{
+				MinAge:      defaultPackRewriteMinAge,
+				GracePeriod: defaultPackRewriteGracePeriod,
+				Parallel:    defaultPackRewriteParallel,
+			},
+			Parallel: defaultPackRewriteParallel,
+		},
+
+		PackConsolidationInterval: *serverStartPackConsolidationInterval,
+		PackConsolidation: content.PackConsolidationOptions{
+			SmallPackPercent: defaultPackConsolidationSmallPackPercent,
+			MinPackCount:     *serverStartPackConsolidationMinPacks,
+			BlobGC: content.BlobGCOptions{
+				MinAge:      defaultPackRewriteMinAge,
+				GracePeriod: defaultPackRewriteGracePeriod,
+				Parallel:    defaultPackRewriteParallel,
+			},
+			Parallel: defaultPackRewriteParallel,
+		},
 	})
 	if err != nil {
 		return errors.Wrap(err, "unable to initialize server")
@@ -49,6 +133,14 @@ func runServer(ctx context.Context, rep *repo.Repository) error {
 		return errors.Wrap(err, "error connecting to repository")
 	}
 
+	if *serverStartS3GatewayAddress != "" {
+		shutdownS3Gateway, err := startS3Gateway(ctx, srv)
+		if err != nil {
+			return err
+		}
+		defer shutdownS3Gateway()
+	}
+
 	mux := http.NewServeMux()
 
 	mux.Handle("/api/", srv.APIHandlers())
@@ -60,7 +152,7 @@ func runServer(ctx context.Context, rep *repo.Repository) error {
 		mux.Handle("/", serveIndexFileForKnownUIRoutes(http.FileServer(server.AssetFile())))
 	}
 
-	httpServer := &http.Server{Addr: stripProtocol(*serverAddress)}
+	httpServer := &http.Server{Addr: stripProtocol(serverListenAddress())}
 	srv.OnShutdown = httpServer.Shutdown
 
 	onCtrlC(func() {
@@ -79,6 +171,10 @@ func runServer(ctx context.Context, rep *repo.Repository) error {
 		return errors.Wrap(err, "error initializing Prometheus")
 	}
 
+	if *serverStartAnonymousContents {
+		mux.Handle("/api/v1/contents/", srv.ContentHandler())
+	}
+
 	var handler http.Handler = mux
 
 	if as := *serverStartAutoShutdown; as > 0 {
@@ -100,6 +196,51 @@ func runServer(ctx context.Context, rep *repo.Repository) error {
 	return srv.SetRepository(ctx, nil)
 }
 
+// startS3Gateway starts serving S3-compatible API on a separate address, since S3 clients expect
+// buckets at the root URL. The server username and password are used as access key and secret key.
+// Requests are served using the repository the server is currently connected to.
+func startS3Gateway(ctx context.Context, srv *server.Server) (func(), error) {
+	opt := s3gateway.Options{Region: *serverStartS3GatewayRegion}
+
+	if *serverPassword != "" {
+		opt.AccessKeyID = *serverUsername
+		opt.SecretAccessKey = *serverPassword
+	} else {
+		log(ctx).Warningf("server password not set, S3 gateway will allow anonymous access")
+	}
+
+	l, err := net.Listen("tcp", *serverStartS3GatewayAddress)
+	if err != nil {
+		return nil, errors.Wrap(err, "S3 gateway listen error")
+	}
+
+	s3Server := &http.Server{
+		Handler: s3gateway.New(srv, opt),
+	}
+
+	go func() {
+		var serr error
+
+		if *serverStartTLSCertFile != "" && *serverStartTLSKeyFile != "" {
+			fmt.Fprintf(os.Stderr, "S3 GATEWAY ADDRESS: https://%v\n", l.Addr())
+			serr = s3Server.ServeTLS(l, *serverStartTLSCertFile, *serverStartTLSKeyFile)
+		} else {
+			fmt.Fprintf(os.Stderr, "S3 GATEWAY ADDRESS: http://%v\n", l.Addr())
+			serr = s3Server.Serve(l)
+		}
+
+		if serr != http.ErrServerClosed {
+			log(ctx).Warningf("S3 gateway error: %v", serr)
+		}
+	}()
+
+	return func() {
+		if err := s3Server.Shutdown(ctx); err != nil {
+			log(ctx).Warningf("unable to shut down S3 gateway: %v", err)
+		}
+	}, nil
+}
+
 func initPrometheus(mux *http.ServeMux) error {
 	reg := prom.NewRegistry()
 	if err := reg.Register(prom.NewProcessCollector(prom.ProcessCollectorOpts{})); err != nil {
@@ -130,7 +271,8 @@ func stripProtocol(addr string) string {
 func isKnownUIRoute(path string) bool {
 	return strings.HasPrefix(path, "/snapshots/") ||
 		strings.HasPrefix(path, "/policies") ||
-		strings.HasPrefix(path, "/repo")
+		strings.HasPrefix(path, "/repo") ||
+		strings.HasPrefix(path, "/maintenance")
 }
 
 func serveIndexFileForKnownUIRoutes(h http.Handler) http.Handler {
@@ -0,0 +1,124 @@
+package cli
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/server"
+	"github.com/kopia/kopia/repo"
+)
+
+var (
+	serverStartTenantsFile = serverStartCommand.Flag("tenants", "Serve multiple repositories described in the provided JSON file, routing API clients to their repository by credentials").ExistingFile()
+)
+
+// runMultiTenantServer runs a server that fronts multiple repositories, each represented by a separate
+// server.Server reachable only with credentials of its tenant.
+func runMultiTenantServer(ctx context.Context) error {
+	if *serverStartS3GatewayAddress != "" || *serverStartAnonymousContents {
+		return errors.New("S3 gateway and anonymous content access are not supported with multiple tenants")
+	}
+
+	tenants, err := server.LoadTenants(*serverStartTenantsFile)
+	if err != nil {
+		return err
+	}
+
+	router := server.NewTenantRouter()
+
+	var servers []*server.Server
+
+	defer func() {
+		for _, srv := range servers {
+			if err := srv.SetRepository(ctx, nil); err != nil {
+				log(ctx).Warningf("unable to close repository: %v", err)
+			}
+		}
+	}()
+
+	for _, t := range tenants {
+		srv, err := startTenantServer(ctx, t)
+		if err != nil {
+			return errors.Wrapf(err, "unable to start server for tenant %q", t.Name)
+		}
+
+		servers = append(servers, srv)
+
+		if err := router.Add(t, srv.APIHandlers()); err != nil {
+			return err
+		}
+
+		log(ctx).Infof("serving repository %v for tenant %v", t.ConfigFile, t.Name)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/api/", router)
+
+	if *serverStartHTMLPath != "" {
+		mux.Handle("/", http.FileServer(http.Dir(*serverStartHTMLPath)))
+	} else if *serverStartUI {
+		mux.Handle("/", serveIndexFileForKnownUIRoutes(http.FileServer(server.AssetFile())))
+	}
+
+	if err = initPrometheus(mux); err != nil {
+		return errors.Wrap(err, "error initializing Prometheus")
+	}
+
+	httpServer := &http.Server{Addr: stripProtocol(serverListenAddress())}
+
+	onCtrlC(func() {
+		log(ctx).Infof("Shutting down...")
+
+		if serr := httpServer.Shutdown(ctx); serr != nil {
+			log(ctx).Warningf("unable to shut down: %v", serr)
+		}
+	})
+
+	var handler http.Handler = mux
+
+	if as := *serverStartAutoShutdown; as > 0 {
+		log(ctx).Infof("starting a watchdog to stop the server if there's no activity for %v", as)
+		handler = startServerWatchdog(handler, as, func() {
+			if serr := httpServer.Shutdown(ctx); serr != nil {
+				log(ctx).Warningf("unable to stop the server: %v", serr)
+			}
+		})
+	}
+
+	httpServer.Handler = handler
+
+	if err = startServerWithOptionalTLS(ctx, httpServer); err != http.ErrServerClosed {
+		return err
+	}
+
+	return nil
+}
+
+func startTenantServer(ctx context.Context, t server.Tenant) (*server.Server, error) {
+	rep, err := repo.Open(ctx, t.ConfigFile, t.RepositoryPassword, applyOptionsFromFlags(ctx, nil))
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to open repository")
+	}
+
+	srv, err := server.New(ctx, rep, server.Options{
+		ConfigFile:                  t.ConfigFile,
+		RefreshInterval:             *serverStartRefreshInterval,
+		QuotaPerSource:              *serverStartQuotaPerSourceMB << 20, //nolint:gomnd
+		QuotaPerUser:                *serverStartQuotaPerUserMB << 20,   //nolint:gomnd
+		QuotaPeriod:                 *serverStartQuotaPeriod,
+		DisableRepositoryManagement: true,
+	})
+	if err != nil {
+		rep.Close(ctx) //nolint:errcheck
+		return nil, err
+	}
+
+	if err := srv.SetRepository(ctx, rep); err != nil {
+		rep.Close(ctx) //nolint:errcheck
+		return nil, err
+	}
+
+	return srv, nil
+}
@@ -23,6 +23,10 @@ func runServerStatus(ctx context.Context, cli *serverapi.Client) error {
 
 	for _, src := range status.Sources {
 		fmt.Printf("%15v %v\n", src.Status, src.Source)
+
+		if src.LastError != "" {
+			fmt.Printf("%15v %v\n", "", src.LastError)
+		}
 	}
 
 	return nil
@@ -129,6 +129,21 @@ func startServerWithOptionalTLS(ctx context.Context, httpServer *http.Server) er
 }
 
 func startServerWithOptionalTLSAndListener(ctx context.Context, httpServer *http.Server, listener net.Listener) error {
+	if *serverStartTLSClientCAFile != "" {
+		if *serverStartTLSCertFile == "" && !*serverStartTLSGenerateCert {
+			return errors.New("TLS client certificate authentication requires TLS")
+		}
+
+		v, err := newClientCertVerifier(ctx, *serverStartTLSClientCAFile, *serverStartTLSClientCRLFile)
+		if err != nil {
+			return errors.Wrap(err, "unable to load client certificate configuration")
+		}
+
+		httpServer.TLSConfig = v.tlsConfig()
+	} else if *serverStartTLSClientCRLFile != "" {
+		return errors.New("--tls-client-crl-file requires --tls-client-ca-file")
+	}
+
 	// generate and save to PEM files
 	if *serverStartTLSGenerateCert && *serverStartTLSCertFile != "" && *serverStartTLSKeyFile != "" {
 		if _, err := os.Stat(*serverStartTLSCertFile); err == nil {
@@ -170,12 +185,14 @@ func startServerWithOptionalTLSAndListener(ctx context.Context, httpServer *http
 			return errors.Wrap(err, "unable to generate server cert")
 		}
 
-		httpServer.TLSConfig = &tls.Config{
-			Certificates: []tls.Certificate{
-				{
-					Certificate: [][]byte{cert.Raw},
-					PrivateKey:  key,
-				},
+		if httpServer.TLSConfig == nil {
+			httpServer.TLSConfig = &tls.Config{}
+		}
+
+		httpServer.TLSConfig.Certificates = []tls.Certificate{
+			{
+				Certificate: [][]byte{cert.Raw},
+				PrivateKey:  key,
 			},
 		}
 
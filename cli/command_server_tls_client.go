@@ -0,0 +1,240 @@
+package cli
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	serverStartTLSClientCAFile  = serverStartCommand.Flag("tls-client-ca-file", "Require TLS client certificates signed by one of the CAs in the provided PEM file").ExistingFile()
+	serverStartTLSClientCRLFile = serverStartCommand.Flag("tls-client-crl-file", "Reject TLS client certificates revoked by the provided CRL (PEM or DER)").ExistingFile()
+)
+
+// clientCertVerifier verifies TLS client certificates against the CA and CRL files, reloading them
+// whenever they change, so that CAs can be rotated and certificates revoked without restarting the server.
+type clientCertVerifier struct {
+	ctx     context.Context // used for logging
+	caFile  string
+	crlFile string
+	timeNow func() time.Time
+
+	mu         sync.Mutex
+	caModTime  time.Time
+	crlModTime time.Time
+	cas        []*x509.Certificate
+	roots      *x509.CertPool
+	revoked    map[string]bool // serial numbers of revoked certificates
+}
+
+func (v *clientCertVerifier) tlsConfig() *tls.Config {
+	return &tls.Config{
+		// chain is verified by VerifyPeerCertificate against the most recent CAs, not the ones loaded at startup.
+		ClientAuth:            tls.RequireAnyClientCert,
+		VerifyPeerCertificate: v.verifyPeerCertificate,
+	}
+}
+
+// reloadIfChangedLocked reloads CA and CRL files if their modification times have changed since they were loaded.
+// Must be called with v.mu held.
+func (v *clientCertVerifier) reloadIfChangedLocked() error {
+	st, err := os.Stat(v.caFile)
+	if err != nil {
+		return errors.Wrap(err, "unable to stat client CA file")
+	}
+
+	caChanged := !st.ModTime().Equal(v.caModTime)
+
+	if caChanged {
+		cas, err := loadCertificates(v.caFile)
+		if err != nil {
+			return err
+		}
+
+		roots := x509.NewCertPool()
+		for _, c := range cas {
+			roots.AddCert(c)
+		}
+
+		v.cas = cas
+		v.roots = roots
+		v.caModTime = st.ModTime()
+	}
+
+	if v.crlFile == "" {
+		return nil
+	}
+
+	st, err = os.Stat(v.crlFile)
+	if err != nil {
+		return errors.Wrap(err, "unable to stat client CRL file")
+	}
+
+	// CRL must be re-checked against new CAs even if it did not change.
+	if !caChanged && st.ModTime().Equal(v.crlModTime) {
+		return nil
+	}
+
+	revoked, err := loadRevokedSerialNumbers(v.ctx, v.crlFile, v.cas, v.timeNow())
+	if err != nil {
+		// retry next time even if the file does not change.
+		v.crlModTime = time.Time{}
+		return err
+	}
+
+	v.revoked = revoked
+	v.crlModTime = st.ModTime()
+
+	return nil
+}
+
+func (v *clientCertVerifier) verifyPeerCertificate(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+	v.mu.Lock()
+	err := v.reloadIfChangedLocked()
+	roots, revoked := v.roots, v.revoked
+	v.mu.Unlock()
+
+	if err != nil {
+		// keep using last known good CA and CRL
+		log(v.ctx).Warningf("unable to reload client certificate configuration: %v", err)
+	}
+
+	if roots == nil {
+		return errors.New("client CA not loaded")
+	}
+
+	if len(rawCerts) == 0 {
+		return errors.New("no client certificate")
+	}
+
+	var certs []*x509.Certificate
+
+	for _, raw := range rawCerts {
+		c, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return errors.Wrap(err, "invalid client certificate")
+		}
+
+		if revoked[c.SerialNumber.String()] {
+			return errors.Errorf("client certificate %v has been revoked", c.SerialNumber)
+		}
+
+		certs = append(certs, c)
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, c := range certs[1:] {
+		intermediates.AddCert(c)
+	}
+
+	if _, err := certs[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   v.timeNow(),
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}); err != nil {
+		return errors.Wrap(err, "invalid client certificate")
+	}
+
+	return nil
+}
+
+func loadCertificates(fname string) ([]*x509.Certificate, error) {
+	data, err := ioutil.ReadFile(fname) //nolint:gosec
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read certificates")
+	}
+
+	var certs []*x509.Certificate
+
+	for {
+		var b *pem.Block
+
+		b, data = pem.Decode(data)
+		if b == nil {
+			break
+		}
+
+		if b.Type != "CERTIFICATE" {
+			continue
+		}
+
+		c, err := x509.ParseCertificate(b.Bytes)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid certificate in %v", fname)
+		}
+
+		certs = append(certs, c)
+	}
+
+	if len(certs) == 0 {
+		return nil, errors.Errorf("no certificates found in %v", fname)
+	}
+
+	return certs, nil
+}
+
+// loadRevokedSerialNumbers parses the CRL, verifies that it's signed by one of the provided CAs
+// and returns the set of revoked serial numbers.
+func loadRevokedSerialNumbers(ctx context.Context, fname string, cas []*x509.Certificate, now time.Time) (map[string]bool, error) {
+	data, err := ioutil.ReadFile(fname) //nolint:gosec
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read CRL")
+	}
+
+	crl, err := x509.ParseCRL(data) //nolint:staticcheck
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid CRL in %v", fname)
+	}
+
+	if !crlSignedByAny(crl, cas) {
+		return nil, errors.Errorf("CRL in %v is not signed by any of the client CAs", fname)
+	}
+
+	if crl.HasExpired(now) {
+		log(ctx).Warningf("client CRL in %v has expired, certificates revoked since then will not be rejected", fname)
+	}
+
+	revoked := map[string]bool{}
+	for _, rc := range crl.TBSCertList.RevokedCertificates {
+		revoked[rc.SerialNumber.String()] = true
+	}
+
+	return revoked, nil
+}
+
+func crlSignedByAny(crl *pkix.CertificateList, cas []*x509.Certificate) bool {
+	for _, ca := range cas {
+		if ca.CheckCRLSignature(crl) == nil { //nolint:staticcheck
+			return true
+		}
+	}
+
+	return false
+}
+
+func newClientCertVerifier(ctx context.Context, caFile, crlFile string) (*clientCertVerifier, error) {
+	v := &clientCertVerifier{
+		ctx:     ctx,
+		caFile:  caFile,
+		crlFile: crlFile,
+		timeNow: time.Now,
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if err := v.reloadIfChangedLocked(); err != nil {
+		return nil, err
+	}
+
+	return v, nil
+}
@@ -0,0 +1,166 @@
+package cli
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kopia/kopia/internal/testlogging"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T, name string) *testCA {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &testCA{cert, key}
+}
+
+func (ca *testCA) issueClientCert(t *testing.T, serial int64) []byte {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, key.Public(), ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return der
+}
+
+func (ca *testCA) writeCRL(t *testing.T, fname string, revokedSerials ...int64) {
+	t.Helper()
+
+	var revoked []pkix.RevokedCertificate
+	for _, s := range revokedSerials {
+		revoked = append(revoked, pkix.RevokedCertificate{SerialNumber: big.NewInt(s), RevocationTime: time.Now()})
+	}
+
+	der, err := ca.cert.CreateCRL(rand.Reader, ca.key, revoked, time.Now(), time.Now().Add(time.Hour)) //nolint:staticcheck
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeTestFile(t, fname, pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: der}))
+}
+
+// writeTestFile writes the file ensuring its modification time changes.
+func writeTestFile(t *testing.T, fname string, data []byte) {
+	t.Helper()
+
+	if err := ioutil.WriteFile(fname, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	mtime := time.Now().Add(time.Duration(len(data)) * time.Second)
+	if err := os.Chtimes(fname, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClientCertVerifier(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	td, err := ioutil.TempDir("", "client-cert")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(td)
+
+	caFile := filepath.Join(td, "ca.pem")
+	crlFile := filepath.Join(td, "crl.pem")
+
+	ca1 := newTestCA(t, "ca1")
+	ca2 := newTestCA(t, "ca2")
+
+	writeTestFile(t, caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca1.cert.Raw}))
+	ca1.writeCRL(t, crlFile)
+
+	v, err := newClientCertVerifier(ctx, caFile, crlFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	good := ca1.issueClientCert(t, 100)
+	revoked := ca1.issueClientCert(t, 101)
+	fromCA2 := ca2.issueClientCert(t, 200)
+
+	verify := func(desc string, cert []byte, wantOK bool) {
+		t.Helper()
+
+		if err := v.verifyPeerCertificate([][]byte{cert}, nil); (err == nil) != wantOK {
+			t.Errorf("unexpected verification result for %v: %v", desc, err)
+		}
+	}
+
+	verify("good", good, true)
+	verify("to be revoked", revoked, true)
+	verify("from other CA", fromCA2, false)
+
+	// revoke certificate, verifier picks up the new CRL.
+	ca1.writeCRL(t, crlFile, 101)
+
+	verify("good", good, true)
+	verify("revoked", revoked, false)
+
+	// CRL signed by an unknown CA is rejected and the last good one keeps being used.
+	ca2.writeCRL(t, crlFile)
+	verify("revoked", revoked, false)
+
+	// rotate CA.
+	writeTestFile(t, caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca2.cert.Raw}))
+
+	verify("from old CA", good, false)
+	verify("from new CA", fromCA2, true)
+}
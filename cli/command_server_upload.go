@@ -3,12 +3,20 @@ package cli
 import (
 	"context"
 	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/pkg/errors"
 
 	"github.com/kopia/kopia/internal/serverapi"
+	"github.com/kopia/kopia/snapshot"
 )
 
 var (
-	serverStartUploadCommand = serverCommands.Command("upload", "Trigger upload for one or more sources")
+	serverStartUploadCommand      = serverCommands.Command("upload", "Trigger upload for one or more sources")
+	serverStartUploadSource       = serverStartUploadCommand.Flag("source", "Only upload the provided source (local path or user@host:/path)").String()
+	serverStartUploadWait         = serverStartUploadCommand.Flag("wait", "Wait for uploads to complete and fail if any of them fails").Bool()
+	serverStartUploadPollInterval = serverStartUploadCommand.Flag("poll-interval", "How frequently to poll for upload status when waiting").Default("1s").Hidden().Duration()
 )
 
 func init() {
@@ -16,16 +24,105 @@ func init() {
 }
 
 func runServerStartUpload(ctx context.Context, cli *serverapi.Client) error {
-	return triggerActionOnMatchingSources(ctx, cli, "sources/upload")
-}
+	path := "sources/upload"
+
+	if *serverStartUploadSource != "" {
+		var sources serverapi.SourcesResponse
+		if err := cli.Get(ctx, "sources", &sources); err != nil {
+			return err
+		}
+
+		si, err := snapshot.ParseSourceInfo(*serverStartUploadSource, sources.LocalHost, sources.LocalUsername)
+		if err != nil {
+			return errors.Wrap(err, "invalid source")
+		}
+
+		path += "?" + sourceQuery(si).Encode()
+	}
 
-func triggerActionOnMatchingSources(ctx context.Context, cli *serverapi.Client, path string) error {
 	var resp serverapi.MultipleSourceActionResponse
 
 	if err := cli.Post(ctx, path, &serverapi.Empty{}, &resp); err != nil {
 		return err
 	}
 
+	if len(resp.Sources) == 0 {
+		return errors.New("no matching sources")
+	}
+
+	printSourceActionResults(resp)
+
+	if !*serverStartUploadWait {
+		return nil
+	}
+
+	failed := 0
+
+	for src, r := range resp.Sources {
+		if !r.Success {
+			failed++
+			continue
+		}
+
+		st, err := waitForSnapshotRun(ctx, cli, src, r.Run)
+		if err != nil {
+			return err
+		}
+
+		if st.State != serverapi.SnapshotRunSucceeded {
+			printStderr("%v %v: %v\n", st.State, src, st.Error)
+			failed++
+
+			continue
+		}
+
+		printStderr("%v %v: created snapshot %v\n", st.State, src, st.SnapshotID)
+	}
+
+	if failed > 0 {
+		return errors.Errorf("%v uploads failed", failed)
+	}
+
+	return nil
+}
+
+// waitForSnapshotRun polls the server until the given snapshot run of a source finishes.
+func waitForSnapshotRun(ctx context.Context, cli *serverapi.Client, src string, run int64) (*serverapi.SnapshotRunStatus, error) {
+	si, err := snapshot.ParseSourceInfo(src, "", "")
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid source returned by server")
+	}
+
+	q := sourceQuery(si)
+	q.Set("run", fmt.Sprintf("%v", run))
+
+	for {
+		var st serverapi.SnapshotRunStatus
+
+		if err := cli.Get(ctx, "sources/run?"+q.Encode(), &st); err != nil {
+			return nil, err
+		}
+
+		switch st.State {
+		case serverapi.SnapshotRunQueued, serverapi.SnapshotRunRunning:
+			time.Sleep(*serverStartUploadPollInterval)
+
+		default:
+			return &st, nil
+		}
+	}
+}
+
+func sourceQuery(si snapshot.SourceInfo) url.Values {
+	q := url.Values{}
+	q.Set("userName", si.UserName)
+	q.Set("host", si.Host)
+	q.Set("path", si.Path)
+
+	return q
+}
+
+func printSourceActionResults(resp serverapi.MultipleSourceActionResponse) {
 	for src, resp := range resp.Sources {
 		if resp.Success {
 			fmt.Println("SUCCESS", src)
@@ -33,6 +130,4 @@ func triggerActionOnMatchingSources(ctx context.Context, cli *serverapi.Client,
 			fmt.Println("FAILED", src)
 		}
 	}
-
-	return nil
 }
@@ -0,0 +1,133 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/ospath"
+	"github.com/kopia/kopia/internal/osservice"
+)
+
+var (
+	serviceCommands = app.Command("service", "Commands to run the daemon as a service managed by the operating system (systemd, launchd or Windows Task Scheduler).")
+	serviceName     = serviceCommands.Flag("name", "Name of the service").Default("kopia").String()
+	serviceSystem   = serviceCommands.Flag("system", "Install the service for the whole machine instead of the current user (requires administrative privileges)").Bool()
+
+	serviceInstallCommand = serviceCommands.Command("install", "Install the daemon as a service and start it")
+	serviceInstallUser    = serviceInstallCommand.Flag("user", "User account the system service runs as").String()
+	serviceInstallEnv     = serviceInstallCommand.Flag("env", "Environment variable of the service (KEY=VALUE)").Strings()
+	serviceInstallLogDir  = serviceInstallCommand.Flag("service-log-dir", "Directory where the service output and logs are written").Default(ospath.LogsDir()).String()
+	serviceInstallDryRun  = serviceInstallCommand.Flag("dry-run", "Print the service definition without installing it").Bool()
+
+	serviceUninstallCommand = serviceCommands.Command("uninstall", "Stop the service and uninstall it")
+	serviceStatusCommand    = serviceCommands.Command("status", "Show status of the service")
+)
+
+func init() {
+	serviceInstallCommand.Action(noRepositoryAction(runServiceInstall))
+	serviceUninstallCommand.Action(noRepositoryAction(runServiceUninstall))
+	serviceStatusCommand.Action(noRepositoryAction(runServiceStatus))
+}
+
+func serviceConfig() *osservice.Config {
+	return &osservice.Config{
+		Name:        *serviceName,
+		Description: "Kopia daemon which keeps the repository connected and snapshots scheduled",
+		System:      *serviceSystem,
+	}
+}
+
+func runServiceInstall(ctx context.Context) error {
+	if *serviceInstallUser != "" && !*serviceSystem {
+		return errors.New("--user can only be used with --system")
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return errors.Wrap(err, "unable to determine kopia executable")
+	}
+
+	configFile, err := filepath.Abs(repositoryConfigFileName())
+	if err != nil {
+		return errors.Wrap(err, "unable to determine config file")
+	}
+
+	if _, err = os.Stat(configFile); err != nil {
+		return errors.Wrapf(err, "repository is not connected using %v", configFile)
+	}
+
+	logDir, err := filepath.Abs(*serviceInstallLogDir)
+	if err != nil {
+		return errors.Wrap(err, "unable to determine log directory")
+	}
+
+	cfg := serviceConfig()
+	cfg.Executable = exe
+	cfg.UserName = *serviceInstallUser
+	cfg.LogDir = logDir
+	cfg.Args = []string{
+		"--config-file=" + configFile,
+		"--log-dir=" + logDir,
+		"daemon", "start",
+	}
+	cfg.Env = map[string]string{
+		checkForUpdatesEnvar: "false",
+	}
+
+	for _, kv := range *serviceInstallEnv {
+		p := strings.Index(kv, "=")
+		if p <= 0 {
+			return errors.Errorf("invalid environment variable %q, must be KEY=VALUE", kv)
+		}
+
+		cfg.Env[kv[0:p]] = kv[p+1:]
+	}
+
+	if *serviceInstallDryRun {
+		f, def, err := osservice.Definition(cfg)
+		if err != nil {
+			return err
+		}
+
+		printStderr("Service definition %v:\n", f)
+		fmt.Print(string(def))
+
+		return nil
+	}
+
+	if err := osservice.Install(ctx, cfg); err != nil {
+		return errors.Wrap(err, "unable to install service")
+	}
+
+	printStderr("Installed and started service %v.\n", cfg.Name)
+
+	return nil
+}
+
+func runServiceUninstall(ctx context.Context) error {
+	cfg := serviceConfig()
+
+	if err := osservice.Uninstall(ctx, cfg); err != nil {
+		return errors.Wrap(err, "unable to uninstall service")
+	}
+
+	printStderr("Uninstalled service %v.\n", cfg.Name)
+
+	return nil
+}
+
+func runServiceStatus(ctx context.Context) error {
+	status, err := osservice.Status(ctx, serviceConfig())
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(status)
+
+	return nil
+}
@@ -2,15 +2,22 @@ package cli
 
 import (
 	"context"
-	"os"
+	"fmt"
+	"io"
 
-	"github.com/kopia/kopia/internal/iocopy"
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/units"
 	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/object"
 )
 
 var (
-	catCommand     = app.Command("show", "Displays contents of a repository object.").Alias("cat")
-	catCommandPath = catCommand.Arg("object-path", "Path").Required().String()
+	catCommand       = app.Command("show", "Displays contents of a repository object.").Alias("cat")
+	catCommandPath   = catCommand.Arg("object-path", "Path").Required().String()
+	catCommandLayout = catCommand.Flag("layout", "Show the chunks, indirection levels and pack blobs backing the object instead of its contents").Bool()
+	catCommandOffset = catCommand.Flag("offset", "Offset of the first byte to show").Default("0").Int64()
+	catCommandLength = catCommand.Flag("length", "Number of bytes to show (-1 shows all bytes until the end of the object)").Default("-1").Int64()
 )
 
 func runCatCommand(ctx context.Context, rep *repo.Repository) error {
@@ -19,6 +26,10 @@ func runCatCommand(ctx context.Context, rep *repo.Repository) error {
 		return err
 	}
 
+	if *catCommandLayout {
+		return showObjectLayout(ctx, rep, oid)
+	}
+
 	r, err := rep.Objects.Open(ctx, oid)
 	if err != nil {
 		return err
@@ -26,11 +37,76 @@ func runCatCommand(ctx context.Context, rep *repo.Repository) error {
 
 	defer r.Close() //nolint:errcheck
 
-	_, err = iocopy.Copy(os.Stdout, r)
+	rd, err := objectRange(r, *catCommandOffset, *catCommandLength)
+	if err != nil {
+		return err
+	}
+
+	return showContent(rd)
+}
+
+// objectRange returns the reader of the range of the object starting at the provided offset, seeking
+// directly to the chunk containing it, optionally limited to the provided number of bytes.
+func objectRange(r object.Reader, offset, length int64) (io.Reader, error) {
+	if offset < 0 || offset > r.Length() {
+		return nil, errors.Errorf("invalid offset %v, object length is %v", offset, r.Length())
+	}
+
+	if offset > 0 {
+		if _, err := r.Seek(offset, io.SeekStart); err != nil {
+			return nil, errors.Wrap(err, "unable to seek")
+		}
+	}
+
+	if length < 0 {
+		return r, nil
+	}
+
+	return io.LimitReader(r, length), nil
+}
+
+func showObjectLayout(ctx context.Context, rep *repo.Repository, oid object.ID) error {
+	l, err := rep.Objects.GetLayout(ctx, oid)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Object:             %v\n", l.ObjectID)
+	fmt.Printf("Length:             %v (%v)\n", l.Length(), units.BytesStringBase10(l.Length()))
+	fmt.Printf("Indirection levels: %v\n", l.IndirectionLevels)
+
+	if len(l.IndexChunks) > 0 {
+		fmt.Printf("\nIndex chunks:\n")
+		printLayoutChunks(l.IndexChunks)
+	}
 
-	return err
+	fmt.Printf("\nChunks:\n")
+	printLayoutChunks(l.Chunks)
+
+	return nil
+}
+
+func printLayoutChunks(chunks []object.ChunkInfo) {
+	fmt.Printf("%12v %10v %5v %-40v %-40v %10v %10v\n", "START", "LENGTH", "LEVEL", "CONTENT ID", "PACK", "OFFSET", "PACKED")
+
+	for _, c := range chunks {
+		deleted := ""
+		if c.Content.Deleted {
+			deleted = " (deleted)"
+		}
+
+		compressed := ""
+		if c.Compressed {
+			compressed = " (compressed)"
+		}
+
+		fmt.Printf("%12v %10v %5v %-40v %-40v %10v %10v%v%v\n",
+			c.Start, c.Length, c.Level, c.Content.ID, c.Content.PackBlobID, c.Content.PackOffset, c.Content.Length, compressed, deleted)
+	}
 }
 
 func init() {
+	catCommand.GetArg("object-path").HintAction(completeSnapshotRoots)
+	setupShowCommand(catCommand)
 	catCommand.Action(repositoryAction(runCatCommand))
 }
@@ -0,0 +1,77 @@
+package cli
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+
+	"github.com/kopia/kopia/internal/repotesting"
+	"github.com/kopia/kopia/internal/testlogging"
+	"github.com/kopia/kopia/repo/object"
+)
+
+func TestObjectRange(t *testing.T) {
+	var env repotesting.Environment
+
+	ctx := testlogging.Context(t)
+	defer env.Setup(t).Close(ctx, t)
+
+	data := make([]byte, 3000000)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	w := env.Repository.Objects.NewWriter(ctx, object.WriterOptions{})
+	if _, err := w.Write(data); err != nil {
+		t.Fatalf("write error: %v", err)
+	}
+
+	oid, err := w.Result()
+	if err != nil {
+		t.Fatalf("unable to write object: %v", err)
+	}
+
+	cases := []struct {
+		offset, length int64
+		want           []byte
+	}{
+		{0, -1, data},
+		{1000, 10, data[1000:1010]},
+		{2500000, -1, data[2500000:]},
+		{2999990, 100, data[2999990:]},
+		{3000000, -1, nil},
+	}
+
+	for _, tc := range cases {
+		r, err := env.Repository.Objects.Open(ctx, oid)
+		if err != nil {
+			t.Fatalf("unable to open object: %v", err)
+		}
+
+		rd, err := objectRange(r, tc.offset, tc.length)
+		if err != nil {
+			t.Fatalf("unable to get range %v+%v: %v", tc.offset, tc.length, err)
+		}
+
+		got, err := ioutil.ReadAll(rd)
+		if err != nil {
+			t.Fatalf("read error: %v", err)
+		}
+
+		if !bytes.Equal(got, tc.want) {
+			t.Errorf("unexpected contents of range %v+%v: %v bytes, want %v", tc.offset, tc.length, len(got), len(tc.want))
+		}
+
+		r.Close() //nolint:errcheck
+	}
+
+	r, err := env.Repository.Objects.Open(ctx, oid)
+	if err != nil {
+		t.Fatalf("unable to open object: %v", err)
+	}
+
+	defer r.Close() //nolint:errcheck
+
+	if _, err := objectRange(r, 3000001, -1); err == nil {
+		t.Errorf("expected error for offset past the end of the object")
+	}
+}
@@ -0,0 +1,106 @@
+package cli
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/manifest"
+	"github.com/kopia/kopia/snapshot"
+)
+
+var (
+	snapshotAnnotateCommand           = snapshotCommands.Command("annotate", "Attach notes and annotations to existing snapshots, such as 'pre-upgrade state' or ticket IDs.")
+	snapshotAnnotateIDs               = snapshotAnnotateCommand.Arg("id", "IDs of snapshots to annotate").Required().Strings()
+	snapshotAnnotateNotes             = snapshotAnnotateCommand.Flag("note", "Add a free-text note").Strings()
+	snapshotAnnotateClearNotes        = snapshotAnnotateCommand.Flag("clear-notes", "Remove all notes").Bool()
+	snapshotAnnotateAddAnnotations    = snapshotAnnotateCommand.Flag("annotation", "Set an annotation").PlaceHolder("KEY=VALUE").Strings()
+	snapshotAnnotateRemoveAnnotations = snapshotAnnotateCommand.Flag("remove-annotation", "Remove an annotation").PlaceHolder("KEY").Strings()
+)
+
+func init() {
+	snapshotAnnotateCommand.GetArg("id").HintAction(completeSnapshotIDs)
+	snapshotAnnotateCommand.Action(repositoryAction(runSnapshotAnnotateCommand))
+}
+
+func runSnapshotAnnotateCommand(ctx context.Context, rep *repo.Repository) error {
+	annotations, err := parseAnnotations(*snapshotAnnotateAddAnnotations)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range *snapshotAnnotateIDs {
+		md, err := rep.Manifests.GetMetadata(ctx, manifest.ID(id))
+		if err != nil {
+			return errors.Wrapf(err, "unable to find snapshot %v", id)
+		}
+
+		if md.Labels[manifest.TypeLabelKey] != snapshot.ManifestType {
+			return errors.Errorf("%v is not a snapshot", id)
+		}
+
+		man, err := snapshot.LoadSnapshot(ctx, rep, md.ID)
+		if err != nil {
+			return err
+		}
+
+		annotateSnapshot(man, rep.Username+"@"+rep.Hostname, annotations)
+
+		newID, err := snapshot.UpdateSnapshot(ctx, rep, man)
+		if err != nil {
+			return errors.Wrapf(err, "unable to update snapshot %v", id)
+		}
+
+		printStderr("Annotated snapshot of %v at %v, its ID changed from %v to %v.\n", man.Source, formatTimestamp(man.StartTime), id, newID)
+	}
+
+	return nil
+}
+
+func annotateSnapshot(man *snapshot.Manifest, author string, annotations map[string]string) {
+	if *snapshotAnnotateClearNotes {
+		man.Notes = nil
+	}
+
+	for _, text := range *snapshotAnnotateNotes {
+		man.Notes = append(man.Notes, &snapshot.Note{
+			Time:   time.Now(),
+			Author: author,
+			Text:   text,
+		})
+	}
+
+	for k, v := range annotations {
+		if man.Annotations == nil {
+			man.Annotations = map[string]string{}
+		}
+
+		man.Annotations[k] = v
+	}
+
+	for _, k := range *snapshotAnnotateRemoveAnnotations {
+		delete(man.Annotations, k)
+	}
+
+	if len(man.Annotations) == 0 {
+		man.Annotations = nil
+	}
+}
+
+func parseAnnotations(values []string) (map[string]string, error) {
+	result := map[string]string{}
+
+	for _, v := range values {
+		parts := strings.SplitN(v, "=", 2) //nolint:gomnd
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, errors.Errorf("invalid annotation %q, must be KEY=VALUE", v)
+		}
+
+		result[parts[0]] = parts[1]
+	}
+
+	return result, nil
+}
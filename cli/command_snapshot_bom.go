@@ -0,0 +1,131 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/manifest"
+	"github.com/kopia/kopia/snapshot"
+	"github.com/kopia/kopia/snapshot/bom"
+	"github.com/kopia/kopia/snapshot/snapshotfs"
+)
+
+var (
+	bomCommands = snapshotCommands.Command("bom", "Commands to export and verify bills of materials of snapshots - lists of all files with their sizes and SHA-256 hashes.")
+
+	bomExportCommand    = bomCommands.Command("export", "Export the bill of materials of a snapshot, to be stored independently of the repository.")
+	bomExportSnapshotID = bomExportCommand.Arg("id", "Snapshot ID").Required().String()
+	bomExportOutput     = bomExportCommand.Flag("output", "File to write the bill of materials to instead of standard output").Short('o').String()
+	bomExportSigningKey = bomExportCommand.Flag("signing-key", "Sign the bill of materials with the private key from the provided file").Envar("KOPIA_SIGNING_KEY").ExistingFile()
+
+	bomVerifyCommand     = bomCommands.Command("verify", "Verify files in a directory, such as the target of a restore, against a bill of materials.")
+	bomVerifyFile        = bomVerifyCommand.Arg("bom", "File containing the bill of materials").Required().ExistingFile()
+	bomVerifyDirectory   = bomVerifyCommand.Arg("directory", "Directory to verify").Required().ExistingDir()
+	bomVerifyTrustedKeys = bomVerifyCommand.Flag("trusted-key", "Public key trusted to sign bills of materials (can be repeated)").Strings()
+)
+
+func init() {
+	bomExportCommand.GetArg("id").HintAction(completeSnapshotIDs)
+	bomExportCommand.Action(repositoryAction(runBOMExportCommand))
+	bomVerifyCommand.Action(noRepositoryAction(runBOMVerifyCommand))
+}
+
+func runBOMExportCommand(ctx context.Context, rep *repo.Repository) error {
+	if err := loadSnapshotSigningKey(*bomExportSigningKey); err != nil {
+		return err
+	}
+
+	man, err := snapshot.LoadSnapshot(ctx, rep, manifest.ID(*bomExportSnapshotID))
+	if err != nil {
+		return err
+	}
+
+	root, err := snapshotfs.SnapshotRoot(rep, man)
+	if err != nil {
+		return err
+	}
+
+	b, err := bom.Build(ctx, man, root)
+	if err != nil {
+		return errors.Wrap(err, "unable to build bill of materials")
+	}
+
+	if snapshotSigningKey != nil {
+		if err := b.Sign(snapshotSigningKey); err != nil {
+			return err
+		}
+	}
+
+	var w io.Writer = os.Stdout
+
+	if *bomExportOutput != "" {
+		f, err := os.Create(*bomExportOutput)
+		if err != nil {
+			return errors.Wrap(err, "unable to create output file")
+		}
+		defer f.Close() //nolint:errcheck
+
+		w = f
+	}
+
+	e := json.NewEncoder(w)
+	e.SetIndent("", "  ")
+
+	if err := e.Encode(b); err != nil {
+		return errors.Wrap(err, "unable to write bill of materials")
+	}
+
+	printStderr("Exported bill of materials of %v files of snapshot %v of %v.\n", len(b.Files), man.ID, man.Source)
+
+	return nil
+}
+
+func runBOMVerifyCommand(ctx context.Context) error {
+	data, err := ioutil.ReadFile(*bomVerifyFile) //nolint:gosec
+	if err != nil {
+		return errors.Wrap(err, "unable to read bill of materials")
+	}
+
+	b := &bom.BOM{}
+	if err := json.Unmarshal(data, b); err != nil {
+		return errors.Wrap(err, "unable to parse bill of materials")
+	}
+
+	if len(*bomVerifyTrustedKeys) > 0 {
+		trusted, err := parseTrustedKeys(*bomVerifyTrustedKeys)
+		if err != nil {
+			return err
+		}
+
+		if err := b.VerifySignature(trusted); err != nil {
+			return errors.Wrap(err, "unable to verify bill of materials")
+		}
+
+		printStderr("Bill of materials is signed by %v.\n", snapshot.FormatPublicKey(b.Signature.PublicKey))
+	} else {
+		log(ctx).Warningf("signature of the bill of materials is not verified, use --trusted-key")
+	}
+
+	diffs, err := b.VerifyDirectory(*bomVerifyDirectory)
+	if err != nil {
+		return err
+	}
+
+	for _, d := range diffs {
+		printStdout("%-10v %v\n", d.Kind, d.Path)
+	}
+
+	if len(diffs) > 0 {
+		return errors.Errorf("%v differences from the bill of materials of snapshot %v of %v", len(diffs), b.SnapshotID, b.Source)
+	}
+
+	printStderr("All %v files match the bill of materials of snapshot %v of %v.\n", len(b.Files), b.SnapshotID, b.Source)
+
+	return nil
+}
@@ -2,13 +2,23 @@ package cli
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"path/filepath"
+	"runtime"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/pkg/errors"
 
+	"github.com/kopia/kopia/fs"
+	"github.com/kopia/kopia/internal/apfs"
+	"github.com/kopia/kopia/internal/fssnapshot"
+	"github.com/kopia/kopia/internal/serverapi"
+	"github.com/kopia/kopia/internal/units"
 	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/lock"
 	"github.com/kopia/kopia/snapshot"
 	"github.com/kopia/kopia/snapshot/policy"
 	"github.com/kopia/kopia/snapshot/snapshotfs"
@@ -28,10 +38,21 @@ var (
 	snapshotCreateDescription             = snapshotCreateCommand.Flag("description", "Free-form snapshot description.").String()
 	snapshotCreateForceHash               = snapshotCreateCommand.Flag("force-hash", "Force hashing of source files for a given percentage of files [0..100]").Default("0").Int()
 	snapshotCreateParallelUploads         = snapshotCreateCommand.Flag("parallel", "Upload N files in parallel").PlaceHolder("N").Default("0").Int()
-	snapshotCreateHostname                = snapshotCreateCommand.Flag("hostname", "Override local hostname.").String()
-	snapshotCreateUsername                = snapshotCreateCommand.Flag("username", "Override local username.").String()
+	snapshotCreateParallelSources         = snapshotCreateCommand.Flag("parallel-sources", "Snapshot N sources in parallel, splitting --parallel between them").PlaceHolder("N").Default("1").Int()
+	snapshotCreateHostname                = snapshotCreateCommand.Flag("override-hostname", "Override hostname the snapshots are attributed to.").Envar(overrideHostnameEnvar).String()
+	snapshotCreateUsername                = snapshotCreateCommand.Flag("override-username", "Override username the snapshots are attributed to.").Envar(overrideUsernameEnvar).String()
+	snapshotCreateHostnameCompat          = snapshotCreateCommand.Flag("hostname", "Override local hostname.").Hidden().String()
+	snapshotCreateUsernameCompat          = snapshotCreateCommand.Flag("username", "Override local username.").Hidden().String()
 	snapshotCreateStartTime               = snapshotCreateCommand.Flag("start-time", "Override snapshot start timestamp.").String()
 	snapshotCreateEndTime                 = snapshotCreateCommand.Flag("end-time", "Override snapshot end timestamp.").String()
+	snapshotCreateFlushEvery              = snapshotCreateCommand.Flag("flush-every", "Flush snapshot manifests and indexes after every N sources, 0 to flush once after all sources").Default("1").Int()
+	snapshotCreateDryRun                  = snapshotCreateCommand.Flag("dry-run", "Report what would be uploaded without writing anything to the repository").Bool()
+	snapshotCreateSigningKey              = snapshotCreateCommand.Flag("signing-key", "Sign snapshots with the private key from the provided file").Envar("KOPIA_SIGNING_KEY").ExistingFile()
+	snapshotCreateAcceptAnomaly           = snapshotCreateCommand.Flag("accept-anomaly", "Save suspicious snapshots even if the anomaly or canary policy says to fail").Bool()
+	snapshotCreateNotifySuspicious        = snapshotCreateCommand.Flag("notify-suspicious", "Command to run when a snapshot shows anomalous changes or modified canary files").PlaceHolder("COMMAND").String()
+	snapshotCreateDeterministic           = snapshotCreateCommand.Flag("deterministic", "Produce identical object IDs for identical trees by recording fixed timestamps, no ownership and rehashing all files").Bool()
+	snapshotCreateAPFSSnapshot            = snapshotCreateCommand.Flag("apfs-snapshot", "Back up from a temporary APFS local snapshot for a consistent view of files modified during the snapshot (macOS only, requires root or Full Disk Access)").Bool()
+	snapshotCreateSourceAlias             = snapshotCreateCommand.Flag("source-alias", "Snapshot a staging location (such as a VSS or LVM snapshot mount) as the provided source, sharing its history and policies").PlaceHolder("[USER@HOST:]PATH").String()
 )
 
 func runBackupCommand(ctx context.Context, rep *repo.Repository) error {
@@ -50,13 +71,16 @@ func runBackupCommand(ctx context.Context, rep *repo.Repository) error {
 		return errors.New("no backup sources")
 	}
 
-	u := snapshotfs.NewUploader(rep)
-	u.MaxUploadBytes = *snapshotCreateCheckpointUploadLimitMB << 20 //nolint:gomnd
-	u.ForceHashPercentage = *snapshotCreateForceHash
-	u.ParallelUploads = *snapshotCreateParallelUploads
-	onCtrlC(u.Cancel)
+	if !*snapshotCreateDryRun {
+		lockedCtx, release, err := lockRepository(ctx, rep, lock.Shared, "snapshot create")
+		if err != nil {
+			return err
+		}
 
-	u.Progress = progress
+		defer release()
+
+		ctx = lockedCtx
+	}
 
 	startTime, err := parseTimestamp(*snapshotCreateStartTime)
 	if err != nil {
@@ -76,14 +100,20 @@ func runBackupCommand(ctx context.Context, rep *repo.Repository) error {
 		return errors.New("description too long")
 	}
 
-	var finalErrors []string
+	if err := loadSnapshotSigningKey(*snapshotCreateSigningKey); err != nil {
+		return err
+	}
 
-	for _, snapshotDir := range sources {
-		if u.IsCancelled() {
-			printStderr("Upload canceled\n")
-			break
-		}
+	if *snapshotCreateSourceAlias != "" && (len(sources) != 1 || *snapshotCreateAll) {
+		return errors.New("--source-alias requires exactly one source")
+	}
+
+	var sourceInfos []snapshot.SourceInfo
 
+	// localPaths maps sources to the local paths being snapshotted, which differ from the source path for aliases.
+	localPaths := map[snapshot.SourceInfo]string{}
+
+	for _, snapshotDir := range sources {
 		dir, err := filepath.Abs(snapshotDir)
 		if err != nil {
 			return errors.Errorf("invalid source: '%s': %s", snapshotDir, err)
@@ -95,17 +125,41 @@ func runBackupCommand(ctx context.Context, rep *repo.Repository) error {
 			UserName: rep.Username,
 		}
 
-		if h := *snapshotCreateHostname; h != "" {
-			sourceInfo.Host = h
-		}
+		sourceInfo.Host = firstNonEmpty(*snapshotCreateHostname, *snapshotCreateHostnameCompat, sourceInfo.Host)
+		sourceInfo.UserName = firstNonEmpty(*snapshotCreateUsername, *snapshotCreateUsernameCompat, sourceInfo.UserName)
 
-		if u := *snapshotCreateUsername; u != "" {
-			sourceInfo.UserName = u
-		}
+		localPath := sourceInfo.Path
 
-		if err := snapshotSingleSource(ctx, rep, u, sourceInfo); err != nil {
-			finalErrors = append(finalErrors, err.Error())
+		if a := *snapshotCreateSourceAlias; a != "" {
+			sourceInfo, err = parseSourceAlias(a, sourceInfo)
+			if err != nil {
+				return err
+			}
 		}
+
+		sourceInfos = append(sourceInfos, sourceInfo)
+		localPaths[sourceInfo] = localPath
+	}
+
+	scheduleCtx, cancelSchedule := context.WithCancel(ctx)
+	defer cancelSchedule()
+
+	go bandwidth.run(scheduleCtx)
+
+	var finalErrors []string
+
+	if *snapshotCreateParallelSources > 1 && len(sourceInfos) > 1 {
+		finalErrors, err = snapshotSourcesInParallel(ctx, rep, sourceInfos, localPaths)
+	} else {
+		finalErrors, err = snapshotSourcesSequentially(ctx, rep, sourceInfos, localPaths)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if err := rep.Flush(ctx); err != nil {
+		return errors.Wrap(err, "flush error")
 	}
 
 	if len(finalErrors) == 0 {
@@ -115,6 +169,174 @@ func runBackupCommand(ctx context.Context, rep *repo.Repository) error {
 	return errors.Errorf("encountered %v errors:\n%v", len(finalErrors), strings.Join(finalErrors, "\n"))
 }
 
+func newBackupUploader(rep *repo.Repository, parallelUploads int) *snapshotfs.Uploader {
+	u := snapshotfs.NewUploader(rep)
+	u.MaxUploadBytes = *snapshotCreateCheckpointUploadLimitMB << 20 //nolint:gomnd
+	u.ForceHashPercentage = *snapshotCreateForceHash
+	u.ParallelUploads = parallelUploads
+	u.DryRun = *snapshotCreateDryRun
+	u.Deterministic = *snapshotCreateDeterministic
+	u.Progress = progress
+
+	return u
+}
+
+// maybeFlushAfterSource flushes the repository after every --flush-every completed sources.
+func maybeFlushAfterSource(ctx context.Context, rep *repo.Repository, completedCount int) error {
+	// batching flushes of many sources reduces the number of small manifest and index blobs.
+	if n := *snapshotCreateFlushEvery; n > 0 && completedCount%n == 0 {
+		if err := rep.Flush(ctx); err != nil {
+			return errors.Wrap(err, "flush error")
+		}
+
+		bandwidth.flushed()
+	}
+
+	return nil
+}
+
+func snapshotSourcesSequentially(ctx context.Context, rep *repo.Repository, sourceInfos []snapshot.SourceInfo, localPaths map[snapshot.SourceInfo]string) ([]string, error) {
+	var finalErrors []string
+
+	u := newBackupUploader(rep, *snapshotCreateParallelUploads)
+	onCtrlC(u.Cancel)
+
+	for i, sourceInfo := range sourceInfos {
+		if u.IsCancelled() {
+			printStderr("Upload canceled\n")
+			break
+		}
+
+		if err := snapshotSingleSource(ctx, rep, u, sourceInfo, localPaths[sourceInfo]); err != nil {
+			finalErrors = append(finalErrors, err.Error())
+		}
+
+		if err := maybeFlushAfterSource(ctx, rep, i+1); err != nil {
+			return nil, err
+		}
+	}
+
+	return finalErrors, nil
+}
+
+// snapshotSourcesInParallel snapshots multiple sources at the same time sharing the repository connection,
+// the --parallel budget of concurrent file uploads is split evenly across concurrently running sources.
+func snapshotSourcesInParallel(ctx context.Context, rep *repo.Repository, sourceInfos []snapshot.SourceInfo, localPaths map[snapshot.SourceInfo]string) ([]string, error) {
+	parallelSources := *snapshotCreateParallelSources
+	if parallelSources > len(sourceInfos) {
+		parallelSources = len(sourceInfos)
+	}
+
+	totalUploads := *snapshotCreateParallelUploads
+	if totalUploads == 0 {
+		totalUploads = runtime.NumCPU()
+	}
+
+	perSourceUploads := totalUploads / parallelSources
+	if perSourceUploads < 1 {
+		perSourceUploads = 1
+	}
+
+	semaphore := make(chan struct{}, parallelSources)
+
+	var (
+		wg              sync.WaitGroup
+		mu              sync.Mutex
+		canceled        bool
+		completed       int
+		finalErrors     []string
+		flushErr        error
+		activeUploaders = map[snapshot.SourceInfo]*snapshotfs.Uploader{}
+	)
+
+	progress.StartShared()
+
+	onCtrlC(func() {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if !canceled {
+			canceled = true
+			for s, u := range activeUploaders {
+				log(ctx).Warningf("canceling active uploader for %v", s)
+				u.Cancel()
+			}
+		}
+	})
+
+	for _, s := range sourceInfos {
+		// start a new uploader unless already canceled
+		mu.Lock()
+		if canceled || flushErr != nil {
+			mu.Unlock()
+			printStderr("Upload canceled\n")
+
+			break
+		}
+
+		u := newBackupUploader(rep, perSourceUploads)
+		activeUploaders[s] = u
+		mu.Unlock()
+
+		wg.Add(1)
+		semaphore <- struct{}{}
+
+		go func(s snapshot.SourceInfo) {
+			defer func() {
+				<-semaphore
+				wg.Done()
+			}()
+
+			err := snapshotSingleSource(ctx, rep, u, s, localPaths[s])
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			delete(activeUploaders, s)
+
+			if err != nil {
+				finalErrors = append(finalErrors, err.Error())
+			}
+
+			completed++
+
+			if ferr := maybeFlushAfterSource(ctx, rep, completed); ferr != nil && flushErr == nil {
+				flushErr = ferr
+			}
+		}(s)
+	}
+
+	wg.Wait()
+	progress.FinishShared()
+
+	return finalErrors, flushErr
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+
+	return ""
+}
+
+// parseSourceAlias parses the source the local path is snapshotted as, which may omit the user and host
+// to keep those of the local source.
+func parseSourceAlias(alias string, local snapshot.SourceInfo) (snapshot.SourceInfo, error) {
+	si, err := snapshot.ParseSourceInfo(alias, local.Host, local.UserName)
+	if err != nil {
+		return snapshot.SourceInfo{}, errors.Wrap(err, "invalid source alias")
+	}
+
+	if si.Path == "" {
+		return snapshot.SourceInfo{}, errors.Errorf("source alias %q must include a path", alias)
+	}
+
+	return si, nil
+}
+
 func parseTimestamp(timestamp string) (time.Time, error) {
 	if timestamp != "" {
 		parsedTimestamp, err := time.Parse(timeFormat, timestamp)
@@ -135,28 +357,58 @@ func startTimeAfterEndTime(startTime, endTime time.Time) bool {
 		startTime.After(endTime)
 }
 
-func snapshotSingleSource(ctx context.Context, rep *repo.Repository, u *snapshotfs.Uploader, sourceInfo snapshot.SourceInfo) error {
-	printStderr("Snapshotting %v ...\n", sourceInfo)
+func snapshotSingleSource(ctx context.Context, rep *repo.Repository, u *snapshotfs.Uploader, sourceInfo snapshot.SourceInfo, localPath string) error {
+	if localPath != sourceInfo.Path {
+		printStderr("Snapshotting %v from %v ...\n", sourceInfo, localPath)
+	} else {
+		printStderr("Snapshotting %v ...\n", sourceInfo)
+	}
 
 	t0 := time.Now()
 
 	rep.Content.Stats.Reset()
 
-	localEntry, err := getLocalFSEntry(ctx, sourceInfo.Path)
+	if *snapshotCreateAPFSSnapshot {
+		snapshotPath, release, err := localPathInAPFSSnapshot(ctx, localPath)
+		if err != nil {
+			return err
+		}
+		defer release()
+
+		localPath = snapshotPath
+	}
+
+	policyTree, err := policy.TreeForSource(ctx, rep, sourceInfo)
 	if err != nil {
-		return errors.Wrap(err, "unable to get local filesystem entry")
+		return errors.Wrap(err, "unable to get policy tree")
 	}
 
-	previous, err := findPreviousSnapshotManifest(ctx, rep, sourceInfo, nil)
+	if fsp := policyTree.EffectivePolicy().FilesystemSnapshotPolicy; fsp.Enabled() && !*snapshotCreateAPFSSnapshot {
+		snapshotPath, release, err := fssnapshot.Open(ctx, localPath, fssnapshot.Options{
+			Type:            fsp.Type,
+			LVMSnapshotSize: fsp.LVMSnapshotSize,
+		})
+		if err != nil {
+			return err
+		}
+		defer release()
+
+		localPath = snapshotPath
+	}
+
+	localEntry, err := getLocalFSEntry(ctx, localPath)
 	if err != nil {
-		return err
+		return errors.Wrap(err, "unable to get local filesystem entry")
 	}
 
-	policyTree, err := policy.TreeForSource(ctx, rep, sourceInfo)
+	previous, err := snapshot.FindPreviousManifests(ctx, rep, sourceInfo, nil)
 	if err != nil {
-		return errors.Wrap(err, "unable to get policy tree")
+		return err
 	}
 
+	bandwidth.start(sourceInfo, policyTree.EffectivePolicy().ThrottlingPolicy)
+	defer bandwidth.finish(sourceInfo)
+
 	log(ctx).Debugf("uploading %v using %v previous manifests", sourceInfo, len(previous))
 
 	manifest, err := u.Upload(ctx, localEntry, policyTree, sourceInfo, previous...)
@@ -164,6 +416,26 @@ func snapshotSingleSource(ctx context.Context, rep *repo.Repository, u *snapshot
 		return err
 	}
 
+	pol := policyTree.EffectivePolicy()
+
+	if manifest.Anomaly, err = pol.AnomalyPolicy.DetectAnomaly(ctx, rep, manifest); err != nil {
+		return errors.Wrap(err, "unable to check snapshot for anomalies")
+	}
+
+	if *snapshotCreateDryRun {
+		progress.Finish()
+		printDryRunReport(sourceInfo, manifest)
+
+		return nil
+	}
+
+	if manifest.Suspicious() {
+		if err := handleSuspiciousSnapshot(ctx, pol, manifest); err != nil {
+			progress.Finish()
+			return err
+		}
+	}
+
 	manifest.Description = *snapshotCreateDescription
 
 	duration := manifest.EndTime.Sub(manifest.StartTime)
@@ -189,6 +461,12 @@ func snapshotSingleSource(ctx context.Context, rep *repo.Repository, u *snapshot
 		}
 	}
 
+	if snapshotSigningKey != nil {
+		if err := manifest.Sign(snapshotSigningKey); err != nil {
+			return errors.Wrap(err, "unable to sign snapshot")
+		}
+	}
+
 	snapID, err := snapshot.SaveSnapshot(ctx, rep, manifest)
 	if err != nil {
 		return errors.Wrap(err, "cannot save manifest")
@@ -198,10 +476,6 @@ func snapshotSingleSource(ctx context.Context, rep *repo.Repository, u *snapshot
 		return errors.Wrap(err, "unable to apply retention policy")
 	}
 
-	if ferr := rep.Flush(ctx); ferr != nil {
-		return errors.Wrap(ferr, "flush error")
-	}
-
 	progress.Finish()
 
 	var maybePartial string
@@ -210,52 +484,175 @@ func snapshotSingleSource(ctx context.Context, rep *repo.Repository, u *snapshot
 	}
 
 	printStderr("\nCreated%v snapshot with root %v and ID %v in %v\n", maybePartial, manifest.RootObjectID(), snapID, time.Since(t0).Truncate(time.Second))
+	printStderr("Uploaded %v new contents (%v), %v already in repository\n",
+		manifest.Stats.NewContentCount,
+		units.BytesStringBase10(manifest.Stats.NewContentBytes),
+		units.BytesStringBase10(manifest.Stats.DedupedBytes))
+
+	if len(manifest.SensitiveFiles) > 0 {
+		var sb strings.Builder
+
+		writeSensitiveFiles(&sb, manifest.SensitiveFiles)
+		printStderr("%v", sb.String())
+	}
+
+	if ds := manifest.RootEntry.DirSummary; ds != nil && ds.FailedEntryCount > 0 {
+		var sb strings.Builder
+
+		writeFailedEntries(&sb, ds)
+		printStderr("%v", sb.String())
+	}
 
 	return err
 }
 
-// findPreviousSnapshotManifest returns the list of previous snapshots for a given source, including
-// last complete snapshot and possibly some number of incomplete snapshots following it.
-func findPreviousSnapshotManifest(ctx context.Context, rep *repo.Repository, sourceInfo snapshot.SourceInfo, noLaterThan *time.Time) ([]*snapshot.Manifest, error) {
-	man, err := snapshot.ListSnapshots(ctx, rep, sourceInfo)
+// localPathInAPFSSnapshot creates an APFS local snapshot of the volume containing the path and returns
+// the corresponding path in the snapshot, which is released by the returned function.
+func localPathInAPFSSnapshot(ctx context.Context, localPath string) (string, func(), error) {
+	// the volume and path within the snapshot must be determined from the real path.
+	realPath, err := filepath.EvalSymlinks(localPath)
 	if err != nil {
-		return nil, errors.Wrap(err, "error listing previous snapshots")
+		return "", nil, errors.Wrap(err, "evaluate symlink")
 	}
 
-	// phase 1 - find latest complete snapshot.
-	var previousComplete *snapshot.Manifest
-
-	var previousCompleteStartTime time.Time
+	s, err := apfs.Create(ctx, realPath)
+	if err != nil {
+		return "", nil, errors.Wrap(err, "unable to create APFS snapshot")
+	}
 
-	var result []*snapshot.Manifest
+	log(ctx).Infof("reading %v from APFS snapshot %v of %v", localPath, s.Name(), s.Volume)
 
-	for _, p := range man {
-		if noLaterThan != nil && p.StartTime.After(*noLaterThan) {
-			continue
+	return s.Path(realPath), func() {
+		if err := s.Release(ctx); err != nil {
+			log(ctx).Warningf("unable to release APFS snapshot %v: %v", s.Name(), err)
 		}
+	}, nil
+}
 
-		if p.IncompleteReason == "" && (previousComplete == nil || p.StartTime.After(previousComplete.StartTime)) {
-			previousComplete = p
-			previousCompleteStartTime = p.StartTime
-		}
+// snapshotEntryAsSource snapshots an entry that is not a local directory, such as a Docker volume or database dumps,
+// as the provided source. Snapshots with read errors are not saved if failOnReadErrors is set.
+func snapshotEntryAsSource(ctx context.Context, rep *repo.Repository, root fs.Entry, sourceInfo snapshot.SourceInfo, description string, tags map[string]string, hookOutput json.RawMessage, failOnReadErrors bool) (*snapshot.Manifest, error) {
+	t0 := time.Now()
+
+	previous, err := snapshot.FindPreviousManifests(ctx, rep, sourceInfo, nil)
+	if err != nil {
+		return nil, err
 	}
 
-	if previousComplete != nil {
-		result = append(result, previousComplete)
+	policyTree, err := policy.TreeForSource(ctx, rep, sourceInfo)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to get policy tree")
 	}
 
-	// add all incomplete snapshots after that
-	for _, p := range man {
-		if noLaterThan != nil && p.StartTime.After(*noLaterThan) {
-			continue
-		}
+	u := snapshotfs.NewUploader(rep)
+	u.Progress = progress
+	onCtrlC(u.Cancel)
+
+	manifest, err := u.Upload(ctx, root, policyTree, sourceInfo, previous...)
+	if err != nil {
+		return nil, err
+	}
+
+	progress.Finish()
+
+	if failOnReadErrors && manifest.Stats.ReadErrors > 0 {
+		return nil, errors.Errorf("snapshot not saved because of %v read errors", manifest.Stats.ReadErrors)
+	}
+
+	pol := policyTree.EffectivePolicy()
+
+	if manifest.Anomaly, err = pol.AnomalyPolicy.DetectAnomaly(ctx, rep, manifest); err != nil {
+		return nil, errors.Wrap(err, "unable to check snapshot for anomalies")
+	}
+
+	if pol.RejectsSnapshot(manifest) {
+		return nil, errors.Errorf("snapshot not saved because it is suspicious: %v", strings.Join(manifest.SuspicionReasons(), ", "))
+	}
+
+	manifest.Description = description
+	manifest.Tags = tags
+	manifest.HookOutput = hookOutput
+
+	snapID, err := snapshot.SaveSnapshot(ctx, rep, manifest)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot save manifest")
+	}
+
+	if _, err = policy.ApplyRetentionPolicy(ctx, rep, sourceInfo, true); err != nil {
+		return nil, errors.Wrap(err, "unable to apply retention policy")
+	}
 
-		if p.IncompleteReason != "" && p.StartTime.After(previousCompleteStartTime) {
-			result = append(result, p)
+	printStderr("\nCreated snapshot with root %v and ID %v in %v\n", manifest.RootObjectID(), snapID, time.Since(t0).Truncate(time.Second))
+	printStderr("Uploaded %v new contents (%v), %v already in repository\n",
+		manifest.Stats.NewContentCount,
+		units.BytesStringBase10(manifest.Stats.NewContentBytes),
+		units.BytesStringBase10(manifest.Stats.DedupedBytes))
+
+	return manifest, nil
+}
+
+// writeFailedEntries writes the report of entries that could not be read.
+func writeFailedEntries(sb *strings.Builder, ds *fs.DirectorySummary) {
+	fmt.Fprintf(sb, "  Failed entries:      %v\n", ds.FailedEntryCount)
+
+	for _, e := range ds.FailedEntries {
+		fmt.Fprintf(sb, "    %v: %v\n", e.EntryPath, e.Error)
+	}
+
+	if more := ds.FailedEntryCount - len(ds.FailedEntries); more > 0 {
+		fmt.Fprintf(sb, "    (%v more)\n", more)
+	}
+}
+
+// writeSensitiveFiles writes the report of files detected as sensitive according to the screening policy.
+func writeSensitiveFiles(sb *strings.Builder, files []*snapshot.SensitiveFile) {
+	fmt.Fprintf(sb, "  Sensitive files:     %v\n", len(files))
+
+	for _, sf := range files {
+		action := "uploaded"
+		if sf.Skipped {
+			action = "skipped"
 		}
+
+		fmt.Fprintf(sb, "    %v (%v, %v)\n", sf.Path, action, sf.Reason)
 	}
+}
 
-	return result, nil
+func printDryRunReport(sourceInfo snapshot.SourceInfo, manifest *snapshot.Manifest) {
+	var sb strings.Builder
+
+	st := manifest.Stats
+
+	fmt.Fprintf(&sb, "\nDry run of %v:\n", sourceInfo)
+	fmt.Fprintf(&sb, "  Files:               %v (%v) in %v directories\n", st.TotalFileCount, units.BytesStringBase10(st.TotalFileSize), st.TotalDirectoryCount)
+	fmt.Fprintf(&sb, "  Unchanged files:     %v\n", st.CachedFiles)
+	fmt.Fprintf(&sb, "  New or changed:      %v\n", st.NonCachedFiles)
+	fmt.Fprintf(&sb, "  Modified:            %v\n", st.ModifiedFiles)
+	fmt.Fprintf(&sb, "  Excluded:            %v files (%v), %v directories\n", st.ExcludedFileCount, units.BytesStringBase10(st.ExcludedTotalFileSize), st.ExcludedDirCount)
+
+	if st.ReadErrors > 0 {
+		fmt.Fprintf(&sb, "  Read errors:         %v\n", st.ReadErrors)
+	}
+
+	fmt.Fprintf(&sb, "  Would upload:        %v contents (%v)\n", st.NewContentCount, units.BytesStringBase10(st.NewContentBytes))
+
+	if manifest.IncompleteReason != "" {
+		fmt.Fprintf(&sb, "  Incomplete:          %v\n", manifest.IncompleteReason)
+	}
+
+	for _, r := range manifest.SuspicionReasons() {
+		fmt.Fprintf(&sb, "  Suspicious:          %v\n", r)
+	}
+
+	if len(manifest.SensitiveFiles) > 0 {
+		writeSensitiveFiles(&sb, manifest.SensitiveFiles)
+	}
+
+	if ds := manifest.RootEntry.DirSummary; ds != nil && ds.FailedEntryCount > 0 {
+		writeFailedEntries(&sb, ds)
+	}
+
+	printStdout("%v", sb.String())
 }
 
 func getLocalBackupPaths(ctx context.Context, rep *repo.Repository) ([]string, error) {
@@ -277,6 +674,68 @@ func getLocalBackupPaths(ctx context.Context, rep *repo.Repository) ([]string, e
 	return result, nil
 }
 
+// runBackupCommandUsingDaemon snapshots the sources using the daemon, which already has the repository open.
+// Sources that are not yet known to the daemon are added to it.
+func runBackupCommandUsingDaemon(ctx context.Context, cli *serverapi.Client) error {
+	if len(*snapshotCreateSources) == 0 {
+		return errors.New("no backup sources")
+	}
+
+	var sources serverapi.SourcesResponse
+	if err := cli.Get(ctx, "sources", &sources); err != nil {
+		return err
+	}
+
+	failed := 0
+
+	for _, src := range *snapshotCreateSources {
+		path, err := filepath.Abs(src)
+		if err != nil {
+			return errors.Wrapf(err, "invalid source %v", src)
+		}
+
+		si := snapshot.SourceInfo{Host: sources.LocalHost, UserName: sources.LocalUsername, Path: path}
+
+		printStderr("Snapshotting %v using the daemon ...\n", si)
+
+		t0 := time.Now()
+
+		if err := cli.Post(ctx, "sources", &serverapi.CreateSnapshotSourceRequest{Path: path}, &serverapi.CreateSnapshotSourceResponse{}); err != nil {
+			return errors.Wrapf(err, "unable to add source %v to the daemon", si)
+		}
+
+		var resp serverapi.MultipleSourceActionResponse
+		if err := cli.Post(ctx, "sources/upload?"+sourceQuery(si).Encode(), &serverapi.Empty{}, &resp); err != nil {
+			return errors.Wrapf(err, "unable to start snapshot of %v", si)
+		}
+
+		r, ok := resp.Sources[si.String()]
+		if !ok || !r.Success {
+			return errors.Errorf("unable to start snapshot of %v", si)
+		}
+
+		st, err := waitForSnapshotRun(ctx, cli, si.String(), r.Run)
+		if err != nil {
+			return err
+		}
+
+		if st.State != serverapi.SnapshotRunSucceeded {
+			printStderr("Error snapshotting %v: %v\n", si, st.Error)
+			failed++
+
+			continue
+		}
+
+		printStderr("\nCreated snapshot with ID %v in %v\n", st.SnapshotID, time.Since(t0).Truncate(time.Second))
+	}
+
+	if failed > 0 {
+		return errors.Errorf("encountered %v errors", failed)
+	}
+
+	return nil
+}
+
 func init() {
-	snapshotCreateCommand.Action(repositoryAction(runBackupCommand))
+	snapshotCreateCommand.Action(daemonCapableAction(snapshotCreateCommand, runBackupCommandUsingDaemon, repositoryAction(runBackupCommand)))
 }
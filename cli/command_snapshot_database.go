@@ -0,0 +1,128 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/dbdump"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/snapshot"
+)
+
+var (
+	snapshotDatabaseCommand       = snapshotCommands.Command("database", "Snapshot PostgreSQL or MySQL databases by streaming the output of pg_dump or mysqldump, without temporary files.")
+	snapshotDatabaseType          = snapshotDatabaseCommand.Arg("type", "Type of the database").Required().Enum(dbdump.TypePostgres, dbdump.TypeMySQL)
+	snapshotDatabaseNames         = snapshotDatabaseCommand.Flag("database", "Name of the database to dump, each is stored as a separate file").Required().Strings()
+	snapshotDatabaseHost          = snapshotDatabaseCommand.Flag("db-host", "Database server host").String()
+	snapshotDatabasePort          = snapshotDatabaseCommand.Flag("db-port", "Database server port").Int()
+	snapshotDatabaseUser          = snapshotDatabaseCommand.Flag("db-user", "Database user, the password is read by the dump command from its environment or configuration").String()
+	snapshotDatabaseDumpCommand   = snapshotDatabaseCommand.Flag("dump-command", "Command used instead of pg_dump or mysqldump, such as 'docker exec db pg_dump'").String()
+	snapshotDatabaseDumpArgs      = snapshotDatabaseCommand.Flag("dump-arg", "Additional argument of the dump command").Strings()
+	snapshotDatabaseSourcePath    = snapshotDatabaseCommand.Flag("source-path", "Path of the snapshot source, defaults to /TYPE/HOST").String()
+	snapshotDatabaseBeforeCommand = snapshotDatabaseCommand.Flag("before-command", "Command to run before dumping the databases, the snapshot is not taken if it fails. A JSON object printed to its standard output, such as the position in the database log, is stored in the snapshot").PlaceHolder("COMMAND").String()
+	snapshotDatabaseAfterCommand  = snapshotDatabaseCommand.Flag("after-command", "Command to run after the snapshot, even if it failed").PlaceHolder("COMMAND").String()
+	snapshotDatabaseDescription   = snapshotDatabaseCommand.Flag("description", "Free-form snapshot description.").String()
+)
+
+func init() {
+	snapshotDatabaseCommand.Action(repositoryAction(runSnapshotDatabaseCommand))
+}
+
+func runSnapshotDatabaseCommand(ctx context.Context, rep *repo.Repository) error {
+	opt := &dbdump.Options{
+		Type:        *snapshotDatabaseType,
+		Databases:   *snapshotDatabaseNames,
+		Host:        *snapshotDatabaseHost,
+		Port:        *snapshotDatabasePort,
+		User:        *snapshotDatabaseUser,
+		DumpCommand: *snapshotDatabaseDumpCommand,
+		ExtraArgs:   *snapshotDatabaseDumpArgs,
+	}
+
+	sourceInfo := snapshot.SourceInfo{
+		Host:     rep.Hostname,
+		UserName: rep.Username,
+		Path:     *snapshotDatabaseSourcePath,
+	}
+
+	if sourceInfo.Path == "" {
+		sourceInfo.Path = "/" + opt.Type + "/" + firstNonEmpty(opt.Host, "localhost")
+	}
+
+	root, err := dbdump.Root(opt.Type, opt)
+	if err != nil {
+		return err
+	}
+
+	hookOutput, err := runSnapshotHook(ctx, *snapshotDatabaseBeforeCommand, sourceInfo, nil, nil)
+	if err != nil {
+		return err
+	}
+
+	printStderr("Snapshotting %v databases %v as %v ...\n", opt.Type, strings.Join(opt.Databases, ", "), sourceInfo)
+
+	// partial dumps are not usable, so failures of dump commands fail the snapshot.
+	man, err := snapshotEntryAsSource(ctx, rep, root, sourceInfo, *snapshotDatabaseDescription, map[string]string{
+		"database.type":      opt.Type,
+		"database.databases": strings.Join(opt.Databases, ","),
+	}, hookOutput, true)
+
+	if _, herr := runSnapshotHook(ctx, *snapshotDatabaseAfterCommand, sourceInfo, man, err); herr != nil {
+		log(ctx).Warningf("%v", herr)
+	}
+
+	return err
+}
+
+// runSnapshotHook invokes the provided command, which may include arguments separated by spaces,
+// passing the source and, after the snapshot, its ID or error in environment variables.
+// If the command prints a JSON object to its standard output, the object is returned in compact form,
+// any other output is printed.
+func runSnapshotHook(ctx context.Context, command string, src snapshot.SourceInfo, man *snapshot.Manifest, snapshotErr error) (json.RawMessage, error) {
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return nil, nil
+	}
+
+	var stdout bytes.Buffer
+
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...) //nolint:gosec
+	cmd.Stdout = &stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(), "KOPIA_SNAPSHOT_SOURCE="+src.String())
+
+	if man != nil {
+		cmd.Env = append(cmd.Env, "KOPIA_SNAPSHOT_ID="+string(man.ID))
+	}
+
+	if snapshotErr != nil {
+		cmd.Env = append(cmd.Env, "KOPIA_SNAPSHOT_ERROR="+snapshotErr.Error())
+	}
+
+	err := cmd.Run()
+
+	return hookOutput(stdout.Bytes()), errors.Wrapf(err, "error running %v", args[0])
+}
+
+// hookOutput returns the output of a hook in compact form if it is a JSON object, otherwise prints it.
+func hookOutput(out []byte) json.RawMessage {
+	var obj map[string]json.RawMessage
+
+	if trimmed := bytes.TrimSpace(out); bytes.HasPrefix(trimmed, []byte("{")) && json.Unmarshal(trimmed, &obj) == nil {
+		var compact bytes.Buffer
+
+		if json.Compact(&compact, trimmed) == nil {
+			return compact.Bytes()
+		}
+	}
+
+	os.Stderr.Write(out) //nolint:errcheck
+
+	return nil
+}
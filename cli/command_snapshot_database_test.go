@@ -0,0 +1,19 @@
+package cli
+
+import "testing"
+
+func TestHookOutput(t *testing.T) {
+	cases := map[string]string{
+		"{\n  \"lsn\": \"0/16B3748\",\n  \"version\": 12\n}\n": `{"lsn":"0/16B3748","version":12}`,
+		"":                   "",
+		"dump started\n":     "",
+		"{ not json\n":       "",
+		"[\"not object\"]\n": "",
+	}
+
+	for out, want := range cases {
+		if got := string(hookOutput([]byte(out))); got != want {
+			t.Errorf("unexpected hook output of %q: %v, want %v", out, got, want)
+		}
+	}
+}
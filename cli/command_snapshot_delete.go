@@ -63,5 +63,6 @@ func runDeleteCommand(ctx context.Context, rep *repo.Repository) error {
 }
 
 func init() {
+	snapshotDeleteCommand.GetArg("id").HintAction(completeSnapshotIDs)
 	snapshotDeleteCommand.Action(repositoryAction(runDeleteCommand))
 }
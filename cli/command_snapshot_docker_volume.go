@@ -0,0 +1,144 @@
+package cli
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/fs"
+	"github.com/kopia/kopia/fs/archivefs"
+	"github.com/kopia/kopia/fs/localfs"
+	"github.com/kopia/kopia/internal/dockervolume"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/snapshot"
+)
+
+var (
+	snapshotDockerVolumeCommand     = snapshotCommands.Command("docker-volume", "Snapshot a Docker volume, reading it directly from its mount point or using a helper container.")
+	snapshotDockerVolumeName        = snapshotDockerVolumeCommand.Arg("name", "Name of the volume").Required().String()
+	snapshotDockerVolumeDocker      = snapshotDockerVolumeCommand.Flag("docker-command", "Command used to invoke docker, such as 'sudo docker' or 'podman'").Default("docker").Envar("KOPIA_DOCKER_COMMAND").String()
+	snapshotDockerVolumeHelper      = snapshotDockerVolumeCommand.Flag("helper", "Read the volume using a helper container even if its mount point is accessible").Bool()
+	snapshotDockerVolumeHelperImage = snapshotDockerVolumeCommand.Flag("helper-image", "Image of the helper container, which must provide tar").Default(dockervolume.DefaultHelperImage).String()
+	snapshotDockerVolumeDescription = snapshotDockerVolumeCommand.Flag("description", "Free-form snapshot description.").String()
+)
+
+// dockerVolumeSourcePrefix is the path prefix of sources of volumes without a mount point.
+const dockerVolumeSourcePrefix = "/docker-volumes/"
+
+func init() {
+	snapshotDockerVolumeCommand.Action(repositoryAction(runSnapshotDockerVolumeCommand))
+}
+
+func runSnapshotDockerVolumeCommand(ctx context.Context, rep *repo.Repository) error {
+	client, err := dockervolume.NewClient(*snapshotDockerVolumeDocker)
+	if err != nil {
+		return err
+	}
+
+	vol, err := client.Inspect(ctx, *snapshotDockerVolumeName)
+	if err != nil {
+		return errors.Wrap(err, "unable to inspect volume")
+	}
+
+	// the mount point identifies the volume, so that policies can be set for it like for any other directory.
+	sourceInfo := snapshot.SourceInfo{
+		Host:     rep.Hostname,
+		UserName: rep.Username,
+		Path:     vol.Mountpoint,
+	}
+
+	if sourceInfo.Path == "" {
+		sourceInfo.Path = dockerVolumeSourcePrefix + vol.Name
+	}
+
+	root, cleanup, err := dockerVolumeRoot(ctx, client, vol)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	printStderr("Snapshotting volume %v as %v ...\n", vol.Name, sourceInfo)
+
+	_, err = snapshotEntryAsSource(ctx, rep, root, sourceInfo, *snapshotDockerVolumeDescription, dockerVolumeTags(vol), nil, false)
+
+	return err
+}
+
+// dockerVolumeRoot returns the root directory of the volume, read from its mount point when accessible
+// or otherwise from an archive exported by a helper container.
+func dockerVolumeRoot(ctx context.Context, client *dockervolume.Client, vol *dockervolume.Volume) (fs.Entry, func(), error) {
+	if !*snapshotDockerVolumeHelper && vol.Mountpoint != "" {
+		err := checkDirectoryReadable(vol.Mountpoint)
+		if err == nil {
+			e, err := localfs.NewEntry(vol.Mountpoint)
+			return e, func() {}, err
+		}
+
+		log(ctx).Infof("mount point of volume %v is not accessible (%v), using helper container", vol.Name, err)
+	}
+
+	// archivefs determines the format from the file extension.
+	f, err := ioutil.TempFile("", "kopia-docker-volume-*.tar")
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "unable to create temporary file")
+	}
+
+	cleanup := func() {
+		f.Close()           //nolint:errcheck
+		os.Remove(f.Name()) //nolint:errcheck
+	}
+
+	printStderr("Reading volume %v using helper container %v ...\n", vol.Name, *snapshotDockerVolumeHelperImage)
+
+	if err := client.Export(ctx, vol.Name, *snapshotDockerVolumeHelperImage, f); err != nil {
+		cleanup()
+		return nil, nil, errors.Wrap(err, "unable to read volume using helper container")
+	}
+
+	arch, err := archivefs.Open(ctx, f.Name(), 0)
+	if err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+
+	return arch.Root(), func() {
+		arch.Close() //nolint:errcheck
+		cleanup()
+	}, nil
+}
+
+func checkDirectoryReadable(dir string) error {
+	f, err := os.Open(dir) //nolint:gosec
+	if err != nil {
+		return err
+	}
+	defer f.Close() //nolint:errcheck
+
+	if _, err := f.Readdirnames(1); err != nil && err != io.EOF {
+		return err
+	}
+
+	return nil
+}
+
+// dockerVolumeTags returns tags of the snapshot describing the volume, its labels and the containers using it.
+func dockerVolumeTags(vol *dockervolume.Volume) map[string]string {
+	tags := map[string]string{
+		"docker.volume": vol.Name,
+		"docker.driver": vol.Driver,
+	}
+
+	if len(vol.Containers) > 0 {
+		tags["docker.containers"] = strings.Join(vol.Containers, ",")
+	}
+
+	for k, v := range vol.Labels {
+		tags["docker.label."+k] = v
+	}
+
+	return tags
+}
@@ -0,0 +1,120 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/fs"
+	"github.com/kopia/kopia/internal/units"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/snapshot"
+	"github.com/kopia/kopia/snapshot/snapshotfs"
+)
+
+var (
+	duplicatesCommand           = snapshotCommands.Command("duplicates", "List groups of files with identical contents within snapshots")
+	duplicatesCommandObjectIDs  = duplicatesCommand.Arg("object-id", "Directory object IDs to search").Strings()
+	duplicatesCommandSources    = duplicatesCommand.Flag("sources", "Search the latest snapshots of the provided sources").Strings()
+	duplicatesCommandAllSources = duplicatesCommand.Flag("all-sources", "Search the latest snapshots of all sources").Bool()
+	duplicatesCommandMinSize    = duplicatesCommand.Flag("min-size", "Minimum size of reported files").Default("1").Int64()
+)
+
+func runDuplicatesCommand(ctx context.Context, rep *repo.Repository) error {
+	roots := map[string]fs.Directory{}
+
+	for _, oidStr := range *duplicatesCommandObjectIDs {
+		oid, err := parseObjectID(ctx, rep, oidStr)
+		if err != nil {
+			return err
+		}
+
+		dir, ok := snapshotfs.DirectoryEntry(rep, oid, nil).(fs.Directory)
+		if !ok {
+			return errors.Errorf("%v is not a directory", oidStr)
+		}
+
+		roots[oidStr] = dir
+	}
+
+	if err := addLatestSnapshotRoots(ctx, rep, roots); err != nil {
+		return err
+	}
+
+	if len(roots) == 0 {
+		return errors.New("no directories to search, provide object IDs, --sources or --all-sources")
+	}
+
+	groups, err := snapshotfs.FindDuplicateFiles(ctx, roots, *duplicatesCommandMinSize)
+	if err != nil {
+		return err
+	}
+
+	var total int64
+
+	for _, g := range groups {
+		total += g.ReclaimableBytes()
+
+		fmt.Printf("%v files of %v each, reclaimable %v (%v)\n",
+			len(g.Paths), units.BytesStringBase10(g.Size), units.BytesStringBase10(g.ReclaimableBytes()), g.ObjectID)
+
+		for _, p := range g.Paths {
+			fmt.Printf("  %v\n", p)
+		}
+	}
+
+	printStderr("Found %v groups of duplicate files, total reclaimable size: %v\n", len(groups), units.BytesStringBase10(total))
+
+	return nil
+}
+
+// addLatestSnapshotRoots adds root directories of the latest snapshots of the sources specified with flags.
+func addLatestSnapshotRoots(ctx context.Context, rep *repo.Repository, roots map[string]fs.Directory) error {
+	var sources []snapshot.SourceInfo
+
+	if *duplicatesCommandAllSources {
+		all, err := snapshot.ListSources(ctx, rep)
+		if err != nil {
+			return errors.Wrap(err, "unable to list sources")
+		}
+
+		sources = all
+	} else {
+		for _, srcStr := range *duplicatesCommandSources {
+			src, err := snapshot.ParseSourceInfo(srcStr, rep.Hostname, rep.Username)
+			if err != nil {
+				return errors.Wrapf(err, "error parsing %q", srcStr)
+			}
+
+			sources = append(sources, src)
+		}
+	}
+
+	for _, src := range sources {
+		snapshots, err := snapshot.ListSnapshots(ctx, rep, src)
+		if err != nil {
+			return errors.Wrapf(err, "unable to list snapshots of %v", src)
+		}
+
+		var latest *snapshot.Manifest
+
+		for _, m := range snapshots {
+			if m.RootEntry != nil && m.RootEntry.Type == snapshot.EntryTypeDirectory && (latest == nil || m.StartTime.After(latest.StartTime)) {
+				latest = m
+			}
+		}
+
+		if latest == nil {
+			continue
+		}
+
+		roots[src.String()] = snapshotfs.DirectoryEntry(rep, latest.RootObjectID(), nil).(fs.Directory)
+	}
+
+	return nil
+}
+
+func init() {
+	duplicatesCommand.Action(repositoryAction(runDuplicatesCommand))
+}
@@ -72,5 +72,6 @@ func runExpireCommand(ctx context.Context, rep *repo.Repository) error {
 }
 
 func init() {
+	snapshotExpireCommand.GetArg("path").HintAction(completeSources)
 	snapshotExpireCommand.Action(repositoryAction(runExpireCommand))
 }
@@ -0,0 +1,206 @@
+package cli
+
+import (
+	"context"
+	"sort"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/clock"
+	"github.com/kopia/kopia/internal/units"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/snapshot"
+	"github.com/kopia/kopia/snapshot/gc"
+	"github.com/kopia/kopia/snapshot/policy"
+)
+
+var (
+	snapshotForgetSourceCommand     = snapshotCommands.Command("forget-source", "Delete snapshots and policies of a decommissioned machine, user or directory.")
+	snapshotForgetSourceTarget      = snapshotForgetSourceCommand.Arg("source", "Source to forget ('user@host' or 'user@host:path')").Required().String()
+	snapshotForgetSourceGracePeriod = snapshotForgetSourceCommand.Flag("grace-period", "Refuse to forget sources with snapshots newer than this").Default("720h").Duration()
+	snapshotForgetSourceKeepLatest  = snapshotForgetSourceCommand.Flag("keep-latest", "Number of latest snapshots of each source to keep, policies of sources with kept snapshots are not removed").Int()
+	snapshotForgetSourceAllUsers    = snapshotForgetSourceCommand.Flag("all-users", "Forget sources of all users of the host").Bool()
+	snapshotForgetSourceDelete      = snapshotForgetSourceCommand.Flag("delete", "Whether to actually delete snapshots and policies").Bool()
+)
+
+func init() {
+	snapshotForgetSourceCommand.GetArg("source").HintAction(completeSources)
+	snapshotForgetSourceCommand.Action(repositoryAction(runSnapshotForgetSourceCommand))
+}
+
+// sourceMatches determines whether the source is the target or belongs to the host or user of the target.
+func sourceMatches(target, src snapshot.SourceInfo) bool {
+	if src.Host != target.Host {
+		return false
+	}
+
+	if target.UserName != "" && src.UserName != target.UserName {
+		return false
+	}
+
+	return target.Path == "" || src.Path == target.Path
+}
+
+func runSnapshotForgetSourceCommand(ctx context.Context, rep *repo.Repository) error {
+	target, err := snapshot.ParseSourceInfo(*snapshotForgetSourceTarget, rep.Hostname, rep.Username)
+	if err != nil {
+		return err
+	}
+
+	if target.Host == "" {
+		return errors.Errorf("invalid source %q, must include the host", *snapshotForgetSourceTarget)
+	}
+
+	if *snapshotForgetSourceAllUsers {
+		if target.Path != "" {
+			return errors.New("--all-users can't be used with a path")
+		}
+
+		target.UserName = ""
+	}
+
+	if *snapshotForgetSourceKeepLatest < 0 {
+		return errors.New("--keep-latest must not be negative")
+	}
+
+	allSources, err := snapshot.ListSources(ctx, rep)
+	if err != nil {
+		return errors.Wrap(err, "unable to list sources")
+	}
+
+	var sources []snapshot.SourceInfo
+
+	for _, src := range allSources {
+		if sourceMatches(target, src) {
+			sources = append(sources, src)
+		}
+	}
+
+	sort.Slice(sources, func(i, j int) bool {
+		return sources[i].String() < sources[j].String()
+	})
+
+	toDelete, kept, err := snapshotsToForget(ctx, rep, sources)
+	if err != nil {
+		return err
+	}
+
+	policies, err := policiesToForget(ctx, rep, target, kept)
+	if err != nil {
+		return err
+	}
+
+	if len(toDelete) == 0 && len(policies) == 0 {
+		printStderr("Nothing to forget for %v.\n", target)
+		return nil
+	}
+
+	est, err := gc.EstimateReclaimed(ctx, rep, toDelete)
+	if err != nil {
+		return errors.Wrap(err, "unable to estimate reclaimed space")
+	}
+
+	printStdout("Snapshots to delete: %v of %v sources\n", len(toDelete), len(sources))
+
+	for _, p := range policies {
+		printStdout("Policy to remove: %v\n", p.Target())
+	}
+
+	printStdout("Contents to reclaim at next GC: %v (%v)\n", est.Count, units.BytesStringBase10(est.Bytes))
+
+	if !*snapshotForgetSourceDelete {
+		printStderr("Not deleting because '--delete' flag was not set.\n")
+		return nil
+	}
+
+	for _, m := range toDelete {
+		if err := rep.Manifests.Delete(ctx, m.ID); err != nil {
+			return errors.Wrapf(err, "unable to delete snapshot %v", m.ID)
+		}
+	}
+
+	for _, p := range policies {
+		if err := policy.RemovePolicy(ctx, rep, p.Target()); err != nil {
+			return errors.Wrapf(err, "unable to remove policy of %v", p.Target())
+		}
+	}
+
+	printStderr("Deleted %v snapshots and %v policies, run 'kopia snapshot gc' to reclaim space.\n", len(toDelete), len(policies))
+
+	return nil
+}
+
+// snapshotsToForget returns the snapshots of the sources except the latest ones to keep
+// and the sources that have snapshots kept, failing if any source has a snapshot within the grace period.
+func snapshotsToForget(ctx context.Context, rep *repo.Repository, sources []snapshot.SourceInfo) ([]*snapshot.Manifest, []snapshot.SourceInfo, error) {
+	var (
+		result []*snapshot.Manifest
+		kept   []snapshot.SourceInfo
+	)
+
+	for _, src := range sources {
+		snapshots, err := snapshot.ListSnapshots(ctx, rep, src)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "unable to list snapshots of %v", src)
+		}
+
+		sort.Slice(snapshots, func(i, j int) bool {
+			return snapshots[i].StartTime.After(snapshots[j].StartTime)
+		})
+
+		if len(snapshots) > 0 && !clock.OlderThan(rep.Time(), snapshots[0].StartTime, *snapshotForgetSourceGracePeriod) {
+			return nil, nil, errors.Errorf("%v has a snapshot from %v, which is within the grace period of %v",
+				src, formatTimestamp(snapshots[0].StartTime), *snapshotForgetSourceGracePeriod)
+		}
+
+		if len(snapshots) > 0 && *snapshotForgetSourceKeepLatest > 0 {
+			kept = append(kept, src)
+		}
+
+		if len(snapshots) <= *snapshotForgetSourceKeepLatest {
+			continue
+		}
+
+		snapshots = snapshots[*snapshotForgetSourceKeepLatest:]
+
+		printStdout("%v: %v snapshots from %v to %v\n", src, len(snapshots),
+			formatTimestamp(snapshots[len(snapshots)-1].StartTime), formatTimestamp(snapshots[0].StartTime))
+
+		result = append(result, snapshots...)
+	}
+
+	return result, kept, nil
+}
+
+// policiesToForget returns policies of the target and the sources that belong to it,
+// except policies that apply to the sources whose snapshots are kept.
+func policiesToForget(ctx context.Context, rep *repo.Repository, target snapshot.SourceInfo, kept []snapshot.SourceInfo) ([]*policy.Policy, error) {
+	all, err := policy.ListPolicies(ctx, rep)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to list policies")
+	}
+
+	var result []*policy.Policy
+
+	for _, p := range all {
+		if sourceMatches(target, p.Target()) && !appliesToAnySource(p.Target(), kept) {
+			result = append(result, p)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Target().String() < result[j].Target().String()
+	})
+
+	return result, nil
+}
+
+func appliesToAnySource(target snapshot.SourceInfo, sources []snapshot.SourceInfo) bool {
+	for _, src := range sources {
+		if sourceMatches(target, src) {
+			return true
+		}
+	}
+
+	return false
+}
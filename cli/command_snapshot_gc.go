@@ -2,9 +2,13 @@ package cli
 
 import (
 	"context"
+	"encoding/json"
+
+	"github.com/pkg/errors"
 
 	"github.com/kopia/kopia/internal/units"
 	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/lock"
 	"github.com/kopia/kopia/snapshot/gc"
 )
 
@@ -12,10 +16,47 @@ var (
 	snapshotGCCommand       = snapshotCommands.Command("gc", "Remove contents not used by any snapshot")
 	snapshotGCMinContentAge = snapshotGCCommand.Flag("min-age", "Minimum content age to allow deletion").Default("24h").Duration()
 	snapshotGCDelete        = snapshotGCCommand.Flag("delete", "Delete unreferenced contents").Bool()
+
+	snapshotGCPlan             = snapshotGCCommand.Flag("plan", "Print the plan of reclaiming space, with storage requests and estimated costs, before deleting contents").Bool()
+	snapshotGCPlanJSON         = snapshotGCCommand.Flag("plan-json", "Print the plan in JSON format").Bool()
+	snapshotGCRewriteThreshold = snapshotGCCommand.Flag("rewrite-threshold", "Minimum percentage of unused data in a pack to rewrite its remaining contents").Default("50").Int()
+
+	// defaults are list prices of AWS S3 Standard in USD.
+	snapshotGCPutPrice     = snapshotGCCommand.Flag("put-price", "Price of 1000 PUT requests").Default("0.005").Float64()
+	snapshotGCGetPrice     = snapshotGCCommand.Flag("get-price", "Price of 1000 GET requests").Default("0.0004").Float64()
+	snapshotGCDeletePrice  = snapshotGCCommand.Flag("delete-price", "Price of 1000 DELETE requests").Default("0").Float64()
+	snapshotGCEgressPrice  = snapshotGCCommand.Flag("egress-price", "Price of downloading 1 GB").Default("0.09").Float64()
+	snapshotGCStoragePrice = snapshotGCCommand.Flag("storage-price", "Price of storing 1 GB for a month").Default("0.023").Float64()
+
+	snapshotGCMaxDeleteRequests = snapshotGCCommand.Flag("max-delete-requests", "Abort if the plan requires more DELETE requests").Int()
+	snapshotGCMaxRewrittenPacks = snapshotGCCommand.Flag("max-pack-rewrites", "Abort if the plan requires rewriting more packs").Int()
+	snapshotGCMaxEgressMB       = snapshotGCCommand.Flag("max-egress-mb", "Abort if the plan requires downloading more data").Int64()
+	snapshotGCMaxCost           = snapshotGCCommand.Flag("max-cost", "Abort if the estimated cost of the plan is higher").Float64()
 )
 
 func runSnapshotGCCommand(ctx context.Context, rep *repo.Repository) error {
-	st, err := gc.Run(ctx, rep, *snapshotGCMinContentAge, *snapshotGCDelete)
+	if *snapshotGCDelete {
+		lockedCtx, release, err := lockRepository(ctx, rep, lock.Exclusive, "snapshot gc")
+		if err != nil {
+			return err
+		}
+
+		defer release()
+
+		ctx = lockedCtx
+	}
+
+	st, plan, err := gc.RunWithPlan(ctx, rep, *snapshotGCMinContentAge, *snapshotGCDelete, snapshotGCPlanOptions())
+
+	if plan != nil {
+		if perr := printGCPlan(plan); perr != nil {
+			return perr
+		}
+
+		if errors.Is(err, gc.ErrPlanLimitsExceeded) {
+			return err
+		}
+	}
 
 	log(ctx).Infof("GC found %v unused contents (%v bytes)", st.UnusedCount, units.BytesStringBase2(st.UnusedBytes))
 	log(ctx).Infof("GC found %v unused contents that are too recent to delete (%v bytes)", st.TooRecentCount, units.BytesStringBase2(st.TooRecentBytes))
@@ -25,6 +66,63 @@ func runSnapshotGCCommand(ctx context.Context, rep *repo.Repository) error {
 	return err
 }
 
+// snapshotGCPlanOptions returns the options of the GC plan or nil if the plan was not requested.
+func snapshotGCPlanOptions() *gc.PlanOptions {
+	limits := gc.PlanLimits{
+		MaxDeleteRequests: *snapshotGCMaxDeleteRequests,
+		MaxRewrittenPacks: *snapshotGCMaxRewrittenPacks,
+		MaxEgressBytes:    *snapshotGCMaxEgressMB << 20, //nolint:gomnd
+		MaxCost:           *snapshotGCMaxCost,
+	}
+
+	if !*snapshotGCPlan && !*snapshotGCPlanJSON && limits == (gc.PlanLimits{}) {
+		return nil
+	}
+
+	return &gc.PlanOptions{
+		RewriteThresholdPercent: *snapshotGCRewriteThreshold,
+		Pricing: gc.Pricing{
+			PutPerThousand:    *snapshotGCPutPrice,
+			GetPerThousand:    *snapshotGCGetPrice,
+			DeletePerThousand: *snapshotGCDeletePrice,
+			EgressPerGB:       *snapshotGCEgressPrice,
+			StoragePerGBMonth: *snapshotGCStoragePrice,
+		},
+		Limits: limits,
+	}
+}
+
+func printGCPlan(p *gc.Plan) error {
+	if *snapshotGCPlanJSON {
+		b, err := json.MarshalIndent(p, "", "  ")
+		if err != nil {
+			return errors.Wrap(err, "unable to serialize plan")
+		}
+
+		printStdout("%s\n", b)
+
+		return nil
+	}
+
+	printStdout("GC plan:\n")
+	printStdout("  Unused contents:        %v (%v)\n", p.UnusedContents, units.BytesStringBase10(p.UnusedBytes))
+	printStdout("  Packs to delete:        %v (%v)\n", p.DeletedPacks, units.BytesStringBase10(p.DeletedPackBytes))
+	printStdout("  Packs to rewrite:       %v (%v), rewriting %v contents (%v)\n",
+		p.RewrittenPacks, units.BytesStringBase10(p.RewrittenPackBytes), p.RewrittenContents, units.BytesStringBase10(p.RewrittenBytes))
+	printStdout("  Unused data retained:   %v\n", units.BytesStringBase10(p.RetainedUnusedBytes))
+	printStdout("  Reclaimed space:        %v\n", units.BytesStringBase10(p.ReclaimedBytes))
+	printStdout("  Requests:               %v DELETE, %v GET, %v PUT\n", p.DeleteRequests, p.GetRequests, p.PutRequests)
+	printStdout("  Egress:                 %v\n", units.BytesStringBase10(p.EgressBytes))
+	printStdout("  Estimated cost:         %.4f\n", p.EstimatedCost)
+	printStdout("  Estimated savings:      %.4f per month\n", p.EstimatedMonthlySavings)
+
+	for _, v := range p.Violations {
+		printStdout("  Limit exceeded:         %v\n", v)
+	}
+
+	return nil
+}
+
 func init() {
 	snapshotGCCommand.Action(repositoryAction(runSnapshotGCCommand))
 }
@@ -0,0 +1,51 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/snapshot/snapshotfs"
+)
+
+var (
+	graphCommand         = snapshotCommands.Command("graph", "Export the graph of objects referenced by a snapshot directory")
+	graphCommandPath     = graphCommand.Arg("object-path", "Path").Required().String()
+	graphCommandFormat   = graphCommand.Flag("format", "Output format").Default("dot").Enum("dot", "json")
+	graphCommandMaxDepth = graphCommand.Flag("max-depth", "Maximum depth of directories to include (0 means unlimited)").Default("0").Int()
+	graphCommandChunks   = graphCommand.Flag("chunks", "Include chunks of objects split into multiple contents").Bool()
+)
+
+func runGraphCommand(ctx context.Context, rep *repo.Repository) error {
+	oid, err := parseObjectID(ctx, rep, *graphCommandPath)
+	if err != nil {
+		return err
+	}
+
+	g, err := snapshotfs.BuildObjectGraph(ctx, rep, snapshotfs.DirectoryEntry(rep, oid, nil), snapshotfs.ObjectGraphOptions{
+		MaxDepth: *graphCommandMaxDepth,
+		Chunks:   *graphCommandChunks,
+	})
+	if err != nil {
+		return errors.Wrap(err, "unable to build object graph")
+	}
+
+	printStderr("Exporting %v nodes and %v edges\n", len(g.Nodes), len(g.Edges))
+
+	if *graphCommandFormat == "json" {
+		e := json.NewEncoder(os.Stdout)
+		e.SetIndent("", "  ")
+
+		return e.Encode(g)
+	}
+
+	return g.WriteDOT(os.Stdout)
+}
+
+func init() {
+	graphCommand.GetArg("object-path").HintAction(completeSnapshotRoots)
+	graphCommand.Action(repositoryAction(runGraphCommand))
+}
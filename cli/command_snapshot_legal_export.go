@@ -0,0 +1,93 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/fs"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/manifest"
+	"github.com/kopia/kopia/snapshot"
+	"github.com/kopia/kopia/snapshot/legalhold"
+	"github.com/kopia/kopia/snapshot/snapshotfs"
+)
+
+var (
+	legalExportCommand    = snapshotCommands.Command("legal-export", "Export a directory of a snapshot to a ZIP archive with a chain-of-custody report, suitable for legal holds and e-discovery.")
+	legalExportSnapshotID = legalExportCommand.Arg("id", "Snapshot ID").Required().String()
+	legalExportPath       = legalExportCommand.Flag("path", "Path of the directory within the snapshot to export").Default("/").String()
+	legalExportOutput     = legalExportCommand.Flag("output", "ZIP archive to create").Short('o').Required().String()
+	legalExportReport     = legalExportCommand.Flag("report", "File to write the chain-of-custody report to, defaults to the archive name with .report.json suffix").String()
+	legalExportCase       = legalExportCommand.Flag("case", "Identifier of the legal matter the export is made for").String()
+	legalExportOperator   = legalExportCommand.Flag("operator", "Person making the export, defaults to the current user").String()
+	legalExportSigningKey = legalExportCommand.Flag("signing-key", "Sign the report with the private key from the provided file").Envar("KOPIA_SIGNING_KEY").ExistingFile()
+)
+
+func init() {
+	legalExportCommand.GetArg("id").HintAction(completeSnapshotIDs)
+	legalExportCommand.Action(repositoryAction(runLegalExportCommand))
+}
+
+func runLegalExportCommand(ctx context.Context, rep *repo.Repository) error {
+	if err := loadSnapshotSigningKey(*legalExportSigningKey); err != nil {
+		return err
+	}
+
+	man, err := snapshot.LoadSnapshot(ctx, rep, manifest.ID(*legalExportSnapshotID))
+	if err != nil {
+		return err
+	}
+
+	root, err := snapshotfs.SnapshotRoot(rep, man)
+	if err != nil {
+		return err
+	}
+
+	e, err := getNestedEntry(ctx, root, strings.Split(*legalExportPath, "/"))
+	if err != nil {
+		return err
+	}
+
+	dir, ok := e.(fs.Directory)
+	if !ok {
+		return errors.Errorf("%v is not a directory", *legalExportPath)
+	}
+
+	reportFile := *legalExportReport
+	if reportFile == "" {
+		reportFile = *legalExportOutput + ".report.json"
+	}
+
+	printStderr("Exporting %v of snapshot %v of %v to %v ...\n", *legalExportPath, man.ID, man.Source, *legalExportOutput)
+
+	r, err := legalhold.Export(ctx, man, *legalExportPath, dir, *legalExportOutput, legalhold.Options{
+		Case:       *legalExportCase,
+		Operator:   firstNonEmpty(*legalExportOperator, rep.Username+"@"+rep.Hostname),
+		Host:       rep.Hostname,
+		SigningKey: snapshotSigningKey,
+	})
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "unable to serialize report")
+	}
+
+	if err := ioutil.WriteFile(reportFile, append(data, '\n'), 0o600); err != nil {
+		return errors.Wrap(err, "unable to write report")
+	}
+
+	printStderr("Exported %v files (%v bytes, sha256 %v), report written to %v.\n", len(r.Files), r.Archive.Size, r.Archive.SHA256, reportFile)
+
+	if !r.Verification.Verified {
+		return errors.Errorf("archive verification failed with %v errors, see the report for details", len(r.Verification.Errors))
+	}
+
+	return nil
+}
@@ -3,13 +3,16 @@ package cli
 import (
 	"context"
 	"fmt"
+	"net/url"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/pkg/errors"
 
 	"github.com/kopia/kopia/fs"
+	"github.com/kopia/kopia/internal/serverapi"
 	"github.com/kopia/kopia/internal/units"
 	"github.com/kopia/kopia/repo"
 	"github.com/kopia/kopia/repo/manifest"
@@ -25,13 +28,18 @@ var (
 	snapshotListIncludeIncomplete    = snapshotListCommand.Flag("incomplete", "Include incomplete.").Short('i').Bool()
 	snapshotListShowHumanReadable    = snapshotListCommand.Flag("human-readable", "Show human-readable units").Default("true").Bool()
 	snapshotListShowDelta            = snapshotListCommand.Flag("delta", "Include deltas.").Short('d').Bool()
+	snapshotListShowUploadStats      = snapshotListCommand.Flag("upload-stats", "Include sizes of new and deduplicated data, excluded files and errors.").Short('u').Bool()
 	snapshotListShowItemID           = snapshotListCommand.Flag("manifest-id", "Include manifest item ID.").Short('m').Bool()
 	snapshotListShowRetentionReasons = snapshotListCommand.Flag("retention", "Include retention reasons.").Default("true").Bool()
+	snapshotListShowTags             = snapshotListCommand.Flag("tags", "Include tags describing the source, such as the Docker volume.").Bool()
+	snapshotListShowHookOutput       = snapshotListCommand.Flag("hook-output", "Include data emitted by the hook run before the snapshot, such as the position in the database log.").Bool()
+	snapshotListShowNotes            = snapshotListCommand.Flag("notes", "Include notes and annotations attached to snapshots.").Default("true").Bool()
 	snapshotListShowModTime          = snapshotListCommand.Flag("mtime", "Include file mod time").Bool()
 	shapshotListShowOwner            = snapshotListCommand.Flag("owner", "Include owner").Bool()
 	snapshotListShowIdentical        = snapshotListCommand.Flag("show-identical", "Show identical snapshots").Short('l').Bool()
 	snapshotListShowAll              = snapshotListCommand.Flag("all", "Show all shapshots (not just current username/host)").Short('a').Bool()
 	maxResultsPerPath                = snapshotListCommand.Flag("max-results", "Maximum number of entries per source.").Default("100").Short('n').Int()
+	snapshotListOffline              = snapshotListCommand.Flag("offline", "List snapshots using the local manifest mirror without accessing the repository storage").Bool()
 )
 
 func findSnapshotsForSource(ctx context.Context, rep *repo.Repository, sourceInfo snapshot.SourceInfo) (manifestIDs []manifest.ID, relPath string, err error) {
@@ -89,6 +97,11 @@ func runSnapshotsCommand(ctx context.Context, rep *repo.Repository) error {
 		return err
 	}
 
+	if refreshed, ok := rep.Manifests.LoadedFromMirror(); ok {
+		printStderr("Listing snapshots from the local mirror refreshed %v ago (%v), recent changes may be missing.\n",
+			rep.Time().Sub(refreshed).Truncate(time.Second), formatTimestamp(refreshed))
+	}
+
 	manifests, err := snapshot.LoadSnapshots(ctx, rep, manifestIDs)
 	if err != nil {
 		return err
@@ -130,7 +143,7 @@ func outputManifestGroups(ctx context.Context, rep *repo.Repository, manifests [
 		if err != nil {
 			log(ctx).Warningf("unable to determine effective policy for %v", src)
 		} else {
-			pol.RetentionPolicy.ComputeRetentionReasons(snapshotGroup)
+			pol.RetentionPolicy.ComputeRetentionReasons(snapshotGroup, rep.Time())
 		}
 
 		if err := outputManifestFromSingleSource(ctx, rep, snapshotGroup, relPathParts); err != nil {
@@ -230,6 +243,30 @@ func outputManifestFromSingleSource(ctx context.Context, rep *repo.Repository, m
 			}
 		}
 
+		if m.Anomaly != nil {
+			bits = append(bits, fmt.Sprintf("anomaly:%.0f%%-modified", m.Anomaly.ModifiedPercent))
+		}
+
+		if n := len(m.CanaryChanges); n > 0 {
+			bits = append(bits, fmt.Sprintf("canaries:%v", n))
+		}
+
+		if *snapshotListShowUploadStats {
+			bits = append(bits, uploadStatsBits(m.Stats)...)
+		}
+
+		if *snapshotListShowTags {
+			bits = append(bits, tagBits(m.Tags)...)
+		}
+
+		if *snapshotListShowNotes {
+			bits = append(bits, tagBits(m.Annotations)...)
+		}
+
+		if *snapshotListShowHookOutput && len(m.HookOutput) > 0 {
+			bits = append(bits, "hook:"+string(m.HookOutput))
+		}
+
 		if *snapshotListShowRetentionReasons {
 			if len(m.RetentionReasons) > 0 {
 				bits = append(bits, "("+strings.Join(m.RetentionReasons, ",")+")")
@@ -237,7 +274,10 @@ func outputManifestFromSingleSource(ctx context.Context, rep *repo.Repository, m
 		}
 
 		oid := ent.(object.HasObjectID).ObjectID()
-		if !*snapshotListShowIdentical && oid == previousOID {
+		// annotated snapshots are shown even if identical to the previous one.
+		annotated := *snapshotListShowNotes && (len(m.Notes) > 0 || len(m.Annotations) > 0)
+
+		if !*snapshotListShowIdentical && oid == previousOID && !annotated {
 			elidedCount++
 
 			maxElidedTime = m.StartTime
@@ -258,6 +298,12 @@ func outputManifestFromSingleSource(ctx context.Context, rep *repo.Repository, m
 			strings.Join(bits, " "),
 		)
 
+		if *snapshotListShowNotes {
+			for _, n := range m.Notes {
+				fmt.Printf("    note %v %v: %v\n", formatTimestamp(n.Time), n.Author, n.Text)
+			}
+		}
+
 		count++
 
 		if m.IncompleteReason == "" {
@@ -270,6 +316,39 @@ func outputManifestFromSingleSource(ctx context.Context, rep *repo.Repository, m
 	return nil
 }
 
+func tagBits(tags map[string]string) []string {
+	var bits []string
+
+	for k, v := range tags {
+		bits = append(bits, k+"="+v)
+	}
+
+	sort.Strings(bits)
+
+	return bits
+}
+
+func uploadStatsBits(st snapshot.Stats) []string {
+	bits := []string{
+		"new:" + maybeHumanReadableBytes(*snapshotListShowHumanReadable, st.NewContentBytes),
+		"deduped:" + maybeHumanReadableBytes(*snapshotListShowHumanReadable, st.DedupedBytes),
+	}
+
+	if st.ModifiedFiles > 0 {
+		bits = append(bits, fmt.Sprintf("modified:%v", st.ModifiedFiles))
+	}
+
+	if n := st.ExcludedFileCount + st.ExcludedDirCount; n > 0 {
+		bits = append(bits, fmt.Sprintf("excluded:%v", n))
+	}
+
+	if st.ReadErrors > 0 {
+		bits = append(bits, fmt.Sprintf("errors:%v", st.ReadErrors))
+	}
+
+	return bits
+}
+
 func deltaBytes(b int64) string {
 	if b > 0 {
 		return "(+" + units.BytesStringBase10(b) + ")"
@@ -278,6 +357,127 @@ func deltaBytes(b int64) string {
 	return ""
 }
 
+// runSnapshotsCommandUsingDaemon lists snapshots of the current user and host using the daemon. Snapshots of
+// subdirectories of sources are listed locally, since that requires reading directories of the snapshots.
+func runSnapshotsCommandUsingDaemon(ctx context.Context, cli *serverapi.Client) error {
+	var sources serverapi.SourcesResponse
+	if err := cli.Get(ctx, "sources", &sources); err != nil {
+		return err
+	}
+
+	q := url.Values{}
+	q.Set("host", sources.LocalHost)
+	q.Set("userName", sources.LocalUsername)
+
+	if *snapshotListPath != "" {
+		si, err := snapshot.ParseSourceInfo(*snapshotListPath, sources.LocalHost, sources.LocalUsername)
+		if err != nil {
+			return errors.Errorf("invalid directory: '%s': %s", *snapshotListPath, err)
+		}
+
+		q = sourceQuery(si)
+	}
+
+	var resp serverapi.SnapshotsResponse
+	if err := cli.Get(ctx, "snapshots?"+q.Encode(), &resp); err != nil {
+		return err
+	}
+
+	if *snapshotListPath != "" && len(resp.Snapshots) == 0 {
+		return errDaemonUnsupported
+	}
+
+	var (
+		bySource = map[snapshot.SourceInfo][]*serverapi.Snapshot{}
+		srcs     []snapshot.SourceInfo
+	)
+
+	for _, s := range resp.Snapshots {
+		if bySource[s.Source] == nil {
+			srcs = append(srcs, s.Source)
+		}
+
+		bySource[s.Source] = append(bySource[s.Source], s)
+	}
+
+	sort.Slice(srcs, func(i, j int) bool {
+		return srcs[i].String() < srcs[j].String()
+	})
+
+	for i, src := range srcs {
+		if i > 0 {
+			fmt.Println()
+		}
+
+		fmt.Printf("%v\n", src)
+
+		outputDaemonSnapshotsFromSingleSource(bySource[src])
+	}
+
+	return nil
+}
+
+func outputDaemonSnapshotsFromSingleSource(snapshots []*serverapi.Snapshot) {
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].StartTime.Before(snapshots[j].StartTime)
+	})
+
+	if len(snapshots) > *maxResultsPerPath {
+		snapshots = snapshots[len(snapshots)-*maxResultsPerPath:]
+	}
+
+	var (
+		previousRoot  string
+		elidedCount   int
+		maxElidedTime time.Time
+	)
+
+	outputElided := func() {
+		if elidedCount > 0 {
+			fmt.Printf("  + %v identical snapshots until %v\n", elidedCount, formatTimestamp(maxElidedTime))
+		}
+	}
+
+	for _, s := range snapshots {
+		if s.IncompleteReason != "" {
+			continue
+		}
+
+		if s.RootEntry == previousRoot {
+			elidedCount++
+
+			maxElidedTime = s.StartTime
+
+			continue
+		}
+
+		previousRoot = s.RootEntry
+
+		outputElided()
+
+		elidedCount = 0
+
+		var bits []string
+
+		if s.Summary != nil {
+			bits = append(bits,
+				maybeHumanReadableBytes(*snapshotListShowHumanReadable, s.Summary.TotalFileSize),
+				fmt.Sprintf("files:%v", s.Summary.TotalFileCount),
+				fmt.Sprintf("dirs:%v", s.Summary.TotalDirCount))
+		}
+
+		if len(s.RetentionReasons) > 0 {
+			bits = append(bits, "("+strings.Join(s.RetentionReasons, ",")+")")
+		}
+
+		fmt.Printf("  %v %v %v\n", formatTimestamp(s.StartTime), s.RootEntry, strings.Join(bits, " "))
+	}
+
+	outputElided()
+}
+
 func init() {
-	snapshotListCommand.Action(repositoryAction(runSnapshotsCommand))
+	snapshotListCommand.GetArg("source").HintAction(completeSources)
+	snapshotListCommand.Action(daemonCapableAction(snapshotListCommand, runSnapshotsCommandUsingDaemon,
+		offlineCapableRepositoryAction(snapshotListOffline, runSnapshotsCommand)))
 }
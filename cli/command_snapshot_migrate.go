@@ -245,7 +245,7 @@ func migrateSingleSourceSnapshot(ctx context.Context, uploader *snapshotfs.Uploa
 
 	printStderr("\rmigrating snapshot of %v at %v\n", s, formatTimestamp(m.StartTime))
 
-	previous, err := findPreviousSnapshotManifest(ctx, destRepo, m.Source, &m.StartTime)
+	previous, err := snapshot.FindPreviousManifests(ctx, destRepo, m.Source, &m.StartTime)
 	if err != nil {
 		return err
 	}
@@ -19,6 +19,7 @@ func runSnapRestoreCommand(ctx context.Context, rep *repo.Repository) error {
 }
 
 func init() {
+	snapshotRestoreCommand.GetArg("id").HintAction(completeSnapshotIDs)
 	addRestoreFlags(snapshotRestoreCommand)
 	snapshotRestoreCommand.Action(repositoryAction(runSnapRestoreCommand))
 }
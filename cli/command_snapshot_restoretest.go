@@ -0,0 +1,106 @@
+package cli
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/units"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/snapshot"
+	"github.com/kopia/kopia/snapshot/restoretest"
+)
+
+var (
+	restoreTestCommand = snapshotCommands.Command("restore-test", "Verify that snapshots can be restored by fully reading randomly selected files from recent snapshots.")
+
+	restoreTestRunCommand         = restoreTestCommand.Command("run", "Read randomly selected files and record the result in the repository.").Default()
+	restoreTestRunFiles           = restoreTestRunCommand.Flag("files", "Number of files to read").Default("5").Int()
+	restoreTestRunRecentSnapshots = restoreTestRunCommand.Flag("recent-snapshots", "Number of most recent snapshots of each source to pick files from").Default("3").Int()
+	restoreTestRunSources         = restoreTestRunCommand.Flag("source", "Only test the provided sources").Strings()
+	restoreTestRunNoSave          = restoreTestRunCommand.Flag("no-save", "Don't record the result in the repository").Bool()
+
+	restoreTestListCommand = restoreTestCommand.Command("list", "List recorded results of restore tests.")
+	restoreTestListFiles   = restoreTestListCommand.Flag("files", "Show individual files").Short('f').Bool()
+)
+
+func init() {
+	restoreTestRunCommand.Action(repositoryAction(runRestoreTestRunCommand))
+	restoreTestListCommand.Action(repositoryAction(runRestoreTestListCommand))
+}
+
+func runRestoreTestRunCommand(ctx context.Context, rep *repo.Repository) error {
+	opt := restoretest.Options{
+		Files:           *restoreTestRunFiles,
+		RecentSnapshots: *restoreTestRunRecentSnapshots,
+	}
+
+	for _, s := range *restoreTestRunSources {
+		si, err := snapshot.ParseSourceInfo(s, rep.Hostname, rep.Username)
+		if err != nil {
+			return errors.Wrapf(err, "invalid source: %v", s)
+		}
+
+		opt.Sources = append(opt.Sources, si)
+	}
+
+	result, err := restoretest.Run(ctx, rep, opt)
+	if err != nil {
+		return err
+	}
+
+	printRestoreTestFiles(result)
+
+	if !*restoreTestRunNoSave {
+		if err := restoretest.Save(ctx, rep, result); err != nil {
+			return err
+		}
+	}
+
+	if len(result.Files) == 0 {
+		printStderr("No files found in recent snapshots.\n")
+		return nil
+	}
+
+	if n := result.FailedCount(); n > 0 {
+		return errors.Errorf("%v of %v files could not be restored", n, len(result.Files))
+	}
+
+	printStderr("All %v files were restored successfully.\n", len(result.Files))
+
+	return nil
+}
+
+func runRestoreTestListCommand(ctx context.Context, rep *repo.Repository) error {
+	results, err := restoretest.List(ctx, rep)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range results {
+		status := "ok"
+		if r.FailedCount() > 0 {
+			status = "FAILED"
+		}
+
+		printStdout("%v %-6v %v files, %v failed, took %v\n", formatTimestamp(r.StartTime), status, len(r.Files), r.FailedCount(), r.EndTime.Sub(r.StartTime).Truncate(time.Millisecond))
+
+		if *restoreTestListFiles {
+			printRestoreTestFiles(r)
+		}
+	}
+
+	return nil
+}
+
+func printRestoreTestFiles(r *restoretest.Result) {
+	for _, f := range r.Files {
+		if f.Error != "" {
+			printStdout("  FAILED %v %v %v: %v\n", f.Source, formatTimestamp(f.SnapshotTime), f.Path, f.Error)
+			continue
+		}
+
+		printStdout("  ok     %v %v %v (%v in %v)\n", f.Source, formatTimestamp(f.SnapshotTime), f.Path, units.BytesStringBase10(f.BytesRead), f.Duration.Truncate(time.Millisecond))
+	}
+}
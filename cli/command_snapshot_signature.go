@@ -0,0 +1,108 @@
+package cli
+
+import (
+	"context"
+	"crypto/ed25519"
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/snapshot"
+)
+
+var (
+	generateSigningKeyCommand = snapshotCommands.Command("generate-signing-key", "Generate a key for signing snapshots and print its public key.")
+	generateSigningKeyOutput  = generateSigningKeyCommand.Flag("output", "File to write the private key to").Required().String()
+
+	verifySignaturesCommand     = snapshotCommands.Command("verify-signatures", "Verify that snapshots were signed with trusted keys.")
+	verifySignaturesTrustedKeys = verifySignaturesCommand.Flag("trusted-key", "Public key of a host authorized to create snapshots (can be repeated)").Required().Strings()
+	verifySignaturesAllSources  = verifySignaturesCommand.Flag("all-sources", "Verify all snapshots").Bool()
+	verifySignaturesSources     = verifySignaturesCommand.Flag("sources", "Verify the provided sources").Strings()
+)
+
+// snapshotSigningKey is the key used to sign snapshots created by this process, if any.
+var snapshotSigningKey ed25519.PrivateKey
+
+func loadSnapshotSigningKey(fname string) error {
+	if fname == "" {
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(fname) //nolint:gosec
+	if err != nil {
+		return errors.Wrap(err, "unable to read signing key")
+	}
+
+	snapshotSigningKey, err = snapshot.ParseSigningKey(data)
+
+	return err
+}
+
+func runGenerateSigningKeyCommand(ctx context.Context) error {
+	key, keyPEM, err := snapshot.GenerateSigningKey()
+	if err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(*generateSigningKeyOutput, keyPEM, 0600); err != nil {
+		return errors.Wrap(err, "unable to write signing key")
+	}
+
+	printStderr("Wrote signing key to %v, its public key is:\n", *generateSigningKeyOutput)
+	printStdout("%v\n", snapshot.FormatPublicKey(key.Public().(ed25519.PublicKey)))
+
+	return nil
+}
+
+func parseTrustedKeys(keys []string) ([]ed25519.PublicKey, error) {
+	var trusted []ed25519.PublicKey
+
+	for _, s := range keys {
+		k, err := snapshot.ParsePublicKey(s)
+		if err != nil {
+			return nil, err
+		}
+
+		trusted = append(trusted, k)
+	}
+
+	return trusted, nil
+}
+
+func runVerifySignaturesCommand(ctx context.Context, rep *repo.Repository) error {
+	trusted, err := parseTrustedKeys(*verifySignaturesTrustedKeys)
+	if err != nil {
+		return err
+	}
+
+	manifests, err := loadSourceManifests(ctx, rep, *verifySignaturesAllSources, *verifySignaturesSources)
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+
+	for _, man := range manifests {
+		if err := man.VerifySignature(trusted); err != nil {
+			failed++
+
+			printStdout("%v %v %v: %v\n", man.ID, man.Source, formatTimestamp(man.StartTime), err)
+
+			continue
+		}
+
+		printStdout("%v %v %v: signed by %v\n", man.ID, man.Source, formatTimestamp(man.StartTime), snapshot.FormatPublicKey(man.Signature.PublicKey))
+	}
+
+	if failed > 0 {
+		return errors.Errorf("%v of %v snapshots are not signed with trusted keys", failed, len(manifests))
+	}
+
+	return nil
+}
+
+func init() {
+	generateSigningKeyCommand.Action(noRepositoryAction(runGenerateSigningKeyCommand))
+	verifySignaturesCommand.Action(repositoryAction(runVerifySignaturesCommand))
+}
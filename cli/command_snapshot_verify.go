@@ -203,7 +203,7 @@ func runVerifyCommand(ctx context.Context, rep *repo.Repository) error {
 }
 
 func enqueueRootsToVerify(ctx context.Context, v *verifier, rep *repo.Repository) error {
-	manifests, err := loadSourceManifests(ctx, rep, *verifyCommandSources)
+	manifests, err := loadSourceManifests(ctx, rep, *verifyCommandAllSources, *verifyCommandSources)
 	if err != nil {
 		return err
 	}
@@ -243,10 +243,10 @@ func enqueueRootsToVerify(ctx context.Context, v *verifier, rep *repo.Repository
 	return nil
 }
 
-func loadSourceManifests(ctx context.Context, rep *repo.Repository, sources []string) ([]*snapshot.Manifest, error) {
+func loadSourceManifests(ctx context.Context, rep *repo.Repository, all bool, sources []string) ([]*snapshot.Manifest, error) {
 	var manifestIDs []manifest.ID
 
-	if *verifyCommandAllSources {
+	if all {
 		man, err := snapshot.ListSnapshotManifests(ctx, rep, nil)
 		if err != nil {
 			return nil, err
@@ -0,0 +1,138 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/snapshot"
+	"github.com/kopia/kopia/snapshot/volumesnapshot"
+)
+
+var (
+	snapshotVolumeCommand          = snapshotCommands.Command("volume", "Snapshot a volume mounted in a Kubernetes pod from a sidecar container or Job, identified by its namespace and claim, printing progress as JSON lines.")
+	snapshotVolumePath             = snapshotVolumeCommand.Arg("path", "Path where the volume is mounted").Required().String()
+	snapshotVolumeCluster          = snapshotVolumeCommand.Flag("cluster", "Name of the cluster, overrides "+volumesnapshot.ClusterEnvar).String()
+	snapshotVolumeNamespace        = snapshotVolumeCommand.Flag("namespace", "Namespace of the volume claim, overrides "+volumesnapshot.NamespaceEnvar).String()
+	snapshotVolumeClaim            = snapshotVolumeCommand.Flag("claim", "Name of the persistent volume claim, overrides "+volumesnapshot.ClaimEnvar).String()
+	snapshotVolumeLabels           = snapshotVolumeCommand.Flag("label", "Label of the snapshot in addition to labels from "+volumesnapshot.LabelsFileEnvar+" (KEY=VALUE)").Strings()
+	snapshotVolumeDescription      = snapshotVolumeCommand.Flag("description", "Free-form snapshot description.").String()
+	snapshotVolumeProgressInterval = snapshotVolumeCommand.Flag("progress-interval", "Interval of progress events").Default("10s").Duration()
+	snapshotVolumeSigningKey       = snapshotVolumeCommand.Flag("signing-key", "Sign snapshots with the private key from the provided file").Envar("KOPIA_SIGNING_KEY").String()
+)
+
+func init() {
+	snapshotVolumeCommand.Action(noRepositoryAction(runSnapshotVolumeCommand))
+}
+
+// runSnapshotVolumeCommand snapshots the volume, reporting all failures as the final event and exit code
+// instead of an error message, so that they can be handled by controllers.
+func runSnapshotVolumeCommand(ctx context.Context) error {
+	enc := json.NewEncoder(os.Stdout)
+
+	opt := &volumesnapshot.Options{
+		Path:             *snapshotVolumePath,
+		Description:      *snapshotVolumeDescription,
+		ProgressInterval: *snapshotVolumeProgressInterval,
+		OnEvent: func(e *volumesnapshot.Event) {
+			enc.Encode(e) //nolint:errcheck
+		},
+	}
+
+	final := snapshotVolume(ctx, opt)
+
+	if final.ExitCode != volumesnapshot.ExitSuccess {
+		os.Exit(final.ExitCode) //nolint:gocritic
+	}
+
+	return nil
+}
+
+func snapshotVolume(ctx context.Context, opt *volumesnapshot.Options) *volumesnapshot.Event {
+	fail := func(err error, exitCode int) *volumesnapshot.Event {
+		var src snapshot.SourceInfo
+		if opt.Identity != nil {
+			src = opt.Identity.SourceInfo(opt.Path)
+		}
+
+		e := volumesnapshot.FailedEvent(src, err, exitCode)
+		opt.OnEvent(e)
+
+		return e
+	}
+
+	id, err := volumeIdentityFromFlags()
+	opt.Identity = id
+
+	if err != nil {
+		return fail(err, volumesnapshot.ExitInvalidConfiguration)
+	}
+
+	if err = loadSnapshotSigningKey(*snapshotVolumeSigningKey); err != nil {
+		return fail(err, volumesnapshot.ExitInvalidConfiguration)
+	}
+
+	opt.SigningKey = snapshotSigningKey
+
+	rep, err := openRepository(ctx, nil, true)
+	if err != nil {
+		if _, serr := os.Stat(repositoryConfigFileName()); os.IsNotExist(serr) {
+			return fail(errors.Wrap(err, "open repository"), volumesnapshot.ExitInvalidConfiguration)
+		}
+
+		return fail(errors.Wrap(err, "open repository"), volumesnapshot.ExitFailed)
+	}
+
+	defer rep.Close(ctx) //nolint:errcheck
+
+	// the pod is terminated with SIGTERM, after which the snapshot is saved as incomplete.
+	cancel := make(chan struct{})
+	opt.Cancel = cancel
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+
+	defer func() {
+		signal.Stop(sig)
+		close(sig)
+	}()
+
+	go func() {
+		if _, ok := <-sig; ok {
+			close(cancel)
+		}
+	}()
+
+	return volumesnapshot.Run(ctx, rep, opt)
+}
+
+func volumeIdentityFromFlags() (*volumesnapshot.Identity, error) {
+	id, err := volumesnapshot.IdentityFromEnv(os.Getenv)
+	if err != nil {
+		return nil, err
+	}
+
+	id.Cluster = firstNonEmpty(*snapshotVolumeCluster, id.Cluster)
+	id.Namespace = firstNonEmpty(*snapshotVolumeNamespace, id.Namespace)
+	id.Claim = firstNonEmpty(*snapshotVolumeClaim, id.Claim)
+
+	for _, kv := range *snapshotVolumeLabels {
+		p := strings.Index(kv, "=")
+		if p <= 0 {
+			return nil, errors.Errorf("invalid label %q, must be KEY=VALUE", kv)
+		}
+
+		if id.Labels == nil {
+			id.Labels = map[string]string{}
+		}
+
+		id.Labels[kv[0:p]] = kv[p+1:]
+	}
+
+	return id, id.Validate()
+}
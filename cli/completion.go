@@ -0,0 +1,158 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+
+	"github.com/kopia/kopia/internal/ospath"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/snapshot"
+	"github.com/kopia/kopia/snapshot/policy"
+)
+
+const fishCompletionScript = `function __complete_%[1]v
+    set -l args (commandline -opc)
+    %[1]v --completion-bash $args[2..-1] (commandline -ct)
+end
+
+complete -c %[1]v -f -a '(__complete_%[1]v)'
+`
+
+var _ = app.Flag("completion-script-fish", "Generate completion script for fish.").Hidden().PreAction(generateFishCompletionScript).Bool()
+
+func generateFishCompletionScript(_ *kingpin.ParseContext) error {
+	fmt.Printf(fishCompletionScript, app.Name)
+	os.Exit(0)
+
+	return nil
+}
+
+// Hints of positional arguments are attached in init() of the commands rather than in the declarations,
+// because referencing completion helpers there changes the order of initialization and thereby of arguments.
+
+// withCompletionRepository opens the connected repository without prompting for password and invokes
+// the provided callback. Completions are best-effort so any errors result in no completions.
+func withCompletionRepository(cb func(ctx context.Context, rep *repo.Repository) []string) []string {
+	ctx := rootContext()
+
+	pass, ok := repo.GetPersistedPassword(ctx, repositoryConfigFileName())
+	if !ok {
+		if *password == "" {
+			return nil
+		}
+
+		pass = strings.TrimSpace(*password)
+	}
+
+	rep, err := repo.Open(ctx, repositoryConfigFileName(), pass, nil)
+	if err != nil {
+		return nil
+	}
+
+	defer rep.Close(ctx) //nolint:errcheck
+
+	return cb(ctx, rep)
+}
+
+// completeRepositoryProfiles returns the list of repository configuration files in the default config directory.
+func completeRepositoryProfiles() []string {
+	matches, _ := filepath.Glob(filepath.Join(ospath.ConfigDir(), "*.config"))
+	sort.Strings(matches)
+
+	return matches
+}
+
+// completeSnapshotIDs returns manifest IDs of all snapshots in the repository.
+func completeSnapshotIDs() []string {
+	return withCompletionRepository(func(ctx context.Context, rep *repo.Repository) []string {
+		ids, err := snapshot.ListSnapshotManifests(ctx, rep, nil)
+		if err != nil {
+			return nil
+		}
+
+		var result []string
+		for _, id := range ids {
+			result = append(result, string(id))
+		}
+
+		sort.Strings(result)
+
+		return result
+	})
+}
+
+// completeSnapshotRoots returns root object IDs of all snapshots in the repository, which can be used
+// as the starting point of object paths.
+func completeSnapshotRoots() []string {
+	return withCompletionRepository(func(ctx context.Context, rep *repo.Repository) []string {
+		ids, err := snapshot.ListSnapshotManifests(ctx, rep, nil)
+		if err != nil {
+			return nil
+		}
+
+		manifests, err := snapshot.LoadSnapshots(ctx, rep, ids)
+		if err != nil {
+			return nil
+		}
+
+		uniq := map[string]bool{}
+		for _, m := range manifests {
+			if oid := m.RootObjectID(); oid != "" {
+				uniq[oid.String()] = true
+			}
+		}
+
+		return sortedKeys(uniq)
+	})
+}
+
+// completeSources returns all snapshot sources in the repository.
+func completeSources() []string {
+	return withCompletionRepository(func(ctx context.Context, rep *repo.Repository) []string {
+		sources, err := snapshot.ListSources(ctx, rep)
+		if err != nil {
+			return nil
+		}
+
+		uniq := map[string]bool{}
+		for _, src := range sources {
+			uniq[src.String()] = true
+		}
+
+		return sortedKeys(uniq)
+	})
+}
+
+// completePolicyTargets returns all targets that have policies defined in the repository.
+func completePolicyTargets() []string {
+	return withCompletionRepository(func(ctx context.Context, rep *repo.Repository) []string {
+		policies, err := policy.ListPolicies(ctx, rep)
+		if err != nil {
+			return nil
+		}
+
+		uniq := map[string]bool{}
+		for _, p := range policies {
+			uniq[p.Target().String()] = true
+		}
+
+		return sortedKeys(uniq)
+	})
+}
+
+func sortedKeys(m map[string]bool) []string {
+	var result []string
+	for k := range m {
+		result = append(result, k)
+	}
+
+	sort.Strings(result)
+
+	return result
+}
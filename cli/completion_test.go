@@ -0,0 +1,42 @@
+package cli
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestArgumentOrder(t *testing.T) {
+	cases := map[string][]string{
+		"mount":            {"path", "mountPoint"},
+		"restore":          {"source-path", "target-path"},
+		"snapshot restore": {"id", "target-path"},
+		"diff":             {"object-path1", "object-path2"},
+		"cache pin":        {"object-path"},
+	}
+
+	for cmd, want := range cases {
+		names := strings.Fields(cmd)
+
+		c := app.GetCommand(names[0])
+		for _, n := range names[1:] {
+			if c != nil {
+				c = c.GetCommand(n)
+			}
+		}
+
+		if c == nil {
+			t.Fatalf("command %q not found", cmd)
+		}
+
+		var got []string
+
+		for _, a := range c.Model().Args {
+			got = append(got, a.Name)
+		}
+
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("unexpected arguments of %q: %v, want %v", cmd, got, want)
+		}
+	}
+}
@@ -1,12 +1,14 @@
 package cli
 
 import (
+	"bufio"
 	"context"
 	"fmt"
 	"os"
 	"os/signal"
 	"path/filepath"
 	"runtime"
+	"strings"
 
 	"github.com/pkg/errors"
 
@@ -15,6 +17,7 @@ import (
 	"github.com/kopia/kopia/fs/loggingfs"
 	"github.com/kopia/kopia/internal/ospath"
 	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/blob/chaos"
 )
 
 var (
@@ -25,7 +28,11 @@ var (
 	enableListCaching  = app.Flag("list-caching", "Enables caching of list results (disable with --no-list-caching)").Default("true").Hidden().Bool()
 	metricsListenAddr  = app.Flag("metrics-listen-addr", "Expose Prometheus metrics on a given host:port").Hidden().String()
 
-	configPath = app.Flag("config-file", "Specify the config file to use.").Default(defaultConfigFileName()).Envar("KOPIA_CONFIG_PATH").String()
+	injectStorageErrorRate        = app.Flag("inject-storage-error-rate", "Probability of storage operations failing, for testing only").Hidden().Float64()
+	injectStoragePartialWriteRate = app.Flag("inject-storage-partial-write-rate", "Probability of storage writes being partial, for testing only").Hidden().Float64()
+	injectStorageMaxLatency       = app.Flag("inject-storage-max-latency", "Maximum random latency added to storage operations, for testing only").Hidden().Duration()
+
+	configPath = app.Flag("config-file", "Specify the config file to use.").Default(defaultConfigFileName()).HintAction(completeRepositoryProfiles).Envar("KOPIA_CONFIG_PATH").String()
 )
 
 func printStderr(msg string, args ...interface{}) {
@@ -36,13 +43,35 @@ func printStdout(msg string, args ...interface{}) {
 	fmt.Fprintf(os.Stdout, msg, args...) //nolint:errcheck
 }
 
+// askForConfirmation prints the question and returns true if the user answered yes on standard input.
+func askForConfirmation(question string) bool {
+	printStderr("%v (y/N) ", question)
+
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
+	default:
+		return false
+	}
+}
+
+// onCtrlC invokes the provided function when Ctrl-C is pressed, which is expected to stop the operation
+// in progress cleanly. Pressing Ctrl-C again exits the process immediately, which is safe because
+// repository contents only become visible once pack and index blobs have been completely written.
 func onCtrlC(f func()) {
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt)
 
 	go func() {
 		<-c
+		printStderr("\nStopping, press Ctrl-C again to exit immediately...\n")
 		f()
+
+		<-c
+		printStderr("\nExiting without waiting for operation to complete.\n")
+		os.Exit(1)
 	}()
 }
 
@@ -88,10 +117,20 @@ func applyOptionsFromFlags(ctx context.Context, opts *repo.Options) *repo.Option
 		opts.TraceStorage = log(ctx).Debugf
 	}
 
+	if faults := (chaos.Options{
+		ErrorRate:        *injectStorageErrorRate,
+		PartialWriteRate: *injectStoragePartialWriteRate,
+		MaxLatency:       *injectStorageMaxLatency,
+	}); faults.IsEnabled() {
+		opts.StorageFaults = &faults
+	}
+
 	if *traceObjectManager {
 		opts.ObjectManagerOptions.Trace = log(ctx).Debugf
 	}
 
+	opts.BandwidthLimiter = storageBandwidthLimiter
+
 	return opts
 }
 
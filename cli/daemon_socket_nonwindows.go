@@ -0,0 +1,18 @@
+// +build !windows
+
+package cli
+
+import (
+	"net"
+	"syscall"
+)
+
+// listenDaemonSocket listens on the daemon control socket, which is created accessible only to the current user
+// since the daemon API is unauthenticated. The umask is set before the socket is created, so that there's no window
+// in which other users could connect.
+func listenDaemonSocket(socketPath string) (net.Listener, error) {
+	oldMask := syscall.Umask(0077) //nolint:gomnd
+	defer syscall.Umask(oldMask)
+
+	return net.Listen("unix", socketPath)
+}
@@ -0,0 +1,11 @@
+package cli
+
+import (
+	"net"
+)
+
+// listenDaemonSocket listens on the daemon control socket, whose access is controlled by the permissions
+// of the directory it's created in.
+func listenDaemonSocket(socketPath string) (net.Listener, error) {
+	return net.Listen("unix", socketPath)
+}
@@ -2,18 +2,29 @@ package cli
 
 import (
 	"context"
+	"regexp"
 	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 
 	"github.com/kopia/kopia/fs"
 	"github.com/kopia/kopia/repo"
 	"github.com/kopia/kopia/repo/object"
+	"github.com/kopia/kopia/snapshot"
 	"github.com/kopia/kopia/snapshot/snapshotfs"
 )
 
+// snapshotPathPattern matches object paths of the form <source>@<selector>[/<path>], where the selector
+// is 'latest' or the date, optionally followed by the time, as of which the latest snapshot of the source is used.
+var snapshotPathPattern = regexp.MustCompile(`^(.+)@(latest|\d{4}-\d{2}-\d{2}(?:T\d{2}:\d{2}(?::\d{2})?)?)(/.*)?$`)
+
 // ParseObjectID interprets the given ID string and returns corresponding object.ID.
 func parseObjectID(ctx context.Context, rep *repo.Repository, id string) (object.ID, error) {
+	if m := snapshotPathPattern.FindStringSubmatch(id); m != nil {
+		return parseSnapshotPath(ctx, rep, m[1], m[2], m[3])
+	}
+
 	parts := strings.Split(id, "/")
 
 	oid, err := object.ParseID(parts[0])
@@ -43,14 +54,13 @@ func getNestedEntry(ctx context.Context, startingDir fs.Entry, parts []string) (
 			return nil, errors.Errorf("entry not found %q: parent is not a directory", part)
 		}
 
-		entries, err := dir.Readdir(ctx)
-		if err != nil {
-			return nil, err
+		e, err := dir.Child(ctx, part)
+		if errors.Is(err, fs.ErrEntryNotFound) {
+			return nil, errors.Errorf("entry not found: %q", part)
 		}
 
-		e := entries.FindByName(part)
-		if e == nil {
-			return nil, errors.Errorf("entry not found: %q", part)
+		if err != nil {
+			return nil, err
 		}
 
 		current = e
@@ -67,3 +77,83 @@ func parseNestedObjectID(ctx context.Context, startingDir fs.Entry, parts []stri
 
 	return e.(object.HasObjectID).ObjectID(), nil
 }
+
+// parseSnapshotPath returns the ID of the object at the provided path within the snapshot of the source
+// matching the selector.
+func parseSnapshotPath(ctx context.Context, rep *repo.Repository, source, selector, path string) (object.ID, error) {
+	src, err := snapshot.ParseSourceInfo(source, rep.Hostname, rep.Username)
+	if err != nil {
+		return "", errors.Wrapf(err, "invalid source %q", source)
+	}
+
+	cutoff, err := snapshotSelectorCutoff(selector)
+	if err != nil {
+		return "", err
+	}
+
+	manifests, err := snapshot.ListSnapshots(ctx, rep, src)
+	if err != nil {
+		return "", errors.Wrapf(err, "unable to list snapshots of %v", src)
+	}
+
+	man := latestSnapshotBefore(manifests, cutoff)
+	if man == nil {
+		return "", errors.Errorf("no snapshots of %v matching %q", src, selector)
+	}
+
+	log(ctx).Debugf("using snapshot of %v taken at %v", src, formatTimestamp(man.StartTime))
+
+	if path == "" {
+		return man.RootObjectID(), nil
+	}
+
+	return parseNestedObjectID(ctx, snapshotfs.DirectoryEntry(rep, man.RootObjectID(), nil), strings.Split(path, "/"))
+}
+
+// snapshotSelectorCutoff returns the time before which snapshots match the selector, zero time for 'latest'.
+// Dates and times select snapshots taken until the end of the given day, minute or second in the local time zone.
+func snapshotSelectorCutoff(selector string) (time.Time, error) {
+	if selector == "latest" {
+		return time.Time{}, nil
+	}
+
+	for _, l := range []struct {
+		layout string
+		period time.Duration
+	}{
+		{"2006-01-02T15:04:05", time.Second},
+		{"2006-01-02T15:04", time.Minute},
+	} {
+		if t, err := time.ParseInLocation(l.layout, selector, time.Local); err == nil {
+			return t.Add(l.period), nil
+		}
+	}
+
+	t, err := time.ParseInLocation("2006-01-02", selector, time.Local)
+	if err != nil {
+		return time.Time{}, errors.Errorf("invalid snapshot selector %q, expected 'latest' or date", selector)
+	}
+
+	return t.AddDate(0, 0, 1), nil
+}
+
+// latestSnapshotBefore returns the latest complete snapshot started before the cutoff time, which is ignored if zero.
+func latestSnapshotBefore(manifests []*snapshot.Manifest, cutoff time.Time) *snapshot.Manifest {
+	var result *snapshot.Manifest
+
+	for _, m := range manifests {
+		if m.IncompleteReason != "" || m.RootEntry == nil {
+			continue
+		}
+
+		if !cutoff.IsZero() && !m.StartTime.Before(cutoff) {
+			continue
+		}
+
+		if result == nil || m.StartTime.After(result.StartTime) {
+			result = m
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,86 @@
+package cli
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kopia/kopia/snapshot"
+)
+
+func TestSnapshotPathPattern(t *testing.T) {
+	cases := []struct {
+		input                    string
+		source, selector, nested string
+	}{
+		{"/home/user@latest", "/home/user", "latest", ""},
+		{"/home/user@latest/docs/a.txt", "/home/user", "latest", "/docs/a.txt"},
+		{"user@host:/data@2020-05-01/x", "user@host:/data", "2020-05-01", "/x"},
+		{"/data@2020-05-01T10:30", "/data", "2020-05-01T10:30", ""},
+	}
+
+	for _, tc := range cases {
+		m := snapshotPathPattern.FindStringSubmatch(tc.input)
+		if m == nil {
+			t.Fatalf("%q did not match", tc.input)
+		}
+
+		if m[1] != tc.source || m[2] != tc.selector || m[3] != tc.nested {
+			t.Errorf("unexpected match of %q: %q", tc.input, m[1:])
+		}
+	}
+
+	for _, input := range []string{"kffbb7c28ea6c34d6cbe555d1cf80faa9/subdir", "user@host:/data", "/data@yesterday"} {
+		if snapshotPathPattern.MatchString(input) {
+			t.Errorf("unexpected match of %q", input)
+		}
+	}
+}
+
+func TestLatestSnapshotBefore(t *testing.T) {
+	day := func(d, h int) time.Time {
+		return time.Date(2020, 5, d, h, 0, 0, 0, time.Local)
+	}
+
+	root := &snapshot.DirEntry{ObjectID: "k1234"}
+	manifests := []*snapshot.Manifest{
+		{ID: "a", StartTime: day(1, 10), RootEntry: root},
+		{ID: "b", StartTime: day(2, 10), RootEntry: root},
+		{ID: "c", StartTime: day(2, 20), RootEntry: root, IncompleteReason: "canceled"},
+		{ID: "d", StartTime: day(3, 10), RootEntry: root},
+		{ID: "e", StartTime: time.Date(2020, 5, 4, 15, 4, 30, 0, time.Local), RootEntry: root},
+		{ID: "f", StartTime: time.Date(2020, 5, 4, 15, 5, 10, 0, time.Local), RootEntry: root},
+	}
+
+	cases := []struct {
+		selector string
+		want     string
+	}{
+		{"latest", "f"},
+		{"2020-05-02", "b"},
+		{"2020-05-02T09:00", "a"},
+		{"2020-05-02T10:00:00", "b"},
+		{"2020-05-01", "a"},
+		{"2020-04-30", ""},
+		// times select snapshots until the end of the given minute or second.
+		{"2020-05-04T15:04", "e"},
+		{"2020-05-04T15:04:29", "d"},
+		{"2020-05-04T15:04:30", "e"},
+		{"2020-05-04T15:05", "f"},
+	}
+
+	for _, tc := range cases {
+		cutoff, err := snapshotSelectorCutoff(tc.selector)
+		if err != nil {
+			t.Fatalf("unable to parse %q: %v", tc.selector, err)
+		}
+
+		got := ""
+		if m := latestSnapshotBefore(manifests, cutoff); m != nil {
+			got = string(m.ID)
+		}
+
+		if got != tc.want {
+			t.Errorf("unexpected snapshot for %q: %q, want %q", tc.selector, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package cli
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo/blob/throttling"
+)
+
+// requestLimitsFlag is a repeatable flag parsing limits of storage requests in CLASS=PER_SECOND[:MAX_CONCURRENT] format.
+type requestLimitsFlag map[string]throttling.RequestLimit
+
+func (f requestLimitsFlag) Set(v string) error {
+	eq := strings.Index(v, "=")
+	if eq < 0 {
+		return errors.Errorf("invalid request limit %q, expected CLASS=PER_SECOND[:MAX_CONCURRENT]", v)
+	}
+
+	var (
+		l   throttling.RequestLimit
+		err error
+	)
+
+	class, rate := v[0:eq], v[eq+1:]
+
+	if p := strings.Index(rate, ":"); p >= 0 {
+		if l.MaxConcurrent, err = strconv.Atoi(rate[p+1:]); err != nil {
+			return errors.Wrapf(err, "invalid maximum number of concurrent requests in %q", v)
+		}
+
+		rate = rate[0:p]
+	}
+
+	if rate != "" {
+		if l.PerSecond, err = strconv.ParseFloat(rate, 64); err != nil {
+			return errors.Wrapf(err, "invalid number of requests per second in %q", v)
+		}
+	}
+
+	if err := throttling.ValidateRequestLimit(class, l); err != nil {
+		return err
+	}
+
+	f[class] = l
+
+	return nil
+}
+
+func (f requestLimitsFlag) String() string {
+	var parts []string
+
+	for class, l := range f {
+		parts = append(parts, class+"="+formatRequestLimit(l))
+	}
+
+	return strings.Join(parts, " ")
+}
+
+func (f requestLimitsFlag) IsCumulative() bool {
+	return true
+}
+
+func formatRequestLimit(l throttling.RequestLimit) string {
+	s := strconv.FormatFloat(l.PerSecond, 'f', -1, 64)
+
+	if l.MaxConcurrent > 0 {
+		s += ":" + strconv.Itoa(l.MaxConcurrent)
+	}
+
+	return s
+}
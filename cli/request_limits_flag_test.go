@@ -0,0 +1,38 @@
+package cli
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/kopia/kopia/repo/blob/throttling"
+)
+
+func TestRequestLimitsFlag(t *testing.T) {
+	f := requestLimitsFlag{}
+
+	for _, v := range []string{"get=100:16", "list=0.5", "delete=:4", "get=200"} {
+		if err := f.Set(v); err != nil {
+			t.Errorf("unable to parse %q: %v", v, err)
+		}
+	}
+
+	want := requestLimitsFlag{
+		"get":    {PerSecond: 200},
+		"list":   {PerSecond: 0.5},
+		"delete": {MaxConcurrent: 4},
+	}
+
+	if !reflect.DeepEqual(f, want) {
+		t.Errorf("unexpected limits: %v, want %v", f, want)
+	}
+
+	for _, v := range []string{"get", "copy=1", "get=x", "get=1:x", "put=-1"} {
+		if err := f.Set(v); err == nil {
+			t.Errorf("invalid limit %q was accepted", v)
+		}
+	}
+
+	if got, want := formatRequestLimit(throttling.RequestLimit{PerSecond: 2.5, MaxConcurrent: 3}), "2.5:3"; got != want {
+		t.Errorf("unexpected format: %v, want %v", got, want)
+	}
+}
@@ -3,6 +3,7 @@ package cli
 import (
 	"bytes"
 	"compress/gzip"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -20,6 +21,7 @@ import (
 var (
 	commonIndentJSON bool
 	commonUnzip      bool
+	commonHexDump    bool
 
 	timeZone = app.Flag("timezone", "Format time according to specified time zone (local, utc, original or time zone name)").Default("local").Hidden().String()
 )
@@ -27,13 +29,14 @@ var (
 func setupShowCommand(cmd *kingpin.CmdClause) {
 	cmd.Flag("json", "Pretty-print JSON content").Short('j').BoolVar(&commonIndentJSON)
 	cmd.Flag("unzip", "Transparently unzip the content").Short('z').BoolVar(&commonUnzip)
+	cmd.Flag("hex", "Print hexadecimal dump of the content").BoolVar(&commonHexDump)
 }
 
 func showContent(rd io.Reader) error {
-	return showContentWithFlags(rd, commonUnzip, commonIndentJSON)
+	return showContentWithFlags(rd, commonUnzip, commonIndentJSON, commonHexDump)
 }
 
-func showContentWithFlags(rd io.Reader, unzip, indentJSON bool) error {
+func showContentWithFlags(rd io.Reader, unzip, indentJSON, hexDump bool) error {
 	if unzip {
 		gz, err := gzip.NewReader(rd)
 		if err != nil {
@@ -57,6 +60,15 @@ func showContentWithFlags(rd io.Reader, unzip, indentJSON bool) error {
 		rd = ioutil.NopCloser(&buf2)
 	}
 
+	if hexDump {
+		d := hex.Dumper(os.Stdout)
+		defer d.Close() //nolint:errcheck
+
+		_, err := iocopy.Copy(d, rd)
+
+		return err
+	}
+
 	if _, err := iocopy.Copy(os.Stdout, rd); err != nil {
 		return err
 	}
@@ -0,0 +1,54 @@
+package cli
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/snapshot"
+	"github.com/kopia/kopia/snapshot/policy"
+)
+
+// handleSuspiciousSnapshot reports signs of ransomware found in the snapshot and returns an error if it must not be saved.
+func handleSuspiciousSnapshot(ctx context.Context, pol *policy.Policy, man *snapshot.Manifest) error {
+	reasons := man.SuspicionReasons()
+
+	for _, r := range reasons {
+		log(ctx).Warningf("snapshot of %v is suspicious, %v", man.Source, r)
+	}
+
+	rejected := pol.RejectsSnapshot(man) && !*snapshotCreateAcceptAnomaly
+
+	if command := *snapshotCreateNotifySuspicious; command != "" {
+		if err := notifySuspiciousSnapshot(ctx, command, man, reasons, !rejected); err != nil {
+			log(ctx).Warningf("unable to notify about suspicious snapshot: %v", err)
+		}
+	}
+
+	if rejected {
+		return errors.Errorf("snapshot of %v not saved because it is suspicious, use --accept-anomaly to save it", man.Source)
+	}
+
+	return nil
+}
+
+// notifySuspiciousSnapshot invokes the provided command, which may include arguments separated by spaces,
+// passing the details of the suspicious snapshot in environment variables.
+func notifySuspiciousSnapshot(ctx context.Context, command string, man *snapshot.Manifest, reasons []string, saved bool) error {
+	args := strings.Fields(command)
+
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...) //nolint:gosec
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(),
+		"KOPIA_SNAPSHOT_SOURCE="+man.Source.String(),
+		"KOPIA_SNAPSHOT_SAVED="+strconv.FormatBool(saved),
+		"KOPIA_SUSPICION_REASONS="+strings.Join(reasons, "\n"),
+	)
+
+	return errors.Wrapf(cmd.Run(), "error running %v", args[0])
+}
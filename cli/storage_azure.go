@@ -3,6 +3,7 @@ package cli
 import (
 	"context"
 
+	"github.com/pkg/errors"
 	"gopkg.in/alecthomas/kingpin.v2"
 
 	"github.com/kopia/kopia/repo/blob"
@@ -18,12 +19,19 @@ func init() {
 		func(cmd *kingpin.CmdClause) {
 			cmd.Flag("container", "Name of the Azure blob container").Required().StringVar(&azOptions.Container)
 			cmd.Flag("storage-account", "Azure storage account name(overrides AZURE_STORAGE_ACCOUNT environment variable)").Required().Envar("AZURE_STORAGE_ACCOUNT").StringVar(&azOptions.StorageAccount)
-			cmd.Flag("storage-key", "Azure storage account key(overrides AZURE_STORAGE_KEY environment variable)").Required().Envar("AZURE_STORAGE_KEY").StringVar(&azOptions.StorageKey)
+			cmd.Flag("storage-key", "Azure storage account key(overrides AZURE_STORAGE_KEY environment variable)").Envar("AZURE_STORAGE_KEY").StringVar(&azOptions.StorageKey)
+			cmd.Flag("credentials-provider", "How to obtain credentials: 'shared-key' uses the storage key, 'msi' uses the managed identity, 'exec' runs --credentials-command").Default(azure.CredentialsSharedKey).EnumVar(&azOptions.CredentialsProvider, azure.CredentialsSharedKey, azure.CredentialsMSI, azure.CredentialsExec)
+			cmd.Flag("credentials-command", "Command printing JSON with OAuth token, invoked again before it expires").StringVar(&azOptions.CredentialsCommand)
 			cmd.Flag("prefix", "Prefix to use for objects in the bucket").StringVar(&azOptions.Prefix)
 			cmd.Flag("max-download-speed", "Limit the download speed.").PlaceHolder("BYTES_PER_SEC").IntVar(&azOptions.MaxDownloadSpeedBytesPerSecond)
+			setupTransportFlags(cmd, &azOptions.TransportOptions)
 			cmd.Flag("max-upload-speed", "Limit the upload speed.").PlaceHolder("BYTES_PER_SEC").IntVar(&azOptions.MaxUploadSpeedBytesPerSecond)
 		},
 		func(ctx context.Context, isNew bool) (blob.Storage, error) {
+			if azOptions.CredentialsProvider == azure.CredentialsSharedKey && azOptions.StorageKey == "" {
+				return nil, errors.New("--storage-key is required with shared key credentials")
+			}
+
 			return azure.New(ctx, &azOptions)
 		},
 	)
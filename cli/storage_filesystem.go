@@ -65,6 +65,8 @@ func init() {
 			cmd.Flag("file-mode", "File mode for newly created files (0600)").PlaceHolder("MODE").StringVar(&connectFileMode)
 			cmd.Flag("dir-mode", "Mode of newly directory files (0700)").PlaceHolder("MODE").StringVar(&connectDirMode)
 			cmd.Flag("flat", "Use flat directory structure").BoolVar(&connectFlat)
+			cmd.Flag("smb", "Adapt to SMB/CIFS mounts (replacing files, retrying while the share is disconnected, case-insensitive names)").BoolVar(&options.SMB)
+			cmd.Flag("basic-operations-only", "Avoid exclusive file creation, directory syncs and file time updates unsupported by some NAS servers").BoolVar(&options.BasicOperationsOnly)
 		},
 		connect)
 }
@@ -24,7 +24,9 @@ func init() {
 			cmd.Flag("prefix", "Prefix to use for objects in the bucket").StringVar(&options.Prefix)
 			cmd.Flag("read-only", "Use read-only GCS scope to prevent write access").BoolVar(&options.ReadOnly)
 			cmd.Flag("credentials-file", "Use the provided JSON file with credentials").ExistingFileVar(&options.ServiceAccountCredentialsFile)
+			cmd.Flag("credentials-command", "Command printing JSON with OAuth token, invoked again before it expires").StringVar(&options.CredentialsCommand)
 			cmd.Flag("max-download-speed", "Limit the download speed.").PlaceHolder("BYTES_PER_SEC").IntVar(&options.MaxDownloadSpeedBytesPerSecond)
+			setupTransportFlags(cmd, &options.TransportOptions)
 			cmd.Flag("max-upload-speed", "Limit the upload speed.").PlaceHolder("BYTES_PER_SEC").IntVar(&options.MaxUploadSpeedBytesPerSecond)
 			cmd.Flag("embed-credentials", "Embed GCS credentials JSON in Kopia configuration").BoolVar(&embedCredentials)
 		},
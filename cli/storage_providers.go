@@ -9,8 +9,8 @@ import (
 	"github.com/kopia/kopia/repo/blob"
 )
 
-// RegisterStorageConnectFlags registers repository subcommand to connect to a storage
-// or create new repository in a given storage.
+// RegisterStorageConnectFlags registers repository subcommand to connect to a storage,
+// create new repository or synchronize the repository to a given storage.
 func RegisterStorageConnectFlags(
 	name, description string,
 	flags func(*kingpin.CmdClause),
@@ -56,4 +56,30 @@ func RegisterStorageConnectFlags(
 
 		return runRepairCommandWithStorage(ctx, st)
 	})
+
+	// Set up 'sync-to' subcommand
+	cc = syncCommand.Command(name, "Synchronize repository to "+description)
+	flags(cc)
+	cc.Action(func(_ *kingpin.ParseContext) error {
+		ctx := rootContext()
+		// the destination may not exist yet.
+		st, err := connect(ctx, true)
+		if err != nil {
+			return errors.Wrap(err, "can't connect to storage")
+		}
+
+		defer st.Close(ctx) //nolint:errcheck
+
+		return runSyncCommandWithStorage(ctx, st)
+	})
+}
+
+// setupTransportFlags registers flags customizing HTTP transport of storage providers accessed over HTTP(S).
+func setupTransportFlags(cmd *kingpin.CmdClause, o *blob.TransportOptions) {
+	cmd.Flag("proxy", "HTTP(S) proxy URL (defaults to HTTPS_PROXY environment variable)").PlaceHolder("URL").StringVar(&o.ProxyURL)
+	cmd.Flag("root-ca-file", "PEM file with additional trusted certificate authorities").ExistingFileVar(&o.RootCAFile)
+	cmd.Flag("tls-min-version", "Minimum TLS version").EnumVar(&o.TLSMinVersion, "1.0", "1.1", "1.2", "1.3")
+	cmd.Flag("ip-family", "Only connect using IPv4 or IPv6 addresses").EnumVar(&o.IPFamily, "ipv4", "ipv6")
+	cmd.Flag("resolve", "Connect to the given address instead of resolving the host name (can be repeated)").PlaceHolder("HOST=ADDRESS").StringMapVar(&o.HostOverrides)
+	cmd.Flag("dns-server", "DNS server used to resolve host names instead of the system resolver").PlaceHolder("HOST[:PORT]").StringVar(&o.DNSServer)
 }
@@ -0,0 +1,41 @@
+package cli
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"gopkg.in/alecthomas/kingpin.v2"
+
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/blob/redundant"
+)
+
+func init() {
+	var (
+		primaryConfigFile   string
+		secondaryConfigFile string
+	)
+
+	RegisterStorageConnectFlags(
+		"redundant",
+		"two storage locations, writing every blob to both",
+		func(cmd *kingpin.CmdClause) {
+			cmd.Flag("primary-storage", "JSON file with configuration of storage serving reads").Required().ExistingFileVar(&primaryConfigFile)
+			cmd.Flag("secondary-storage", "JSON file with configuration of storage serving reads when the primary storage fails").Required().ExistingFileVar(&secondaryConfigFile)
+		},
+		func(ctx context.Context, isNew bool) (blob.Storage, error) {
+			var opt redundant.Options
+
+			var err error
+
+			if opt.Primary, err = loadStorageConfig(primaryConfigFile); err != nil {
+				return nil, errors.Wrap(err, "invalid primary storage")
+			}
+
+			if opt.Secondary, err = loadStorageConfig(secondaryConfigFile); err != nil {
+				return nil, errors.Wrap(err, "invalid secondary storage")
+			}
+
+			return redundant.New(ctx, &opt)
+		})
+}
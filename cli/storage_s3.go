@@ -3,6 +3,7 @@ package cli
 import (
 	"context"
 
+	"github.com/pkg/errors"
 	"gopkg.in/alecthomas/kingpin.v2"
 
 	"github.com/kopia/kopia/repo/blob"
@@ -19,16 +20,24 @@ func init() {
 			cmd.Flag("bucket", "Name of the S3 bucket").Required().StringVar(&s3options.BucketName)
 			cmd.Flag("endpoint", "Endpoint to use").Default("s3.amazonaws.com").StringVar(&s3options.Endpoint)
 			cmd.Flag("region", "S3 Region").Default("").StringVar(&s3options.Region)
-			cmd.Flag("access-key", "Access key ID (overrides AWS_ACCESS_KEY_ID environment variable)").Required().Envar("AWS_ACCESS_KEY_ID").StringVar(&s3options.AccessKeyID)
-			cmd.Flag("secret-access-key", "Secret access key (overrides AWS_SECRET_ACCESS_KEY environment variable)").Required().Envar("AWS_SECRET_ACCESS_KEY").StringVar(&s3options.SecretAccessKey)
+			cmd.Flag("access-key", "Access key ID (overrides AWS_ACCESS_KEY_ID environment variable)").Envar("AWS_ACCESS_KEY_ID").StringVar(&s3options.AccessKeyID)
+			cmd.Flag("secret-access-key", "Secret access key (overrides AWS_SECRET_ACCESS_KEY environment variable)").Envar("AWS_SECRET_ACCESS_KEY").StringVar(&s3options.SecretAccessKey)
 			cmd.Flag("session-token", "Session token (overrides AWS_SESSION_TOKEN environment variable)").Envar("AWS_SESSION_TOKEN").StringVar(&s3options.SessionToken)
+			cmd.Flag("credentials-provider", "How to obtain credentials: 'static' uses access keys, 'iam' uses IAM roles (including IRSA), 'exec' runs --credentials-command").Default(s3.CredentialsStatic).EnumVar(&s3options.CredentialsProvider, s3.CredentialsStatic, s3.CredentialsIAM, s3.CredentialsExec)
+			cmd.Flag("credentials-command", "Command printing JSON credentials, invoked again before they expire").StringVar(&s3options.CredentialsCommand)
 			cmd.Flag("prefix", "Prefix to use for objects in the bucket").StringVar(&s3options.Prefix)
 			cmd.Flag("disable-tls", "Disable TLS security (HTTPS)").BoolVar(&s3options.DoNotUseTLS)
 			cmd.Flag("disable-tls-verification", "Disable TLS (HTTPS) certificate verification").BoolVar(&s3options.DoNotVerifyTLS)
+			setupTransportFlags(cmd, &s3options.TransportOptions)
 			cmd.Flag("max-download-speed", "Limit the download speed.").PlaceHolder("BYTES_PER_SEC").IntVar(&s3options.MaxDownloadSpeedBytesPerSecond)
 			cmd.Flag("max-upload-speed", "Limit the upload speed.").PlaceHolder("BYTES_PER_SEC").IntVar(&s3options.MaxUploadSpeedBytesPerSecond)
+			cmd.Flag("resumable-upload-part-size", "Upload blobs larger than the given size in parts, resuming failed uploads from the last completed part (minimum 5MiB).").PlaceHolder("BYTES").IntVar(&s3options.ResumableUploadPartSize)
 		},
 		func(ctx context.Context, isNew bool) (blob.Storage, error) {
+			if s3options.CredentialsProvider == s3.CredentialsStatic && (s3options.AccessKeyID == "" || s3options.SecretAccessKey == "") {
+				return nil, errors.New("--access-key and --secret-access-key are required with static credentials")
+			}
+
 			return s3.New(ctx, &s3options)
 		},
 	)
@@ -0,0 +1,72 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+	"gopkg.in/alecthomas/kingpin.v2"
+
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/blob/split"
+)
+
+func init() {
+	var (
+		metadataConfigFile string
+		dataConfigFile     string
+		dataPrefixes       []string
+	)
+
+	RegisterStorageConnectFlags(
+		"split",
+		"two storage locations, keeping metadata and data separately",
+		func(cmd *kingpin.CmdClause) {
+			cmd.Flag("metadata-storage", "JSON file with configuration of storage holding indexes and metadata").Required().ExistingFileVar(&metadataConfigFile)
+			cmd.Flag("data-storage", "JSON file with configuration of storage holding file contents").Required().ExistingFileVar(&dataConfigFile)
+			cmd.Flag("data-prefix", "Prefix of blobs kept in data storage (can be repeated)").Hidden().StringsVar(&dataPrefixes)
+		},
+		func(ctx context.Context, isNew bool) (blob.Storage, error) {
+			var opt split.Options
+
+			var err error
+
+			if opt.Metadata, err = loadStorageConfig(metadataConfigFile); err != nil {
+				return nil, errors.Wrap(err, "invalid metadata storage")
+			}
+
+			if opt.Data, err = loadStorageConfig(dataConfigFile); err != nil {
+				return nil, errors.Wrap(err, "invalid data storage")
+			}
+
+			for _, p := range dataPrefixes {
+				opt.DataPrefixes = append(opt.DataPrefixes, blob.ID(p))
+			}
+
+			return split.New(ctx, &opt)
+		})
+}
+
+// loadStorageConfig reads storage configuration from a JSON file, which can either be a repository
+// configuration file or just its 'storage' section, such as {"type":"filesystem","config":{"path":"/repo"}}.
+func loadStorageConfig(fname string) (blob.ConnectionInfo, error) {
+	data, err := ioutil.ReadFile(fname) //nolint:gosec
+	if err != nil {
+		return blob.ConnectionInfo{}, errors.Wrap(err, "unable to read storage configuration")
+	}
+
+	var lc repo.LocalConfig
+	if err := lc.Load(bytes.NewReader(data)); err == nil && lc.Storage.Type != "" {
+		return lc.Storage, nil
+	}
+
+	var ci blob.ConnectionInfo
+	if err := json.Unmarshal(data, &ci); err != nil {
+		return blob.ConnectionInfo{}, errors.Wrap(err, "unable to parse storage configuration")
+	}
+
+	return ci, nil
+}
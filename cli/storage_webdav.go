@@ -23,6 +23,7 @@ func init() {
 			cmd.Flag("flat", "Use flat directory structure").BoolVar(&connectFlat)
 			cmd.Flag("webdav-username", "WebDAV username").Envar("KOPIA_WEBDAV_USERNAME").StringVar(&options.Username)
 			cmd.Flag("webdav-password", "WebDAV password").Envar("KOPIA_WEBDAV_PASSWORD").StringVar(&options.Password)
+			setupTransportFlags(cmd, &options.TransportOptions)
 		},
 		func(ctx context.Context, isNew bool) (blob.Storage, error) {
 			wo := options
@@ -0,0 +1,266 @@
+// Package archivefs implements read-only virtual filesystem abstraction on top of tar and zip archives.
+package archivefs
+
+import (
+	"context"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/fs"
+	"github.com/kopia/kopia/repo/logging"
+)
+
+var log = logging.GetContextLoggerFunc("kopia/archivefs")
+
+// ErrUnsupportedFormat is returned when the archive format can't be determined from its name.
+var ErrUnsupportedFormat = errors.New("unsupported archive format")
+
+// Archive represents an opened archive.
+type Archive struct {
+	root    *directory
+	closers []io.Closer
+
+	// duplicity volumes store full file contents under 'snapshot/'
+	duplicity bool
+
+	// chunks of files split across duplicity volumes, by file name.
+	duplicityChunks map[string][]duplicityChunk
+}
+
+// Root returns the root directory of the archive.
+func (a *Archive) Root() fs.Directory {
+	return a.root
+}
+
+// Close releases all resources associated with the archive.
+func (a *Archive) Close() error {
+	var lastErr error
+
+	for _, c := range a.closers {
+		if err := c.Close(); err != nil {
+			lastErr = err
+		}
+	}
+
+	return lastErr
+}
+
+// IsSupported determines whether the provided file name has a supported archive extension.
+func IsSupported(fname string) bool {
+	return formatFromName(fname) != ""
+}
+
+func formatFromName(fname string) string {
+	lower := strings.ToLower(fname)
+
+	for _, suffix := range []string{".difftar.gz", ".difftar", ".tar.gz", ".tgz", ".tar", ".zip"} {
+		if strings.HasSuffix(lower, suffix) {
+			return suffix
+		}
+	}
+
+	return ""
+}
+
+// Open opens the archive at the given path.
+// Supported formats are .tar, .tar.gz, .tgz, .zip and unencrypted duplicity full backups (.difftar, .difftar.gz),
+// which are opened using their first volume and include the contents of all volumes.
+// The first stripComponents leading path elements are removed from all archive entries,
+// similar to 'tar --strip-components'.
+func Open(ctx context.Context, fname string, stripComponents int) (*Archive, error) {
+	fi, err := os.Stat(fname)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &Archive{
+		root: newDirectory(path.Base(fname), os.ModeDir|0o755, fi.ModTime(), fs.OwnerInfo{}), //nolint:gomnd
+	}
+
+	switch formatFromName(fname) {
+	case ".zip":
+		err = a.readZip(fname, stripComponents)
+	case ".tar":
+		err = a.readTar(ctx, fname, false, stripComponents)
+	case ".tar.gz", ".tgz":
+		err = a.readTar(ctx, fname, true, stripComponents)
+	case ".difftar", ".difftar.gz":
+		a.duplicity = true
+		err = a.readDuplicityVolumes(ctx, fname, stripComponents)
+	default:
+		return nil, ErrUnsupportedFormat
+	}
+
+	if err != nil {
+		a.Close() //nolint:errcheck
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// add inserts the provided entry at the given slash-separated path, creating parent directories as needed.
+func (a *Archive) add(entryPath string, stripComponents int, newEntry func(name string) fs.Entry) {
+	parts := strings.Split(strings.Trim(path.Clean("/"+entryPath), "/"), "/")
+	if len(parts) <= stripComponents || parts[len(parts)-1] == "" {
+		return
+	}
+
+	parts = parts[stripComponents:]
+
+	dir := a.root
+
+	for _, p := range parts[0 : len(parts)-1] {
+		dir = dir.subdir(p)
+	}
+
+	e := newEntry(parts[len(parts)-1])
+
+	// directory entries may be reported after their children, preserve already-added children.
+	if d, ok := e.(*directory); ok {
+		if existing, ok := dir.children[d.name].(*directory); ok {
+			existing.entry = d.entry
+			return
+		}
+	}
+
+	dir.children[e.Name()] = e
+}
+
+type entry struct {
+	name    string
+	mode    os.FileMode
+	size    int64
+	modTime time.Time
+	owner   fs.OwnerInfo
+}
+
+func (e *entry) Name() string {
+	return e.name
+}
+
+func (e *entry) IsDir() bool {
+	return e.mode.IsDir()
+}
+
+func (e *entry) Mode() os.FileMode {
+	return e.mode
+}
+
+func (e *entry) ModTime() time.Time {
+	return e.modTime
+}
+
+func (e *entry) Size() int64 {
+	return e.size
+}
+
+func (e *entry) Sys() interface{} {
+	return nil
+}
+
+func (e *entry) Owner() fs.OwnerInfo {
+	return e.owner
+}
+
+type directory struct {
+	entry
+
+	children map[string]fs.Entry
+}
+
+func newDirectory(name string, mode os.FileMode, modTime time.Time, owner fs.OwnerInfo) *directory {
+	return &directory{
+		entry:    entry{name: name, mode: mode | os.ModeDir, modTime: modTime, owner: owner},
+		children: map[string]fs.Entry{},
+	}
+}
+
+func (d *directory) subdir(name string) *directory {
+	if sd, ok := d.children[name].(*directory); ok {
+		return sd
+	}
+
+	sd := newDirectory(name, 0o755, d.modTime, d.owner) //nolint:gomnd
+	d.children[name] = sd
+
+	return sd
+}
+
+func (d *directory) Summary() *fs.DirectorySummary {
+	return nil
+}
+
+func (d *directory) Child(ctx context.Context, name string) (fs.Entry, error) {
+	if e, ok := d.children[name]; ok {
+		return e, nil
+	}
+
+	return nil, fs.ErrEntryNotFound
+}
+
+func (d *directory) Readdir(ctx context.Context) (fs.Entries, error) {
+	var result fs.Entries
+
+	for _, e := range d.children {
+		result = append(result, e)
+	}
+
+	result.Sort()
+
+	return result, nil
+}
+
+type file struct {
+	entry
+
+	open func() (io.ReadSeeker, io.Closer, error)
+}
+
+func (f *file) Open(ctx context.Context) (fs.Reader, error) {
+	rs, closer, err := f.open()
+	if err != nil {
+		return nil, err
+	}
+
+	return &fileReader{rs, closer, f}, nil
+}
+
+type fileReader struct {
+	io.ReadSeeker
+	closer io.Closer
+	f      *file
+}
+
+func (r *fileReader) Close() error {
+	if r.closer == nil {
+		return nil
+	}
+
+	return r.closer.Close()
+}
+
+func (r *fileReader) Entry() (fs.Entry, error) {
+	return r.f, nil
+}
+
+type symlink struct {
+	entry
+
+	target string
+}
+
+func (s *symlink) Readlink(ctx context.Context) (string, error) {
+	return s.target, nil
+}
+
+var (
+	_ fs.Directory = (*directory)(nil)
+	_ fs.File      = (*file)(nil)
+	_ fs.Symlink   = (*symlink)(nil)
+)
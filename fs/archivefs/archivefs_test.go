@@ -0,0 +1,272 @@
+package archivefs
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kopia/kopia/fs"
+	"github.com/kopia/kopia/internal/testlogging"
+)
+
+var testFiles = map[string]string{
+	"top/a.txt":        "contents of a",
+	"top/sub/b.txt":    "contents of b",
+	"top/sub/deep/c":   "c",
+	"top/empty-file":   "",
+	"top/another/file": "another",
+}
+
+func writeTestTar(t *testing.T, w io.Writer) {
+	tw := tar.NewWriter(w)
+
+	for name, contents := range testFiles {
+		if err := tw.WriteHeader(&tar.Header{
+			Name:     name,
+			Typeflag: tar.TypeReg,
+			Mode:     0o644,
+			Size:     int64(len(contents)),
+			ModTime:  time.Unix(1500000000, 0),
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := io.WriteString(tw, contents); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := tw.WriteHeader(&tar.Header{Name: "top/link", Typeflag: tar.TypeSymlink, Linkname: "a.txt", Mode: 0o777}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeTestZip(t *testing.T, w io.Writer) {
+	zw := zip.NewWriter(w)
+
+	for name, contents := range testFiles {
+		fw, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := io.WriteString(fw, contents); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func createArchive(t *testing.T, dir, name string, write func(w io.Writer)) string {
+	fname := filepath.Join(dir, name)
+
+	f, err := os.Create(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer f.Close()
+
+	write(f)
+
+	return fname
+}
+
+func TestArchives(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	dir, err := ioutil.TempDir("", "archivefs")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	archives := []string{
+		createArchive(t, dir, "test.tar", func(w io.Writer) { writeTestTar(t, w) }),
+		createArchive(t, dir, "test.tar.gz", func(w io.Writer) {
+			gz := gzip.NewWriter(w)
+			writeTestTar(t, gz)
+			gz.Close()
+		}),
+		createArchive(t, dir, "test.zip", func(w io.Writer) { writeTestZip(t, w) }),
+	}
+
+	for _, fname := range archives {
+		a, err := Open(ctx, fname, 1)
+		if err != nil {
+			t.Fatalf("unable to open %v: %v", fname, err)
+		}
+
+		for name, contents := range testFiles {
+			verifyFile(ctx, t, a.Root(), name[len("top/"):], contents)
+		}
+
+		if err := a.Close(); err != nil {
+			t.Errorf("close error: %v", err)
+		}
+	}
+
+	if _, err := Open(ctx, filepath.Join(dir, "test.tar"), 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Open(ctx, archives[0]+".unknown", 0); err == nil {
+		t.Errorf("expected error when opening unknown archive")
+	}
+}
+
+func verifyFile(ctx context.Context, t *testing.T, root fs.Directory, name, contents string) {
+	t.Helper()
+
+	var e fs.Entry = root
+
+	for _, part := range strings.Split(name, "/") {
+		d, ok := e.(fs.Directory)
+		if !ok {
+			t.Fatalf("%v is not a directory", e.Name())
+		}
+
+		var err error
+		if e, err = d.Child(ctx, part); err != nil {
+			t.Fatalf("unable to find %v: %v", name, err)
+		}
+	}
+
+	f, ok := e.(fs.File)
+	if !ok {
+		t.Fatalf("%v is not a file", name)
+	}
+
+	rd, err := f.Open(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer rd.Close()
+
+	b, err := ioutil.ReadAll(rd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(b) != contents {
+		t.Errorf("invalid contents of %v: %q, want %q", name, b, contents)
+	}
+
+	if len(contents) > 1 {
+		if _, err := rd.Seek(1, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+
+		b, _ = ioutil.ReadAll(rd)
+		if string(b) != contents[1:] {
+			t.Errorf("invalid contents of %v after seek: %q, want %q", name, b, contents[1:])
+		}
+	}
+}
+
+func writeDuplicityVolume(t *testing.T, w io.Writer, files map[string]string) {
+	tw := tar.NewWriter(w)
+
+	for name, contents := range files {
+		if err := tw.WriteHeader(&tar.Header{
+			Name:     name,
+			Typeflag: tar.TypeReg,
+			Mode:     0o644,
+			Size:     int64(len(contents)),
+			ModTime:  time.Unix(1500000000, 0),
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := io.WriteString(tw, contents); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDuplicityVolumes(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	dir, err := ioutil.TempDir("", "archivefs")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	const base = "duplicity-full.20200102T030405Z"
+
+	vol1 := createArchive(t, dir, base+".vol1.difftar", func(w io.Writer) {
+		writeDuplicityVolume(t, w, map[string]string{
+			"snapshot/a.txt":          "contents of a",
+			"multivol_snapshot/big/1": "first part,",
+		})
+	})
+
+	createArchive(t, dir, base+".vol2.difftar.gz", func(w io.Writer) {
+		gz := gzip.NewWriter(w)
+		writeDuplicityVolume(t, gz, map[string]string{
+			"multivol_snapshot/big/2": "second part,",
+			"multivol_snapshot/big/3": "third part",
+			"snapshot/sub/b.txt":      "contents of b",
+		})
+		gz.Close()
+	})
+
+	a, err := Open(ctx, vol1, 0)
+	if err != nil {
+		t.Fatalf("unable to open %v: %v", vol1, err)
+	}
+
+	verifyFile(ctx, t, a.Root(), "a.txt", "contents of a")
+	verifyFile(ctx, t, a.Root(), "sub/b.txt", "contents of b")
+	verifyFile(ctx, t, a.Root(), "big", "first part,second part,third part")
+
+	if err := a.Close(); err != nil {
+		t.Errorf("close error: %v", err)
+	}
+
+	// manifest lists a volume that is not present.
+	createArchive(t, dir, base+".manifest", func(w io.Writer) {
+		io.WriteString(w, "Hostname host\nVolume 1:\n    StartingPath   .\nVolume 2:\nVolume 3:\n")
+	})
+
+	if _, err := Open(ctx, vol1, 0); err == nil {
+		t.Errorf("expected error opening backup with missing volume")
+	}
+
+	os.Remove(filepath.Join(dir, base+".manifest"))
+
+	// chunk of a file split across volumes is missing.
+	vol1 = createArchive(t, dir, "duplicity-full.20200103T030405Z.vol1.difftar", func(w io.Writer) {
+		writeDuplicityVolume(t, w, map[string]string{
+			"multivol_snapshot/big/1": "first part,",
+			"multivol_snapshot/big/3": "third part",
+		})
+	})
+
+	if _, err := Open(ctx, vol1, 0); err == nil {
+		t.Errorf("expected error opening backup with missing chunk")
+	}
+}
@@ -0,0 +1,222 @@
+package archivefs
+
+import (
+	"archive/tar"
+	"bufio"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// duplicityMultivolPrefix is the prefix of chunks of files that were split across volumes,
+// chunk N of file F is stored as 'multivol_snapshot/F/N'.
+const duplicityMultivolPrefix = "multivol_snapshot/"
+
+var (
+	duplicityVolumeRegexp         = regexp.MustCompile(`^(.*)\.vol(\d+)\.difftar(?:\.gz)?$`)
+	duplicityManifestVolumeRegexp = regexp.MustCompile(`^Volume (\d+):`)
+)
+
+// duplicityChunk is a part of a file split across volumes.
+type duplicityChunk struct {
+	index   int
+	header  *tar.Header
+	section *io.SectionReader
+}
+
+// readDuplicityVolumes reads all volumes of the duplicity backup whose first volume is provided,
+// failing if any of the volumes is missing.
+func (a *Archive) readDuplicityVolumes(ctx context.Context, fname string, stripComponents int) error {
+	volumes, err := duplicityVolumes(fname)
+	if err != nil {
+		return err
+	}
+
+	a.duplicityChunks = map[string][]duplicityChunk{}
+
+	for _, v := range volumes {
+		log(ctx).Debugf("reading duplicity volume %v", v)
+
+		if err := a.readTar(ctx, v, strings.HasSuffix(strings.ToLower(v), ".gz"), stripComponents); err != nil {
+			return errors.Wrapf(err, "unable to read volume %v", filepath.Base(v))
+		}
+	}
+
+	return a.addDuplicityMultivolFiles(stripComponents)
+}
+
+// duplicityVolumes returns the volumes of the backup, which are determined from the manifest
+// when it's available and the volume files present otherwise.
+func duplicityVolumes(fname string) ([]string, error) {
+	m := duplicityVolumeRegexp.FindStringSubmatch(fname)
+	if m == nil || m[2] != "1" {
+		return nil, errors.Errorf("%v is not the first volume of a duplicity backup", filepath.Base(fname))
+	}
+
+	base := m[1]
+
+	count, err := duplicityManifestVolumeCount(base + ".manifest")
+	if err != nil {
+		return nil, err
+	}
+
+	var result []string
+
+	for n := 1; count == 0 || n <= count; n++ {
+		v, err := findDuplicityVolume(base + ".vol" + strconv.Itoa(n))
+		if err != nil {
+			return nil, err
+		}
+
+		if v == "" {
+			if count == 0 {
+				break
+			}
+
+			return nil, errors.Errorf("missing volume %v of %v", n, count)
+		}
+
+		result = append(result, v)
+	}
+
+	return result, nil
+}
+
+// findDuplicityVolume returns the name of the compressed or uncompressed volume or an empty string if it doesn't exist.
+func findDuplicityVolume(prefix string) (string, error) {
+	for _, suffix := range []string{".difftar.gz", ".difftar"} {
+		_, err := os.Stat(prefix + suffix)
+
+		switch {
+		case err == nil:
+			return prefix + suffix, nil
+		case !os.IsNotExist(err):
+			return "", errors.Wrap(err, "unable to find volume")
+		}
+	}
+
+	return "", nil
+}
+
+// duplicityManifestVolumeCount returns the number of volumes listed in the manifest or 0 if the manifest is not present.
+func duplicityManifestVolumeCount(fname string) (int, error) {
+	f, err := os.Open(fname) //nolint:gosec
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+
+	if err != nil {
+		return 0, errors.Wrap(err, "unable to open manifest")
+	}
+	defer f.Close() //nolint:errcheck
+
+	count := 0
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		if m := duplicityManifestVolumeRegexp.FindStringSubmatch(s.Text()); m != nil {
+			if n, _ := strconv.Atoi(m[1]); n > count {
+				count = n
+			}
+		}
+	}
+
+	return count, errors.Wrap(s.Err(), "unable to read manifest")
+}
+
+// addDuplicityChunk records a chunk of a file split across volumes, returning false if the entry is not a chunk.
+func (a *Archive) addDuplicityChunk(f *os.File, h *tar.Header, dataOffset int64) bool {
+	if !strings.HasPrefix(h.Name, duplicityMultivolPrefix) || h.Typeflag == tar.TypeDir {
+		return false
+	}
+
+	name := strings.TrimPrefix(h.Name, duplicityMultivolPrefix)
+
+	p := strings.LastIndex(name, "/")
+	if p < 0 {
+		return false
+	}
+
+	index, err := strconv.Atoi(name[p+1:])
+	if err != nil {
+		return false
+	}
+
+	a.duplicityChunks[name[0:p]] = append(a.duplicityChunks[name[0:p]], duplicityChunk{
+		index:   index,
+		header:  h,
+		section: io.NewSectionReader(f, dataOffset, h.Size),
+	})
+
+	return true
+}
+
+// addDuplicityMultivolFiles adds files assembled from their chunks, failing if any chunk is missing.
+func (a *Archive) addDuplicityMultivolFiles(stripComponents int) error {
+	for name, chunks := range a.duplicityChunks {
+		sort.Slice(chunks, func(i, j int) bool {
+			return chunks[i].index < chunks[j].index
+		})
+
+		var (
+			parts []*io.SectionReader
+			size  int64
+		)
+
+		for i, c := range chunks {
+			if c.index != i+1 {
+				return errors.Errorf("missing chunk %v of %v", i+1, name)
+			}
+
+			parts = append(parts, c.section)
+			size += c.section.Size()
+		}
+
+		h := *chunks[0].header
+		h.Name = name
+		h.Size = size
+		h.Typeflag = tar.TypeReg
+
+		a.addTarFile(&h, stripComponents, func() (io.ReadSeeker, io.Closer, error) {
+			return io.NewSectionReader(concatReaderAt(parts), 0, size), nil, nil
+		})
+	}
+
+	return nil
+}
+
+// concatReaderAt presents consecutive sections as a single stream.
+type concatReaderAt []*io.SectionReader
+
+func (c concatReaderAt) ReadAt(b []byte, off int64) (int, error) {
+	n := 0
+
+	for _, p := range c {
+		if off >= p.Size() {
+			off -= p.Size()
+			continue
+		}
+
+		m, err := p.ReadAt(b[n:], off)
+		n += m
+
+		if n == len(b) {
+			return n, nil
+		}
+
+		if err != nil && err != io.EOF {
+			return n, err
+		}
+
+		off = 0
+	}
+
+	return n, io.EOF
+}
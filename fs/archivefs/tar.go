@@ -0,0 +1,170 @@
+package archivefs
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/fs"
+	"github.com/kopia/kopia/internal/iocopy"
+)
+
+const duplicitySnapshotPrefix = "snapshot/"
+
+// countingReader keeps track of the number of bytes read so far, which allows
+// mapping tar entries to their offsets within the archive.
+type countingReader struct {
+	r      io.Reader
+	offset int64
+}
+
+func (c *countingReader) Read(b []byte) (int, error) {
+	n, err := c.r.Read(b)
+	c.offset += int64(n)
+
+	return n, err
+}
+
+// tempFileCloser removes the temporary file on close.
+type tempFileCloser struct {
+	f *os.File
+}
+
+func (c tempFileCloser) Close() error {
+	c.f.Close() //nolint:errcheck
+
+	return os.Remove(c.f.Name())
+}
+
+func (a *Archive) readTar(ctx context.Context, fname string, gzipped bool, stripComponents int) error {
+	f, err := os.Open(fname) //nolint:gosec
+	if err != nil {
+		return err
+	}
+
+	a.closers = append(a.closers, f)
+
+	if gzipped {
+		// compressed streams are not seekable, decompress into a temporary file
+		// so that individual entries can be read independently.
+		if f, err = a.decompressToTempFile(ctx, f); err != nil {
+			return errors.Wrap(err, "unable to decompress archive")
+		}
+	}
+
+	cr := &countingReader{r: f}
+	tr := tar.NewReader(cr)
+
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return errors.Wrap(err, "error reading tar archive")
+		}
+
+		if a.duplicity {
+			if a.addDuplicityChunk(f, h, cr.offset) {
+				continue
+			}
+
+			if !strings.HasPrefix(h.Name, duplicitySnapshotPrefix) {
+				// skip signatures and deltas.
+				continue
+			}
+
+			h.Name = strings.TrimPrefix(h.Name, duplicitySnapshotPrefix)
+		}
+
+		a.addTarEntry(f, h, cr.offset, stripComponents)
+	}
+}
+
+func (a *Archive) decompressToTempFile(ctx context.Context, f *os.File) (*os.File, error) {
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close() //nolint:errcheck
+
+	tf, err := ioutil.TempFile("", "kopia-archive")
+	if err != nil {
+		return nil, err
+	}
+
+	a.closers = append(a.closers, tempFileCloser{tf})
+
+	n, err := iocopy.Copy(tf, gz)
+	if err != nil {
+		return nil, err
+	}
+
+	log(ctx).Debugf("decompressed %v bytes from %v", n, f.Name())
+
+	if _, err := tf.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	return tf, nil
+}
+
+func (a *Archive) addTarEntry(f *os.File, h *tar.Header, dataOffset int64, stripComponents int) {
+	fi := h.FileInfo()
+	e := entry{
+		mode:    fi.Mode(),
+		size:    h.Size,
+		modTime: h.ModTime,
+		owner: fs.OwnerInfo{
+			UserID:  uint32(h.Uid),
+			GroupID: uint32(h.Gid),
+		},
+	}
+
+	switch h.Typeflag {
+	case tar.TypeDir:
+		a.add(h.Name, stripComponents, func(name string) fs.Entry {
+			e.name = name
+			e.size = 0
+
+			return &directory{entry: e, children: map[string]fs.Entry{}}
+		})
+
+	case tar.TypeSymlink:
+		a.add(h.Name, stripComponents, func(name string) fs.Entry {
+			e.name = name
+			e.size = int64(len(h.Linkname))
+
+			return &symlink{entry: e, target: h.Linkname}
+		})
+
+	case tar.TypeReg, tar.TypeRegA:
+		a.addTarFile(h, stripComponents, func() (io.ReadSeeker, io.Closer, error) {
+			return io.NewSectionReader(f, dataOffset, h.Size), nil, nil
+		})
+	}
+}
+
+func (a *Archive) addTarFile(h *tar.Header, stripComponents int, open func() (io.ReadSeeker, io.Closer, error)) {
+	fi := h.FileInfo()
+
+	a.add(h.Name, stripComponents, func(name string) fs.Entry {
+		return &file{entry: entry{
+			name:    name,
+			mode:    fi.Mode(),
+			size:    h.Size,
+			modTime: h.ModTime,
+			owner: fs.OwnerInfo{
+				UserID:  uint32(h.Uid),
+				GroupID: uint32(h.Gid),
+			},
+		}, open: open}
+	})
+}
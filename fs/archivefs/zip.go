@@ -0,0 +1,141 @@
+package archivefs
+
+import (
+	"archive/zip"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/fs"
+)
+
+func (a *Archive) readZip(fname string, stripComponents int) error {
+	zr, err := zip.OpenReader(fname)
+	if err != nil {
+		return errors.Wrap(err, "error reading zip archive")
+	}
+
+	a.closers = append(a.closers, zr)
+
+	for _, zf := range zr.File {
+		a.addZipEntry(zf, stripComponents)
+	}
+
+	return nil
+}
+
+func (a *Archive) addZipEntry(zf *zip.File, stripComponents int) {
+	fi := zf.FileInfo()
+	e := entry{
+		mode:    fi.Mode(),
+		size:    int64(zf.UncompressedSize64),
+		modTime: zf.Modified,
+	}
+
+	switch {
+	case fi.IsDir():
+		a.add(zf.Name, stripComponents, func(name string) fs.Entry {
+			e.name = name
+			e.size = 0
+
+			return &directory{entry: e, children: map[string]fs.Entry{}}
+		})
+
+	case fi.Mode()&os.ModeSymlink != 0:
+		a.add(zf.Name, stripComponents, func(name string) fs.Entry {
+			e.name = name
+
+			return &symlink{entry: e, target: readZipSymlinkTarget(zf)}
+		})
+
+	case fi.Mode().IsRegular():
+		a.add(zf.Name, stripComponents, func(name string) fs.Entry {
+			e.name = name
+
+			return &file{entry: e, open: func() (io.ReadSeeker, io.Closer, error) {
+				rs := &zipReadSeeker{zf: zf}
+				return rs, rs, nil
+			}}
+		})
+	}
+}
+
+func readZipSymlinkTarget(zf *zip.File) string {
+	rc, err := zf.Open()
+	if err != nil {
+		return ""
+	}
+	defer rc.Close() //nolint:errcheck
+
+	b, err := ioutil.ReadAll(rc)
+	if err != nil {
+		return ""
+	}
+
+	return string(b)
+}
+
+// zipReadSeeker provides seeking within a compressed zip entry by re-opening it
+// and skipping data when seeking backwards.
+type zipReadSeeker struct {
+	zf  *zip.File
+	rc  io.ReadCloser
+	pos int64
+}
+
+func (r *zipReadSeeker) Read(b []byte) (int, error) {
+	if r.rc == nil {
+		rc, err := r.zf.Open()
+		if err != nil {
+			return 0, err
+		}
+
+		if _, err := io.CopyN(ioutil.Discard, rc, r.pos); err != nil {
+			rc.Close() //nolint:errcheck
+			return 0, err
+		}
+
+		r.rc = rc
+	}
+
+	n, err := r.rc.Read(b)
+	r.pos += int64(n)
+
+	return n, err
+}
+
+func (r *zipReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.pos
+	case io.SeekEnd:
+		offset += int64(r.zf.UncompressedSize64)
+	default:
+		return r.pos, errors.New("invalid whence")
+	}
+
+	if offset < 0 {
+		return r.pos, errors.New("negative position")
+	}
+
+	if offset != r.pos {
+		r.Close() //nolint:errcheck
+		r.pos = offset
+	}
+
+	return r.pos, nil
+}
+
+func (r *zipReadSeeker) Close() error {
+	if r.rc == nil {
+		return nil
+	}
+
+	err := r.rc.Close()
+	r.rc = nil
+
+	return err
+}
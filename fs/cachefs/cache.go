@@ -137,26 +137,91 @@ func (c *Cache) getEntries(ctx context.Context, id string, expirationTime time.D
 		return nil, err
 	}
 
-	if len(raw) > c.maxDirectoryEntries {
-		// no point caching since it would not fit anyway, just return it.
-		return raw, nil
+	c.addEntriesLocked(id, raw, expirationTime)
+
+	return raw, nil
+}
+
+// IterateEntries invokes the callback for each entry of a provided directory using ObjectID of a directory (if any)
+// to cache the results. Directories too large to fit in the cache are streamed without being held in memory.
+func (c *Cache) IterateEntries(ctx context.Context, d fs.Directory, cb fs.IterateEntriesCallback) error {
+	h, ok := d.(object.HasObjectID)
+	if !ok || c == nil {
+		return fs.IterateEntries(ctx, d, cb)
+	}
+
+	cacheID := string(h.ObjectID())
+
+	c.mu.Lock()
+	cached := c.getEntriesFromCacheLocked(ctx, cacheID)
+	c.mu.Unlock()
+
+	if cached != nil {
+		for _, e := range cached {
+			if err := cb(ctx, e); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	// collect entries while they fit in the cache, give up as soon as they don't.
+	var (
+		collected fs.Entries
+		tooLarge  bool
+	)
+
+	if err := fs.IterateEntries(ctx, d, func(ctx context.Context, e fs.Entry) error {
+		if !tooLarge {
+			if len(collected) >= c.maxDirectoryEntries {
+				tooLarge = true
+				collected = nil
+			} else {
+				collected = append(collected, e)
+			}
+		}
+
+		return cb(ctx, e)
+	}); err != nil {
+		return err
+	}
+
+	if tooLarge {
+		return nil
+	}
+
+	collected.Sort()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.data[cacheID]; !ok {
+		c.addEntriesLocked(cacheID, collected, dirCacheExpiration)
+	}
+
+	return nil
+}
+
+func (c *Cache) addEntriesLocked(id string, entries fs.Entries, expirationTime time.Duration) {
+	if len(entries) > c.maxDirectoryEntries {
+		// no point caching since it would not fit anyway.
+		return
 	}
 
 	entry := &cacheEntry{
 		id:          id,
-		entries:     raw,
+		entries:     entries,
 		expireAfter: time.Now().Add(expirationTime),
 	}
 
 	c.addToHead(entry)
 	c.data[id] = entry
 
-	c.totalDirectoryEntries += len(raw)
+	c.totalDirectoryEntries += len(entries)
 	for c.totalDirectoryEntries > c.maxDirectoryEntries || len(c.data) > c.maxDirectories {
 		c.removeEntryLocked(c.tail)
 	}
-
-	return raw, nil
 }
 
 func (c *Cache) removeEntryLocked(toremove *cacheEntry) {
@@ -13,7 +13,9 @@ import (
 	"time"
 
 	"github.com/kopia/kopia/fs"
+	"github.com/kopia/kopia/internal/mockfs"
 	"github.com/kopia/kopia/internal/testlogging"
+	"github.com/kopia/kopia/repo/object"
 )
 
 const expirationTime = 10 * time.Hour
@@ -283,3 +285,64 @@ func TestCacheGetEntriesLocking(t *testing.T) {
 		t.Fatal("Cache is locked after returning from getEntries")
 	}
 }
+
+type directoryWithObjectID struct {
+	*mockfs.Directory
+	oid object.ID
+}
+
+func (d directoryWithObjectID) ObjectID() object.ID {
+	return d.oid
+}
+
+func iterateCount(ctx context.Context, c *Cache, d fs.Directory) (int, error) {
+	cnt := 0
+
+	err := c.IterateEntries(ctx, d, func(ctx context.Context, e fs.Entry) error {
+		cnt++
+		return nil
+	})
+
+	return cnt, err
+}
+
+func TestCacheIterateEntries(t *testing.T) {
+	ctx := testlogging.Context(t)
+	c := NewCache(&Options{
+		MaxCachedDirectories: 10,
+		MaxCachedEntries:     5,
+	})
+
+	small := directoryWithObjectID{mockfs.NewDirectory(), "small"}
+	large := directoryWithObjectID{mockfs.NewDirectory(), "large"}
+
+	for i := 0; i < 3; i++ {
+		small.AddFile(fmt.Sprintf("f%v", i), []byte{1}, 0)
+	}
+
+	for i := 0; i < 10; i++ {
+		large.AddFile(fmt.Sprintf("f%v", i), []byte{1}, 0)
+	}
+
+	for _, d := range []directoryWithObjectID{small, large} {
+		if _, err := iterateCount(ctx, c, d); err != nil {
+			t.Fatalf("unable to iterate %v: %v", d.oid, err)
+		}
+
+		d.FailReaddir(errors.New("some error"))
+	}
+
+	// small directory is served from the cache.
+	if cnt, err := iterateCount(ctx, c, small); err != nil || cnt != 3 {
+		t.Errorf("unexpected result of iterating cached directory: %v %v", cnt, err)
+	}
+
+	// large directory did not fit in the cache and is listed again.
+	if _, err := iterateCount(ctx, c, large); err == nil {
+		t.Errorf("expected error iterating large directory")
+	}
+
+	if got, want := c.totalDirectoryEntries, 3; got != want {
+		t.Errorf("unexpected number of cached entries: %v, want %v", got, want)
+	}
+}
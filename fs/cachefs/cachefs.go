@@ -10,6 +10,7 @@ import (
 // DirectoryCacher reads and potentially caches directory entries for a given directory.
 type DirectoryCacher interface {
 	Readdir(ctx context.Context, d fs.Directory) (fs.Entries, error)
+	IterateEntries(ctx context.Context, d fs.Directory, cb fs.IterateEntriesCallback) error
 }
 
 type cacheContext struct {
@@ -44,6 +45,12 @@ func (d *directory) Readdir(ctx context.Context) (fs.Entries, error) {
 	return wrapped, err
 }
 
+func (d *directory) IterateEntries(ctx context.Context, cb fs.IterateEntriesCallback) error {
+	return d.ctx.cacher.IterateEntries(ctx, d.Directory, func(ctx context.Context, e fs.Entry) error {
+		return cb(ctx, wrapWithContext(e, d.ctx))
+	})
+}
+
 type file struct {
 	ctx *cacheContext
 	fs.File
@@ -76,5 +83,6 @@ func wrapWithContext(e fs.Entry, opts *cacheContext) fs.Entry {
 }
 
 var _ fs.Directory = &directory{}
+var _ fs.DirectoryIterator = &directory{}
 var _ fs.File = &file{}
 var _ fs.Symlink = &symlink{}
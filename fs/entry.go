@@ -15,6 +15,11 @@ type Entry interface {
 	Owner() OwnerInfo
 }
 
+// HasDevice is implemented by entries that know the device they are stored on, which allows detecting mount points.
+type HasDevice interface {
+	Device() uint64
+}
+
 // OwnerInfo describes owner of a filesystem entry
 type OwnerInfo struct {
 	UserID  uint32
@@ -46,6 +51,54 @@ type Directory interface {
 	Summary() *DirectorySummary
 }
 
+// IterateEntriesCallback is invoked for each entry of a directory.
+type IterateEntriesCallback func(ctx context.Context, e Entry) error
+
+// DirectoryIterator is implemented by directories that can enumerate their entries without
+// reading all of them into memory first.
+//
+// Entries are not guaranteed to be returned in any particular order and the callback is never
+// invoked concurrently. Returning an error from the callback stops the iteration and the error
+// is returned to the caller.
+type DirectoryIterator interface {
+	IterateEntries(ctx context.Context, cb IterateEntriesCallback) error
+}
+
+// IterateEntries invokes the provided callback for each entry of a directory, streaming them
+// when the directory implements DirectoryIterator and falling back to Readdir() otherwise.
+func IterateEntries(ctx context.Context, d Directory, cb IterateEntriesCallback) error {
+	if it, ok := d.(DirectoryIterator); ok {
+		return it.IterateEntries(ctx, cb)
+	}
+
+	entries, err := d.Readdir(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		if err := cb(ctx, e); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// FileRange is a range of bytes within a file.
+type FileRange struct {
+	Start  int64
+	Length int64
+}
+
+// ChangedRangesFinder is implemented by files stored in chunks, which can determine the ranges of an existing
+// copy of the file that differ from their contents without reading the contents of the entire file.
+//
+// The returned ranges are ordered by their position and reported ranges may be larger than the actual changes.
+type ChangedRangesFinder interface {
+	ChangedRanges(ctx context.Context, existing io.ReaderAt, existingSize int64) ([]FileRange, error)
+}
+
 // ErrEntryNotFound is returned when an entry is not found.
 var ErrEntryNotFound = errors.New("entry not found")
 
@@ -72,6 +125,33 @@ type DirectorySummary struct {
 	TotalDirCount    int64     `json:"dirs"`
 	MaxModTime       time.Time `json:"maxTime"`
 	IncompleteReason string    `json:"incomplete,omitempty"`
+
+	// FailedEntryCount is the number of entries in the directory tree that could not be read, of which
+	// up to MaxFailedEntriesPerSummary are described in FailedEntries.
+	FailedEntryCount int               `json:"numFailed,omitempty"`
+	FailedEntries    []*EntryWithError `json:"errors,omitempty"`
+}
+
+// MaxFailedEntriesPerSummary is the maximum number of failed entries described in a DirectorySummary.
+const MaxFailedEntriesPerSummary = 10
+
+// EntryWithError describes an entry that could not be read.
+type EntryWithError struct {
+	EntryPath string `json:"path"`
+	Error     string `json:"error"`
+}
+
+// AddFailedEntries records the provided failed entries in the summary.
+func (s *DirectorySummary) AddFailedEntries(count int, entries ...*EntryWithError) {
+	s.FailedEntryCount += count
+
+	for _, e := range entries {
+		if len(s.FailedEntries) >= MaxFailedEntriesPerSummary {
+			break
+		}
+
+		s.FailedEntries = append(s.FailedEntries, e)
+	}
 }
 
 // Symlink represents a symbolic link entry.
@@ -4,6 +4,7 @@ package ignorefs
 import (
 	"bufio"
 	"context"
+	"path"
 	"strings"
 
 	"github.com/pkg/errors"
@@ -24,6 +25,9 @@ type ignoreContext struct {
 	dotIgnoreFiles []string         // which files to look for more ignore rules
 	matchers       []ignore.Matcher // current set of rules to ignore files
 	maxFileSize    int64            // maximum size of file allowed
+
+	oneFileSystem  bool            // whether to skip directories on other devices
+	includedMounts map[string]bool // cleaned paths of mount points included despite oneFileSystem
 }
 
 func (c *ignoreContext) shouldIncludeByName(path string, e fs.Entry) bool {
@@ -58,7 +62,9 @@ func (d *ignoreDirectory) Readdir(ctx context.Context) (fs.Entries, error) {
 		return nil, err
 	}
 
-	thisContext, err := d.buildContext(ctx, entries)
+	thisContext, err := d.buildContext(ctx, func(ctx context.Context, name string) (fs.Entry, error) {
+		return entries.FindByName(name), nil
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -66,25 +72,88 @@ func (d *ignoreDirectory) Readdir(ctx context.Context) (fs.Entries, error) {
 	result := make(fs.Entries, 0, len(entries))
 
 	for _, e := range entries {
-		if !thisContext.shouldIncludeByName(d.relativePath+"/"+e.Name(), e) {
-			continue
+		if e = d.wrapIncludedEntry(thisContext, e); e != nil {
+			result = append(result, e)
 		}
+	}
 
-		if maxSize := thisContext.maxFileSize; maxSize > 0 && e.Size() > maxSize {
-			continue
+	return result, nil
+}
+
+func (d *ignoreDirectory) IterateEntries(ctx context.Context, cb fs.IterateEntriesCallback) error {
+	thisContext, err := d.buildContext(ctx, d.findChild)
+	if err != nil {
+		return err
+	}
+
+	return fs.IterateEntries(ctx, d.Directory, func(ctx context.Context, e fs.Entry) error {
+		if e = d.wrapIncludedEntry(thisContext, e); e == nil {
+			return nil
 		}
 
-		if dir, ok := e.(fs.Directory); ok {
-			e = &ignoreDirectory{d.relativePath + "/" + e.Name(), thisContext, d.policyTree.Child(e.Name()), dir}
+		return cb(ctx, e)
+	})
+}
+
+// wrapIncludedEntry returns the entry wrapped for listing or nil if the entry is ignored.
+func (d *ignoreDirectory) wrapIncludedEntry(thisContext *ignoreContext, e fs.Entry) fs.Entry {
+	if !thisContext.shouldIncludeByName(d.relativePath+"/"+e.Name(), e) {
+		return nil
+	}
+
+	if maxSize := thisContext.maxFileSize; maxSize > 0 && e.Size() > maxSize {
+		return nil
+	}
+
+	if thisContext.oneFileSystem && d.isExcludedMountPoint(thisContext, e) {
+		for _, oi := range thisContext.onIgnore {
+			oi(d.relativePath+"/"+e.Name(), e)
 		}
 
-		result = append(result, e)
+		return nil
 	}
 
-	return result, nil
+	if dir, ok := e.(fs.Directory); ok {
+		return &ignoreDirectory{d.relativePath + "/" + e.Name(), thisContext, d.policyTree.Child(e.Name()), dir}
+	}
+
+	return e
 }
 
-func (d *ignoreDirectory) buildContext(ctx context.Context, entries fs.Entries) (*ignoreContext, error) {
+// isExcludedMountPoint returns true if the entry is a directory on a different device than this directory
+// that is not explicitly included.
+func (d *ignoreDirectory) isExcludedMountPoint(thisContext *ignoreContext, e fs.Entry) bool {
+	if !e.IsDir() {
+		return false
+	}
+
+	parentDev, ok := d.Directory.(fs.HasDevice)
+	if !ok {
+		return false
+	}
+
+	dev, ok := e.(fs.HasDevice)
+	if !ok || dev.Device() == parentDev.Device() {
+		return false
+	}
+
+	return !thisContext.includedMounts[path.Clean(d.relativePath+"/"+e.Name())]
+}
+
+// findChild returns the child entry with a given name or nil if not found, without listing the directory.
+func (d *ignoreDirectory) findChild(ctx context.Context, name string) (fs.Entry, error) {
+	e, err := d.Directory.Child(ctx, name)
+	if errors.Is(err, fs.ErrEntryNotFound) {
+		return nil, nil
+	}
+
+	return e, err
+}
+
+// childFinder returns the child entry with a given name or nil if not found.
+type childFinder func(ctx context.Context, name string) (fs.Entry, error)
+
+func (d *ignoreDirectory) buildContext(ctx context.Context, findChild childFinder) (*ignoreContext, error) {
 	var effectiveDotIgnoreFiles = d.parentContext.dotIgnoreFiles
 
 	pol := d.policyTree.DefinedPolicy()
@@ -92,15 +161,20 @@ func (d *ignoreDirectory) buildContext(ctx context.Context, entries fs.Entries)
 		effectiveDotIgnoreFiles = pol.FilesPolicy.DotIgnoreFiles
 	}
 
-	var foundDotIgnoreFiles bool
+	var dotIgnoreFiles []fs.File
 
 	for _, dotfile := range effectiveDotIgnoreFiles {
-		if e := entries.FindByName(dotfile); e != nil {
-			foundDotIgnoreFiles = true
+		e, err := findChild(ctx, dotfile)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to look up %v", dotfile)
+		}
+
+		if f, ok := e.(fs.File); ok {
+			dotIgnoreFiles = append(dotIgnoreFiles, f)
 		}
 	}
 
-	if !foundDotIgnoreFiles && pol == nil {
+	if len(dotIgnoreFiles) == 0 && pol == nil {
 		// no dotfiles and no policy at this level, reuse parent ignore rules
 		return d.parentContext, nil
 	}
@@ -110,6 +184,8 @@ func (d *ignoreDirectory) buildContext(ctx context.Context, entries fs.Entries)
 		onIgnore:       d.parentContext.onIgnore,
 		dotIgnoreFiles: effectiveDotIgnoreFiles,
 		maxFileSize:    d.parentContext.maxFileSize,
+		oneFileSystem:  d.parentContext.oneFileSystem,
+		includedMounts: d.parentContext.includedMounts,
 	}
 
 	if pol != nil {
@@ -118,7 +194,7 @@ func (d *ignoreDirectory) buildContext(ctx context.Context, entries fs.Entries)
 		}
 	}
 
-	if err := newic.loadDotIgnoreFiles(ctx, d.relativePath, entries, effectiveDotIgnoreFiles); err != nil {
+	if err := newic.loadDotIgnoreFiles(ctx, d.relativePath, dotIgnoreFiles); err != nil {
 		return nil, err
 	}
 
@@ -139,6 +215,23 @@ func (c *ignoreContext) overrideFromPolicy(fp policy.FilesPolicy, dirPath string
 		c.maxFileSize = fp.MaxFileSize
 	}
 
+	if fp.OneFileSystem != nil {
+		c.oneFileSystem = *fp.OneFileSystem
+	}
+
+	if len(fp.IncludedMounts) > 0 {
+		included := map[string]bool{}
+		for p := range c.includedMounts {
+			included[p] = true
+		}
+
+		for _, m := range fp.IncludedMounts {
+			included[path.Clean(dirPath+"/"+strings.TrimPrefix(m, "/"))] = true
+		}
+
+		c.includedMounts = included
+	}
+
 	// append policy-level rules
 	for _, rule := range fp.IgnoreRules {
 		m, err := ignore.ParseGitIgnore(dirPath, rule)
@@ -152,20 +245,8 @@ func (c *ignoreContext) overrideFromPolicy(fp policy.FilesPolicy, dirPath string
 	return nil
 }
 
-func (c *ignoreContext) loadDotIgnoreFiles(ctx context.Context, dirPath string, entries fs.Entries, dotIgnoreFiles []string) error {
-	for _, dotIgnoreFile := range dotIgnoreFiles {
-		e := entries.FindByName(dotIgnoreFile)
-		if e == nil {
-			// no dotfile
-			continue
-		}
-
-		f, ok := e.(fs.File)
-		if !ok {
-			// not a file
-			continue
-		}
-
+func (c *ignoreContext) loadDotIgnoreFiles(ctx context.Context, dirPath string, dotIgnoreFiles []fs.File) error {
+	for _, f := range dotIgnoreFiles {
 		matchers, err := parseIgnoreFile(ctx, dirPath, f)
 		if err != nil {
 			return errors.Wrapf(err, "unable to parse ignore file %v", f.Name())
@@ -246,6 +327,7 @@ func New(dir fs.Directory, policyTree *policy.Tree, options ...Option) fs.Direct
 }
 
 var _ fs.Directory = &ignoreDirectory{}
+var _ fs.DirectoryIterator = &ignoreDirectory{}
 
 // ReportIgnoredFiles returns an Option causing ignorefs to call the provided function whenever a file or directory is ignored.
 func ReportIgnoredFiles(f IgnoreCallback) Option {
@@ -2,6 +2,7 @@ package ignorefs_test
 
 import (
 	"bytes"
+	"context"
 	"sort"
 	"testing"
 
@@ -216,6 +217,55 @@ var cases = []struct {
 			"./src/some-src/f1",
 		},
 	},
+	{
+		desc: "one file system excludes mount points",
+		setup: func(root *mockfs.Directory) {
+			root.Subdir("bin").SetDevice(2)
+			root.Subdir("src", "some-src").SetDevice(3)
+		},
+		policyTree: policy.BuildTree(map[string]*policy.Policy{
+			".": {
+				FilesPolicy: policy.FilesPolicy{
+					OneFileSystem: newBool(true),
+				},
+			},
+		}, policy.DefaultPolicy),
+		ignoredFiles: []string{
+			"./bin/",
+			"./bin/some-bin",
+			"./src/some-src/",
+			"./src/some-src/f1",
+		},
+	},
+	{
+		desc: "one file system includes listed mount points",
+		setup: func(root *mockfs.Directory) {
+			root.Subdir("bin").SetDevice(2)
+			root.Subdir("src", "some-src").SetDevice(3)
+		},
+		policyTree: policy.BuildTree(map[string]*policy.Policy{
+			".": {
+				FilesPolicy: policy.FilesPolicy{
+					OneFileSystem:  newBool(true),
+					IncludedMounts: []string{"/src/some-src"},
+				},
+			},
+		}, policy.DefaultPolicy),
+		ignoredFiles: []string{
+			"./bin/",
+			"./bin/some-bin",
+		},
+	},
+	{
+		desc: "mount points included without one file system",
+		setup: func(root *mockfs.Directory) {
+			root.Subdir("bin").SetDevice(2)
+		},
+	},
+}
+
+func newBool(b bool) *bool {
+	return &b
 }
 
 func TestIgnoreFS(t *testing.T) {
@@ -232,6 +282,10 @@ func TestIgnoreFS(t *testing.T) {
 
 			expectedFiles := addAndSubtractFiles(originalFiles, tc.addedFiles, tc.ignoredFiles)
 			verifyDirectoryTree(t, ifs, expectedFiles)
+
+			if diff := pretty.Compare(walkTreeWith(t, ifs, iterateSorted), expectedFiles); diff != "" {
+				t.Errorf("unexpected directory tree when iterating, diff(-got,+want): %v\n", diff)
+			}
 		})
 	}
 }
@@ -264,6 +318,26 @@ func addAndSubtractFiles(original, added, removed []string) []string {
 }
 
 func walkTree(t *testing.T, dir fs.Directory) []string {
+	return walkTreeWith(t, dir, func(ctx context.Context, d fs.Directory) (fs.Entries, error) {
+		return d.Readdir(ctx)
+	})
+}
+
+// iterateSorted lists the directory using fs.IterateEntries and sorts the result by name.
+func iterateSorted(ctx context.Context, d fs.Directory) (fs.Entries, error) {
+	var entries fs.Entries
+
+	err := fs.IterateEntries(ctx, d, func(ctx context.Context, e fs.Entry) error {
+		entries = append(entries, e)
+		return nil
+	})
+
+	entries.Sort()
+
+	return entries, err
+}
+
+func walkTreeWith(t *testing.T, dir fs.Directory, list func(ctx context.Context, d fs.Directory) (fs.Entries, error)) []string {
 	var output []string
 
 	var walk func(path string, d fs.Directory) error
@@ -271,7 +345,7 @@ func walkTree(t *testing.T, dir fs.Directory) []string {
 	walk = func(path string, d fs.Directory) error {
 		output = append(output, path+"/")
 
-		entries, err := d.Readdir(testlogging.Context(t))
+		entries, err := list(testlogging.Context(t), d)
 		if err != nil {
 			return err
 		}
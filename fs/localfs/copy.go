@@ -20,6 +20,9 @@ type CopyOptions struct {
 	// the copier does not modify already existing files and returns an error
 	// instead.
 	OverwriteFiles bool
+	// Existing files at least this large are updated in place by rewriting only their changed ranges
+	// when the restored file can report them, 0 disables in-place updates.
+	InPlaceUpdateMinSize int64
 }
 
 // Copy copies e into targetPath in the local file system. If e is an
@@ -147,13 +150,17 @@ func (c *copier) createDirectory(ctx context.Context, path string) error {
 }
 
 func (c *copier) copyFileContent(ctx context.Context, targetPath string, f fs.File) error {
-	switch _, err := os.Stat(targetPath); {
+	switch st, err := os.Stat(targetPath); {
 	case os.IsNotExist(err): // copy file below
 	case err == nil:
 		if !c.OverwriteFiles {
 			return errors.Errorf("unable to create %q, it already exists", targetPath)
 		}
 
+		if finder, ok := f.(fs.ChangedRangesFinder); ok && c.shouldUpdateInPlace(st, f) {
+			return c.updateFileInPlace(ctx, targetPath, f, finder)
+		}
+
 		log(ctx).Debugf("Overwriting existing file: %v", targetPath)
 	default:
 		return errors.Wrap(err, "failed to stat "+targetPath)
@@ -170,6 +177,63 @@ func (c *copier) copyFileContent(ctx context.Context, targetPath string, f fs.Fi
 	return atomic.WriteFile(targetPath, r)
 }
 
+func (c *copier) shouldUpdateInPlace(existing os.FileInfo, f fs.File) bool {
+	return c.InPlaceUpdateMinSize > 0 && existing.Mode().IsRegular() && f.Size() >= c.InPlaceUpdateMinSize
+}
+
+// updateFileInPlace rewrites the ranges of the existing file that differ from the contents of the provided file.
+// Unlike replacing the file, this is not atomic and an interrupted update leaves the file partially updated.
+func (c *copier) updateFileInPlace(ctx context.Context, targetPath string, f fs.File, finder fs.ChangedRangesFinder) error {
+	out, err := os.OpenFile(targetPath, os.O_RDWR, 0) //nolint:gosec
+	if err != nil {
+		return errors.Wrap(err, "unable to open existing file")
+	}
+	defer out.Close() //nolint:errcheck
+
+	st, err := out.Stat()
+	if err != nil {
+		return errors.Wrap(err, "unable to stat existing file")
+	}
+
+	ranges, err := finder.ChangedRanges(ctx, out, st.Size())
+	if err != nil {
+		return errors.Wrap(err, "unable to determine changed ranges of "+targetPath)
+	}
+
+	r, err := f.Open(ctx)
+	if err != nil {
+		return errors.Wrap(err, "unable to open snapshot file for "+targetPath)
+	}
+	defer r.Close() //nolint:errcheck
+
+	var written int64
+
+	for _, rng := range ranges {
+		if _, err := r.Seek(rng.Start, io.SeekStart); err != nil {
+			return errors.Wrap(err, "unable to seek snapshot file")
+		}
+
+		if _, err := out.Seek(rng.Start, io.SeekStart); err != nil {
+			return errors.Wrap(err, "unable to seek "+targetPath)
+		}
+
+		n, err := io.CopyN(out, r, rng.Length)
+		if err != nil {
+			return errors.Wrap(err, "unable to update "+targetPath)
+		}
+
+		written += n
+	}
+
+	if err := out.Truncate(f.Size()); err != nil {
+		return errors.Wrap(err, "unable to truncate "+targetPath)
+	}
+
+	log(ctx).Debugf("updated %v of %v bytes of %v in place", written, f.Size(), targetPath)
+
+	return out.Close()
+}
+
 func isEmptyDirectory(name string) (bool, error) {
 	f, err := os.Open(name) //nolint:gosec
 	if err != nil {
@@ -5,7 +5,6 @@ import (
 	"io"
 	"os"
 	"path/filepath"
-	"sort"
 	"sync"
 	"time"
 
@@ -22,20 +21,13 @@ const (
 
 var log = logging.GetContextLoggerFunc("kopia/localfs")
 
-type sortedEntries fs.Entries
-
-func (e sortedEntries) Len() int      { return len(e) }
-func (e sortedEntries) Swap(i, j int) { e[i], e[j] = e[j], e[i] }
-func (e sortedEntries) Less(i, j int) bool {
-	return e[i].Name() < e[j].Name()
-}
-
 type filesystemEntry struct {
 	name       string
 	size       int64
 	mtimeNanos int64
 	mode       os.FileMode
 	owner      fs.OwnerInfo
+	device     uint64
 
 	parentDir string
 }
@@ -72,6 +64,10 @@ func (e *filesystemEntry) Owner() fs.OwnerInfo {
 	return e.owner
 }
 
+func (e *filesystemEntry) Device() uint64 {
+	return e.device
+}
+
 var _ os.FileInfo = (*filesystemEntry)(nil)
 
 func newEntry(fi os.FileInfo, parentDir string) filesystemEntry {
@@ -81,6 +77,7 @@ func newEntry(fi os.FileInfo, parentDir string) filesystemEntry {
 		fi.ModTime().UnixNano(),
 		fi.Mode(),
 		platformSpecificOwnerInfo(fi),
+		platformSpecificDevice(fi),
 		parentDir,
 	}
 }
@@ -126,43 +123,60 @@ type entryWithError struct {
 	err   error
 }
 
-func (fsd *filesystemDirectory) Readdir(ctx context.Context) (fs.Entries, error) {
+func (fsd *filesystemDirectory) IterateEntries(ctx context.Context, cb fs.IterateEntriesCallback) error {
 	fullPath := fsd.fullPath()
 
 	f, direrr := os.Open(fullPath) //nolint:gosec
 	if direrr != nil {
-		return nil, direrr
+		return direrr
 	}
 	defer f.Close() //nolint:errcheck
 
+	// closed when the iteration stops early to terminate the goroutines below.
+	done := make(chan struct{})
+
 	// start feeding directory entry names to namesCh
 	namesCh := make(chan string, dirListingPrefetch)
 
-	var readDirErr error
+	var (
+		readDirErr error
+		readerWG   sync.WaitGroup
+	)
+
+	readerWG.Add(1)
 
 	go func() {
+		defer readerWG.Done()
 		defer close(namesCh)
 
 		for {
 			names, err := f.Readdirnames(numEntriesToRead)
 			for _, name := range names {
-				namesCh <- name
+				select {
+				case namesCh <- name:
+				case <-done:
+					return
+				}
 			}
 
 			if err == nil {
 				continue
 			}
 
-			if err == io.EOF {
-				break
+			if err != io.EOF {
+				readDirErr = err
 			}
 
-			readDirErr = err
-
-			break
+			return
 		}
 	}()
 
+	// make sure the directory is not closed while it's still being read.
+	defer func() {
+		close(done)
+		readerWG.Wait()
+	}()
+
 	entriesCh := make(chan entryWithError, dirListingPrefetch)
 
 	var workersWG sync.WaitGroup
@@ -176,6 +190,8 @@ func (fsd *filesystemDirectory) Readdir(ctx context.Context) (fs.Entries, error)
 			defer workersWG.Done()
 
 			for n := range namesCh {
+				var ewe entryWithError
+
 				fi, staterr := os.Lstat(fullPath + "/" + n)
 
 				switch {
@@ -183,17 +199,22 @@ func (fsd *filesystemDirectory) Readdir(ctx context.Context) (fs.Entries, error)
 					// lost the race - ignore.
 					continue
 				case staterr != nil:
-					entriesCh <- entryWithError{err: errors.Errorf("unable to stat directory entry %q: %v", n, staterr)}
-					continue
+					ewe.err = errors.Errorf("unable to stat directory entry %q: %v", n, staterr)
+				default:
+					e, fierr := entryFromChildFileInfo(fi, fullPath)
+					if fierr != nil {
+						log(ctx).Warningf("unable to create directory entry %q: %v", fi.Name(), fierr)
+						continue
+					}
+
+					ewe.entry = e
 				}
 
-				e, fierr := entryFromChildFileInfo(fi, fullPath)
-				if fierr != nil {
-					log(ctx).Warningf("unable to create directory entry %q: %v", fi.Name(), fierr)
-					continue
+				select {
+				case entriesCh <- ewe:
+				case <-done:
+					return
 				}
-
-				entriesCh <- entryWithError{entry: e}
 			}
 		}()
 	}
@@ -204,26 +225,42 @@ func (fsd *filesystemDirectory) Readdir(ctx context.Context) (fs.Entries, error)
 		close(entriesCh)
 	}()
 
-	// drain the entriesCh into a slice and sort it
-	var entries fs.Entries
+	var firstStatErr error
 
 	for e := range entriesCh {
 		if e.err != nil {
-			// only return the first error
-			if readDirErr == nil {
-				readDirErr = e.err
+			// deliver remaining entries and only return the first error
+			if firstStatErr == nil {
+				firstStatErr = e.err
 			}
 
 			continue
 		}
 
-		entries = append(entries, e.entry)
+		if err := cb(ctx, e.entry); err != nil {
+			return err
+		}
+	}
+
+	if firstStatErr != nil {
+		return firstStatErr
 	}
 
-	sort.Sort(sortedEntries(entries))
+	// return any error encountered when listing the directory
+	return readDirErr
+}
+
+func (fsd *filesystemDirectory) Readdir(ctx context.Context) (fs.Entries, error) {
+	var entries fs.Entries
+
+	err := fsd.IterateEntries(ctx, func(ctx context.Context, e fs.Entry) error {
+		entries = append(entries, e)
+		return nil
+	})
+
+	entries.Sort()
 
-	// return any error encountered when listing or reading the directory
-	return entries, readDirErr
+	return entries, err
 }
 
 type fileWithMetadata struct {
@@ -305,5 +342,6 @@ func entryFromChildFileInfo(fi os.FileInfo, parentDir string) (fs.Entry, error)
 }
 
 var _ fs.Directory = &filesystemDirectory{}
+var _ fs.DirectoryIterator = &filesystemDirectory{}
 var _ fs.File = &filesystemFile{}
 var _ fs.Symlink = &filesystemSymlink{}
@@ -1,6 +1,8 @@
 package localfs
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -147,3 +149,60 @@ func assertNoError(t *testing.T, err error) {
 		t.Errorf("err: %v", err)
 	}
 }
+
+func TestIterateEntries(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	tmp, err := ioutil.TempDir("", "kopia")
+	if err != nil {
+		t.Fatalf("cannot create temp directory: %v", err)
+	}
+
+	defer os.RemoveAll(tmp)
+
+	const numFiles = 1000
+
+	for i := 0; i < numFiles; i++ {
+		assertNoError(t, ioutil.WriteFile(filepath.Join(tmp, fmt.Sprintf("f%v", i)), []byte{1, 2, 3}, 0600))
+	}
+
+	dir, err := Directory(tmp)
+	if err != nil {
+		t.Fatalf("error opening directory: %v", err)
+	}
+
+	seen := map[string]bool{}
+
+	assertNoError(t, dir.(fs.DirectoryIterator).IterateEntries(ctx, func(ctx context.Context, e fs.Entry) error {
+		if seen[e.Name()] {
+			t.Errorf("duplicate entry %v", e.Name())
+		}
+
+		seen[e.Name()] = true
+
+		return nil
+	}))
+
+	if got, want := len(seen), numFiles; got != want {
+		t.Errorf("unexpected number of entries: %v, want %v", got, want)
+	}
+
+	// returning an error from the callback stops the iteration.
+	errStop := errors.New("stop")
+	cnt := 0
+
+	if err := dir.(fs.DirectoryIterator).IterateEntries(ctx, func(ctx context.Context, e fs.Entry) error {
+		cnt++
+		if cnt == 10 {
+			return errStop
+		}
+
+		return nil
+	}); err != errStop {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if cnt != 10 {
+		t.Errorf("unexpected number of callbacks after stopping: %v", cnt)
+	}
+}
@@ -9,3 +9,8 @@ import (
 func platformSpecificOwnerInfo(fi os.FileInfo) fs.OwnerInfo {
 	return fs.OwnerInfo{}
 }
+
+// platformSpecificDevice returns the same device for all files, so mount points are not detected on Windows.
+func platformSpecificDevice(fi os.FileInfo) uint64 {
+	return 0
+}
@@ -46,6 +46,19 @@ func (ld *loggingDirectory) Readdir(ctx context.Context) (fs.Entries, error) {
 	return loggingEntries, err
 }
 
+func (ld *loggingDirectory) IterateEntries(ctx context.Context, cb fs.IterateEntriesCallback) error {
+	t0 := time.Now()
+	cnt := 0
+	err := fs.IterateEntries(ctx, ld.Directory, func(ctx context.Context, entry fs.Entry) error {
+		cnt++
+		return cb(ctx, wrapWithOptions(entry, ld.options, ld.relativePath+"/"+entry.Name()))
+	})
+	dt := time.Since(t0)
+	ld.options.printf(ld.options.prefix+"IterateEntries(%v) took %v and returned %v items", ld.relativePath, dt, cnt)
+
+	return err
+}
+
 type loggingFile struct {
 	options *loggingOptions
 	fs.File
@@ -107,5 +120,6 @@ func Prefix(prefix string) Option {
 }
 
 var _ fs.Directory = &loggingDirectory{}
+var _ fs.DirectoryIterator = &loggingDirectory{}
 var _ fs.File = &loggingFile{}
 var _ fs.Symlink = &loggingSymlink{}
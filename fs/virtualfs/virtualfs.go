@@ -0,0 +1,154 @@
+// Package virtualfs implements in-memory directories of files whose contents are streamed when read,
+// such as the output of commands, which allows snapshotting data that does not exist as files.
+package virtualfs
+
+import (
+	"context"
+	"io"
+	"os"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/fs"
+)
+
+const (
+	defaultDirMode  = os.ModeDir | 0o755
+	defaultFileMode = 0o644
+)
+
+// ErrSeekNotSupported is returned when seeking in a streaming file.
+var ErrSeekNotSupported = errors.New("streaming files do not support seeking")
+
+type entry struct {
+	name    string
+	mode    os.FileMode
+	size    int64
+	modTime time.Time
+}
+
+func (e *entry) Name() string {
+	return e.name
+}
+
+func (e *entry) IsDir() bool {
+	return e.mode.IsDir()
+}
+
+func (e *entry) Mode() os.FileMode {
+	return e.mode
+}
+
+func (e *entry) ModTime() time.Time {
+	return e.modTime
+}
+
+func (e *entry) Size() int64 {
+	return atomic.LoadInt64(&e.size)
+}
+
+func (e *entry) Sys() interface{} {
+	return nil
+}
+
+func (e *entry) Owner() fs.OwnerInfo {
+	return fs.OwnerInfo{}
+}
+
+type staticDirectory struct {
+	entry
+
+	entries fs.Entries
+}
+
+// NewStaticDirectory returns a directory with the provided entries.
+func NewStaticDirectory(name string, entries fs.Entries) fs.Directory {
+	sorted := append(fs.Entries(nil), entries...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Name() < sorted[j].Name()
+	})
+
+	return &staticDirectory{
+		entry:   entry{name: name, mode: defaultDirMode, modTime: time.Now()},
+		entries: sorted,
+	}
+}
+
+func (d *staticDirectory) Summary() *fs.DirectorySummary {
+	return nil
+}
+
+func (d *staticDirectory) Child(ctx context.Context, name string) (fs.Entry, error) {
+	if e := d.entries.FindByName(name); e != nil {
+		return e, nil
+	}
+
+	return nil, fs.ErrEntryNotFound
+}
+
+func (d *staticDirectory) Readdir(ctx context.Context) (fs.Entries, error) {
+	return append(fs.Entries(nil), d.entries...), nil
+}
+
+// StreamOpener returns the stream of contents of a file, which can only be read once.
+type StreamOpener func(ctx context.Context) (io.ReadCloser, error)
+
+type streamingFile struct {
+	entry
+
+	open StreamOpener
+}
+
+// NewStreamingFile returns a file whose contents are read from the stream returned by the provided function.
+// The size of the file is unknown until the stream has been read to the end, and its modification time is
+// the time it was created, so snapshots always read the stream again and only deduplicate unchanged data.
+func NewStreamingFile(name string, open StreamOpener) fs.File {
+	return &streamingFile{
+		entry: entry{name: name, mode: defaultFileMode, modTime: time.Now()},
+		open:  open,
+	}
+}
+
+func (f *streamingFile) Open(ctx context.Context) (fs.Reader, error) {
+	rc, err := f.open(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	atomic.StoreInt64(&f.size, 0)
+
+	return &streamingReader{rc, f}, nil
+}
+
+type streamingReader struct {
+	io.ReadCloser
+
+	f *streamingFile
+}
+
+func (r *streamingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	atomic.AddInt64(&r.f.size, int64(n))
+
+	return n, err
+}
+
+func (r *streamingReader) Seek(offset int64, whence int) (int64, error) {
+	if offset == 0 && whence == io.SeekCurrent {
+		return r.f.Size(), nil
+	}
+
+	return 0, ErrSeekNotSupported
+}
+
+func (r *streamingReader) Entry() (fs.Entry, error) {
+	return r.f, nil
+}
+
+var (
+	_ fs.Directory = (*staticDirectory)(nil)
+	_ fs.File      = (*streamingFile)(nil)
+)
@@ -7,7 +7,7 @@ require (
 	cloud.google.com/go v0.54.0 // indirect
 	cloud.google.com/go/storage v1.6.0
 	contrib.go.opencensus.io/exporter/prometheus v0.1.0
-	github.com/Azure/azure-pipeline-go v0.2.2 // indirect
+	github.com/Azure/azure-pipeline-go v0.2.2
 	github.com/Azure/azure-storage-blob-go v0.8.0
 	github.com/alecthomas/units v0.0.0-20190924025748-f65c72e2690d // indirect
 	github.com/aws/aws-sdk-go v1.28.13
@@ -38,6 +38,7 @@ require (
 	github.com/stretchr/testify v1.4.0
 	github.com/studio-b12/gowebdav v0.0.0-20200303150724-9380631c29a1
 	github.com/zalando/go-keyring v0.0.0-20200121091418-667557018717
+	github.com/zeebo/blake3 v0.0.4
 	go.opencensus.io v0.22.3
 	gocloud.dev v0.19.0
 	golang.org/x/crypto v0.0.0-20200311171314-f7b00557c8c4
@@ -52,4 +53,5 @@ require (
 	google.golang.org/grpc v1.28.0 // indirect
 	gopkg.in/alecthomas/kingpin.v2 v2.2.6
 	gopkg.in/ini.v1 v1.55.0 // indirect
+	gopkg.in/yaml.v2 v2.2.5
 )
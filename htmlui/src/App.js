@@ -7,6 +7,7 @@ import { BrowserRouter as Router, NavLink, Route, Switch, Redirect } from 'react
 import './App.css';
 import { DirectoryObject } from "./DirectoryObject";
 import logo from './kopia-flat.svg';
+import { MaintenanceStatus } from "./MaintenanceStatus";
 import { PoliciesTable } from "./PoliciesTable";
 import { RepoStatus } from "./RepoStatus";
 import { SnapshotsTable } from "./SnapshotsTable";
@@ -23,6 +24,7 @@ function App() {
             <NavLink className="nav-link" activeClassName="active" to="/snapshots">Snapshots</NavLink>
             <NavLink className="nav-link" activeClassName="active" to="/policies">Policies</NavLink>
             <NavLink className="nav-link" activeClassName="active" to="/repo">Repository</NavLink>
+            <NavLink className="nav-link" activeClassName="active" to="/maintenance">Maintenance</NavLink>
           </Nav>
         </Navbar.Collapse>
       </Navbar>
@@ -34,6 +36,7 @@ function App() {
           <Route path="/snapshots" component={SourcesTable} />
           <Route path="/policies" component={PoliciesTable} />
           <Route path="/repo" component={RepoStatus} />
+          <Route path="/maintenance" component={MaintenanceStatus} />
           <Route exact path="/">
             <Redirect to="/snapshots" />
           </Route>
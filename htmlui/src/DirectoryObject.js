@@ -55,6 +55,10 @@ export class DirectoryObject extends Component {
             <Button size="xxl" variant="dark" onClick={this.props.history.goBack} >
                 Back
             </Button>
+            &nbsp;
+            <Button size="xxl" variant="primary" href={"/api/v1/objects/" + this.props.match.params.oid + "?format=zip&fname=" + this.props.match.params.oid + ".zip"}>
+                Download as ZIP
+            </Button>
             </Row>
             <hr/>
             <Row>
@@ -0,0 +1,78 @@
+import axios from 'axios';
+import React, { Component } from 'react';
+import Badge from 'react-bootstrap/Badge';
+import Form from 'react-bootstrap/Form';
+import Spinner from 'react-bootstrap/Spinner';
+import { rfc3339TimestampForDisplay, sizeDisplayName } from './uiutil';
+
+export class MaintenanceStatus extends Component {
+    constructor() {
+        super();
+
+        this.state = {
+            info: {},
+            isLoading: true,
+            error: null,
+        };
+
+        this.mounted = false;
+    }
+
+    componentDidMount() {
+        this.mounted = true;
+        this.fetchInfo();
+    }
+
+    componentWillUnmount() {
+        this.mounted = false;
+    }
+
+    fetchInfo() {
+        axios.get('/api/v1/repo/maintenance').then(result => {
+            if (this.mounted) {
+                this.setState({
+                    info: result.data,
+                    isLoading: false,
+                });
+            }
+        }).catch(error => {
+            if (this.mounted) {
+                this.setState({
+                    error,
+                    isLoading: false
+                })
+            }
+        });
+    }
+
+    render() {
+        let { info, isLoading, error } = this.state;
+        if (error) {
+            return <p>ERROR: {error.message}</p>;
+        }
+        if (isLoading) {
+            return <Spinner animation="border" variant="primary" />;
+        }
+
+        return <div className="padded">
+            <h3>Maintenance</h3>
+            <Form.Group>
+                <Form.Label>Index Blobs</Form.Label>
+                <Form.Control readOnly defaultValue={info.indexBlobCount + " (" + sizeDisplayName(info.indexBlobsTotalSize) + ")"} />
+            </Form.Group>
+            <Form.Group>
+                <Form.Label>Uncompacted Index Blobs</Form.Label>
+                <Form.Control readOnly defaultValue={info.uncompactedIndexBlobs} />
+                {info.indexOptimizeSuggested && <Badge variant="warning">run 'kopia index optimize' to compact indexes</Badge>}
+            </Form.Group>
+            <Form.Group>
+                <Form.Label>Oldest Index Blob</Form.Label>
+                <Form.Control readOnly defaultValue={rfc3339TimestampForDisplay(info.oldestIndexBlobTime)} />
+            </Form.Group>
+            <Form.Group>
+                <Form.Label>Newest Index Blob</Form.Label>
+                <Form.Control readOnly defaultValue={rfc3339TimestampForDisplay(info.newestIndexBlobTime)} />
+            </Form.Group>
+        </div>;
+    }
+}
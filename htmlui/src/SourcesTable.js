@@ -179,6 +179,10 @@ export class SourcesTable extends Component {
                     <Button variant="primary" size="sm" onClick={() => {
                         parent.startSnapshot(x.row.original.source);
                     }}>Snapshot now</Button>
+                    {x.row.original.lastError && <>
+                        &nbsp;
+                        <Badge variant="danger" title={x.row.original.lastError}>last snapshot failed</Badge>
+                    </>}
                 </>;
 
             case "PENDING":
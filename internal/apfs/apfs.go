@@ -0,0 +1,53 @@
+// Package apfs creates temporary APFS local snapshots on macOS, which provide a consistent point-in-time
+// view of files that are being modified while they are backed up.
+package apfs
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// localSnapshotDateRegexp matches the date printed by 'tmutil localsnapshot', which identifies the snapshot.
+var localSnapshotDateRegexp = regexp.MustCompile(`(?m)date:\s*(\d{4}-\d{2}-\d{2}-\d{6})\s*$`)
+
+// Snapshot is an APFS local snapshot mounted for reading.
+type Snapshot struct {
+	// Date identifies the snapshot among local snapshots.
+	Date string
+
+	// Volume is the mount point of the snapshotted volume.
+	Volume string
+
+	// MountPoint is the directory where the snapshot is mounted.
+	MountPoint string
+}
+
+// Name returns the name of the snapshot.
+func (s *Snapshot) Name() string {
+	return "com.apple.TimeMachine." + s.Date + ".local"
+}
+
+// Path returns the path in the mounted snapshot corresponding to the provided absolute path on the volume.
+func (s *Snapshot) Path(original string) string {
+	rel := original
+
+	// on macOS 10.15+ the data volume is mounted at /System/Volumes/Data and firmlinked into the root,
+	// so paths on it may or may not include the volume mount point.
+	if s.Volume != "/" && (original == s.Volume || strings.HasPrefix(original, s.Volume+"/")) {
+		rel = strings.TrimPrefix(original, s.Volume)
+	}
+
+	return filepath.Join(s.MountPoint, rel)
+}
+
+func parseLocalSnapshotDate(output string) (string, error) {
+	m := localSnapshotDateRegexp.FindStringSubmatch(output)
+	if m == nil {
+		return "", errors.Errorf("unable to determine local snapshot date: %v", strings.TrimSpace(output))
+	}
+
+	return m[1], nil
+}
@@ -0,0 +1,99 @@
+package apfs
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// Create creates a local snapshot of the APFS volume containing the provided path and mounts it read-only.
+// Mounting snapshots requires running as root or granting Full Disk Access to the process.
+func Create(ctx context.Context, path string) (*Snapshot, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return nil, errors.Wrapf(err, "unable to determine volume of %v", path)
+	}
+
+	if fstype := int8String(st.Fstypename[:]); fstype != "apfs" {
+		return nil, errors.Errorf("%v is on a %v volume, local snapshots require APFS", path, fstype)
+	}
+
+	out, err := run(ctx, "tmutil", "localsnapshot")
+	if err != nil {
+		return nil, err
+	}
+
+	date, err := parseLocalSnapshotDate(out)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Snapshot{
+		Date:   date,
+		Volume: int8String(st.Mntonname[:]),
+	}
+
+	if s.MountPoint, err = ioutil.TempDir("", "kopia-apfs-"); err != nil {
+		s.deleteSnapshot(ctx)
+		return nil, errors.Wrap(err, "unable to create mount point")
+	}
+
+	if _, err := run(ctx, "mount_apfs", "-o", "rdonly,nobrowse", "-s", s.Name(), s.Volume, s.MountPoint); err != nil {
+		os.Remove(s.MountPoint) //nolint:errcheck
+		s.deleteSnapshot(ctx)
+
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Release unmounts and deletes the snapshot.
+func (s *Snapshot) Release(ctx context.Context) error {
+	if _, err := run(ctx, "umount", s.MountPoint); err != nil {
+		return err
+	}
+
+	os.Remove(s.MountPoint) //nolint:errcheck
+
+	return s.deleteSnapshot(ctx)
+}
+
+func (s *Snapshot) deleteSnapshot(ctx context.Context) error {
+	_, err := run(ctx, "tmutil", "deletelocalsnapshots", s.Date)
+	return err
+}
+
+func int8String(b []int8) string {
+	var sb strings.Builder
+
+	for _, c := range b {
+		if c == 0 {
+			break
+		}
+
+		sb.WriteByte(byte(c))
+	}
+
+	return sb.String()
+}
+
+func run(ctx context.Context, args ...string) (string, error) {
+	var out bytes.Buffer
+
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...) //nolint:gosec
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+
+	if err := cmd.Run(); err != nil {
+		return out.String(), errors.Wrapf(err, "error running %v: %v", strings.Join(args, " "), strings.TrimSpace(out.String()))
+	}
+
+	return out.String(), nil
+}
@@ -0,0 +1,20 @@
+//go:build !darwin
+// +build !darwin
+
+package apfs
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+)
+
+// Create creates a local snapshot of the APFS volume containing the provided path and mounts it read-only.
+func Create(ctx context.Context, path string) (*Snapshot, error) {
+	return nil, errors.New("APFS snapshots are only supported on macOS")
+}
+
+// Release unmounts and deletes the snapshot.
+func (s *Snapshot) Release(ctx context.Context) error {
+	return nil
+}
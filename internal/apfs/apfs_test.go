@@ -0,0 +1,41 @@
+package apfs
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestParseLocalSnapshotDate(t *testing.T) {
+	date, err := parseLocalSnapshotDate("NOTE: local snapshots are considered purgeable\nCreated local snapshot with date: 2020-05-06-071520\n")
+	if err != nil {
+		t.Fatalf("unable to parse date: %v", err)
+	}
+
+	if got, want := date, "2020-05-06-071520"; got != want {
+		t.Errorf("unexpected date: %v, want %v", got, want)
+	}
+
+	if _, err := parseLocalSnapshotDate("Failed to create local snapshot"); err == nil {
+		t.Errorf("expected error")
+	}
+}
+
+func TestSnapshotPath(t *testing.T) {
+	cases := []struct {
+		volume, original, want string
+	}{
+		{"/", "/Applications/Foo.app", "/mnt/Applications/Foo.app"},
+		{"/System/Volumes/Data", "/Users/foo", "/mnt/Users/foo"},
+		{"/System/Volumes/Data", "/System/Volumes/Data/Users/foo", "/mnt/Users/foo"},
+		{"/System/Volumes/Data", "/System/Volumes/Data", "/mnt"},
+		{"/Volumes/External", "/Volumes/External/photos", "/mnt/photos"},
+	}
+
+	for _, tc := range cases {
+		s := &Snapshot{Date: "2020-05-06-071520", Volume: tc.volume, MountPoint: "/mnt"}
+
+		if got, want := s.Path(tc.original), filepath.FromSlash(tc.want); got != want {
+			t.Errorf("unexpected path of %v on %v: %v, want %v", tc.original, tc.volume, got, want)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+// Package bloom implements a compact Bloom filter for quickly testing set membership.
+package bloom
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"math"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	formatMagic = "BLM1"
+	headerSize  = 12 // magic + number of hash functions + number of words
+
+	maxHashFunctions = 30
+)
+
+// Filter is a Bloom filter, which can report false positives but never false negatives.
+type Filter struct {
+	bits []uint64
+	k    uint32
+}
+
+// New creates a filter sized for the given number of items and desired false positive rate.
+func New(itemCount int, falsePositiveRate float64) *Filter {
+	if itemCount < 1 {
+		itemCount = 1
+	}
+
+	// optimal number of bits m = -n*ln(p)/(ln 2)^2 and number of hash functions k = m/n*ln(2)
+	m := math.Ceil(-float64(itemCount) * math.Log(falsePositiveRate) / (math.Ln2 * math.Ln2))
+	k := uint32(math.Round(m / float64(itemCount) * math.Ln2))
+
+	if k < 1 {
+		k = 1
+	}
+
+	if k > maxHashFunctions {
+		k = maxHashFunctions
+	}
+
+	return &Filter{
+		bits: make([]uint64, (int(m)+63)/64), //nolint:gomnd
+		k:    k,
+	}
+}
+
+func hashes(key []byte) (h1, h2 uint32) {
+	h := fnv.New64a()
+	h.Write(key) //nolint:errcheck
+
+	v := h.Sum64()
+
+	return uint32(v), uint32(v>>32) | 1 //nolint:gomnd
+}
+
+// Add adds the key to the filter.
+func (f *Filter) Add(key []byte) {
+	h1, h2 := hashes(key)
+	m := uint32(len(f.bits) * 64) //nolint:gomnd
+
+	for i := uint32(0); i < f.k; i++ {
+		bit := (h1 + i*h2) % m
+		f.bits[bit/64] |= 1 << (bit % 64)
+	}
+}
+
+// MayContain returns false if the key is definitely not in the filter. When it returns true
+// the key is likely, but not guaranteed to have been added.
+func (f *Filter) MayContain(key []byte) bool {
+	h1, h2 := hashes(key)
+	m := uint32(len(f.bits) * 64) //nolint:gomnd
+
+	for i := uint32(0); i < f.k; i++ {
+		bit := (h1 + i*h2) % m
+		if f.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// MarshalBinary returns the serialized representation of the filter.
+func (f *Filter) MarshalBinary() ([]byte, error) {
+	b := make([]byte, headerSize+8*len(f.bits)) //nolint:gomnd
+
+	copy(b, formatMagic)
+	binary.LittleEndian.PutUint32(b[4:], f.k)
+	binary.LittleEndian.PutUint32(b[8:], uint32(len(f.bits)))
+
+	for i, w := range f.bits {
+		binary.LittleEndian.PutUint64(b[headerSize+8*i:], w)
+	}
+
+	return b, nil
+}
+
+// Unmarshal deserializes the filter previously serialized using MarshalBinary.
+func Unmarshal(b []byte) (*Filter, error) {
+	if len(b) < headerSize || string(b[0:4]) != formatMagic {
+		return nil, errors.New("invalid filter header")
+	}
+
+	k := binary.LittleEndian.Uint32(b[4:])
+	words := int(binary.LittleEndian.Uint32(b[8:]))
+
+	if k < 1 || k > maxHashFunctions || words < 1 || len(b) != headerSize+8*words {
+		return nil, errors.New("invalid filter length")
+	}
+
+	f := &Filter{
+		bits: make([]uint64, words),
+		k:    k,
+	}
+
+	for i := range f.bits {
+		f.bits[i] = binary.LittleEndian.Uint64(b[headerSize+8*i:])
+	}
+
+	return f, nil
+}
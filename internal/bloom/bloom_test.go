@@ -0,0 +1,59 @@
+package bloom
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestFilter(t *testing.T) {
+	const (
+		itemCount = 10000
+		fpRate    = 0.01
+	)
+
+	f := New(itemCount, fpRate)
+
+	for i := 0; i < itemCount; i++ {
+		f.Add([]byte(fmt.Sprintf("item-%v", i)))
+	}
+
+	b, err := f.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f2, err := Unmarshal(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, f := range []*Filter{f, f2} {
+		for i := 0; i < itemCount; i++ {
+			if !f.MayContain([]byte(fmt.Sprintf("item-%v", i))) {
+				t.Fatalf("false negative for item %v", i)
+			}
+		}
+
+		var falsePositives int
+
+		for i := 0; i < itemCount; i++ {
+			if f.MayContain([]byte(fmt.Sprintf("other-%v", i))) {
+				falsePositives++
+			}
+		}
+
+		if got, max := float64(falsePositives)/itemCount, 2*fpRate; got > max {
+			t.Errorf("false positive rate too high: %v, want at most %v", got, max)
+		}
+	}
+}
+
+func TestUnmarshalInvalid(t *testing.T) {
+	b, _ := New(10, 0.01).MarshalBinary()
+
+	for _, tc := range [][]byte{nil, []byte("BLM1"), b[0 : len(b)-1], append([]byte("XXXX"), b[4:]...)} {
+		if _, err := Unmarshal(tc); err == nil {
+			t.Errorf("expected error for %x", tc)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+// Package clock provides the local time source and helpers for comparing local time with timestamps
+// produced by other clocks, such as those of other clients or storage providers.
+package clock
+
+import "time"
+
+// MaxSkew is the maximum tolerated difference between the local clock and clocks of other clients
+// and storage providers.
+const MaxSkew = 5 * time.Minute
+
+// Now returns the current local time.
+func Now() time.Time {
+	return time.Now() // allow:no-inject-time
+}
+
+// OlderThan returns true if the timestamp t produced by another clock is older than d at local time now,
+// even if the other clock was behind the local one by up to MaxSkew.
+//
+// It is used to decide whether data can be expired or deleted, so in case of doubt it reports that
+// the timestamp is not old enough. A non-positive d requests no safety margin and always returns true.
+func OlderThan(now, t time.Time, d time.Duration) bool {
+	if d <= 0 {
+		return true
+	}
+
+	return now.Sub(t) > d+MaxSkew
+}
+
+// InFuture returns true if the timestamp t is later than local time now by more than MaxSkew,
+// which indicates that it was produced by a clock that was ahead or that the local clock went back.
+func InFuture(now, t time.Time) bool {
+	return t.Sub(now) > MaxSkew
+}
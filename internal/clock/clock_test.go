@@ -0,0 +1,46 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestOlderThan(t *testing.T) {
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		t    time.Time
+		d    time.Duration
+		want bool
+	}{
+		{now, 0, true},
+		{now, time.Hour, false},
+		{now.Add(-time.Hour), time.Hour, false},
+		{now.Add(-time.Hour - MaxSkew), time.Hour, false},
+		{now.Add(-time.Hour - MaxSkew - time.Second), time.Hour, true},
+		{now.Add(time.Hour), time.Hour, false},
+		{now.Add(time.Hour), -1, true},
+	}
+
+	for _, tc := range cases {
+		if got := OlderThan(now, tc.t, tc.d); got != tc.want {
+			t.Errorf("OlderThan(%v, %v, %v) = %v, want %v", now, tc.t, tc.d, got, tc.want)
+		}
+	}
+}
+
+func TestInFuture(t *testing.T) {
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	if InFuture(now, now.Add(MaxSkew)) {
+		t.Errorf("timestamp within tolerance reported in the future")
+	}
+
+	if !InFuture(now, now.Add(MaxSkew+time.Second)) {
+		t.Errorf("timestamp beyond tolerance not reported in the future")
+	}
+
+	if InFuture(now, now.Add(-time.Hour)) {
+		t.Errorf("past timestamp reported in the future")
+	}
+}
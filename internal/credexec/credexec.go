@@ -0,0 +1,80 @@
+// Package credexec obtains storage credentials at runtime by invoking an external command.
+//
+// The command is executed without a shell and must print a single JSON object to its standard
+// output, for example:
+//
+//	{
+//	  "accessKeyID": "...",
+//	  "secretAccessKey": "...",
+//	  "sessionToken": "...",
+//	  "token": "...",
+//	  "expiration": "2020-04-01T12:00:00Z"
+//	}
+//
+// Fields that don't apply to a particular storage type can be omitted. When expiration is present,
+// the command is invoked again shortly before that time, which allows credentials to be refreshed
+// while long-running operations are in progress. This makes it possible to integrate secret stores
+// such as HashiCorp Vault by providing a small wrapper script.
+package credexec
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ExpiryWindow is the amount of time before expiration at which credentials are considered expired
+// and are obtained again.
+const ExpiryWindow = 5 * time.Minute
+
+// Credentials represents the credentials returned by the external command.
+type Credentials struct {
+	AccessKeyID     string    `json:"accessKeyID,omitempty"`
+	SecretAccessKey string    `json:"secretAccessKey,omitempty"`
+	SessionToken    string    `json:"sessionToken,omitempty"`
+	Token           string    `json:"token,omitempty"`
+	Expiration      time.Time `json:"expiration,omitempty"`
+}
+
+// RefreshAfter returns the time at which the credentials should be refreshed or zero time
+// if they don't expire.
+func (c *Credentials) RefreshAfter() time.Time {
+	if c.Expiration.IsZero() {
+		return time.Time{}
+	}
+
+	return c.Expiration.Add(-ExpiryWindow)
+}
+
+// Run invokes the provided command, which may include arguments separated by spaces,
+// and parses the credentials it prints.
+func Run(ctx context.Context, command string) (*Credentials, error) {
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return nil, errors.New("credentials command not provided")
+	}
+
+	var stdout bytes.Buffer
+
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...) //nolint:gosec
+	cmd.Stdout = &stdout
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, errors.Wrapf(err, "error running credentials command %v", args[0])
+	}
+
+	var c Credentials
+
+	if err := json.Unmarshal(stdout.Bytes(), &c); err != nil {
+		return nil, errors.Wrapf(err, "invalid output of credentials command %v", args[0])
+	}
+
+	return &c, nil
+}
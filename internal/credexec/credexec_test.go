@@ -0,0 +1,43 @@
+package credexec_test
+
+import (
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/kopia/kopia/internal/credexec"
+	"github.com/kopia/kopia/internal/testlogging"
+)
+
+func TestRun(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test relies on 'echo' command")
+	}
+
+	ctx := testlogging.Context(t)
+
+	c, err := credexec.Run(ctx, `echo {"accessKeyID":"ak","secretAccessKey":"sak","expiration":"2020-04-01T12:00:00Z"}`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if c.AccessKeyID != "ak" || c.SecretAccessKey != "sak" {
+		t.Errorf("unexpected credentials: %+v", c)
+	}
+
+	if want := time.Date(2020, 4, 1, 11, 55, 0, 0, time.UTC); !c.RefreshAfter().Equal(want) {
+		t.Errorf("unexpected refresh time: %v, want %v", c.RefreshAfter(), want)
+	}
+
+	if _, err := credexec.Run(ctx, "echo not-json"); err == nil {
+		t.Errorf("expected error on invalid output")
+	}
+
+	if _, err := credexec.Run(ctx, "false"); err == nil {
+		t.Errorf("expected error on failed command")
+	}
+
+	if _, err := credexec.Run(ctx, " "); err == nil {
+		t.Errorf("expected error on empty command")
+	}
+}
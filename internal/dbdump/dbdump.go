@@ -0,0 +1,228 @@
+// Package dbdump streams dumps of PostgreSQL and MySQL databases produced by pg_dump and mysqldump
+// as virtual files, so that they can be snapshotted without temporary files.
+//
+// Dumps are written in plain SQL format without timestamps, which makes unchanged parts of
+// the database deduplicate with previous snapshots. Passwords are not passed on the command line,
+// use PGPASSWORD, MYSQL_PWD or the configuration files of the tools instead.
+package dbdump
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/fs"
+	"github.com/kopia/kopia/fs/virtualfs"
+)
+
+// Supported database types.
+const (
+	TypePostgres = "postgres"
+	TypeMySQL    = "mysql"
+)
+
+// maxErrorOutput is the maximum length of the error output of the dump command included in errors.
+const maxErrorOutput = 4096
+
+// Options describes the databases to dump.
+type Options struct {
+	Type      string
+	Databases []string
+
+	Host string
+	Port int
+	User string
+
+	// DumpCommand overrides pg_dump or mysqldump and may include arguments separated by spaces.
+	DumpCommand string
+
+	// ExtraArgs are passed to the dump command before the database name.
+	ExtraArgs []string
+}
+
+// Validate returns an error if the options are invalid.
+func (o *Options) Validate() error {
+	switch o.Type {
+	case TypePostgres, TypeMySQL:
+	default:
+		return errors.Errorf("unsupported database type %q", o.Type)
+	}
+
+	if len(o.Databases) == 0 {
+		return errors.New("no databases to dump")
+	}
+
+	seen := map[string]bool{}
+
+	for _, db := range o.Databases {
+		if db == "" || strings.ContainsAny(db, `/\`) {
+			return errors.Errorf("invalid database name %q", db)
+		}
+
+		if seen[db] {
+			return errors.Errorf("duplicate database %q", db)
+		}
+
+		seen[db] = true
+	}
+
+	return nil
+}
+
+// DumpArgs returns the command line dumping the provided database.
+func (o *Options) DumpArgs(db string) []string {
+	var args []string
+
+	switch o.Type {
+	case TypePostgres:
+		args = []string{"pg_dump", "--format=plain", "--no-password"}
+
+		args = appendIfSet(args, "--host=", o.Host)
+		args = appendIfSet(args, "--username=", o.User)
+
+	case TypeMySQL:
+		args = []string{"mysqldump", "--single-transaction", "--skip-dump-date", "--routines", "--triggers"}
+
+		args = appendIfSet(args, "--host=", o.Host)
+		args = appendIfSet(args, "--user=", o.User)
+	}
+
+	if o.Port != 0 {
+		args = append(args, "--port="+strconv.Itoa(o.Port))
+	}
+
+	if c := strings.Fields(o.DumpCommand); len(c) > 0 {
+		args = append(c, args[1:]...)
+	}
+
+	args = append(args, o.ExtraArgs...)
+
+	if o.Type == TypeMySQL {
+		return append(args, "--databases", db)
+	}
+
+	return append(args, "--dbname="+db)
+}
+
+func appendIfSet(args []string, flag, value string) []string {
+	if value == "" {
+		return args
+	}
+
+	return append(args, flag+value)
+}
+
+// Root returns the directory containing dumps of all databases named after the database with .sql extension.
+func Root(name string, o *Options) (fs.Directory, error) {
+	if err := o.Validate(); err != nil {
+		return nil, err
+	}
+
+	var entries fs.Entries
+
+	for _, db := range o.Databases {
+		args := o.DumpArgs(db)
+
+		entries = append(entries, virtualfs.NewStreamingFile(db+".sql", func(ctx context.Context) (io.ReadCloser, error) {
+			return startCommand(ctx, args)
+		}))
+	}
+
+	return virtualfs.NewStaticDirectory(name, entries), nil
+}
+
+// commandOutput is the output of a running command, which fails at the end of the output when the command failed.
+type commandOutput struct {
+	cmd    *exec.Cmd
+	stdout io.ReadCloser
+	stderr bytes.Buffer
+	err    error
+	done   bool
+}
+
+func startCommand(ctx context.Context, args []string) (*commandOutput, error) {
+	c := &commandOutput{
+		cmd: exec.CommandContext(ctx, args[0], args[1:]...), //nolint:gosec
+	}
+
+	c.cmd.Stderr = &limitedWriter{&c.stderr, maxErrorOutput}
+
+	var err error
+
+	if c.stdout, err = c.cmd.StdoutPipe(); err != nil {
+		return nil, errors.Wrap(err, "unable to create pipe")
+	}
+
+	if err := c.cmd.Start(); err != nil {
+		return nil, errors.Wrapf(err, "unable to start %v", args[0])
+	}
+
+	return c, nil
+}
+
+func (c *commandOutput) Read(p []byte) (int, error) {
+	if c.done {
+		return 0, c.err
+	}
+
+	n, err := c.stdout.Read(p)
+	if err == io.EOF {
+		c.done = true
+		c.err = c.wait()
+
+		if c.err == nil {
+			c.err = io.EOF
+		}
+
+		return n, c.err
+	}
+
+	return n, err
+}
+
+func (c *commandOutput) wait() error {
+	if err := c.cmd.Wait(); err != nil {
+		return errors.Wrapf(err, "%v failed: %v", c.cmd.Args[0], strings.TrimSpace(c.stderr.String()))
+	}
+
+	return nil
+}
+
+// Close stops the command if its output was not read to the end.
+func (c *commandOutput) Close() error {
+	if c.done {
+		return nil
+	}
+
+	c.done = true
+	c.err = errors.New("command output closed")
+
+	c.cmd.Process.Kill() //nolint:errcheck
+	c.cmd.Wait()         //nolint:errcheck
+
+	return nil
+}
+
+// limitedWriter discards data written after the limit.
+type limitedWriter struct {
+	w         *bytes.Buffer
+	remaining int
+}
+
+func (l *limitedWriter) Write(p []byte) (int, error) {
+	n := len(p)
+
+	if len(p) > l.remaining {
+		p = p[0:l.remaining]
+	}
+
+	l.remaining -= len(p)
+	l.w.Write(p) //nolint:errcheck
+
+	return n, nil
+}
@@ -0,0 +1,130 @@
+package dbdump
+
+import (
+	"context"
+	"io/ioutil"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/kopia/kopia/fs"
+)
+
+func TestDumpArgs(t *testing.T) {
+	cases := []struct {
+		opt  Options
+		want string
+	}{
+		{
+			Options{Type: TypePostgres, Databases: []string{"app"}},
+			"pg_dump --format=plain --no-password --dbname=app",
+		},
+		{
+			Options{Type: TypePostgres, Host: "db", Port: 5433, User: "backup", ExtraArgs: []string{"--schema=public"}},
+			"pg_dump --format=plain --no-password --host=db --username=backup --port=5433 --schema=public --dbname=app",
+		},
+		{
+			Options{Type: TypeMySQL, Host: "db", User: "root"},
+			"mysqldump --single-transaction --skip-dump-date --routines --triggers --host=db --user=root --databases app",
+		},
+		{
+			Options{Type: TypeMySQL, DumpCommand: "docker exec db mysqldump"},
+			"docker exec db mysqldump --single-transaction --skip-dump-date --routines --triggers --databases app",
+		},
+	}
+
+	for _, tc := range cases {
+		if got := strings.Join(tc.opt.DumpArgs("app"), " "); got != tc.want {
+			t.Errorf("unexpected args: %v, want %v", got, tc.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	invalid := []Options{
+		{Type: "oracle", Databases: []string{"app"}},
+		{Type: TypePostgres},
+		{Type: TypePostgres, Databases: []string{"a/b"}},
+		{Type: TypeMySQL, Databases: []string{"app", "app"}},
+	}
+
+	for _, o := range invalid {
+		o := o
+		if err := o.Validate(); err == nil {
+			t.Errorf("expected error for %+v", o)
+		}
+	}
+}
+
+func TestRootStreamsCommandOutput(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires echo and false commands")
+	}
+
+	ctx := context.Background()
+
+	root, err := Root("dumps", &Options{Type: TypePostgres, Databases: []string{"b", "a"}, DumpCommand: "echo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := root.Readdir(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := entryNames(entries), "a.sql b.sql"; got != want {
+		t.Fatalf("unexpected entries: %v, want %v", got, want)
+	}
+
+	r, err := entries[0].(fs.File).Open(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("unable to read dump: %v", err)
+	}
+
+	r.Close() //nolint:errcheck
+
+	if got, want := string(data), "--format=plain --no-password --dbname=a\n"; got != want {
+		t.Errorf("unexpected dump: %q, want %q", got, want)
+	}
+
+	if got, want := entries[0].Size(), int64(len(data)); got != want {
+		t.Errorf("unexpected size: %v, want %v", got, want)
+	}
+
+	root, err = Root("dumps", &Options{Type: TypePostgres, Databases: []string{"a"}, DumpCommand: "false"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := root.Child(ctx, "a.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err = f.(fs.File).Open(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ioutil.ReadAll(r); err == nil || !strings.Contains(err.Error(), "false failed") {
+		t.Errorf("expected failure of the dump command, got %v", err)
+	}
+
+	r.Close() //nolint:errcheck
+}
+
+func entryNames(entries fs.Entries) string {
+	var names []string
+
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+
+	return strings.Join(names, " ")
+}
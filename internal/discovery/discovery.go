@@ -0,0 +1,177 @@
+// Package discovery finds directories on the local machine that are good candidates for snapshot sources.
+package discovery
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// Volumes returns mount points of local volumes (or drive roots on Windows).
+func Volumes() []string {
+	switch runtime.GOOS {
+	case "windows":
+		return windowsDrives()
+	case "darwin":
+		return append([]string{"/"}, subdirectories("/Volumes")...)
+	case "linux":
+		return linuxMountPoints("/proc/mounts")
+	default:
+		return []string{"/"}
+	}
+}
+
+// HomeDirectories returns home directories of users of the local machine, or just of the current user
+// if the other home directories can't be listed.
+func HomeDirectories() []string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil
+	}
+
+	parent := filepath.Dir(home)
+	if parent == filepath.Dir(parent) {
+		// home directory directly under the root (such as /root), whose siblings aren't home directories.
+		return []string{home}
+	}
+
+	dirs := subdirectories(parent)
+
+	for _, d := range dirs {
+		if d == home {
+			return dirs
+		}
+	}
+
+	return []string{home}
+}
+
+func windowsDrives() []string {
+	var result []string
+
+	for c := 'A'; c <= 'Z'; c++ {
+		root := string(c) + `:\`
+		if _, err := os.Stat(root); err == nil {
+			result = append(result, root)
+		}
+	}
+
+	return result
+}
+
+// linuxMountPoints returns mount points of block devices listed in the provided mounts file.
+func linuxMountPoints(mountsFile string) []string {
+	mounts, err := LinuxMounts(mountsFile)
+	if err != nil {
+		return []string{"/"}
+	}
+
+	seen := map[string]bool{}
+
+	var result []string
+
+	for _, m := range mounts {
+		mp := m.MountPoint
+		if !strings.HasPrefix(m.Device, "/dev/") || seen[mp] || strings.HasPrefix(mp, "/boot") || strings.HasPrefix(mp, "/snap/") {
+			continue
+		}
+
+		seen[mp] = true
+
+		result = append(result, mp)
+	}
+
+	sort.Strings(result)
+
+	return result
+}
+
+// Mount describes a mounted file system.
+type Mount struct {
+	Device     string
+	MountPoint string
+	Type       string
+}
+
+// LinuxMounts returns file systems listed in the provided mounts file, such as /proc/self/mounts, in mount order.
+func LinuxMounts(mountsFile string) ([]Mount, error) {
+	f, err := os.Open(mountsFile) //nolint:gosec
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close() //nolint:errcheck
+
+	var result []Mount
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		// device, mount point, file system type, options...
+		fields := strings.Fields(s.Text())
+		if len(fields) < 3 { //nolint:gomnd
+			continue
+		}
+
+		// mount points have spaces and other special characters escaped as octal.
+		result = append(result, Mount{
+			Device:     unescapeMountPoint(fields[0]),
+			MountPoint: unescapeMountPoint(fields[1]),
+			Type:       fields[2],
+		})
+	}
+
+	return result, s.Err()
+}
+
+func unescapeMountPoint(s string) string {
+	var sb strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) {
+			var v byte
+
+			valid := true
+
+			for _, c := range []byte(s[i+1 : i+4]) {
+				if c < '0' || c > '7' {
+					valid = false
+					break
+				}
+
+				v = v*8 + (c - '0') //nolint:gomnd
+			}
+
+			if valid {
+				sb.WriteByte(v)
+
+				i += 3
+
+				continue
+			}
+		}
+
+		sb.WriteByte(s[i])
+	}
+
+	return sb.String()
+}
+
+func subdirectories(dir string) []string {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+
+	var result []string
+
+	for _, e := range entries {
+		if e.IsDir() && !strings.HasPrefix(e.Name(), ".") {
+			result = append(result, filepath.Join(dir, e.Name()))
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,58 @@
+package discovery
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLinuxMountPoints(t *testing.T) {
+	td, err := ioutil.TempDir("", "discovery")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(td)
+
+	mounts := filepath.Join(td, "mounts")
+
+	if err := ioutil.WriteFile(mounts, []byte(`sysfs /sys sysfs rw,nosuid 0 0
+proc /proc proc rw,nosuid 0 0
+/dev/sda1 / ext4 rw,relatime 0 0
+/dev/sda2 /boot/efi vfat rw 0 0
+/dev/sdb1 /mnt/my\040data ext4 rw 0 0
+/dev/loop0 /snap/core/123 squashfs ro 0 0
+/dev/sda1 / ext4 rw,relatime 0 0
+tmpfs /tmp tmpfs rw 0 0
+`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"/", "/mnt/my data"}
+	if got := linuxMountPoints(mounts); !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected mount points: %v, want %v", got, want)
+	}
+
+	if got, want := linuxMountPoints(filepath.Join(td, "no-such-file")), []string{"/"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected mount points: %v, want %v", got, want)
+	}
+}
+
+func TestUnescapeMountPoint(t *testing.T) {
+	cases := map[string]string{
+		`/mnt/a\040b`:  "/mnt/a b",
+		`/mnt/a\011b`:  "/mnt/a\tb",
+		`/mnt/a\\b`:    `/mnt/a\\b`,
+		`/mnt/a\09`:    `/mnt/a\09`,
+		`/mnt/plain`:   "/mnt/plain",
+		`/mnt/trail\0`: `/mnt/trail\0`,
+	}
+
+	for input, want := range cases {
+		if got := unescapeMountPoint(input); got != want {
+			t.Errorf("unescapeMountPoint(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+// Package dockervolume inspects and reads Docker volumes using the docker command line.
+package dockervolume
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultHelperImage is the image of the helper container used to read volumes whose mount point
+// is not accessible, which must provide the tar command.
+const DefaultHelperImage = "busybox"
+
+// helperMountPath is where the volume is mounted in the helper container.
+const helperMountPath = "/volume"
+
+// Volume describes a Docker volume.
+type Volume struct {
+	Name       string            `json:"Name"`
+	Driver     string            `json:"Driver"`
+	Mountpoint string            `json:"Mountpoint"`
+	Labels     map[string]string `json:"Labels"`
+
+	// Containers are the names of containers using the volume.
+	Containers []string `json:"-"`
+}
+
+// Client invokes the docker command.
+type Client struct {
+	command []string
+
+	// run executes the command with the provided arguments writing its output to stdout.
+	run func(ctx context.Context, stdout io.Writer, args []string) error
+}
+
+// NewClient returns a client invoking the provided command, which may include arguments separated by spaces,
+// such as "sudo docker" or "podman".
+func NewClient(command string) (*Client, error) {
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return nil, errors.New("docker command not provided")
+	}
+
+	return &Client{command: args, run: runCommand}, nil
+}
+
+// Inspect returns information about the volume and the containers using it.
+func (c *Client) Inspect(ctx context.Context, name string) (*Volume, error) {
+	var out bytes.Buffer
+
+	if err := c.docker(ctx, &out, "volume", "inspect", "--format", "{{json .}}", name); err != nil {
+		return nil, err
+	}
+
+	v := &Volume{}
+	if err := json.Unmarshal(out.Bytes(), v); err != nil {
+		return nil, errors.Wrap(err, "invalid volume information")
+	}
+
+	out.Reset()
+
+	if err := c.docker(ctx, &out, "ps", "--all", "--filter", "volume="+name, "--format", "{{.Names}}"); err != nil {
+		return nil, err
+	}
+
+	v.Containers = strings.Fields(out.String())
+	sort.Strings(v.Containers)
+
+	return v, nil
+}
+
+// Export writes the contents of the volume as a tar archive, read by a helper container running the
+// provided image, which works even when the mount point is not accessible, such as when Docker runs
+// in a virtual machine or the volume uses a remote driver.
+func (c *Client) Export(ctx context.Context, name, image string, w io.Writer) error {
+	return c.docker(ctx, w, "run", "--rm", "--network=none",
+		"--volume", name+":"+helperMountPath+":ro",
+		image, "tar", "-C", helperMountPath, "-cf", "-", ".")
+}
+
+func (c *Client) docker(ctx context.Context, stdout io.Writer, args ...string) error {
+	return c.run(ctx, stdout, append(append([]string(nil), c.command...), args...))
+}
+
+func runCommand(ctx context.Context, stdout io.Writer, args []string) error {
+	var stderr bytes.Buffer
+
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...) //nolint:gosec
+	cmd.Stdout = stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return errors.Wrapf(err, "error running %v: %v", strings.Join(args, " "), strings.TrimSpace(stderr.String()))
+	}
+
+	return nil
+}
@@ -0,0 +1,91 @@
+package dockervolume
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestInspect(t *testing.T) {
+	c, err := NewClient("sudo docker")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var invoked [][]string
+
+	c.run = func(ctx context.Context, stdout io.Writer, args []string) error {
+		invoked = append(invoked, args)
+
+		switch args[2] {
+		case "volume":
+			io.WriteString(stdout, `{"Name":"data","Driver":"local","Mountpoint":"/var/lib/docker/volumes/data/_data","Labels":{"app":"web"}}`) //nolint:errcheck
+		case "ps":
+			io.WriteString(stdout, "web-2\nweb-1\n") //nolint:errcheck
+		default:
+			return errors.Errorf("unexpected command: %v", args)
+		}
+
+		return nil
+	}
+
+	v, err := c.Inspect(context.Background(), "data")
+	if err != nil {
+		t.Fatalf("unable to inspect: %v", err)
+	}
+
+	want := &Volume{
+		Name:       "data",
+		Driver:     "local",
+		Mountpoint: "/var/lib/docker/volumes/data/_data",
+		Labels:     map[string]string{"app": "web"},
+		Containers: []string{"web-1", "web-2"},
+	}
+
+	if !reflect.DeepEqual(v, want) {
+		t.Errorf("unexpected volume: %+v, want %+v", v, want)
+	}
+
+	if got, want := strings.Join(invoked[1], " "), "sudo docker ps --all --filter volume=data --format {{.Names}}"; got != want {
+		t.Errorf("unexpected command: %v, want %v", got, want)
+	}
+}
+
+func TestExport(t *testing.T) {
+	c, err := NewClient("docker")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var invoked []string
+
+	c.run = func(ctx context.Context, stdout io.Writer, args []string) error {
+		invoked = args
+		_, err := io.WriteString(stdout, "tar-data")
+
+		return err
+	}
+
+	var out bytes.Buffer
+
+	if err := c.Export(context.Background(), "data", DefaultHelperImage, &out); err != nil {
+		t.Fatalf("unable to export: %v", err)
+	}
+
+	if got, want := strings.Join(invoked, " "), "docker run --rm --network=none --volume data:/volume:ro busybox tar -C /volume -cf - ."; got != want {
+		t.Errorf("unexpected command: %v, want %v", got, want)
+	}
+
+	if out.String() != "tar-data" {
+		t.Errorf("unexpected output: %q", out.String())
+	}
+
+	if _, err := NewClient(" "); err == nil {
+		t.Errorf("expected error for empty command")
+	}
+}
@@ -0,0 +1,311 @@
+// Package fssnapshot creates temporary LVM, btrfs or ZFS snapshots of the file system containing a source,
+// so that the source can be read from a consistent point-in-time view of files being modified.
+//
+// Creating snapshots requires running as root and the lvm2, btrfs-progs or zfs command-line tools.
+package fssnapshot
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/discovery"
+	"github.com/kopia/kopia/repo/logging"
+)
+
+var log = logging.GetContextLoggerFunc("kopia/fssnapshot")
+
+// Supported types of snapshots.
+const (
+	TypeLVM   = "lvm"
+	TypeBtrfs = "btrfs"
+	TypeZFS   = "zfs"
+)
+
+const (
+	defaultMountsFile      = "/proc/self/mounts"
+	defaultLVMSnapshotSize = "1G"
+
+	// snapshotNamePrefix identifies snapshots created by kopia, which makes leftovers easy to find.
+	snapshotNamePrefix = "kopia-"
+	snapshotTimeFormat = "20060102-150405"
+
+	// btrfsSnapshotDirPrefix is the prefix of the snapshot subvolume created in the root of the file system.
+	btrfsSnapshotDirPrefix = ".kopia-snapshot-"
+)
+
+// Options describes the snapshot to create.
+type Options struct {
+	Type string
+
+	// LVMSnapshotSize is the size of the LVM snapshot volume passed to lvcreate.
+	LVMSnapshotSize string
+}
+
+// Snapshot is a snapshot of a file system whose contents are accessible in a directory.
+type Snapshot struct {
+	Type string
+
+	// Name identifies the snapshot - the logical volume, subvolume path or ZFS snapshot.
+	Name string
+
+	// Volume is the mount point of the snapshotted file system.
+	Volume string
+
+	// MountPoint is the directory containing the snapshot of the root of the file system.
+	MountPoint string
+
+	// mounted is set when the snapshot has been mounted by kopia and must be unmounted.
+	mounted bool
+
+	run runFunc
+}
+
+// runFunc runs the provided command and returns its combined output.
+type runFunc func(ctx context.Context, args ...string) (string, error)
+
+// creator creates snapshots, the mounts file and commands are replaceable for testing.
+type creator struct {
+	mountsFile string
+	run        runFunc
+	now        func() time.Time
+	tempDir    func() (string, error)
+}
+
+// Create creates a snapshot of the file system containing the provided absolute path and makes it accessible.
+func Create(ctx context.Context, path string, opt Options) (*Snapshot, error) {
+	c := &creator{
+		mountsFile: defaultMountsFile,
+		run:        run,
+		now:        time.Now,
+		tempDir: func() (string, error) {
+			return ioutil.TempDir("", "kopia-"+opt.Type+"-")
+		},
+	}
+
+	return c.create(ctx, path, opt)
+}
+
+// Open creates a snapshot of the file system containing the provided path and returns the corresponding path
+// in the snapshot along with the function that removes the snapshot.
+func Open(ctx context.Context, path string, opt Options) (string, func(), error) {
+	// the file system and path within the snapshot must be determined from the real path.
+	realPath, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", nil, errors.Wrap(err, "evaluate symlink")
+	}
+
+	s, err := Create(ctx, realPath, opt)
+	if err != nil {
+		return "", nil, errors.Wrapf(err, "unable to create %v snapshot", opt.Type)
+	}
+
+	log(ctx).Infof("reading %v from %v snapshot %v of %v", path, s.Type, s.Name, s.Volume)
+
+	return s.Path(realPath), func() {
+		if err := s.Release(ctx); err != nil {
+			log(ctx).Warningf("unable to release %v snapshot %v: %v", s.Type, s.Name, err)
+		}
+	}, nil
+}
+
+func (c *creator) create(ctx context.Context, path string, opt Options) (*Snapshot, error) {
+	mounts, err := discovery.LinuxMounts(c.mountsFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to list mounted file systems")
+	}
+
+	m, ok := findMount(mounts, path)
+	if !ok {
+		return nil, errors.Errorf("unable to find file system containing %v", path)
+	}
+
+	name := snapshotNamePrefix + c.now().Format(snapshotTimeFormat)
+
+	switch opt.Type {
+	case TypeLVM:
+		return c.createLVM(ctx, m, name, opt.LVMSnapshotSize)
+	case TypeBtrfs:
+		return c.createBtrfs(ctx, m, name)
+	case TypeZFS:
+		return c.createZFS(ctx, m, name)
+	default:
+		return nil, errors.Errorf("unsupported snapshot type %q", opt.Type)
+	}
+}
+
+func (c *creator) createLVM(ctx context.Context, m discovery.Mount, name, size string) (*Snapshot, error) {
+	out, err := c.run(ctx, "lvs", "--noheadings", "-o", "vg_name,lv_name", m.Device)
+	if err != nil {
+		return nil, errors.Wrapf(err, "%v is not on an LVM logical volume", m.MountPoint)
+	}
+
+	vg, lv, err := parseLogicalVolume(out)
+	if err != nil {
+		return nil, err
+	}
+
+	if size == "" {
+		size = defaultLVMSnapshotSize
+	}
+
+	s := &Snapshot{Type: TypeLVM, Name: vg + "/" + name, Volume: m.MountPoint, run: c.run}
+
+	if _, err := c.run(ctx, "lvcreate", "--snapshot", "--size", size, "--name", name, vg+"/"+lv); err != nil {
+		return nil, err
+	}
+
+	if s.MountPoint, err = c.tempDir(); err != nil {
+		s.deleteSnapshot(ctx) //nolint:errcheck
+		return nil, errors.Wrap(err, "unable to create mount point")
+	}
+
+	options := "ro"
+	if m.Type == "xfs" {
+		// XFS refuses to mount a snapshot along with its origin, which has the same UUID.
+		options += ",nouuid"
+	}
+
+	if _, err := c.run(ctx, "mount", "-t", m.Type, "-o", options, "/dev/"+s.Name, s.MountPoint); err != nil {
+		os.Remove(s.MountPoint) //nolint:errcheck
+		s.deleteSnapshot(ctx)   //nolint:errcheck
+
+		return nil, err
+	}
+
+	s.mounted = true
+
+	return s, nil
+}
+
+func (c *creator) createBtrfs(ctx context.Context, m discovery.Mount, name string) (*Snapshot, error) {
+	if m.Type != TypeBtrfs {
+		return nil, errors.Errorf("%v is on a %v file system, not btrfs", m.MountPoint, m.Type)
+	}
+
+	// nested subvolumes are not included in the snapshot and appear as empty directories.
+	dir := filepath.Join(m.MountPoint, btrfsSnapshotDirPrefix+strings.TrimPrefix(name, snapshotNamePrefix))
+
+	if _, err := c.run(ctx, "btrfs", "subvolume", "snapshot", "-r", m.MountPoint, dir); err != nil {
+		return nil, err
+	}
+
+	return &Snapshot{Type: TypeBtrfs, Name: dir, Volume: m.MountPoint, MountPoint: dir, run: c.run}, nil
+}
+
+func (c *creator) createZFS(ctx context.Context, m discovery.Mount, name string) (*Snapshot, error) {
+	if m.Type != TypeZFS {
+		return nil, errors.Errorf("%v is on a %v file system, not ZFS", m.MountPoint, m.Type)
+	}
+
+	// the device of a ZFS mount is the name of the dataset.
+	s := &Snapshot{
+		Type:   TypeZFS,
+		Name:   m.Device + "@" + name,
+		Volume: m.MountPoint,
+
+		// snapshots are mounted automatically when accessed through the hidden .zfs directory.
+		MountPoint: filepath.Join(m.MountPoint, ".zfs", "snapshot", name),
+		run:        c.run,
+	}
+
+	if _, err := c.run(ctx, "zfs", "snapshot", s.Name); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Path returns the path in the snapshot corresponding to the provided absolute path on the file system.
+func (s *Snapshot) Path(original string) string {
+	rel := original
+	if s.Volume != "/" {
+		rel = strings.TrimPrefix(original, s.Volume)
+	}
+
+	return filepath.Join(s.MountPoint, rel)
+}
+
+// Release unmounts and deletes the snapshot.
+func (s *Snapshot) Release(ctx context.Context) error {
+	if s.mounted {
+		if _, err := s.run(ctx, "umount", s.MountPoint); err != nil {
+			return err
+		}
+
+		os.Remove(s.MountPoint) //nolint:errcheck
+	}
+
+	return s.deleteSnapshot(ctx)
+}
+
+func (s *Snapshot) deleteSnapshot(ctx context.Context) error {
+	var err error
+
+	switch s.Type {
+	case TypeLVM:
+		_, err = s.run(ctx, "lvremove", "--force", s.Name)
+	case TypeBtrfs:
+		_, err = s.run(ctx, "btrfs", "subvolume", "delete", s.Name)
+	case TypeZFS:
+		_, err = s.run(ctx, "zfs", "destroy", s.Name)
+	}
+
+	return err
+}
+
+// findMount returns the most recent mount of the longest mount point containing the path.
+func findMount(mounts []discovery.Mount, path string) (discovery.Mount, bool) {
+	var (
+		result discovery.Mount
+		found  bool
+	)
+
+	for _, m := range mounts {
+		if !containsPath(m.MountPoint, path) {
+			continue
+		}
+
+		if !found || len(m.MountPoint) >= len(result.MountPoint) {
+			result = m
+			found = true
+		}
+	}
+
+	return result, found
+}
+
+func containsPath(dir, path string) bool {
+	return dir == "/" || path == dir || strings.HasPrefix(path, dir+"/")
+}
+
+// parseLogicalVolume parses the volume group and logical volume names printed by lvs.
+func parseLogicalVolume(output string) (vg, lv string, err error) {
+	fields := strings.Fields(output)
+	if len(fields) != 2 { //nolint:gomnd
+		return "", "", errors.Errorf("unexpected output of lvs: %v", strings.TrimSpace(output))
+	}
+
+	return fields[0], fields[1], nil
+}
+
+func run(ctx context.Context, args ...string) (string, error) {
+	var out bytes.Buffer
+
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...) //nolint:gosec
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+
+	if err := cmd.Run(); err != nil {
+		return out.String(), errors.Wrapf(err, "error running %v: %v", strings.Join(args, " "), strings.TrimSpace(out.String()))
+	}
+
+	return out.String(), nil
+}
@@ -0,0 +1,191 @@
+package fssnapshot
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/discovery"
+)
+
+const testMounts = `/dev/mapper/vg0-root / ext4 rw,relatime 0 0
+proc /proc proc rw,nosuid,nodev,noexec,relatime 0 0
+/dev/mapper/vg0-data /srv/data xfs rw,relatime 0 0
+/dev/sdb1 /mnt/pool btrfs rw,relatime,subvol=/ 0 0
+tank/home /home zfs rw,xattr,noacl 0 0
+tank/home/my\040user /home/my\040user zfs rw,xattr,noacl 0 0
+`
+
+type fakeRunner struct {
+	commands []string
+	outputs  map[string]string
+	fail     string
+}
+
+func (r *fakeRunner) run(ctx context.Context, args ...string) (string, error) {
+	cmd := strings.Join(args, " ")
+	r.commands = append(r.commands, cmd)
+
+	if r.fail != "" && args[0] == r.fail {
+		return "", errors.Errorf("%v failed", args[0])
+	}
+
+	return r.outputs[args[0]], nil
+}
+
+func newTestCreator(t *testing.T, r *fakeRunner) *creator {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "fssnapshot")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { os.RemoveAll(dir) }) //nolint:errcheck
+
+	mountsFile := filepath.Join(dir, "mounts")
+	if err := ioutil.WriteFile(mountsFile, []byte(testMounts), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return &creator{
+		mountsFile: mountsFile,
+		run:        r.run,
+		now: func() time.Time {
+			return time.Date(2020, 5, 1, 12, 30, 0, 0, time.UTC)
+		},
+		tempDir: func() (string, error) {
+			return "/tmp/mnt", nil
+		},
+	}
+}
+
+func TestFindMount(t *testing.T) {
+	mounts, err := discovery.LinuxMounts(newTestCreator(t, &fakeRunner{}).mountsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]string{
+		"/etc":                "/",
+		"/srv/data":           "/srv/data",
+		"/srv/data/x":         "/srv/data",
+		"/srv/database":       "/",
+		"/home/alice":         "/home",
+		"/home/my user/files": "/home/my user",
+	}
+
+	for path, want := range cases {
+		m, ok := findMount(mounts, path)
+		if !ok || m.MountPoint != want {
+			t.Errorf("unexpected mount of %v: %v, want %v", path, m.MountPoint, want)
+		}
+	}
+}
+
+func TestCreateLVM(t *testing.T) {
+	ctx := context.Background()
+	r := &fakeRunner{outputs: map[string]string{"lvs": "  vg0 data\n"}}
+
+	s, err := newTestCreator(t, r).create(ctx, "/srv/data/db", Options{Type: TypeLVM})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := s.Path("/srv/data/db"), "/tmp/mnt/db"; got != want {
+		t.Errorf("unexpected path: %v, want %v", got, want)
+	}
+
+	if err := s.Release(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	verifyCommands(t, r,
+		"lvs --noheadings -o vg_name,lv_name /dev/mapper/vg0-data",
+		"lvcreate --snapshot --size 1G --name kopia-20200501-123000 vg0/data",
+		"mount -t xfs -o ro,nouuid /dev/vg0/kopia-20200501-123000 /tmp/mnt",
+		"umount /tmp/mnt",
+		"lvremove --force vg0/kopia-20200501-123000")
+}
+
+func TestCreateLVMMountFailure(t *testing.T) {
+	r := &fakeRunner{outputs: map[string]string{"lvs": "  vg0 root\n"}, fail: "mount"}
+
+	if _, err := newTestCreator(t, r).create(context.Background(), "/etc", Options{Type: TypeLVM, LVMSnapshotSize: "10%ORIGIN"}); err == nil {
+		t.Fatal("expected error")
+	}
+
+	verifyCommands(t, r,
+		"lvs --noheadings -o vg_name,lv_name /dev/mapper/vg0-root",
+		"lvcreate --snapshot --size 10%ORIGIN --name kopia-20200501-123000 vg0/root",
+		"mount -t ext4 -o ro /dev/vg0/kopia-20200501-123000 /tmp/mnt",
+		"lvremove --force vg0/kopia-20200501-123000")
+}
+
+func TestCreateBtrfs(t *testing.T) {
+	ctx := context.Background()
+	r := &fakeRunner{}
+
+	s, err := newTestCreator(t, r).create(ctx, "/mnt/pool/photos", Options{Type: TypeBtrfs})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := s.Path("/mnt/pool/photos"), "/mnt/pool/.kopia-snapshot-20200501-123000/photos"; got != want {
+		t.Errorf("unexpected path: %v, want %v", got, want)
+	}
+
+	if err := s.Release(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	verifyCommands(t, r,
+		"btrfs subvolume snapshot -r /mnt/pool /mnt/pool/.kopia-snapshot-20200501-123000",
+		"btrfs subvolume delete /mnt/pool/.kopia-snapshot-20200501-123000")
+}
+
+func TestCreateZFS(t *testing.T) {
+	ctx := context.Background()
+	r := &fakeRunner{}
+
+	s, err := newTestCreator(t, r).create(ctx, "/home/my user/files", Options{Type: TypeZFS})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := s.Path("/home/my user/files"), "/home/my user/.zfs/snapshot/kopia-20200501-123000/files"; got != want {
+		t.Errorf("unexpected path: %v, want %v", got, want)
+	}
+
+	if err := s.Release(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	verifyCommands(t, r,
+		"zfs snapshot tank/home/my user@kopia-20200501-123000",
+		"zfs destroy tank/home/my user@kopia-20200501-123000")
+}
+
+func TestCreateWrongFileSystem(t *testing.T) {
+	c := newTestCreator(t, &fakeRunner{})
+
+	for _, opt := range []Options{{Type: TypeBtrfs}, {Type: TypeZFS}, {Type: "vss"}} {
+		if _, err := c.create(context.Background(), "/srv/data", opt); err == nil {
+			t.Errorf("expected error for %v", opt.Type)
+		}
+	}
+}
+
+func verifyCommands(t *testing.T, r *fakeRunner, want ...string) {
+	t.Helper()
+
+	if got := strings.Join(r.commands, "\n"); got != strings.Join(want, "\n") {
+		t.Errorf("unexpected commands:\n%v\nwant:\n%v", got, strings.Join(want, "\n"))
+	}
+}
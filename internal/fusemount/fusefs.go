@@ -75,14 +75,9 @@ func (dir *fuseDirectoryNode) Lookup(ctx context.Context, fileName string) (fuse
 }
 
 func (dir *fuseDirectoryNode) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
-	entries, err := dir.directory().Readdir(ctx)
-	if err != nil {
-		return nil, err
-	}
-
 	result := []fuse.Dirent{}
 
-	for _, e := range entries {
+	if err := fs.IterateEntries(ctx, dir.directory(), func(ctx context.Context, e fs.Entry) error {
 		dirent := fuse.Dirent{
 			Name: e.Name(),
 		}
@@ -97,6 +92,10 @@ func (dir *fuseDirectoryNode) ReadDirAll(ctx context.Context) ([]fuse.Dirent, er
 		}
 
 		result = append(result, dirent)
+
+		return nil
+	}); err != nil {
+		return nil, err
 	}
 
 	return result, nil
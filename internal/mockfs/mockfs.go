@@ -34,6 +34,7 @@ type entry struct {
 	size    int64
 	modTime time.Time
 	owner   fs.OwnerInfo
+	device  uint64
 }
 
 func (e entry) Name() string {
@@ -64,12 +65,27 @@ func (e entry) Owner() fs.OwnerInfo {
 	return e.owner
 }
 
+func (e entry) Device() uint64 {
+	return e.device
+}
+
+// SetDevice changes the device the entry is stored on.
+func (e *entry) SetDevice(dev uint64) {
+	e.device = dev
+}
+
+// SetModTime changes the modification time of the entry.
+func (e *entry) SetModTime(t time.Time) {
+	e.modTime = t
+}
+
 // Directory is mock in-memory implementation of fs.Directory
 type Directory struct {
 	entry
 
 	children     fs.Entries
 	readdirError error
+	readdirBlock <-chan struct{}
 }
 
 // Summary returns summary of a directory.
@@ -173,6 +189,12 @@ func (imd *Directory) FailReaddir(err error) {
 	imd.readdirError = err
 }
 
+// BlockReaddir causes the subsequent Readdir() calls to block until the provided channel is closed,
+// which simulates an unresponsive file system.
+func (imd *Directory) BlockReaddir(ch <-chan struct{}) {
+	imd.readdirBlock = ch
+}
+
 // Child gets the named child of a directory.
 func (imd *Directory) Child(ctx context.Context, name string) (fs.Entry, error) {
 	return fs.ReadDirAndFindChild(ctx, imd, name)
@@ -180,6 +202,10 @@ func (imd *Directory) Child(ctx context.Context, name string) (fs.Entry, error)
 
 // Readdir gets the contents of a directory.
 func (imd *Directory) Readdir(ctx context.Context) (fs.Entries, error) {
+	if imd.readdirBlock != nil {
+		<-imd.readdirBlock
+	}
+
 	if imd.readdirError != nil {
 		return nil, imd.readdirError
 	}
@@ -201,6 +227,17 @@ func (imf *File) SetContents(b []byte) {
 	}
 }
 
+// BlockOpen causes the subsequent Open() calls to block until the provided channel is closed,
+// which simulates an unresponsive file system.
+func (imf *File) BlockOpen(ch <-chan struct{}) {
+	source := imf.source
+
+	imf.source = func() (ReaderSeekerCloser, error) {
+		<-ch
+		return source()
+	}
+}
+
 type fileReader struct {
 	ReaderSeekerCloser
 	entry fs.Entry
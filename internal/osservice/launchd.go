@@ -0,0 +1,102 @@
+package osservice
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// launchdBackend manages launchd daemons (system-wide) and agents (per-user).
+type launchdBackend struct{}
+
+func launchdLabel(cfg *Config) string {
+	return "io.kopia." + cfg.Name
+}
+
+func (launchdBackend) definitionFile(cfg *Config) (string, error) {
+	if cfg.System {
+		return filepath.Join("/Library/LaunchDaemons", launchdLabel(cfg)+".plist"), nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", errors.Wrap(err, "unable to determine home directory")
+	}
+
+	return filepath.Join(home, "Library", "LaunchAgents", launchdLabel(cfg)+".plist"), nil
+}
+
+func (launchdBackend) validate(cfg *Config) error {
+	return nil
+}
+
+func (launchdBackend) definition(cfg *Config) []byte {
+	var b bytes.Buffer
+
+	esc := func(s string) string {
+		var e bytes.Buffer
+
+		xml.EscapeText(&e, []byte(s)) //nolint:errcheck
+
+		return e.String()
+	}
+
+	str := func(s string) string {
+		return "<string>" + esc(s) + "</string>"
+	}
+
+	fmt.Fprintf(&b, "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n")
+	fmt.Fprintf(&b, "<!DOCTYPE plist PUBLIC \"-//Apple//DTD PLIST 1.0//EN\" \"http://www.apple.com/DTDs/PropertyList-1.0.dtd\">\n")
+	fmt.Fprintf(&b, "<plist version=\"1.0\">\n<dict>\n")
+	fmt.Fprintf(&b, "  <key>Label</key>\n  %v\n", str(launchdLabel(cfg)))
+	fmt.Fprintf(&b, "  <key>ProgramArguments</key>\n  <array>\n")
+	fmt.Fprintf(&b, "    %v\n", str(cfg.Executable))
+
+	for _, a := range cfg.Args {
+		fmt.Fprintf(&b, "    %v\n", str(a))
+	}
+
+	fmt.Fprintf(&b, "  </array>\n")
+
+	if len(cfg.Env) > 0 {
+		fmt.Fprintf(&b, "  <key>EnvironmentVariables</key>\n  <dict>\n")
+
+		for _, k := range sortedEnv(cfg.Env) {
+			fmt.Fprintf(&b, "    <key>%v</key>\n    %v\n", esc(k), str(cfg.Env[k]))
+		}
+
+		fmt.Fprintf(&b, "  </dict>\n")
+	}
+
+	if cfg.System && cfg.UserName != "" {
+		fmt.Fprintf(&b, "  <key>UserName</key>\n  %v\n", str(cfg.UserName))
+	}
+
+	// launchd does not capture the output, so it's written to the log directory.
+	if cfg.LogDir != "" {
+		fmt.Fprintf(&b, "  <key>StandardOutPath</key>\n  %v\n", str(filepath.Join(cfg.LogDir, cfg.Name+"-service.log")))
+		fmt.Fprintf(&b, "  <key>StandardErrorPath</key>\n  %v\n", str(filepath.Join(cfg.LogDir, cfg.Name+"-service.log")))
+	}
+
+	fmt.Fprintf(&b, "  <key>RunAtLoad</key>\n  <true/>\n")
+	fmt.Fprintf(&b, "  <key>KeepAlive</key>\n  <dict>\n    <key>SuccessfulExit</key>\n    <false/>\n  </dict>\n")
+	fmt.Fprintf(&b, "</dict>\n</plist>\n")
+
+	return b.Bytes()
+}
+
+func (launchdBackend) installCommands(cfg *Config, file string) [][]string {
+	return [][]string{{"launchctl", "load", "-w", file}}
+}
+
+func (launchdBackend) uninstallCommands(cfg *Config, file string) [][]string {
+	return [][]string{{"launchctl", "unload", "-w", file}}
+}
+
+func (launchdBackend) statusCommand(cfg *Config, file string) []string {
+	return []string{"launchctl", "list", launchdLabel(cfg)}
+}
@@ -0,0 +1,204 @@
+// Package osservice installs commands as services managed by the operating system, using systemd on Linux,
+// launchd on macOS and the Task Scheduler on Windows.
+package osservice
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Config describes the service.
+type Config struct {
+	// Name is the name of the service, which must be unique on the machine.
+	Name string
+
+	Description string
+
+	// Executable and Args are the command line run by the service.
+	Executable string
+	Args       []string
+
+	// Env contains environment variables of the service.
+	Env map[string]string
+
+	// System installs the service for all users of the machine, which requires administrative privileges,
+	// instead of the service running only while the current user is logged in.
+	System bool
+
+	// UserName is the user account a system service runs as.
+	UserName string
+
+	// LogDir is the directory where the output of the service is written, where not captured by the service manager.
+	LogDir string
+}
+
+// backend manages services of a particular service manager.
+type backend interface {
+	// definitionFile returns the path of the file defining the service.
+	definitionFile(cfg *Config) (string, error)
+
+	// validate returns an error if the service can't be represented in the definition file.
+	validate(cfg *Config) error
+
+	// definition returns the contents of the file defining the service.
+	definition(cfg *Config) []byte
+
+	installCommands(cfg *Config, file string) [][]string
+	uninstallCommands(cfg *Config, file string) [][]string
+	statusCommand(cfg *Config, file string) []string
+}
+
+func backendForOS() (backend, error) {
+	switch runtime.GOOS {
+	case "linux":
+		return systemdBackend{}, nil
+	case "darwin":
+		return launchdBackend{}, nil
+	case "windows":
+		return taskSchedulerBackend{}, nil
+	default:
+		return nil, errors.Errorf("services are not supported on %v", runtime.GOOS)
+	}
+}
+
+// Definition returns the path and contents of the file defining the service.
+func Definition(cfg *Config) (string, []byte, error) {
+	b, err := backendForOS()
+	if err != nil {
+		return "", nil, err
+	}
+
+	if err = b.validate(cfg); err != nil {
+		return "", nil, err
+	}
+
+	f, err := b.definitionFile(cfg)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return f, b.definition(cfg), nil
+}
+
+// Install writes the service definition and registers the service with the service manager, which starts it.
+func Install(ctx context.Context, cfg *Config) error {
+	b, err := backendForOS()
+	if err != nil {
+		return err
+	}
+
+	if err = b.validate(cfg); err != nil {
+		return err
+	}
+
+	f, err := b.definitionFile(cfg)
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(f), 0700); err != nil {
+		return errors.Wrap(err, "unable to create service directory")
+	}
+
+	if cfg.LogDir != "" {
+		if err = os.MkdirAll(cfg.LogDir, 0700); err != nil {
+			return errors.Wrap(err, "unable to create log directory")
+		}
+	}
+
+	// the definition may include secrets passed in the environment.
+	if err = ioutil.WriteFile(f, b.definition(cfg), 0600); err != nil {
+		return errors.Wrap(err, "unable to write service definition")
+	}
+
+	for _, args := range b.installCommands(cfg, f) {
+		if _, err := run(ctx, args); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Uninstall stops the service and removes its definition.
+func Uninstall(ctx context.Context, cfg *Config) error {
+	b, err := backendForOS()
+	if err != nil {
+		return err
+	}
+
+	f, err := b.definitionFile(cfg)
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(f); os.IsNotExist(err) {
+		return errors.Errorf("service %v is not installed", cfg.Name)
+	}
+
+	cmds := b.uninstallCommands(cfg, f)
+	for i, args := range cmds {
+		// commands preceding the last one stop the service, which may not be running.
+		if _, err := run(ctx, args); err != nil && i == len(cmds)-1 {
+			return err
+		}
+	}
+
+	return errors.Wrap(os.Remove(f), "unable to remove service definition")
+}
+
+// Status returns the status of the service as reported by the service manager.
+func Status(ctx context.Context, cfg *Config) (string, error) {
+	b, err := backendForOS()
+	if err != nil {
+		return "", err
+	}
+
+	f, err := b.definitionFile(cfg)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := os.Stat(f); os.IsNotExist(err) {
+		return "not installed", nil
+	}
+
+	// service managers report stopped services with non-zero exit codes, so only the output matters.
+	out, _ := run(ctx, b.statusCommand(cfg, f))
+
+	return strings.TrimSpace(out), nil
+}
+
+func run(ctx context.Context, args []string) (string, error) {
+	var out bytes.Buffer
+
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...) //nolint:gosec
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+
+	if err := cmd.Run(); err != nil {
+		return out.String(), errors.Wrapf(err, "error running %v: %v", strings.Join(args, " "), strings.TrimSpace(out.String()))
+	}
+
+	return out.String(), nil
+}
+
+func sortedEnv(env map[string]string) []string {
+	var keys []string
+	for k := range env {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,117 @@
+package osservice
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+)
+
+func testConfig() *Config {
+	return &Config{
+		Name:        "kopia",
+		Description: "test service",
+		Executable:  "/usr/bin/kopia",
+		Args:        []string{"--config-file=/home/bob/my config", "daemon", "start"},
+		Env: map[string]string{
+			"KOPIA_PASSWORD":          `p%a"$s<s>`,
+			"KOPIA_CHECK_FOR_UPDATES": "false",
+		},
+		LogDir: "/home/bob/logs",
+	}
+}
+
+func TestSystemdDefinition(t *testing.T) {
+	cfg := testConfig()
+
+	def := string(systemdBackend{}.definition(cfg))
+
+	for _, want := range []string{
+		`ExecStart="/usr/bin/kopia" "--config-file=/home/bob/my config" "daemon" "start"` + "\n",
+		`Environment="KOPIA_CHECK_FOR_UPDATES=false"` + "\nEnvironment=\"KOPIA_PASSWORD=p%%a\\\"$s<s>\"\n",
+		"WantedBy=default.target\n",
+	} {
+		if !strings.Contains(def, want) {
+			t.Errorf("definition does not contain %q:\n%v", want, def)
+		}
+	}
+
+	if strings.Contains(def, "User=") {
+		t.Errorf("unexpected user in per-user service:\n%v", def)
+	}
+
+	cfg.System = true
+	cfg.UserName = "bob"
+
+	def = string(systemdBackend{}.definition(cfg))
+
+	for _, want := range []string{"User=bob\n", "WantedBy=multi-user.target\n"} {
+		if !strings.Contains(def, want) {
+			t.Errorf("definition does not contain %q:\n%v", want, def)
+		}
+	}
+
+	if got, want := systemdExecQuote(`a$b%c`), `"a$$b%%c"`; got != want {
+		t.Errorf("unexpected quoted value %v, want %v", got, want)
+	}
+}
+
+func TestLaunchdDefinition(t *testing.T) {
+	cfg := testConfig()
+	cfg.System = true
+	cfg.UserName = "bob"
+
+	def := launchdBackend{}.definition(cfg)
+
+	// the definition must be well-formed XML.
+	var v interface{}
+	if err := xml.Unmarshal(def, &v); err != nil {
+		t.Fatalf("invalid plist: %v\n%s", err, def)
+	}
+
+	for _, want := range []string{
+		"<string>io.kopia.kopia</string>",
+		"<string>--config-file=/home/bob/my config</string>",
+		"<key>KOPIA_PASSWORD</key>\n    <string>p%a&#34;$s&lt;s&gt;</string>",
+		"<key>UserName</key>\n  <string>bob</string>",
+		"<key>StandardErrorPath</key>\n  <string>/home/bob/logs/kopia-service.log</string>",
+	} {
+		if !strings.Contains(string(def), want) {
+			t.Errorf("definition does not contain %q:\n%s", want, def)
+		}
+	}
+}
+
+func TestTaskSchedulerDefinition(t *testing.T) {
+	cfg := testConfig()
+
+	if err := (taskSchedulerBackend{}).validate(cfg); err == nil {
+		t.Errorf("expected error for double quotes in environment")
+	}
+
+	cfg.Env["KOPIA_PASSWORD"] = "p%a$s<s>"
+
+	if err := (taskSchedulerBackend{}).validate(cfg); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	def := string(taskSchedulerBackend{}.definition(cfg))
+
+	for _, want := range []string{
+		"set \"KOPIA_PASSWORD=p%%a$s<s>\"\r\n",
+		`"/usr/bin/kopia" "--config-file=/home/bob/my config" "daemon" "start" >>"/home/bob/logs/kopia-service.log" 2>&1`,
+	} {
+		if !strings.Contains(def, want) {
+			t.Errorf("definition does not contain %q:\n%v", want, def)
+		}
+	}
+
+	if got := (taskSchedulerBackend{}).installCommands(cfg, "x.cmd")[0]; !strings.Contains(strings.Join(got, " "), "/SC ONLOGON") {
+		t.Errorf("unexpected install command: %v", got)
+	}
+
+	cfg.System = true
+
+	if got := (taskSchedulerBackend{}).installCommands(cfg, "x.cmd")[0]; !strings.Contains(strings.Join(got, " "), "/SC ONSTART /RU SYSTEM") {
+		t.Errorf("unexpected install command: %v", got)
+	}
+}
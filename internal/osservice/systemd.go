@@ -0,0 +1,108 @@
+package osservice
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// systemdBackend manages systemd units, either system-wide or in the per-user instance of systemd.
+type systemdBackend struct{}
+
+func (systemdBackend) definitionFile(cfg *Config) (string, error) {
+	if cfg.System {
+		return filepath.Join("/etc/systemd/system", cfg.Name+".service"), nil
+	}
+
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", errors.Wrap(err, "unable to determine user configuration directory")
+	}
+
+	return filepath.Join(dir, "systemd", "user", cfg.Name+".service"), nil
+}
+
+func (systemdBackend) validate(cfg *Config) error {
+	return nil
+}
+
+func (systemdBackend) definition(cfg *Config) []byte {
+	var b bytes.Buffer
+
+	fmt.Fprintf(&b, "[Unit]\n")
+	fmt.Fprintf(&b, "Description=%v\n", cfg.Description)
+	fmt.Fprintf(&b, "Wants=network-online.target\n")
+	fmt.Fprintf(&b, "After=network-online.target\n")
+	fmt.Fprintf(&b, "\n[Service]\n")
+	fmt.Fprintf(&b, "Type=simple\n")
+
+	cmdline := []string{systemdExecQuote(cfg.Executable)}
+	for _, a := range cfg.Args {
+		cmdline = append(cmdline, systemdExecQuote(a))
+	}
+
+	fmt.Fprintf(&b, "ExecStart=%v\n", strings.Join(cmdline, " "))
+
+	if cfg.System && cfg.UserName != "" {
+		fmt.Fprintf(&b, "User=%v\n", cfg.UserName)
+	}
+
+	for _, k := range sortedEnv(cfg.Env) {
+		fmt.Fprintf(&b, "Environment=%v\n", systemdQuote(k+"="+cfg.Env[k]))
+	}
+
+	// output goes to the journal.
+	fmt.Fprintf(&b, "Restart=on-failure\n")
+	fmt.Fprintf(&b, "RestartSec=30\n")
+	fmt.Fprintf(&b, "\n[Install]\n")
+
+	if cfg.System {
+		fmt.Fprintf(&b, "WantedBy=multi-user.target\n")
+	} else {
+		fmt.Fprintf(&b, "WantedBy=default.target\n")
+	}
+
+	return b.Bytes()
+}
+
+func (systemdBackend) systemctl(cfg *Config, args ...string) []string {
+	if cfg.System {
+		return append([]string{"systemctl"}, args...)
+	}
+
+	return append([]string{"systemctl", "--user"}, args...)
+}
+
+func (s systemdBackend) installCommands(cfg *Config, file string) [][]string {
+	return [][]string{
+		s.systemctl(cfg, "daemon-reload"),
+		s.systemctl(cfg, "enable", "--now", cfg.Name+".service"),
+	}
+}
+
+func (s systemdBackend) uninstallCommands(cfg *Config, file string) [][]string {
+	return [][]string{
+		s.systemctl(cfg, "disable", "--now", cfg.Name+".service"),
+	}
+}
+
+func (s systemdBackend) statusCommand(cfg *Config, file string) []string {
+	return s.systemctl(cfg, "is-active", cfg.Name+".service")
+}
+
+// systemdQuote quotes the value for use in unit files, escaping characters that have special meaning
+// in quoted strings and specifiers.
+func systemdQuote(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "%", "%%", "\n", `\n`)
+	return `"` + r.Replace(s) + `"`
+}
+
+// systemdExecQuote is like systemdQuote, but also escapes environment variable references, which are only
+// expanded in command lines.
+func systemdExecQuote(s string) string {
+	return systemdQuote(strings.ReplaceAll(s, "$", "$$"))
+}
@@ -0,0 +1,110 @@
+package osservice
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// taskSchedulerBackend runs the command as a Windows scheduled task started at logon or, for system services,
+// at boot. Scheduled tasks can't define environment variables or redirect output, so the task runs
+// a batch file that does both.
+type taskSchedulerBackend struct{}
+
+func (taskSchedulerBackend) definitionFile(cfg *Config) (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", errors.Wrap(err, "unable to determine user configuration directory")
+	}
+
+	if cfg.System {
+		if dir = os.Getenv("ProgramData"); dir == "" {
+			return "", errors.New("ProgramData directory is not set")
+		}
+	}
+
+	return filepath.Join(dir, "kopia", cfg.Name+"-service.cmd"), nil
+}
+
+// validate rejects double quotes, which can't be escaped in quoted batch file arguments.
+func (taskSchedulerBackend) validate(cfg *Config) error {
+	values := append([]string{cfg.Executable}, cfg.Args...)
+	for _, k := range sortedEnv(cfg.Env) {
+		values = append(values, k, cfg.Env[k])
+	}
+
+	for _, v := range values {
+		if strings.Contains(v, `"`) {
+			return errors.Errorf("double quotes are not supported in service command line or environment: %v", v)
+		}
+	}
+
+	return nil
+}
+
+func (taskSchedulerBackend) definition(cfg *Config) []byte {
+	var b bytes.Buffer
+
+	fmt.Fprintf(&b, "@echo off\r\n")
+	fmt.Fprintf(&b, "rem %v\r\n", cfg.Description)
+
+	for _, k := range sortedEnv(cfg.Env) {
+		fmt.Fprintf(&b, "set \"%v=%v\"\r\n", k, batchEscape(cfg.Env[k]))
+	}
+
+	cmdline := []string{batchQuote(cfg.Executable)}
+	for _, a := range cfg.Args {
+		cmdline = append(cmdline, batchQuote(a))
+	}
+
+	if cfg.LogDir != "" {
+		cmdline = append(cmdline, ">>"+batchQuote(filepath.Join(cfg.LogDir, cfg.Name+"-service.log")), "2>&1")
+	}
+
+	fmt.Fprintf(&b, "%v\r\n", strings.Join(cmdline, " "))
+
+	return b.Bytes()
+}
+
+func (taskSchedulerBackend) installCommands(cfg *Config, file string) [][]string {
+	create := []string{"schtasks", "/Create", "/F", "/TN", cfg.Name, "/TR", `"` + file + `"`}
+
+	if cfg.System {
+		user := cfg.UserName
+		if user == "" {
+			user = "SYSTEM"
+		}
+
+		create = append(create, "/SC", "ONSTART", "/RU", user)
+	} else {
+		create = append(create, "/SC", "ONLOGON")
+	}
+
+	return [][]string{
+		create,
+		{"schtasks", "/Run", "/TN", cfg.Name},
+	}
+}
+
+func (taskSchedulerBackend) uninstallCommands(cfg *Config, file string) [][]string {
+	return [][]string{
+		{"schtasks", "/End", "/TN", cfg.Name},
+		{"schtasks", "/Delete", "/F", "/TN", cfg.Name},
+	}
+}
+
+func (taskSchedulerBackend) statusCommand(cfg *Config, file string) []string {
+	return []string{"schtasks", "/Query", "/TN", cfg.Name}
+}
+
+func batchEscape(s string) string {
+	return strings.ReplaceAll(s, "%", "%%")
+}
+
+func batchQuote(s string) string {
+	return `"` + batchEscape(s) + `"`
+}
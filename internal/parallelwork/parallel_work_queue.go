@@ -16,6 +16,9 @@ type Queue struct {
 	activeWorkerCount int64
 	completedWork     int64
 
+	// err is the first error returned by a callback, after which no more work is dequeued.
+	err error
+
 	nextReportTime time.Time
 
 	ProgressCallback func(enqueued, active, completed int64)
@@ -52,12 +55,11 @@ func (v *Queue) enqueue(front bool, callback CallbackFunc) {
 }
 
 // Process starts N workers, which will be processing elements in the queue until the queue
-// is empty and all workers are idle.
+// is empty and all workers are idle. When a callback fails, the remaining work is abandoned
+// and the first error is returned once all workers have stopped.
 func (v *Queue) Process(workers int) error {
 	var wg sync.WaitGroup
 
-	errors := make(chan error, workers)
-
 	for i := 0; i < workers; i++ {
 		wg.Add(1)
 
@@ -70,34 +72,30 @@ func (v *Queue) Process(workers int) error {
 					break
 				}
 
-				if err := callback(); err != nil {
-					errors <- err
-					break
-				}
-
-				v.completed()
+				v.completed(callback())
 			}
 		}(i)
 	}
 
 	wg.Wait()
-	close(errors)
 
-	// return first error or nil
-	return <-errors
+	v.monitor.L.Lock()
+	defer v.monitor.L.Unlock()
+
+	return v.err
 }
 
 func (v *Queue) dequeue() CallbackFunc {
 	v.monitor.L.Lock()
 	defer v.monitor.L.Unlock()
 
-	for v.queueItems.Len() == 0 && v.activeWorkerCount > 0 {
+	for v.queueItems.Len() == 0 && v.activeWorkerCount > 0 && v.err == nil {
 		// no items in queue, but some workers are active, they may add more.
 		v.monitor.Wait()
 	}
 
 	// no items in queue, no workers are active, no more work.
-	if v.queueItems.Len() == 0 {
+	if v.queueItems.Len() == 0 || v.err != nil {
 		return nil
 	}
 
@@ -110,10 +108,14 @@ func (v *Queue) dequeue() CallbackFunc {
 	return front.Value.(CallbackFunc)
 }
 
-func (v *Queue) completed() {
+func (v *Queue) completed(err error) {
 	v.monitor.L.Lock()
 	defer v.monitor.L.Unlock()
 
+	if err != nil && v.err == nil {
+		v.err = err
+	}
+
 	v.activeWorkerCount--
 	v.completedWork++
 	v.maybeReportProgress()
@@ -0,0 +1,75 @@
+package parallelwork
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestQueueProcess(t *testing.T) {
+	q := NewQueue()
+
+	var count int32
+
+	for i := 0; i < 10; i++ {
+		q.EnqueueBack(func() error {
+			atomic.AddInt32(&count, 1)
+
+			q.EnqueueFront(func() error {
+				atomic.AddInt32(&count, 1)
+				return nil
+			})
+
+			return nil
+		})
+	}
+
+	if err := q.Process(3); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got, want := atomic.LoadInt32(&count), int32(20); got != want {
+		t.Errorf("unexpected number of callbacks: %v, want %v", got, want)
+	}
+}
+
+func TestQueueProcessFailingCallback(t *testing.T) {
+	q := NewQueue()
+	errFailed := errors.New("failed")
+
+	var count int32
+
+	q.EnqueueBack(func() error {
+		return errFailed
+	})
+
+	for i := 0; i < 100; i++ {
+		q.EnqueueBack(func() error {
+			atomic.AddInt32(&count, 1)
+			time.Sleep(time.Millisecond)
+
+			return nil
+		})
+	}
+
+	done := make(chan error, 1)
+
+	go func() {
+		done <- q.Process(4)
+	}()
+
+	select {
+	case err := <-done:
+		if err != errFailed {
+			t.Fatalf("unexpected error: %v, want %v", err, errFailed)
+		}
+
+	case <-time.After(10 * time.Second):
+		t.Fatalf("queue did not stop after failed callback")
+	}
+
+	if got := atomic.LoadInt32(&count); got >= 100 {
+		t.Errorf("remaining work was not abandoned after failure: %v callbacks", got)
+	}
+}
@@ -0,0 +1,322 @@
+// Package providervalidation implements validation to ensure the blob storage is compatible with kopia requirements.
+package providervalidation
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/logging"
+)
+
+var log = logging.GetContextLoggerFunc("providervalidation")
+
+// Options provides options for provider validation.
+type Options struct {
+	NumBlobs      int
+	MaxBlobLength int
+}
+
+// DefaultOptions is the default set of options.
+// nolint:gomnd,gochecknoglobals
+var DefaultOptions = Options{
+	NumBlobs:      5,
+	MaxBlobLength: 1 << 20,
+}
+
+// validator holds the state of a single validation run.
+type validator struct {
+	st     blob.Storage
+	prefix blob.ID
+
+	// latencies of storage operations keyed by operation name
+	latencies map[string][]time.Duration
+}
+
+// ValidateProvider runs a series of tests against the provided storage to ensure it provides
+// the semantics required by kopia: read-after-write, list-after-write, overwrites, deletes and
+// correct handling of missing blobs. All blobs written during validation are removed at the end.
+func ValidateProvider(ctx context.Context, st blob.Storage, opt Options) error {
+	if opt.NumBlobs <= 0 || opt.MaxBlobLength <= 1 {
+		return errors.Errorf("invalid options: %+v", opt)
+	}
+
+	prefix, err := randomHex(8)
+	if err != nil {
+		return err
+	}
+
+	v := &validator{
+		st: st,
+		// all test blobs share a random prefix, which lets us list just the blobs we've written.
+		prefix:    blob.ID("v" + prefix),
+		latencies: map[string][]time.Duration{},
+	}
+
+	defer v.cleanup(ctx)
+
+	if err := v.run(ctx, opt); err != nil {
+		return err
+	}
+
+	v.logLatencies(ctx)
+
+	return nil
+}
+
+func (v *validator) run(ctx context.Context, opt Options) error {
+	log(ctx).Infof("Validating that missing blobs are reported correctly...")
+
+	if err := v.verifyNotFound(ctx, v.prefix+"-missing"); err != nil {
+		return err
+	}
+
+	if err := v.deleteBlob(ctx, v.prefix+"-missing"); err != nil {
+		return errors.Wrap(err, "deleting a missing blob must succeed")
+	}
+
+	log(ctx).Infof("Writing %v test blobs...", opt.NumBlobs)
+
+	written := map[blob.ID][]byte{}
+
+	for i := 0; i < opt.NumBlobs; i++ {
+		id := blob.ID(fmt.Sprintf("%v-%04x", v.prefix, i))
+
+		// always include one zero-length blob.
+		length := 0
+		if i > 0 {
+			length = 1 + (i*opt.MaxBlobLength/opt.NumBlobs)%opt.MaxBlobLength
+		}
+
+		data, err := randomBytes(length)
+		if err != nil {
+			return err
+		}
+
+		if err := v.putBlob(ctx, id, data); err != nil {
+			return errors.Wrapf(err, "unable to write %v", id)
+		}
+
+		written[id] = data
+
+		if err := v.verifyContents(ctx, id, data); err != nil {
+			return errors.Wrap(err, "read-after-write")
+		}
+	}
+
+	log(ctx).Infof("Validating partial reads...")
+
+	for id, data := range written {
+		if err := v.verifyPartialReads(ctx, id, data); err != nil {
+			return err
+		}
+	}
+
+	log(ctx).Infof("Validating list-after-write...")
+
+	if err := v.verifyList(ctx, written); err != nil {
+		return errors.Wrap(err, "list-after-write")
+	}
+
+	log(ctx).Infof("Validating overwrites...")
+
+	// blobs are content-addressed, so kopia only ever overwrites them with identical contents.
+	for id, data := range written {
+		if err := v.putBlob(ctx, id, data); err != nil {
+			return errors.Wrapf(err, "unable to overwrite %v", id)
+		}
+
+		if err := v.verifyContents(ctx, id, data); err != nil {
+			return errors.Wrap(err, "read-after-overwrite")
+		}
+	}
+
+	if err := v.verifyList(ctx, written); err != nil {
+		return errors.Wrap(err, "list-after-overwrite")
+	}
+
+	log(ctx).Infof("Validating deletes...")
+
+	for id := range written {
+		if err := v.deleteBlob(ctx, id); err != nil {
+			return errors.Wrapf(err, "unable to delete %v", id)
+		}
+
+		delete(written, id)
+
+		if err := v.verifyNotFound(ctx, id); err != nil {
+			return errors.Wrap(err, "read-after-delete")
+		}
+
+		if err := v.verifyList(ctx, written); err != nil {
+			return errors.Wrap(err, "list-after-delete")
+		}
+	}
+
+	return nil
+}
+
+// cleanup removes blobs left behind when validation fails midway.
+func (v *validator) cleanup(ctx context.Context) {
+	bms, err := blob.ListAllBlobs(ctx, v.st, v.prefix)
+	if err != nil {
+		log(ctx).Warningf("unable to list test blobs for cleanup: %v", err)
+		return
+	}
+
+	for _, bm := range bms {
+		if err := v.st.DeleteBlob(ctx, bm.BlobID); err != nil {
+			log(ctx).Warningf("unable to delete test blob %v: %v", bm.BlobID, err)
+		}
+	}
+}
+
+func (v *validator) verifyNotFound(ctx context.Context, id blob.ID) error {
+	_, err := v.getBlob(ctx, id, 0, -1)
+	if err == nil {
+		return errors.Errorf("blob %v was expected to not exist", id)
+	}
+
+	if err != blob.ErrBlobNotFound {
+		return errors.Wrapf(err, "reading missing blob %v must return ErrBlobNotFound", id)
+	}
+
+	return nil
+}
+
+func (v *validator) verifyContents(ctx context.Context, id blob.ID, want []byte) error {
+	got, err := v.getBlob(ctx, id, 0, -1)
+	if err != nil {
+		return errors.Wrapf(err, "unable to read %v", id)
+	}
+
+	if !bytes.Equal(got, want) {
+		return errors.Errorf("invalid contents of %v: got %v bytes, want %v", id, len(got), len(want))
+	}
+
+	return nil
+}
+
+func (v *validator) verifyPartialReads(ctx context.Context, id blob.ID, data []byte) error {
+	if len(data) < 2 { //nolint:gomnd
+		return nil
+	}
+
+	half := int64(len(data) / 2) //nolint:gomnd
+
+	for _, r := range []struct{ offset, length int64 }{
+		{0, 1},
+		{0, half},
+		{half, int64(len(data)) - half},
+		{int64(len(data)) - 1, 1},
+	} {
+		got, err := v.getBlob(ctx, id, r.offset, r.length)
+		if err != nil {
+			return errors.Wrapf(err, "unable to read %v at %v+%v", id, r.offset, r.length)
+		}
+
+		if !bytes.Equal(got, data[r.offset:r.offset+r.length]) {
+			return errors.Errorf("invalid partial read of %v at %v+%v", id, r.offset, r.length)
+		}
+	}
+
+	return nil
+}
+
+func (v *validator) verifyList(ctx context.Context, want map[blob.ID][]byte) error {
+	t0 := time.Now()
+	bms, err := blob.ListAllBlobs(ctx, v.st, v.prefix+"-")
+	v.record("ListBlobs", t0)
+
+	if err != nil {
+		return errors.Wrap(err, "unable to list blobs")
+	}
+
+	got := map[blob.ID]int64{}
+	for _, bm := range bms {
+		got[bm.BlobID] = bm.Length
+	}
+
+	for id, data := range want {
+		l, ok := got[id]
+		if !ok {
+			return errors.Errorf("blob %v was not listed", id)
+		}
+
+		if l != int64(len(data)) {
+			return errors.Errorf("listed length of %v is %v, want %v", id, l, len(data))
+		}
+	}
+
+	for id := range got {
+		if _, ok := want[id]; !ok {
+			return errors.Errorf("unexpected blob %v was listed", id)
+		}
+	}
+
+	return nil
+}
+
+func (v *validator) getBlob(ctx context.Context, id blob.ID, offset, length int64) ([]byte, error) {
+	defer v.record("GetBlob", time.Now())
+	return v.st.GetBlob(ctx, id, offset, length)
+}
+
+func (v *validator) putBlob(ctx context.Context, id blob.ID, data []byte) error {
+	defer v.record("PutBlob", time.Now())
+	return v.st.PutBlob(ctx, id, data)
+}
+
+func (v *validator) deleteBlob(ctx context.Context, id blob.ID) error {
+	defer v.record("DeleteBlob", time.Now())
+	return v.st.DeleteBlob(ctx, id)
+}
+
+func (v *validator) record(op string, t0 time.Time) {
+	v.latencies[op] = append(v.latencies[op], time.Since(t0))
+}
+
+func (v *validator) logLatencies(ctx context.Context) {
+	var ops []string
+	for op := range v.latencies {
+		ops = append(ops, op)
+	}
+
+	sort.Strings(ops)
+
+	for _, op := range ops {
+		l := v.latencies[op]
+		sort.Slice(l, func(i, j int) bool { return l[i] < l[j] })
+
+		var total time.Duration
+		for _, d := range l {
+			total += d
+		}
+
+		log(ctx).Infof("%-10v count:%v min:%v avg:%v max:%v", op, len(l), l[0], total/time.Duration(len(l)), l[len(l)-1])
+	}
+}
+
+func randomBytes(n int) ([]byte, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return nil, errors.Wrap(err, "unable to generate random data")
+	}
+
+	return b, nil
+}
+
+func randomHex(n int) (string, error) {
+	b, err := randomBytes(n)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%x", b), nil
+}
@@ -0,0 +1,45 @@
+package providervalidation_test
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/blobtesting"
+	"github.com/kopia/kopia/internal/providervalidation"
+	"github.com/kopia/kopia/internal/testlogging"
+)
+
+func TestProviderValidation(t *testing.T) {
+	ctx := testlogging.Context(t)
+	m := blobtesting.DataMap{}
+	st := blobtesting.NewMapStorage(m, nil, nil)
+
+	if err := providervalidation.ValidateProvider(ctx, st, providervalidation.DefaultOptions); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(m) != 0 {
+		t.Fatalf("test blobs were not cleaned up: %v", len(m))
+	}
+}
+
+func TestProviderValidationFailure(t *testing.T) {
+	ctx := testlogging.Context(t)
+	m := blobtesting.DataMap{}
+	st := &blobtesting.FaultyStorage{
+		Base: blobtesting.NewMapStorage(m, nil, nil),
+		Faults: map[string][]*blobtesting.Fault{
+			// first GetBlob checks missing blob, fail the read-after-write of the first blob.
+			"GetBlob": {{}, {Err: errors.New("some error")}},
+		},
+	}
+
+	if err := providervalidation.ValidateProvider(ctx, st, providervalidation.DefaultOptions); err == nil {
+		t.Fatalf("expected validation to fail")
+	}
+
+	if len(m) != 0 {
+		t.Fatalf("test blobs were not cleaned up after failure: %v", len(m))
+	}
+}
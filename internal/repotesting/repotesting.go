@@ -112,12 +112,17 @@ func (e *Environment) configFile() string {
 
 // MustReopen closes and reopens the repository.
 func (e *Environment) MustReopen(t *testing.T) {
+	e.MustReopenWithOptions(t, &repo.Options{})
+}
+
+// MustReopenWithOptions closes and reopens the repository with the provided options.
+func (e *Environment) MustReopenWithOptions(t *testing.T, opt *repo.Options) {
 	err := e.Repository.Close(testlogging.Context(t))
 	if err != nil {
 		t.Fatalf("close error: %v", err)
 	}
 
-	e.Repository, err = repo.Open(testlogging.Context(t), e.configFile(), masterPassword, &repo.Options{})
+	e.Repository, err = repo.Open(testlogging.Context(t), e.configFile(), masterPassword, opt)
 	if err != nil {
 		t.Fatalf("err: %v", err)
 	}
@@ -0,0 +1,115 @@
+package restic
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/subtle"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/poly1305"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	ivSize         = aes.BlockSize
+	macSize        = poly1305.TagSize
+	cryptoOverhead = ivSize + macSize
+
+	aesKeySize = 32
+	macKeySize = 16
+)
+
+// poly1305KeyMask clamps the 'r' part of the Poly1305 key the same way restic does.
+var poly1305KeyMask = [16]byte{
+	0xff, 0xff, 0xff, 0x0f,
+	0xfc, 0xff, 0xff, 0x0f,
+	0xfc, 0xff, 0xff, 0x0f,
+	0xfc, 0xff, 0xff, 0x0f,
+}
+
+// macKey is the Poly1305-AES key used for authenticating restic ciphertexts.
+type macKey struct {
+	K []byte `json:"k"`
+	R []byte `json:"r"`
+}
+
+// masterKey is the key used for encrypting all data in a restic repository.
+type masterKey struct {
+	MAC     macKey `json:"mac"`
+	Encrypt []byte `json:"encrypt"`
+}
+
+func (k *masterKey) validate() error {
+	if len(k.Encrypt) != aesKeySize || len(k.MAC.K) != macKeySize || len(k.MAC.R) != macKeySize {
+		return errors.New("invalid key length")
+	}
+
+	return nil
+}
+
+// deriveUserKey derives the key used for decrypting master key from the user password.
+func deriveUserKey(password string, salt []byte, n, r, p int) (*masterKey, error) {
+	b, err := scrypt.Key([]byte(password), salt, n, r, p, aesKeySize+2*macKeySize)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to derive key")
+	}
+
+	return &masterKey{
+		Encrypt: b[0:aesKeySize],
+		MAC: macKey{
+			K: b[aesKeySize : aesKeySize+macKeySize],
+			R: b[aesKeySize+macKeySize:],
+		},
+	}, nil
+}
+
+func (k *masterKey) mac(nonce, data []byte) ([]byte, error) {
+	var polyKey [32]byte
+
+	c, err := aes.NewCipher(k.MAC.K)
+	if err != nil {
+		return nil, err
+	}
+
+	c.Encrypt(polyKey[16:], nonce)
+
+	for i := 0; i < macKeySize; i++ {
+		polyKey[i] = k.MAC.R[i] & poly1305KeyMask[i]
+	}
+
+	var tag [macSize]byte
+
+	poly1305.Sum(&tag, data, &polyKey)
+
+	return tag[:], nil
+}
+
+// decrypt verifies and decrypts the provided IV || ciphertext || MAC.
+func (k *masterKey) decrypt(data []byte) ([]byte, error) {
+	if len(data) < cryptoOverhead {
+		return nil, errors.New("ciphertext too short")
+	}
+
+	iv := data[0:ivSize]
+	ciphertext := data[ivSize : len(data)-macSize]
+	tag := data[len(data)-macSize:]
+
+	expected, err := k.mac(iv, ciphertext)
+	if err != nil {
+		return nil, err
+	}
+
+	if subtle.ConstantTimeCompare(expected, tag) != 1 {
+		return nil, errors.New("ciphertext verification failed")
+	}
+
+	c, err := aes.NewCipher(k.Encrypt)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext := make([]byte, len(ciphertext))
+	cipher.NewCTR(c, iv).XORKeyStream(plaintext, ciphertext)
+
+	return plaintext, nil
+}
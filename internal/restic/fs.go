@@ -0,0 +1,285 @@
+package restic
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/fs"
+)
+
+const (
+	nodeTypeFile    = "file"
+	nodeTypeDir     = "dir"
+	nodeTypeSymlink = "symlink"
+)
+
+type tree struct {
+	Nodes []*node `json:"nodes"`
+}
+
+type node struct {
+	Name       string      `json:"name"`
+	Type       string      `json:"type"`
+	Mode       os.FileMode `json:"mode,omitempty"`
+	ModTime    time.Time   `json:"mtime,omitempty"`
+	UID        uint32      `json:"uid"`
+	GID        uint32      `json:"gid"`
+	Size       int64       `json:"size,omitempty"`
+	LinkTarget string      `json:"linktarget,omitempty"`
+	Content    []ID        `json:"content"`
+	Subtree    ID          `json:"subtree,omitempty"`
+}
+
+func (r *Repository) loadTree(id ID) (*tree, error) {
+	b, err := r.loadBlob(id, blobTypeTree)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &tree{}
+	if err := json.Unmarshal(b, t); err != nil {
+		return nil, errors.Wrapf(err, "invalid tree %v", id)
+	}
+
+	return t, nil
+}
+
+// SnapshotRoot returns the directory entry corresponding to the snapshot root along with the
+// local path it represents. Restic stores absolute paths in snapshot trees, so the root is the
+// innermost directory common to all snapshot paths.
+func (r *Repository) SnapshotRoot(ctx context.Context, s *Snapshot) (fs.Directory, string, error) {
+	var root fs.Directory = &resticDirectory{
+		resticEntry{repo: r, node: &node{Name: "/", Type: nodeTypeDir, Mode: os.ModeDir | 0o755, ModTime: s.Time, Subtree: s.Tree}},
+	}
+
+	common := commonPath(s.Paths)
+	rootPath := "/"
+
+	for _, part := range strings.Split(filepath.ToSlash(common), "/") {
+		if part == "" {
+			continue
+		}
+
+		e, err := root.Child(ctx, part)
+		if err != nil {
+			return nil, "", errors.Wrapf(err, "unable to find %q in snapshot %v", common, s.ID)
+		}
+
+		d, ok := e.(fs.Directory)
+		if !ok {
+			// single-file snapshot, use the parent directory.
+			break
+		}
+
+		root = d
+		rootPath = filepath.Join(rootPath, part)
+	}
+
+	return root, rootPath, nil
+}
+
+// commonPath returns the longest common directory of all provided paths.
+func commonPath(paths []string) string {
+	if len(paths) == 0 {
+		return "/"
+	}
+
+	common := filepath.Clean(paths[0])
+
+	for _, p := range paths[1:] {
+		p = filepath.Clean(p)
+
+		for common != p && !strings.HasPrefix(p, common+string(filepath.Separator)) {
+			parent := filepath.Dir(common)
+			if parent == common {
+				return common
+			}
+
+			common = parent
+		}
+	}
+
+	return common
+}
+
+type resticEntry struct {
+	repo *Repository
+	node *node
+}
+
+func (e *resticEntry) Name() string {
+	return e.node.Name
+}
+
+func (e *resticEntry) IsDir() bool {
+	return e.node.Type == nodeTypeDir
+}
+
+func (e *resticEntry) Mode() os.FileMode {
+	return e.node.Mode
+}
+
+func (e *resticEntry) ModTime() time.Time {
+	return e.node.ModTime
+}
+
+func (e *resticEntry) Size() int64 {
+	return e.node.Size
+}
+
+func (e *resticEntry) Sys() interface{} {
+	return nil
+}
+
+func (e *resticEntry) Owner() fs.OwnerInfo {
+	return fs.OwnerInfo{
+		UserID:  e.node.UID,
+		GroupID: e.node.GID,
+	}
+}
+
+type resticDirectory struct {
+	resticEntry
+}
+
+func (d *resticDirectory) Summary() *fs.DirectorySummary {
+	return nil
+}
+
+func (d *resticDirectory) Child(ctx context.Context, name string) (fs.Entry, error) {
+	return fs.ReadDirAndFindChild(ctx, d, name)
+}
+
+func (d *resticDirectory) Readdir(ctx context.Context) (fs.Entries, error) {
+	t, err := d.repo.loadTree(d.node.Subtree)
+	if err != nil {
+		return nil, err
+	}
+
+	var result fs.Entries
+
+	for _, n := range t.Nodes {
+		e := resticEntry{d.repo, n}
+
+		switch n.Type {
+		case nodeTypeDir:
+			result = append(result, &resticDirectory{e})
+		case nodeTypeFile:
+			result = append(result, &resticFile{e})
+		case nodeTypeSymlink:
+			result = append(result, &resticSymlink{e})
+		default:
+			log(ctx).Debugf("skipping unsupported entry %v of type %v", n.Name, n.Type)
+		}
+	}
+
+	result.Sort()
+
+	return result, nil
+}
+
+type resticSymlink struct {
+	resticEntry
+}
+
+func (s *resticSymlink) Readlink(ctx context.Context) (string, error) {
+	return s.node.LinkTarget, nil
+}
+
+type resticFile struct {
+	resticEntry
+}
+
+func (f *resticFile) Open(ctx context.Context) (fs.Reader, error) {
+	offsets := make([]int64, len(f.node.Content)+1)
+
+	for i, id := range f.node.Content {
+		l, err := f.repo.blobSize(id)
+		if err != nil {
+			return nil, err
+		}
+
+		offsets[i+1] = offsets[i] + l
+	}
+
+	return &fileReader{f: f, offsets: offsets, current: -1}, nil
+}
+
+// fileReader implements fs.Reader by lazily loading data blobs referenced by a file node.
+type fileReader struct {
+	f       *resticFile
+	offsets []int64 // offsets[i] is the starting position of i-th blob, last element is total length
+
+	pos     int64
+	current int    // index of the blob currently held in 'data'
+	data    []byte // plaintext of the current blob
+}
+
+func (r *fileReader) Read(b []byte) (int, error) {
+	total := r.offsets[len(r.offsets)-1]
+	if r.pos >= total {
+		return 0, io.EOF
+	}
+
+	ndx := r.blobIndex(r.pos)
+	if ndx != r.current {
+		data, err := r.f.repo.loadBlob(r.f.node.Content[ndx], blobTypeData)
+		if err != nil {
+			return 0, err
+		}
+
+		r.current = ndx
+		r.data = data
+	}
+
+	n := copy(b, r.data[r.pos-r.offsets[ndx]:])
+	r.pos += int64(n)
+
+	return n, nil
+}
+
+// blobIndex returns the index of the blob containing a given position.
+func (r *fileReader) blobIndex(pos int64) int {
+	for i := 0; i < len(r.offsets)-1; i++ {
+		if pos < r.offsets[i+1] {
+			return i
+		}
+	}
+
+	return len(r.offsets) - 2 //nolint:gomnd
+}
+
+func (r *fileReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.pos
+	case io.SeekEnd:
+		offset += r.offsets[len(r.offsets)-1]
+	default:
+		return r.pos, errors.New("invalid whence")
+	}
+
+	if offset < 0 {
+		return r.pos, errors.New("negative position")
+	}
+
+	r.pos = offset
+
+	return r.pos, nil
+}
+
+func (r *fileReader) Close() error {
+	return nil
+}
+
+func (r *fileReader) Entry() (fs.Entry, error) {
+	return r.f, nil
+}
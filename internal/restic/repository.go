@@ -0,0 +1,335 @@
+// Package restic implements read-only access to restic repositories stored on a local filesystem,
+// exposing their snapshots as fs.Entry trees suitable for uploading with kopia.
+package restic
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo/logging"
+)
+
+var log = logging.GetContextLoggerFunc("kopia/restic")
+
+// ErrInvalidPassword is returned when none of the repository keys can be decrypted with the provided password.
+var ErrInvalidPassword = errors.New("invalid restic repository password")
+
+const (
+	blobTypeData = "data"
+	blobTypeTree = "tree"
+
+	// compressedUnpackedFileVersion is the leading byte of a compressed unpacked file (format v2).
+	compressedUnpackedFileVersion = 2
+)
+
+// ID is a hex-encoded SHA256 identifier of a restic file or blob.
+type ID string
+
+type keyFile struct {
+	KDF  string `json:"kdf"`
+	N    int    `json:"N"`
+	R    int    `json:"r"`
+	P    int    `json:"p"`
+	Salt []byte `json:"salt"`
+	Data []byte `json:"data"`
+}
+
+type config struct {
+	Version int    `json:"version"`
+	ID      string `json:"id"`
+}
+
+type indexFile struct {
+	Packs []struct {
+		ID    ID `json:"id"`
+		Blobs []struct {
+			ID                 ID     `json:"id"`
+			Type               string `json:"type"`
+			Offset             int64  `json:"offset"`
+			Length             int64  `json:"length"`
+			UncompressedLength int64  `json:"uncompressed_length,omitempty"`
+		} `json:"blobs"`
+	} `json:"packs"`
+}
+
+// blobLocation describes the location of a single blob within a pack file.
+type blobLocation struct {
+	packID             ID
+	blobType           string
+	offset             int64
+	length             int64
+	uncompressedLength int64
+}
+
+// plaintextLength returns the length of blob data after decryption and decompression.
+func (l blobLocation) plaintextLength() int64 {
+	if l.uncompressedLength > 0 {
+		return l.uncompressedLength
+	}
+
+	return l.length - cryptoOverhead
+}
+
+// Snapshot represents a single restic snapshot.
+type Snapshot struct {
+	ID       ID        `json:"-"`
+	Time     time.Time `json:"time"`
+	Tree     ID        `json:"tree"`
+	Paths    []string  `json:"paths"`
+	Hostname string    `json:"hostname"`
+	Username string    `json:"username"`
+	Tags     []string  `json:"tags"`
+}
+
+// Repository provides read-only access to a restic repository.
+type Repository struct {
+	path    string
+	key     *masterKey
+	version int
+	blobs   map[ID]blobLocation
+	decoder *zstd.Decoder
+}
+
+// Open opens the restic repository in a given local directory using the provided password.
+func Open(ctx context.Context, path, password string) (*Repository, error) {
+	r := &Repository{path: path}
+
+	var err error
+
+	if r.key, err = r.findMasterKey(ctx, password); err != nil {
+		return nil, err
+	}
+
+	var cfg config
+	if err := r.loadJSONFile("config", &cfg); err != nil {
+		return nil, errors.Wrap(err, "unable to read repository config")
+	}
+
+	r.version = cfg.Version
+
+	if r.decoder, err = zstd.NewReader(nil); err != nil {
+		return nil, errors.Wrap(err, "unable to initialize decompressor")
+	}
+
+	if err := r.loadIndexes(ctx); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *Repository) findMasterKey(ctx context.Context, password string) (*masterKey, error) {
+	keyFiles, err := r.listFiles("keys")
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to list keys")
+	}
+
+	for _, kf := range keyFiles {
+		b, err := ioutil.ReadFile(filepath.Join(r.path, "keys", string(kf))) //nolint:gosec
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to read key %v", kf)
+		}
+
+		var k keyFile
+		if err := json.Unmarshal(b, &k); err != nil {
+			return nil, errors.Wrapf(err, "invalid key %v", kf)
+		}
+
+		if k.KDF != "scrypt" {
+			log(ctx).Debugf("skipping key %v with unsupported KDF %q", kf, k.KDF)
+			continue
+		}
+
+		userKey, err := deriveUserKey(password, k.Salt, k.N, k.R, k.P)
+		if err != nil {
+			return nil, err
+		}
+
+		plaintext, err := userKey.decrypt(k.Data)
+		if err != nil {
+			// wrong password for this key, try next one.
+			continue
+		}
+
+		mk := &masterKey{}
+		if err := json.Unmarshal(plaintext, mk); err != nil {
+			return nil, errors.Wrapf(err, "invalid master key in %v", kf)
+		}
+
+		if err := mk.validate(); err != nil {
+			return nil, errors.Wrapf(err, "invalid master key in %v", kf)
+		}
+
+		return mk, nil
+	}
+
+	return nil, ErrInvalidPassword
+}
+
+// listFiles returns the names of all files in a given repository subdirectory, including
+// files in nested shard directories such as 'data/ab/'.
+func (r *Repository) listFiles(dir string) ([]ID, error) {
+	var result []ID
+
+	err := filepath.Walk(filepath.Join(r.path, dir), func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.Mode().IsRegular() {
+			result = append(result, ID(info.Name()))
+		}
+
+		return nil
+	})
+
+	sort.Slice(result, func(i, j int) bool { return result[i] < result[j] })
+
+	return result, err
+}
+
+// loadUnpackedFile reads, decrypts and possibly decompresses a file stored outside of pack files.
+func (r *Repository) loadUnpackedFile(name string) ([]byte, error) {
+	b, err := ioutil.ReadFile(filepath.Join(r.path, name)) //nolint:gosec
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := r.key.decrypt(b)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to decrypt %v", name)
+	}
+
+	if r.version >= 2 && len(plaintext) > 0 && plaintext[0] == compressedUnpackedFileVersion {
+		return r.decoder.DecodeAll(plaintext[1:], nil)
+	}
+
+	return plaintext, nil
+}
+
+func (r *Repository) loadJSONFile(name string, v interface{}) error {
+	b, err := r.loadUnpackedFile(name)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(b, v)
+}
+
+func (r *Repository) loadIndexes(ctx context.Context) error {
+	r.blobs = map[ID]blobLocation{}
+
+	indexFiles, err := r.listFiles("index")
+	if err != nil {
+		return errors.Wrap(err, "unable to list indexes")
+	}
+
+	for _, n := range indexFiles {
+		var ndx indexFile
+		if err := r.loadJSONFile(filepath.Join("index", string(n)), &ndx); err != nil {
+			return errors.Wrapf(err, "unable to load index %v", n)
+		}
+
+		for _, p := range ndx.Packs {
+			for _, b := range p.Blobs {
+				r.blobs[b.ID] = blobLocation{
+					packID:             p.ID,
+					blobType:           b.Type,
+					offset:             b.Offset,
+					length:             b.Length,
+					uncompressedLength: b.UncompressedLength,
+				}
+			}
+		}
+	}
+
+	log(ctx).Debugf("loaded %v blobs from %v indexes", len(r.blobs), len(indexFiles))
+
+	return nil
+}
+
+// ListSnapshots returns all snapshots in the repository sorted by time.
+func (r *Repository) ListSnapshots(ctx context.Context) ([]*Snapshot, error) {
+	ids, err := r.listFiles("snapshots")
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to list snapshots")
+	}
+
+	var result []*Snapshot
+
+	for _, id := range ids {
+		s := &Snapshot{}
+		if err := r.loadJSONFile(filepath.Join("snapshots", string(id)), s); err != nil {
+			log(ctx).Warningf("unable to load snapshot %v: %v", id, err)
+			continue
+		}
+
+		s.ID = id
+		result = append(result, s)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Time.Before(result[j].Time)
+	})
+
+	return result, nil
+}
+
+// loadBlob returns plaintext contents of a blob with a given ID and type.
+func (r *Repository) loadBlob(id ID, blobType string) ([]byte, error) {
+	loc, ok := r.blobs[id]
+	if !ok {
+		return nil, errors.Errorf("blob %v not found in index", id)
+	}
+
+	if loc.blobType != blobType {
+		return nil, errors.Errorf("blob %v has unexpected type %q, wanted %q", id, loc.blobType, blobType)
+	}
+
+	packID := string(loc.packID)
+	if len(packID) < 2 { //nolint:gomnd
+		return nil, errors.Errorf("invalid pack ID %q", packID)
+	}
+
+	f, err := os.Open(filepath.Join(r.path, "data", packID[0:2], packID))
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to open pack %v", packID)
+	}
+	defer f.Close() //nolint:errcheck
+
+	b := make([]byte, loc.length)
+	if _, err := f.ReadAt(b, loc.offset); err != nil {
+		return nil, errors.Wrapf(err, "unable to read blob %v from pack %v", id, packID)
+	}
+
+	plaintext, err := r.key.decrypt(b)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to decrypt blob %v", id)
+	}
+
+	if loc.uncompressedLength > 0 {
+		if plaintext, err = r.decoder.DecodeAll(plaintext, nil); err != nil {
+			return nil, errors.Wrapf(err, "unable to decompress blob %v", id)
+		}
+	}
+
+	return plaintext, nil
+}
+
+// blobSize returns the plaintext size of a given data blob.
+func (r *Repository) blobSize(id ID) (int64, error) {
+	loc, ok := r.blobs[id]
+	if !ok {
+		return 0, errors.Errorf("blob %v not found in index", id)
+	}
+
+	return loc.plaintextLength(), nil
+}
@@ -0,0 +1,260 @@
+package restic
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kopia/kopia/fs"
+	"github.com/kopia/kopia/internal/testlogging"
+)
+
+func encrypt(t *testing.T, k *masterKey, plaintext []byte) []byte {
+	t.Helper()
+
+	iv := make([]byte, ivSize)
+	for i := range iv {
+		iv[i] = byte(len(plaintext) + i)
+	}
+
+	c, err := aes.NewCipher(k.Encrypt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := make([]byte, ivSize+len(plaintext))
+	copy(result, iv)
+	cipher.NewCTR(c, iv).XORKeyStream(result[ivSize:], plaintext)
+
+	tag, err := k.mac(iv, result[ivSize:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return append(result, tag...)
+}
+
+func mustJSON(t *testing.T, v interface{}) []byte {
+	t.Helper()
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return b
+}
+
+func writeFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func hashID(data []byte) ID {
+	h := sha256.Sum256(data)
+	return ID(hex.EncodeToString(h[:]))
+}
+
+type testPack struct {
+	buf   bytes.Buffer
+	blobs []map[string]interface{}
+}
+
+func (p *testPack) add(t *testing.T, mk *masterKey, blobType string, plaintext []byte) ID {
+	id := hashID(plaintext)
+	enc := encrypt(t, mk, plaintext)
+
+	p.blobs = append(p.blobs, map[string]interface{}{
+		"id":     id,
+		"type":   blobType,
+		"offset": p.buf.Len(),
+		"length": len(enc),
+	})
+	p.buf.Write(enc)
+
+	return id
+}
+
+// createTestRepository writes a minimal restic repository containing a single snapshot of /home/src.
+func createTestRepository(t *testing.T, dir, password string, snapshotTime time.Time) {
+	t.Helper()
+
+	mk := &masterKey{
+		Encrypt: bytes.Repeat([]byte{1}, aesKeySize),
+		MAC:     macKey{K: bytes.Repeat([]byte{2}, macKeySize), R: bytes.Repeat([]byte{3}, macKeySize)},
+	}
+
+	salt := []byte("0123456789abcdef")
+
+	userKey, err := deriveUserKey(password, salt, 1024, 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeFile(t, filepath.Join(dir, "keys", "k1"), mustJSON(t, map[string]interface{}{
+		"kdf":  "scrypt",
+		"N":    1024,
+		"r":    1,
+		"p":    1,
+		"salt": salt,
+		"data": encrypt(t, userKey, mustJSON(t, mk)),
+	}))
+
+	writeFile(t, filepath.Join(dir, "config"), encrypt(t, mk, mustJSON(t, map[string]interface{}{
+		"version": 1,
+		"id":      "test",
+	})))
+
+	var p testPack
+
+	chunk1 := p.add(t, mk, blobTypeData, []byte("hello, "))
+	chunk2 := p.add(t, mk, blobTypeData, []byte("world"))
+
+	srcTree := p.add(t, mk, blobTypeTree, mustJSON(t, tree{Nodes: []*node{
+		{Name: "file.txt", Type: nodeTypeFile, Mode: 0o644, ModTime: snapshotTime, Size: 12, Content: []ID{chunk1, chunk2}},
+		{Name: "link", Type: nodeTypeSymlink, Mode: os.ModeSymlink | 0o777, ModTime: snapshotTime, LinkTarget: "file.txt"},
+	}}))
+
+	homeTree := p.add(t, mk, blobTypeTree, mustJSON(t, tree{Nodes: []*node{
+		{Name: "src", Type: nodeTypeDir, Mode: os.ModeDir | 0o755, ModTime: snapshotTime, Subtree: srcTree},
+	}}))
+
+	rootTree := p.add(t, mk, blobTypeTree, mustJSON(t, tree{Nodes: []*node{
+		{Name: "home", Type: nodeTypeDir, Mode: os.ModeDir | 0o755, ModTime: snapshotTime, Subtree: homeTree},
+	}}))
+
+	packID := hashID(p.buf.Bytes())
+	writeFile(t, filepath.Join(dir, "data", string(packID[0:2]), string(packID)), p.buf.Bytes())
+
+	writeFile(t, filepath.Join(dir, "index", "i1"), encrypt(t, mk, mustJSON(t, map[string]interface{}{
+		"packs": []interface{}{
+			map[string]interface{}{"id": packID, "blobs": p.blobs},
+		},
+	})))
+
+	writeFile(t, filepath.Join(dir, "snapshots", "s1"), encrypt(t, mk, mustJSON(t, Snapshot{
+		Time:     snapshotTime,
+		Tree:     rootTree,
+		Paths:    []string{"/home/src"},
+		Hostname: "host1",
+		Username: "user1",
+	})))
+}
+
+func TestResticRepository(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	dir, err := ioutil.TempDir("", "restic")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	snapshotTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	createTestRepository(t, dir, "secret", snapshotTime)
+
+	if _, err := Open(ctx, dir, "wrong"); err != ErrInvalidPassword {
+		t.Fatalf("unexpected error when opening with invalid password: %v", err)
+	}
+
+	r, err := Open(ctx, dir, "secret")
+	if err != nil {
+		t.Fatalf("unable to open: %v", err)
+	}
+
+	snaps, err := r.ListSnapshots(ctx)
+	if err != nil || len(snaps) != 1 {
+		t.Fatalf("unexpected snapshots: %v %v", snaps, err)
+	}
+
+	if got, want := snaps[0].Time, snapshotTime; !got.Equal(want) {
+		t.Errorf("invalid snapshot time %v, want %v", got, want)
+	}
+
+	root, rootPath, err := r.SnapshotRoot(ctx, snaps[0])
+	if err != nil {
+		t.Fatalf("unable to get snapshot root: %v", err)
+	}
+
+	if got, want := rootPath, "/home/src"; got != want {
+		t.Errorf("invalid root path %v, want %v", got, want)
+	}
+
+	entries, err := root.Readdir(ctx)
+	if err != nil || len(entries) != 2 {
+		t.Fatalf("unexpected entries: %v %v", entries, err)
+	}
+
+	f, ok := entries.FindByName("file.txt").(fs.File)
+	if !ok {
+		t.Fatalf("file.txt not found")
+	}
+
+	rd, err := f.Open(ctx)
+	if err != nil {
+		t.Fatalf("unable to open file: %v", err)
+	}
+
+	data, err := ioutil.ReadAll(rd)
+	if err != nil {
+		t.Fatalf("unable to read file: %v", err)
+	}
+
+	if got, want := string(data), "hello, world"; got != want {
+		t.Errorf("invalid file contents %q, want %q", got, want)
+	}
+
+	if _, err := rd.Seek(7, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	data, _ = ioutil.ReadAll(rd)
+	if got, want := string(data), "world"; got != want {
+		t.Errorf("invalid file contents after seek %q, want %q", got, want)
+	}
+
+	l, ok := entries.FindByName("link").(fs.Symlink)
+	if !ok {
+		t.Fatalf("link not found")
+	}
+
+	if target, _ := l.Readlink(ctx); target != "file.txt" {
+		t.Errorf("invalid link target %q", target)
+	}
+}
+
+func TestCommonPath(t *testing.T) {
+	cases := []struct {
+		paths []string
+		want  string
+	}{
+		{nil, "/"},
+		{[]string{"/a/b"}, "/a/b"},
+		{[]string{"/a/b", "/a/c"}, "/a"},
+		{[]string{"/a/b", "/a/b/c"}, "/a/b"},
+		{[]string{"/a/bc", "/a/b"}, "/a"},
+		{[]string{"/x", "/y"}, "/"},
+	}
+
+	for _, tc := range cases {
+		if got := commonPath(tc.paths); got != tc.want {
+			t.Errorf("commonPath(%v) = %v, want %v", tc.paths, got, tc.want)
+		}
+	}
+}
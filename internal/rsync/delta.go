@@ -0,0 +1,384 @@
+package rsync
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"io"
+	"math"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	minBlockSize = 1 << 10
+	maxBlockSize = 64 << 10
+
+	// maxLiteralSize is the maximum number of literal bytes sent in a single delta operation.
+	maxLiteralSize = 256 << 10
+)
+
+// BlockSignature contains the checksums of a single block of the basis file.
+type BlockSignature struct {
+	Weak   uint32
+	Strong []byte
+}
+
+// Signature contains the checksums of all blocks of the basis file, which the receiver sends
+// to the sender to allow it to only transfer the parts of the file that differ.
+type Signature struct {
+	BlockSize int
+	Blocks    []BlockSignature
+}
+
+// deltaOp instructs the receiver to append either literal data or a block of the basis file to the output.
+// The last operation has End set and carries the length and checksum of the entire output.
+type deltaOp struct {
+	Block int
+	Data  []byte
+
+	End      bool
+	Length   int64
+	Checksum []byte
+}
+
+// DeltaStats contains statistics about the delta of a single file.
+type DeltaStats struct {
+	LiteralBytes int64
+	MatchedBytes int64
+}
+
+// blockSizeFor returns the block size used for the basis file of the provided size, which balances
+// the size of the signature against the granularity of matches, similar to rsync.
+func blockSizeFor(size int64) int {
+	bs := int(math.Sqrt(float64(size)))
+
+	switch {
+	case bs < minBlockSize:
+		return minBlockSize
+	case bs > maxBlockSize:
+		return maxBlockSize
+	default:
+		return bs
+	}
+}
+
+// rollingChecksum is the rsync weak checksum, which can be updated in constant time as the window
+// slides over the data one byte at a time.
+type rollingChecksum struct {
+	a, b uint32
+	n    uint32
+}
+
+func newRollingChecksum(data []byte) rollingChecksum {
+	var r rollingChecksum
+
+	for _, c := range data {
+		r.rollIn(c)
+	}
+
+	return r
+}
+
+func (r *rollingChecksum) rollIn(c byte) {
+	r.a += uint32(c)
+	r.b += r.a
+	r.n++
+}
+
+func (r *rollingChecksum) rollOut(c byte) {
+	r.a -= uint32(c)
+	r.b -= r.n * uint32(c)
+	r.n--
+}
+
+func (r *rollingChecksum) sum() uint32 {
+	return r.a&0xffff | r.b<<16
+}
+
+func strongChecksum(data []byte) []byte {
+	h := sha256.Sum256(data)
+	return h[:]
+}
+
+// ComputeSignature computes the signature of the basis file.
+func ComputeSignature(r io.Reader, blockSize int) (*Signature, error) {
+	if blockSize <= 0 {
+		return nil, errors.Errorf("invalid block size %v", blockSize)
+	}
+
+	sig := &Signature{BlockSize: blockSize}
+	buf := make([]byte, blockSize)
+
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			rc := newRollingChecksum(buf[0:n])
+
+			sig.Blocks = append(sig.Blocks, BlockSignature{
+				Weak:   rc.sum(),
+				Strong: strongChecksum(buf[0:n]),
+			})
+		}
+
+		switch {
+		case err == io.EOF || err == io.ErrUnexpectedEOF:
+			return sig, nil
+		case err != nil:
+			return nil, errors.Wrap(err, "unable to read basis file")
+		}
+	}
+}
+
+// deltaWriter emits delta operations, batching literal data.
+type deltaWriter struct {
+	enc     *gob.Encoder
+	literal []byte
+	stats   DeltaStats
+}
+
+func (w *deltaWriter) addLiteral(c byte) error {
+	w.literal = append(w.literal, c)
+
+	if len(w.literal) >= maxLiteralSize {
+		return w.flushLiteral()
+	}
+
+	return nil
+}
+
+func (w *deltaWriter) flushLiteral() error {
+	if len(w.literal) == 0 {
+		return nil
+	}
+
+	w.stats.LiteralBytes += int64(len(w.literal))
+
+	if err := w.enc.Encode(deltaOp{Block: -1, Data: w.literal}); err != nil {
+		return errors.Wrap(err, "unable to write delta")
+	}
+
+	w.literal = w.literal[:0]
+
+	return nil
+}
+
+func (w *deltaWriter) addBlock(index, length int) error {
+	if err := w.flushLiteral(); err != nil {
+		return err
+	}
+
+	w.stats.MatchedBytes += int64(length)
+
+	return errors.Wrap(w.enc.Encode(deltaOp{Block: index}), "unable to write delta")
+}
+
+// WriteDelta writes the delta that transforms the basis file with the provided signature into
+// the contents of r. Blocks of the basis file are found at any offset using the rolling checksum.
+func WriteDelta(sig *Signature, r io.Reader, w io.Writer) (DeltaStats, error) {
+	blocksByWeak := map[uint32][]int{}
+
+	for i, b := range sig.Blocks {
+		blocksByWeak[b.Weak] = append(blocksByWeak[b.Weak], i)
+	}
+
+	findBlock := func(weak uint32, window []byte) int {
+		candidates := blocksByWeak[weak]
+		if len(candidates) == 0 {
+			return -1
+		}
+
+		strong := strongChecksum(window)
+
+		for _, i := range candidates {
+			// only the last block of the basis file can be shorter than the block size.
+			if bytes.Equal(sig.Blocks[i].Strong, strong) && (len(window) == sig.BlockSize || i == len(sig.Blocks)-1) {
+				return i
+			}
+		}
+
+		return -1
+	}
+
+	h := sha256.New()
+	br := bufio.NewReader(io.TeeReader(r, h))
+	dw := &deltaWriter{enc: gob.NewEncoder(w)}
+
+	var length int64
+
+	fill := func(window []byte) ([]byte, error) {
+		for len(window) < sig.BlockSize {
+			c, err := br.ReadByte()
+			if err == io.EOF {
+				break
+			}
+
+			if err != nil {
+				return nil, errors.Wrap(err, "unable to read source")
+			}
+
+			length++
+
+			window = append(window, c)
+		}
+
+		return window, nil
+	}
+
+	window, err := fill(make([]byte, 0, sig.BlockSize))
+	if err != nil {
+		return dw.stats, err
+	}
+
+	rc := newRollingChecksum(window)
+	atEOF := len(window) < sig.BlockSize
+
+	for len(window) > 0 {
+		if i := findBlock(rc.sum(), window); i >= 0 {
+			if err := dw.addBlock(i, len(window)); err != nil {
+				return dw.stats, err
+			}
+
+			if window, err = fill(window[:0]); err != nil {
+				return dw.stats, err
+			}
+
+			rc = newRollingChecksum(window)
+			atEOF = len(window) < sig.BlockSize
+
+			continue
+		}
+
+		out := window[0]
+		if err := dw.addLiteral(out); err != nil {
+			return dw.stats, err
+		}
+
+		rc.rollOut(out)
+
+		if !atEOF {
+			c, err := br.ReadByte()
+
+			switch {
+			case err == io.EOF:
+				atEOF = true
+			case err != nil:
+				return dw.stats, errors.Wrap(err, "unable to read source")
+			default:
+				length++
+
+				window = append(window, c)
+
+				rc.rollIn(c)
+			}
+		}
+
+		window = window[1:]
+	}
+
+	if err := dw.flushLiteral(); err != nil {
+		return dw.stats, err
+	}
+
+	if err := dw.enc.Encode(deltaOp{End: true, Length: length, Checksum: h.Sum(nil)}); err != nil {
+		return dw.stats, errors.Wrap(err, "unable to write delta")
+	}
+
+	return dw.stats, nil
+}
+
+// ApplyDelta writes the output described by the delta to w, reading matched blocks from the basis file.
+// It fails unless the entire delta has been received and the output matches its checksum.
+func ApplyDelta(basis io.ReaderAt, blockSize int, delta io.Reader, w io.Writer) (int64, error) {
+	dec := gob.NewDecoder(delta)
+	h := sha256.New()
+	out := io.MultiWriter(w, h)
+
+	var length int64
+
+	for {
+		var op deltaOp
+
+		if err := dec.Decode(&op); err != nil {
+			return length, errors.Wrap(err, "unable to read delta")
+		}
+
+		if op.End {
+			if op.Length != length || !bytes.Equal(op.Checksum, h.Sum(nil)) {
+				return length, errors.Errorf("output does not match checksum of the source")
+			}
+
+			return length, nil
+		}
+
+		var (
+			n   int64
+			err error
+		)
+
+		if op.Block < 0 {
+			var nn int
+
+			nn, err = out.Write(op.Data)
+			n = int64(nn)
+		} else {
+			n, err = io.Copy(out, io.NewSectionReader(basis, int64(op.Block)*int64(blockSize), int64(blockSize)))
+		}
+
+		if err != nil {
+			return length, errors.Wrap(err, "unable to write output")
+		}
+
+		length += n
+	}
+}
+
+// WriteFileSignature writes the signature of the basis file to w, it runs on the remote host.
+func WriteFileSignature(basisPath string, blockSize int, w io.Writer) error {
+	f, err := os.Open(basisPath) //nolint:gosec
+	if err != nil {
+		return errors.Wrap(err, "unable to open basis file")
+	}
+	defer f.Close() //nolint:errcheck
+
+	sig, err := ComputeSignature(bufio.NewReader(f), blockSize)
+	if err != nil {
+		return err
+	}
+
+	return errors.Wrap(gob.NewEncoder(w).Encode(sig), "unable to write signature")
+}
+
+// ApplyFileDelta creates targetPath from the basis file and the delta read from r, it runs on the remote host.
+// The target file is removed if the delta can't be applied.
+func ApplyFileDelta(basisPath, targetPath string, blockSize int, r io.Reader) error {
+	basis, err := os.Open(basisPath) //nolint:gosec
+	if err != nil {
+		return errors.Wrap(err, "unable to open basis file")
+	}
+	defer basis.Close() //nolint:errcheck
+
+	f, err := os.Create(targetPath)
+	if err != nil {
+		return errors.Wrap(err, "unable to create target file")
+	}
+
+	bw := bufio.NewWriter(f)
+
+	_, err = ApplyDelta(basis, blockSize, r, bw)
+	if err == nil {
+		err = bw.Flush()
+	}
+
+	if cerr := f.Close(); err == nil {
+		err = errors.Wrap(cerr, "unable to close target file")
+	}
+
+	if err != nil {
+		os.Remove(targetPath) //nolint:errcheck
+	}
+
+	return err
+}
@@ -0,0 +1,96 @@
+package rsync
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func TestDeltaRoundTrip(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+
+	randomBytes := func(n int) []byte {
+		b := make([]byte, n)
+		rnd.Read(b)
+
+		return b
+	}
+
+	basis := randomBytes(100000)
+	concat := func(parts ...[]byte) []byte {
+		return bytes.Join(parts, nil)
+	}
+
+	cases := []struct {
+		desc        string
+		source      []byte
+		maxLiterals int64
+	}{
+		{"identical", basis, 0},
+		{"empty", nil, 0},
+		{"modified in the middle", concat(basis[0:50000], []byte("xyz"), basis[50003:]), 2 * 1024},
+		{"inserted", concat(basis[0:30000], randomBytes(100), basis[30000:]), 2*1024 + 100},
+		{"deleted", concat(basis[0:30000], basis[31000:]), 2 * 1024},
+		{"truncated", basis[0:70000], 1024},
+		{"appended", concat(basis, randomBytes(500)), 1024 + 500},
+		{"unrelated", randomBytes(5000), 5000},
+	}
+
+	for _, tc := range cases {
+		sig, err := ComputeSignature(bytes.NewReader(basis), minBlockSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var delta bytes.Buffer
+
+		stats, err := WriteDelta(sig, bytes.NewReader(tc.source), &delta)
+		if err != nil {
+			t.Fatalf("%v: unable to write delta: %v", tc.desc, err)
+		}
+
+		if stats.LiteralBytes > tc.maxLiterals {
+			t.Errorf("%v: too many literal bytes: %v, want at most %v", tc.desc, stats.LiteralBytes, tc.maxLiterals)
+		}
+
+		if got, want := stats.LiteralBytes+stats.MatchedBytes, int64(len(tc.source)); got != want {
+			t.Errorf("%v: unexpected total bytes %v, want %v", tc.desc, got, want)
+		}
+
+		var out bytes.Buffer
+
+		if _, err := ApplyDelta(bytes.NewReader(basis), minBlockSize, &delta, &out); err != nil {
+			t.Fatalf("%v: unable to apply delta: %v", tc.desc, err)
+		}
+
+		if !bytes.Equal(out.Bytes(), tc.source) {
+			t.Errorf("%v: invalid output", tc.desc)
+		}
+	}
+}
+
+func TestApplyDeltaIncomplete(t *testing.T) {
+	basis := bytes.Repeat([]byte("abcdefgh"), 1000)
+
+	sig, err := ComputeSignature(bytes.NewReader(basis), minBlockSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var delta bytes.Buffer
+
+	if _, err := WriteDelta(sig, bytes.NewReader(append([]byte("prefix"), basis...)), &delta); err != nil {
+		t.Fatal(err)
+	}
+
+	truncated := delta.Bytes()[0 : delta.Len()-10]
+
+	if _, err := ApplyDelta(bytes.NewReader(basis), minBlockSize, bytes.NewReader(truncated), &bytes.Buffer{}); err == nil {
+		t.Errorf("truncated delta was applied")
+	}
+
+	// basis that changed since the signature was computed.
+	if _, err := ApplyDelta(bytes.NewReader(bytes.ToUpper(basis)), minBlockSize, bytes.NewReader(delta.Bytes()), &bytes.Buffer{}); err == nil {
+		t.Errorf("delta was applied to different basis")
+	}
+}
@@ -0,0 +1,72 @@
+package rsync
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ReceiverCommand is the kopia command which runs the receiving side of delta transfers on the remote host.
+const ReceiverCommand = "rsync-receiver"
+
+// sshRemote runs kopia on the remote host using separate SSH sessions.
+type sshRemote struct {
+	sshArgs []string // ssh command including the host
+	kopia   []string
+}
+
+// run runs the kopia receiver with the provided arguments on the remote host.
+func (r *sshRemote) run(ctx context.Context, stdin io.Reader, stdout io.Writer, args ...string) error {
+	var remoteCommand []string
+
+	for _, a := range append(append(append([]string{}, r.kopia...), ReceiverCommand), args...) {
+		remoteCommand = append(remoteCommand, shellQuote(a))
+	}
+
+	// ssh passes the command to the remote shell as a single string.
+	cmdArgs := append(append([]string{}, r.sshArgs...), strings.Join(remoteCommand, " "))
+
+	var stderr bytes.Buffer
+
+	cmd := exec.CommandContext(ctx, cmdArgs[0], cmdArgs[1:]...) //nolint:gosec
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return errors.Wrapf(err, "remote %v failed: %v", ReceiverCommand, strings.TrimSpace(stderr.String()))
+	}
+
+	return nil
+}
+
+func (r *sshRemote) Signature(ctx context.Context, basisPath string, blockSize int) (*Signature, error) {
+	var out bytes.Buffer
+
+	if err := r.run(ctx, nil, &out, "signature", "--block-size="+strconv.Itoa(blockSize), basisPath); err != nil {
+		return nil, err
+	}
+
+	var sig Signature
+
+	if err := gob.NewDecoder(&out).Decode(&sig); err != nil {
+		return nil, errors.Wrap(err, "invalid signature")
+	}
+
+	return &sig, nil
+}
+
+func (r *sshRemote) Patch(ctx context.Context, basisPath, targetPath string, blockSize int, delta io.Reader) error {
+	return r.run(ctx, delta, nil, "patch", "--block-size="+strconv.Itoa(blockSize), basisPath, targetPath)
+}
+
+// shellQuote quotes the argument for POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,469 @@
+// Package rsync implements rsync-style synchronization of filesystem trees to remote hosts over SSH.
+//
+// The remote side is accessed using the SFTP subsystem of the system 'ssh' client, so it honors
+// the user's SSH configuration and only requires a standard SSH server on the target host.
+// Similar to rsync's quick check, files whose size and modification time already match
+// are not transferred again.
+//
+// When kopia is also installed on the remote host, changed files are transferred using rsync's
+// delta algorithm: the remote host sends checksums of the blocks of its copy of the file and
+// only the parts of the file that can't be found among those blocks are transferred.
+package rsync
+
+import (
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+	psftp "github.com/pkg/sftp"
+
+	"github.com/kopia/kopia/fs"
+	"github.com/kopia/kopia/internal/iocopy"
+	"github.com/kopia/kopia/repo/logging"
+)
+
+var log = logging.GetContextLoggerFunc("kopia/rsync")
+
+const tempFileSuffix = ".kopia-tmp"
+
+// Options controls the behavior of Sync.
+type Options struct {
+	// Delete removes remote entries that are not present in the source tree.
+	Delete bool
+
+	// Remote enables delta transfer of files that exist on the remote host, if provided.
+	Remote Remote
+}
+
+// Stats contains statistics about a completed synchronization.
+type Stats struct {
+	FilesCopied  int
+	FilesPatched int
+	FilesSkipped int
+	BytesCopied  int64
+	BytesMatched int64
+	Deleted      int
+}
+
+// Remote computes signatures of remote files and applies deltas to them on the remote host.
+type Remote interface {
+	Signature(ctx context.Context, basisPath string, blockSize int) (*Signature, error)
+	Patch(ctx context.Context, basisPath, targetPath string, blockSize int, delta io.Reader) error
+}
+
+// Destination represents a remote directory accessed over SSH.
+type Destination struct {
+	Client *psftp.Client
+	Path   string
+
+	sshArgs []string
+	cmd     *exec.Cmd
+}
+
+// Remote returns the Remote which runs the provided kopia command on the remote host.
+func (d *Destination) Remote(kopiaCommand string) Remote {
+	return &sshRemote{
+		sshArgs: d.sshArgs,
+		kopia:   strings.Fields(kopiaCommand),
+	}
+}
+
+// Close closes the connection to the remote host.
+func (d *Destination) Close() error {
+	err := d.Client.Close()
+
+	if d.cmd != nil {
+		d.cmd.Wait() //nolint:errcheck
+	}
+
+	return err
+}
+
+// ParseTarget parses the target in the form of '[user@]host:path' into the host part and path.
+func ParseTarget(target string) (host, targetPath string, err error) {
+	p := strings.Index(target, ":")
+	if p <= 0 {
+		return "", "", errors.Errorf("invalid target %q, must be [user@]host:path", target)
+	}
+
+	host, targetPath = target[0:p], target[p+1:]
+	if targetPath == "" {
+		targetPath = "."
+	}
+
+	return host, targetPath, nil
+}
+
+// Dial connects to the remote target in the form of '[user@]host:path' using the provided ssh command.
+func Dial(ctx context.Context, target, sshCommand string) (*Destination, error) {
+	host, targetPath, err := ParseTarget(target)
+	if err != nil {
+		return nil, err
+	}
+
+	args := strings.Fields(sshCommand)
+	if len(args) == 0 {
+		return nil, errors.New("ssh command not provided")
+	}
+
+	args = append(args, host)
+
+	cmd := exec.CommandContext(ctx, args[0], append(args[1:], "-s", "sftp")...) //nolint:gosec
+	cmd.Stderr = os.Stderr
+
+	wr, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to get stdin")
+	}
+
+	rd, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to get stdout")
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, errors.Wrapf(err, "unable to start %v", args[0])
+	}
+
+	cli, err := psftp.NewClientPipe(rd, wr)
+	if err != nil {
+		cmd.Process.Kill() //nolint:errcheck
+		cmd.Wait()         //nolint:errcheck
+
+		return nil, errors.Wrapf(err, "unable to establish SFTP session with %v", host)
+	}
+
+	return &Destination{Client: cli, Path: targetPath, sshArgs: args, cmd: cmd}, nil
+}
+
+// Sync copies the provided entry to targetPath on the remote host, transferring only files that differ.
+func Sync(ctx context.Context, cli *psftp.Client, targetPath string, e fs.Entry, opt Options) (*Stats, error) {
+	s := &syncer{cli: cli, Options: opt}
+
+	if err := s.syncEntry(ctx, e, targetPath); err != nil {
+		return &s.stats, err
+	}
+
+	return &s.stats, nil
+}
+
+type syncer struct {
+	Options
+
+	cli   *psftp.Client
+	stats Stats
+}
+
+func (s *syncer) syncEntry(ctx context.Context, e fs.Entry, targetPath string) error {
+	var err error
+
+	switch e := e.(type) {
+	case fs.Directory:
+		err = s.syncDirectory(ctx, e, targetPath)
+	case fs.File:
+		err = s.syncFile(ctx, e, targetPath)
+	case fs.Symlink:
+		// symlink attributes can't be set over SFTP.
+		return s.syncSymlink(ctx, e, targetPath)
+	default:
+		return errors.Errorf("invalid FS entry type for %q: %#v", targetPath, e)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return s.setAttributes(ctx, targetPath, e)
+}
+
+func (s *syncer) syncDirectory(ctx context.Context, d fs.Directory, targetPath string) error {
+	switch st, err := s.cli.Lstat(targetPath); {
+	case os.IsNotExist(err):
+		if err := s.cli.MkdirAll(targetPath); err != nil {
+			return errors.Wrapf(err, "unable to create directory %v", targetPath)
+		}
+	case err != nil:
+		return errors.Wrapf(err, "unable to stat %v", targetPath)
+	case !st.IsDir():
+		if err := s.removeAll(targetPath); err != nil {
+			return err
+		}
+
+		if err := s.cli.Mkdir(targetPath); err != nil {
+			return errors.Wrapf(err, "unable to create directory %v", targetPath)
+		}
+	}
+
+	entries, err := d.Readdir(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		if err := s.syncEntry(ctx, e, path.Join(targetPath, e.Name())); err != nil {
+			return err
+		}
+	}
+
+	if s.Delete {
+		return s.deleteExtraneous(ctx, entries, targetPath)
+	}
+
+	return nil
+}
+
+func (s *syncer) deleteExtraneous(ctx context.Context, entries fs.Entries, targetPath string) error {
+	remote, err := s.cli.ReadDir(targetPath)
+	if err != nil {
+		return errors.Wrapf(err, "unable to list %v", targetPath)
+	}
+
+	for _, fi := range remote {
+		if entries.FindByName(fi.Name()) != nil {
+			continue
+		}
+
+		log(ctx).Debugf("deleting %v", path.Join(targetPath, fi.Name()))
+
+		if err := s.removeAll(path.Join(targetPath, fi.Name())); err != nil {
+			return err
+		}
+
+		s.stats.Deleted++
+	}
+
+	return nil
+}
+
+func (s *syncer) removeAll(p string) error {
+	st, err := s.cli.Lstat(p)
+	if err != nil {
+		return errors.Wrapf(err, "unable to stat %v", p)
+	}
+
+	if !st.IsDir() {
+		return errors.Wrapf(s.cli.Remove(p), "unable to remove %v", p)
+	}
+
+	children, err := s.cli.ReadDir(p)
+	if err != nil {
+		return errors.Wrapf(err, "unable to list %v", p)
+	}
+
+	for _, c := range children {
+		if err := s.removeAll(path.Join(p, c.Name())); err != nil {
+			return err
+		}
+	}
+
+	return errors.Wrapf(s.cli.RemoveDirectory(p), "unable to remove %v", p)
+}
+
+// isUpToDate implements rsync's quick check - a remote file is considered up-to-date if the size and
+// modification time (with SFTP's one-second resolution) match.
+func isUpToDate(st os.FileInfo, f fs.File) bool {
+	return st.Mode().IsRegular() && st.Size() == f.Size() && st.ModTime().Unix() == f.ModTime().Unix()
+}
+
+func (s *syncer) syncFile(ctx context.Context, f fs.File, targetPath string) error {
+	st, err := s.cli.Lstat(targetPath)
+
+	switch {
+	case err == nil && isUpToDate(st, f):
+		s.stats.FilesSkipped++
+		return nil
+	case err == nil && st.IsDir():
+		if err := s.removeAll(targetPath); err != nil {
+			return err
+		}
+	case err != nil && !os.IsNotExist(err):
+		return errors.Wrapf(err, "unable to stat %v", targetPath)
+	}
+
+	if err == nil && st.Mode().IsRegular() && st.Size() > 0 && s.Remote != nil {
+		patched, err := s.patchFile(ctx, f, targetPath, st.Size())
+		if err != nil || patched {
+			return err
+		}
+	}
+
+	r, err := f.Open(ctx)
+	if err != nil {
+		return errors.Wrap(err, "unable to open snapshot file for "+targetPath)
+	}
+	defer r.Close() //nolint:errcheck
+
+	log(ctx).Debugf("copying file contents to: %v", targetPath)
+
+	n, err := s.writeFileAtomically(targetPath, r)
+	if err != nil {
+		return err
+	}
+
+	s.stats.FilesCopied++
+	s.stats.BytesCopied += n
+
+	return nil
+}
+
+// patchFile transfers the file using the delta against the existing remote file, returning false
+// if delta transfer is not available on the remote host.
+func (s *syncer) patchFile(ctx context.Context, f fs.File, targetPath string, remoteSize int64) (bool, error) {
+	blockSize := blockSizeFor(remoteSize)
+
+	sig, err := s.Remote.Signature(ctx, targetPath, blockSize)
+	if err != nil {
+		log(ctx).Warningf("delta transfer not available, copying whole files: %v", err)
+
+		s.Remote = nil
+
+		return false, nil
+	}
+
+	r, err := f.Open(ctx)
+	if err != nil {
+		return false, errors.Wrap(err, "unable to open snapshot file for "+targetPath)
+	}
+	defer r.Close() //nolint:errcheck
+
+	log(ctx).Debugf("transferring delta to: %v", targetPath)
+
+	tmpPath := tempPath(targetPath)
+	pr, pw := io.Pipe()
+
+	var stats DeltaStats
+
+	deltaErr := make(chan error, 1)
+
+	go func() {
+		var err error
+
+		stats, err = WriteDelta(sig, r, pw)
+		pw.CloseWithError(err)
+		deltaErr <- err
+	}()
+
+	err = s.Remote.Patch(ctx, targetPath, tmpPath, blockSize, pr)
+	// unblock the delta writer if the remote host stopped reading.
+	pr.CloseWithError(io.ErrClosedPipe)
+
+	if derr := <-deltaErr; err == nil && derr != nil {
+		err = derr
+	}
+
+	if err == nil {
+		err = s.renameIntoPlace(tmpPath, targetPath)
+	}
+
+	if err != nil {
+		s.cli.Remove(tmpPath) //nolint:errcheck
+		return false, errors.Wrapf(err, "unable to transfer delta to %v", targetPath)
+	}
+
+	s.stats.FilesPatched++
+	s.stats.BytesCopied += stats.LiteralBytes
+	s.stats.BytesMatched += stats.MatchedBytes
+
+	return true, nil
+}
+
+func tempPath(targetPath string) string {
+	return path.Join(path.Dir(targetPath), "."+path.Base(targetPath)+tempFileSuffix)
+}
+
+// writeFileAtomically writes the contents to a temporary file next to targetPath and renames it into place,
+// so that an interrupted transfer never leaves a partially-written file behind.
+func (s *syncer) writeFileAtomically(targetPath string, r io.Reader) (int64, error) {
+	tmpPath := tempPath(targetPath)
+
+	w, err := s.cli.Create(tmpPath)
+	if err != nil {
+		return 0, errors.Wrapf(err, "unable to create %v", tmpPath)
+	}
+
+	n, err := iocopy.Copy(w, r)
+	if err != nil {
+		w.Close()             //nolint:errcheck
+		s.cli.Remove(tmpPath) //nolint:errcheck
+
+		return 0, errors.Wrapf(err, "unable to write %v", tmpPath)
+	}
+
+	if err := w.Close(); err != nil {
+		s.cli.Remove(tmpPath) //nolint:errcheck
+		return 0, errors.Wrapf(err, "unable to close %v", tmpPath)
+	}
+
+	if err := s.renameIntoPlace(tmpPath, targetPath); err != nil {
+		s.cli.Remove(tmpPath) //nolint:errcheck
+		return 0, err
+	}
+
+	return n, nil
+}
+
+func (s *syncer) renameIntoPlace(tmpPath, targetPath string) error {
+	if err := s.cli.PosixRename(tmpPath, targetPath); err != nil {
+		// server does not support posix-rename@openssh.com, fall back to regular rename,
+		// which fails if the target exists.
+		s.cli.Remove(targetPath) //nolint:errcheck
+
+		if err := s.cli.Rename(tmpPath, targetPath); err != nil {
+			return errors.Wrapf(err, "unable to rename %v", tmpPath)
+		}
+	}
+
+	return nil
+}
+
+func (s *syncer) syncSymlink(ctx context.Context, l fs.Symlink, targetPath string) error {
+	target, err := l.Readlink(ctx)
+	if err != nil {
+		return errors.Wrapf(err, "unable to read symlink for %v", targetPath)
+	}
+
+	if st, err := s.cli.Lstat(targetPath); err == nil {
+		if st.Mode()&os.ModeSymlink != 0 {
+			if existing, err := s.cli.ReadLink(targetPath); err == nil && existing == target {
+				s.stats.FilesSkipped++
+				return nil
+			}
+		}
+
+		if err := s.removeAll(targetPath); err != nil {
+			return err
+		}
+	}
+
+	if err := s.cli.Symlink(target, targetPath); err != nil {
+		return errors.Wrapf(err, "unable to create symlink %v", targetPath)
+	}
+
+	s.stats.FilesCopied++
+
+	return nil
+}
+
+// setAttributes sets permissions, modification time and ownership of targetPath.
+// Ownership changes typically require root privileges on the remote host, so failures are only logged.
+func (s *syncer) setAttributes(ctx context.Context, targetPath string, e fs.Entry) error {
+	const modBits = os.ModePerm | os.ModeSetgid | os.ModeSetuid | os.ModeSticky
+
+	if err := s.cli.Chmod(targetPath, e.Mode()&modBits); err != nil {
+		return errors.Wrapf(err, "could not change permissions on %v", targetPath)
+	}
+
+	if err := s.cli.Chtimes(targetPath, e.ModTime(), e.ModTime()); err != nil {
+		return errors.Wrapf(err, "could not change mod time on %v", targetPath)
+	}
+
+	if err := s.cli.Chown(targetPath, int(e.Owner().UserID), int(e.Owner().GroupID)); err != nil {
+		log(ctx).Debugf("could not change owner/group for %v: %v", targetPath, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,242 @@
+package rsync
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	psftp "github.com/pkg/sftp"
+
+	"github.com/kopia/kopia/fs/localfs"
+	"github.com/kopia/kopia/internal/testlogging"
+)
+
+// connectInProcess returns SFTP client connected to in-process server operating on the local filesystem.
+func connectInProcess(t *testing.T) *psftp.Client {
+	t.Helper()
+
+	c1, c2 := net.Pipe()
+
+	srv, err := psftp.NewServer(c2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go srv.Serve() //nolint:errcheck
+
+	cli, err := psftp.NewClientPipe(c1, c1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		cli.Close()
+		srv.Close()
+	})
+
+	return cli
+}
+
+func mustWriteFile(t *testing.T, fname, contents string, mtime time.Time) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(fname), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(fname, []byte(contents), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Chtimes(fname, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSync(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	tmp, err := ioutil.TempDir("", "rsync")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(tmp)
+
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	mustWriteFile(t, filepath.Join(src, "a.txt"), "aaa", mtime)
+	mustWriteFile(t, filepath.Join(src, "sub", "b.txt"), "bbbb", mtime)
+
+	if err := os.Symlink("a.txt", filepath.Join(src, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	cli := connectInProcess(t)
+
+	srcEntry, err := localfs.NewEntry(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := Sync(ctx, cli, dst, srcEntry, Options{})
+	if err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+
+	if got, want := stats.FilesCopied, 3; got != want {
+		t.Errorf("invalid number of files copied: %v, want %v", got, want)
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(dst, "sub", "b.txt"))
+	if err != nil || string(b) != "bbbb" {
+		t.Errorf("invalid contents of b.txt: %q %v", b, err)
+	}
+
+	if target, err := os.Readlink(filepath.Join(dst, "link")); err != nil || target != "a.txt" {
+		t.Errorf("invalid link: %v %v", target, err)
+	}
+
+	// modify one file, add extraneous file on the destination and sync again.
+	mustWriteFile(t, filepath.Join(src, "a.txt"), "AAAAA", mtime.Add(time.Hour))
+	mustWriteFile(t, filepath.Join(dst, "extra", "c.txt"), "c", mtime)
+
+	if srcEntry, err = localfs.NewEntry(src); err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err = Sync(ctx, cli, dst, srcEntry, Options{Delete: true})
+	if err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+
+	if got, want := *stats, (Stats{FilesCopied: 1, FilesSkipped: 2, BytesCopied: 5, Deleted: 1}); got != want {
+		t.Errorf("invalid stats: %+v, want %+v", got, want)
+	}
+
+	if _, err := os.Stat(filepath.Join(dst, "extra")); !os.IsNotExist(err) {
+		t.Errorf("extraneous directory was not deleted: %v", err)
+	}
+
+	st, err := os.Stat(filepath.Join(dst, "a.txt"))
+	if err != nil || !st.ModTime().Equal(mtime.Add(time.Hour)) {
+		t.Errorf("invalid modification time of a.txt: %v %v", st, err)
+	}
+}
+
+func TestParseTarget(t *testing.T) {
+	cases := []struct {
+		target, host, path string
+		wantErr            bool
+	}{
+		{"user@host:/tmp/x", "user@host", "/tmp/x", false},
+		{"host:", "host", ".", false},
+		{"host:rel/path", "host", "rel/path", false},
+		{"/local/path", "", "", true},
+		{":/x", "", "", true},
+	}
+
+	for _, tc := range cases {
+		host, p, err := ParseTarget(tc.target)
+		if (err != nil) != tc.wantErr || host != tc.host || p != tc.path {
+			t.Errorf("ParseTarget(%q) = %q, %q, %v", tc.target, host, p, err)
+		}
+	}
+}
+
+// localRemote runs the receiver in-process, operating on the same filesystem as the in-process SFTP server.
+type localRemote struct {
+	failSignature bool
+}
+
+func (r *localRemote) Signature(ctx context.Context, basisPath string, blockSize int) (*Signature, error) {
+	if r.failSignature {
+		return nil, errors.New("kopia: command not found")
+	}
+
+	var buf bytes.Buffer
+
+	if err := WriteFileSignature(basisPath, blockSize, &buf); err != nil {
+		return nil, err
+	}
+
+	var sig Signature
+
+	return &sig, gob.NewDecoder(&buf).Decode(&sig)
+}
+
+func (r *localRemote) Patch(ctx context.Context, basisPath, targetPath string, blockSize int, delta io.Reader) error {
+	return ApplyFileDelta(basisPath, targetPath, blockSize, delta)
+}
+
+func TestSyncDelta(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	tmp, err := ioutil.TempDir("", "rsync")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(tmp)
+
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	contents := strings.Repeat("some line of text\n", 100000)
+
+	mustWriteFile(t, filepath.Join(src, "big.txt"), contents, mtime)
+	mustWriteFile(t, filepath.Join(dst, "big.txt"), "prefix\n"+contents[0:1000000]+"changed"+contents[1000007:], mtime.Add(-time.Hour))
+
+	srcEntry, err := localfs.NewEntry(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cli := connectInProcess(t)
+
+	stats, err := Sync(ctx, cli, dst, srcEntry, Options{Remote: &localRemote{}})
+	if err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+
+	if stats.FilesPatched != 1 || stats.FilesCopied != 0 {
+		t.Errorf("file was not patched: %+v", stats)
+	}
+
+	if stats.BytesCopied > int64(len(contents))/100 {
+		t.Errorf("too many bytes transferred: %+v", stats)
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(dst, "big.txt"))
+	if err != nil || string(b) != contents {
+		t.Errorf("invalid contents of big.txt: %v", err)
+	}
+
+	// when the receiver is not available on the remote host, whole files are copied.
+	mustWriteFile(t, filepath.Join(dst, "big.txt"), "x", mtime)
+
+	stats, err = Sync(ctx, cli, dst, srcEntry, Options{Remote: &localRemote{failSignature: true}})
+	if err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+
+	if stats.FilesPatched != 0 || stats.FilesCopied != 1 || stats.BytesCopied != int64(len(contents)) {
+		t.Errorf("file was not copied: %+v", stats)
+	}
+
+	if b, err := ioutil.ReadFile(filepath.Join(dst, "big.txt")); err != nil || string(b) != contents {
+		t.Errorf("invalid contents of big.txt: %v", err)
+	}
+}
@@ -0,0 +1,586 @@
+// Package s3gateway implements read-only S3-compatible API exposing snapshot contents.
+//
+// Each snapshot is exposed as a bucket named after its manifest ID and files within
+// the snapshot are exposed as objects whose keys are slash-separated paths relative to
+// the snapshot root. Only path-style requests are supported.
+package s3gateway
+
+import (
+	"context"
+	"encoding/xml"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/kopia/kopia/fs"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/logging"
+	"github.com/kopia/kopia/repo/manifest"
+	"github.com/kopia/kopia/repo/object"
+	"github.com/kopia/kopia/snapshot"
+	"github.com/kopia/kopia/snapshot/snapshotfs"
+)
+
+var log = logging.GetContextLoggerFunc("kopia/s3gateway")
+
+const (
+	s3Namespace      = "http://s3.amazonaws.com/doc/2006-03-01/"
+	s3TimeFormat     = "2006-01-02T15:04:05.000Z"
+	defaultMaxKeys   = 1000
+	defaultRegion    = "us-east-1"
+	keySeparator     = "/"
+	listTypeV2       = "2"
+	storageClassName = "STANDARD"
+)
+
+// Options provides configuration of the gateway.
+type Options struct {
+	// AccessKeyID and SecretAccessKey used to verify AWS Signature Version 4 of incoming requests.
+	// When both are empty, anonymous requests are accepted.
+	AccessKeyID     string
+	SecretAccessKey string
+
+	// Region reported to clients and used for signature verification, defaults to 'us-east-1'.
+	Region string
+}
+
+// RepositoryProvider provides the repository used to serve each request.
+type RepositoryProvider interface {
+	// UseRepository invokes the callback with the current repository, which is nil when not connected.
+	// The repository must not be used after the callback returns, since it may be closed or replaced.
+	UseRepository(ctx context.Context, cb func(rep *repo.Repository))
+}
+
+type gateway struct {
+	repos   RepositoryProvider
+	options Options
+}
+
+// New returns HTTP handler implementing S3-compatible API on top of the snapshots in the repository
+// returned by the provider.
+func New(repos RepositoryProvider, opt Options) http.Handler {
+	if opt.Region == "" {
+		opt.Region = defaultRegion
+	}
+
+	return &gateway{repos, opt}
+}
+
+func (g *gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	log(ctx).Debugf("S3 request %v %v", r.Method, r.URL)
+
+	if err := g.authenticate(r); err != nil {
+		writeError(ctx, w, r, err)
+		return
+	}
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeError(ctx, w, r, errAccessDenied("the gateway is read-only"))
+		return
+	}
+
+	g.repos.UseRepository(ctx, func(rep *repo.Repository) {
+		if rep == nil {
+			writeError(ctx, w, r, errServiceUnavailable("not connected to a repository"))
+			return
+		}
+
+		if err := g.serveRequest(ctx, w, r, rep); err != nil {
+			writeError(ctx, w, r, err)
+		}
+	})
+}
+
+func (g *gateway) serveRequest(ctx context.Context, w http.ResponseWriter, r *http.Request, rep *repo.Repository) *s3Error {
+	bucket, key := splitBucketAndKey(r.URL.Path)
+
+	switch {
+	case bucket == "":
+		return g.listBuckets(ctx, w, rep)
+	case key == "" && r.URL.Query()["location"] != nil:
+		return g.getBucketLocation(ctx, w, rep, bucket)
+	case key == "" && r.Method == http.MethodHead:
+		_, err := g.bucketRoot(ctx, rep, bucket)
+		return err
+	case key == "":
+		return g.listObjects(ctx, w, r, rep, bucket)
+	default:
+		return g.getObject(ctx, w, r, rep, bucket, key)
+	}
+}
+
+func splitBucketAndKey(p string) (bucket, key string) {
+	p = strings.TrimPrefix(p, "/")
+
+	if i := strings.Index(p, keySeparator); i >= 0 {
+		return p[0:i], p[i+1:]
+	}
+
+	return p, ""
+}
+
+func writeXML(ctx context.Context, w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/xml")
+
+	if _, err := w.Write([]byte(xml.Header)); err != nil {
+		return
+	}
+
+	if err := xml.NewEncoder(w).Encode(v); err != nil {
+		log(ctx).Warningf("error encoding response: %v", err)
+	}
+}
+
+type bucketInfo struct {
+	Name         string `xml:"Name"`
+	CreationDate string `xml:"CreationDate"`
+}
+
+type listAllMyBucketsResult struct {
+	XMLName xml.Name     `xml:"ListAllMyBucketsResult"`
+	Xmlns   string       `xml:"xmlns,attr"`
+	Buckets []bucketInfo `xml:"Buckets>Bucket"`
+}
+
+func (g *gateway) listBuckets(ctx context.Context, w http.ResponseWriter, rep *repo.Repository) *s3Error {
+	ids, err := snapshot.ListSnapshotManifests(ctx, rep, nil)
+	if err != nil {
+		return errInternal(err)
+	}
+
+	manifests, err := snapshot.LoadSnapshots(ctx, rep, ids)
+	if err != nil {
+		return errInternal(err)
+	}
+
+	result := listAllMyBucketsResult{Xmlns: s3Namespace, Buckets: []bucketInfo{}}
+
+	for _, m := range manifests {
+		result.Buckets = append(result.Buckets, bucketInfo{
+			Name:         string(m.ID),
+			CreationDate: m.StartTime.UTC().Format(s3TimeFormat),
+		})
+	}
+
+	sort.Slice(result.Buckets, func(i, j int) bool {
+		return result.Buckets[i].Name < result.Buckets[j].Name
+	})
+
+	writeXML(ctx, w, result)
+
+	return nil
+}
+
+type locationConstraint struct {
+	XMLName xml.Name `xml:"LocationConstraint"`
+	Xmlns   string   `xml:"xmlns,attr"`
+	Region  string   `xml:",chardata"`
+}
+
+func (g *gateway) getBucketLocation(ctx context.Context, w http.ResponseWriter, rep *repo.Repository, bucket string) *s3Error {
+	if _, err := g.bucketRoot(ctx, rep, bucket); err != nil {
+		return err
+	}
+
+	writeXML(ctx, w, locationConstraint{Xmlns: s3Namespace, Region: g.options.Region})
+
+	return nil
+}
+
+// bucketRoot returns the root entry of the snapshot corresponding to a bucket.
+func (g *gateway) bucketRoot(ctx context.Context, rep *repo.Repository, bucket string) (fs.Entry, *s3Error) {
+	man, err := snapshot.LoadSnapshot(ctx, rep, manifest.ID(bucket))
+	if err != nil {
+		return nil, errNoSuchBucket(bucket)
+	}
+
+	root, err := snapshotfs.SnapshotRoot(rep, man)
+	if err != nil {
+		return nil, errInternal(err)
+	}
+
+	return root, nil
+}
+
+// findEntry returns the entry corresponding to a given key or nil if not found.
+func findEntry(ctx context.Context, root fs.Entry, key string) (fs.Entry, error) {
+	e := root
+
+	// snapshot of a single file is exposed as an object named after the file.
+	if _, ok := root.(fs.Directory); !ok {
+		if key == root.Name() {
+			return root, nil
+		}
+
+		return nil, nil
+	}
+
+	for _, part := range strings.Split(key, keySeparator) {
+		d, ok := e.(fs.Directory)
+		if !ok || part == "" {
+			return nil, nil
+		}
+
+		c, err := d.Child(ctx, part)
+		if err == fs.ErrEntryNotFound {
+			return nil, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		e = c
+	}
+
+	return e, nil
+}
+
+func entryETag(e fs.Entry) string {
+	if h, ok := e.(object.HasObjectID); ok {
+		return `"` + h.ObjectID().String() + `"`
+	}
+
+	return `"` + strconv.FormatInt(e.ModTime().UnixNano(), 16) + `"`
+}
+
+func (g *gateway) getObject(ctx context.Context, w http.ResponseWriter, r *http.Request, rep *repo.Repository, bucket, key string) *s3Error {
+	root, serr := g.bucketRoot(ctx, rep, bucket)
+	if serr != nil {
+		return serr
+	}
+
+	e, err := findEntry(ctx, root, key)
+	if err != nil {
+		return errInternal(err)
+	}
+
+	f, ok := e.(fs.File)
+	if !ok {
+		return errNoSuchKey(key)
+	}
+
+	rd, err := f.Open(ctx)
+	if err != nil {
+		return errInternal(err)
+	}
+	defer rd.Close() //nolint:errcheck
+
+	w.Header().Set("ETag", entryETag(f))
+	w.Header().Set("Accept-Ranges", "bytes")
+
+	// S3 clients expect Last-Modified even for entries without modification time,
+	// which http.ServeContent() would omit.
+	w.Header().Set("Last-Modified", f.ModTime().UTC().Format(http.TimeFormat))
+	http.ServeContent(w, r, key, f.ModTime(), rd)
+
+	return nil
+}
+
+type objectInfo struct {
+	Key          string `xml:"Key"`
+	LastModified string `xml:"LastModified"`
+	ETag         string `xml:"ETag"`
+	Size         int64  `xml:"Size"`
+	StorageClass string `xml:"StorageClass"`
+}
+
+type commonPrefix struct {
+	Prefix string `xml:"Prefix"`
+}
+
+type listBucketResult struct {
+	XMLName        xml.Name       `xml:"ListBucketResult"`
+	Xmlns          string         `xml:"xmlns,attr"`
+	Name           string         `xml:"Name"`
+	Prefix         string         `xml:"Prefix"`
+	Delimiter      string         `xml:"Delimiter,omitempty"`
+	MaxKeys        int            `xml:"MaxKeys"`
+	IsTruncated    bool           `xml:"IsTruncated"`
+	Contents       []objectInfo   `xml:"Contents"`
+	CommonPrefixes []commonPrefix `xml:"CommonPrefixes,omitempty"`
+
+	// V1 only
+	Marker     *string `xml:"Marker,omitempty"`
+	NextMarker string  `xml:"NextMarker,omitempty"`
+
+	// V2 only
+	KeyCount              *int   `xml:"KeyCount,omitempty"`
+	ContinuationToken     string `xml:"ContinuationToken,omitempty"`
+	NextContinuationToken string `xml:"NextContinuationToken,omitempty"`
+	StartAfter            string `xml:"StartAfter,omitempty"`
+}
+
+// listItem is either an object or a common prefix in a listing.
+type listItem struct {
+	key    string
+	entry  fs.Entry
+	prefix bool
+}
+
+func (g *gateway) listObjects(ctx context.Context, w http.ResponseWriter, r *http.Request, rep *repo.Repository, bucket string) *s3Error {
+	q := r.URL.Query()
+
+	root, serr := g.bucketRoot(ctx, rep, bucket)
+	if serr != nil {
+		return serr
+	}
+
+	maxKeys := defaultMaxKeys
+
+	if v := q.Get("max-keys"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return errInvalidArgument("invalid max-keys")
+		}
+
+		if n < maxKeys {
+			maxKeys = n
+		}
+	}
+
+	prefix, delimiter := q.Get("prefix"), q.Get("delimiter")
+
+	result := listBucketResult{
+		Xmlns:     s3Namespace,
+		Name:      bucket,
+		Prefix:    prefix,
+		Delimiter: delimiter,
+		MaxKeys:   maxKeys,
+		Contents:  []objectInfo{},
+	}
+
+	var after string
+
+	if q.Get("list-type") == listTypeV2 {
+		result.ContinuationToken = q.Get("continuation-token")
+		result.StartAfter = q.Get("start-after")
+
+		after = result.StartAfter
+		if result.ContinuationToken != "" {
+			after = result.ContinuationToken
+		}
+	} else {
+		marker := q.Get("marker")
+		result.Marker = &marker
+		after = marker
+	}
+
+	items, err := listItems(ctx, root, prefix, delimiter)
+	if err != nil {
+		return errInternal(err)
+	}
+
+	var last string
+
+	for _, it := range items {
+		if it.key <= after {
+			continue
+		}
+
+		if len(result.Contents)+len(result.CommonPrefixes) >= maxKeys {
+			result.IsTruncated = true
+			break
+		}
+
+		if it.prefix {
+			result.CommonPrefixes = append(result.CommonPrefixes, commonPrefix{it.key})
+		} else {
+			result.Contents = append(result.Contents, objectInfo{
+				Key:          it.key,
+				LastModified: it.entry.ModTime().UTC().Format(s3TimeFormat),
+				ETag:         entryETag(it.entry),
+				Size:         it.entry.Size(),
+				StorageClass: storageClassName,
+			})
+		}
+
+		last = it.key
+	}
+
+	if result.IsTruncated {
+		if result.Marker != nil {
+			result.NextMarker = last
+		} else {
+			result.NextContinuationToken = last
+		}
+	}
+
+	if result.Marker == nil {
+		n := len(result.Contents) + len(result.CommonPrefixes)
+		result.KeyCount = &n
+	}
+
+	writeXML(ctx, w, result)
+
+	return nil
+}
+
+// listItems returns all objects and common prefixes matching the provided prefix and delimiter sorted by key.
+func listItems(ctx context.Context, root fs.Entry, prefix, delimiter string) ([]listItem, error) {
+	var items []listItem
+
+	d, ok := root.(fs.Directory)
+	if !ok {
+		if strings.HasPrefix(root.Name(), prefix) {
+			items = append(items, listItem{key: root.Name(), entry: root})
+		}
+
+		return items, nil
+	}
+
+	// start at the deepest directory fully covered by the prefix.
+	dirPrefix := ""
+	if i := strings.LastIndex(prefix, keySeparator); i >= 0 {
+		dirPrefix = prefix[0 : i+1]
+
+		e, err := findEntry(ctx, root, strings.TrimSuffix(dirPrefix, keySeparator))
+		if err != nil {
+			return nil, err
+		}
+
+		if d, ok = e.(fs.Directory); !ok {
+			return nil, nil
+		}
+	}
+
+	if err := collectItems(ctx, d, dirPrefix, prefix, delimiter, &items); err != nil {
+		return nil, err
+	}
+
+	// group remaining keys by delimiter other than the separator.
+	if delimiter != "" && delimiter != keySeparator {
+		items = groupByDelimiter(items, prefix, delimiter)
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].key < items[j].key
+	})
+
+	return items, nil
+}
+
+func collectItems(ctx context.Context, d fs.Directory, dirPrefix, prefix, delimiter string, items *[]listItem) error {
+	entries, err := d.Readdir(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		key := dirPrefix + e.Name()
+
+		switch e := e.(type) {
+		case fs.Directory:
+			dirKey := key + keySeparator
+
+			if !strings.HasPrefix(dirKey, prefix) && !strings.HasPrefix(prefix, dirKey) {
+				continue
+			}
+
+			// with the default delimiter, directories below the prefix are returned as common prefixes
+			// without descending into them.
+			if delimiter == keySeparator && strings.HasPrefix(dirKey, prefix) {
+				*items = append(*items, listItem{key: dirKey, prefix: true})
+				continue
+			}
+
+			if err := collectItems(ctx, e, dirKey, prefix, delimiter, items); err != nil {
+				return err
+			}
+
+		case fs.File:
+			if strings.HasPrefix(key, prefix) {
+				*items = append(*items, listItem{key: key, entry: e})
+			}
+		}
+	}
+
+	return nil
+}
+
+func groupByDelimiter(items []listItem, prefix, delimiter string) []listItem {
+	var result []listItem
+
+	seen := map[string]bool{}
+
+	for _, it := range items {
+		i := strings.Index(it.key[len(prefix):], delimiter)
+		if i < 0 {
+			result = append(result, it)
+			continue
+		}
+
+		p := it.key[0 : len(prefix)+i+len(delimiter)]
+		if !seen[p] {
+			seen[p] = true
+
+			result = append(result, listItem{key: p, prefix: true})
+		}
+	}
+
+	return result
+}
+
+// s3Error represents an error returned to S3 clients.
+type s3Error struct {
+	XMLName  xml.Name `xml:"Error"`
+	Code     string   `xml:"Code"`
+	Message  string   `xml:"Message"`
+	Resource string   `xml:"Resource"`
+
+	httpStatus int
+}
+
+func writeError(ctx context.Context, w http.ResponseWriter, r *http.Request, err *s3Error) {
+	log(ctx).Debugf("S3 error %v: %v", err.Code, err.Message)
+
+	err.Resource = r.URL.Path
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(err.httpStatus)
+
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	if _, werr := w.Write([]byte(xml.Header)); werr != nil {
+		return
+	}
+
+	xml.NewEncoder(w).Encode(err) //nolint:errcheck
+}
+
+func errAccessDenied(msg string) *s3Error {
+	return &s3Error{Code: "AccessDenied", Message: msg, httpStatus: http.StatusForbidden}
+}
+
+func errNoSuchBucket(bucket string) *s3Error {
+	return &s3Error{Code: "NoSuchBucket", Message: "The specified bucket does not exist: " + bucket, httpStatus: http.StatusNotFound}
+}
+
+func errNoSuchKey(key string) *s3Error {
+	return &s3Error{Code: "NoSuchKey", Message: "The specified key does not exist: " + key, httpStatus: http.StatusNotFound}
+}
+
+func errInvalidArgument(msg string) *s3Error {
+	return &s3Error{Code: "InvalidArgument", Message: msg, httpStatus: http.StatusBadRequest}
+}
+
+func errServiceUnavailable(msg string) *s3Error {
+	return &s3Error{Code: "ServiceUnavailable", Message: msg, httpStatus: http.StatusServiceUnavailable}
+}
+
+func errInternal(err error) *s3Error {
+	return &s3Error{Code: "InternalError", Message: err.Error(), httpStatus: http.StatusInternalServerError}
+}
+
+func errSignatureDoesNotMatch() *s3Error {
+	return &s3Error{
+		Code:       "SignatureDoesNotMatch",
+		Message:    "The request signature we calculated does not match the signature you provided.",
+		httpStatus: http.StatusForbidden,
+	}
+}
@@ -0,0 +1,245 @@
+package s3gateway
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	minio "github.com/minio/minio-go/v6"
+
+	"github.com/kopia/kopia/internal/mockfs"
+	"github.com/kopia/kopia/internal/repotesting"
+	"github.com/kopia/kopia/internal/testlogging"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/snapshot"
+	"github.com/kopia/kopia/snapshot/snapshotfs"
+)
+
+const (
+	testAccessKey = "test-access-key"
+	testSecretKey = "test-secret-key"
+)
+
+func TestGateway(t *testing.T) {
+	var env repotesting.Environment
+
+	ctx := testlogging.Context(t)
+	defer env.Setup(t).Close(ctx, t)
+
+	dir := mockfs.NewDirectory()
+	dir.AddFile("a.txt", []byte("contents of a"), 0o644)
+	dir.AddFile("a-b.txt", []byte("contents of a-b"), 0o644)
+	dir.AddDir("sub", 0o755)
+	dir.AddFile("sub/b.txt", []byte("contents of b"), 0o644)
+	dir.AddDir("sub/deep", 0o755)
+	dir.AddFile("sub/deep/c.txt", []byte("contents of c"), 0o644)
+
+	man, err := snapshotfs.NewUploader(env.Repository).Upload(ctx, dir, nil, snapshot.SourceInfo{Host: "h", UserName: "u", Path: "/p"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	snapID, err := snapshot.SaveSnapshot(ctx, env.Repository, man)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bucket := string(snapID)
+
+	repos := &testRepositoryProvider{rep: env.Repository}
+
+	srv := httptest.NewServer(New(repos, Options{AccessKeyID: testAccessKey, SecretAccessKey: testSecretKey}))
+	defer srv.Close()
+
+	endpoint := strings.TrimPrefix(srv.URL, "http://")
+
+	cli, err := minio.New(endpoint, testAccessKey, testSecretKey, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buckets, err := cli.ListBuckets()
+	if err != nil {
+		t.Fatalf("unable to list buckets: %v", err)
+	}
+
+	if len(buckets) != 1 || buckets[0].Name != bucket {
+		t.Fatalf("unexpected buckets: %v", buckets)
+	}
+
+	verifyList(t, cli, bucket, "", true, "a-b.txt", "a.txt", "sub/b.txt", "sub/deep/c.txt")
+	verifyList(t, cli, bucket, "", false, "a-b.txt", "a.txt", "sub/")
+	verifyList(t, cli, bucket, "sub/", false, "sub/b.txt", "sub/deep/")
+	verifyList(t, cli, bucket, "sub/d", true, "sub/deep/c.txt")
+	verifyList(t, cli, bucket, "nonexistent/", true)
+
+	obj, err := cli.GetObject(bucket, "sub/deep/c.txt", minio.GetObjectOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if b, err := ioutil.ReadAll(obj); err != nil || string(b) != "contents of c" {
+		t.Errorf("unexpected object contents: %q %v", b, err)
+	}
+
+	opt := minio.GetObjectOptions{}
+	if err := opt.SetRange(9, 12); err != nil {
+		t.Fatal(err)
+	}
+
+	obj, err = cli.GetObject(bucket, "a.txt", opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if b, err := ioutil.ReadAll(obj); err != nil || string(b) != "of a" {
+		t.Errorf("unexpected range contents: %q %v", b, err)
+	}
+
+	if _, err := cli.StatObject(bucket, "no-such-file", minio.StatObjectOptions{}); err == nil {
+		t.Errorf("expected error when getting non-existent object")
+	}
+
+	if err := cli.RemoveObject(bucket, "a.txt"); minio.ToErrorResponse(err).Code != "AccessDenied" {
+		t.Errorf("unexpected error when removing object: %v", err)
+	}
+
+	u, err := cli.PresignedGetObject(bucket, "sub/b.txt", time.Hour, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	verifyHTTPGet(t, u.String(), http.StatusOK, "contents of b")
+	verifyHTTPGet(t, srv.URL+"/"+bucket+"/sub/b.txt", http.StatusForbidden, "")
+
+	badCli, err := minio.New(endpoint, testAccessKey, "wrong-secret", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := badCli.ListBuckets(); minio.ToErrorResponse(err).Code != "SignatureDoesNotMatch" {
+		t.Errorf("unexpected error with invalid credentials: %v", err)
+	}
+
+	// the repository is obtained for each request.
+	repos.rep = nil
+
+	verifyHTTPGet(t, u.String(), http.StatusServiceUnavailable, "")
+}
+
+type testRepositoryProvider struct {
+	rep *repo.Repository
+}
+
+func (p *testRepositoryProvider) UseRepository(ctx context.Context, cb func(rep *repo.Repository)) {
+	cb(p.rep)
+}
+
+func TestAuthenticateCredentialScope(t *testing.T) {
+	g := &gateway{options: Options{AccessKeyID: testAccessKey, SecretAccessKey: testSecretKey, Region: defaultRegion}}
+	now := time.Now().UTC()
+
+	cases := []struct {
+		desc          string
+		scopeDate     string
+		signedHeaders []string
+		wantErr       bool
+	}{
+		{"valid", now.Format(scopeDateFormat), []string{"host", "x-amz-date"}, false},
+		{"scope date differs from X-Amz-Date", now.Add(-48 * time.Hour).Format(scopeDateFormat), []string{"host", "x-amz-date"}, true},
+		{"host not signed", now.Format(scopeDateFormat), []string{"x-amz-date"}, true},
+	}
+
+	for _, tc := range cases {
+		r := httptest.NewRequest(http.MethodGet, "http://gateway/", nil)
+		r.Header.Set("X-Amz-Date", now.Format(amzDateFormat))
+
+		sr := &signedRequest{
+			accessKeyID:   testAccessKey,
+			date:          tc.scopeDate,
+			region:        defaultRegion,
+			service:       "s3",
+			amzDate:       now,
+			signedHeaders: tc.signedHeaders,
+			payloadHash:   emptyPayloadHash,
+			query:         r.URL.Query(),
+		}
+
+		r.Header.Set("Authorization", fmt.Sprintf("%v Credential=%v/%v/%v/s3/aws4_request, SignedHeaders=%v, Signature=%v",
+			signatureAlgorithm, testAccessKey, tc.scopeDate, defaultRegion, strings.Join(tc.signedHeaders, ";"), computeSignature(testSecretKey, r, sr)))
+
+		if err := g.authenticate(r); (err != nil) != tc.wantErr {
+			t.Errorf("%v: unexpected error: %v", tc.desc, err)
+		}
+	}
+}
+
+func verifyList(t *testing.T, cli *minio.Client, bucket, prefix string, recursive bool, want ...string) {
+	t.Helper()
+
+	var got []string
+
+	for oi := range cli.ListObjectsV2(bucket, prefix, recursive, nil) {
+		if oi.Err != nil {
+			t.Fatalf("list error: %v", oi.Err)
+		}
+
+		got = append(got, oi.Key)
+	}
+
+	sort.Strings(got)
+
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("invalid list result for %q (recursive=%v): %v, want %v", prefix, recursive, got, want)
+	}
+}
+
+func verifyHTTPGet(t *testing.T, u string, wantStatus int, wantBody string) {
+	t.Helper()
+
+	resp, err := http.Get(u) //nolint:gosec
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer resp.Body.Close()
+
+	b, _ := ioutil.ReadAll(resp.Body)
+
+	if resp.StatusCode != wantStatus {
+		t.Fatalf("unexpected status %v: %s", resp.StatusCode, b)
+	}
+
+	if wantBody != "" && string(b) != wantBody {
+		t.Errorf("unexpected body %q, want %q", b, wantBody)
+	}
+}
+
+func TestListItemsPagination(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	dir := mockfs.NewDirectory()
+	dir.AddFile("x-1", []byte("1"), 0o644)
+	dir.AddFile("x-2", []byte("2"), 0o644)
+	dir.AddFile("y", []byte("3"), 0o644)
+
+	items, err := listItems(ctx, dir, "", "-")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var keys []string
+	for _, it := range items {
+		keys = append(keys, it.key)
+	}
+
+	if got, want := strings.Join(keys, ","), "x-,y"; got != want {
+		t.Errorf("invalid grouping: %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,296 @@
+package s3gateway
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	signatureAlgorithm = "AWS4-HMAC-SHA256"
+	amzDateFormat      = "20060102T150405Z"
+	scopeDateFormat    = "20060102"
+	unsignedPayload    = "UNSIGNED-PAYLOAD"
+	maxClockSkew       = 15 * time.Minute
+	maxPresignExpiry   = 7 * 24 * time.Hour
+)
+
+// emptyPayloadHash is SHA256 of an empty string.
+var emptyPayloadHash = hex.EncodeToString(sha256.New().Sum(nil))
+
+// signedRequest contains the elements of AWS Signature Version 4 extracted from a request.
+type signedRequest struct {
+	accessKeyID   string
+	date          string // YYYYMMDD
+	region        string
+	service       string
+	amzDate       time.Time
+	signedHeaders []string
+	signature     string
+	payloadHash   string
+	query         url.Values // query parameters included in the signature
+}
+
+// authenticate verifies AWS Signature Version 4 of the request provided either in the
+// Authorization header or as presigned URL query parameters.
+func (g *gateway) authenticate(r *http.Request) *s3Error {
+	if g.options.AccessKeyID == "" && g.options.SecretAccessKey == "" {
+		return nil
+	}
+
+	var (
+		sr  *signedRequest
+		err *s3Error
+	)
+
+	if r.URL.Query().Get("X-Amz-Algorithm") != "" {
+		sr, err = parsePresignedRequest(r)
+	} else {
+		sr, err = parseAuthorizationHeader(r)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if sr.accessKeyID != g.options.AccessKeyID {
+		return &s3Error{Code: "InvalidAccessKeyId", Message: "The access key ID you provided does not exist.", httpStatus: http.StatusForbidden}
+	}
+
+	if sr.region != g.options.Region || sr.service != "s3" {
+		return errAccessDenied("invalid credential scope")
+	}
+
+	if sr.date != sr.amzDate.UTC().Format(scopeDateFormat) {
+		return errAccessDenied("credential scope date does not match X-Amz-Date")
+	}
+
+	if !isSignedHeader(sr, "host") {
+		return errAccessDenied("host header must be signed")
+	}
+
+	expected := computeSignature(g.options.SecretAccessKey, r, sr)
+	if subtle.ConstantTimeCompare([]byte(expected), []byte(sr.signature)) != 1 {
+		return errSignatureDoesNotMatch()
+	}
+
+	return nil
+}
+
+func isSignedHeader(sr *signedRequest, name string) bool {
+	for _, h := range sr.signedHeaders {
+		if h == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseCredential parses credential in the form of AKID/YYYYMMDD/region/service/aws4_request.
+func parseCredential(sr *signedRequest, cred string) *s3Error {
+	parts := strings.Split(cred, "/")
+	if len(parts) != 5 || parts[4] != "aws4_request" { //nolint:gomnd
+		return errAccessDenied("invalid credential")
+	}
+
+	sr.accessKeyID, sr.date, sr.region, sr.service = parts[0], parts[1], parts[2], parts[3]
+
+	return nil
+}
+
+func parseAuthorizationHeader(r *http.Request) (*signedRequest, *s3Error) {
+	auth := r.Header.Get("Authorization")
+	if auth == "" {
+		return nil, errAccessDenied("anonymous access is not allowed")
+	}
+
+	if !strings.HasPrefix(auth, signatureAlgorithm+" ") {
+		return nil, errAccessDenied("unsupported signature algorithm, only AWS Signature Version 4 is supported")
+	}
+
+	sr := &signedRequest{query: r.URL.Query()}
+
+	for _, kv := range strings.Split(strings.TrimPrefix(auth, signatureAlgorithm+" "), ",") {
+		kv = strings.TrimSpace(kv)
+
+		switch {
+		case strings.HasPrefix(kv, "Credential="):
+			if err := parseCredential(sr, strings.TrimPrefix(kv, "Credential=")); err != nil {
+				return nil, err
+			}
+		case strings.HasPrefix(kv, "SignedHeaders="):
+			sr.signedHeaders = strings.Split(strings.TrimPrefix(kv, "SignedHeaders="), ";")
+		case strings.HasPrefix(kv, "Signature="):
+			sr.signature = strings.TrimPrefix(kv, "Signature=")
+		}
+	}
+
+	amzDate := r.Header.Get("X-Amz-Date")
+	if amzDate == "" {
+		return nil, errAccessDenied("missing X-Amz-Date")
+	}
+
+	t, err := time.Parse(amzDateFormat, amzDate)
+	if err != nil {
+		return nil, errAccessDenied("invalid X-Amz-Date")
+	}
+
+	if d := time.Now().Sub(t); d > maxClockSkew || d < -maxClockSkew {
+		return nil, &s3Error{Code: "RequestTimeTooSkewed", Message: "The difference between the request time and the server's time is too large.", httpStatus: http.StatusForbidden}
+	}
+
+	sr.amzDate = t
+
+	sr.payloadHash = r.Header.Get("X-Amz-Content-Sha256")
+	if sr.payloadHash == "" {
+		sr.payloadHash = emptyPayloadHash
+	}
+
+	return sr, nil
+}
+
+func parsePresignedRequest(r *http.Request) (*signedRequest, *s3Error) {
+	q := r.URL.Query()
+
+	if q.Get("X-Amz-Algorithm") != signatureAlgorithm {
+		return nil, errAccessDenied("unsupported signature algorithm, only AWS Signature Version 4 is supported")
+	}
+
+	sr := &signedRequest{
+		signedHeaders: strings.Split(q.Get("X-Amz-SignedHeaders"), ";"),
+		signature:     q.Get("X-Amz-Signature"),
+		payloadHash:   unsignedPayload,
+		query:         url.Values{},
+	}
+
+	if err := parseCredential(sr, q.Get("X-Amz-Credential")); err != nil {
+		return nil, err
+	}
+
+	t, err := time.Parse(amzDateFormat, q.Get("X-Amz-Date"))
+	if err != nil {
+		return nil, errAccessDenied("invalid X-Amz-Date")
+	}
+
+	expires, err := strconv.Atoi(q.Get("X-Amz-Expires"))
+	if err != nil || expires < 0 || time.Duration(expires)*time.Second > maxPresignExpiry {
+		return nil, errAccessDenied("invalid X-Amz-Expires")
+	}
+
+	if time.Now().After(t.Add(time.Duration(expires) * time.Second)) {
+		return nil, errAccessDenied("request has expired")
+	}
+
+	sr.amzDate = t
+
+	for k, v := range q {
+		if k != "X-Amz-Signature" {
+			sr.query[k] = v
+		}
+	}
+
+	return sr, nil
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data)) //nolint:errcheck
+
+	return h.Sum(nil)
+}
+
+func computeSignature(secretAccessKey string, r *http.Request, sr *signedRequest) string {
+	canonicalRequest := strings.Join([]string{
+		r.Method,
+		uriEncode(r.URL.Path, false),
+		canonicalQueryString(sr.query),
+		canonicalHeaders(r, sr.signedHeaders),
+		strings.Join(sr.signedHeaders, ";"),
+		sr.payloadHash,
+	}, "\n")
+
+	crHash := sha256.Sum256([]byte(canonicalRequest))
+	scope := strings.Join([]string{sr.date, sr.region, sr.service, "aws4_request"}, "/")
+
+	stringToSign := strings.Join([]string{
+		signatureAlgorithm,
+		sr.amzDate.Format(amzDateFormat),
+		scope,
+		hex.EncodeToString(crHash[:]),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+secretAccessKey), sr.date)
+	key = hmacSHA256(key, sr.region)
+	key = hmacSHA256(key, sr.service)
+	key = hmacSHA256(key, "aws4_request")
+
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func canonicalQueryString(q url.Values) string {
+	var parts []string
+
+	for k, values := range q {
+		for _, v := range values {
+			parts = append(parts, uriEncode(k, true)+"="+uriEncode(v, true))
+		}
+	}
+
+	sort.Strings(parts)
+
+	return strings.Join(parts, "&")
+}
+
+func canonicalHeaders(r *http.Request, signedHeaders []string) string {
+	var sb strings.Builder
+
+	for _, h := range signedHeaders {
+		var v string
+
+		if h == "host" {
+			v = r.Host
+		} else {
+			v = strings.Join(r.Header[http.CanonicalHeaderKey(h)], ",")
+		}
+
+		sb.WriteString(h)
+		sb.WriteString(":")
+		sb.WriteString(strings.Join(strings.Fields(v), " "))
+		sb.WriteString("\n")
+	}
+
+	return sb.String()
+}
+
+// uriEncode encodes the string as specified by AWS Signature Version 4, which
+// leaves only unreserved characters unescaped.
+func uriEncode(s string, encodeSlash bool) string {
+	const hexDigits = "0123456789ABCDEF"
+
+	var sb strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '_', c == '.', c == '~':
+			sb.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			sb.WriteByte(c)
+		default:
+			sb.WriteByte('%')
+			sb.WriteByte(hexDigits[c>>4])
+			sb.WriteByte(hexDigits[c&15]) //nolint:gomnd
+		}
+	}
+
+	return sb.String()
+}
@@ -8,6 +8,7 @@ import (
 
 // ScrubSensitiveData returns a copy of a given value with sensitive fields scrubbed.
 // Fields are marked as sensitive with truct field tag `kopia:"sensitive"`
+// Nested structs, including ones referenced through pointers and interfaces, are scrubbed as well.
 func ScrubSensitiveData(v reflect.Value) reflect.Value {
 	switch v.Kind() {
 	case reflect.Ptr:
@@ -15,24 +16,50 @@ func ScrubSensitiveData(v reflect.Value) reflect.Value {
 
 	case reflect.Struct:
 		res := reflect.New(v.Type()).Elem()
+		res.Set(v)
 
 		for i := 0; i < v.NumField(); i++ {
 			fv := v.Field(i)
 
 			sf := v.Type().Field(i)
+			if sf.PkgPath != "" {
+				// unexported field
+				continue
+			}
 
-			if sf.Tag.Get("kopia") == "sensitive" {
+			switch {
+			case sf.Tag.Get("kopia") == "sensitive":
 				if sf.Type.Kind() == reflect.String {
 					res.Field(i).SetString(strings.Repeat("*", fv.Len()))
+				} else {
+					res.Field(i).Set(reflect.Zero(sf.Type))
 				}
-			} else {
-				res.Field(i).Set(fv)
+
+			case hasNestedStruct(fv):
+				res.Field(i).Set(ScrubSensitiveData(fv))
 			}
 		}
 
 		return res
 
+	case reflect.Interface:
+		return ScrubSensitiveData(v.Elem())
+
 	default:
 		panic("Unsupported type: " + v.String())
 	}
 }
+
+// hasNestedStruct returns true if the value is a struct or a non-nil pointer or interface referencing one.
+func hasNestedStruct(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Struct:
+		return true
+
+	case reflect.Ptr, reflect.Interface:
+		return !v.IsNil() && hasNestedStruct(v.Elem())
+
+	default:
+		return false
+	}
+}
@@ -0,0 +1,164 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/serverapi"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/manifest"
+	"github.com/kopia/kopia/snapshot"
+	"github.com/kopia/kopia/snapshot/policy"
+)
+
+// agentManifestType is the type of manifests storing agent registrations.
+const agentManifestType = "agent"
+
+func agentLabels(hostname, username string) map[string]string {
+	return map[string]string{
+		manifest.TypeLabelKey: agentManifestType,
+		"hostname":            hostname,
+		"username":            username,
+	}
+}
+
+func (s *Server) handleAgentRegister(ctx context.Context, r *http.Request) (interface{}, *apiError) {
+	var info serverapi.AgentInfo
+
+	if err := json.NewDecoder(r.Body).Decode(&info); err != nil {
+		return nil, requestError(serverapi.ErrorMalformedRequest, "malformed request body")
+	}
+
+	if info.Hostname == "" || info.Username == "" {
+		return nil, requestError(serverapi.ErrorMalformedRequest, "missing hostname or username")
+	}
+
+	info.LastSeen = time.Now()
+
+	if err := registerAgent(ctx, s.rep, &info); err != nil {
+		return nil, internalServerError(err)
+	}
+
+	log(ctx).Debugf("registered agent %v@%v", info.Username, info.Hostname)
+
+	return &serverapi.Empty{}, nil
+}
+
+// registerAgent stores the agent information in the repository, replacing its previous registration.
+func registerAgent(ctx context.Context, rep *repo.Repository, info *serverapi.AgentInfo) error {
+	labels := agentLabels(info.Hostname, info.Username)
+
+	previous, err := rep.Manifests.Find(ctx, labels)
+	if err != nil {
+		return errors.Wrap(err, "unable to find agent registrations")
+	}
+
+	if _, err := rep.Manifests.Put(ctx, labels, info); err != nil {
+		return errors.Wrap(err, "unable to register agent")
+	}
+
+	for _, p := range previous {
+		if err := rep.Manifests.Delete(ctx, p.ID); err != nil {
+			return errors.Wrap(err, "unable to remove previous agent registration")
+		}
+	}
+
+	return errors.Wrap(rep.Flush(ctx), "unable to flush agent registration")
+}
+
+func (s *Server) handleAgentList(ctx context.Context, r *http.Request) (interface{}, *apiError) {
+	entries, err := s.rep.Manifests.Find(ctx, map[string]string{
+		manifest.TypeLabelKey: agentManifestType,
+	})
+	if err != nil {
+		return nil, internalServerError(err)
+	}
+
+	policies, err := policy.ListPolicies(ctx, s.rep)
+	if err != nil {
+		return nil, internalServerError(err)
+	}
+
+	resp := &serverapi.AgentsResponse{
+		Agents: []*serverapi.AgentStatus{},
+	}
+
+	for _, e := range entries {
+		st := &serverapi.AgentStatus{
+			Sources: []snapshot.SourceInfo{},
+		}
+
+		if err := s.rep.Manifests.Get(ctx, e.ID, &st.AgentInfo); err != nil {
+			return nil, internalServerError(err)
+		}
+
+		for _, pol := range policies {
+			t := pol.Target()
+			if t.Path != "" && t.Host == st.Hostname && t.UserName == st.Username {
+				st.Sources = append(st.Sources, t)
+			}
+		}
+
+		sort.Slice(st.Sources, func(i, j int) bool {
+			return st.Sources[i].Path < st.Sources[j].Path
+		})
+
+		resp.Agents = append(resp.Agents, st)
+	}
+
+	sort.Slice(resp.Agents, func(i, j int) bool {
+		if l, r := resp.Agents[i].Hostname, resp.Agents[j].Hostname; l != r {
+			return l < r
+		}
+
+		return resp.Agents[i].Username < resp.Agents[j].Username
+	})
+
+	return resp, nil
+}
+
+func (s *Server) handleAgentSourceEnable(ctx context.Context, r *http.Request) (interface{}, *apiError) {
+	var req serverapi.EnableAgentSourceRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, requestError(serverapi.ErrorMalformedRequest, "malformed request body")
+	}
+
+	src := req.Source
+	if src.Host == "" || src.UserName == "" || src.Path == "" {
+		return nil, requestError(serverapi.ErrorMalformedRequest, "source must include user, host and path")
+	}
+
+	resp := &serverapi.CreateSnapshotSourceResponse{}
+
+	// the path is on the agent machine, so unlike with local sources its existence can't be verified here;
+	// defining the policy is sufficient for the agent and the server to pick up the source.
+	_, err := policy.GetDefinedPolicy(ctx, s.rep, src)
+	switch err {
+	case nil:
+		log(ctx).Debugf("policy for %v already exists", src)
+
+	case policy.ErrPolicyNotFound:
+		resp.Created = true
+
+		log(ctx).Debugf("policy for %v not found, creating initial one", src)
+
+		if err = policy.SetPolicy(ctx, s.rep, src, &req.InitialPolicy); err != nil {
+			return nil, internalServerError(errors.Wrap(err, "unable to set initial policy"))
+		}
+
+		if err = s.rep.Flush(ctx); err != nil {
+			return nil, internalServerError(errors.Wrap(err, "unable to flush"))
+		}
+
+	default:
+		return nil, internalServerError(err)
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,76 @@
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/kopia/kopia/repo/content"
+)
+
+// contentCacheControl allows caching of content blocks indefinitely, since their IDs are derived from the contents.
+const contentCacheControl = "public, max-age=31536000, immutable"
+
+func isValidContentID(cid string) bool {
+	if cid == "" {
+		return false
+	}
+
+	for _, ch := range cid {
+		if !('0' <= ch && ch <= '9') && !('a' <= ch && ch <= 'z') {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ContentHandler returns a handler serving content blocks, which can be mounted without authentication.
+func (s *Server) ContentHandler() http.Handler {
+	return http.HandlerFunc(s.handleContentGet)
+}
+
+// handleContentGet serves raw payload of a single content block identified by its ID.
+// The payload is returned as stored in the repository (after decryption), so contents written
+// with compression enabled are returned compressed.
+func (s *Server) handleContentGet(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		http.Error(w, "incompatible HTTP method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.rep == nil {
+		http.Error(w, "not connected", http.StatusServiceUnavailable)
+		return
+	}
+
+	cid := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+	if !isValidContentID(cid) {
+		http.Error(w, "invalid content id", http.StatusBadRequest)
+		return
+	}
+
+	data, err := s.rep.Content.GetContent(r.Context(), content.ID(cid))
+	if err == content.ErrContentNotFound {
+		http.Error(w, "content not found", http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		log(r.Context()).Warningf("unable to get content %v: %v", cid, err)
+		http.Error(w, "unable to get content", http.StatusInternalServerError)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("ETag", `"`+cid+`"`)
+	w.Header().Set("Cache-Control", contentCacheControl)
+
+	// modification time is not meaningful for immutable contents, caching relies on ETag instead.
+	http.ServeContent(w, r, cid, time.Time{}, bytes.NewReader(data))
+}
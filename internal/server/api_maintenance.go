@@ -0,0 +1,55 @@
+package server
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/serverapi"
+	"github.com/kopia/kopia/snapshot/restoretest"
+)
+
+// maxUncompactedIndexBlobs is the number of index blobs smaller than maximum pack size
+// above which 'kopia index optimize' is suggested.
+const maxUncompactedIndexBlobs = 20
+
+func (s *Server) handleMaintenanceInfo(ctx context.Context, r *http.Request) (interface{}, *apiError) {
+	blobs, err := s.rep.Content.IndexBlobs(ctx)
+	if err != nil {
+		return nil, internalServerError(errors.Wrap(err, "unable to list index blobs"))
+	}
+
+	resp := &serverapi.MaintenanceInfoResponse{
+		IndexBlobCount: len(blobs),
+	}
+
+	for _, b := range blobs {
+		resp.IndexBlobsTotalSize += b.Length
+
+		if b.Length <= int64(s.rep.Content.Format.MaxPackSize) {
+			resp.UncompactedIndexBlobs++
+		}
+
+		if resp.OldestIndexBlobTime.IsZero() || b.Timestamp.Before(resp.OldestIndexBlobTime) {
+			resp.OldestIndexBlobTime = b.Timestamp
+		}
+
+		if b.Timestamp.After(resp.NewestIndexBlobTime) {
+			resp.NewestIndexBlobTime = b.Timestamp
+		}
+	}
+
+	resp.IndexOptimizeSuggested = resp.UncompactedIndexBlobs > maxUncompactedIndexBlobs
+
+	results, err := restoretest.List(ctx, s.rep)
+	if err != nil {
+		return nil, internalServerError(err)
+	}
+
+	if len(results) > 0 {
+		resp.LastRestoreTest = results[len(results)-1]
+	}
+
+	return resp, nil
+}
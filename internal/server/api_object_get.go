@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/kopia/kopia/repo/object"
+	"github.com/kopia/kopia/snapshot/snapshotfs"
 )
 
 func (s *Server) handleObjectGet(w http.ResponseWriter, r *http.Request) {
@@ -22,6 +23,11 @@ func (s *Server) handleObjectGet(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if r.URL.Query().Get("format") == "zip" {
+		s.handleObjectGetZip(w, r, oid)
+		return
+	}
+
 	obj, err := s.rep.Objects.Open(r.Context(), oid)
 	if err == object.ErrObjectNotFound {
 		http.Error(w, "object not found", http.StatusNotFound)
@@ -48,3 +54,24 @@ func (s *Server) handleObjectGet(w http.ResponseWriter, r *http.Request) {
 
 	http.ServeContent(w, r, fname, mtime, obj)
 }
+
+// handleObjectGetZip streams the contents of a directory object as a ZIP archive.
+func (s *Server) handleObjectGetZip(w http.ResponseWriter, r *http.Request, oid object.ID) {
+	if cid, _, ok := oid.ContentID(); !ok || cid.Prefix() != "k" {
+		http.Error(w, "only directories can be downloaded as ZIP", http.StatusBadRequest)
+		return
+	}
+
+	fname := oid.String() + ".zip"
+	if p := r.URL.Query().Get("fname"); p != "" {
+		fname = p
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", "attachment; filename=\""+fname+"\"")
+
+	// headers have already been sent when the error occurs, the client will see a truncated archive.
+	if err := snapshotfs.RestoreZip(r.Context(), w, snapshotfs.DirectoryEntry(s.rep, oid, nil)); err != nil {
+		log(r.Context()).Warningf("error writing ZIP archive of %v: %v", oid, err)
+	}
+}
@@ -6,7 +6,10 @@ import (
 	"net/http"
 	"net/url"
 
+	"github.com/pkg/errors"
+
 	"github.com/kopia/kopia/internal/serverapi"
+	"github.com/kopia/kopia/repo"
 	"github.com/kopia/kopia/snapshot"
 	"github.com/kopia/kopia/snapshot/policy"
 )
@@ -37,6 +40,49 @@ func (s *Server) handlePolicyList(ctx context.Context, r *http.Request) (interfa
 	return resp, nil
 }
 
+func (s *Server) handleAuthoritativePolicies(ctx context.Context, r *http.Request) (interface{}, *apiError) {
+	if s.options.LoadAuthoritativePolicies == nil {
+		return nil, requestError(serverapi.ErrorNotFound, "authoritative policies not configured")
+	}
+
+	b, err := s.options.LoadAuthoritativePolicies()
+	if err != nil {
+		return nil, internalServerError(err)
+	}
+
+	return b, nil
+}
+
+// enforceAuthoritativePolicies applies the authoritative policies to the repository, so that clients
+// snapshotting to the repository use them even if they modified them locally.
+func (s *Server) enforceAuthoritativePolicies(ctx context.Context, rep *repo.Repository) error {
+	if s.options.LoadAuthoritativePolicies == nil {
+		return nil
+	}
+
+	b, err := s.options.LoadAuthoritativePolicies()
+	if err != nil {
+		return errors.Wrap(err, "unable to load authoritative policies")
+	}
+
+	res, err := policy.ImportPolicies(ctx, rep, b, policy.ImportOptions{
+		Variables: policy.LocalTargetVariables(rep),
+	})
+	if err != nil {
+		return errors.Wrap(err, "unable to apply authoritative policies")
+	}
+
+	if len(res.Set) == 0 {
+		return nil
+	}
+
+	for _, si := range res.Set {
+		log(ctx).Infof("applied authoritative policy for %v", si)
+	}
+
+	return errors.Wrap(rep.Flush(ctx), "unable to flush authoritative policies")
+}
+
 func getPolicyTargetFromURL(u *url.URL) snapshot.SourceInfo {
 	host := u.Query().Get("host")
 	path := u.Query().Get("path")
@@ -34,7 +34,7 @@ func (s *Server) handleSnapshotList(ctx context.Context, r *http.Request) (inter
 
 		pol, _, err := policy.GetEffectivePolicy(ctx, s.rep, first.Source)
 		if err == nil {
-			pol.RetentionPolicy.ComputeRetentionReasons(grp)
+			pol.RetentionPolicy.ComputeRetentionReasons(grp, s.rep.Time())
 		}
 
 		for _, m := range grp {
@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"os"
 	"sort"
+	"strconv"
 
 	"github.com/pkg/errors"
 
@@ -37,6 +38,25 @@ func (s *Server) handleSourcesList(ctx context.Context, r *http.Request) (interf
 	return resp, nil
 }
 
+func (s *Server) handleSourceRunStatus(ctx context.Context, r *http.Request) (interface{}, *apiError) {
+	src := getPolicyTargetFromURL(r.URL)
+	if src.Host == "" || src.UserName == "" || src.Path == "" {
+		return nil, requestError(serverapi.ErrorMalformedRequest, "userName, host and path are required")
+	}
+
+	run, err := strconv.ParseInt(r.URL.Query().Get("run"), 10, 64)
+	if err != nil || run <= 0 {
+		return nil, requestError(serverapi.ErrorMalformedRequest, "invalid run")
+	}
+
+	sm := s.sourceManagers[src]
+	if sm == nil {
+		return nil, requestError(serverapi.ErrorNotFound, "source not found")
+	}
+
+	return sm.runStatus(run), nil
+}
+
 func (s *Server) handleSourcesCreate(ctx context.Context, r *http.Request) (interface{}, *apiError) {
 	var req serverapi.CreateSnapshotSourceRequest
 
@@ -0,0 +1,78 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/lock"
+)
+
+// runPeriodically invokes the provided function at the interval until the context is canceled.
+func runPeriodically(ctx context.Context, interval time.Duration, f func()) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-time.After(interval):
+			f()
+		}
+	}
+}
+
+// withExclusiveLock invokes the provided function while holding an exclusive repository lock,
+// skipping it if the lock can't be acquired.
+func withExclusiveLock(ctx context.Context, r *repo.Repository, purpose string, f func(ctx context.Context)) {
+	l, err := r.AcquireLock(ctx, lock.Exclusive, purpose)
+	if err != nil {
+		log(ctx).Warningf("unable to lock repository for %v: %v", purpose, err)
+		return
+	}
+
+	defer releaseLock(ctx, l)
+
+	lockedCtx, cancel := l.Context(ctx)
+	defer cancel()
+
+	f(lockedCtx)
+}
+
+// releaseLock releases the provided lock, errors are only logged since the lock expires on its own.
+func releaseLock(ctx context.Context, l *lock.Lock) {
+	if err := l.Err(); err != nil {
+		log(ctx).Errorf("%v aborted: %v", l.Info().Purpose, err)
+	}
+
+	if err := l.Release(ctx); err != nil {
+		log(ctx).Warningf("unable to release repository lock: %v", err)
+	}
+}
+
+// rewritePacks reclaims space of deleted contents in packs that also contain contents in use.
+func (s *Server) rewritePacks(ctx context.Context, r *repo.Repository) {
+	withExclusiveLock(ctx, r, "server pack rewrite", func(ctx context.Context) {
+		st, err := r.Content.RewriteWastefulPacks(ctx, s.options.PackRewrite)
+		if err != nil {
+			log(ctx).Warningf("unable to rewrite packs: %v", err)
+			return
+		}
+
+		log(ctx).Infof("rewrote %v contents (%v bytes) from %v packs with %v bytes of deleted contents, deleted %v packs (%v bytes)",
+			st.RewrittenCount, st.RewrittenBytes, st.PackCount, st.WasteBytes, st.BlobGC.DeletedCount, st.BlobGC.DeletedBytes)
+	})
+}
+
+// consolidatePacks merges small packs into full-size ones.
+func (s *Server) consolidatePacks(ctx context.Context, r *repo.Repository) {
+	withExclusiveLock(ctx, r, "server pack consolidation", func(ctx context.Context) {
+		st, err := r.Content.ConsolidateSmallPacks(ctx, s.options.PackConsolidation)
+		if err != nil {
+			log(ctx).Warningf("unable to consolidate packs: %v", err)
+			return
+		}
+
+		log(ctx).Infof("consolidated %v contents (%v bytes) from %v small packs, deleted %v packs (%v bytes)",
+			st.RewrittenCount, st.RewrittenBytes, st.PackCount, st.BlobGC.DeletedCount, st.BlobGC.DeletedBytes)
+	})
+}
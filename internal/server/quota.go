@@ -0,0 +1,112 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/units"
+	"github.com/kopia/kopia/snapshot"
+)
+
+const defaultQuotaPeriod = 24 * time.Hour
+
+// quotaExceededError is returned when a source or user has used up its upload quota for the current period.
+type quotaExceededError struct {
+	target string
+	quota  int64
+	period time.Duration
+}
+
+func (e *quotaExceededError) Error() string {
+	return fmt.Sprintf("upload quota of %v per %v exceeded for %v", units.BytesStringBase10(e.quota), e.period, e.target)
+}
+
+func (s *Server) quotaPeriod() time.Duration {
+	if p := s.options.QuotaPeriod; p > 0 {
+		return p
+	}
+
+	return defaultQuotaPeriod
+}
+
+// remainingUploadQuota returns the number of bytes of new contents the source can still upload
+// within the current quota period, or -1 if no quota applies.
+// When the quota is exhausted, quotaExceededError is returned.
+func (s *Server) remainingUploadQuota(ctx context.Context, src snapshot.SourceInfo) (int64, error) {
+	remaining := int64(-1)
+	since := s.rep.Time().Add(-s.quotaPeriod())
+
+	if q := s.options.QuotaPerSource; q > 0 {
+		manifests, err := snapshot.ListSnapshots(ctx, s.rep, src)
+		if err != nil {
+			return 0, errors.Wrapf(err, "unable to list snapshots of %v", src)
+		}
+
+		left := q - newBytesSince(manifests, since)
+		if left <= 0 {
+			return 0, &quotaExceededError{src.String(), q, s.quotaPeriod()}
+		}
+
+		remaining = left
+	}
+
+	if q := s.options.QuotaPerUser; q > 0 {
+		used, err := s.userNewBytesSince(ctx, src, since)
+		if err != nil {
+			return 0, err
+		}
+
+		left := q - used
+		if left <= 0 {
+			return 0, &quotaExceededError{src.UserName + "@" + src.Host, q, s.quotaPeriod()}
+		}
+
+		if remaining < 0 || left < remaining {
+			remaining = left
+		}
+	}
+
+	return remaining, nil
+}
+
+// userNewBytesSince returns the number of bytes of new contents uploaded by all sources
+// belonging to the same user@host as the provided source.
+func (s *Server) userNewBytesSince(ctx context.Context, src snapshot.SourceInfo, since time.Time) (int64, error) {
+	sources, err := snapshot.ListSources(ctx, s.rep)
+	if err != nil {
+		return 0, errors.Wrap(err, "unable to list sources")
+	}
+
+	var total int64
+
+	for _, ss := range sources {
+		if ss.UserName != src.UserName || ss.Host != src.Host {
+			continue
+		}
+
+		manifests, err := snapshot.ListSnapshots(ctx, s.rep, ss)
+		if err != nil {
+			return 0, errors.Wrapf(err, "unable to list snapshots of %v", ss)
+		}
+
+		total += newBytesSince(manifests, since)
+	}
+
+	return total, nil
+}
+
+// newBytesSince returns the total size of new contents written by snapshots started after the given time.
+func newBytesSince(manifests []*snapshot.Manifest, since time.Time) int64 {
+	var total int64
+
+	for _, m := range manifests {
+		if m.StartTime.After(since) {
+			total += m.Stats.NewContentBytes
+		}
+	}
+
+	return total
+}
@@ -0,0 +1,113 @@
+package server
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kopia/kopia/internal/faketime"
+	"github.com/kopia/kopia/internal/repotesting"
+	"github.com/kopia/kopia/internal/testlogging"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/snapshot"
+)
+
+func TestNewBytesSince(t *testing.T) {
+	t0 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	manifests := []*snapshot.Manifest{
+		{StartTime: t0.Add(-2 * time.Hour), Stats: snapshot.Stats{NewContentBytes: 100}},
+		{StartTime: t0.Add(1 * time.Hour), Stats: snapshot.Stats{NewContentBytes: 20}},
+		{StartTime: t0.Add(2 * time.Hour), Stats: snapshot.Stats{NewContentBytes: 3}},
+	}
+
+	cases := []struct {
+		since time.Time
+		want  int64
+	}{
+		{t0.Add(-3 * time.Hour), 123},
+		{t0, 23},
+		{t0.Add(90 * time.Minute), 3},
+		{t0.Add(3 * time.Hour), 0},
+	}
+
+	for _, tc := range cases {
+		if got := newBytesSince(manifests, tc.since); got != tc.want {
+			t.Errorf("unexpected new bytes since %v: %v, want %v", tc.since, got, tc.want)
+		}
+	}
+}
+
+func TestQuotaCancelsUpload(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	var env repotesting.Environment
+
+	defer env.Setup(t).Close(ctx, t)
+
+	ft := faketime.NewTimeAdvance(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	env.MustReopenWithOptions(t, &repo.Options{TimeNowFunc: ft.NowFunc()})
+
+	dir, err := ioutil.TempDir("", "kopia-quota")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	for i := 0; i < 10; i++ {
+		data := make([]byte, 100000)
+		rand.Read(data) //nolint:errcheck
+
+		if err := ioutil.WriteFile(filepath.Join(dir, fmt.Sprintf("file%v", i)), data, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s, err := New(ctx, env.Repository, Options{QuotaPerSource: 250000, QuotaPeriod: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.rep = env.Repository
+
+	sm := newSourceManager(snapshot.SourceInfo{UserName: "u", Host: "h", Path: dir}, s)
+
+	// upload exceeding the quota is canceled and the partial snapshot is saved.
+	snapID, err := sm.snapshotInternal(ctx)
+	if err != nil {
+		t.Fatalf("snapshot error: %v", err)
+	}
+
+	man, err := snapshot.LoadSnapshot(ctx, env.Repository, snapID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if man.IncompleteReason == "" {
+		t.Errorf("snapshot exceeding the quota is complete")
+	}
+
+	if _, ok := sm.lastError.(*quotaExceededError); !ok {
+		t.Errorf("unexpected last error: %v", sm.lastError)
+	}
+
+	// further snapshots are rejected until the quota period passes, measured using the repository clock.
+	if _, err := sm.snapshotInternal(ctx); err == nil {
+		t.Errorf("snapshot over quota was not rejected")
+	}
+
+	if got, want := sm.quotaRetryTime, ft.NowFunc()().Add(quotaRetryInterval); !got.Equal(want) {
+		t.Errorf("unexpected quota retry time: %v, want %v", got, want)
+	}
+
+	ft.Advance(2 * time.Hour)
+
+	if _, err := s.remainingUploadQuota(ctx, sm.src); err != nil {
+		t.Errorf("quota not available after the quota period: %v", err)
+	}
+}
@@ -0,0 +1,46 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/snapshot/restoretest"
+)
+
+// runRestoreTestsPeriodically fully reads randomly selected files from recent snapshots at the
+// restore test interval and records the results in the repository.
+func (s *Server) runRestoreTestsPeriodically(ctx context.Context, r *repo.Repository) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-time.After(s.options.RestoreTestInterval):
+			s.runRestoreTest(ctx, r)
+		}
+	}
+}
+
+func (s *Server) runRestoreTest(ctx context.Context, r *repo.Repository) {
+	result, err := restoretest.Run(ctx, r, restoretest.Options{Files: s.options.RestoreTestFiles})
+	if err != nil {
+		log(ctx).Warningf("unable to run restore test: %v", err)
+		return
+	}
+
+	for _, f := range result.Files {
+		if f.Error != "" {
+			log(ctx).Errorf("restore test failed to read %v in snapshot %v of %v: %v", f.Path, f.SnapshotID, f.Source, f.Error)
+		}
+	}
+
+	if err := restoretest.Save(ctx, r, result); err != nil {
+		log(ctx).Warningf("unable to save restore test result: %v", err)
+		return
+	}
+
+	if err := r.Flush(ctx); err != nil {
+		log(ctx).Warningf("unable to flush restore test result: %v", err)
+	}
+}
@@ -3,9 +3,11 @@ package server
 
 import (
 	"context"
+	"crypto/ed25519"
 	"encoding/json"
 	"net/http"
 	"net/url"
+	"runtime"
 	"sync"
 	"time"
 
@@ -14,9 +16,11 @@ import (
 
 	"github.com/kopia/kopia/internal/serverapi"
 	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/content"
 	"github.com/kopia/kopia/repo/logging"
 	"github.com/kopia/kopia/snapshot"
 	"github.com/kopia/kopia/snapshot/policy"
+	"github.com/kopia/kopia/snapshot/snapshotfs"
 )
 
 var log = logging.GetContextLoggerFunc("kopia/server")
@@ -34,6 +38,9 @@ type Server struct {
 	mu              sync.RWMutex
 	sourceManagers  map[snapshot.SourceInfo]*sourceManager
 	uploadSemaphore chan struct{}
+
+	// divides upload throughput between sources snapshotted at the same time.
+	uploadScheduler *snapshotfs.FairScheduler
 }
 
 // APIHandlers handles API requests.
@@ -45,6 +52,7 @@ func (s *Server) APIHandlers() http.Handler {
 	m.HandleFunc("/api/v1/sources", s.handleAPI(s.handleSourcesCreate)).Methods("POST")
 	m.HandleFunc("/api/v1/sources/upload", s.handleAPI(s.handleUpload)).Methods("POST")
 	m.HandleFunc("/api/v1/sources/cancel", s.handleAPI(s.handleCancel)).Methods("POST")
+	m.HandleFunc("/api/v1/sources/run", s.handleAPI(s.handleSourceRunStatus)).Methods("GET")
 
 	// snapshots
 	m.HandleFunc("/api/v1/snapshots", s.handleAPI(s.handleSnapshotList)).Methods("GET")
@@ -54,19 +62,29 @@ func (s *Server) APIHandlers() http.Handler {
 	m.HandleFunc("/api/v1/policy", s.handleAPI(s.handlePolicyDelete)).Methods("DELETE")
 
 	m.HandleFunc("/api/v1/policies", s.handleAPI(s.handlePolicyList)).Methods("GET")
+	m.HandleFunc("/api/v1/policies/authoritative", s.handleAPI(s.handleAuthoritativePolicies)).Methods("GET")
+
+	m.HandleFunc("/api/v1/agents", s.handleAPI(s.handleAgentList)).Methods("GET")
+	m.HandleFunc("/api/v1/agents", s.handleAPI(s.handleAgentRegister)).Methods("POST")
+	m.HandleFunc("/api/v1/agents/sources", s.handleAPI(s.handleAgentSourceEnable)).Methods("POST")
 
 	m.HandleFunc("/api/v1/refresh", s.handleAPI(s.handleRefresh)).Methods("POST")
 	m.HandleFunc("/api/v1/flush", s.handleAPI(s.handleFlush)).Methods("POST")
-	m.HandleFunc("/api/v1/shutdown", s.handleAPIPossiblyNotConnected(s.handleShutdown)).Methods("POST")
 
 	m.PathPrefix("/api/v1/objects/").HandlerFunc(s.handleObjectGet).Methods("GET")
+	m.PathPrefix("/api/v1/contents/").HandlerFunc(s.handleContentGet).Methods("GET", "HEAD")
 
 	m.HandleFunc("/api/v1/repo/status", s.handleAPIPossiblyNotConnected(s.handleRepoStatus)).Methods("GET")
-	m.HandleFunc("/api/v1/repo/connect", s.handleAPIPossiblyNotConnected(s.handleRepoConnect)).Methods("POST")
-	m.HandleFunc("/api/v1/repo/create", s.handleAPIPossiblyNotConnected(s.handleRepoCreate)).Methods("POST")
-	m.HandleFunc("/api/v1/repo/disconnect", s.handleAPI(s.handleRepoDisconnect)).Methods("POST")
 	m.HandleFunc("/api/v1/repo/algorithms", s.handleAPIPossiblyNotConnected(s.handleRepoSupportedAlgorithms)).Methods("GET")
 	m.HandleFunc("/api/v1/repo/sync", s.handleAPI(s.handleRepoSync)).Methods("POST")
+	m.HandleFunc("/api/v1/repo/maintenance", s.handleAPI(s.handleMaintenanceInfo)).Methods("GET")
+
+	if !s.options.DisableRepositoryManagement {
+		m.HandleFunc("/api/v1/shutdown", s.handleAPIPossiblyNotConnected(s.handleShutdown)).Methods("POST")
+		m.HandleFunc("/api/v1/repo/connect", s.handleAPIPossiblyNotConnected(s.handleRepoConnect)).Methods("POST")
+		m.HandleFunc("/api/v1/repo/create", s.handleAPIPossiblyNotConnected(s.handleRepoCreate)).Methods("POST")
+		m.HandleFunc("/api/v1/repo/disconnect", s.handleAPI(s.handleRepoDisconnect)).Methods("POST")
+	}
 
 	return m
 }
@@ -81,6 +99,15 @@ func (s *Server) handleAPI(f func(ctx context.Context, r *http.Request) (interfa
 	})
 }
 
+// UseRepository invokes the callback with the repository the server is connected to or nil if not connected.
+// The server lock is held while the callback runs, so that the repository is not closed or replaced meanwhile.
+func (s *Server) UseRepository(ctx context.Context, cb func(rep *repo.Repository)) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	cb(s.rep)
+}
+
 func (s *Server) handleAPIPossiblyNotConnected(f func(ctx context.Context, r *http.Request) (interface{}, *apiError)) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		s.mu.RLock()
@@ -210,6 +237,12 @@ func (s *Server) SetRepository(ctx context.Context, rep *repo.Repository) error
 		return nil
 	}
 
+	if err := s.enforceAuthoritativePolicies(ctx, rep); err != nil {
+		s.rep = nil
+
+		return err
+	}
+
 	if err := s.syncSourcesLocked(ctx); err != nil {
 		s.stopAllSourceManagersLocked(ctx)
 		s.rep = nil
@@ -220,6 +253,18 @@ func (s *Server) SetRepository(ctx context.Context, rep *repo.Repository) error
 	ctx, s.cancelRep = context.WithCancel(ctx)
 	go s.refreshPeriodically(ctx, rep)
 
+	if s.options.RestoreTestInterval > 0 {
+		go s.runRestoreTestsPeriodically(ctx, rep)
+	}
+
+	if s.options.PackRewriteInterval > 0 {
+		go runPeriodically(ctx, s.options.PackRewriteInterval, func() { s.rewritePacks(ctx, rep) })
+	}
+
+	if s.options.PackConsolidationInterval > 0 {
+		go runPeriodically(ctx, s.options.PackConsolidationInterval, func() { s.consolidatePacks(ctx, rep) })
+	}
+
 	return nil
 }
 
@@ -234,6 +279,10 @@ func (s *Server) refreshPeriodically(ctx context.Context, r *repo.Repository) {
 				log(ctx).Warningf("error refreshing repository: %v", err)
 			}
 
+			if err := s.enforceAuthoritativePolicies(ctx, r); err != nil {
+				log(ctx).Warningf("unable to enforce authoritative policies: %v", err)
+			}
+
 			if err := s.SyncSources(ctx); err != nil {
 				log(ctx).Warningf("unable to sync sources: %v", err)
 			}
@@ -332,15 +381,51 @@ type Options struct {
 	ConfigFile      string
 	ConnectOptions  *repo.ConnectOptions
 	RefreshInterval time.Duration
+
+	// maximum number of bytes of new contents uploaded per QuotaPeriod by a single source or all sources of a user, 0 means unlimited.
+	QuotaPerSource int64
+	QuotaPerUser   int64
+	QuotaPeriod    time.Duration
+
+	// prevents API clients from shutting down the server and connecting, creating or disconnecting repositories.
+	DisableRepositoryManagement bool
+
+	// maximum number of sources snapshotted at the same time, defaults to 1.
+	MaxConcurrentSnapshots int
+
+	// if set, snapshots are signed with the key.
+	SigningKey ed25519.PrivateKey
+
+	// if set, loads the bundle of authoritative policies, which are applied to the repository
+	// when connecting to it and on each refresh, reverting changes made by clients.
+	LoadAuthoritativePolicies func() (*policy.Bundle, error)
+
+	// if set, randomly selected files from recent snapshots are fully read at the interval to verify they can be restored.
+	RestoreTestInterval time.Duration
+	RestoreTestFiles    int
+
+	// if set, contents in use are rewritten at the interval from packs containing mostly deleted contents, which are deleted.
+	PackRewriteInterval time.Duration
+	PackRewrite         content.PackRewriteOptions
+
+	// if set, small packs are merged into full-size ones at the interval.
+	PackConsolidationInterval time.Duration
+	PackConsolidation         content.PackConsolidationOptions
 }
 
 // New creates a Server on top of a given Repository.
 // The server will manage sources for a given username@hostname.
 func New(ctx context.Context, rep *repo.Repository, options Options) (*Server, error) {
+	maxConcurrentSnapshots := options.MaxConcurrentSnapshots
+	if maxConcurrentSnapshots < 1 {
+		maxConcurrentSnapshots = 1
+	}
+
 	s := &Server{
 		options:         options,
 		sourceManagers:  map[snapshot.SourceInfo]*sourceManager{},
-		uploadSemaphore: make(chan struct{}, 1),
+		uploadSemaphore: make(chan struct{}, maxConcurrentSnapshots),
+		uploadScheduler: snapshotfs.NewFairScheduler(runtime.NumCPU()),
 	}
 
 	return s, nil
@@ -2,11 +2,18 @@ package server
 
 import (
 	"context"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/pkg/errors"
+
 	"github.com/kopia/kopia/fs/localfs"
+	"github.com/kopia/kopia/internal/ctxutil"
+	"github.com/kopia/kopia/internal/fssnapshot"
 	"github.com/kopia/kopia/internal/serverapi"
+	"github.com/kopia/kopia/repo/lock"
+	"github.com/kopia/kopia/repo/manifest"
 	"github.com/kopia/kopia/snapshot"
 	"github.com/kopia/kopia/snapshot/policy"
 	"github.com/kopia/kopia/snapshot/snapshotfs"
@@ -15,6 +22,8 @@ import (
 const (
 	statusRefreshInterval = 15 * time.Second // how frequently to refresh source status
 	oneDay                = 24 * time.Hour
+	quotaRetryInterval    = 15 * time.Minute // how frequently to retry snapshots of sources that exceeded their quota
+	maxRecentRuns         = 20               // number of finished snapshot runs whose results can be queried
 )
 
 // sourceManager manages the state machine of each source
@@ -42,6 +51,11 @@ type sourceManager struct {
 	lastSnapshot                       *snapshot.Manifest
 	lastCompleteSnapshot               *snapshot.Manifest
 	manifestsSinceLastCompleteSnapshot []*snapshot.Manifest
+	lastError                          error
+	quotaRetryTime                     time.Time
+	runsStarted                        int64
+	currentRun                         *serverapi.SnapshotRunStatus
+	recentRuns                         []serverapi.SnapshotRunStatus // most recent last
 
 	progress *snapshotfs.CountingUploadProgress
 }
@@ -65,6 +79,10 @@ func (s *sourceManager) Status() *serverapi.SourceStatus {
 		st.LastSnapshotSize = &ls.Stats.TotalFileSize
 	}
 
+	if s.lastError != nil {
+		st.LastError = s.lastError.Error()
+	}
+
 	if st.Status == "UPLOADING" {
 		c := s.progress.Snapshot()
 
@@ -80,6 +98,12 @@ func (s *sourceManager) setStatus(stat string) {
 	s.state = stat
 }
 
+func (s *sourceManager) setLastError(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastError = err
+}
+
 func (s *sourceManager) currentUploader() *snapshotfs.Uploader {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -169,9 +193,85 @@ func (s *sourceManager) scheduleSnapshotNow() {
 
 func (s *sourceManager) upload(ctx context.Context) serverapi.SourceActionResponse {
 	log(ctx).Infof("upload triggered via API: %v", s.src)
+
+	if _, err := s.server.remainingUploadQuota(ctx, s.src); err != nil {
+		log(ctx).Errorf("rejecting upload of %v: %v", s.src, err)
+		s.setLastError(err)
+
+		return serverapi.SourceActionResponse{Success: false}
+	}
+
 	s.scheduleSnapshotNow()
 
-	return serverapi.SourceActionResponse{Success: true}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	// all requests made before the next run starts are satisfied by it.
+	return serverapi.SourceActionResponse{Success: true, Run: s.runsStarted + 1}
+}
+
+// beginRun records the start of a new snapshot run.
+func (s *sourceManager) beginRun() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.runsStarted++
+	s.currentRun = &serverapi.SnapshotRunStatus{
+		Source:    s.src,
+		Run:       s.runsStarted,
+		State:     serverapi.SnapshotRunRunning,
+		StartTime: time.Now(),
+	}
+}
+
+// endRun records the result of the snapshot run started by beginRun.
+func (s *sourceManager) endRun(snapshotID manifest.ID, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := *s.currentRun
+	r.EndTime = time.Now()
+	r.SnapshotID = snapshotID
+	r.State = serverapi.SnapshotRunSucceeded
+
+	if err != nil {
+		r.State = serverapi.SnapshotRunFailed
+		r.Error = err.Error()
+	}
+
+	s.currentRun = nil
+	s.recentRuns = append(s.recentRuns, r)
+
+	if len(s.recentRuns) > maxRecentRuns {
+		s.recentRuns = s.recentRuns[len(s.recentRuns)-maxRecentRuns:]
+	}
+}
+
+// runStatus returns the status of the snapshot run with a given sequence number.
+func (s *sourceManager) runStatus(run int64) *serverapi.SnapshotRunStatus {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if cr := s.currentRun; cr != nil && cr.Run == run {
+		st := *cr
+		c := s.progress.Snapshot()
+		st.UploadCounters = &c
+
+		return &st
+	}
+
+	if run > s.runsStarted {
+		return &serverapi.SnapshotRunStatus{Source: s.src, Run: run, State: serverapi.SnapshotRunQueued}
+	}
+
+	for i := range s.recentRuns {
+		if s.recentRuns[i].Run == run {
+			st := s.recentRuns[i]
+			return &st
+		}
+	}
+
+	return &serverapi.SnapshotRunStatus{Source: s.src, Run: run, State: serverapi.SnapshotRunUnknown}
 }
 
 func (s *sourceManager) cancel(ctx context.Context) serverapi.SourceActionResponse {
@@ -218,48 +318,144 @@ func (s *sourceManager) snapshot(ctx context.Context) {
 	default:
 	}
 
-	localEntry, err := localfs.NewEntry(s.src.Path)
+	s.beginRun()
+
+	snapshotID, err := s.snapshotInternal(ctx)
 	if err != nil {
-		log(ctx).Errorf("unable to create local filesystem: %v", err)
-		return
+		log(ctx).Errorf("snapshot of %v failed: %v", s.src, err)
 	}
 
-	u := snapshotfs.NewUploader(s.server.rep)
+	s.endRun(snapshotID, err)
+}
+
+func (s *sourceManager) snapshotInternal(ctx context.Context) (manifest.ID, error) {
+	remainingQuota, err := s.server.remainingUploadQuota(ctx, s.src)
+	if err != nil {
+		s.setLastError(err)
+
+		// don't retry scheduled snapshot immediately, usage will only go down as the quota period moves.
+		s.mu.Lock()
+		s.quotaRetryTime = s.server.rep.Time().Add(quotaRetryInterval)
+		s.mu.Unlock()
+
+		return "", err
+	}
+
+	l, err := s.server.rep.AcquireLock(ctx, lock.Shared, "server snapshot of "+s.src.String())
+	if err != nil {
+		s.setLastError(err)
+
+		return "", errors.Wrap(err, "unable to lock repository")
+	}
+
+	defer releaseLock(ctx, l)
+
+	ctx, cancel := l.Context(ctx)
+	defer cancel()
 
 	policyTree, err := policy.TreeForSource(ctx, s.server.rep, s.src)
 	if err != nil {
 		log(ctx).Errorf("unable to create policy getter: %v", err)
 	}
 
+	localPath := s.src.Path
+
+	if fsp := policyTree.EffectivePolicy().FilesystemSnapshotPolicy; fsp.Enabled() {
+		snapshotPath, release, err := fssnapshot.Open(ctx, localPath, fssnapshot.Options{
+			Type:            fsp.Type,
+			LVMSnapshotSize: fsp.LVMSnapshotSize,
+		})
+		if err != nil {
+			s.setLastError(err)
+
+			return "", err
+		}
+		defer release()
+
+		localPath = snapshotPath
+	}
+
+	localEntry, err := localfs.NewEntry(localPath)
+	if err != nil {
+		return "", errors.Wrap(err, "unable to create local filesystem")
+	}
+
+	u := snapshotfs.NewUploader(s.server.rep)
+	if remainingQuota >= 0 {
+		u.MaxUploadBytes = remainingQuota
+	}
+
 	u.Progress = s.progress
+	u.FairShare = s.server.uploadScheduler.Join(policyTree.EffectivePolicy().SchedulingPolicy.Priority())
 
 	log(ctx).Infof("starting upload of %v", s.src)
 	s.setUploader(u)
-	manifest, err := u.Upload(ctx, localEntry, policyTree, s.src, s.manifestsSinceLastCompleteSnapshot...)
+	man, err := u.Upload(ctx, localEntry, policyTree, s.src, s.manifestsSinceLastCompleteSnapshot...)
 	s.setUploader(nil)
 
 	if err != nil {
-		log(ctx).Errorf("upload error: %v", err)
-		return
+		s.setLastError(err)
+
+		return "", errors.Wrap(err, "upload error")
 	}
 
-	snapshotID, err := snapshot.SaveSnapshot(ctx, s.server.rep, manifest)
+	// snapshot must not be saved if the lock was lost, since its contents may have been garbage-collected.
+	if err := l.Err(); err != nil {
+		s.setLastError(err)
+
+		return "", err
+	}
+
+	// partial snapshot of a canceled upload must still be saved.
+	saveCtx := ctxutil.Detach(ctx)
+
+	pol := policyTree.EffectivePolicy()
+
+	if man.Anomaly, err = pol.AnomalyPolicy.DetectAnomaly(ctx, s.server.rep, man); err != nil {
+		return "", errors.Wrap(err, "unable to check snapshot for anomalies")
+	}
+
+	for _, r := range man.SuspicionReasons() {
+		log(ctx).Warningf("snapshot of %v is suspicious, %v", s.src, r)
+	}
+
+	if pol.RejectsSnapshot(man) {
+		err := errors.Errorf("snapshot not saved because it is suspicious: %v", strings.Join(man.SuspicionReasons(), ", "))
+		s.setLastError(err)
+
+		return "", err
+	}
+
+	if key := s.server.options.SigningKey; key != nil {
+		if err := man.Sign(key); err != nil {
+			return "", errors.Wrap(err, "unable to sign snapshot")
+		}
+	}
+
+	snapshotID, err := snapshot.SaveSnapshot(saveCtx, s.server.rep, man)
 	if err != nil {
-		log(ctx).Errorf("unable to save snapshot: %v", err)
-		return
+		return "", errors.Wrap(err, "unable to save snapshot")
 	}
 
 	if _, err := policy.ApplyRetentionPolicy(ctx, s.server.rep, s.src, true); err != nil {
-		log(ctx).Errorf("unable to apply retention policy: %v", err)
-		return
+		return snapshotID, errors.Wrap(err, "unable to apply retention policy")
 	}
 
 	log(ctx).Infof("created snapshot %v", snapshotID)
 
-	if err := s.server.rep.Flush(ctx); err != nil {
-		log(ctx).Errorf("unable to flush: %v", err)
-		return
+	// partial snapshot is kept, but further uploads will be rejected until the quota period passes.
+	if _, err := s.server.remainingUploadQuota(ctx, s.src); err != nil {
+		log(ctx).Warningf("snapshot of %v is incomplete: %v", s.src, err)
+		s.setLastError(err)
+	} else {
+		s.setLastError(nil)
 	}
+
+	if err := s.server.rep.Flush(saveCtx); err != nil {
+		return snapshotID, errors.Wrap(err, "unable to flush")
+	}
+
+	return snapshotID, nil
 }
 
 func (s *sourceManager) findClosestNextSnapshotTime() *time.Time {
@@ -322,6 +518,14 @@ func (s *sourceManager) refreshStatus(ctx context.Context) {
 		}
 
 		s.nextSnapshotTime = s.findClosestNextSnapshotTime()
+
+		s.mu.RLock()
+		rt := s.quotaRetryTime
+		s.mu.RUnlock()
+
+		if nt := s.nextSnapshotTime; nt != nil && nt.Before(rt) {
+			s.nextSnapshotTime = &rt
+		}
 	} else {
 		s.nextSnapshotTime = nil
 		s.lastSnapshot = nil
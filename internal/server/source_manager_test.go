@@ -0,0 +1,52 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/serverapi"
+	"github.com/kopia/kopia/snapshot"
+)
+
+func TestSourceManagerRunStatus(t *testing.T) {
+	sm := newSourceManager(snapshot.SourceInfo{UserName: "u", Host: "h", Path: "/p"}, nil)
+
+	verifyState := func(run int64, want string) {
+		t.Helper()
+
+		if got := sm.runStatus(run).State; got != want {
+			t.Errorf("unexpected state of run %v: %v, want %v", run, got, want)
+		}
+	}
+
+	verifyState(1, serverapi.SnapshotRunQueued)
+
+	sm.beginRun()
+	verifyState(1, serverapi.SnapshotRunRunning)
+	verifyState(2, serverapi.SnapshotRunQueued)
+
+	sm.endRun("snap1", nil)
+	verifyState(1, serverapi.SnapshotRunSucceeded)
+
+	if got := sm.runStatus(1).SnapshotID; got != "snap1" {
+		t.Errorf("unexpected snapshot ID: %v", got)
+	}
+
+	sm.beginRun()
+	sm.endRun("", errors.New("some error"))
+	verifyState(2, serverapi.SnapshotRunFailed)
+
+	if got := sm.runStatus(2).Error; got != "some error" {
+		t.Errorf("unexpected error: %v", got)
+	}
+
+	for i := 0; i < maxRecentRuns; i++ {
+		sm.beginRun()
+		sm.endRun("", nil)
+	}
+
+	// oldest runs are forgotten
+	verifyState(1, serverapi.SnapshotRunUnknown)
+	verifyState(maxRecentRuns+2, serverapi.SnapshotRunSucceeded)
+}
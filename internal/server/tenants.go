@@ -0,0 +1,126 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// Tenant describes a single repository served by a multi-tenant server along with the credentials
+// of API clients allowed to access it.
+type Tenant struct {
+	Name               string `json:"name"`
+	Username           string `json:"username"`
+	Password           string `json:"password"`
+	ConfigFile         string `json:"configFile"`
+	RepositoryPassword string `json:"repositoryPassword"`
+
+	// common name of TLS client certificates identifying the tenant, as an alternative to username and password.
+	ClientCertificateName string `json:"clientCertificateName,omitempty"`
+}
+
+// LoadTenants loads the list of tenants from a JSON file.
+func LoadTenants(fname string) ([]Tenant, error) {
+	f, err := os.Open(fname) //nolint:gosec
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to open tenants file")
+	}
+	defer f.Close() //nolint:errcheck
+
+	var tenants []Tenant
+
+	if err := json.NewDecoder(f).Decode(&tenants); err != nil {
+		return nil, errors.Wrap(err, "unable to parse tenants file")
+	}
+
+	for i, t := range tenants {
+		if t.Name == "" || t.ConfigFile == "" || t.RepositoryPassword == "" {
+			return nil, errors.Errorf("tenant #%v must have name, configFile and repositoryPassword", i)
+		}
+
+		if (t.Username == "" || t.Password == "") && t.ClientCertificateName == "" {
+			return nil, errors.Errorf("tenant %q must have username and password or clientCertificateName", t.Name)
+		}
+	}
+
+	return tenants, nil
+}
+
+type tenantHandler struct {
+	name     string
+	password string
+	handler  http.Handler
+}
+
+// TenantRouter routes API requests to the handler of the tenant identified by request credentials.
+// Clients of one tenant have no way of reaching handlers of other tenants.
+type TenantRouter struct {
+	tenants     map[string]*tenantHandler // keyed by username
+	certTenants map[string]*tenantHandler // keyed by client certificate common name
+}
+
+// Add registers the handler for a tenant identified by its credentials.
+func (t *TenantRouter) Add(tenant Tenant, h http.Handler) error {
+	th := &tenantHandler{tenant.Name, tenant.Password, h}
+
+	if n := tenant.ClientCertificateName; n != "" {
+		if existing := t.certTenants[n]; existing != nil {
+			return errors.Errorf("client certificate name %q is used by both %q and %q", n, existing.name, tenant.Name)
+		}
+
+		t.certTenants[n] = th
+	}
+
+	if u := tenant.Username; u != "" {
+		if existing := t.tenants[u]; existing != nil {
+			return errors.Errorf("username %q is used by both %q and %q", u, existing.name, tenant.Name)
+		}
+
+		t.tenants[u] = th
+	}
+
+	return nil
+}
+
+func (t *TenantRouter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// client certificates are only present when the server verifies them during TLS handshake.
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		if th := t.certTenants[r.TLS.PeerCertificates[0].Subject.CommonName]; th != nil {
+			log(r.Context()).Debugf("request %v for tenant %v", r.URL, th.name)
+			th.handler.ServeHTTP(w, r)
+
+			return
+		}
+	}
+
+	user, pass, ok := r.BasicAuth()
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Basic realm="Kopia"`)
+		http.Error(w, "Missing credentials.\n", http.StatusUnauthorized)
+
+		return
+	}
+
+	th := t.tenants[user]
+	if th == nil || subtle.ConstantTimeCompare([]byte(pass), []byte(th.password)) != 1 {
+		w.Header().Set("WWW-Authenticate", `Basic realm="Kopia"`)
+		http.Error(w, "Access denied.\n", http.StatusUnauthorized)
+
+		return
+	}
+
+	log(r.Context()).Debugf("request %v for tenant %v", r.URL, th.name)
+
+	th.handler.ServeHTTP(w, r)
+}
+
+// NewTenantRouter creates a TenantRouter with no tenants.
+func NewTenantRouter() *TenantRouter {
+	return &TenantRouter{
+		tenants:     map[string]*tenantHandler{},
+		certTenants: map[string]*tenantHandler{},
+	}
+}
@@ -0,0 +1,102 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTenantRouter(t *testing.T) {
+	router := NewTenantRouter()
+
+	for _, name := range []string{"t1", "t2"} {
+		name := name
+
+		if err := router.Add(Tenant{Name: name, Username: "user-" + name, Password: "pass-" + name, ClientCertificateName: "cert-" + name}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(name)) //nolint:errcheck
+		})); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := router.Add(Tenant{Name: "t3", Username: "user-t1", Password: "other"}, http.NotFoundHandler()); err == nil {
+		t.Errorf("expected error when adding duplicate username")
+	}
+
+	cases := []struct {
+		user, pass string
+		certName   string
+		wantCode   int
+		wantBody   string
+	}{
+		{"user-t1", "pass-t1", "", http.StatusOK, "t1"},
+		{"user-t2", "pass-t2", "", http.StatusOK, "t2"},
+		{"user-t1", "pass-t2", "", http.StatusUnauthorized, ""},
+		{"user-t3", "pass-t3", "", http.StatusUnauthorized, ""},
+		{"", "", "", http.StatusUnauthorized, ""},
+		{"", "", "cert-t2", http.StatusOK, "t2"},
+		{"", "", "cert-t3", http.StatusUnauthorized, ""},
+	}
+
+	for _, tc := range cases {
+		req := httptest.NewRequest("GET", "/api/v1/sources", nil)
+		if tc.user != "" {
+			req.SetBasicAuth(tc.user, tc.pass)
+		}
+
+		if tc.certName != "" {
+			req.TLS = &tls.ConnectionState{
+				PeerCertificates: []*x509.Certificate{{Subject: pkix.Name{CommonName: tc.certName}}},
+			}
+		}
+
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		if rec.Code != tc.wantCode {
+			t.Errorf("unexpected status code for %v: %v, want %v", tc.user, rec.Code, tc.wantCode)
+		}
+
+		if tc.wantCode == http.StatusOK && rec.Body.String() != tc.wantBody {
+			t.Errorf("request of %v routed to %q, want %q", tc.user, rec.Body.String(), tc.wantBody)
+		}
+	}
+}
+
+func TestLoadTenants(t *testing.T) {
+	td, err := ioutil.TempDir("", "tenants")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(td)
+
+	fname := filepath.Join(td, "tenants.json")
+
+	if err = ioutil.WriteFile(fname, []byte(`[{"name":"t1","username":"u1","password":"p1","configFile":"c1","repositoryPassword":"r1"}]`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tenants, err := LoadTenants(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tenants) != 1 || tenants[0].ConfigFile != "c1" || tenants[0].RepositoryPassword != "r1" {
+		t.Errorf("unexpected tenants: %+v", tenants)
+	}
+
+	if err = ioutil.WriteFile(fname, []byte(`[{"name":"t1","username":"u1"}]`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := LoadTenants(fname); err == nil {
+		t.Errorf("expected error for incomplete tenant")
+	}
+}
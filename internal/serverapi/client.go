@@ -8,7 +8,9 @@ import (
 	"crypto/x509"
 	"encoding/hex"
 	"encoding/json"
+	"net"
 	"net/http"
+	"strings"
 
 	"github.com/pkg/errors"
 
@@ -20,6 +22,8 @@ var log = logging.GetContextLoggerFunc("kopia/client")
 // DefaultUsername is the default username for Kopia server.
 const DefaultUsername = "kopia"
 
+const unixSocketPrefix = "unix:"
+
 // Client provides helper methods for communicating with Kopia API serevr.
 type Client struct {
 	options ClientOptions
@@ -100,6 +104,7 @@ func (c *Client) Post(ctx context.Context, path string, reqPayload, respPayload
 
 // ClientOptions encapsulates all optional API options.HTTPClient options.
 type ClientOptions struct {
+	// BaseURL is the URL of the server, or 'unix:' followed by the path of the unix socket the server listens on.
 	BaseURL string
 
 	HTTPClient *http.Client
@@ -111,6 +116,9 @@ type ClientOptions struct {
 
 	RootCAs *x509.CertPool
 
+	// certificates presented to servers requiring TLS client authentication.
+	ClientCertificates []tls.Certificate
+
 	LogRequests bool
 }
 
@@ -120,10 +128,21 @@ func NewClient(options ClientOptions) (*Client, error) {
 	if options.HTTPClient == nil {
 		transport := &http.Transport{
 			TLSClientConfig: &tls.Config{
-				RootCAs: options.RootCAs,
+				RootCAs:      options.RootCAs,
+				Certificates: options.ClientCertificates,
 			},
 		}
 
+		if socketPath := strings.TrimPrefix(options.BaseURL, unixSocketPrefix); socketPath != options.BaseURL {
+			transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", socketPath)
+			}
+
+			// host name is ignored when dialing unix socket
+			options.BaseURL = "http://localhost"
+		}
+
 		if f := options.TrustedServerCertificateFingerprint; f != "" {
 			if options.RootCAs != nil {
 				return nil, errors.Errorf("can't set both RootCAs and TrustedServerCertificateFingerprint")
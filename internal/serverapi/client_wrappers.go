@@ -101,9 +101,43 @@ func (c *Client) ListPolicies(ctx context.Context, match *snapshot.SourceInfo) (
 	return resp, nil
 }
 
+// RegisterAgent registers the machine described by the provided information with the server.
+func (c *Client) RegisterAgent(ctx context.Context, info *AgentInfo) error {
+	return c.Post(ctx, "agents", info, &Empty{})
+}
+
+// ListAgents lists the agents registered with the server.
+func (c *Client) ListAgents(ctx context.Context) (*AgentsResponse, error) {
+	resp := &AgentsResponse{}
+	if err := c.Get(ctx, "agents", resp); err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// EnableAgentSource enables snapshotting of a source on a registered agent.
+func (c *Client) EnableAgentSource(ctx context.Context, req *EnableAgentSourceRequest) (*CreateSnapshotSourceResponse, error) {
+	resp := &CreateSnapshotSourceResponse{}
+	if err := c.Post(ctx, "agents/sources", req, resp); err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
 // GetObject returns the object payload.
 func (c *Client) GetObject(ctx context.Context, objectID string) ([]byte, error) {
-	req, err := http.NewRequest("GET", c.options.BaseURL+"objects/"+objectID, nil)
+	return c.getRaw(ctx, "objects/"+objectID)
+}
+
+// GetContent returns the raw payload of a content block.
+func (c *Client) GetContent(ctx context.Context, contentID string) ([]byte, error) {
+	return c.getRaw(ctx, "contents/"+contentID)
+}
+
+func (c *Client) getRaw(ctx context.Context, urlSuffix string) ([]byte, error) {
+	req, err := http.NewRequest("GET", c.options.BaseURL+urlSuffix, nil)
 	if err != nil {
 		return nil, err
 	}
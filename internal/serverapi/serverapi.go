@@ -10,6 +10,7 @@ import (
 	"github.com/kopia/kopia/repo/manifest"
 	"github.com/kopia/kopia/snapshot"
 	"github.com/kopia/kopia/snapshot/policy"
+	"github.com/kopia/kopia/snapshot/restoretest"
 	"github.com/kopia/kopia/snapshot/snapshotfs"
 )
 
@@ -25,6 +26,18 @@ type StatusResponse struct {
 	Storage     string `json:"storage,omitempty"`
 }
 
+// MaintenanceInfoResponse is the response of 'repo/maintenance' HTTP API command.
+type MaintenanceInfoResponse struct {
+	IndexBlobCount         int       `json:"indexBlobCount"`
+	IndexBlobsTotalSize    int64     `json:"indexBlobsTotalSize"`
+	UncompactedIndexBlobs  int       `json:"uncompactedIndexBlobs"`
+	OldestIndexBlobTime    time.Time `json:"oldestIndexBlobTime,omitempty"`
+	NewestIndexBlobTime    time.Time `json:"newestIndexBlobTime,omitempty"`
+	IndexOptimizeSuggested bool      `json:"indexOptimizeSuggested"`
+
+	LastRestoreTest *restoretest.Result `json:"lastRestoreTest,omitempty"`
+}
+
 // SourcesResponse is the response of 'sources' HTTP API command.
 type SourcesResponse struct {
 	LocalUsername string `json:"localUsername"`
@@ -42,6 +55,7 @@ type SourceStatus struct {
 	LastSnapshotTime *time.Time                 `json:"lastSnapshotTime,omitempty"`
 	NextSnapshotTime *time.Time                 `json:"nextSnapshotTime,omitempty"`
 	UploadCounters   *snapshotfs.UploadCounters `json:"upload,omitempty"`
+	LastError        string                     `json:"lastError,omitempty"`
 }
 
 // PolicyListEntry describes single policy.
@@ -87,6 +101,31 @@ type ErrorResponse struct {
 // SourceActionResponse is a per-source response.
 type SourceActionResponse struct {
 	Success bool `json:"success"`
+
+	// Run is the sequence number of the snapshot run that will satisfy an upload request,
+	// which can be passed to 'sources/run' to query its progress.
+	Run int64 `json:"run,omitempty"`
+}
+
+// Snapshot run states.
+const (
+	SnapshotRunQueued    = "QUEUED"
+	SnapshotRunRunning   = "RUNNING"
+	SnapshotRunSucceeded = "SUCCEEDED"
+	SnapshotRunFailed    = "FAILED"
+	SnapshotRunUnknown   = "UNKNOWN" // run is too old or was never requested
+)
+
+// SnapshotRunStatus is the response of 'sources/run' HTTP API command.
+type SnapshotRunStatus struct {
+	Source         snapshot.SourceInfo        `json:"source"`
+	Run            int64                      `json:"run"`
+	State          string                     `json:"state"`
+	StartTime      time.Time                  `json:"startTime,omitempty"`
+	EndTime        time.Time                  `json:"endTime,omitempty"`
+	SnapshotID     manifest.ID                `json:"snapshotID,omitempty"`
+	Error          string                     `json:"error,omitempty"`
+	UploadCounters *snapshotfs.UploadCounters `json:"upload,omitempty"`
 }
 
 // MultipleSourceActionResponse contains per-source responses for all sources targeted by API command.
@@ -148,3 +187,31 @@ type Snapshot struct {
 type SnapshotsResponse struct {
 	Snapshots []*Snapshot `json:"snapshots"`
 }
+
+// AgentInfo describes a machine registered with the server along with snapshot sources discovered on it.
+type AgentInfo struct {
+	Hostname        string    `json:"hostname"`
+	Username        string    `json:"username"`
+	OS              string    `json:"os"`
+	Volumes         []string  `json:"volumes"`
+	HomeDirectories []string  `json:"homeDirectories"`
+	LastSeen        time.Time `json:"lastSeen"`
+}
+
+// AgentStatus describes a registered agent along with sources enabled for it.
+type AgentStatus struct {
+	AgentInfo
+
+	Sources []snapshot.SourceInfo `json:"sources"`
+}
+
+// AgentsResponse contains a list of registered agents.
+type AgentsResponse struct {
+	Agents []*AgentStatus `json:"agents"`
+}
+
+// EnableAgentSourceRequest contains request to enable snapshotting of a source on a registered agent.
+type EnableAgentSourceRequest struct {
+	Source        snapshot.SourceInfo `json:"source"`
+	InitialPolicy policy.Policy       `json:"initialPolicy"` // policy to set on the source when first enabled, ignored if already exists
+}
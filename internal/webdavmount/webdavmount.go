@@ -93,19 +93,23 @@ type webdavDir struct {
 	entry fs.Directory
 }
 
+// errEnoughEntries stops directory iteration once the requested number of entries has been read.
+var errEnoughEntries = errors.New("enough entries")
+
 func (d *webdavDir) Readdir(n int) ([]os.FileInfo, error) {
-	entries, err := d.entry.Readdir(d.ctx)
-	if err != nil {
-		return nil, err
-	}
+	var fis []os.FileInfo
 
-	if n > 0 && n < len(entries) {
-		entries = entries[0:n]
-	}
+	err := fs.IterateEntries(d.ctx, d.entry, func(ctx context.Context, e fs.Entry) error {
+		if n > 0 && len(fis) >= n {
+			return errEnoughEntries
+		}
 
-	var fis []os.FileInfo
-	for _, e := range entries {
 		fis = append(fis, &webdavFileInfo{e})
+
+		return nil
+	})
+	if err != nil && !errors.Is(err, errEnoughEntries) {
+		return nil, err
 	}
 
 	return fis, nil
@@ -0,0 +1,94 @@
+// Package appendonly implements wrapper around Storage that prevents deleting and overwriting blobs.
+//
+// The wrapper is used by clients connected with append-only credentials, which can add new blobs to the storage
+// but are not allowed to remove or replace existing ones. Blobs with mutable prefixes, such as lock blobs,
+// are exempt. The wrapper only makes such clients fail early, the restriction itself must be enforced
+// by the storage provider.
+package appendonly
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo/blob"
+)
+
+// ErrAppendOnly is returned when attempting to delete or overwrite a blob in append-only storage.
+var ErrAppendOnly = errors.New("storage is append-only")
+
+type appendOnlyStorage struct {
+	blob.Storage
+
+	mutablePrefixes []blob.ID
+}
+
+func (s *appendOnlyStorage) isMutable(id blob.ID) bool {
+	for _, p := range s.mutablePrefixes {
+		if strings.HasPrefix(string(id), string(p)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checkNotExists returns ErrAppendOnly if the immutable blob already exists.
+func (s *appendOnlyStorage) checkNotExists(ctx context.Context, id blob.ID) error {
+	if s.isMutable(id) {
+		return nil
+	}
+
+	_, err := s.Storage.GetBlob(ctx, id, 0, 0)
+
+	switch err {
+	case nil:
+		return errors.Wrapf(ErrAppendOnly, "unable to overwrite %v", id)
+	case blob.ErrBlobNotFound:
+		return nil
+	default:
+		return err
+	}
+}
+
+func (s *appendOnlyStorage) PutBlob(ctx context.Context, id blob.ID, data []byte) error {
+	if err := s.checkNotExists(ctx, id); err != nil {
+		return err
+	}
+
+	return s.Storage.PutBlob(ctx, id, data)
+}
+
+func (s *appendOnlyStorage) PutBlobWithOptions(ctx context.Context, id blob.ID, data []byte, opt blob.PutOptions) error {
+	if err := s.checkNotExists(ctx, id); err != nil {
+		return err
+	}
+
+	return blob.PutBlobWithOptions(ctx, s.Storage, id, data, opt)
+}
+
+func (s *appendOnlyStorage) SetStorageClass(ctx context.Context, id blob.ID, storageClass string) error {
+	return blob.SetStorageClass(ctx, s.Storage, id, storageClass)
+}
+
+func (s *appendOnlyStorage) RestoreArchivedBlob(ctx context.Context, id blob.ID, days int) (bool, error) {
+	return blob.RestoreArchivedBlob(ctx, s.Storage, id, days)
+}
+
+func (s *appendOnlyStorage) DeleteBlob(ctx context.Context, id blob.ID) error {
+	if !s.isMutable(id) {
+		return errors.Wrapf(ErrAppendOnly, "unable to delete %v", id)
+	}
+
+	return s.Storage.DeleteBlob(ctx, id)
+}
+
+// NewWrapper returns a Storage wrapper that refuses to delete or overwrite blobs except the ones
+// with the provided mutable prefixes.
+func NewWrapper(wrapped blob.Storage, mutablePrefixes []blob.ID) blob.Storage {
+	return &appendOnlyStorage{
+		Storage:         wrapped,
+		mutablePrefixes: mutablePrefixes,
+	}
+}
@@ -0,0 +1,49 @@
+package appendonly
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/blobtesting"
+	"github.com/kopia/kopia/internal/testlogging"
+	"github.com/kopia/kopia/repo/blob"
+)
+
+func TestAppendOnlyStorage(t *testing.T) {
+	ctx := testlogging.Context(t)
+	data := blobtesting.DataMap{}
+
+	st := NewWrapper(blobtesting.NewMapStorage(data, nil, nil), []blob.ID{"l"})
+
+	for _, id := range []blob.ID{"p1", "n1", "l1"} {
+		if err := st.PutBlob(ctx, id, []byte{1, 2}); err != nil {
+			t.Fatalf("unable to write %v: %v", id, err)
+		}
+	}
+
+	blobtesting.AssertGetBlob(ctx, t, st, "p1", []byte{1, 2})
+	blobtesting.AssertListResults(ctx, t, st, "", "l1", "n1", "p1")
+
+	if err := st.PutBlob(ctx, "p1", []byte{3, 4}); !errors.Is(err, ErrAppendOnly) {
+		t.Errorf("unexpected error overwriting blob: %v", err)
+	}
+
+	if err := st.DeleteBlob(ctx, "n1"); !errors.Is(err, ErrAppendOnly) {
+		t.Errorf("unexpected error deleting blob: %v", err)
+	}
+
+	blobtesting.AssertGetBlob(ctx, t, st, "p1", []byte{1, 2})
+	blobtesting.AssertGetBlob(ctx, t, st, "n1", []byte{1, 2})
+
+	// blobs with mutable prefixes can be rewritten and deleted.
+	if err := st.PutBlob(ctx, "l1", []byte{3, 4}); err != nil {
+		t.Errorf("unable to rewrite mutable blob: %v", err)
+	}
+
+	if err := st.DeleteBlob(ctx, "l1"); err != nil {
+		t.Errorf("unable to delete mutable blob: %v", err)
+	}
+
+	blobtesting.AssertListResults(ctx, t, st, "", "n1", "p1")
+}
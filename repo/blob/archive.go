@@ -0,0 +1,28 @@
+package blob
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+)
+
+// ErrBlobArchived is returned when a BLOB is stored in an archival tier and must be restored before it can be read.
+var ErrBlobArchived = errors.New("BLOB is archived")
+
+// ArchiveRestorer is implemented by storage providers which support archival storage tiers,
+// such as S3 Glacier or Azure Archive.
+type ArchiveRestorer interface {
+	// RestoreArchivedBlob requests the archived blob to be restored and kept readable for the provided
+	// number of days. It returns true if the blob can be read now and false if the restore is in progress.
+	RestoreArchivedBlob(ctx context.Context, blobID ID, days int) (bool, error)
+}
+
+// RestoreArchivedBlob requests the blob to be restored if the storage supports archival tiers
+// and returns true when the blob can be read.
+func RestoreArchivedBlob(ctx context.Context, st Storage, blobID ID, days int) (bool, error) {
+	if ar, ok := st.(ArchiveRestorer); ok {
+		return ar.RestoreArchivedBlob(ctx, blobID, days)
+	}
+
+	return true, nil
+}
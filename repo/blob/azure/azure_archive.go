@@ -0,0 +1,49 @@
+package azure
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/Azure/azure-storage-blob-go/azblob"
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo/blob"
+)
+
+// RestoreArchivedBlob implements blob.ArchiveRestorer. Archived blobs are rehydrated to the hot tier,
+// where they remain until moved again, so the number of days is ignored.
+func (az *azStorage) RestoreArchivedBlob(ctx context.Context, b blob.ID, days int) (bool, error) {
+	var cu *azblob.ContainerURL
+	if !az.bucket.As(&cu) {
+		return false, errors.New("unable to access container")
+	}
+
+	bu := cu.NewBlobURL(az.getObjectNameString(b))
+
+	props, err := bu.GetProperties(ctx, azblob.BlobAccessConditions{})
+	if err != nil {
+		var se azblob.StorageError
+		if errors.As(err, &se) && se.Response().StatusCode == http.StatusNotFound {
+			return false, blob.ErrBlobNotFound
+		}
+
+		return false, err
+	}
+
+	if props.AccessTier() != string(azblob.AccessTierArchive) {
+		return true, nil
+	}
+
+	if props.ArchiveStatus() != "" {
+		// rehydrate-pending-to-hot or rehydrate-pending-to-cool
+		return false, nil
+	}
+
+	log(ctx).Debugf("requesting rehydration of %v", b)
+
+	if _, err := bu.SetTier(ctx, azblob.AccessTierHot, azblob.LeaseAccessConditions{}); err != nil {
+		return false, errors.Wrap(err, "unable to rehydrate blob")
+	}
+
+	return false, nil
+}
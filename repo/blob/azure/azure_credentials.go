@@ -0,0 +1,158 @@
+package azure
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Azure/azure-storage-blob-go/azblob"
+	"github.com/pkg/errors"
+	"gocloud.dev/blob/azureblob"
+
+	"github.com/kopia/kopia/internal/credexec"
+	"github.com/kopia/kopia/repo/logging"
+)
+
+var log = logging.GetContextLoggerFunc("repo/azure")
+
+// Supported values of Options.CredentialsProvider.
+const (
+	// CredentialsSharedKey uses the storage account key from Options.
+	CredentialsSharedKey = "shared-key"
+
+	// CredentialsMSI obtains OAuth tokens from the managed identity of the Azure VM or service.
+	CredentialsMSI = "msi"
+
+	// CredentialsExec runs Options.CredentialsCommand to obtain OAuth tokens.
+	CredentialsExec = "exec"
+)
+
+const (
+	msiTokenEndpoint = "http://169.254.169.254/metadata/identity/oauth2/token?api-version=2018-02-01&resource=https%3A%2F%2Fstorage.azure.com%2F"
+
+	// tokenRetryInterval is the delay before retrying after failure to refresh a token.
+	tokenRetryInterval = 30 * time.Second
+)
+
+// tokenFetcher returns the token and its expiration time, zero if it does not expire.
+type tokenFetcher func(ctx context.Context) (string, time.Time, error)
+
+// newCredential returns the credential used to authorize requests and shared key credential
+// used to sign URLs, which is nil unless shared key is used.
+func newCredential(ctx context.Context, opt *Options) (azblob.Credential, *azblob.SharedKeyCredential, error) {
+	var fetch tokenFetcher
+
+	switch opt.CredentialsProvider {
+	case "", CredentialsSharedKey:
+		credential, err := azureblob.NewCredential(azureblob.AccountName(opt.StorageAccount), azureblob.AccountKey(opt.StorageKey))
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return credential, credential, nil
+
+	case CredentialsMSI:
+		fetch = fetchMSIToken
+
+	case CredentialsExec:
+		if opt.CredentialsCommand == "" {
+			return nil, nil, errors.New("credentials command must be specified")
+		}
+
+		fetch = func(ctx context.Context) (string, time.Time, error) {
+			c, err := credexec.Run(ctx, opt.CredentialsCommand)
+			if err != nil {
+				return "", time.Time{}, err
+			}
+
+			if c.Token == "" {
+				return "", time.Time{}, errors.New("credentials command did not return a token")
+			}
+
+			return c.Token, c.Expiration, nil
+		}
+
+	default:
+		return nil, nil, errors.Errorf("unsupported credentials provider %q", opt.CredentialsProvider)
+	}
+
+	token, expiration, err := fetch(ctx)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "unable to obtain token")
+	}
+
+	if expiration.IsZero() {
+		return azblob.NewTokenCredential(token, nil), nil, nil
+	}
+
+	initial := true
+
+	return azblob.NewTokenCredential(token, func(tc azblob.TokenCredential) time.Duration {
+		// the refresher is invoked immediately, at which point the token is fresh.
+		if initial {
+			initial = false
+			return refreshDelay(expiration)
+		}
+
+		newToken, newExpiration, err := fetch(ctx)
+		if err != nil {
+			log(ctx).Warningf("unable to refresh Azure token: %v", err)
+			return tokenRetryInterval
+		}
+
+		tc.SetToken(newToken)
+
+		return refreshDelay(newExpiration)
+	}), nil, nil
+}
+
+func refreshDelay(expiration time.Time) time.Duration {
+	if expiration.IsZero() {
+		return 0
+	}
+
+	d := time.Until(expiration.Add(-credexec.ExpiryWindow)) // allow:no-inject-time
+	if d < tokenRetryInterval {
+		d = tokenRetryInterval
+	}
+
+	return d
+}
+
+func fetchMSIToken(ctx context.Context) (string, time.Time, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, msiTokenEndpoint, nil)
+	if err != nil {
+		return "", time.Time{}, errors.Wrap(err, "unable to create request")
+	}
+
+	req.Header.Set("Metadata", "true")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", time.Time{}, errors.Wrap(err, "unable to contact instance metadata service")
+	}
+
+	defer resp.Body.Close() //nolint:errcheck
+
+	if resp.StatusCode != http.StatusOK {
+		return "", time.Time{}, errors.Errorf("instance metadata service returned %v", resp.Status)
+	}
+
+	var tok struct {
+		AccessToken string `json:"access_token"`
+		ExpiresOn   string `json:"expires_on"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&tok); err != nil {
+		return "", time.Time{}, errors.Wrap(err, "invalid token response")
+	}
+
+	expiresOn, err := strconv.ParseInt(tok.ExpiresOn, 10, 64)
+	if err != nil {
+		return "", time.Time{}, errors.Wrap(err, "invalid token expiration")
+	}
+
+	return tok.AccessToken, time.Unix(expiresOn, 0), nil
+}
@@ -1,5 +1,7 @@
 package azure
 
+import "github.com/kopia/kopia/repo/blob"
+
 // Options defines options for Azure blob storage storage.
 type Options struct {
 	// Container is the name of the azure storage container where data is stored.
@@ -12,6 +14,14 @@ type Options struct {
 	StorageAccount string `json:"storageAccount"`
 	StorageKey     string `json:"storageKey" kopia:"sensitive"`
 
+	// CredentialsProvider selects how credentials are obtained, one of "shared-key" (default), "msi" or "exec".
+	CredentialsProvider string `json:"credentialsProvider,omitempty"`
+
+	// CredentialsCommand is the command used to obtain OAuth tokens when CredentialsProvider is "exec".
+	CredentialsCommand string `json:"credentialsCommand,omitempty"`
+
+	blob.TransportOptions
+
 	MaxUploadSpeedBytesPerSecond   int `json:"maxUploadSpeedBytesPerSecond,omitempty"`
 	MaxDownloadSpeedBytesPerSecond int `json:"maxDownloadSpeedBytesPerSecond,omitempty"`
 }
@@ -7,8 +7,10 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net/http"
 	"time"
 
+	"github.com/Azure/azure-pipeline-go/pipeline"
 	"github.com/Azure/azure-storage-blob-go/azblob"
 	"github.com/efarrer/iothrottler"
 	"github.com/pkg/errors"
@@ -102,6 +104,11 @@ func translateError(err error) error {
 		return blob.ErrBlobNotFound
 	}
 
+	var se azblob.StorageError
+	if errors.As(err, &se) && se.ServiceCode() == "BlobArchived" {
+		return blob.ErrBlobArchived
+	}
+
 	return err
 }
 
@@ -203,6 +210,20 @@ func toBandwidth(bytesPerSecond int) iothrottler.Bandwidth {
 	return iothrottler.Bandwidth(bytesPerSecond) * iothrottler.BytesPerSecond
 }
 
+// newHTTPSender returns pipeline factory which sends requests using the provided client.
+func newHTTPSender(cli *http.Client) pipeline.Factory {
+	return pipeline.FactoryFunc(func(next pipeline.Policy, po *pipeline.PolicyOptions) pipeline.PolicyFunc {
+		return func(ctx context.Context, request pipeline.Request) (pipeline.Response, error) {
+			r, err := cli.Do(request.WithContext(ctx))
+			if err != nil {
+				err = pipeline.NewError(err, "HTTP request failed")
+			}
+
+			return pipeline.NewHTTPResponse(r), err
+		}
+	})
+}
+
 // New creates new Azure Blob Storage-backed storage with specified options:
 //
 // - the 'Container', 'StorageAccount' and 'StorageKey' fields are required and all other parameters are optional.
@@ -212,16 +233,32 @@ func New(ctx context.Context, opt *Options) (blob.Storage, error) {
 	}
 
 	// create a credentials object.
-	credential, err := azureblob.NewCredential(azureblob.AccountName(opt.StorageAccount), azureblob.AccountKey(opt.StorageKey))
+	credential, sharedKeyCredential, err := newCredential(ctx, opt)
 	if err != nil {
 		return nil, err
 	}
 
+	var pipelineOptions azblob.PipelineOptions
+
+	if !opt.TransportOptions.IsDefault() {
+		t, err := opt.TransportOptions.NewTransport(false)
+		if err != nil {
+			return nil, err
+		}
+
+		pipelineOptions.HTTPSender = newHTTPSender(&http.Client{Transport: t})
+	}
+
 	// create a Pipeline with credentials.
-	pipeline := azureblob.NewPipeline(credential, azblob.PipelineOptions{})
+	pl := azureblob.NewPipeline(credential, pipelineOptions)
+
+	bucketOptions := &azureblob.Options{}
+	if sharedKeyCredential != nil {
+		bucketOptions.Credential = sharedKeyCredential
+	}
 
 	// create a *blob.Bucket.
-	bucket, err := azureblob.OpenBucket(ctx, pipeline, azureblob.AccountName(opt.StorageAccount), opt.Container, &azureblob.Options{Credential: credential})
+	bucket, err := azureblob.OpenBucket(ctx, pl, azureblob.AccountName(opt.StorageAccount), opt.Container, bucketOptions)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,55 @@
+package azure
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/Azure/azure-storage-blob-go/azblob"
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo/blob"
+)
+
+// PutBlobWithOptions implements blob.PutterWithOptions. Blobs are uploaded to the default access tier
+// of the account and moved to the requested tier afterwards.
+func (az *azStorage) PutBlobWithOptions(ctx context.Context, b blob.ID, data []byte, opt blob.PutOptions) error {
+	if err := az.PutBlob(ctx, b, data); err != nil {
+		return err
+	}
+
+	if opt.StorageClass == "" {
+		return nil
+	}
+
+	return az.SetStorageClass(ctx, b, opt.StorageClass)
+}
+
+// SetStorageClass implements blob.StorageClassChanger using access tiers (Hot, Cool or Archive).
+func (az *azStorage) SetStorageClass(ctx context.Context, b blob.ID, storageClass string) error {
+	var cu *azblob.ContainerURL
+	if !az.bucket.As(&cu) {
+		return errors.New("unable to access container")
+	}
+
+	bu := cu.NewBlobURL(az.getObjectNameString(b))
+
+	props, err := bu.GetProperties(ctx, azblob.BlobAccessConditions{})
+	if err != nil {
+		var se azblob.StorageError
+		if errors.As(err, &se) && se.Response().StatusCode == http.StatusNotFound {
+			return blob.ErrBlobNotFound
+		}
+
+		return err
+	}
+
+	if props.AccessTier() == storageClass {
+		return nil
+	}
+
+	if _, err := bu.SetTier(ctx, azblob.AccessTierType(storageClass), azblob.LeaseAccessConditions{}); err != nil {
+		return errors.Wrapf(err, "unable to set access tier of %v", b)
+	}
+
+	return nil
+}
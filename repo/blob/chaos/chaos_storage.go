@@ -0,0 +1,178 @@
+// Package chaos implements wrapper around Storage that injects random latencies and failures.
+//
+// It is meant for validating retry and repair behavior against realistic failure modes
+// and must never be used for repositories holding important data.
+package chaos
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/logging"
+)
+
+var log = logging.GetContextLoggerFunc("repo/chaos")
+
+// ErrInjected is returned by operations that failed due to an injected fault.
+var ErrInjected = errors.New("injected storage fault")
+
+// Options specifies which faults are injected and how often.
+type Options struct {
+	// ErrorRate is the probability of each operation failing with ErrInjected.
+	ErrorRate float64
+
+	// PartialWriteRate is the probability of PutBlob writing only a prefix of the data
+	// before failing with ErrInjected.
+	PartialWriteRate float64
+
+	// MinLatency and MaxLatency specify the range of random delay added to each operation.
+	MinLatency time.Duration
+	MaxLatency time.Duration
+
+	// Seed initializes the random number generator, 0 uses the current time.
+	Seed int64
+}
+
+// IsEnabled returns true if the options inject any faults.
+func (o *Options) IsEnabled() bool {
+	return o.ErrorRate > 0 || o.PartialWriteRate > 0 || o.MaxLatency > 0
+}
+
+type chaosStorage struct {
+	base blob.Storage
+	opt  Options
+
+	mu  sync.Mutex
+	rnd *rand.Rand
+}
+
+func (s *chaosStorage) GetBlob(ctx context.Context, id blob.ID, offset, length int64) ([]byte, error) {
+	if err := s.beforeOperation(ctx, "GetBlob", id); err != nil {
+		return nil, err
+	}
+
+	return s.base.GetBlob(ctx, id, offset, length)
+}
+
+func (s *chaosStorage) PutBlob(ctx context.Context, id blob.ID, data []byte) error {
+	if err := s.beforeOperation(ctx, "PutBlob", id); err != nil {
+		return err
+	}
+
+	if n, ok := s.partialWriteLength(len(data)); ok {
+		log(ctx).Debugf("injecting partial write of %v (%v of %v bytes)", id, n, len(data))
+
+		if err := s.base.PutBlob(ctx, id, data[0:n]); err != nil {
+			return err
+		}
+
+		return ErrInjected
+	}
+
+	return s.base.PutBlob(ctx, id, data)
+}
+
+func (s *chaosStorage) PutBlobWithOptions(ctx context.Context, id blob.ID, data []byte, opt blob.PutOptions) error {
+	if err := s.beforeOperation(ctx, "PutBlobWithOptions", id); err != nil {
+		return err
+	}
+
+	return blob.PutBlobWithOptions(ctx, s.base, id, data, opt)
+}
+
+func (s *chaosStorage) SetStorageClass(ctx context.Context, id blob.ID, storageClass string) error {
+	if err := s.beforeOperation(ctx, "SetStorageClass", id); err != nil {
+		return err
+	}
+
+	return blob.SetStorageClass(ctx, s.base, id, storageClass)
+}
+
+func (s *chaosStorage) DeleteBlob(ctx context.Context, id blob.ID) error {
+	if err := s.beforeOperation(ctx, "DeleteBlob", id); err != nil {
+		return err
+	}
+
+	return s.base.DeleteBlob(ctx, id)
+}
+
+func (s *chaosStorage) ListBlobs(ctx context.Context, prefix blob.ID, callback func(blob.Metadata) error) error {
+	if err := s.beforeOperation(ctx, "ListBlobs", prefix); err != nil {
+		return err
+	}
+
+	return s.base.ListBlobs(ctx, prefix, callback)
+}
+
+func (s *chaosStorage) RestoreArchivedBlob(ctx context.Context, id blob.ID, days int) (bool, error) {
+	if err := s.beforeOperation(ctx, "RestoreArchivedBlob", id); err != nil {
+		return false, err
+	}
+
+	return blob.RestoreArchivedBlob(ctx, s.base, id, days)
+}
+
+func (s *chaosStorage) Close(ctx context.Context) error {
+	return s.base.Close(ctx)
+}
+
+func (s *chaosStorage) ConnectionInfo() blob.ConnectionInfo {
+	return s.base.ConnectionInfo()
+}
+
+// beforeOperation sleeps for a random latency and returns ErrInjected if the operation should fail.
+func (s *chaosStorage) beforeOperation(ctx context.Context, method string, id blob.ID) error {
+	s.mu.Lock()
+	latency := s.opt.MinLatency
+	if d := s.opt.MaxLatency - s.opt.MinLatency; d > 0 {
+		latency += time.Duration(s.rnd.Int63n(int64(d)))
+	}
+	fail := s.rnd.Float64() < s.opt.ErrorRate
+	s.mu.Unlock()
+
+	if latency > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(latency):
+		}
+	}
+
+	if fail {
+		log(ctx).Debugf("injecting failure of %v(%q)", method, id)
+		return ErrInjected
+	}
+
+	return nil
+}
+
+// partialWriteLength returns the number of bytes to write if the write should be partial.
+func (s *chaosStorage) partialWriteLength(length int) (int, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if length == 0 || s.rnd.Float64() >= s.opt.PartialWriteRate {
+		return 0, false
+	}
+
+	return s.rnd.Intn(length), true
+}
+
+// NewWrapper returns a Storage wrapper that injects faults according to the provided options.
+func NewWrapper(wrapped blob.Storage, opt Options) blob.Storage {
+	seed := opt.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano() // allow:no-inject-time
+	}
+
+	return &chaosStorage{
+		base: wrapped,
+		opt:  opt,
+		rnd:  rand.New(rand.NewSource(seed)), //nolint:gosec
+	}
+}
@@ -0,0 +1,50 @@
+package chaos
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kopia/kopia/internal/blobtesting"
+	"github.com/kopia/kopia/internal/testlogging"
+)
+
+func TestChaosStorageNoFaults(t *testing.T) {
+	ctx := testlogging.Context(t)
+	data := blobtesting.DataMap{}
+
+	st := NewWrapper(blobtesting.NewMapStorage(data, nil, nil), Options{
+		MaxLatency: time.Millisecond,
+	})
+
+	blobtesting.VerifyStorage(ctx, t, st)
+}
+
+func TestChaosStorageFaults(t *testing.T) {
+	ctx := testlogging.Context(t)
+	data := blobtesting.DataMap{}
+	base := blobtesting.NewMapStorage(data, nil, nil)
+
+	st := NewWrapper(base, Options{ErrorRate: 1, Seed: 1})
+
+	if err := st.PutBlob(ctx, "b1", []byte{1, 2, 3}); err != ErrInjected {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if _, err := st.GetBlob(ctx, "b1", 0, -1); err != ErrInjected {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if len(data) != 0 {
+		t.Errorf("failed write modified storage: %v", data)
+	}
+
+	st = NewWrapper(base, Options{PartialWriteRate: 1, Seed: 1})
+
+	if err := st.PutBlob(ctx, "b1", []byte{1, 2, 3, 4, 5, 6, 7, 8}); err != ErrInjected {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if got := len(data["b1"]); got >= 8 {
+		t.Errorf("write was not partial: %v bytes", got)
+	}
+}
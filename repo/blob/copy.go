@@ -0,0 +1,40 @@
+package blob
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+)
+
+// ErrServerSideCopyNotSupported is returned when a blob can't be copied between two storages without downloading it.
+var ErrServerSideCopyNotSupported = errors.New("server-side copy is not supported")
+
+// ServerSideCopier is implemented by storage providers which can copy blobs from another storage of the
+// same provider without transferring their data through the client, such as between two S3 buckets.
+type ServerSideCopier interface {
+	// CopyBlobFrom copies the blob from the source storage or returns ErrServerSideCopyNotSupported
+	// if the provider can't copy it directly.
+	CopyBlobFrom(ctx context.Context, src Storage, blobID ID) error
+}
+
+// CopyBlob copies the blob to the destination storage, using server-side copy when it's supported
+// and otherwise downloading and uploading the blob. It returns true if server-side copy was used.
+func CopyBlob(ctx context.Context, dst, src Storage, blobID ID) (bool, error) {
+	if c, ok := dst.(ServerSideCopier); ok {
+		err := c.CopyBlobFrom(ctx, src, blobID)
+		if err == nil {
+			return true, nil
+		}
+
+		if !errors.Is(err, ErrServerSideCopyNotSupported) {
+			return false, err
+		}
+	}
+
+	data, err := src.GetBlob(ctx, blobID, 0, -1)
+	if err != nil {
+		return false, err
+	}
+
+	return false, dst.PutBlob(ctx, blobID, data)
+}
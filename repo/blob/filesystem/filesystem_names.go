@@ -0,0 +1,97 @@
+package filesystem
+
+import (
+	"context"
+	"strings"
+
+	"github.com/kopia/kopia/repo/blob"
+)
+
+// fsNameEscape marks upper-case letters in names of files on case-insensitive SMB shares.
+const fsNameEscape = '_'
+
+// encodeBlobID returns the ID under which the blob is stored in files, which on SMB shares doesn't contain
+// upper-case letters, so that blob IDs differing only in case don't map to the same file.
+// Each character is encoded separately, so encoded prefixes of blob IDs are prefixes of encoded blob IDs.
+func (fs *fsStorage) encodeBlobID(id blob.ID) blob.ID {
+	if !fs.Impl.(*fsImpl).SMB || strings.IndexFunc(string(id), needsEscaping) < 0 {
+		return id
+	}
+
+	var sb strings.Builder
+
+	for _, r := range id {
+		if needsEscaping(r) {
+			sb.WriteRune(fsNameEscape)
+		}
+
+		sb.WriteRune(toLower(r))
+	}
+
+	return blob.ID(sb.String())
+}
+
+// decodeBlobID reverses encodeBlobID. Unescaped upper-case letters in names returned
+// by servers which don't preserve case are treated as lower-case.
+func (fs *fsStorage) decodeBlobID(id blob.ID) blob.ID {
+	if !fs.Impl.(*fsImpl).SMB {
+		return id
+	}
+
+	var (
+		sb      strings.Builder
+		escaped bool
+	)
+
+	for _, r := range id {
+		switch {
+		case escaped:
+			escaped = false
+
+			if r != fsNameEscape {
+				r -= 'a' - 'A'
+			}
+
+			sb.WriteRune(r)
+
+		case r == fsNameEscape:
+			escaped = true
+
+		default:
+			sb.WriteRune(toLower(r))
+		}
+	}
+
+	return blob.ID(sb.String())
+}
+
+func needsEscaping(r rune) bool {
+	return r == fsNameEscape || ('A' <= r && r <= 'Z')
+}
+
+func toLower(r rune) rune {
+	if 'A' <= r && r <= 'Z' {
+		return r + 'a' - 'A'
+	}
+
+	return r
+}
+
+func (fs *fsStorage) GetBlob(ctx context.Context, blobID blob.ID, offset, length int64) ([]byte, error) {
+	return fs.Storage.GetBlob(ctx, fs.encodeBlobID(blobID), offset, length)
+}
+
+func (fs *fsStorage) PutBlob(ctx context.Context, blobID blob.ID, data []byte) error {
+	return fs.Storage.PutBlob(ctx, fs.encodeBlobID(blobID), data)
+}
+
+func (fs *fsStorage) DeleteBlob(ctx context.Context, blobID blob.ID) error {
+	return fs.Storage.DeleteBlob(ctx, fs.encodeBlobID(blobID))
+}
+
+func (fs *fsStorage) ListBlobs(ctx context.Context, prefix blob.ID, callback func(blob.Metadata) error) error {
+	return fs.Storage.ListBlobs(ctx, fs.encodeBlobID(prefix), func(bm blob.Metadata) error {
+		bm.BlobID = fs.decodeBlobID(bm.BlobID)
+		return callback(bm)
+	})
+}
@@ -0,0 +1,31 @@
+// +build !windows
+
+package filesystem
+
+import (
+	"os"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// syncDirectory makes changes to entries of the directory durable.
+// Filesystems which don't support syncing directories, such as some network filesystems, are ignored.
+func syncDirectory(dirname string) error {
+	d, err := os.Open(dirname) //nolint:gosec
+	if err != nil {
+		return err
+	}
+	defer d.Close() //nolint:errcheck
+
+	if err := d.Sync(); err != nil && !errors.Is(err, syscall.EINVAL) && !errors.Is(err, syscall.ENOTSUP) {
+		return err
+	}
+
+	return nil
+}
+
+// isOutOfSpace returns true if the error indicates that the filesystem is full or the disk quota is exceeded.
+func isOutOfSpace(err error) bool {
+	return errors.Is(err, syscall.ENOSPC) || errors.Is(err, syscall.EDQUOT)
+}
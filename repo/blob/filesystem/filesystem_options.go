@@ -13,6 +13,14 @@ type Options struct {
 
 	FileUID *int `json:"uid,omitempty"`
 	FileGID *int `json:"gid,omitempty"`
+
+	// SMB adapts the storage to SMB/CIFS mounts: existing files are removed before being replaced by rename,
+	// errors are retried while the share is disconnected and file names are made safe for case-insensitive servers.
+	SMB bool `json:"smb,omitempty"`
+
+	// BasicOperationsOnly avoids exclusive file creation, syncing directories and updating file times,
+	// which are unsupported by some NAS servers.
+	BasicOperationsOnly bool `json:"basicOperationsOnly,omitempty"`
 }
 
 func (fso *Options) fileMode() os.FileMode {
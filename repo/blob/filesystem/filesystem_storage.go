@@ -9,10 +9,12 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/pkg/errors"
 
+	"github.com/kopia/kopia/internal/clock"
 	"github.com/kopia/kopia/internal/retry"
 	"github.com/kopia/kopia/repo/blob"
 	"github.com/kopia/kopia/repo/blob/sharded"
@@ -27,6 +29,12 @@ const (
 
 	fsDefaultFileMode os.FileMode = 0600
 	fsDefaultDirMode  os.FileMode = 0700
+
+	// fsTempFileInfix separates the name of the blob file from the random suffix of its temporary file.
+	fsTempFileInfix = ".tmp."
+
+	// fsOrphanedTempFileAge is the age after which temporary files are assumed to be left behind by interrupted writes.
+	fsOrphanedTempFileAge = time.Hour
 )
 
 var fsDefaultShards = []int{3, 3}
@@ -44,6 +52,10 @@ func isRetriable(err error) bool {
 		return false
 	}
 
+	if errors.Is(err, blob.ErrStorageFull) {
+		return false
+	}
+
 	err = errors.Cause(err)
 
 	if os.IsNotExist(err) {
@@ -57,11 +69,32 @@ func isRetriable(err error) bool {
 	return true
 }
 
+// isRetriable returns true if the error is retriable. When the SMB share is disconnected, files
+// appear to be missing, so such errors are retried as long as the storage path is inaccessible.
+func (fs *fsImpl) isRetriable(err error) bool {
+	if isRetriable(err) {
+		return true
+	}
+
+	return os.IsNotExist(errors.Cause(err)) && fs.shareDisconnected()
+}
+
+// shareDisconnected returns true if the storage is on an SMB share which is currently inaccessible.
+func (fs *fsImpl) shareDisconnected() bool {
+	if !fs.SMB {
+		return false
+	}
+
+	_, err := os.Stat(fs.Path)
+
+	return err != nil
+}
+
 func (fs *fsImpl) GetBlobFromPath(ctx context.Context, dirPath, path string, offset, length int64) ([]byte, error) {
 	val, err := retry.WithExponentialBackoff(ctx, "GetBlobFromPath:"+path, func() (interface{}, error) {
 		f, err := os.Open(path) //nolint:gosec
 		return f, err
-	}, isRetriable)
+	}, fs.isRetriable)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return nil, blob.ErrBlobNotFound
@@ -111,22 +144,24 @@ func (fs *fsImpl) PutBlobInPath(ctx context.Context, dirPath, path string, data
 			defer progressCallback(path, int64(len(data)), int64(len(data)))
 		}
 
-		tempFile := fmt.Sprintf("%s.tmp.%x", path, randSuffix)
+		tempFile := fmt.Sprintf("%s%s%x", path, fsTempFileInfix, randSuffix)
 
-		f, err := fs.createTempFileAndDir(tempFile)
+		f, err := fs.createTempFileAndDir(ctx, tempFile)
 		if err != nil {
-			return errors.Wrap(err, "cannot create temporary file")
+			return storageFullOr(errors.Wrap(err, "cannot create temporary file"), fs.Path)
 		}
 
-		if _, err = f.Write(data); err != nil {
-			return errors.Wrap(err, "can't write temporary file")
-		}
+		// the data must be durable before the rename makes it visible, otherwise power loss
+		// could leave a torn blob under the final name.
+		if err = writeAndSync(f, data); err != nil {
+			if removeErr := os.Remove(tempFile); removeErr != nil {
+				log(ctx).Warningf("can't remove temp file: %v", removeErr)
+			}
 
-		if err = f.Close(); err != nil {
-			return errors.Wrap(err, "can't close temporary file")
+			return storageFullOr(err, fs.Path)
 		}
 
-		err = os.Rename(tempFile, path)
+		err = fs.renameFile(tempFile, path)
 		if err != nil {
 			if removeErr := os.Remove(tempFile); removeErr != nil {
 				log(ctx).Warningf("can't remove temp file: %v", removeErr)
@@ -135,6 +170,10 @@ func (fs *fsImpl) PutBlobInPath(ctx context.Context, dirPath, path string, data
 			return err
 		}
 
+		if err = fs.syncDirectory(dirPath); err != nil {
+			return errors.Wrap(err, "can't sync directory")
+		}
+
 		if fs.FileUID != nil && fs.FileGID != nil && os.Geteuid() == 0 {
 			if chownErr := os.Chown(path, *fs.FileUID, *fs.FileGID); chownErr != nil {
 				log(ctx).Warningf("can't change file permissions: %v", chownErr)
@@ -142,18 +181,81 @@ func (fs *fsImpl) PutBlobInPath(ctx context.Context, dirPath, path string, data
 		}
 
 		return nil
-	}, isRetriable)
+	}, fs.isRetriable)
+}
+
+// storageFullOr returns blob.ErrStorageFull if the error was caused by the filesystem running out of space,
+// which is not retried, otherwise it returns the error.
+func storageFullOr(err error, path string) error {
+	if !isOutOfSpace(err) {
+		return err
+	}
+
+	return errors.Wrapf(blob.ErrStorageFull, "no space left in %v (%v)", path, errors.Cause(err))
+}
+
+// renameFile renames the file, replacing the existing file if the filesystem doesn't support it, such as SMB shares.
+func (fs *fsImpl) renameFile(oldPath, newPath string) error {
+	err := os.Rename(oldPath, newPath)
+	if err == nil || !fs.SMB {
+		return err
+	}
+
+	if _, statErr := os.Stat(newPath); statErr != nil {
+		return err
+	}
+
+	if removeErr := os.Remove(newPath); removeErr != nil {
+		return err
+	}
+
+	return os.Rename(oldPath, newPath)
+}
+
+func (fs *fsImpl) syncDirectory(dirname string) error {
+	if fs.BasicOperationsOnly {
+		return nil
+	}
+
+	return syncDirectory(dirname)
 }
 
-func (fs *fsImpl) createTempFileAndDir(tempFile string) (*os.File, error) {
+func writeAndSync(f *os.File, data []byte) error {
+	if _, err := f.Write(data); err != nil {
+		f.Close() //nolint:errcheck
+		return errors.Wrap(err, "can't write temporary file")
+	}
+
+	if err := f.Sync(); err != nil {
+		f.Close() //nolint:errcheck
+		return errors.Wrap(err, "can't sync temporary file")
+	}
+
+	return errors.Wrap(f.Close(), "can't close temporary file")
+}
+
+func (fs *fsImpl) createTempFileAndDir(ctx context.Context, tempFile string) (*os.File, error) {
 	flags := os.O_CREATE | os.O_WRONLY | os.O_EXCL
+	if fs.BasicOperationsOnly {
+		// temporary file names are random, so they are only truncated in case of a collision.
+		flags = os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	}
 
 	f, err := os.OpenFile(tempFile, flags, fs.fileMode())
 	if os.IsNotExist(err) {
-		if err = os.MkdirAll(filepath.Dir(tempFile), fs.dirMode()); err != nil {
+		dir := filepath.Dir(tempFile)
+
+		if err = os.MkdirAll(dir, fs.dirMode()); err != nil {
 			return nil, errors.Wrap(err, "cannot create directory")
 		}
 
+		// make entries of newly created shard directories durable in their parents.
+		for d := dir; len(d) > len(fs.Path); d = filepath.Dir(d) {
+			if err := fs.syncDirectory(filepath.Dir(d)); err != nil {
+				log(ctx).Warningf("can't sync directory %v: %v", filepath.Dir(d), err)
+			}
+		}
+
 		return os.OpenFile(tempFile, flags, fs.fileMode())
 	}
 
@@ -163,30 +265,61 @@ func (fs *fsImpl) createTempFileAndDir(tempFile string) (*os.File, error) {
 func (fs *fsImpl) DeleteBlobInPath(ctx context.Context, dirPath, path string) error {
 	return retry.WithExponentialBackoffNoValue(ctx, "DeleteBlobInPath:"+path, func() error {
 		err := os.Remove(path)
-		if err == nil || os.IsNotExist(err) {
+		if err == nil || (os.IsNotExist(err) && !fs.shareDisconnected()) {
 			return nil
 		}
 
 		return err
-	}, isRetriable)
+	}, fs.isRetriable)
 }
 
 func (fs *fsImpl) ReadDir(ctx context.Context, dirname string) ([]os.FileInfo, error) {
 	v, err := retry.WithExponentialBackoff(ctx, "ReadDir:"+dirname, func() (interface{}, error) {
 		v, err := ioutil.ReadDir(dirname)
 		return v, err
-	}, isRetriable)
+	}, fs.isRetriable)
 
 	if err != nil {
 		return nil, err
 	}
 
-	return v.([]os.FileInfo), nil
+	return fs.removeOrphanedTempFiles(ctx, dirname, v.([]os.FileInfo)), nil
+}
+
+// removeOrphanedTempFiles removes temporary files left behind by writes interrupted by a crash or power loss
+// and returns the remaining entries. Recent temporary files may belong to writes in progress and are kept.
+func (fs *fsImpl) removeOrphanedTempFiles(ctx context.Context, dirname string, entries []os.FileInfo) []os.FileInfo {
+	now := clock.Now()
+
+	var result []os.FileInfo
+
+	for _, e := range entries {
+		if e.IsDir() || !strings.Contains(e.Name(), fsStorageChunkSuffix+fsTempFileInfix) {
+			result = append(result, e)
+			continue
+		}
+
+		if !clock.OlderThan(now, e.ModTime(), fsOrphanedTempFileAge) {
+			continue
+		}
+
+		log(ctx).Debugf("removing orphaned temporary file %v", e.Name())
+
+		if err := os.Remove(filepath.Join(dirname, e.Name())); err != nil && !os.IsNotExist(err) {
+			log(ctx).Warningf("can't remove orphaned temporary file: %v", err)
+		}
+	}
+
+	return result
 }
 
 // TouchBlob updates file modification time to current time if it's sufficiently old.
 func (fs *fsStorage) TouchBlob(ctx context.Context, blobID blob.ID, threshold time.Duration) error {
-	_, path := fs.Storage.GetShardedPathAndFilePath(blobID)
+	if fs.Impl.(*fsImpl).BasicOperationsOnly {
+		return nil
+	}
+
+	_, path := fs.Storage.GetShardedPathAndFilePath(fs.encodeBlobID(blobID))
 
 	st, err := os.Stat(path)
 	if err != nil {
@@ -3,15 +3,20 @@ package filesystem
 import (
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"reflect"
 	"runtime"
 	"sort"
+	"syscall"
 	"testing"
 	"time"
 
+	"github.com/pkg/errors"
+
 	"github.com/kopia/kopia/repo/blob"
 
 	"github.com/kopia/kopia/internal/blobtesting"
+	"github.com/kopia/kopia/internal/clock"
 	"github.com/kopia/kopia/internal/testlogging"
 )
 
@@ -127,6 +132,124 @@ func TestFileStorageConcurrency(t *testing.T) {
 	})
 }
 
+func TestFileStorageOrphanedTempFiles(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	path, _ := ioutil.TempDir("", "fs-orphaned")
+	defer os.RemoveAll(path)
+
+	st, err := New(ctx, &Options{
+		Path:            path,
+		DirectoryShards: []int{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertNoError(t, st.PutBlob(ctx, "someblob1234567", []byte{1, 2, 3}))
+
+	// successful writes don't leave temporary files behind.
+	assertDirectoryEntries(t, path, "someblob1234567.f")
+
+	orphaned := filepath.Join(path, "someblob2234567.f"+fsTempFileInfix+"0123")
+	inProgress := filepath.Join(path, "someblob3234567.f"+fsTempFileInfix+"4567")
+
+	assertNoError(t, ioutil.WriteFile(orphaned, []byte{1}, fsDefaultFileMode))
+	assertNoError(t, ioutil.WriteFile(inProgress, []byte{1}, fsDefaultFileMode))
+
+	old := time.Now().Add(-2*fsOrphanedTempFileAge - clock.MaxSkew)
+	assertNoError(t, os.Chtimes(orphaned, old, old))
+
+	blobs, err := blob.ListAllBlobs(ctx, st, "")
+	assertNoError(t, err)
+
+	if len(blobs) != 1 || blobs[0].BlobID != "someblob1234567" {
+		t.Errorf("unexpected blobs: %v", blobs)
+	}
+
+	// listing removes the orphaned temporary file, but not the one which may be still written.
+	assertDirectoryEntries(t, path, "someblob1234567.f", filepath.Base(inProgress))
+}
+
+func TestFileStorageSMB(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	path, _ := ioutil.TempDir("", "fs-smb")
+	defer os.RemoveAll(path)
+
+	st, err := New(ctx, &Options{
+		Path:                path,
+		DirectoryShards:     []int{},
+		SMB:                 true,
+		BasicOperationsOnly: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blobtesting.VerifyStorage(ctx, t, st)
+
+	// blob IDs differing only in case are stored in different files.
+	assertNoError(t, st.PutBlob(ctx, "someBlob_1234567", []byte{1}))
+	assertNoError(t, st.PutBlob(ctx, "someblob_1234567", []byte{2}))
+
+	blobtesting.AssertGetBlob(ctx, t, st, "someBlob_1234567", []byte{1})
+	blobtesting.AssertGetBlob(ctx, t, st, "someblob_1234567", []byte{2})
+
+	blobs, err := blob.ListAllBlobs(ctx, st, "someB")
+	assertNoError(t, err)
+
+	if len(blobs) != 1 || blobs[0].BlobID != "someBlob_1234567" {
+		t.Errorf("unexpected blobs: %v", blobs)
+	}
+
+	for _, name := range []string{"some_blob__1234567.f", "someblob__1234567.f"} {
+		if _, err := os.Stat(filepath.Join(path, name)); err != nil {
+			t.Errorf("file %v not found: %v", name, err)
+		}
+	}
+}
+
+func TestFileStorageSMBRenameOverExisting(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "fs-smb-rename")
+	defer os.RemoveAll(dir)
+
+	fs := &fsImpl{Options: Options{Path: dir, SMB: true}}
+
+	// renaming a file over a directory fails even on filesystems that replace existing files.
+	src := filepath.Join(dir, "src")
+	dst := filepath.Join(dir, "dst")
+
+	assertNoError(t, ioutil.WriteFile(src, []byte{1}, fsDefaultFileMode))
+	assertNoError(t, os.Mkdir(dst, fsDefaultDirMode))
+
+	assertNoError(t, fs.renameFile(src, dst))
+
+	if data, err := ioutil.ReadFile(dst); err != nil || !reflect.DeepEqual(data, []byte{1}) {
+		t.Errorf("unexpected contents of renamed file: %v %v", data, err)
+	}
+}
+
+func assertDirectoryEntries(t *testing.T, dir string, want ...string) {
+	t.Helper()
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("unable to read directory: %v", err)
+	}
+
+	var got []string
+	for _, e := range entries {
+		got = append(got, e.Name())
+	}
+
+	sort.Strings(want)
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected directory entries: %v, want %v", got, want)
+	}
+}
+
 func verifyBlobTimestampOrder(t *testing.T, st blob.Storage, want ...blob.ID) {
 	blobs, err := blob.ListAllBlobs(testlogging.Context(t), st, "")
 	if err != nil {
@@ -155,3 +278,21 @@ func assertNoError(t *testing.T, err error) {
 		t.Errorf("err: %v", err)
 	}
 }
+
+func TestFileStorageFullError(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("out-of-space errors are different on windows")
+	}
+
+	outOfSpace := errors.Wrap(&os.PathError{Op: "write", Path: "some-file", Err: syscall.ENOSPC}, "can't write temporary file")
+
+	if err := storageFullOr(outOfSpace, "some-path"); !errors.Is(err, blob.ErrStorageFull) {
+		t.Errorf("unexpected error: %v, want storage full", err)
+	}
+
+	other := &os.PathError{Op: "write", Path: "some-file", Err: syscall.EIO}
+
+	if err := storageFullOr(other, "some-path"); err != other {
+		t.Errorf("unexpected error: %v, want %v", err, other)
+	}
+}
@@ -0,0 +1,23 @@
+package filesystem
+
+import (
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	errorHandleDiskFull syscall.Errno = 39   // ERROR_HANDLE_DISK_FULL
+	errorDiskFull       syscall.Errno = 112  // ERROR_DISK_FULL
+	errorDiskQuota      syscall.Errno = 1295 // ERROR_DISK_QUOTA_EXCEEDED
+)
+
+// syncDirectory is a no-op on Windows, which doesn't support syncing directories.
+func syncDirectory(dirname string) error {
+	return nil
+}
+
+// isOutOfSpace returns true if the error indicates that the disk is full or the disk quota is exceeded.
+func isOutOfSpace(err error) bool {
+	return errors.Is(err, errorHandleDiskFull) || errors.Is(err, errorDiskFull) || errors.Is(err, errorDiskQuota)
+}
@@ -1,6 +1,10 @@
 package gcs
 
-import "encoding/json"
+import (
+	"encoding/json"
+
+	"github.com/kopia/kopia/repo/blob"
+)
 
 // Options defines options Google Cloud Storage-backed storage.
 type Options struct {
@@ -16,9 +20,14 @@ type Options struct {
 	// ServiceAccountCredentialJSON specifies the raw JSON credentials.
 	ServiceAccountCredentialJSON json.RawMessage `kopia:"sensitive" json:"credentials,omitempty"`
 
+	// CredentialsCommand specifies the command used to obtain OAuth tokens instead of service account credentials.
+	CredentialsCommand string `json:"credentialsCommand,omitempty"`
+
 	// ReadOnly causes GCS connection to be opened with read-only scope to prevent accidental mutations.
 	ReadOnly bool `json:"readOnly,omitempty"`
 
+	blob.TransportOptions
+
 	MaxUploadSpeedBytesPerSecond int `json:"maxUploadSpeedBytesPerSecond,omitempty"`
 
 	MaxDownloadSpeedBytesPerSecond int `json:"maxDownloadSpeedBytesPerSecond,omitempty"`
@@ -7,6 +7,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"net/http"
 	"time"
 
 	"github.com/efarrer/iothrottler"
@@ -17,6 +18,7 @@ import (
 	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
 
+	"github.com/kopia/kopia/internal/credexec"
 	"github.com/kopia/kopia/internal/iocopy"
 	"github.com/kopia/kopia/internal/retry"
 	"github.com/kopia/kopia/internal/throttle"
@@ -223,6 +225,29 @@ func tokenSourceFromCredentialsJSON(ctx context.Context, data json.RawMessage, s
 	return cfg.TokenSource(ctx), nil
 }
 
+// execTokenSource implements oauth2.TokenSource by running an external command.
+type execTokenSource struct {
+	ctx     context.Context
+	command string
+}
+
+func (s execTokenSource) Token() (*oauth2.Token, error) {
+	c, err := credexec.Run(s.ctx, s.command)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.Token == "" {
+		return nil, errors.New("credentials command did not return a token")
+	}
+
+	return &oauth2.Token{
+		AccessToken: c.Token,
+		TokenType:   "Bearer",
+		Expiry:      c.RefreshAfter(),
+	}, nil
+}
+
 // New creates new Google Cloud Storage-backed storage with specified options:
 //
 // - the 'BucketName' field is required and all other parameters are optional.
@@ -234,12 +259,24 @@ func New(ctx context.Context, opt *Options) (blob.Storage, error) {
 
 	var err error
 
+	if !opt.TransportOptions.IsDefault() {
+		t, err := opt.TransportOptions.NewTransport(false)
+		if err != nil {
+			return nil, err
+		}
+
+		// oauth2 uses the client from the context both to obtain tokens and as the base of the returned client.
+		ctx = context.WithValue(ctx, oauth2.HTTPClient, &http.Client{Transport: t})
+	}
+
 	scope := gcsclient.ScopeReadWrite
 	if opt.ReadOnly {
 		scope = gcsclient.ScopeReadOnly
 	}
 
-	if sa := opt.ServiceAccountCredentialJSON; len(sa) > 0 {
+	if cmd := opt.CredentialsCommand; cmd != "" {
+		ts = oauth2.ReuseTokenSource(nil, execTokenSource{ctx, cmd})
+	} else if sa := opt.ServiceAccountCredentialJSON; len(sa) > 0 {
 		ts, err = tokenSourceFromCredentialsJSON(ctx, sa, scope)
 	} else if sa := opt.ServiceAccountCredentialsFile; sa != "" {
 		ts, err = tokenSourceFromCredentialsFile(ctx, sa, scope)
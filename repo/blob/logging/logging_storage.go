@@ -39,6 +39,24 @@ func (s *loggingStorage) PutBlob(ctx context.Context, id blob.ID, data []byte) e
 	return err
 }
 
+func (s *loggingStorage) PutBlobWithOptions(ctx context.Context, id blob.ID, data []byte, opt blob.PutOptions) error {
+	t0 := time.Now()
+	err := blob.PutBlobWithOptions(ctx, s.base, id, data, opt)
+	dt := time.Since(t0)
+	s.printf(s.prefix+"PutBlobWithOptions(%q,len=%v,%+v)=%#v took %v", id, len(data), opt, err, dt)
+
+	return err
+}
+
+func (s *loggingStorage) SetStorageClass(ctx context.Context, id blob.ID, storageClass string) error {
+	t0 := time.Now()
+	err := blob.SetStorageClass(ctx, s.base, id, storageClass)
+	dt := time.Since(t0)
+	s.printf(s.prefix+"SetStorageClass(%q,%q)=%#v took %v", id, storageClass, err, dt)
+
+	return err
+}
+
 func (s *loggingStorage) DeleteBlob(ctx context.Context, id blob.ID) error {
 	t0 := time.Now()
 	err := s.base.DeleteBlob(ctx, id)
@@ -60,6 +78,15 @@ func (s *loggingStorage) ListBlobs(ctx context.Context, prefix blob.ID, callback
 	return err
 }
 
+func (s *loggingStorage) RestoreArchivedBlob(ctx context.Context, id blob.ID, days int) (bool, error) {
+	t0 := time.Now()
+	ready, err := blob.RestoreArchivedBlob(ctx, s.base, id, days)
+	dt := time.Since(t0)
+	s.printf(s.prefix+"RestoreArchivedBlob(%q,%v)=(%v, %#v) took %v", id, days, ready, err, dt)
+
+	return ready, err
+}
+
 func (s *loggingStorage) Close(ctx context.Context) error {
 	t0 := time.Now()
 	err := s.base.Close(ctx)
@@ -0,0 +1,217 @@
+// Package memory implements in-memory Storage, which is useful for embedding and for testing code
+// that uses repositories without touching the disk.
+package memory
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kopia/kopia/repo/blob"
+)
+
+// DataMap is a map of blob ID to their contents.
+type DataMap map[blob.ID][]byte
+
+// Storage is an implementation of blob.Storage which keeps all blobs in memory.
+type Storage struct {
+	data    DataMap
+	keyTime map[blob.ID]time.Time
+	timeNow func() time.Time
+	mutex   sync.RWMutex
+}
+
+// GetBlob implements blob.Storage.
+func (s *Storage) GetBlob(ctx context.Context, id blob.ID, offset, length int64) ([]byte, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	data, ok := s.data[id]
+	if ok {
+		data = append([]byte(nil), data...)
+
+		if length < 0 {
+			return data, nil
+		}
+
+		if int(offset) > len(data) || offset < 0 {
+			return nil, errors.New("invalid offset")
+		}
+
+		data = data[offset:]
+		if int(length) > len(data) {
+			return nil, errors.New("invalid length")
+		}
+
+		return data[0:length], nil
+	}
+
+	return nil, blob.ErrBlobNotFound
+}
+
+// PutBlob implements blob.Storage.
+func (s *Storage) PutBlob(ctx context.Context, id blob.ID, data []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, ok := s.data[id]; ok {
+		return nil
+	}
+
+	s.keyTime[id] = s.timeNow()
+
+	s.data[id] = append([]byte{}, data...)
+
+	return nil
+}
+
+// DeleteBlob implements blob.Storage.
+func (s *Storage) DeleteBlob(ctx context.Context, id blob.ID) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.data, id)
+	delete(s.keyTime, id)
+
+	return nil
+}
+
+// ListBlobs implements blob.Storage.
+func (s *Storage) ListBlobs(ctx context.Context, prefix blob.ID, callback func(blob.Metadata) error) error {
+	s.mutex.RLock()
+
+	keys := []blob.ID{}
+
+	for k := range s.data {
+		if strings.HasPrefix(string(k), string(prefix)) {
+			keys = append(keys, k)
+		}
+	}
+
+	s.mutex.RUnlock()
+
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i] < keys[j]
+	})
+
+	for _, k := range keys {
+		s.mutex.RLock()
+		v, ok := s.data[k]
+		ts := s.keyTime[k]
+		s.mutex.RUnlock()
+
+		if !ok {
+			continue
+		}
+
+		if err := callback(blob.Metadata{
+			BlobID:    k,
+			Length:    int64(len(v)),
+			Timestamp: ts,
+		}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Close implements blob.Storage.
+func (s *Storage) Close(ctx context.Context) error {
+	return nil
+}
+
+// TouchBlob updates the timestamp of the blob if it is older than the threshold.
+func (s *Storage) TouchBlob(ctx context.Context, blobID blob.ID, threshold time.Duration) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if v, ok := s.keyTime[blobID]; ok {
+		n := s.timeNow()
+		if n.Sub(v) >= threshold {
+			s.keyTime[blobID] = n
+		}
+	}
+
+	return nil
+}
+
+// ConnectionInfo implements blob.Storage.
+func (s *Storage) ConnectionInfo() blob.ConnectionInfo {
+	// unsupported
+	return blob.ConnectionInfo{}
+}
+
+// Snapshot represents the contents of Storage at a point in time.
+type Snapshot struct {
+	data    DataMap
+	keyTime map[blob.ID]time.Time
+}
+
+// Snapshot captures the current contents of the storage, which can be later restored using Restore().
+func (s *Storage) Snapshot() *Snapshot {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	snap := &Snapshot{
+		data:    DataMap{},
+		keyTime: map[blob.ID]time.Time{},
+	}
+
+	for k, v := range s.data {
+		snap.data[k] = append([]byte(nil), v...)
+	}
+
+	for k, v := range s.keyTime {
+		snap.keyTime[k] = v
+	}
+
+	return snap
+}
+
+// Restore rolls back the contents of the storage to the provided snapshot.
+func (s *Storage) Restore(snap *Snapshot) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// modify maps in place, since they may be shared with the creator of the storage.
+	for k := range s.data {
+		delete(s.data, k)
+	}
+
+	for k := range s.keyTime {
+		delete(s.keyTime, k)
+	}
+
+	for k, v := range snap.data {
+		s.data[k] = append([]byte(nil), v...)
+	}
+
+	for k, v := range snap.keyTime {
+		s.keyTime[k] = v
+	}
+}
+
+// New returns new empty in-memory storage.
+func New() *Storage {
+	return NewWithData(DataMap{}, nil, nil)
+}
+
+// NewWithData returns in-memory storage backed by the contents of given map, which may be
+// accessed directly by the caller when the storage is not in use.
+func NewWithData(data DataMap, keyTime map[blob.ID]time.Time, timeNow func() time.Time) *Storage {
+	if keyTime == nil {
+		keyTime = make(map[blob.ID]time.Time)
+	}
+
+	if timeNow == nil {
+		timeNow = time.Now
+	}
+
+	return &Storage{data: data, keyTime: keyTime, timeNow: timeNow}
+}
+
+var _ blob.Storage = (*Storage)(nil)
@@ -0,0 +1,46 @@
+package memory_test
+
+import (
+	"testing"
+
+	"github.com/kopia/kopia/internal/blobtesting"
+	"github.com/kopia/kopia/internal/testlogging"
+	"github.com/kopia/kopia/repo/blob/memory"
+)
+
+func TestMemoryStorage(t *testing.T) {
+	blobtesting.VerifyStorage(testlogging.Context(t), t, memory.New())
+}
+
+func TestMemoryStorageSnapshotRestore(t *testing.T) {
+	ctx := testlogging.Context(t)
+	st := memory.New()
+
+	if err := st.PutBlob(ctx, "a", []byte{1, 2, 3, 4}); err != nil {
+		t.Fatalf("unable to write blob: %v", err)
+	}
+
+	snap := st.Snapshot()
+
+	if err := st.PutBlob(ctx, "b", []byte{5, 6, 7, 8}); err != nil {
+		t.Fatalf("unable to write blob: %v", err)
+	}
+
+	if err := st.DeleteBlob(ctx, "a"); err != nil {
+		t.Fatalf("unable to delete blob: %v", err)
+	}
+
+	st.Restore(snap)
+
+	blobtesting.AssertGetBlob(ctx, t, st, "a", []byte{1, 2, 3, 4})
+	blobtesting.AssertGetBlobNotFound(ctx, t, st, "b")
+
+	// snapshot can be restored multiple times.
+	if err := st.PutBlob(ctx, "c", []byte{7}); err != nil {
+		t.Fatalf("unable to write blob: %v", err)
+	}
+
+	st.Restore(snap)
+
+	blobtesting.AssertListResults(ctx, t, st, "", "a")
+}
@@ -0,0 +1,53 @@
+// Package offline implements Storage that is never accessible, used when opening repositories
+// using only locally cached data.
+package offline
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo/blob"
+)
+
+// ErrOffline is returned by all operations that would require access to the storage.
+var ErrOffline = errors.New("storage is not accessible in offline mode")
+
+type offlineStorage struct {
+	ci blob.ConnectionInfo
+}
+
+func (s *offlineStorage) GetBlob(ctx context.Context, id blob.ID, offset, length int64) ([]byte, error) {
+	return nil, errors.Wrapf(ErrOffline, "unable to read %v", id)
+}
+
+func (s *offlineStorage) PutBlob(ctx context.Context, id blob.ID, data []byte) error {
+	return errors.Wrapf(ErrOffline, "unable to write %v", id)
+}
+
+func (s *offlineStorage) DeleteBlob(ctx context.Context, id blob.ID) error {
+	return errors.Wrapf(ErrOffline, "unable to delete %v", id)
+}
+
+func (s *offlineStorage) ListBlobs(ctx context.Context, prefix blob.ID, callback func(blob.Metadata) error) error {
+	return errors.Wrapf(ErrOffline, "unable to list %v", prefix)
+}
+
+func (s *offlineStorage) ConnectionInfo() blob.ConnectionInfo {
+	return s.ci
+}
+
+func (s *offlineStorage) Close(ctx context.Context) error {
+	return nil
+}
+
+// NewStorage returns Storage for the provided connection info, which fails all operations with ErrOffline.
+func NewStorage(ci blob.ConnectionInfo) blob.Storage {
+	return &offlineStorage{ci}
+}
+
+// IsOffline returns true if the provided storage was returned by NewStorage.
+func IsOffline(st blob.Storage) bool {
+	_, ok := st.(*offlineStorage)
+	return ok
+}
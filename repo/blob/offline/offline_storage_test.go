@@ -0,0 +1,45 @@
+package offline
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/blobtesting"
+	"github.com/kopia/kopia/internal/testlogging"
+	"github.com/kopia/kopia/repo/blob"
+)
+
+func TestOfflineStorage(t *testing.T) {
+	ctx := testlogging.Context(t)
+	ci := blob.ConnectionInfo{Type: "filesystem"}
+	st := NewStorage(ci)
+
+	if _, err := st.GetBlob(ctx, "b1", 0, -1); !errors.Is(err, ErrOffline) {
+		t.Errorf("unexpected GetBlob error: %v", err)
+	}
+
+	if err := st.PutBlob(ctx, "b1", []byte{1}); !errors.Is(err, ErrOffline) {
+		t.Errorf("unexpected PutBlob error: %v", err)
+	}
+
+	if err := st.DeleteBlob(ctx, "b1"); !errors.Is(err, ErrOffline) {
+		t.Errorf("unexpected DeleteBlob error: %v", err)
+	}
+
+	if _, err := blob.ListAllBlobs(ctx, st, ""); !errors.Is(err, ErrOffline) {
+		t.Errorf("unexpected ListBlobs error: %v", err)
+	}
+
+	if got := st.ConnectionInfo(); got.Type != ci.Type {
+		t.Errorf("unexpected connection info: %v", got)
+	}
+
+	if !IsOffline(st) {
+		t.Errorf("storage is not offline")
+	}
+
+	if IsOffline(blobtesting.NewMapStorage(blobtesting.DataMap{}, nil, nil)) {
+		t.Errorf("map storage is offline")
+	}
+}
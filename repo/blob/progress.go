@@ -4,7 +4,10 @@ import "context"
 
 type contextKey string
 
-const progressCallbackContextKey contextKey = "progress-callback"
+const (
+	progressCallbackContextKey    contextKey = "progress-callback"
+	localStateDirectoryContextKey contextKey = "local-state-directory"
+)
 
 // ProgressFunc is used to report progress of a long-running storage operation.
 type ProgressFunc func(desc string, completed, total int64)
@@ -19,3 +22,15 @@ func ProgressCallback(ctx context.Context) ProgressFunc {
 	pf, _ := ctx.Value(progressCallbackContextKey).(ProgressFunc)
 	return pf
 }
+
+// WithLocalStateDirectory returns a context that passes the local directory where storage created with it may keep
+// state that must survive restarts, such as sessions of interrupted uploads.
+func WithLocalStateDirectory(ctx context.Context, dir string) context.Context {
+	return context.WithValue(ctx, localStateDirectoryContextKey, dir)
+}
+
+// LocalStateDirectory gets the local state directory from the context or an empty string if not provided.
+func LocalStateDirectory(ctx context.Context) string {
+	dir, _ := ctx.Value(localStateDirectoryContextKey).(string)
+	return dir
+}
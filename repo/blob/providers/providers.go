@@ -5,4 +5,6 @@ import (
 	// Register well-known blob storage providers
 	_ "github.com/kopia/kopia/repo/blob/filesystem"
 	_ "github.com/kopia/kopia/repo/blob/gcs"
+	_ "github.com/kopia/kopia/repo/blob/redundant"
+	_ "github.com/kopia/kopia/repo/blob/split"
 )
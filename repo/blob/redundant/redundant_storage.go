@@ -0,0 +1,193 @@
+// Package redundant implements Storage which writes every blob to two storage backends.
+//
+// This provides simple synchronous redundancy: each write succeeds only after the blob has been stored
+// in both backends, while reads are served by the primary storage and fall back to the secondary
+// storage when the primary storage can't be read.
+package redundant
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/logging"
+)
+
+const redundantStorageType = "redundant"
+
+var log = logging.GetContextLoggerFunc("repo/redundant")
+
+// Options defines options for redundant storage.
+type Options struct {
+	// Primary is the storage serving reads.
+	Primary blob.ConnectionInfo `json:"primary"`
+
+	// Secondary is the storage serving reads when the primary storage can't be read.
+	Secondary blob.ConnectionInfo `json:"secondary"`
+}
+
+type redundantStorage struct {
+	primary   blob.Storage
+	secondary blob.Storage
+}
+
+// both invokes the provided function for each of the underlying storage backends in parallel
+// and returns the first error.
+func (s *redundantStorage) both(ctx context.Context, f func(ctx context.Context, st blob.Storage) error) error {
+	eg, ctx := errgroup.WithContext(ctx)
+
+	eg.Go(func() error {
+		return f(ctx, s.primary)
+	})
+
+	eg.Go(func() error {
+		return f(ctx, s.secondary)
+	})
+
+	return eg.Wait()
+}
+
+func (s *redundantStorage) GetBlob(ctx context.Context, id blob.ID, offset, length int64) ([]byte, error) {
+	data, err := s.primary.GetBlob(ctx, id, offset, length)
+	if err == nil || ctx.Err() != nil {
+		return data, err
+	}
+
+	if err != blob.ErrBlobNotFound {
+		log(ctx).Warningf("unable to read %v from primary storage, reading from secondary storage: %v", id, err)
+	}
+
+	data, err2 := s.secondary.GetBlob(ctx, id, offset, length)
+	if err2 != nil {
+		// report the error of the primary storage, unless it only lacked the blob.
+		if err == blob.ErrBlobNotFound {
+			return nil, err2
+		}
+
+		return nil, err
+	}
+
+	return data, nil
+}
+
+func (s *redundantStorage) PutBlob(ctx context.Context, id blob.ID, data []byte) error {
+	return s.both(ctx, func(ctx context.Context, st blob.Storage) error {
+		return st.PutBlob(ctx, id, data)
+	})
+}
+
+func (s *redundantStorage) PutBlobWithOptions(ctx context.Context, id blob.ID, data []byte, opt blob.PutOptions) error {
+	return s.both(ctx, func(ctx context.Context, st blob.Storage) error {
+		return blob.PutBlobWithOptions(ctx, st, id, data, opt)
+	})
+}
+
+func (s *redundantStorage) SetStorageClass(ctx context.Context, id blob.ID, storageClass string) error {
+	return s.both(ctx, func(ctx context.Context, st blob.Storage) error {
+		return blob.SetStorageClass(ctx, st, id, storageClass)
+	})
+}
+
+func (s *redundantStorage) RestoreArchivedBlob(ctx context.Context, id blob.ID, days int) (bool, error) {
+	// reads are served by the primary storage, so only its blobs need to be restored.
+	restored, err := blob.RestoreArchivedBlob(ctx, s.primary, id, days)
+	if err == nil || ctx.Err() != nil {
+		return restored, err
+	}
+
+	log(ctx).Warningf("unable to restore %v in primary storage, restoring in secondary storage: %v", id, err)
+
+	return blob.RestoreArchivedBlob(ctx, s.secondary, id, days)
+}
+
+func (s *redundantStorage) DeleteBlob(ctx context.Context, id blob.ID) error {
+	return s.both(ctx, func(ctx context.Context, st blob.Storage) error {
+		// the blob may be missing from one of the backends if its earlier write or deletion failed halfway.
+		if err := st.DeleteBlob(ctx, id); err != nil && err != blob.ErrBlobNotFound {
+			return err
+		}
+
+		return nil
+	})
+}
+
+func (s *redundantStorage) ListBlobs(ctx context.Context, prefix blob.ID, callback func(blob.Metadata) error) error {
+	// blobs are listed before invoking the callback, so that listing can fall back to the secondary storage
+	// without reporting any blob twice.
+	blobs, err := blob.ListAllBlobs(ctx, s.primary, prefix)
+	if err != nil {
+		if ctx.Err() != nil {
+			return err
+		}
+
+		log(ctx).Warningf("unable to list blobs in primary storage, listing secondary storage: %v", err)
+
+		if blobs, err = blob.ListAllBlobs(ctx, s.secondary, prefix); err != nil {
+			return err
+		}
+	}
+
+	for _, bm := range blobs {
+		if err := callback(bm); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *redundantStorage) ConnectionInfo() blob.ConnectionInfo {
+	return blob.ConnectionInfo{
+		Type: redundantStorageType,
+		Config: &Options{
+			Primary:   s.primary.ConnectionInfo(),
+			Secondary: s.secondary.ConnectionInfo(),
+		},
+	}
+}
+
+func (s *redundantStorage) Close(ctx context.Context) error {
+	err := s.secondary.Close(ctx)
+
+	if err2 := s.primary.Close(ctx); err == nil {
+		err = err2
+	}
+
+	return err
+}
+
+// NewStorage returns a Storage writing all blobs to both provided storage backends,
+// which reads blobs from the primary storage and falls back to the secondary storage.
+func NewStorage(primary, secondary blob.Storage) blob.Storage {
+	return &redundantStorage{
+		primary:   primary,
+		secondary: secondary,
+	}
+}
+
+// New creates new redundant storage by connecting to both of the underlying storage backends.
+func New(ctx context.Context, opt *Options) (blob.Storage, error) {
+	primary, err := blob.NewStorage(ctx, opt.Primary)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to connect to primary storage")
+	}
+
+	secondary, err := blob.NewStorage(ctx, opt.Secondary)
+	if err != nil {
+		primary.Close(ctx) //nolint:errcheck
+		return nil, errors.Wrap(err, "unable to connect to secondary storage")
+	}
+
+	return NewStorage(primary, secondary), nil
+}
+
+func init() {
+	blob.AddSupportedStorage(
+		redundantStorageType,
+		func() interface{} { return &Options{} },
+		func(ctx context.Context, o interface{}) (blob.Storage, error) {
+			return New(ctx, o.(*Options))
+		})
+}
@@ -0,0 +1,70 @@
+package redundant
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/blobtesting"
+	"github.com/kopia/kopia/internal/testlogging"
+	"github.com/kopia/kopia/repo/blob"
+)
+
+func TestRedundantStorage(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	blobtesting.VerifyStorage(ctx, t, NewStorage(
+		blobtesting.NewMapStorage(blobtesting.DataMap{}, nil, nil),
+		blobtesting.NewMapStorage(blobtesting.DataMap{}, nil, nil)))
+
+	primaryData := blobtesting.DataMap{}
+	secondaryData := blobtesting.DataMap{}
+
+	primary := &blobtesting.FaultyStorage{
+		Base: blobtesting.NewMapStorage(primaryData, nil, nil),
+	}
+
+	st := NewStorage(primary, blobtesting.NewMapStorage(secondaryData, nil, nil))
+
+	for _, id := range []blob.ID{"p1", "p2", "n1"} {
+		if err := st.PutBlob(ctx, id, []byte{1, 2}); err != nil {
+			t.Fatalf("unable to write %v: %v", id, err)
+		}
+	}
+
+	if len(primaryData) != 3 || len(secondaryData) != 3 {
+		t.Errorf("blobs not written to both storage backends: %v, %v", primaryData, secondaryData)
+	}
+
+	// reads and listing fall back to the secondary storage when the primary storage fails.
+	someError := errors.New("some error")
+
+	primary.Faults = map[string][]*blobtesting.Fault{
+		"GetBlob":   {{Err: someError}},
+		"ListBlobs": {{Err: someError}},
+	}
+
+	blobtesting.AssertGetBlob(ctx, t, st, "p1", []byte{1, 2})
+	blobtesting.AssertListResults(ctx, t, st, "p", "p1", "p2")
+
+	// blobs missing from the primary storage are read from the secondary storage.
+	delete(primaryData, "n1")
+	blobtesting.AssertGetBlob(ctx, t, st, "n1", []byte{1, 2})
+
+	if err := st.DeleteBlob(ctx, "n1"); err != nil {
+		t.Fatalf("unable to delete blob missing from primary storage: %v", err)
+	}
+
+	if _, ok := secondaryData["n1"]; ok {
+		t.Errorf("blob not deleted from secondary storage")
+	}
+
+	// writes fail when any of the backends fails.
+	primary.Faults = map[string][]*blobtesting.Fault{
+		"PutBlob": {{Err: someError}},
+	}
+
+	if err := st.PutBlob(ctx, "p3", []byte{1, 2}); !errors.Is(err, someError) {
+		t.Errorf("unexpected error writing blob: %v", err)
+	}
+}
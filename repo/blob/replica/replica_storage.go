@@ -0,0 +1,86 @@
+// Package replica implements wrapper around Storage that serves reads from a local replica.
+//
+// The replica is a possibly out-of-date copy of the storage, such as a USB disk with a synced copy
+// of the repository. Reads of blobs that are missing from the replica or can't be read from it
+// are served by the wrapped storage, while all other operations go directly to the wrapped storage.
+package replica
+
+import (
+	"context"
+	"strings"
+
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/logging"
+)
+
+var log = logging.GetContextLoggerFunc("repo/replica")
+
+type replicaStorage struct {
+	blob.Storage
+
+	replica  blob.Storage
+	prefixes []blob.ID
+}
+
+func (s *replicaStorage) GetBlob(ctx context.Context, id blob.ID, offset, length int64) ([]byte, error) {
+	if s.isReplicated(id) {
+		data, err := s.replica.GetBlob(ctx, id, offset, length)
+		if err == nil {
+			return data, nil
+		}
+
+		if err != blob.ErrBlobNotFound {
+			log(ctx).Debugf("unable to read %v from local replica: %v", id, err)
+		}
+	}
+
+	return s.Storage.GetBlob(ctx, id, offset, length)
+}
+
+func (s *replicaStorage) isReplicated(id blob.ID) bool {
+	for _, p := range s.prefixes {
+		if strings.HasPrefix(string(id), string(p)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *replicaStorage) RestoreArchivedBlob(ctx context.Context, id blob.ID, days int) (bool, error) {
+	if s.isReplicated(id) {
+		if _, err := s.replica.GetBlob(ctx, id, 0, 0); err == nil {
+			// no need to restore blobs that will be read from the replica.
+			return true, nil
+		}
+	}
+
+	return blob.RestoreArchivedBlob(ctx, s.Storage, id, days)
+}
+
+func (s *replicaStorage) PutBlobWithOptions(ctx context.Context, id blob.ID, data []byte, opt blob.PutOptions) error {
+	return blob.PutBlobWithOptions(ctx, s.Storage, id, data, opt)
+}
+
+func (s *replicaStorage) SetStorageClass(ctx context.Context, id blob.ID, storageClass string) error {
+	return blob.SetStorageClass(ctx, s.Storage, id, storageClass)
+}
+
+func (s *replicaStorage) Close(ctx context.Context) error {
+	if err := s.replica.Close(ctx); err != nil {
+		log(ctx).Warningf("unable to close local replica: %v", err)
+	}
+
+	return s.Storage.Close(ctx)
+}
+
+// NewWrapper returns a Storage wrapper that reads blobs with the provided prefixes from the replica
+// before falling back to the wrapped storage. Only blobs that are never modified once written
+// can be safely read from a replica that may be out of date.
+func NewWrapper(wrapped, replica blob.Storage, prefixes []blob.ID) blob.Storage {
+	return &replicaStorage{
+		Storage:  wrapped,
+		replica:  replica,
+		prefixes: prefixes,
+	}
+}
@@ -0,0 +1,45 @@
+package replica
+
+import (
+	"testing"
+
+	"github.com/kopia/kopia/internal/blobtesting"
+	"github.com/kopia/kopia/internal/testlogging"
+	"github.com/kopia/kopia/repo/blob"
+)
+
+func TestReplicaStorage(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	baseData := blobtesting.DataMap{}
+	replicaData := blobtesting.DataMap{}
+
+	st := NewWrapper(
+		blobtesting.NewMapStorage(baseData, nil, nil),
+		blobtesting.NewMapStorage(replicaData, nil, nil),
+		[]blob.ID{"p"})
+
+	blobtesting.VerifyStorage(ctx, t, st)
+
+	baseData["p1"] = []byte{1, 2}
+	baseData["p2"] = []byte{3, 4}
+	baseData["n1"] = []byte{5, 6}
+	replicaData["p1"] = []byte{1, 2}
+	replicaData["n1"] = []byte{9, 9}
+
+	// blob present in the replica.
+	blobtesting.AssertGetBlob(ctx, t, st, "p1", []byte{1, 2})
+
+	// blob not yet replicated.
+	blobtesting.AssertGetBlob(ctx, t, st, "p2", []byte{3, 4})
+
+	// blobs not matching any prefix are always read from the wrapped storage.
+	blobtesting.AssertGetBlob(ctx, t, st, "n1", []byte{5, 6})
+
+	// to verify where reads come from, remove blob from the wrapped storage.
+	delete(baseData, "p1")
+	blobtesting.AssertGetBlob(ctx, t, st, "p1", []byte{1, 2})
+
+	// listing only reflects the wrapped storage.
+	blobtesting.AssertListResults(ctx, t, st, "p", "p2")
+}
@@ -0,0 +1,76 @@
+package s3
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo/blob"
+)
+
+type iamPolicy struct {
+	Version   string               `json:"Version"`
+	Statement []iamPolicyStatement `json:"Statement"`
+}
+
+type iamPolicyStatement struct {
+	Sid       string                 `json:"Sid"`
+	Effect    string                 `json:"Effect"`
+	Action    []string               `json:"Action"`
+	Resource  []string               `json:"Resource"`
+	Condition map[string]interface{} `json:"Condition,omitempty"`
+}
+
+// AppendOnlyPolicy returns the IAM policy granting access to the bucket and prefix of the storage that allows
+// listing, reading and adding objects, but only allows deleting objects whose names start with one of the mutable prefixes.
+//
+// The policy can't prevent overwriting existing objects, the bucket must have versioning or object lock enabled
+// so that overwritten data can be recovered.
+func AppendOnlyPolicy(opt *Options, mutablePrefixes []blob.ID) ([]byte, error) {
+	bucketARN := "arn:aws:s3:::" + opt.BucketName
+
+	var mutableObjects []string
+	for _, p := range mutablePrefixes {
+		mutableObjects = append(mutableObjects, bucketARN+"/"+opt.Prefix+string(p)+"*")
+	}
+
+	pol := iamPolicy{
+		Version: "2012-10-17",
+		Statement: []iamPolicyStatement{
+			{
+				Sid:      "ListRepository",
+				Effect:   "Allow",
+				Action:   []string{"s3:ListBucket"},
+				Resource: []string{bucketARN},
+				Condition: map[string]interface{}{
+					"StringLike": map[string][]string{
+						"s3:prefix": {opt.Prefix + "*"},
+					},
+				},
+			},
+			{
+				Sid:      "ReadAndAddObjects",
+				Effect:   "Allow",
+				Action:   []string{"s3:GetObject", "s3:PutObject"},
+				Resource: []string{bucketARN + "/" + opt.Prefix + "*"},
+			},
+			{
+				// parts of multipart uploads are added with s3:PutObject, resuming and aborting them requires more permissions.
+				Sid:      "ResumeAndAbortMultipartUploads",
+				Effect:   "Allow",
+				Action:   []string{"s3:ListMultipartUploadParts", "s3:AbortMultipartUpload"},
+				Resource: []string{bucketARN + "/" + opt.Prefix + "*"},
+			},
+			{
+				Sid:      "DeleteMutableObjects",
+				Effect:   "Allow",
+				Action:   []string{"s3:DeleteObject"},
+				Resource: mutableObjects,
+			},
+		},
+	}
+
+	b, err := json.MarshalIndent(pol, "", "  ")
+
+	return b, errors.Wrap(err, "unable to serialize policy")
+}
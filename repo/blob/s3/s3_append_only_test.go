@@ -0,0 +1,42 @@
+package s3
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/kopia/kopia/repo/blob"
+)
+
+func TestAppendOnlyPolicy(t *testing.T) {
+	b, err := AppendOnlyPolicy(&Options{BucketName: "some-bucket", Prefix: "repo/"}, []blob.ID{"l"})
+	if err != nil {
+		t.Fatalf("unable to generate policy: %v", err)
+	}
+
+	var pol iamPolicy
+	if err := json.Unmarshal(b, &pol); err != nil {
+		t.Fatalf("invalid policy: %v", err)
+	}
+
+	resources := map[string][]string{}
+	for _, s := range pol.Statement {
+		for _, a := range s.Action {
+			resources[a] = s.Resource
+		}
+	}
+
+	want := map[string][]string{
+		"s3:ListBucket":   {"arn:aws:s3:::some-bucket"},
+		"s3:GetObject":    {"arn:aws:s3:::some-bucket/repo/*"},
+		"s3:PutObject":    {"arn:aws:s3:::some-bucket/repo/*"},
+		"s3:DeleteObject": {"arn:aws:s3:::some-bucket/repo/l*"},
+
+		"s3:ListMultipartUploadParts": {"arn:aws:s3:::some-bucket/repo/*"},
+		"s3:AbortMultipartUpload":     {"arn:aws:s3:::some-bucket/repo/*"},
+	}
+
+	if !reflect.DeepEqual(resources, want) {
+		t.Errorf("unexpected resources: %v, want %v", resources, want)
+	}
+}
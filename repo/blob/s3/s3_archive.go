@@ -0,0 +1,113 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	minio "github.com/minio/minio-go/v6"
+	"github.com/minio/minio-go/v6/pkg/s3signer"
+	"github.com/minio/minio-go/v6/pkg/s3utils"
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo/blob"
+)
+
+// archivedStorageClasses are storage classes whose objects must be restored before reading.
+var archivedStorageClasses = map[string]bool{
+	"GLACIER":      true,
+	"DEEP_ARCHIVE": true,
+}
+
+// RestoreArchivedBlob implements blob.ArchiveRestorer.
+func (s *s3Storage) RestoreArchivedBlob(ctx context.Context, b blob.ID, days int) (bool, error) {
+	oi, err := s.cli.StatObjectWithContext(ctx, s.BucketName, s.getObjectNameString(b), minio.StatObjectOptions{})
+	if err != nil {
+		return false, translateError(err)
+	}
+
+	if !archivedStorageClasses[oi.Metadata.Get("X-Amz-Storage-Class")] {
+		return true, nil
+	}
+
+	// see https://docs.aws.amazon.com/AmazonS3/latest/API/API_HeadObject.html#API_HeadObject_ResponseSyntax
+	switch restore := oi.Metadata.Get("X-Amz-Restore"); {
+	case strings.Contains(restore, `ongoing-request="false"`):
+		return true, nil
+
+	case strings.Contains(restore, `ongoing-request="true"`):
+		return false, nil
+	}
+
+	s3log(ctx).Debugf("requesting restore of %v", b)
+
+	return false, s.requestRestore(ctx, s.getObjectNameString(b), days)
+}
+
+// requestRestore sends RestoreObject request, which is not supported by minio client.
+func (s *s3Storage) requestRestore(ctx context.Context, objectName string, days int) error {
+	body := []byte(fmt.Sprintf(
+		"<RestoreRequest><Days>%v</Days><GlacierJobParameters><Tier>Standard</Tier></GlacierJobParameters></RestoreRequest>",
+		days))
+
+	region, err := s.cli.GetBucketLocation(s.BucketName)
+	if err != nil {
+		return errors.Wrap(err, "unable to determine bucket location")
+	}
+
+	scheme := "https"
+	if s.DoNotUseTLS {
+		scheme = "http"
+	}
+
+	u := url.URL{
+		Scheme:   scheme,
+		Host:     s.Endpoint,
+		Path:     "/" + s.BucketName + "/" + objectName,
+		RawQuery: "restore",
+	}
+
+	u.RawPath = "/" + s.BucketName + "/" + s3utils.EncodePath(objectName)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "unable to create request")
+	}
+
+	h := sha256.Sum256(body)
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(h[:]))
+	req.ContentLength = int64(len(body))
+
+	v, err := s.creds.Get()
+	if err != nil {
+		return errors.Wrap(err, "unable to get credentials")
+	}
+
+	req = s3signer.SignV4(*req, v.AccessKeyID, v.SecretAccessKey, v.SessionToken, region)
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "restore request failed")
+	}
+
+	defer resp.Body.Close() //nolint:errcheck
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusAccepted:
+		return nil
+
+	case http.StatusConflict:
+		// RestoreAlreadyInProgress
+		return nil
+
+	default:
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return errors.Errorf("restore request failed with %v: %s", resp.Status, msg)
+	}
+}
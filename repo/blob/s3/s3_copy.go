@@ -0,0 +1,35 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+
+	minio "github.com/minio/minio-go/v6"
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo/blob"
+)
+
+// CopyBlobFrom implements blob.ServerSideCopier by copying objects from another bucket on the same endpoint.
+//
+// The copy is performed using credentials of the destination, which must be allowed to read the source bucket.
+func (s *s3Storage) CopyBlobFrom(ctx context.Context, src blob.Storage, b blob.ID) error {
+	srcS3, ok := src.(*s3Storage)
+	if !ok || srcS3.Endpoint != s.Endpoint {
+		return blob.ErrServerSideCopyNotSupported
+	}
+
+	core := minio.Core{Client: s.cli}
+
+	_, err := exponentialBackoff(ctx, fmt.Sprintf("CopyBlobFrom(%q,%q)", srcS3.BucketName, b), func() (interface{}, error) {
+		return core.CopyObjectWithContext(ctx, srcS3.BucketName, srcS3.getObjectNameString(b), s.BucketName, s.getObjectNameString(b), map[string]string{
+			"x-amz-metadata-directive": "COPY",
+		})
+	})
+
+	if minio.ToErrorResponse(err).Code == "AccessDenied" {
+		return errors.Wrapf(blob.ErrServerSideCopyNotSupported, "access to bucket %q denied", srcS3.BucketName)
+	}
+
+	return translateError(err)
+}
@@ -0,0 +1,83 @@
+package s3
+
+import (
+	"context"
+
+	"github.com/minio/minio-go/v6/pkg/credentials"
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/credexec"
+)
+
+// Supported values of Options.CredentialsProvider.
+const (
+	// CredentialsStatic uses access key, secret access key and session token from Options.
+	CredentialsStatic = "static"
+
+	// CredentialsIAM obtains credentials from the environment: IAM roles for service accounts (IRSA)
+	// when AWS_WEB_IDENTITY_TOKEN_FILE is set, ECS task roles or EC2 instance profiles.
+	CredentialsIAM = "iam"
+
+	// CredentialsExec runs Options.CredentialsCommand to obtain credentials.
+	CredentialsExec = "exec"
+)
+
+func newCredentials(ctx context.Context, opt *Options) (*credentials.Credentials, error) {
+	switch opt.CredentialsProvider {
+	case "", CredentialsStatic:
+		return credentials.NewStaticV4(opt.AccessKeyID, opt.SecretAccessKey, opt.SessionToken), nil
+
+	case CredentialsIAM:
+		return credentials.NewIAM(""), nil
+
+	case CredentialsExec:
+		if opt.CredentialsCommand == "" {
+			return nil, errors.New("credentials command must be specified")
+		}
+
+		return credentials.New(&execProvider{ctx: ctx, command: opt.CredentialsCommand}), nil
+
+	default:
+		return nil, errors.Errorf("unsupported credentials provider %q", opt.CredentialsProvider)
+	}
+}
+
+// execProvider implements credentials.Provider by running an external command.
+type execProvider struct {
+	ctx     context.Context
+	command string
+
+	// expiry is nil if the last retrieved credentials don't expire.
+	expiry *credentials.Expiry
+}
+
+func (p *execProvider) Retrieve() (credentials.Value, error) {
+	c, err := credexec.Run(p.ctx, p.command)
+	if err != nil {
+		return credentials.Value{}, err
+	}
+
+	if c.AccessKeyID == "" || c.SecretAccessKey == "" {
+		return credentials.Value{}, errors.New("credentials command did not return access key and secret access key")
+	}
+
+	p.expiry = nil
+
+	if !c.Expiration.IsZero() {
+		p.expiry = &credentials.Expiry{}
+		p.expiry.SetExpiration(c.Expiration, credexec.ExpiryWindow)
+
+		s3log(p.ctx).Debugf("obtained S3 credentials valid until %v", c.Expiration)
+	}
+
+	return credentials.Value{
+		AccessKeyID:     c.AccessKeyID,
+		SecretAccessKey: c.SecretAccessKey,
+		SessionToken:    c.SessionToken,
+		SignerType:      credentials.SignatureV4,
+	}, nil
+}
+
+func (p *execProvider) IsExpired() bool {
+	return p.expiry != nil && p.expiry.IsExpired()
+}
@@ -0,0 +1,62 @@
+package s3
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/kopia/kopia/internal/testlogging"
+)
+
+func TestExecCredentials(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test relies on 'echo' command")
+	}
+
+	ctx := testlogging.Context(t)
+
+	creds, err := newCredentials(ctx, &Options{
+		CredentialsProvider: CredentialsExec,
+		CredentialsCommand:  `echo {"accessKeyID":"ak","secretAccessKey":"sak","sessionToken":"st"}`,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	v, err := creds.Get()
+	if err != nil {
+		t.Fatalf("unable to get credentials: %v", err)
+	}
+
+	if v.AccessKeyID != "ak" || v.SecretAccessKey != "sak" || v.SessionToken != "st" {
+		t.Errorf("unexpected credentials: %+v", v)
+	}
+
+	if creds.IsExpired() {
+		t.Errorf("credentials without expiration must not expire")
+	}
+
+	// credentials that have already expired are retrieved again.
+	creds, err = newCredentials(ctx, &Options{
+		CredentialsProvider: CredentialsExec,
+		CredentialsCommand:  `echo {"accessKeyID":"ak","secretAccessKey":"sak","expiration":"2020-01-01T00:00:00Z"}`,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := creds.Get(); err != nil {
+		t.Fatalf("unable to get credentials: %v", err)
+	}
+
+	if !creds.IsExpired() {
+		t.Errorf("expired credentials not reported as such")
+	}
+
+	if _, err := newCredentials(ctx, &Options{CredentialsProvider: CredentialsExec}); err == nil {
+		t.Errorf("expected error without credentials command")
+	}
+
+	if _, err := newCredentials(ctx, &Options{CredentialsProvider: "no-such-provider"}); err == nil {
+		t.Errorf("expected error for unsupported provider")
+	}
+}
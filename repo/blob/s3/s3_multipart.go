@@ -0,0 +1,352 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5" //nolint:gosec
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	minio "github.com/minio/minio-go/v6"
+	"github.com/minio/minio-go/v6/pkg/encrypt"
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/clock"
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/logging"
+)
+
+var s3log = logging.GetContextLoggerFunc("repo/s3")
+
+// minMultipartPartSize is the smallest size of a part (other than the last one) accepted by S3.
+const minMultipartPartSize = 5 << 20
+
+// maxMultipartSessionAge is the age after which sessions stored on disk are no longer resumed and get aborted.
+const maxMultipartSessionAge = 24 * time.Hour
+
+// multipartAPI is the subset of minio.Core used for multipart uploads.
+type multipartAPI interface {
+	NewMultipartUpload(bucket, object string, opts minio.PutObjectOptions) (string, error)
+	PutObjectPartWithContext(ctx context.Context, bucket, object, uploadID string, partID int, data io.Reader, size int64, md5Base64, sha256Hex string, sse encrypt.ServerSide) (minio.ObjectPart, error)
+	ListObjectParts(bucket, object, uploadID string, partNumberMarker, maxParts int) (minio.ListObjectPartsResult, error)
+	CompleteMultipartUploadWithContext(ctx context.Context, bucket, object, uploadID string, parts []minio.CompletePart) (string, error)
+	AbortMultipartUploadWithContext(ctx context.Context, bucket, object, uploadID string) error
+}
+
+// multipartSession is the state of a multipart upload that has not completed yet.
+type multipartSession struct {
+	Bucket   string    `json:"bucket"`
+	Object   string    `json:"object"`
+	UploadID string    `json:"uploadID"`
+	DataHash []byte    `json:"dataHash"` // sessions are only resumed when uploading identical data
+	Started  time.Time `json:"started"`
+}
+
+// multipartUploader uploads large blobs in parts, remembering upload sessions of failed uploads, so that
+// retrying the upload of the same blob only sends parts that have not been received by the server yet.
+// When stateDir is set, sessions are also stored there, so that uploads can be resumed after a restart.
+type multipartUploader struct {
+	api      multipartAPI
+	bucket   string
+	partSize int
+	stateDir string
+
+	mu       sync.Mutex
+	sessions map[string]*multipartSession // keyed by object name
+}
+
+func (m *multipartUploader) upload(ctx context.Context, b blob.ID, object, storageClass string, data []byte, wrapReader func(io.Reader) (io.Reader, error)) error {
+	dataHash := sha256.Sum256(data)
+
+	sess, err := m.getOrCreateSession(ctx, object, storageClass, dataHash[:])
+	if err != nil {
+		return err
+	}
+
+	uploaded, err := m.uploadedParts(ctx, object, sess.UploadID)
+	if err != nil {
+		return err
+	}
+
+	progressCallback := blob.ProgressCallback(ctx)
+
+	var parts []minio.CompletePart
+
+	for offset, partNumber := 0, 1; offset < len(data); offset, partNumber = offset+m.partSize, partNumber+1 {
+		end := offset + m.partSize
+		if end > len(data) {
+			end = len(data)
+		}
+
+		part := data[offset:end]
+		md5sum := md5.Sum(part) //nolint:gosec
+
+		if etag, ok := uploaded[partNumber]; ok && etag == hex.EncodeToString(md5sum[:]) {
+			s3log(ctx).Debugf("part %v of %v already uploaded, skipping", partNumber, object)
+			parts = append(parts, minio.CompletePart{PartNumber: partNumber, ETag: etag})
+
+			continue
+		}
+
+		r, err := wrapReader(bytes.NewReader(part))
+		if err != nil {
+			return err
+		}
+
+		op, err := m.api.PutObjectPartWithContext(ctx, m.bucket, object, sess.UploadID, partNumber, r, int64(len(part)), base64.StdEncoding.EncodeToString(md5sum[:]), "", nil)
+		if err != nil {
+			// session is kept, retrying the upload will resume from this part.
+			return err
+		}
+
+		parts = append(parts, minio.CompletePart{PartNumber: partNumber, ETag: op.ETag})
+
+		if progressCallback != nil {
+			progressCallback(string(b), int64(end), int64(len(data)))
+		}
+	}
+
+	if _, err := m.api.CompleteMultipartUploadWithContext(ctx, m.bucket, object, sess.UploadID, parts); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	m.removeSessionLocked(ctx, object)
+	m.mu.Unlock()
+
+	return nil
+}
+
+// getOrCreateSession returns the session of previously interrupted upload of the same data or starts a new one.
+func (m *multipartUploader) getOrCreateSession(ctx context.Context, object, storageClass string, dataHash []byte) (*multipartSession, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sess := m.sessions[object]
+	if sess == nil {
+		sess = m.loadSessionLocked(ctx, object)
+	}
+
+	if sess != nil {
+		if bytes.Equal(sess.DataHash, dataHash) {
+			s3log(ctx).Debugf("resuming upload of %v", object)
+			return sess, nil
+		}
+
+		m.abortLocked(ctx, object, sess)
+	}
+
+	uploadID, err := m.api.NewMultipartUpload(m.bucket, object, minio.PutObjectOptions{
+		ContentType:  "application/x-kopia",
+		StorageClass: storageClass,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to start multipart upload")
+	}
+
+	sess = &multipartSession{
+		Bucket:   m.bucket,
+		Object:   object,
+		UploadID: uploadID,
+		DataHash: dataHash,
+		Started:  clock.Now(),
+	}
+
+	m.sessions[object] = sess
+	m.saveSessionLocked(ctx, sess)
+
+	return sess, nil
+}
+
+// uploadedParts returns the ETags of parts of the given upload already received by the server, keyed by part number.
+func (m *multipartUploader) uploadedParts(ctx context.Context, object, uploadID string) (map[int]string, error) {
+	result := map[int]string{}
+	marker := 0
+
+	for {
+		lp, err := m.api.ListObjectParts(m.bucket, object, uploadID, marker, 0)
+		if err != nil {
+			if me, ok := err.(minio.ErrorResponse); ok && me.Code == "NoSuchUpload" {
+				// upload has been aborted or expired on the server, start over.
+				m.mu.Lock()
+				m.removeSessionLocked(ctx, object)
+				m.mu.Unlock()
+			}
+
+			return nil, errors.Wrap(err, "unable to list uploaded parts")
+		}
+
+		for _, p := range lp.ObjectParts {
+			result[p.PartNumber] = strings.Trim(p.ETag, `"`)
+		}
+
+		if !lp.IsTruncated {
+			return result, nil
+		}
+
+		marker = lp.NextPartNumberMarker
+	}
+}
+
+func (m *multipartUploader) abortLocked(ctx context.Context, object string, sess *multipartSession) {
+	if err := m.api.AbortMultipartUploadWithContext(ctx, m.bucket, object, sess.UploadID); err != nil {
+		s3log(ctx).Warningf("unable to abort multipart upload of %v: %v", object, err)
+	}
+
+	m.removeSessionLocked(ctx, object)
+}
+
+// abortAll aborts all incomplete uploads so that their parts don't keep using storage.
+// Sessions stored on disk are kept, so that their uploads can be resumed after a restart.
+func (m *multipartUploader) abortAll(ctx context.Context) {
+	if m.stateDir != "" {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for object, sess := range m.sessions {
+		m.abortLocked(ctx, object, sess)
+	}
+}
+
+// abortExpired aborts uploads of sessions stored on disk that are too old to be resumed.
+func (m *multipartUploader) abortExpired(ctx context.Context) {
+	if m.stateDir == "" {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	files, err := ioutil.ReadDir(m.stateDir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			s3log(ctx).Warningf("unable to list multipart upload sessions: %v", err)
+		}
+
+		return
+	}
+
+	for _, fi := range files {
+		sess, err := readMultipartSession(filepath.Join(m.stateDir, fi.Name()))
+		if err != nil || sess.Bucket != m.bucket || clock.Now().Sub(sess.Started) < maxMultipartSessionAge {
+			continue
+		}
+
+		s3log(ctx).Debugf("aborting expired multipart upload of %v", sess.Object)
+		m.abortLocked(ctx, sess.Object, sess)
+	}
+}
+
+// sessionFile returns the name of the file storing the session of the given object.
+func (m *multipartUploader) sessionFile(object string) string {
+	h := sha256.Sum256([]byte(m.bucket + "/" + object))
+	return filepath.Join(m.stateDir, hex.EncodeToString(h[:16])+".json")
+}
+
+// loadSessionLocked returns the session of the given object stored on disk or nil if there's none that can be resumed.
+func (m *multipartUploader) loadSessionLocked(ctx context.Context, object string) *multipartSession {
+	if m.stateDir == "" {
+		return nil
+	}
+
+	sess, err := readMultipartSession(m.sessionFile(object))
+	if err != nil {
+		if !os.IsNotExist(errors.Cause(err)) {
+			s3log(ctx).Warningf("unable to read multipart upload session of %v: %v", object, err)
+		}
+
+		return nil
+	}
+
+	if sess.Bucket != m.bucket || sess.Object != object {
+		return nil
+	}
+
+	if clock.Now().Sub(sess.Started) >= maxMultipartSessionAge {
+		m.abortLocked(ctx, object, sess)
+		return nil
+	}
+
+	m.sessions[object] = sess
+
+	return sess
+}
+
+// saveSessionLocked stores the session on disk, failures only prevent resuming the upload after a restart.
+func (m *multipartUploader) saveSessionLocked(ctx context.Context, sess *multipartSession) {
+	if m.stateDir == "" {
+		return
+	}
+
+	data, err := json.Marshal(sess)
+	if err != nil {
+		s3log(ctx).Warningf("unable to serialize multipart upload session: %v", err)
+		return
+	}
+
+	if err := os.MkdirAll(m.stateDir, 0700); err != nil {
+		s3log(ctx).Warningf("unable to create multipart upload session directory: %v", err)
+		return
+	}
+
+	fname := m.sessionFile(sess.Object)
+
+	mySuffix := fmt.Sprintf(".tmp-%v-%v", os.Getpid(), clock.Now().UnixNano())
+	if err := ioutil.WriteFile(fname+mySuffix, data, 0600); err != nil {
+		s3log(ctx).Warningf("unable to write multipart upload session: %v", err)
+		return
+	}
+
+	os.Rename(fname+mySuffix, fname) //nolint:errcheck
+	os.Remove(fname + mySuffix)      //nolint:errcheck
+}
+
+func (m *multipartUploader) removeSessionLocked(ctx context.Context, object string) {
+	delete(m.sessions, object)
+
+	if m.stateDir == "" {
+		return
+	}
+
+	if err := os.Remove(m.sessionFile(object)); err != nil && !os.IsNotExist(err) {
+		s3log(ctx).Warningf("unable to remove multipart upload session of %v: %v", object, err)
+	}
+}
+
+func readMultipartSession(fname string) (*multipartSession, error) {
+	data, err := ioutil.ReadFile(fname) //nolint:gosec
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read session")
+	}
+
+	var sess multipartSession
+
+	if err := json.Unmarshal(data, &sess); err != nil {
+		return nil, errors.Wrap(err, "unable to parse session")
+	}
+
+	return &sess, nil
+}
+
+func newMultipartUploader(api multipartAPI, bucket string, partSize int, stateDir string) *multipartUploader {
+	return &multipartUploader{
+		api:      api,
+		bucket:   bucket,
+		partSize: partSize,
+		stateDir: stateDir,
+		sessions: map[string]*multipartSession{},
+	}
+}
@@ -0,0 +1,324 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5" //nolint:gosec
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"testing"
+
+	minio "github.com/minio/minio-go/v6"
+	"github.com/minio/minio-go/v6/pkg/encrypt"
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/testlogging"
+)
+
+type fakeMultipartAPI struct {
+	nextID    int
+	uploads   map[string]map[int][]byte // uploadID -> part number -> data
+	objects   map[string][]byte
+	aborted   []string
+	partsSent []int
+
+	failPart int // part number to fail once
+}
+
+func (f *fakeMultipartAPI) NewMultipartUpload(bucket, object string, opts minio.PutObjectOptions) (string, error) {
+	f.nextID++
+	id := fmt.Sprintf("upload-%v", f.nextID)
+	f.uploads[id] = map[int][]byte{}
+
+	return id, nil
+}
+
+func (f *fakeMultipartAPI) PutObjectPartWithContext(ctx context.Context, bucket, object, uploadID string, partID int, data io.Reader, size int64, md5Base64, sha256Hex string, sse encrypt.ServerSide) (minio.ObjectPart, error) {
+	b, err := ioutil.ReadAll(data)
+	if err != nil {
+		return minio.ObjectPart{}, err
+	}
+
+	f.partsSent = append(f.partsSent, partID)
+
+	if partID == f.failPart {
+		f.failPart = 0
+		return minio.ObjectPart{}, errors.New("connection reset")
+	}
+
+	f.uploads[uploadID][partID] = b
+
+	return minio.ObjectPart{PartNumber: partID, ETag: md5hex(b)}, nil
+}
+
+func (f *fakeMultipartAPI) ListObjectParts(bucket, object, uploadID string, partNumberMarker, maxParts int) (minio.ListObjectPartsResult, error) {
+	parts, ok := f.uploads[uploadID]
+	if !ok {
+		return minio.ListObjectPartsResult{}, minio.ErrorResponse{Code: "NoSuchUpload", StatusCode: 404}
+	}
+
+	var result minio.ListObjectPartsResult
+
+	for n, b := range parts {
+		result.ObjectParts = append(result.ObjectParts, minio.ObjectPart{PartNumber: n, ETag: `"` + md5hex(b) + `"`, Size: int64(len(b))})
+	}
+
+	return result, nil
+}
+
+func (f *fakeMultipartAPI) CompleteMultipartUploadWithContext(ctx context.Context, bucket, object, uploadID string, parts []minio.CompletePart) (string, error) {
+	var buf bytes.Buffer
+
+	for i, p := range parts {
+		b := f.uploads[uploadID][p.PartNumber]
+		if p.PartNumber != i+1 || md5hex(b) != p.ETag {
+			return "", errors.Errorf("invalid part %v", p)
+		}
+
+		buf.Write(b)
+	}
+
+	f.objects[object] = buf.Bytes()
+	delete(f.uploads, uploadID)
+
+	return "etag", nil
+}
+
+func (f *fakeMultipartAPI) AbortMultipartUploadWithContext(ctx context.Context, bucket, object, uploadID string) error {
+	f.aborted = append(f.aborted, uploadID)
+	delete(f.uploads, uploadID)
+
+	return nil
+}
+
+func md5hex(b []byte) string {
+	h := md5.Sum(b) //nolint:gosec
+	return hex.EncodeToString(h[:])
+}
+
+func noWrap(r io.Reader) (io.Reader, error) {
+	return r, nil
+}
+
+func TestMultipartUploadResume(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	api := &fakeMultipartAPI{
+		uploads:  map[string]map[int][]byte{},
+		objects:  map[string][]byte{},
+		failPart: 3,
+	}
+
+	m := newMultipartUploader(api, "bucket", 10, "")
+
+	data := make([]byte, 45)
+	rand.Read(data) //nolint:gosec
+
+	if err := m.upload(ctx, "blob1", "obj1", "", data, noWrap); err == nil {
+		t.Fatalf("expected upload to fail")
+	}
+
+	if got, want := fmt.Sprint(api.partsSent), "[1 2 3]"; got != want {
+		t.Errorf("unexpected parts sent: %v, want %v", got, want)
+	}
+
+	api.partsSent = nil
+
+	// retry only sends remaining parts
+	if err := m.upload(ctx, "blob1", "obj1", "", data, noWrap); err != nil {
+		t.Fatalf("upload error: %v", err)
+	}
+
+	if got, want := fmt.Sprint(api.partsSent), "[3 4 5]"; got != want {
+		t.Errorf("unexpected parts sent on retry: %v, want %v", got, want)
+	}
+
+	if !bytes.Equal(api.objects["obj1"], data) {
+		t.Errorf("invalid object contents")
+	}
+
+	if len(m.sessions) != 0 {
+		t.Errorf("sessions not cleaned up: %v", m.sessions)
+	}
+}
+
+func TestMultipartUploadDifferentData(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	api := &fakeMultipartAPI{
+		uploads:  map[string]map[int][]byte{},
+		objects:  map[string][]byte{},
+		failPart: 2,
+	}
+
+	m := newMultipartUploader(api, "bucket", 10, "")
+
+	if err := m.upload(ctx, "blob1", "obj1", "", bytes.Repeat([]byte{1}, 25), noWrap); err == nil {
+		t.Fatalf("expected upload to fail")
+	}
+
+	// uploading different data under the same name abandons previous session.
+	data2 := bytes.Repeat([]byte{2}, 25)
+	if err := m.upload(ctx, "blob1", "obj1", "", data2, noWrap); err != nil {
+		t.Fatalf("upload error: %v", err)
+	}
+
+	if got, want := fmt.Sprint(api.aborted), "[upload-1]"; got != want {
+		t.Errorf("unexpected aborted uploads: %v, want %v", got, want)
+	}
+
+	if !bytes.Equal(api.objects["obj1"], data2) {
+		t.Errorf("invalid object contents")
+	}
+}
+
+func TestMultipartUploadExpiredSession(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	api := &fakeMultipartAPI{
+		uploads:  map[string]map[int][]byte{},
+		objects:  map[string][]byte{},
+		failPart: 2,
+	}
+
+	m := newMultipartUploader(api, "bucket", 10, "")
+	data := bytes.Repeat([]byte{1}, 25)
+
+	if err := m.upload(ctx, "blob1", "obj1", "", data, noWrap); err == nil {
+		t.Fatalf("expected upload to fail")
+	}
+
+	// server forgets about the upload
+	delete(api.uploads, "upload-1")
+
+	if err := m.upload(ctx, "blob1", "obj1", "", data, noWrap); err == nil {
+		t.Fatalf("expected upload of expired session to fail")
+	}
+
+	// next attempt starts over
+	if err := m.upload(ctx, "blob1", "obj1", "", data, noWrap); err != nil {
+		t.Fatalf("upload error: %v", err)
+	}
+
+	if !bytes.Equal(api.objects["obj1"], data) {
+		t.Errorf("invalid object contents")
+	}
+}
+
+func TestMultipartAbortAll(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	api := &fakeMultipartAPI{
+		uploads:  map[string]map[int][]byte{},
+		objects:  map[string][]byte{},
+		failPart: 1,
+	}
+
+	m := newMultipartUploader(api, "bucket", 10, "")
+
+	if err := m.upload(ctx, "blob1", "obj1", "", bytes.Repeat([]byte{1}, 25), noWrap); err == nil {
+		t.Fatalf("expected upload to fail")
+	}
+
+	m.abortAll(ctx)
+
+	if len(api.uploads) != 0 || len(m.sessions) != 0 {
+		t.Errorf("uploads not aborted: %v %v", api.uploads, m.sessions)
+	}
+}
+
+func TestMultipartUploadResumeAfterRestart(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	stateDir, err := ioutil.TempDir("", "kopia-multipart")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(stateDir)
+
+	api := &fakeMultipartAPI{
+		uploads:  map[string]map[int][]byte{},
+		objects:  map[string][]byte{},
+		failPart: 3,
+	}
+
+	data := make([]byte, 45)
+	rand.Read(data) //nolint:gosec
+
+	m := newMultipartUploader(api, "bucket", 10, stateDir)
+
+	if err := m.upload(ctx, "blob1", "obj1", "", data, noWrap); err == nil {
+		t.Fatalf("expected upload to fail")
+	}
+
+	// closing the storage keeps sessions stored on disk.
+	m.abortAll(ctx)
+
+	if len(api.aborted) != 0 {
+		t.Errorf("unexpected aborted uploads: %v", api.aborted)
+	}
+
+	api.partsSent = nil
+
+	// new uploader, as created after a restart, resumes the session.
+	m2 := newMultipartUploader(api, "bucket", 10, stateDir)
+	m2.abortExpired(ctx)
+
+	if err := m2.upload(ctx, "blob1", "obj1", "", data, noWrap); err != nil {
+		t.Fatalf("upload error: %v", err)
+	}
+
+	if got, want := fmt.Sprint(api.partsSent), "[3 4 5]"; got != want {
+		t.Errorf("unexpected parts sent after restart: %v, want %v", got, want)
+	}
+
+	if !bytes.Equal(api.objects["obj1"], data) {
+		t.Errorf("invalid object contents")
+	}
+
+	if files, _ := ioutil.ReadDir(stateDir); len(files) != 0 {
+		t.Errorf("session files not removed: %v", files)
+	}
+}
+
+func TestMultipartAbortExpiredSessions(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	stateDir, err := ioutil.TempDir("", "kopia-multipart")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(stateDir)
+
+	api := &fakeMultipartAPI{
+		uploads:  map[string]map[int][]byte{},
+		objects:  map[string][]byte{},
+		failPart: 1,
+	}
+
+	m := newMultipartUploader(api, "bucket", 10, stateDir)
+
+	if err := m.upload(ctx, "blob1", "obj1", "", bytes.Repeat([]byte{1}, 25), noWrap); err == nil {
+		t.Fatalf("expected upload to fail")
+	}
+
+	sess := m.sessions["obj1"]
+	sess.Started = sess.Started.Add(-maxMultipartSessionAge)
+	m.saveSessionLocked(ctx, sess)
+
+	newMultipartUploader(api, "bucket", 10, stateDir).abortExpired(ctx)
+
+	if got, want := fmt.Sprint(api.aborted), "[upload-1]"; got != want {
+		t.Errorf("unexpected aborted uploads: %v, want %v", got, want)
+	}
+
+	if files, _ := ioutil.ReadDir(stateDir); len(files) != 0 {
+		t.Errorf("session files not removed: %v", files)
+	}
+}
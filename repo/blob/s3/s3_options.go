@@ -1,5 +1,7 @@
 package s3
 
+import "github.com/kopia/kopia/repo/blob"
+
 // Options defines options for S3-based storage.
 type Options struct {
 	// BucketName is the name of the bucket where data is stored.
@@ -12,14 +14,27 @@ type Options struct {
 	DoNotUseTLS    bool   `json:"doNotUseTLS,omitempty"`
 	DoNotVerifyTLS bool   `json:"doNotVerifyTLS,omitempty"`
 
+	blob.TransportOptions
+
 	AccessKeyID     string `json:"accessKeyID"`
 	SecretAccessKey string `json:"secretAccessKey" kopia:"sensitive"`
 	SessionToken    string `json:"sessionToken" kopia:"sensitive"`
 
+	// CredentialsProvider selects how credentials are obtained, one of "static" (default), "iam" or "exec".
+	CredentialsProvider string `json:"credentialsProvider,omitempty"`
+
+	// CredentialsCommand is the command used to obtain credentials when CredentialsProvider is "exec".
+	CredentialsCommand string `json:"credentialsCommand,omitempty"`
+
 	// Region is an optional region to pass in authorization header.
 	Region string `json:"region,omitempty"`
 
 	MaxUploadSpeedBytesPerSecond int `json:"maxUploadSpeedBytesPerSecond,omitempty"`
 
 	MaxDownloadSpeedBytesPerSecond int `json:"maxDownloadSpeedBytesPerSecond,omitempty"`
+
+	// ResumableUploadPartSize enables uploading blobs larger than the given size in parts, so that
+	// retries after a failed upload only send parts that were not received. Sessions of failed uploads
+	// are stored in the cache directory, so that uploads can also be resumed after a restart. 0 disables it.
+	ResumableUploadPartSize int `json:"resumableUploadPartSize,omitempty"`
 }
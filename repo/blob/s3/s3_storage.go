@@ -4,11 +4,11 @@ package s3
 import (
 	"bytes"
 	"context"
-	"crypto/tls"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
+	"path/filepath"
 	"strings"
 
 	"github.com/efarrer/iothrottler"
@@ -31,6 +31,13 @@ type s3Storage struct {
 
 	cli *minio.Client
 
+	// creds and httpClient are used to send requests not supported by the client.
+	creds      *credentials.Credentials
+	httpClient *http.Client
+
+	// multipart is used to upload blobs larger than ResumableUploadPartSize, nil if disabled.
+	multipart *multipartUploader
+
 	downloadThrottler *iothrottler.IOThrottlerPool
 	uploadThrottler   *iothrottler.IOThrottlerPool
 }
@@ -108,12 +115,29 @@ func translateError(err error) error {
 		if me.StatusCode == http.StatusNotFound {
 			return blob.ErrBlobNotFound
 		}
+
+		if me.Code == "InvalidObjectState" {
+			return blob.ErrBlobArchived
+		}
 	}
 
 	return err
 }
 
 func (s *s3Storage) PutBlob(ctx context.Context, b blob.ID, data []byte) error {
+	return s.PutBlobWithOptions(ctx, b, data, blob.PutOptions{})
+}
+
+// PutBlobWithOptions implements blob.PutterWithOptions.
+func (s *s3Storage) PutBlobWithOptions(ctx context.Context, b blob.ID, data []byte, opt blob.PutOptions) error {
+	if s.multipart != nil && len(data) > s.ResumableUploadPartSize {
+		return translateError(retry.WithExponentialBackoffNoValue(ctx, fmt.Sprintf("PutBlob(%v)", b), func() error {
+			return s.multipart.upload(ctx, b, s.getObjectNameString(b), opt.StorageClass, data, func(r io.Reader) (io.Reader, error) {
+				return s.uploadThrottler.AddReader(ioutil.NopCloser(r))
+			})
+		}, isRetriableError))
+	}
+
 	return translateError(retry.WithExponentialBackoffNoValue(ctx, fmt.Sprintf("PutBlob(%v)", b), func() error {
 		throttled, err := s.uploadThrottler.AddReader(ioutil.NopCloser(bytes.NewReader(data)))
 		if err != nil {
@@ -127,14 +151,16 @@ func (s *s3Storage) PutBlob(ctx context.Context, b blob.ID, data []byte) error {
 		}
 
 		n, err := s.cli.PutObject(s.BucketName, s.getObjectNameString(b), throttled, int64(len(data)), minio.PutObjectOptions{
-			ContentType: "application/x-kopia",
-			Progress:    newProgressReader(progressCallback, string(b), int64(len(data))),
+			ContentType:  "application/x-kopia",
+			StorageClass: opt.StorageClass,
+			Progress:     newProgressReader(progressCallback, string(b), int64(len(data))),
 		})
 
 		if err == io.EOF && n == 0 {
 			// special case empty stream
 			_, err = s.cli.PutObject(s.BucketName, s.getObjectNameString(b), bytes.NewBuffer(nil), 0, minio.PutObjectOptions{
-				ContentType: "application/x-kopia",
+				ContentType:  "application/x-kopia",
+				StorageClass: opt.StorageClass,
 			})
 		}
 
@@ -185,6 +211,10 @@ func (s *s3Storage) ConnectionInfo() blob.ConnectionInfo {
 }
 
 func (s *s3Storage) Close(ctx context.Context) error {
+	if s.multipart != nil {
+		s.multipart.abortAll(ctx)
+	}
+
 	return nil
 }
 
@@ -226,12 +256,6 @@ func toBandwidth(bytesPerSecond int) iothrottler.Bandwidth {
 	return iothrottler.Bandwidth(bytesPerSecond) * iothrottler.BytesPerSecond
 }
 
-func getCustomTransport(insecureSkipVerify bool) (transport *http.Transport) {
-	// nolint:gosec
-	customTransport := &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: insecureSkipVerify}}
-	return customTransport
-}
-
 // New creates new S3-backed storage with specified options:
 //
 // - the 'BucketName' field is required and all other parameters are optional.
@@ -240,13 +264,31 @@ func New(ctx context.Context, opt *Options) (blob.Storage, error) {
 		return nil, errors.New("bucket name must be specified")
 	}
 
-	cli, err := minio.NewWithCredentials(opt.Endpoint, credentials.NewStaticV4(opt.AccessKeyID, opt.SecretAccessKey, opt.SessionToken), !opt.DoNotUseTLS, opt.Region)
+	if opt.ResumableUploadPartSize > 0 && opt.ResumableUploadPartSize < minMultipartPartSize {
+		return nil, errors.Errorf("resumable upload part size must be at least %v bytes", minMultipartPartSize)
+	}
+
+	creds, err := newCredentials(ctx, opt)
+	if err != nil {
+		return nil, err
+	}
+
+	cli, err := minio.NewWithCredentials(opt.Endpoint, creds, !opt.DoNotUseTLS, opt.Region)
 	if err != nil {
 		return nil, errors.Wrap(err, "unable to create client")
 	}
 
-	if opt.DoNotVerifyTLS {
-		cli.SetCustomTransport(getCustomTransport(true))
+	hc := http.DefaultClient
+
+	if opt.DoNotVerifyTLS || !opt.TransportOptions.IsDefault() {
+		t, err := opt.TransportOptions.NewTransport(opt.DoNotVerifyTLS)
+		if err != nil {
+			return nil, err
+		}
+
+		cli.SetCustomTransport(t)
+
+		hc = &http.Client{Transport: t}
 	}
 
 	downloadThrottler := iothrottler.NewIOThrottlerPool(toBandwidth(opt.MaxDownloadSpeedBytesPerSecond))
@@ -261,13 +303,27 @@ func New(ctx context.Context, opt *Options) (blob.Storage, error) {
 		return nil, errors.Errorf("bucket %q does not exist", opt.BucketName)
 	}
 
-	return &s3Storage{
+	s := &s3Storage{
 		Options:           *opt,
 		ctx:               ctx,
 		cli:               cli,
+		creds:             creds,
+		httpClient:        hc,
 		downloadThrottler: downloadThrottler,
 		uploadThrottler:   uploadThrottler,
-	}, nil
+	}
+
+	if opt.ResumableUploadPartSize > 0 {
+		var stateDir string
+		if dir := blob.LocalStateDirectory(ctx); dir != "" {
+			stateDir = filepath.Join(dir, "s3-multipart")
+		}
+
+		s.multipart = newMultipartUploader(minio.Core{Client: cli}, opt.BucketName, opt.ResumableUploadPartSize, stateDir)
+		s.multipart.abortExpired(ctx)
+	}
+
+	return s, nil
 }
 
 func init() {
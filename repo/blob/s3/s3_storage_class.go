@@ -0,0 +1,45 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+
+	minio "github.com/minio/minio-go/v6"
+
+	"github.com/kopia/kopia/repo/blob"
+)
+
+// defaultStorageClass is reported by S3 for objects without explicit storage class.
+const defaultStorageClass = "STANDARD"
+
+// SetStorageClass implements blob.StorageClassChanger by copying the object onto itself.
+//
+// Note that the copy updates the modification time of the object.
+func (s *s3Storage) SetStorageClass(ctx context.Context, b blob.ID, storageClass string) error {
+	objectName := s.getObjectNameString(b)
+
+	oi, err := s.cli.StatObjectWithContext(ctx, s.BucketName, objectName, minio.StatObjectOptions{})
+	if err != nil {
+		return translateError(err)
+	}
+
+	current := oi.Metadata.Get("X-Amz-Storage-Class")
+	if current == "" {
+		current = defaultStorageClass
+	}
+
+	if current == storageClass {
+		return nil
+	}
+
+	core := minio.Core{Client: s.cli}
+
+	_, err = exponentialBackoff(ctx, fmt.Sprintf("SetStorageClass(%q,%q)", b, storageClass), func() (interface{}, error) {
+		return core.CopyObjectWithContext(ctx, s.BucketName, objectName, s.BucketName, objectName, map[string]string{
+			"x-amz-storage-class":      storageClass,
+			"x-amz-metadata-directive": "COPY",
+		})
+	})
+
+	return translateError(err)
+}
@@ -254,7 +254,12 @@ func TestCustomTransportNoSSLVerify(t *testing.T) {
 }
 
 func getURL(url string, insecureSkipVerify bool) error {
-	client := &http.Client{Transport: getCustomTransport(insecureSkipVerify)}
+	transport, err := (&blob.TransportOptions{}).NewTransport(insecureSkipVerify)
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{Transport: transport}
 	resp, err := client.Get(url)
 
 	if err != nil {
@@ -0,0 +1,169 @@
+// Package split implements Storage which keeps metadata and data blobs in two different storage backends.
+//
+// This allows small and frequently accessed blobs, such as indexes and manifests, to live on fast storage
+// while bulk pack data lives on cheaper and slower storage.
+package split
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo/blob"
+)
+
+const splitStorageType = "split"
+
+// defaultDataPrefixes are prefixes of pack blobs holding file contents.
+var defaultDataPrefixes = []blob.ID{"p"}
+
+// Options defines options for split storage.
+type Options struct {
+	// Metadata is the storage holding all blobs that are not data blobs.
+	Metadata blob.ConnectionInfo `json:"metadata"`
+
+	// Data is the storage holding data blobs.
+	Data blob.ConnectionInfo `json:"data"`
+
+	// DataPrefixes are prefixes of blob IDs stored in data storage, defaults to data pack blobs.
+	DataPrefixes []blob.ID `json:"dataPrefixes,omitempty"`
+}
+
+type splitStorage struct {
+	metadata     blob.Storage
+	data         blob.Storage
+	dataPrefixes []blob.ID
+}
+
+func (s *splitStorage) isData(id blob.ID) bool {
+	for _, p := range s.dataPrefixes {
+		if strings.HasPrefix(string(id), string(p)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// storageFor returns the storage holding the blob with the given ID.
+func (s *splitStorage) storageFor(id blob.ID) blob.Storage {
+	if s.isData(id) {
+		return s.data
+	}
+
+	return s.metadata
+}
+
+func (s *splitStorage) GetBlob(ctx context.Context, id blob.ID, offset, length int64) ([]byte, error) {
+	return s.storageFor(id).GetBlob(ctx, id, offset, length)
+}
+
+func (s *splitStorage) PutBlob(ctx context.Context, id blob.ID, data []byte) error {
+	return s.storageFor(id).PutBlob(ctx, id, data)
+}
+
+func (s *splitStorage) PutBlobWithOptions(ctx context.Context, id blob.ID, data []byte, opt blob.PutOptions) error {
+	return blob.PutBlobWithOptions(ctx, s.storageFor(id), id, data, opt)
+}
+
+func (s *splitStorage) SetStorageClass(ctx context.Context, id blob.ID, storageClass string) error {
+	return blob.SetStorageClass(ctx, s.storageFor(id), id, storageClass)
+}
+
+func (s *splitStorage) RestoreArchivedBlob(ctx context.Context, id blob.ID, days int) (bool, error) {
+	return blob.RestoreArchivedBlob(ctx, s.storageFor(id), id, days)
+}
+
+func (s *splitStorage) DeleteBlob(ctx context.Context, id blob.ID) error {
+	return s.storageFor(id).DeleteBlob(ctx, id)
+}
+
+func (s *splitStorage) ListBlobs(ctx context.Context, prefix blob.ID, callback func(blob.Metadata) error) error {
+	if s.isData(prefix) {
+		return s.data.ListBlobs(ctx, prefix, callback)
+	}
+
+	if err := s.metadata.ListBlobs(ctx, prefix, func(bm blob.Metadata) error {
+		if s.isData(bm.BlobID) {
+			// ignore data blobs accidentally placed in metadata storage.
+			return nil
+		}
+
+		return callback(bm)
+	}); err != nil {
+		return err
+	}
+
+	// list data blobs whose prefix is more specific than the provided one, such as when listing all blobs.
+	for _, p := range s.dataPrefixes {
+		if strings.HasPrefix(string(p), string(prefix)) {
+			if err := s.data.ListBlobs(ctx, p, callback); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s *splitStorage) ConnectionInfo() blob.ConnectionInfo {
+	return blob.ConnectionInfo{
+		Type: splitStorageType,
+		Config: &Options{
+			Metadata:     s.metadata.ConnectionInfo(),
+			Data:         s.data.ConnectionInfo(),
+			DataPrefixes: s.dataPrefixes,
+		},
+	}
+}
+
+func (s *splitStorage) Close(ctx context.Context) error {
+	err := s.data.Close(ctx)
+
+	if err2 := s.metadata.Close(ctx); err == nil {
+		err = err2
+	}
+
+	return err
+}
+
+// NewStorage returns a Storage keeping blobs with the provided prefixes in data storage
+// and all other blobs in metadata storage. When no prefixes are provided, data pack blobs
+// are kept in data storage.
+func NewStorage(metadata, data blob.Storage, dataPrefixes []blob.ID) blob.Storage {
+	if len(dataPrefixes) == 0 {
+		dataPrefixes = defaultDataPrefixes
+	}
+
+	return &splitStorage{
+		metadata:     metadata,
+		data:         data,
+		dataPrefixes: dataPrefixes,
+	}
+}
+
+// New creates new split storage by connecting to both of the underlying storage backends.
+func New(ctx context.Context, opt *Options) (blob.Storage, error) {
+	metadata, err := blob.NewStorage(ctx, opt.Metadata)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to connect to metadata storage")
+	}
+
+	data, err := blob.NewStorage(ctx, opt.Data)
+	if err != nil {
+		metadata.Close(ctx) //nolint:errcheck
+		return nil, errors.Wrap(err, "unable to connect to data storage")
+	}
+
+	return NewStorage(metadata, data, opt.DataPrefixes), nil
+}
+
+func init() {
+	blob.AddSupportedStorage(
+		splitStorageType,
+		func() interface{} { return &Options{} },
+		func(ctx context.Context, o interface{}) (blob.Storage, error) {
+			return New(ctx, o.(*Options))
+		})
+}
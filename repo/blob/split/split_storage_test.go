@@ -0,0 +1,55 @@
+package split
+
+import (
+	"testing"
+
+	"github.com/kopia/kopia/internal/blobtesting"
+	"github.com/kopia/kopia/internal/testlogging"
+	"github.com/kopia/kopia/repo/blob"
+)
+
+func TestSplitStorage(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	blobtesting.VerifyStorage(ctx, t, NewStorage(
+		blobtesting.NewMapStorage(blobtesting.DataMap{}, nil, nil),
+		blobtesting.NewMapStorage(blobtesting.DataMap{}, nil, nil),
+		nil))
+
+	metadataData := blobtesting.DataMap{}
+	dataData := blobtesting.DataMap{}
+
+	st := NewStorage(
+		blobtesting.NewMapStorage(metadataData, nil, nil),
+		blobtesting.NewMapStorage(dataData, nil, nil),
+		nil)
+
+	for _, id := range []string{"p1", "p2", "q1", "n1", "kopia.repository"} {
+		if err := st.PutBlob(ctx, blob.ID(id), []byte{1, 2}); err != nil {
+			t.Fatalf("unable to write %v: %v", id, err)
+		}
+	}
+
+	if len(dataData) != 2 || dataData["p1"] == nil || dataData["p2"] == nil {
+		t.Errorf("unexpected blobs in data storage: %v", dataData)
+	}
+
+	if len(metadataData) != 3 || metadataData["p1"] != nil {
+		t.Errorf("unexpected blobs in metadata storage: %v", metadataData)
+	}
+
+	blobtesting.AssertGetBlob(ctx, t, st, "p1", []byte{1, 2})
+	blobtesting.AssertGetBlob(ctx, t, st, "q1", []byte{1, 2})
+
+	blobtesting.AssertListResults(ctx, t, st, "", "kopia.repository", "n1", "p1", "p2", "q1")
+	blobtesting.AssertListResults(ctx, t, st, "p", "p1", "p2")
+	blobtesting.AssertListResults(ctx, t, st, "q", "q1")
+
+	if err := st.DeleteBlob(ctx, "p1"); err != nil {
+		t.Fatalf("unable to delete blob: %v", err)
+	}
+
+	if _, ok := dataData["p1"]; ok {
+		t.Errorf("blob not deleted from data storage")
+	}
+}
@@ -58,6 +58,9 @@ type Metadata struct {
 // ErrBlobNotFound is returned when a BLOB cannot be found in storage.
 var ErrBlobNotFound = errors.New("BLOB not found")
 
+// ErrStorageFull is returned when a BLOB cannot be written because the storage is out of space or over quota.
+var ErrStorageFull = errors.New("storage is full")
+
 // ListAllBlobs returns Metadata for all blobs in a given storage that have the provided name prefix.
 func ListAllBlobs(ctx context.Context, st Storage, prefix ID) ([]Metadata, error) {
 	var result []Metadata
@@ -0,0 +1,48 @@
+package blob
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+)
+
+// ErrStorageClassNotSupported is returned when the storage does not support changing storage classes of blobs.
+var ErrStorageClassNotSupported = errors.New("storage classes are not supported")
+
+// PutOptions specifies optional attributes of a blob being written.
+type PutOptions struct {
+	// StorageClass is the provider-specific storage class (such as STANDARD_IA in S3 or Cool in Azure),
+	// empty uses the default class of the storage.
+	StorageClass string
+}
+
+// PutterWithOptions is implemented by storage providers which support optional attributes of written blobs.
+type PutterWithOptions interface {
+	PutBlobWithOptions(ctx context.Context, blobID ID, data []byte, opt PutOptions) error
+}
+
+// StorageClassChanger is implemented by storage providers which can move existing blobs between storage classes.
+type StorageClassChanger interface {
+	// SetStorageClass changes the storage class of the provided blob, it does nothing if the blob
+	// already uses that class.
+	SetStorageClass(ctx context.Context, blobID ID, storageClass string) error
+}
+
+// PutBlobWithOptions writes the blob with provided attributes if the storage supports them,
+// otherwise the attributes are ignored.
+func PutBlobWithOptions(ctx context.Context, st Storage, blobID ID, data []byte, opt PutOptions) error {
+	if p, ok := st.(PutterWithOptions); ok && opt != (PutOptions{}) {
+		return p.PutBlobWithOptions(ctx, blobID, data, opt)
+	}
+
+	return st.PutBlob(ctx, blobID, data)
+}
+
+// SetStorageClass changes the storage class of the blob or returns ErrStorageClassNotSupported.
+func SetStorageClass(ctx context.Context, st Storage, blobID ID, storageClass string) error {
+	if c, ok := st.(StorageClassChanger); ok {
+		return c.SetStorageClass(ctx, blobID, storageClass)
+	}
+
+	return ErrStorageClassNotSupported
+}
@@ -1,6 +1,7 @@
 package blob_test
 
 import (
+	"errors"
 	"testing"
 	"time"
 
@@ -55,3 +56,26 @@ func TestListAllBlobsConsistentEmpty(t *testing.T) {
 		t.Errorf("unexpected list result count: %v, want %v", got, want)
 	}
 }
+
+func TestCopyBlob(t *testing.T) {
+	ctx := testlogging.Context(t)
+	src := blobtesting.NewMapStorage(blobtesting.DataMap{}, nil, time.Now)
+	dst := blobtesting.NewMapStorage(blobtesting.DataMap{}, nil, time.Now)
+
+	src.PutBlob(ctx, "foo1", []byte{1, 2, 3, 4}) //nolint:errcheck
+
+	serverSide, err := blob.CopyBlob(ctx, dst, src, "foo1")
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+
+	if serverSide {
+		t.Errorf("unexpected server-side copy")
+	}
+
+	blobtesting.AssertGetBlob(ctx, t, dst, "foo1", []byte{1, 2, 3, 4})
+
+	if _, err := blob.CopyBlob(ctx, dst, src, "no-such-blob"); !errors.Is(err, blob.ErrBlobNotFound) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
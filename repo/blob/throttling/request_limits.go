@@ -0,0 +1,156 @@
+package throttling
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Classes of storage requests limited independently, since providers usually throttle and bill them separately.
+const (
+	RequestGet    = "get"
+	RequestPut    = "put"
+	RequestList   = "list"
+	RequestDelete = "delete"
+)
+
+// RequestClasses lists all classes of requests.
+var RequestClasses = []string{RequestGet, RequestPut, RequestList, RequestDelete}
+
+// RequestLimit limits the rate and concurrency of requests of one class, zero means unlimited.
+type RequestLimit struct {
+	PerSecond     float64 `json:"perSecond,omitempty"`
+	MaxConcurrent int     `json:"maxConcurrent,omitempty"`
+}
+
+// requestClass tracks requests of one class.
+type requestClass struct {
+	limit RequestLimit
+
+	// next is the time when the next request may start.
+	next time.Time
+
+	// sem has capacity of the maximum number of concurrent requests, nil when unlimited.
+	sem chan struct{}
+}
+
+// reserve accounts for a request started at the provided time and returns how long the caller must wait before starting it.
+func (c *requestClass) reserve(now time.Time) time.Duration {
+	if c.limit.PerSecond <= 0 {
+		c.next = time.Time{}
+		return 0
+	}
+
+	if c.next.Before(now) {
+		c.next = now
+	}
+
+	delay := c.next.Sub(now)
+	c.next = c.next.Add(time.Duration(float64(time.Second) / c.limit.PerSecond))
+
+	return delay
+}
+
+// ValidateRequestLimit returns an error if the class or the limit are invalid.
+func ValidateRequestLimit(class string, limit RequestLimit) error {
+	if !isValidRequestClass(class) {
+		return errors.Errorf("invalid request class %q, must be one of %v", class, RequestClasses)
+	}
+
+	if limit.PerSecond < 0 || limit.MaxConcurrent < 0 {
+		return errors.Errorf("invalid limit of %v requests: %+v", class, limit)
+	}
+
+	return nil
+}
+
+// SetRequestLimit sets the limit of requests of the provided class.
+func (l *Limiter) SetRequestLimit(class string, limit RequestLimit) error {
+	if err := ValidateRequestLimit(class, limit); err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	c := l.requestClass(class)
+	c.limit = limit
+
+	// requests in progress release the semaphore they acquired.
+	c.sem = nil
+	if limit.MaxConcurrent > 0 {
+		c.sem = make(chan struct{}, limit.MaxConcurrent)
+	}
+
+	return nil
+}
+
+// RequestLimits returns the limits of all limited classes of requests.
+func (l *Limiter) RequestLimits() map[string]RequestLimit {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	result := map[string]RequestLimit{}
+
+	for class, c := range l.requests {
+		if c.limit != (RequestLimit{}) {
+			result[class] = c.limit
+		}
+	}
+
+	return result
+}
+
+func (l *Limiter) requestClass(class string) *requestClass {
+	if l.requests == nil {
+		l.requests = map[string]*requestClass{}
+	}
+
+	c := l.requests[class]
+	if c == nil {
+		c = &requestClass{}
+		l.requests[class] = c
+	}
+
+	return c
+}
+
+// startRequest waits until a request of the provided class may start and returns the function
+// that must be called when it completes.
+func (l *Limiter) startRequest(ctx context.Context, class string) (func(), error) {
+	l.mu.Lock()
+	c := l.requestClass(class)
+	delay := c.reserve(l.timeNow())
+	sem := c.sem
+	l.mu.Unlock()
+
+	if delay > 0 {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+
+	if sem == nil {
+		return func() {}, nil
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case sem <- struct{}{}:
+		return func() { <-sem }, nil
+	}
+}
+
+func isValidRequestClass(class string) bool {
+	for _, c := range RequestClasses {
+		if c == class {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,196 @@
+// Package throttling implements wrapper around Storage that limits the bandwidth of uploads and downloads
+// and the rate and concurrency of requests.
+package throttling
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/kopia/kopia/internal/clock"
+	"github.com/kopia/kopia/repo/blob"
+)
+
+// Limiter limits the rate of bytes uploaded to and downloaded from the storage and the rate and
+// concurrency of requests. The limits can be changed at any time and zero means unlimited.
+type Limiter struct {
+	timeNow func() time.Time
+
+	mu       sync.Mutex
+	upload   bucket
+	download bucket
+	requests map[string]*requestClass
+}
+
+// bucket spaces out transfers so that their average rate doesn't exceed the limit.
+type bucket struct {
+	bytesPerSecond int64
+
+	// next is the time when the next transfer may start.
+	next time.Time
+}
+
+// reserve accounts for the transfer of n bytes at the provided time and returns how long the caller must wait before transferring.
+func (b *bucket) reserve(n int64, now time.Time) time.Duration {
+	if b.bytesPerSecond <= 0 {
+		b.next = time.Time{}
+		return 0
+	}
+
+	if b.next.Before(now) {
+		b.next = now
+	}
+
+	delay := b.next.Sub(now)
+	b.next = b.next.Add(time.Duration(float64(n) / float64(b.bytesPerSecond) * float64(time.Second)))
+
+	return delay
+}
+
+// SetLimits sets the maximum upload and download rates in bytes per second, zero means unlimited.
+func (l *Limiter) SetLimits(uploadBytesPerSecond, downloadBytesPerSecond int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.upload.bytesPerSecond = uploadBytesPerSecond
+	l.download.bytesPerSecond = downloadBytesPerSecond
+}
+
+// Limits returns the current maximum upload and download rates in bytes per second.
+func (l *Limiter) Limits() (uploadBytesPerSecond, downloadBytesPerSecond int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.upload.bytesPerSecond, l.download.bytesPerSecond
+}
+
+func (l *Limiter) wait(ctx context.Context, b *bucket, n int64) error {
+	l.mu.Lock()
+	delay := b.reserve(n, l.timeNow())
+	l.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(delay):
+		return nil
+	}
+}
+
+// NewLimiter returns a Limiter with no limits.
+func NewLimiter() *Limiter {
+	return &Limiter{timeNow: clock.Now}
+}
+
+type throttlingStorage struct {
+	base    blob.Storage
+	limiter *Limiter
+}
+
+func (s *throttlingStorage) GetBlob(ctx context.Context, id blob.ID, offset, length int64) ([]byte, error) {
+	done, err := s.limiter.startRequest(ctx, RequestGet)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := s.base.GetBlob(ctx, id, offset, length)
+
+	done()
+
+	if err != nil {
+		return nil, err
+	}
+
+	// the size is only known after download, so the wait delays subsequent downloads.
+	if err := s.limiter.wait(ctx, &s.limiter.download, int64(len(data))); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+func (s *throttlingStorage) PutBlob(ctx context.Context, id blob.ID, data []byte) error {
+	if err := s.limiter.wait(ctx, &s.limiter.upload, int64(len(data))); err != nil {
+		return err
+	}
+
+	done, err := s.limiter.startRequest(ctx, RequestPut)
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	return s.base.PutBlob(ctx, id, data)
+}
+
+func (s *throttlingStorage) PutBlobWithOptions(ctx context.Context, id blob.ID, data []byte, opt blob.PutOptions) error {
+	if err := s.limiter.wait(ctx, &s.limiter.upload, int64(len(data))); err != nil {
+		return err
+	}
+
+	done, err := s.limiter.startRequest(ctx, RequestPut)
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	return blob.PutBlobWithOptions(ctx, s.base, id, data, opt)
+}
+
+func (s *throttlingStorage) SetStorageClass(ctx context.Context, id blob.ID, storageClass string) error {
+	done, err := s.limiter.startRequest(ctx, RequestPut)
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	return blob.SetStorageClass(ctx, s.base, id, storageClass)
+}
+
+func (s *throttlingStorage) RestoreArchivedBlob(ctx context.Context, id blob.ID, days int) (bool, error) {
+	done, err := s.limiter.startRequest(ctx, RequestPut)
+	if err != nil {
+		return false, err
+	}
+	defer done()
+
+	return blob.RestoreArchivedBlob(ctx, s.base, id, days)
+}
+
+func (s *throttlingStorage) DeleteBlob(ctx context.Context, id blob.ID) error {
+	done, err := s.limiter.startRequest(ctx, RequestDelete)
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	return s.base.DeleteBlob(ctx, id)
+}
+
+// ListBlobs counts each listing as a single request, even though providers may need several requests to return all pages.
+func (s *throttlingStorage) ListBlobs(ctx context.Context, prefix blob.ID, callback func(blob.Metadata) error) error {
+	done, err := s.limiter.startRequest(ctx, RequestList)
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	return s.base.ListBlobs(ctx, prefix, callback)
+}
+
+func (s *throttlingStorage) Close(ctx context.Context) error {
+	return s.base.Close(ctx)
+}
+
+func (s *throttlingStorage) ConnectionInfo() blob.ConnectionInfo {
+	return s.base.ConnectionInfo()
+}
+
+// NewWrapper returns a Storage wrapper that limits bandwidth of blob uploads and downloads and requests using the provided limiter.
+func NewWrapper(wrapped blob.Storage, l *Limiter) blob.Storage {
+	return &throttlingStorage{base: wrapped, limiter: l}
+}
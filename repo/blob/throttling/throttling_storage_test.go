@@ -0,0 +1,134 @@
+package throttling
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/blobtesting"
+	"github.com/kopia/kopia/internal/testlogging"
+	"github.com/kopia/kopia/repo/blob"
+)
+
+func TestThrottlingStorageUnlimited(t *testing.T) {
+	ctx := testlogging.Context(t)
+	data := blobtesting.DataMap{}
+
+	st := NewWrapper(blobtesting.NewMapStorage(data, nil, nil), NewLimiter())
+
+	blobtesting.VerifyStorage(ctx, t, st)
+}
+
+func TestBucketReserve(t *testing.T) {
+	t0 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	b := bucket{bytesPerSecond: 1000}
+
+	cases := []struct {
+		now       time.Time
+		n         int64
+		wantDelay time.Duration
+	}{
+		{t0, 500, 0},
+		{t0, 1000, 500 * time.Millisecond},
+		{t0.Add(time.Second), 100, 500 * time.Millisecond},
+		// idle time doesn't accumulate.
+		{t0.Add(10 * time.Second), 100, 0},
+		{t0.Add(10 * time.Second), 100, 100 * time.Millisecond},
+	}
+
+	for i, tc := range cases {
+		if got := b.reserve(tc.n, tc.now); got != tc.wantDelay {
+			t.Errorf("case %v: unexpected delay %v, want %v", i, got, tc.wantDelay)
+		}
+	}
+
+	b.bytesPerSecond = 0
+
+	if got := b.reserve(1e9, t0); got != 0 {
+		t.Errorf("unexpected delay when unlimited: %v", got)
+	}
+}
+
+func TestThrottlingStorageDelaysUploads(t *testing.T) {
+	ctx := testlogging.Context(t)
+	l := NewLimiter()
+	l.SetLimits(10000, 0)
+
+	st := NewWrapper(blobtesting.NewMapStorage(blobtesting.DataMap{}, nil, nil), l)
+
+	t0 := time.Now()
+
+	for _, id := range []string{"a", "b", "c"} {
+		if err := st.PutBlob(ctx, blob.ID(id), make([]byte, 1000)); err != nil {
+			t.Fatalf("error: %v", err)
+		}
+	}
+
+	// the first upload is immediate, the following two wait 100ms each.
+	if dt := time.Since(t0); dt < 200*time.Millisecond {
+		t.Errorf("uploads were not throttled: %v", dt)
+	}
+}
+
+func TestRequestClassReserve(t *testing.T) {
+	t0 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	c := requestClass{limit: RequestLimit{PerSecond: 10}}
+
+	for i, want := range []time.Duration{0, 100 * time.Millisecond, 200 * time.Millisecond} {
+		if got := c.reserve(t0); got != want {
+			t.Errorf("request %v: unexpected delay %v, want %v", i, got, want)
+		}
+	}
+
+	// idle time doesn't accumulate.
+	if got := c.reserve(t0.Add(time.Minute)); got != 0 {
+		t.Errorf("unexpected delay after idle time: %v", got)
+	}
+}
+
+func TestThrottlingStorageLimitsConcurrentRequests(t *testing.T) {
+	ctx := testlogging.Context(t)
+	l := NewLimiter()
+
+	if err := l.SetRequestLimit(RequestDelete, RequestLimit{MaxConcurrent: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := l.SetRequestLimit("copy", RequestLimit{PerSecond: 1}); err == nil {
+		t.Errorf("invalid request class was accepted")
+	}
+
+	if got, want := l.RequestLimits(), map[string]RequestLimit{RequestDelete: {MaxConcurrent: 1}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected limits: %v, want %v", got, want)
+	}
+
+	done, err := l.startRequest(ctx, RequestDelete)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	st := NewWrapper(blobtesting.NewMapStorage(blobtesting.DataMap{}, nil, nil), l)
+
+	// requests of other classes are not affected.
+	if err := st.PutBlob(ctx, "a", []byte{1}); err != nil {
+		t.Fatalf("error: %v", err)
+	}
+
+	cctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+
+	if err := st.DeleteBlob(cctx, "a"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("delete was not blocked by the concurrent request: %v", err)
+	}
+
+	done()
+
+	if err := st.DeleteBlob(ctx, "a"); err != nil {
+		t.Fatalf("error: %v", err)
+	}
+}
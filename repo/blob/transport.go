@@ -0,0 +1,179 @@
+package blob
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// TransportOptions specifies settings of the HTTP transport used by storage providers accessed over HTTP(S).
+type TransportOptions struct {
+	// ProxyURL is the URL of the HTTP(S) proxy, if empty the proxy is determined from
+	// HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables.
+	ProxyURL string `json:"proxyURL,omitempty"`
+
+	// RootCAFile is the name of a PEM file with certificate authorities trusted in addition to system ones.
+	RootCAFile string `json:"rootCAFile,omitempty"`
+
+	// TLSMinVersion is the minimum TLS version to use, one of "1.0", "1.1", "1.2" or "1.3".
+	TLSMinVersion string `json:"tlsMinVersion,omitempty"`
+
+	// IPFamily restricts connections to "ipv4" or "ipv6" addresses, both are used when empty.
+	IPFamily string `json:"ipFamily,omitempty"`
+
+	// HostOverrides maps host names to addresses used to connect to them instead of resolving them.
+	HostOverrides map[string]string `json:"hostOverrides,omitempty"`
+
+	// DNSServer is the address of the DNS server used to resolve host names instead of the system resolver.
+	DNSServer string `json:"dnsServer,omitempty"`
+}
+
+const (
+	dialTimeout   = 30 * time.Second
+	dialKeepAlive = 30 * time.Second
+	dnsPort       = "53"
+)
+
+var ipFamilyNetworks = map[string]string{
+	"ipv4": "tcp4",
+	"ipv6": "tcp6",
+}
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// IsDefault returns true if the options don't customize the transport.
+func (o *TransportOptions) IsDefault() bool {
+	return o.ProxyURL == "" &&
+		o.RootCAFile == "" &&
+		o.TLSMinVersion == "" &&
+		o.IPFamily == "" &&
+		len(o.HostOverrides) == 0 &&
+		o.DNSServer == ""
+}
+
+// NewTransport returns new HTTP transport configured according to the options.
+func (o *TransportOptions) NewTransport(insecureSkipVerify bool) (*http.Transport, error) {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+
+	if o.ProxyURL != "" {
+		u, err := url.Parse(o.ProxyURL)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid proxy URL")
+		}
+
+		t.Proxy = http.ProxyURL(u)
+	}
+
+	t.TLSClientConfig = &tls.Config{
+		InsecureSkipVerify: insecureSkipVerify, //nolint:gosec
+	}
+
+	if o.TLSMinVersion != "" {
+		v, ok := tlsVersions[o.TLSMinVersion]
+		if !ok {
+			return nil, errors.Errorf("unsupported TLS version %q", o.TLSMinVersion)
+		}
+
+		t.TLSClientConfig.MinVersion = v
+	}
+
+	if o.RootCAFile != "" {
+		pool, err := rootCAs(o.RootCAFile)
+		if err != nil {
+			return nil, err
+		}
+
+		t.TLSClientConfig.RootCAs = pool
+	}
+
+	if o.IPFamily != "" || len(o.HostOverrides) > 0 || o.DNSServer != "" {
+		dial, err := o.dialContextFunc()
+		if err != nil {
+			return nil, err
+		}
+
+		t.DialContext = dial
+	}
+
+	return t, nil
+}
+
+func (o *TransportOptions) dialContextFunc() (func(ctx context.Context, network, addr string) (net.Conn, error), error) {
+	dialNetwork := ""
+
+	if o.IPFamily != "" {
+		n, ok := ipFamilyNetworks[o.IPFamily]
+		if !ok {
+			return nil, errors.Errorf("unsupported IP family %q", o.IPFamily)
+		}
+
+		dialNetwork = n
+	}
+
+	d := &net.Dialer{
+		Timeout:   dialTimeout,
+		KeepAlive: dialKeepAlive,
+	}
+
+	if o.DNSServer != "" {
+		dnsServer := o.DNSServer
+		if _, _, err := net.SplitHostPort(dnsServer); err != nil {
+			dnsServer = net.JoinHostPort(dnsServer, dnsPort)
+		}
+
+		d.Resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				var dnsDialer net.Dialer
+				return dnsDialer.DialContext(ctx, network, dnsServer)
+			},
+		}
+	}
+
+	overrides := o.HostOverrides
+
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if dialNetwork != "" {
+			network = dialNetwork
+		}
+
+		if host, port, err := net.SplitHostPort(addr); err == nil {
+			if a, ok := overrides[host]; ok {
+				addr = net.JoinHostPort(a, port)
+			}
+		}
+
+		return d.DialContext(ctx, network, addr)
+	}, nil
+}
+
+func rootCAs(fname string) (*x509.CertPool, error) {
+	data, err := ioutil.ReadFile(fname) //nolint:gosec
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read root CA file")
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		// system pool is not available on all platforms.
+		pool = x509.NewCertPool()
+	}
+
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, errors.Errorf("no certificates found in %v", fname)
+	}
+
+	return pool, nil
+}
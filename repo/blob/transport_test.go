@@ -0,0 +1,112 @@
+package blob
+
+import (
+	"crypto/tls"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTransportOptions(t *testing.T) {
+	var o TransportOptions
+
+	if !o.IsDefault() {
+		t.Errorf("empty options are not default")
+	}
+
+	tr, err := o.NewTransport(true)
+	if err != nil {
+		t.Fatalf("unable to create transport: %v", err)
+	}
+
+	if !tr.TLSClientConfig.InsecureSkipVerify {
+		t.Errorf("TLS verification not disabled")
+	}
+
+	o = TransportOptions{ProxyURL: "http://proxy:3128", TLSMinVersion: "1.2"}
+
+	tr, err = o.NewTransport(false)
+	if err != nil {
+		t.Fatalf("unable to create transport: %v", err)
+	}
+
+	if got, want := tr.TLSClientConfig.MinVersion, uint16(tls.VersionTLS12); got != want {
+		t.Errorf("invalid TLS min version: %v, want %v", got, want)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, "https://storage.example.com/", nil)
+
+	u, err := tr.Proxy(req)
+	if err != nil || u == nil || u.Host != "proxy:3128" {
+		t.Errorf("invalid proxy: %v %v", u, err)
+	}
+
+	if _, err := (&TransportOptions{TLSMinVersion: "0.9"}).NewTransport(false); err == nil {
+		t.Errorf("expected error for unsupported TLS version")
+	}
+
+	tmpDir, err := ioutil.TempDir("", "kopia-transport")
+	if err != nil {
+		t.Fatalf("error getting temp dir: %v", err)
+	}
+
+	defer os.RemoveAll(tmpDir)
+
+	badCA := filepath.Join(tmpDir, "bad.pem")
+	if err := ioutil.WriteFile(badCA, []byte("not a certificate"), 0600); err != nil {
+		t.Fatalf("unable to write file: %v", err)
+	}
+
+	if _, err := (&TransportOptions{RootCAFile: badCA}).NewTransport(false); err == nil {
+		t.Errorf("expected error for invalid root CA file")
+	}
+
+	if _, err := (&TransportOptions{RootCAFile: filepath.Join(tmpDir, "no-such-file")}).NewTransport(false); err == nil {
+		t.Errorf("expected error for missing root CA file")
+	}
+}
+
+func TestTransportOptionsResolution(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	_, port, err := net.SplitHostPort(srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("invalid server address: %v", err)
+	}
+
+	o := TransportOptions{
+		IPFamily:      "ipv4",
+		HostOverrides: map[string]string{"storage.example.invalid": "127.0.0.1"},
+	}
+
+	if o.IsDefault() {
+		t.Errorf("options with host overrides are default")
+	}
+
+	tr, err := o.NewTransport(false)
+	if err != nil {
+		t.Fatalf("unable to create transport: %v", err)
+	}
+
+	resp, err := (&http.Client{Transport: tr}).Get("http://storage.example.invalid:" + port + "/")
+	if err != nil {
+		t.Fatalf("unable to connect using host override: %v", err)
+	}
+
+	resp.Body.Close() //nolint:errcheck
+
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("unexpected status: %v", resp.Status)
+	}
+
+	if _, err := (&TransportOptions{IPFamily: "ipx"}).NewTransport(false); err == nil {
+		t.Errorf("expected error for unsupported IP family")
+	}
+}
@@ -1,11 +1,15 @@
 package webdav
 
+import "github.com/kopia/kopia/repo/blob"
+
 // Options defines options for Filesystem-backed storage.
 type Options struct {
 	URL             string `json:"url"`
 	DirectoryShards []int  `json:"dirShards"`
 	Username        string `json:"username,omitempty"`
 	Password        string `json:"password,omitempty" kopia:"sensitive"`
+
+	blob.TransportOptions
 }
 
 func (fso *Options) shards() []int {
@@ -163,11 +163,22 @@ func isRetriable(err error) bool {
 
 // New creates new WebDAV-backed storage in a specified URL.
 func New(ctx context.Context, opts *Options) (blob.Storage, error) {
+	cli := gowebdav.NewClient(opts.URL, opts.Username, opts.Password)
+
+	if !opts.TransportOptions.IsDefault() {
+		t, err := opts.TransportOptions.NewTransport(false)
+		if err != nil {
+			return nil, err
+		}
+
+		cli.SetTransport(t)
+	}
+
 	return &davStorage{
 		sharded.Storage{
 			Impl: &davStorageImpl{
 				Options: *opts,
-				cli:     gowebdav.NewClient(opts.URL, opts.Username, opts.Password),
+				cli:     cli,
 			},
 			RootPath: "",
 			Suffix:   fsStorageChunkSuffix,
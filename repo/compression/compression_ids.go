@@ -22,4 +22,8 @@ const (
 	headerPgzipDefault         HeaderID = 0x1300
 	headerPgzipBestSpeed       HeaderID = 0x1301
 	headerPgzipBestCompression HeaderID = 0x1302
+
+	// numeric compression levels are stored in the lowest byte.
+	headerZstdLevel HeaderID = 0x1400
+	headerGzipLevel HeaderID = 0x1500
 )
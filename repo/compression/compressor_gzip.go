@@ -3,6 +3,7 @@ package compression
 import (
 	"bytes"
 	"compress/gzip"
+	"fmt"
 	"sync"
 
 	"github.com/pkg/errors"
@@ -14,6 +15,10 @@ func init() {
 	RegisterCompressor("gzip", newGZipCompressor(headerGzipDefault, gzip.DefaultCompression))
 	RegisterCompressor("gzip-best-speed", newGZipCompressor(headerGzipBestSpeed, gzip.BestSpeed))
 	RegisterCompressor("gzip-best-compression", newGZipCompressor(headerGzipBestCompression, gzip.BestCompression))
+
+	for level := gzip.BestSpeed; level <= gzip.BestCompression; level++ {
+		RegisterCompressor(Name(fmt.Sprintf("gzip-%v", level)), newGZipCompressor(headerGzipLevel+HeaderID(level), level))
+	}
 }
 
 func newGZipCompressor(id HeaderID, level int) Compressor {
@@ -2,6 +2,7 @@ package compression
 
 import (
 	"bytes"
+	"fmt"
 	"sync"
 
 	"github.com/klauspost/compress/zstd"
@@ -15,8 +16,15 @@ func init() {
 	RegisterCompressor("zstd-fastest", newZstdCompressor(headerZstdFastest, zstd.SpeedFastest))
 	RegisterCompressor("zstd-better-compression", newZstdCompressor(headerZstdBetterCompression, zstd.SpeedBetterCompression))
 	RegisterCompressor("zstd-best-compression", newZstdCompressor(headerZstdBestCompression, zstd.SpeedBestCompression))
+
+	// numeric levels use the encoder level that most closely matches the reference zstd implementation.
+	for level := 1; level <= maxZstdLevel; level++ {
+		RegisterCompressor(Name(fmt.Sprintf("zstd-%v", level)), newZstdCompressor(headerZstdLevel+HeaderID(level), zstd.EncoderLevelFromZstd(level)))
+	}
 }
 
+const maxZstdLevel = 22
+
 func newZstdCompressor(id HeaderID, level zstd.EncoderLevel) Compressor {
 	return &zstdCompressor{id, compressionHeader(id), sync.Pool{
 		New: func() interface{} {
@@ -8,10 +8,12 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/pkg/errors"
 
 	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/blob/throttling"
 	"github.com/kopia/kopia/repo/content"
 )
 
@@ -20,6 +22,13 @@ type ConnectOptions struct {
 	PersistCredentials bool   `json:"persistCredentials"`
 	HostnameOverride   string `json:"hostnameOverride"`
 	UsernameOverride   string `json:"usernameOverride"`
+	LocalReplicaPath   string `json:"localReplicaPath,omitempty"`
+	AppendOnly         bool   `json:"appendOnly,omitempty"`
+
+	RequestLimits map[string]throttling.RequestLimit `json:"requestLimits,omitempty"`
+
+	// DetectListConsistencyDelay measures the list consistency delay of the storage unless it's provided in caching options.
+	DetectListConsistencyDelay bool `json:"detectListConsistencyDelay,omitempty"`
 
 	content.CachingOptions
 }
@@ -53,15 +62,36 @@ func Connect(ctx context.Context, configFile string, st blob.Storage, password s
 
 	lc.Hostname = opt.HostnameOverride
 	if lc.Hostname == "" {
-		lc.Hostname = getDefaultHostName(ctx)
+		lc.Hostname = GetDefaultHostName(ctx)
 	}
 
 	lc.Username = opt.UsernameOverride
 	if lc.Username == "" {
-		lc.Username = getDefaultUserName(ctx)
+		lc.Username = GetDefaultUserName(ctx)
+	}
+
+	if opt.LocalReplicaPath != "" {
+		if lc.LocalReplicaPath, err = filepath.Abs(opt.LocalReplicaPath); err != nil {
+			return errors.Wrap(err, "invalid local replica path")
+		}
+	}
+
+	lc.AppendOnly = opt.AppendOnly
+
+	for class, l := range opt.RequestLimits {
+		if err := throttling.ValidateRequestLimit(class, l); err != nil {
+			return err
+		}
+	}
+
+	lc.RequestLimits = opt.RequestLimits
+
+	caching := opt.CachingOptions
+	if opt.DetectListConsistencyDelay && caching.ListConsistencyDelaySec == 0 && !opt.AppendOnly {
+		caching.ListConsistencyDelaySec = detectListConsistencyDelay(ctx, st)
 	}
 
-	if err = setupCaching(ctx, configFile, &lc, opt.CachingOptions, f.UniqueID); err != nil {
+	if err = setupCaching(ctx, configFile, &lc, caching, f.UniqueID); err != nil {
 		return errors.Wrap(err, "unable to set up caching")
 	}
 
@@ -98,9 +128,36 @@ func Connect(ctx context.Context, configFile string, st blob.Storage, password s
 		deletePassword(ctx, configFile)
 	}
 
+	if lc.Caching.ManifestMirror {
+		// populate the mirror, so that manifests can be listed offline right away.
+		if err := r.Manifests.Refresh(ctx); err != nil {
+			log(ctx).Warningf("unable to refresh manifest mirror: %v", err)
+		}
+	}
+
 	return r.Close(ctx)
 }
 
+// maxListConsistencyProbeTime is the maximum time to wait for a blob written when connecting to appear in listings.
+const maxListConsistencyProbeTime = time.Minute
+
+// detectListConsistencyDelay returns the list consistency delay of the storage in seconds, zero if it can't be determined.
+func detectListConsistencyDelay(ctx context.Context, st blob.Storage) int {
+	d, err := content.DetectListConsistencyDelay(ctx, st, maxListConsistencyProbeTime)
+	if err != nil {
+		log(ctx).Warningf("unable to detect list consistency delay, set it explicitly if listings of the storage are eventually consistent: %v", err)
+		return 0
+	}
+
+	if d == 0 {
+		return 0
+	}
+
+	log(ctx).Infof("storage listings are eventually consistent, using list consistency delay of %v", d.Round(time.Second))
+
+	return int((d + time.Second - 1) / time.Second)
+}
+
 func setupCaching(ctx context.Context, configPath string, lc *LocalConfig, opt content.CachingOptions, uniqueID []byte) error {
 	if opt.MaxCacheSizeBytes == 0 {
 		lc.Caching = content.CachingOptions{}
@@ -129,6 +186,9 @@ func setupCaching(ctx context.Context, configPath string, lc *LocalConfig, opt c
 	lc.Caching.MaxCacheSizeBytes = opt.MaxCacheSizeBytes
 	lc.Caching.MaxMetadataCacheSizeBytes = opt.MaxMetadataCacheSizeBytes
 	lc.Caching.MaxListCacheDurationSec = opt.MaxListCacheDurationSec
+	lc.Caching.MaxFormatCacheDurationSec = opt.MaxFormatCacheDurationSec
+	lc.Caching.ListConsistencyDelaySec = opt.ListConsistencyDelaySec
+	lc.Caching.ManifestMirror = opt.ManifestMirror
 
 	log(ctx).Debugf("Creating cache directory '%v' with max size %v", lc.Caching.CacheDirectory, lc.Caching.MaxCacheSizeBytes)
 
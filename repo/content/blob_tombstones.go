@@ -0,0 +1,253 @@
+package content
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/clock"
+	"github.com/kopia/kopia/repo/blob"
+)
+
+// Unreferenced pack blobs are deleted in two phases. First a tombstone blob listing them is written,
+// then once the tombstone is older than the grace period, the blobs that are still not referenced by
+// any index are deleted together with the tombstone.
+//
+// The grace period gives writers that were in-flight when the tombstone was written time to make their
+// indexes visible and gives other clients time to refresh their cached view of the indexes, so it should
+// be longer than both the longest snapshot and the list cache duration of all clients.
+const tombstoneBlobPrefix blob.ID = "t"
+
+// BlobTombstone records pack blobs that were found to be unreferenced and scheduled for deletion.
+type BlobTombstone struct {
+	BlobID    blob.ID          `json:"-"`
+	Timestamp time.Time        `json:"timestamp"`
+	Blobs     []TombstonedBlob `json:"blobs"`
+}
+
+// TombstonedBlob describes a single blob scheduled for deletion.
+type TombstonedBlob struct {
+	BlobID blob.ID `json:"id"`
+	Length int64   `json:"length"`
+}
+
+// BlobGCOptions provides options for DeleteUnreferencedBlobs.
+type BlobGCOptions struct {
+	// MinAge is the minimum age of unreferenced blobs to be scheduled for deletion.
+	MinAge time.Duration
+
+	// GracePeriod is the minimum time between scheduling a blob for deletion and deleting it.
+	GracePeriod time.Duration
+
+	Parallel int
+	DryRun   bool
+}
+
+// BlobGCStats contains statistics of DeleteUnreferencedBlobs.
+type BlobGCStats struct {
+	TombstonedCount int
+	TombstonedBytes int64
+
+	PendingCount int
+	PendingBytes int64
+
+	DeletedCount int
+	DeletedBytes int64
+
+	TooRecentCount int
+	TooRecentBytes int64
+}
+
+// WriteBlobTombstone writes a tombstone scheduling the provided blobs for deletion.
+func (bm *Manager) WriteBlobTombstone(ctx context.Context, blobs []blob.Metadata) (blob.ID, error) {
+	ts := BlobTombstone{Timestamp: bm.timeNow()}
+
+	for _, b := range blobs {
+		ts.Blobs = append(ts.Blobs, TombstonedBlob{BlobID: b.BlobID, Length: b.Length})
+	}
+
+	data, err := json.Marshal(ts)
+	if err != nil {
+		return "", errors.Wrap(err, "unable to marshal tombstone")
+	}
+
+	blobID, err := bm.encryptAndWriteBlobNotLocked(ctx, data, tombstoneBlobPrefix)
+	if err != nil {
+		return "", errors.Wrap(err, "unable to write tombstone")
+	}
+
+	return blobID, nil
+}
+
+// ListBlobTombstones returns all tombstones in the repository ordered by their timestamps.
+func (bm *Manager) ListBlobTombstones(ctx context.Context) ([]BlobTombstone, error) {
+	var blobIDs []blob.ID
+
+	if err := bm.st.ListBlobs(ctx, tombstoneBlobPrefix, func(m blob.Metadata) error {
+		blobIDs = append(blobIDs, m.BlobID)
+		return nil
+	}); err != nil {
+		return nil, errors.Wrap(err, "error listing tombstones")
+	}
+
+	var result []BlobTombstone
+
+	for _, blobID := range blobIDs {
+		ts, err := bm.readBlobTombstone(ctx, blobID)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, ts)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Timestamp.Before(result[j].Timestamp)
+	})
+
+	return result, nil
+}
+
+func (bm *Manager) readBlobTombstone(ctx context.Context, blobID blob.ID) (BlobTombstone, error) {
+	var ts BlobTombstone
+
+	payload, err := bm.st.GetBlob(ctx, blobID, 0, -1)
+	if err != nil {
+		return ts, errors.Wrapf(err, "unable to read tombstone %v", blobID)
+	}
+
+	iv, err := getIndexBlobIV(blobID)
+	if err != nil {
+		return ts, err
+	}
+
+	payload, err = bm.indexCrypto.encryptor.Decrypt(nil, payload, iv)
+	if err != nil {
+		return ts, errors.Wrapf(err, "unable to decrypt tombstone %v", blobID)
+	}
+
+	if err := bm.verifyChecksum(bm.indexCrypto, payload, iv); err != nil {
+		return ts, errors.Wrapf(err, "invalid tombstone %v", blobID)
+	}
+
+	if err := json.Unmarshal(payload, &ts); err != nil {
+		return ts, errors.Wrapf(err, "unable to parse tombstone %v", blobID)
+	}
+
+	ts.BlobID = blobID
+
+	return ts, nil
+}
+
+// DeleteUnreferencedBlobs deletes pack blobs not referenced by any index that were previously scheduled for
+// deletion at least opt.GracePeriod ago and schedules the remaining unreferenced blobs for deletion by a later run.
+func (bm *Manager) DeleteUnreferencedBlobs(ctx context.Context, opt BlobGCOptions) (BlobGCStats, error) {
+	var st BlobGCStats
+
+	// make sure the decisions are based on the latest indexes and not on cached listings.
+	bm.listCache.deleteListCache()
+
+	if _, err := bm.Refresh(ctx); err != nil {
+		return st, errors.Wrap(err, "unable to refresh indexes")
+	}
+
+	tombstones, err := bm.ListBlobTombstones(ctx)
+	if err != nil {
+		return st, err
+	}
+
+	now := bm.timeNow()
+
+	// earliest time each blob was scheduled for deletion.
+	scheduled := map[blob.ID]time.Time{}
+
+	for _, ts := range tombstones {
+		for _, b := range ts.Blobs {
+			if t, ok := scheduled[b.BlobID]; !ok || ts.Timestamp.Before(t) {
+				scheduled[b.BlobID] = ts.Timestamp
+			}
+		}
+	}
+
+	var (
+		mu          sync.Mutex
+		toTombstone []blob.Metadata
+	)
+
+	if err := bm.IterateUnreferencedBlobs(ctx, opt.Parallel, func(m blob.Metadata) error {
+		if !clock.OlderThan(now, m.Timestamp, opt.MinAge) {
+			log(ctx).Debugf("preserving %v because it's too new (age: %v)", m.BlobID, now.Sub(m.Timestamp))
+
+			mu.Lock()
+			st.TooRecentCount++
+			st.TooRecentBytes += m.Length
+			mu.Unlock()
+
+			return nil
+		}
+
+		t, ok := scheduled[m.BlobID]
+
+		switch {
+		case !ok:
+			mu.Lock()
+			toTombstone = append(toTombstone, m)
+			st.TombstonedCount++
+			st.TombstonedBytes += m.Length
+			mu.Unlock()
+
+		case !clock.OlderThan(now, t, opt.GracePeriod):
+			mu.Lock()
+			st.PendingCount++
+			st.PendingBytes += m.Length
+			mu.Unlock()
+
+		default:
+			if !opt.DryRun {
+				if err := bm.st.DeleteBlob(ctx, m.BlobID); err != nil && !errors.Is(err, blob.ErrBlobNotFound) {
+					return errors.Wrapf(err, "unable to delete blob %v", m.BlobID)
+				}
+			}
+
+			mu.Lock()
+			st.DeletedCount++
+			st.DeletedBytes += m.Length
+			mu.Unlock()
+		}
+
+		return nil
+	}); err != nil {
+		return st, errors.Wrap(err, "error looking for unreferenced blobs")
+	}
+
+	if opt.DryRun {
+		return st, nil
+	}
+
+	if len(toTombstone) > 0 {
+		blobID, err := bm.WriteBlobTombstone(ctx, toTombstone)
+		if err != nil {
+			return st, err
+		}
+
+		log(ctx).Debugf("scheduled %v blobs for deletion in %v", len(toTombstone), blobID)
+	}
+
+	// at this point all unreferenced blobs listed in tombstones past the grace period have been deleted,
+	// the remaining ones are referenced again and must be preserved.
+	for _, ts := range tombstones {
+		if !clock.OlderThan(now, ts.Timestamp, opt.GracePeriod) {
+			continue
+		}
+
+		if err := bm.st.DeleteBlob(ctx, ts.BlobID); err != nil && !errors.Is(err, blob.ErrBlobNotFound) {
+			return st, errors.Wrapf(err, "unable to delete tombstone %v", ts.BlobID)
+		}
+	}
+
+	return st, nil
+}
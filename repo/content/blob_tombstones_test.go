@@ -0,0 +1,131 @@
+package content
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kopia/kopia/internal/blobtesting"
+	"github.com/kopia/kopia/internal/faketime"
+	"github.com/kopia/kopia/internal/testlogging"
+	"github.com/kopia/kopia/repo/blob"
+)
+
+func TestDeleteUnreferencedBlobsTwoPhase(t *testing.T) {
+	ctx := testlogging.Context(t)
+	data := blobtesting.DataMap{}
+	keyTime := map[blob.ID]time.Time{}
+	ta := faketime.NewTimeAdvance(fakeTime)
+
+	bm := newTestContentManager(t, data, keyTime, ta.NowFunc())
+	defer bm.Close(ctx)
+
+	contentID := writeContentAndVerify(ctx, t, bm, seededRandomData(10, 100))
+	assertNoError(t, bm.Flush(ctx))
+
+	// rewriting the content leaves the original pack unreferenced.
+	assertNoError(t, bm.RewriteContent(ctx, contentID))
+	assertNoError(t, bm.Flush(ctx))
+	verifyUnreferencedBlobsCount(ctx, t, bm, 1)
+
+	ci, err := bm.ContentInfo(ctx, contentID)
+	assertNoError(t, err)
+
+	referencedPack := ci.PackBlobID
+
+	opt := BlobGCOptions{MinAge: time.Hour, GracePeriod: time.Hour, Parallel: 1}
+
+	// too new to be considered.
+	st, err := bm.DeleteUnreferencedBlobs(ctx, opt)
+	assertNoError(t, err)
+
+	if st.TooRecentCount != 1 || st.TombstonedCount != 0 {
+		t.Fatalf("unexpected stats: %+v", st)
+	}
+
+	ta.Advance(2 * time.Hour)
+
+	// first run only writes the tombstone.
+	st, err = bm.DeleteUnreferencedBlobs(ctx, opt)
+	assertNoError(t, err)
+
+	if st.TombstonedCount != 1 || st.DeletedCount != 0 {
+		t.Fatalf("unexpected stats: %+v", st)
+	}
+
+	verifyTombstoneCount(ctx, t, bm, 1)
+	verifyUnreferencedBlobsCount(ctx, t, bm, 1)
+
+	// second run within the grace period does nothing.
+	ta.Advance(30 * time.Minute)
+
+	st, err = bm.DeleteUnreferencedBlobs(ctx, opt)
+	assertNoError(t, err)
+
+	if st.PendingCount != 1 || st.TombstonedCount != 0 || st.DeletedCount != 0 {
+		t.Fatalf("unexpected stats: %+v", st)
+	}
+
+	verifyTombstoneCount(ctx, t, bm, 1)
+
+	// schedule a pack that's still referenced, it must survive the deletion.
+	_, err = bm.WriteBlobTombstone(ctx, []blob.Metadata{{BlobID: referencedPack}})
+	assertNoError(t, err)
+
+	ta.Advance(2 * time.Hour)
+
+	st, err = bm.DeleteUnreferencedBlobs(ctx, opt)
+	assertNoError(t, err)
+
+	if st.DeletedCount != 1 || st.TombstonedCount != 0 {
+		t.Fatalf("unexpected stats: %+v", st)
+	}
+
+	verifyTombstoneCount(ctx, t, bm, 0)
+	verifyUnreferencedBlobsCount(ctx, t, bm, 0)
+
+	if _, ok := data[referencedPack]; !ok {
+		t.Fatalf("referenced pack %v was deleted", referencedPack)
+	}
+
+	verifyContent(ctx, t, bm, contentID, seededRandomData(10, 100))
+}
+
+func TestDeleteUnreferencedBlobsDryRun(t *testing.T) {
+	ctx := testlogging.Context(t)
+	data := blobtesting.DataMap{}
+	keyTime := map[blob.ID]time.Time{}
+	ta := faketime.NewTimeAdvance(fakeTime)
+
+	bm := newTestContentManager(t, data, keyTime, ta.NowFunc())
+	defer bm.Close(ctx)
+
+	contentID := writeContentAndVerify(ctx, t, bm, seededRandomData(10, 100))
+	assertNoError(t, bm.Flush(ctx))
+	assertNoError(t, bm.RewriteContent(ctx, contentID))
+	assertNoError(t, bm.Flush(ctx))
+
+	ta.Advance(2 * time.Hour)
+
+	st, err := bm.DeleteUnreferencedBlobs(ctx, BlobGCOptions{MinAge: time.Hour, GracePeriod: time.Hour, Parallel: 1, DryRun: true})
+	assertNoError(t, err)
+
+	if st.TombstonedCount != 1 {
+		t.Fatalf("unexpected stats: %+v", st)
+	}
+
+	verifyTombstoneCount(ctx, t, bm, 0)
+}
+
+func verifyTombstoneCount(ctx context.Context, t *testing.T, bm *Manager, want int) {
+	t.Helper()
+
+	tombstones, err := bm.ListBlobTombstones(ctx)
+	if err != nil {
+		t.Fatalf("error listing tombstones: %v", err)
+	}
+
+	if got := len(tombstones); got != want {
+		t.Fatalf("unexpected number of tombstones: %v, want %v", got, want)
+	}
+}
@@ -6,6 +6,9 @@ import (
 	"time"
 
 	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/blob/offline"
 )
 
 const verySmallContentFraction = 20 // blobs less than 1/verySmallContentFraction of maxPackSize are considered 'very small'
@@ -19,6 +22,10 @@ type CompactOptions struct {
 	MaxSmallBlobs        int
 	AllIndexes           bool
 	SkipDeletedOlderThan time.Duration
+
+	// IncludeRecentEpochs also compacts index blobs in the most recent epochs of repositories using
+	// epoch-based index management, which are otherwise left alone because they still receive writes.
+	IncludeRecentEpochs bool
 }
 
 // CompactIndexes performs compaction of index blobs ensuring that # of small index blobs is below opt.maxSmallBlobs
@@ -33,6 +40,28 @@ func (bm *Manager) CompactIndexes(ctx context.Context, opt CompactOptions) error
 		return errors.Wrap(err, "error loading indexes")
 	}
 
+	if offline.IsOffline(bm.st) {
+		// indexes can't be compacted without access to the storage.
+		return nil
+	}
+
+	if bm.appendOnly {
+		log(ctx).Debugf("skipping index compaction in append-only mode")
+		return nil
+	}
+
+	if bm.epochs != nil {
+		if err := bm.compactEpochIndexes(ctx, opt); err != nil {
+			log(ctx).Warningf("error performing epoch index maintenance: %v", err)
+		}
+
+		return nil
+	}
+
+	if bm.journal != nil {
+		indexBlobs = bm.processPendingIndexDeletions(ctx, indexBlobs)
+	}
+
 	contentsToCompact := bm.getContentsToCompact(ctx, indexBlobs, opt)
 
 	if err := bm.compactAndDeleteIndexBlobs(ctx, contentsToCompact, opt); err != nil {
@@ -93,11 +122,13 @@ func (bm *Manager) compactAndDeleteIndexBlobs(ctx context.Context, indexBlobs []
 	bld := make(packIndexBuilder)
 
 	for _, indexBlob := range indexBlobs {
-		if err := bm.addIndexBlobsToBuilder(ctx, bld, indexBlob, opt); err != nil {
+		if err := bm.addIndexBlobsToBuilder(ctx, bld, indexBlob); err != nil {
 			return err
 		}
 	}
 
+	bm.dropDeletedContents(ctx, bld, opt)
+
 	var buf bytes.Buffer
 	if err := bld.Build(&buf); err != nil {
 		return errors.Wrap(err, "unable to build an index")
@@ -110,22 +141,55 @@ func (bm *Manager) compactAndDeleteIndexBlobs(ctx context.Context, indexBlobs []
 
 	formatLog(ctx).Debugf("wrote compacted index (%v bytes) in %v", compactedIndexBlob, time.Since(t0)) // allow:no-inject-time
 
+	var superseded []blob.ID
+
 	for _, indexBlob := range indexBlobs {
-		if indexBlob.BlobID == compactedIndexBlob {
-			continue
+		if indexBlob.BlobID != compactedIndexBlob {
+			superseded = append(superseded, indexBlob.BlobID)
 		}
+	}
 
-		bm.listCache.deleteListCache()
+	if bm.journal != nil {
+		// other clients may not be able to list the compacted blob yet, delete superseded blobs later.
+		bm.journal.scheduleDeletion(ctx, superseded)
+		return nil
+	}
+
+	bm.deleteIndexBlobs(ctx, superseded)
 
-		if err := bm.st.DeleteBlob(ctx, indexBlob.BlobID); err != nil {
-			log(ctx).Warningf("unable to delete compacted blob %q: %v", indexBlob.BlobID, err)
+	return nil
+}
+
+// processPendingIndexDeletions deletes index blobs superseded by compactions that happened at
+// least list consistency delay ago and returns the provided index blobs excluding all blobs
+// pending deletion, which don't need to be compacted again.
+func (bm *Manager) processPendingIndexDeletions(ctx context.Context, indexBlobs []IndexBlobInfo) []IndexBlobInfo {
+	pending := bm.journal.pendingDeletions(ctx)
+
+	bm.deleteIndexBlobs(ctx, bm.journal.takeDueDeletions(ctx))
+
+	var result []IndexBlobInfo
+
+	for _, b := range indexBlobs {
+		if !pending[b.BlobID] {
+			result = append(result, b)
 		}
 	}
 
-	return nil
+	return result
 }
 
-func (bm *Manager) addIndexBlobsToBuilder(ctx context.Context, bld packIndexBuilder, indexBlob IndexBlobInfo, opt CompactOptions) error {
+func (bm *Manager) deleteIndexBlobs(ctx context.Context, blobIDs []blob.ID) {
+	for _, blobID := range blobIDs {
+		bm.listCache.deleteListCache()
+
+		if err := bm.st.DeleteBlob(ctx, blobID); err != nil {
+			log(ctx).Warningf("unable to delete compacted blob %q: %v", blobID, err)
+		}
+	}
+}
+
+func (bm *Manager) addIndexBlobsToBuilder(ctx context.Context, bld packIndexBuilder, indexBlob IndexBlobInfo) error {
 	data, err := bm.getIndexBlobInternal(ctx, indexBlob.BlobID)
 	if err != nil {
 		return err
@@ -137,13 +201,24 @@ func (bm *Manager) addIndexBlobsToBuilder(ctx context.Context, bld packIndexBuil
 	}
 
 	_ = index.Iterate("", func(i Info) error {
-		if i.Deleted && opt.SkipDeletedOlderThan > 0 && bm.timeNow().Sub(i.Timestamp()) > opt.SkipDeletedOlderThan {
-			log(ctx).Debugf("skipping content %v deleted at %v", i.ID, i.Timestamp())
-			return nil
-		}
 		bld.Add(i)
 		return nil
 	})
 
 	return nil
 }
+
+// dropDeletedContents removes contents deleted before opt.SkipDeletedOlderThan from the builder. This must happen
+// after all index blobs have been added, otherwise previous versions of deleted contents would become visible again.
+func (bm *Manager) dropDeletedContents(ctx context.Context, bld packIndexBuilder, opt CompactOptions) {
+	if opt.SkipDeletedOlderThan <= 0 {
+		return
+	}
+
+	for id, i := range bld {
+		if i.Deleted && bm.timeNow().Sub(i.Timestamp()) > opt.SkipDeletedOlderThan {
+			log(ctx).Debugf("skipping content %v deleted at %v", i.ID, i.Timestamp())
+			delete(bld, id)
+		}
+	}
+}
@@ -6,6 +6,9 @@ type CachingOptions struct {
 	MaxCacheSizeBytes         int64  `json:"maxCacheSize,omitempty"`
 	MaxMetadataCacheSizeBytes int64  `json:"maxMetadataCacheSize,omitempty"`
 	MaxListCacheDurationSec   int    `json:"maxListCacheDuration,omitempty"`
+	MaxFormatCacheDurationSec int    `json:"maxFormatCacheDuration,omitempty"` // 0 - cached format blob is used indefinitely
+	ListConsistencyDelaySec   int    `json:"listConsistencyDelay,omitempty"`
+	ManifestMirror            bool   `json:"manifestMirror,omitempty"`
 	IgnoreListCache           bool   `json:"-"`
 	HMACSecret                []byte `json:"-"`
 }
@@ -5,17 +5,17 @@ import (
 	"path/filepath"
 	"sync"
 
-	"github.com/pkg/errors"
-
+	"github.com/kopia/kopia/internal/bloom"
 	"github.com/kopia/kopia/repo/blob"
 )
 
 type committedContentIndex struct {
 	cache committedContentIndexCache
 
-	mu     sync.Mutex
-	inUse  map[blob.ID]packIndex
-	merged mergedIndex
+	mu      sync.Mutex
+	inUse   map[blob.ID]packIndex
+	filters map[blob.ID]*bloom.Filter
+	merged  mergedIndex
 }
 
 type committedContentIndexCache interface {
@@ -23,6 +23,10 @@ type committedContentIndexCache interface {
 	addContentToCache(ctx context.Context, indexBlob blob.ID, data []byte) error
 	openIndex(ctx context.Context, indexBlob blob.ID) (packIndex, error)
 	expireUnused(ctx context.Context, used []blob.ID) error
+
+	// readFilter returns blob.ErrBlobNotFound if the filter for the index blob is not cached.
+	readFilter(ctx context.Context, indexBlob blob.ID) ([]byte, error)
+	writeFilter(ctx context.Context, indexBlob blob.ID, data []byte) error
 }
 
 func (b *committedContentIndex) getContent(contentID ID) (Info, error) {
@@ -57,9 +61,9 @@ func (b *committedContentIndex) addContent(ctx context.Context, indexBlobID blob
 		return nil
 	}
 
-	ndx, err := b.cache.openIndex(ctx, indexBlobID)
+	ndx, err := b.openFilteredIndex(ctx, indexBlobID, b.filters)
 	if err != nil {
-		return errors.Wrapf(err, "unable to open pack index %q", indexBlobID)
+		return err
 	}
 
 	b.inUse[indexBlobID] = ndx
@@ -106,23 +110,37 @@ func (b *committedContentIndex) use(ctx context.Context, packFiles []blob.ID) (b
 	var newMerged mergedIndex
 
 	newInUse := map[blob.ID]packIndex{}
+	newFilters := map[blob.ID]*bloom.Filter{}
 
 	defer func() {
 		newMerged.Close() //nolint:errcheck
 	}()
 
+	var reused mergedIndex
+
 	for _, e := range packFiles {
-		ndx, err := b.cache.openIndex(ctx, e)
+		// index blobs are immutable, so indexes that are already open (and memory-mapped,
+		// when using disk cache) can be reused instead of opening them again.
+		if ndx := b.inUse[e]; ndx != nil {
+			reused = append(reused, ndx)
+			newInUse[e] = ndx
+			newFilters[e] = b.filters[e]
+
+			continue
+		}
+
+		ndx, err := b.openFilteredIndex(ctx, e, newFilters)
 		if err != nil {
-			return false, errors.Wrapf(err, "unable to open pack index %q", e)
+			return false, err
 		}
 
 		newMerged = append(newMerged, ndx)
 		newInUse[e] = ndx
 	}
 
-	b.merged = newMerged
+	b.merged = append(reused, newMerged...)
 	b.inUse = newInUse
+	b.filters = newFilters
 
 	if err := b.cache.expireUnused(ctx, packFiles); err != nil {
 		log(ctx).Warningf("unable to expire unused content index files: %v", err)
@@ -142,11 +160,13 @@ func newCommittedContentIndex(caching CachingOptions) *committedContentIndex {
 	} else {
 		cache = &memoryCommittedContentIndexCache{
 			contents: map[blob.ID]packIndex{},
+			filters:  map[blob.ID][]byte{},
 		}
 	}
 
 	return &committedContentIndex{
-		cache: cache,
-		inUse: map[blob.ID]packIndex{},
+		cache:   cache,
+		inUse:   map[blob.ID]packIndex{},
+		filters: map[blob.ID]*bloom.Filter{},
 	}
 }
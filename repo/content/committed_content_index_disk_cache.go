@@ -16,6 +16,7 @@ import (
 
 const (
 	simpleIndexSuffix                      = ".sndx"
+	indexFilterSuffix                      = ".bloom"
 	unusedCommittedContentIndexCleanupTime = 1 * time.Hour // delete unused committed index blobs after 1 hour
 )
 
@@ -27,6 +28,33 @@ func (c *diskCommittedContentIndexCache) indexBlobPath(indexBlobID blob.ID) stri
 	return filepath.Join(c.dirname, string(indexBlobID)+simpleIndexSuffix)
 }
 
+func (c *diskCommittedContentIndexCache) filterPath(indexBlobID blob.ID) string {
+	return filepath.Join(c.dirname, string(indexBlobID)+indexFilterSuffix)
+}
+
+func (c *diskCommittedContentIndexCache) readFilter(ctx context.Context, indexBlobID blob.ID) ([]byte, error) {
+	data, err := ioutil.ReadFile(c.filterPath(indexBlobID))
+	if os.IsNotExist(err) {
+		return nil, blob.ErrBlobNotFound
+	}
+
+	return data, err
+}
+
+func (c *diskCommittedContentIndexCache) writeFilter(ctx context.Context, indexBlobID blob.ID, data []byte) error {
+	tmpFile, err := writeTempFileAtomic(c.dirname, data)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmpFile, c.filterPath(indexBlobID)); err != nil {
+		os.Remove(tmpFile) //nolint:errcheck
+		return err
+	}
+
+	return nil
+}
+
 func (c *diskCommittedContentIndexCache) openIndex(ctx context.Context, indexBlobID blob.ID) (packIndex, error) {
 	fullpath := c.indexBlobPath(indexBlobID)
 
@@ -137,19 +165,21 @@ func (c *diskCommittedContentIndexCache) expireUnused(ctx context.Context, used
 		return errors.Wrap(err, "can't list cache")
 	}
 
-	remaining := map[blob.ID]os.FileInfo{}
+	isUsed := map[blob.ID]bool{}
+	for _, u := range used {
+		isUsed[u] = true
+	}
+
+	var remaining []os.FileInfo
 
 	for _, ent := range entries {
-		if strings.HasSuffix(ent.Name(), simpleIndexSuffix) {
-			n := strings.TrimSuffix(ent.Name(), simpleIndexSuffix)
-			remaining[blob.ID(n)] = ent
+		for _, suffix := range []string{simpleIndexSuffix, indexFilterSuffix} {
+			if strings.HasSuffix(ent.Name(), suffix) && !isUsed[blob.ID(strings.TrimSuffix(ent.Name(), suffix))] {
+				remaining = append(remaining, ent)
+			}
 		}
 	}
 
-	for _, u := range used {
-		delete(remaining, u)
-	}
-
 	for _, rem := range remaining {
 		if time.Since(rem.ModTime()) > unusedCommittedContentIndexCleanupTime { // allow:no-inject-time
 			log(ctx).Debugf("removing unused %v %v", rem.Name(), rem.ModTime())
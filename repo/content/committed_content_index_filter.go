@@ -0,0 +1,106 @@
+package content
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/bloom"
+	"github.com/kopia/kopia/repo/blob"
+)
+
+// indexFilterFalsePositiveRate is the probability of a lookup in an index blob for a content that isn't there.
+const indexFilterFalsePositiveRate = 0.01
+
+// filteredIndex is a packIndex accompanied by a Bloom filter of content IDs in it, which allows
+// lookups of contents that are definitely not in the index to skip searching it.
+type filteredIndex struct {
+	packIndex
+	filter *bloom.Filter
+}
+
+// GetInfo returns information about a single content. If a content is not found, returns (nil,nil)
+func (f *filteredIndex) GetInfo(contentID ID) (*Info, error) {
+	if !f.filter.MayContain([]byte(contentID)) {
+		return nil, nil
+	}
+
+	return f.packIndex.GetInfo(contentID)
+}
+
+// buildIndexFilter builds a Bloom filter of all content IDs in the index.
+func buildIndexFilter(ndx packIndex) (*bloom.Filter, error) {
+	var count int
+
+	if err := ndx.Iterate("", func(Info) error {
+		count++
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	f := bloom.New(count, indexFilterFalsePositiveRate)
+
+	if err := ndx.Iterate("", func(i Info) error {
+		f.Add([]byte(i.ID))
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// indexFilter returns the filter for a given index blob, loading it from cache or building it if necessary.
+// Must be called with b.mu held.
+func (b *committedContentIndex) indexFilter(ctx context.Context, indexBlobID blob.ID, ndx packIndex) (*bloom.Filter, error) {
+	if f := b.filters[indexBlobID]; f != nil {
+		return f, nil
+	}
+
+	if data, err := b.cache.readFilter(ctx, indexBlobID); err == nil {
+		f, err := bloom.Unmarshal(data)
+		if err == nil {
+			return f, nil
+		}
+
+		log(ctx).Warningf("invalid cached filter for %v: %v", indexBlobID, err)
+	} else if err != blob.ErrBlobNotFound {
+		log(ctx).Warningf("unable to read cached filter for %v: %v", indexBlobID, err)
+	}
+
+	f, err := buildIndexFilter(ndx)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to build filter for %v", indexBlobID)
+	}
+
+	data, err := f.MarshalBinary()
+	if err == nil {
+		err = b.cache.writeFilter(ctx, indexBlobID, data)
+	}
+
+	if err != nil {
+		log(ctx).Warningf("unable to cache filter for %v: %v", indexBlobID, err)
+	}
+
+	return f, nil
+}
+
+// openFilteredIndex opens the index blob from cache and wraps it with its filter.
+// Must be called with b.mu held.
+func (b *committedContentIndex) openFilteredIndex(ctx context.Context, indexBlobID blob.ID, newFilters map[blob.ID]*bloom.Filter) (packIndex, error) {
+	ndx, err := b.cache.openIndex(ctx, indexBlobID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to open pack index %q", indexBlobID)
+	}
+
+	f, err := b.indexFilter(ctx, indexBlobID, ndx)
+	if err != nil {
+		ndx.Close() //nolint:errcheck
+		return nil, err
+	}
+
+	newFilters[indexBlobID] = f
+
+	return &filteredIndex{ndx, f}, nil
+}
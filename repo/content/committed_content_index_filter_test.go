@@ -0,0 +1,63 @@
+package content
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kopia/kopia/internal/testlogging"
+	"github.com/kopia/kopia/repo/blob"
+)
+
+func TestCommittedContentIndexFilter(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	cacheDir, err := ioutil.TempDir("", "index-filter")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(cacheDir)
+
+	bld := make(packIndexBuilder)
+
+	for i := 0; i < 1000; i++ {
+		bld.Add(Info{
+			ID:               deterministicContentID("filter", i),
+			PackBlobID:       deterministicPackBlobID(i),
+			TimestampSeconds: randomUnixTime(),
+		})
+	}
+
+	var buf bytes.Buffer
+	if err := bld.Build(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	const indexBlobID blob.ID = "nindex1"
+
+	for _, reopen := range []bool{false, true} {
+		// second iteration uses filter cached on disk.
+		cci := newCommittedContentIndex(CachingOptions{CacheDirectory: cacheDir})
+
+		assertNoError(t, cci.addContent(ctx, indexBlobID, buf.Bytes(), true))
+
+		if _, err := os.Stat(filepath.Join(cacheDir, "indexes", string(indexBlobID)+indexFilterSuffix)); err != nil {
+			t.Fatalf("filter not cached (reopen=%v): %v", reopen, err)
+		}
+
+		for i := 0; i < 1000; i++ {
+			if _, err := cci.getContent(deterministicContentID("filter", i)); err != nil {
+				t.Fatalf("content %v not found: %v", i, err)
+			}
+
+			if _, err := cci.getContent(deterministicContentID("no-such-content", i)); err != ErrContentNotFound {
+				t.Fatalf("unexpected error for non-existent content %v: %v", i, err)
+			}
+		}
+
+		assertNoError(t, cci.merged.Close())
+	}
+}
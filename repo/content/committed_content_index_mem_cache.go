@@ -13,6 +13,7 @@ import (
 type memoryCommittedContentIndexCache struct {
 	mu       sync.Mutex
 	contents map[blob.ID]packIndex
+	filters  map[blob.ID][]byte
 }
 
 func (m *memoryCommittedContentIndexCache) hasIndexBlobID(ctx context.Context, indexBlobID blob.ID) (bool, error) {
@@ -51,3 +52,24 @@ func (m *memoryCommittedContentIndexCache) openIndex(ctx context.Context, indexB
 func (m *memoryCommittedContentIndexCache) expireUnused(ctx context.Context, used []blob.ID) error {
 	return nil
 }
+
+func (m *memoryCommittedContentIndexCache) readFilter(ctx context.Context, indexBlobID blob.ID) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	v := m.filters[indexBlobID]
+	if v == nil {
+		return nil, blob.ErrBlobNotFound
+	}
+
+	return v, nil
+}
+
+func (m *memoryCommittedContentIndexCache) writeFilter(ctx context.Context, indexBlobID blob.ID, data []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.filters[indexBlobID] = data
+
+	return nil
+}
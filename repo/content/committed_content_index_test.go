@@ -0,0 +1,63 @@
+package content
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/kopia/kopia/internal/testlogging"
+	"github.com/kopia/kopia/repo/blob"
+)
+
+func TestCommittedContentIndexReusesOpenIndexes(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	cacheDir, err := ioutil.TempDir("", "committed-index")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(cacheDir)
+
+	cci := newCommittedContentIndex(CachingOptions{CacheDirectory: cacheDir})
+
+	var ids []blob.ID
+
+	for i := 0; i < 3; i++ {
+		bld := make(packIndexBuilder)
+		bld.Add(Info{ID: deterministicContentID("reuse", i), PackBlobID: deterministicPackBlobID(i)})
+
+		var buf bytes.Buffer
+		if err := bld.Build(&buf); err != nil {
+			t.Fatal(err)
+		}
+
+		id := blob.ID(fmt.Sprintf("nindex%v", i))
+		assertNoError(t, cci.addContent(ctx, id, buf.Bytes(), false))
+
+		ids = append(ids, id)
+	}
+
+	if _, err := cci.use(ctx, ids[0:2]); err != nil {
+		t.Fatal(err)
+	}
+
+	first := cci.inUse[ids[0]]
+
+	updated, err := cci.use(ctx, ids[0:3])
+	if err != nil || !updated {
+		t.Fatalf("unexpected result of use(): %v %v", updated, err)
+	}
+
+	if cci.inUse[ids[0]] != first {
+		t.Errorf("index was opened again instead of being reused")
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := cci.getContent(deterministicContentID("reuse", i)); err != nil {
+			t.Errorf("content %v not found: %v", i, err)
+		}
+	}
+}
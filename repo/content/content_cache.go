@@ -6,6 +6,7 @@ import (
 	"os"
 	"path/filepath"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/pkg/errors"
@@ -29,12 +30,15 @@ type contentCache struct {
 	cacheStorage   blob.Storage
 	maxSizeBytes   int64
 	hmacSecret     []byte
+	pins           *cachePins // nil when there are no pins
 	sweepFrequency time.Duration
 	touchThreshold time.Duration
 
 	mu                 sync.Mutex
 	lastTotalSizeBytes int64
 
+	emergencySweepRunning int32 // accessed atomically
+
 	asyncWG sync.WaitGroup
 	closed  chan struct{}
 }
@@ -91,6 +95,10 @@ func (c *contentCache) getContent(ctx context.Context, cacheKey cacheKey, blobID
 		); puterr != nil {
 			stats.Record(ctx, metricContentCacheStoreErrors.M(1))
 			log(ctx).Warningf("unable to write cache item %v: %v", cacheKey, puterr)
+
+			if errors.Is(puterr, blob.ErrStorageFull) {
+				c.emergencySweep(ctx)
+			}
 		}
 	}
 
@@ -123,6 +131,18 @@ func (c *contentCache) readAndVerifyCacheContent(ctx context.Context, cacheKey c
 	return nil
 }
 
+// hasContent returns true if the content with the provided key is present in the cache.
+func (c *contentCache) hasContent(ctx context.Context, cacheKey cacheKey) bool {
+	if !shouldUseContentCache(ctx) || c.cacheStorage == nil {
+		return false
+	}
+
+	// reading a single byte is enough to determine the presence of the item.
+	_, err := c.cacheStorage.GetBlob(ctx, blob.ID(adjustCacheKey(cacheKey)), 0, 1)
+
+	return err == nil
+}
+
 func (c *contentCache) close() {
 	close(c.closed)
 	c.asyncWG.Wait()
@@ -171,7 +191,31 @@ func (h *contentMetadataHeap) Pop() interface{} {
 	return item
 }
 
-func (c *contentCache) sweepDirectory(ctx context.Context) (err error) {
+// emergencySweep frees space when the cache volume is full by reducing the cache to half of its last known size.
+// Concurrent failures trigger a single sweep.
+func (c *contentCache) emergencySweep(ctx context.Context) {
+	if !atomic.CompareAndSwapInt32(&c.emergencySweepRunning, 0, 1) {
+		return
+	}
+	defer atomic.StoreInt32(&c.emergencySweepRunning, 0)
+
+	c.mu.Lock()
+	targetSize := c.lastTotalSizeBytes / 2 //nolint:gomnd
+	c.mu.Unlock()
+
+	log(ctx).Warningf("cache volume is full, reducing cache size to %v bytes", targetSize)
+
+	if err := c.sweepDirectoryToSize(ctx, targetSize); err != nil {
+		log(ctx).Warningf("emergency cache sweep failed: %v", err)
+	}
+}
+
+func (c *contentCache) sweepDirectory(ctx context.Context) error {
+	return c.sweepDirectoryToSize(ctx, c.maxSizeBytes)
+}
+
+// sweepDirectoryToSize removes least recently used unpinned contents until their total size doesn't exceed maxSizeBytes.
+func (c *contentCache) sweepDirectoryToSize(ctx context.Context, maxSizeBytes int64) (err error) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
@@ -185,11 +229,25 @@ func (c *contentCache) sweepDirectory(ctx context.Context) (err error) {
 
 	var totalRetainedSize int64
 
+	pinned := map[blob.ID]bool{}
+
+	if c.pins != nil {
+		if pinned, err = c.pins.pinnedCacheKeys(); err != nil {
+			// don't sweep rather than removing contents that may be pinned.
+			return errors.Wrap(err, "unable to load pinned contents")
+		}
+	}
+
 	err = c.cacheStorage.ListBlobs(ctx, "", func(it blob.Metadata) error {
+		if pinned[it.BlobID] {
+			// pinned contents don't count towards the cache size and are never removed.
+			return nil
+		}
+
 		heap.Push(&h, it)
 		totalRetainedSize += it.Length
 
-		if totalRetainedSize > c.maxSizeBytes {
+		if totalRetainedSize > maxSizeBytes {
 			oldest := heap.Pop(&h).(blob.Metadata)
 			if delerr := c.cacheStorage.DeleteBlob(ctx, oldest.BlobID); delerr != nil {
 				log(ctx).Warningf("unable to remove %v: %v", oldest.BlobID, delerr)
@@ -203,7 +261,7 @@ func (c *contentCache) sweepDirectory(ctx context.Context) (err error) {
 		return errors.Wrap(err, "error listing cache")
 	}
 
-	log(ctx).Debugf("finished sweeping directory in %v and retained %v/%v bytes (%v %%)", time.Since(t0), totalRetainedSize, c.maxSizeBytes, 100*totalRetainedSize/c.maxSizeBytes) // allow:no-inject-time
+	log(ctx).Debugf("finished sweeping directory in %v and retained %v/%v bytes", time.Since(t0), totalRetainedSize, maxSizeBytes) // allow:no-inject-time
 	c.lastTotalSizeBytes = totalRetainedSize
 
 	return nil
@@ -241,6 +299,7 @@ func newContentCacheWithCacheStorage(ctx context.Context, st, cacheStorage blob.
 		cacheStorage:   cacheStorage,
 		maxSizeBytes:   maxSizeBytes,
 		hmacSecret:     append([]byte(nil), caching.HMACSecret...),
+		pins:           newCachePins(caching),
 		closed:         make(chan struct{}),
 		touchThreshold: touchThreshold,
 		sweepFrequency: sweepFrequency,
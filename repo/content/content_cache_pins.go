@@ -0,0 +1,208 @@
+package content
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/hmac"
+	"github.com/kopia/kopia/repo/blob"
+)
+
+// cachePins keeps track of contents pinned in the local cache, which are exempt from sweeping.
+// Contents are pinned under names, so that sets of contents can be pinned and unpinned independently.
+type cachePins struct {
+	filename   string
+	hmacSecret []byte
+
+	mu sync.Mutex
+}
+
+type pinnedContents struct {
+	Pins map[string][]ID `json:"pins"`
+}
+
+func (p *cachePins) loadLocked() (map[string][]ID, error) {
+	data, err := ioutil.ReadFile(p.filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return map[string][]ID{}, nil
+		}
+
+		return nil, errors.Wrap(err, "unable to read cache pins")
+	}
+
+	data, err = hmac.VerifyAndStrip(data, p.hmacSecret)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid file %v", p.filename)
+	}
+
+	var pc pinnedContents
+
+	if err := json.Unmarshal(data, &pc); err != nil {
+		return nil, errors.Wrap(err, "can't unmarshal cache pins")
+	}
+
+	if pc.Pins == nil {
+		pc.Pins = map[string][]ID{}
+	}
+
+	return pc.Pins, nil
+}
+
+func (p *cachePins) saveLocked(pins map[string][]ID) error {
+	data, err := json.Marshal(pinnedContents{pins})
+	if err != nil {
+		return errors.Wrap(err, "can't marshal cache pins")
+	}
+
+	mySuffix := fmt.Sprintf(".tmp-%v-%v", os.Getpid(), time.Now().UnixNano()) // allow:no-inject-time
+	if err := ioutil.WriteFile(p.filename+mySuffix, hmac.Append(data, p.hmacSecret), 0600); err != nil {
+		return errors.Wrap(err, "unable to write cache pins")
+	}
+
+	if err := os.Rename(p.filename+mySuffix, p.filename); err != nil {
+		os.Remove(p.filename + mySuffix) //nolint:errcheck
+		return errors.Wrap(err, "unable to write cache pins")
+	}
+
+	return nil
+}
+
+func (p *cachePins) update(cb func(pins map[string][]ID)) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	pins, err := p.loadLocked()
+	if err != nil {
+		return err
+	}
+
+	cb(pins)
+
+	return p.saveLocked(pins)
+}
+
+func (p *cachePins) list() (map[string][]ID, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.loadLocked()
+}
+
+// pinnedCacheKeys returns the set of cache blob IDs of all pinned contents.
+func (p *cachePins) pinnedCacheKeys() (map[blob.ID]bool, error) {
+	pins, err := p.list()
+	if err != nil {
+		return nil, err
+	}
+
+	result := map[blob.ID]bool{}
+
+	for _, ids := range pins {
+		for _, id := range ids {
+			result[blob.ID(adjustCacheKey(cacheKey(id)))] = true
+		}
+	}
+
+	return result, nil
+}
+
+func newCachePins(caching CachingOptions) *cachePins {
+	if caching.CacheDirectory == "" {
+		return nil
+	}
+
+	return &cachePins{
+		filename:   filepath.Join(caching.CacheDirectory, "pins"),
+		hmacSecret: caching.HMACSecret,
+	}
+}
+
+// PinContents reads the provided contents into the local cache and pins them under the provided name,
+// so that they are not removed when the cache is swept. The callback is invoked after each content is processed.
+func (bm *Manager) PinContents(ctx context.Context, name string, contentIDs []ID, progress func(done int)) error {
+	if bm.pins == nil {
+		return errors.New("caching not enabled")
+	}
+
+	// contents are pinned before they are read, so that they are not swept before the pin is recorded.
+	if err := bm.pins.update(func(pins map[string][]ID) {
+		pins[name] = contentIDs
+	}); err != nil {
+		return err
+	}
+
+	ctx = UsingContentCache(ctx, true)
+
+	for i, cid := range contentIDs {
+		cached, err := bm.IsContentCached(ctx, cid)
+		if err != nil {
+			return errors.Wrapf(err, "unable to check content %v", cid)
+		}
+
+		if !cached {
+			if _, err := bm.GetContent(ctx, cid); err != nil {
+				return errors.Wrapf(err, "unable to read content %v", cid)
+			}
+
+			if cached, _ = bm.IsContentCached(ctx, cid); !cached {
+				return errors.Errorf("content %v could not be stored in the cache, the cache may be disabled", cid)
+			}
+		}
+
+		if progress != nil {
+			progress(i + 1)
+		}
+	}
+
+	return nil
+}
+
+// UnpinContents releases contents pinned under the provided name, which makes them subject to sweeping again.
+func (bm *Manager) UnpinContents(ctx context.Context, name string) error {
+	if bm.pins == nil {
+		return errors.New("caching not enabled")
+	}
+
+	var found bool
+
+	if err := bm.pins.update(func(pins map[string][]ID) {
+		_, found = pins[name]
+		delete(pins, name)
+	}); err != nil {
+		return err
+	}
+
+	if !found {
+		return errors.Errorf("%v is not pinned", name)
+	}
+
+	return nil
+}
+
+// PinnedContents returns the numbers of contents pinned in the local cache by name.
+func (bm *Manager) PinnedContents(ctx context.Context) (map[string]int, error) {
+	if bm.pins == nil {
+		return nil, nil
+	}
+
+	pins, err := bm.pins.list()
+	if err != nil {
+		return nil, err
+	}
+
+	result := map[string]int{}
+	for name, ids := range pins {
+		result[name] = len(ids)
+	}
+
+	return result, nil
+}
@@ -2,6 +2,7 @@ package content
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"io/ioutil"
 	"os"
 	"reflect"
@@ -14,6 +15,7 @@ import (
 	"github.com/pkg/errors"
 
 	"github.com/kopia/kopia/internal/blobtesting"
+	"github.com/kopia/kopia/internal/faketime"
 	"github.com/kopia/kopia/internal/testlogging"
 	"github.com/kopia/kopia/repo/blob"
 )
@@ -253,6 +255,50 @@ func TestCacheFailureToWrite(t *testing.T) {
 	}
 }
 
+func TestCacheEmergencySweepWhenFull(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	cacheStorage := blobtesting.NewMapStorage(blobtesting.DataMap{}, nil, nil)
+	underlyingStorage := newUnderlyingStorageForContentCacheTesting(t)
+
+	for _, id := range []blob.ID{"c1", "c2", "c3", "c4"} {
+		if err := cacheStorage.PutBlob(ctx, id, make([]byte, 1000)); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+
+	faultyCache := &blobtesting.FaultyStorage{
+		Base: cacheStorage,
+	}
+
+	cache, err := newContentCacheWithCacheStorage(ctx, underlyingStorage, faultyCache, 10000, CachingOptions{}, 0, 5*time.Hour)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	defer cache.close()
+
+	faultyCache.Faults = map[string][]*blobtesting.Fault{
+		"PutBlob": {
+			{Err: errors.Wrap(blob.ErrStorageFull, "no space left")},
+		},
+	}
+
+	if _, err := cache.getContent(ctx, "aa", "content-1", 0, 3); err != nil {
+		t.Errorf("write failure wasn't ignored: %v", err)
+	}
+
+	all, err := blob.ListAllBlobs(ctx, cacheStorage, "")
+	if err != nil {
+		t.Errorf("error listing cache: %v", err)
+	}
+
+	// the cache is reduced to half of its size.
+	if got, want := len(all), 2; got != want {
+		t.Errorf("unexpected number of cached items after emergency sweep: %v, want %v", got, want)
+	}
+}
+
 func TestCacheFailureToRead(t *testing.T) {
 	someError := errors.New("some error")
 
@@ -315,3 +361,54 @@ func assertNoError(t *testing.T, err error) {
 		t.Errorf("err: %v", err)
 	}
 }
+
+func TestCachePins(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	tmpDir, err := ioutil.TempDir("", "kopia")
+	if err != nil {
+		t.Fatalf("error getting temp dir: %v", err)
+	}
+
+	defer os.RemoveAll(tmpDir)
+
+	cacheStorage := blobtesting.NewMapStorage(blobtesting.DataMap{}, nil, faketime.AutoAdvance(fakeTime, time.Second))
+	underlyingStorage := newUnderlyingStorageForContentCacheTesting(t)
+	caching := CachingOptions{CacheDirectory: tmpDir, HMACSecret: hmacSecret}
+
+	cache, err := newContentCacheWithCacheStorage(ctx, underlyingStorage, cacheStorage, 5000, caching, 0, time.Hour)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	defer cache.close()
+
+	assertNoError(t, newCachePins(caching).update(func(pins map[string][]ID) {
+		pins["some-pin"] = []ID{"00000a"}
+	}))
+
+	for _, id := range []cacheKey{"00000a", "00000b", "00000c"} {
+		_, err = cache.getContent(ctx, id, "content-4k", 0, -1)
+		assertNoError(t, err)
+	}
+
+	// pinned content is retained and does not count towards the cache size, the oldest of the others is removed.
+	assertNoError(t, cache.sweepDirectory(ctx))
+
+	for _, tc := range []struct {
+		id   cacheKey
+		want bool
+	}{
+		{"00000a", true},
+		{"00000b", false},
+		{"00000c", true},
+	} {
+		if got := cache.hasContent(ctx, tc.id); got != tc.want {
+			t.Errorf("unexpected presence of %v in cache: %v, want %v", tc.id, got, tc.want)
+		}
+	}
+
+	if got, want := cache.lastTotalSizeBytes, int64(4000+sha256.Size); got != want {
+		t.Errorf("unexpected cache size: %v, want %v", got, want)
+	}
+}
@@ -1,5 +1,15 @@
 package content
 
+import (
+	"crypto/sha256"
+	"io"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// KeyPurposesFormatVersion is the format version which introduced keys derived for each purpose.
+const KeyPurposesFormatVersion = 3
+
 // FormattingOptions describes the rules for formatting contents in repository.
 type FormattingOptions struct {
 	Version     int    `json:"version,omitempty"`     // version number, must be "1"
@@ -8,6 +18,29 @@ type FormattingOptions struct {
 	HMACSecret  []byte `json:"secret,omitempty"`      // HMAC secret used to generate encryption keys
 	MasterKey   []byte `json:"masterKey,omitempty"`   // master encryption key (SIV-mode encryption only)
 	MaxPackSize int    `json:"maxPackSize,omitempty"` // maximum size of a pack object
+
+	StorageClasses *StorageClassPolicy `json:"storageClasses,omitempty"` // storage classes of written blobs
+
+	// KeyPurposes, when set, causes keys for each purpose to be derived from the master key
+	// instead of using HMACSecret and MasterKey directly.
+	KeyPurposes *KeyPurposes `json:"keyPurposes,omitempty"`
+}
+
+// KeyPurposes specifies HKDF purposes used to derive independent keys from the master key.
+// Changing a single purpose replaces the keys used for it without affecting the others.
+type KeyPurposes struct {
+	ContentID  string `json:"contentID"`  // content IDs and encryption of contents
+	Index      string `json:"index"`      // authentication and encryption of index blobs
+	Manifest   string `json:"manifest"`   // content IDs and encryption of manifests
+	LocalCache string `json:"localCache"` // integrity of locally cached data
+}
+
+// DefaultKeyPurposes are the key purposes of new repositories.
+var DefaultKeyPurposes = KeyPurposes{
+	ContentID:  "content-id",
+	Index:      "index",
+	Manifest:   "manifest",
+	LocalCache: "local-cache-integrity",
 }
 
 // GetEncryptionAlgorithm implements encryption.Parameters
@@ -29,3 +62,31 @@ func (f *FormattingOptions) GetHashFunction() string {
 func (f *FormattingOptions) GetHMACSecret() []byte {
 	return f.HMACSecret
 }
+
+// DeriveKey derives a key of a given length for the specified purpose from the master key using HKDF.
+func (f *FormattingOptions) DeriveKey(purpose string, length int) []byte {
+	key := make([]byte, length)
+	k := hkdf.New(sha256.New, f.MasterKey, nil, []byte(purpose))
+
+	if _, err := io.ReadFull(k, key); err != nil {
+		panic("unable to derive key from master key, this should never happen")
+	}
+
+	return key
+}
+
+// forPurpose returns formatting options with the HMAC secret and master key derived for the specified purpose.
+func (f *FormattingOptions) forPurpose(purpose string) *FormattingOptions {
+	if f.KeyPurposes == nil {
+		return f
+	}
+
+	fo := *f
+	fo.MasterKey = f.DeriveKey(purpose+"-encryption", len(f.MasterKey))
+
+	if len(f.HMACSecret) > 0 {
+		fo.HMACSecret = f.DeriveKey(purpose+"-hmac", len(f.HMACSecret))
+	}
+
+	return &fo
+}
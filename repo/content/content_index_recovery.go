@@ -175,9 +175,9 @@ func (bm *lockFreeManager) writePackFileIndexRecoveryData(buf *bytes.Buffer, pen
 		return err
 	}
 
-	localIndexIV := bm.hashData(nil, localIndex)
+	localIndexIV := bm.hashData(bm.indexCrypto, nil, localIndex)
 
-	encryptedLocalIndex, err := bm.encryptor.Encrypt(nil, localIndex, localIndexIV)
+	encryptedLocalIndex, err := bm.indexCrypto.encryptor.Encrypt(nil, localIndex, localIndexIV)
 	if err != nil {
 		return err
 	}
@@ -224,7 +224,7 @@ func (bm *lockFreeManager) readPackFileLocalIndex(ctx context.Context, packFile
 		return nil, errors.Errorf("unable to find valid local index in file %v", packFile)
 	}
 
-	localIndexBytes, err := bm.decryptAndVerify(encryptedLocalIndexBytes, postamble.localIndexIV)
+	localIndexBytes, err := bm.decryptAndVerify(bm.indexCrypto, encryptedLocalIndexBytes, postamble.localIndexIV)
 	if err != nil {
 		return nil, errors.Wrap(err, "unable to decrypt local index")
 	}
@@ -16,7 +16,9 @@ import (
 	"go.opencensus.io/stats"
 
 	"github.com/kopia/kopia/internal/buf"
+	"github.com/kopia/kopia/internal/clock"
 	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/blob/appendonly"
 	"github.com/kopia/kopia/repo/logging"
 )
 
@@ -48,7 +50,7 @@ const (
 	defaultMaxPreambleLength = 32
 	defaultPaddingUnit       = 4096
 
-	currentWriteVersion = 1
+	currentWriteVersion = 1 // format version of content entries
 
 	minSupportedWriteVersion = 1
 	maxSupportedWriteVersion = currentWriteVersion
@@ -56,6 +58,10 @@ const (
 	minSupportedReadVersion = 1
 	maxSupportedReadVersion = currentWriteVersion
 
+	// range of repository format versions (FormattingOptions.Version) that can be opened.
+	minSupportedFormatVersion = 1
+	maxSupportedFormatVersion = KeyPurposesFormatVersion
+
 	indexLoadAttempts = 10
 )
 
@@ -84,6 +90,7 @@ type Manager struct {
 	flushPackIndexesAfter  time.Time // time when those indexes should be flushed
 	closed                 chan struct{}
 	bufferPool             sync.Pool
+	appendOnly             bool // contents can't be deleted and indexes are never compacted, since superseded index blobs can't be deleted
 
 	lockFreeManager
 }
@@ -102,6 +109,10 @@ type pendingPackInfo struct {
 // should ever be deleted. That means that contents of such contents should include some element
 // of randomness or a contemporaneous timestamp that will never reappear.
 func (bm *Manager) DeleteContent(ctx context.Context, contentID ID) error {
+	if bm.appendOnly {
+		return errors.Wrapf(appendonly.ErrAppendOnly, "unable to delete content %v", contentID)
+	}
+
 	bm.lock()
 	defer bm.unlock()
 
@@ -502,27 +513,66 @@ func (bm *Manager) getOrCreatePendingPackInfoLocked(prefix blob.ID) (*pendingPac
 // WriteContent saves a given content of data to a pack group with a provided name and returns a contentID
 // that's based on the contents of data written.
 func (bm *Manager) WriteContent(ctx context.Context, data []byte, prefix ID) (ID, error) {
+	contentID, _, err := bm.WriteContentIfMissing(ctx, data, prefix)
+	return contentID, err
+}
+
+// WriteContentIfMissing is like WriteContent but also returns whether the content was actually written
+// because it was not already present in the repository.
+func (bm *Manager) WriteContentIfMissing(ctx context.Context, data []byte, prefix ID) (ID, bool, error) {
 	stats.Record(ctx, metricContentWriteContentCount.M(1))
 	stats.Record(ctx, metricContentWriteContentBytes.M(int64(len(data))))
 
+	contentID, err := bm.ComputeContentID(data, prefix)
+	if err != nil {
+		return "", false, err
+	}
+
+	// content already tracked
+	if _, bi, err := bm.getContentInfo(contentID); err == nil {
+		if !bi.Deleted {
+			return contentID, false, nil
+		}
+	}
+
+	if err := bm.addToPackUnlocked(ctx, contentID, data, false); err != nil {
+		return "", false, err
+	}
+
+	return contentID, true, nil
+}
+
+// ComputeContentID returns the ID that would be assigned to the given data by WriteContent, without writing it.
+func (bm *Manager) ComputeContentID(data []byte, prefix ID) (ID, error) {
 	if err := validatePrefix(prefix); err != nil {
 		return "", err
 	}
 
 	var hashOutput [maxHashSize]byte
 
-	contentID := prefix + ID(hex.EncodeToString(bm.hashData(hashOutput[:0], data)))
+	return prefix + ID(hex.EncodeToString(bm.hashData(bm.cryptoForContentID(prefix), hashOutput[:0], data))), nil
+}
 
-	// content already tracked
-	if _, bi, err := bm.getContentInfo(contentID); err == nil {
-		if !bi.Deleted {
-			return contentID, nil
-		}
+// EncryptBlob encrypts the payload of a blob that is written outside of packs and indexes
+// using the index encryption key. The blob ID must end with at least 16 random hex-encoded bytes,
+// which are used as the initialization vector.
+func (bm *Manager) EncryptBlob(blobID blob.ID, data []byte) ([]byte, error) {
+	iv, err := getIndexBlobIV(blobID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid blob ID %v", blobID)
 	}
 
-	err := bm.addToPackUnlocked(ctx, contentID, data, false)
+	return bm.indexCrypto.encryptor.Encrypt(nil, data, iv)
+}
 
-	return contentID, err
+// DecryptBlob decrypts the payload of a blob encrypted with EncryptBlob.
+func (bm *Manager) DecryptBlob(blobID blob.ID, data []byte) ([]byte, error) {
+	iv, err := getIndexBlobIV(blobID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid blob ID %v", blobID)
+	}
+
+	return bm.indexCrypto.encryptor.Decrypt(nil, data, iv)
 }
 
 // GetContent gets the contents of a given content. If the content is not found returns ErrContentNotFound.
@@ -599,6 +649,21 @@ func (bm *Manager) ContentInfo(ctx context.Context, contentID ID) (Info, error)
 	return bi, err
 }
 
+// IsContentCached returns true if the content can be read without accessing the storage.
+func (bm *Manager) IsContentCached(ctx context.Context, contentID ID) (bool, error) {
+	pp, bi, err := bm.getContentInfo(contentID)
+	if err != nil {
+		return false, err
+	}
+
+	if pp != nil && pp.packBlobID == bi.PackBlobID {
+		// content has not been written to the storage yet.
+		return true, nil
+	}
+
+	return bm.getCacheForContentID(contentID).hasContent(ctx, cacheKey(contentID)), nil
+}
+
 func (bm *Manager) lock() {
 	bm.mu.Lock()
 }
@@ -630,28 +695,81 @@ func (bm *Manager) Refresh(ctx context.Context) (bool, error) {
 type ManagerOptions struct {
 	RepositoryFormatBytes []byte
 	TimeNow               func() time.Time // Time provider
+
+	// AppendOnly refuses deleting contents and disables compaction of indexes, since superseded index blobs can't be deleted.
+	AppendOnly bool
 }
 
 // NewManager creates new content manager with given packing options and a formatter.
 func NewManager(ctx context.Context, st blob.Storage, f *FormattingOptions, caching CachingOptions, options ManagerOptions) (*Manager, error) {
 	nowFn := options.TimeNow
 	if nowFn == nil {
-		nowFn = time.Now // allow:no-inject-time
+		nowFn = clock.Now
+	}
+
+	m, err := newManagerWithoutCompaction(ctx, st, f, caching, nowFn, options.RepositoryFormatBytes)
+	if err != nil {
+		return nil, err
 	}
 
-	return newManagerWithOptions(ctx, st, f, caching, nowFn, options.RepositoryFormatBytes)
+	m.appendOnly = options.AppendOnly
+
+	if err := m.initialize(ctx); err != nil {
+		return nil, err
+	}
+
+	return m, nil
 }
 
 func newManagerWithOptions(ctx context.Context, st blob.Storage, f *FormattingOptions, caching CachingOptions, timeNow func() time.Time, repositoryFormatBytes []byte) (*Manager, error) {
-	if f.Version < minSupportedReadVersion || f.Version > currentWriteVersion {
-		return nil, errors.Errorf("can't handle repositories created using version %v (min supported %v, max supported %v)", f.Version, minSupportedReadVersion, maxSupportedReadVersion)
+	m, err := newManagerWithoutCompaction(ctx, st, f, caching, timeNow, repositoryFormatBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := m.initialize(ctx); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// initialize loads indexes and performs their automatic compaction.
+func (bm *Manager) initialize(ctx context.Context) error {
+	if err := bm.CompactIndexes(ctx, autoCompactionOptions); err != nil {
+		return errors.Wrap(err, "error initializing content manager")
+	}
+
+	return nil
+}
+
+// newManagerWithoutCompaction creates content manager without loading indexes.
+func newManagerWithoutCompaction(ctx context.Context, st blob.Storage, f *FormattingOptions, caching CachingOptions, timeNow func() time.Time, repositoryFormatBytes []byte) (*Manager, error) {
+	if f.Version < minSupportedFormatVersion || f.Version > maxSupportedFormatVersion {
+		return nil, errors.Errorf("can't handle repositories created using version %v (min supported %v, max supported %v)", f.Version, minSupportedFormatVersion, maxSupportedFormatVersion)
+	}
+
+	if f.KeyPurposes != nil && f.Version < KeyPurposesFormatVersion {
+		return nil, errors.Errorf("key purposes require format version %v or newer", KeyPurposesFormatVersion)
 	}
 
-	if f.Version < minSupportedWriteVersion || f.Version > currentWriteVersion {
-		return nil, errors.Errorf("can't handle repositories created using version %v (min supported %v, max supported %v)", f.Version, minSupportedWriteVersion, maxSupportedWriteVersion)
+	purposes := f.KeyPurposes
+	if purposes == nil {
+		// purposes are ignored, all crypto uses the HMAC secret and master key directly.
+		purposes = &KeyPurposes{}
 	}
 
-	hasher, encryptor, err := CreateHashAndEncryptor(f)
+	contentCrypto, err := newKeyedCrypto(f, purposes.ContentID)
+	if err != nil {
+		return nil, err
+	}
+
+	indexCrypto, err := newKeyedCrypto(f, purposes.Index)
+	if err != nil {
+		return nil, err
+	}
+
+	manifestCrypto, err := newKeyedCrypto(f, purposes.Manifest)
 	if err != nil {
 		return nil, err
 	}
@@ -671,7 +789,33 @@ func newManagerWithOptions(ctx context.Context, st blob.Storage, f *FormattingOp
 		return nil, errors.Wrap(err, "unable to initialize metadata cache")
 	}
 
-	listCache, err := newListCache(st, caching)
+	var epochs *epochManager
+
+	journal := newWriteJournal(caching, timeNow)
+
+	listIndexBlobs := func(ctx context.Context) ([]IndexBlobInfo, error) {
+		return listIndexBlobsFromStorage(ctx, st)
+	}
+
+	if f.Version >= epochIndexFormatVersion {
+		if journal != nil && journal.delay > maxEpochListConsistencyDelay {
+			return nil, errors.Errorf("list consistency delay of %v is not supported by repositories using epoch index format, maximum is %v", journal.delay, maxEpochListConsistencyDelay)
+		}
+
+		epochs = newEpochManager(st, timeNow, journal)
+		listIndexBlobs = epochs.activeIndexBlobs
+	} else if journal != nil {
+		listIndexBlobs = func(ctx context.Context) ([]IndexBlobInfo, error) {
+			listed, err := listIndexBlobsFromStorage(ctx, st)
+			if err != nil {
+				return nil, err
+			}
+
+			return journal.mergeRecent(ctx, listed), nil
+		}
+	}
+
+	listCache, err := newListCache(listIndexBlobs, caching, timeNow)
 	if err != nil {
 		return nil, errors.Wrap(err, "unable to initialize list cache")
 	}
@@ -685,20 +829,24 @@ func newManagerWithOptions(ctx context.Context, st blob.Storage, f *FormattingOp
 			CachingOptions:          caching,
 			timeNow:                 timeNow,
 			maxPackSize:             f.MaxPackSize,
-			encryptor:               encryptor,
-			hasher:                  hasher,
+			contentCrypto:           contentCrypto,
+			indexCrypto:             indexCrypto,
+			manifestCrypto:          manifestCrypto,
 			minPreambleLength:       defaultMinPreambleLength,
 			maxPreambleLength:       defaultMaxPreambleLength,
 			paddingUnit:             defaultPaddingUnit,
 			contentCache:            contentCache,
 			metadataCache:           metadataCache,
+			pins:                    newCachePins(caching),
 			listCache:               listCache,
+			epochs:                  epochs,
+			journal:                 journal,
 			st:                      st,
 			repositoryFormatBytes:   repositoryFormatBytes,
 			checkInvariantsOnUnlock: os.Getenv("KOPIA_VERIFY_INVARIANTS") != "",
-			writeFormatVersion:      int32(f.Version),
+			writeFormatVersion:      currentWriteVersion,
 			committedContents:       contentIndex,
-			encryptionBufferPool:    buf.NewPool(ctx, defaultEncryptionBufferPoolSegmentSize+encryptor.MaxOverhead(), "content-manager-encryption"),
+			encryptionBufferPool:    buf.NewPool(ctx, defaultEncryptionBufferPoolSegmentSize+contentCrypto.encryptor.MaxOverhead(), "content-manager-encryption"),
 		},
 
 		mu:   mu,
@@ -715,9 +863,5 @@ func newManagerWithOptions(ctx context.Context, st blob.Storage, f *FormattingOp
 		},
 	}
 
-	if err := m.CompactIndexes(ctx, autoCompactionOptions); err != nil {
-		return nil, errors.Wrap(err, "error initializing content manager")
-	}
-
 	return m, nil
 }
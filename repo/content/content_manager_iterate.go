@@ -1,6 +1,7 @@
 package content
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"strings"
@@ -142,6 +143,24 @@ func (bm *Manager) IterateContents(ctx context.Context, opts IterateOptions, cal
 	return cleanup()
 }
 
+// IterateIndexBlobContents invokes the provided callback for each entry stored in the provided index blob
+// starting with a specified prefix, including deleted entries and entries superseded by other index blobs.
+func (bm *Manager) IterateIndexBlobContents(ctx context.Context, indexBlobID blob.ID, prefix ID, callback IterateCallback) error {
+	data, err := bm.getIndexBlobInternal(ctx, indexBlobID)
+	if err != nil {
+		return errors.Wrapf(err, "unable to read index blob %v", indexBlobID)
+	}
+
+	ndx, err := openPackIndex(bytes.NewReader(data))
+	if err != nil {
+		return errors.Wrapf(err, "unable to open index blob %v", indexBlobID)
+	}
+
+	defer ndx.Close() //nolint:errcheck
+
+	return ndx.Iterate(prefix, callback)
+}
+
 // IteratePackOptions are the options used to iterate over packs
 type IteratePackOptions struct {
 	IncludePacksWithOnlyDeletedContent bool
@@ -25,12 +25,15 @@ type lockFreeManager struct {
 	Stats Stats
 
 	listCache      *listCache
+	epochs         *epochManager // nil when the repository does not use epoch-based index management
+	journal        *writeJournal // nil unless list consistency delay is configured
 	st             blob.Storage
 	Format         FormattingOptions
 	CachingOptions CachingOptions
 
 	contentCache      *contentCache
 	metadataCache     *contentCache
+	pins              *cachePins // nil when caching is not enabled
 	committedContents *committedContentIndex
 
 	checkInvariantsOnUnlock bool
@@ -38,13 +41,17 @@ type lockFreeManager struct {
 	writeFormatVersion int32 // format version to write
 
 	maxPackSize       int
-	hasher            hashing.HashFunc
-	encryptor         encryption.Encryptor
 	minPreambleLength int
 	maxPreambleLength int
 	paddingUnit       int
 	timeNow           func() time.Time
 
+	// crypto using keys for contents, index blobs and manifests, which are distinct only when the
+	// format specifies key purposes.
+	contentCrypto  *keyedCrypto
+	indexCrypto    *keyedCrypto
+	manifestCrypto *keyedCrypto
+
 	repositoryFormatBytes []byte
 
 	encryptionBufferPool *buf.Pool
@@ -58,10 +65,12 @@ func (bm *lockFreeManager) maybeEncryptContentDataForPacking(output *bytes.Buffe
 		return errors.Wrapf(err, "unable to get packed content IV for %q", contentID)
 	}
 
-	b := bm.encryptionBufferPool.Allocate(len(data) + bm.encryptor.MaxOverhead())
+	kc := bm.cryptoForContentID(contentID)
+
+	b := bm.encryptionBufferPool.Allocate(len(data) + kc.encryptor.MaxOverhead())
 	defer b.Release()
 
-	cipherText, err := bm.encryptor.Encrypt(b.Data[:0], data, iv)
+	cipherText, err := kc.encryptor.Encrypt(b.Data[:0], data, iv)
 	if err != nil {
 		return errors.Wrap(err, "unable to encrypt")
 	}
@@ -250,7 +259,7 @@ func (bm *lockFreeManager) getContentDataUnlocked(ctx context.Context, pp *pendi
 		return nil, err
 	}
 
-	decrypted, err := bm.decryptAndVerify(payload, iv)
+	decrypted, err := bm.decryptAndVerify(bm.cryptoForContentID(bi.ID), payload, iv)
 	if err != nil {
 		return nil, errors.Wrapf(err, "invalid checksum at %v offset %v length %v", bi.PackBlobID, bi.PackOffset, len(payload))
 	}
@@ -258,22 +267,22 @@ func (bm *lockFreeManager) getContentDataUnlocked(ctx context.Context, pp *pendi
 	return decrypted, nil
 }
 
-func (bm *lockFreeManager) decryptAndVerify(encrypted, iv []byte) ([]byte, error) {
-	decrypted, err := bm.encryptor.Decrypt(nil, encrypted, iv)
+func (bm *lockFreeManager) decryptAndVerify(kc *keyedCrypto, encrypted, iv []byte) ([]byte, error) {
+	decrypted, err := kc.encryptor.Decrypt(nil, encrypted, iv)
 	if err != nil {
 		return nil, errors.Wrap(err, "decrypt")
 	}
 
 	bm.Stats.decrypted(len(decrypted))
 
-	if bm.encryptor.IsAuthenticated() {
+	if kc.encryptor.IsAuthenticated() {
 		// already verified
 		return decrypted, nil
 	}
 
 	// Since the encryption key is a function of data, we must be able to generate exactly the same key
 	// after decrypting the content. This serves as a checksum.
-	return decrypted, bm.verifyChecksum(decrypted, iv)
+	return decrypted, bm.verifyChecksum(kc, decrypted, iv)
 }
 
 func (bm *lockFreeManager) preparePackDataContent(ctx context.Context, pp *pendingPackInfo) (packIndexBuilder, error) {
@@ -337,7 +346,7 @@ func (bm *lockFreeManager) getIndexBlobInternal(ctx context.Context, blobID blob
 
 	bm.Stats.readContent(len(payload))
 
-	payload, err = bm.encryptor.Decrypt(nil, payload, iv)
+	payload, err = bm.indexCrypto.encryptor.Decrypt(nil, payload, iv)
 	bm.Stats.decrypted(len(payload))
 
 	if err != nil {
@@ -346,7 +355,7 @@ func (bm *lockFreeManager) getIndexBlobInternal(ctx context.Context, blobID blob
 
 	// Since the encryption key is a function of data, we must be able to generate exactly the same key
 	// after decrypting the content. This serves as a checksum.
-	if err := bm.verifyChecksum(payload, iv); err != nil {
+	if err := bm.verifyChecksum(bm.indexCrypto, payload, iv); err != nil {
 		return nil, err
 	}
 
@@ -367,6 +376,10 @@ func getIndexBlobIV(s blob.ID) ([]byte, error) {
 		s = s[0:p]
 	}
 
+	if len(s) < aes.BlockSize*2 {
+		return nil, errors.Errorf("blob ID too short: %v", s)
+	}
+
 	return hex.DecodeString(string(s[len(s)-(aes.BlockSize*2):]))
 }
 
@@ -374,13 +387,13 @@ func (bm *lockFreeManager) writePackFileNotLocked(ctx context.Context, packFile
 	bm.Stats.wroteContent(len(data))
 	bm.listCache.deleteListCache()
 
-	return bm.st.PutBlob(ctx, packFile, data)
+	return bm.putBlob(ctx, packFile, data)
 }
 
 func (bm *lockFreeManager) encryptAndWriteBlobNotLocked(ctx context.Context, data []byte, prefix blob.ID) (blob.ID, error) {
 	var hashOutput [maxHashSize]byte
 
-	hash := bm.hashData(hashOutput[:0], data)
+	hash := bm.hashData(bm.indexCrypto, hashOutput[:0], data)
 	blobID := prefix + blob.ID(hex.EncodeToString(hash))
 
 	iv, err := getIndexBlobIV(blobID)
@@ -390,7 +403,7 @@ func (bm *lockFreeManager) encryptAndWriteBlobNotLocked(ctx context.Context, dat
 
 	bm.Stats.encrypted(len(data))
 
-	data2, err := bm.encryptor.Encrypt(nil, data, iv)
+	data2, err := bm.indexCrypto.encryptor.Encrypt(nil, data, iv)
 	if err != nil {
 		return "", err
 	}
@@ -398,29 +411,46 @@ func (bm *lockFreeManager) encryptAndWriteBlobNotLocked(ctx context.Context, dat
 	bm.Stats.wroteContent(len(data2))
 	bm.listCache.deleteListCache()
 
-	if err := bm.st.PutBlob(ctx, blobID, data2); err != nil {
+	if err := bm.putBlob(ctx, blobID, data2); err != nil {
 		return "", err
 	}
 
+	if bm.journal != nil && isJournaledIndexBlobPrefix(prefix) {
+		bm.journal.recordWritten(ctx, IndexBlobInfo{
+			BlobID:    blobID,
+			Length:    int64(len(data2)),
+			Timestamp: bm.timeNow(),
+		})
+	}
+
 	return blobID, nil
 }
 
-func (bm *lockFreeManager) hashData(output, data []byte) []byte {
+func (bm *lockFreeManager) hashData(kc *keyedCrypto, output, data []byte) []byte {
 	// Hash the content and compute encryption key.
-	contentID := bm.hasher(output, data)
+	contentID := kc.hasher(output, data)
 	bm.Stats.hashedContent(len(data))
 
 	return contentID
 }
 
 func (bm *lockFreeManager) writePackIndexesNew(ctx context.Context, data []byte) (blob.ID, error) {
-	return bm.encryptAndWriteBlobNotLocked(ctx, data, newIndexBlobPrefix)
+	if bm.epochs == nil {
+		return bm.encryptAndWriteBlobNotLocked(ctx, data, newIndexBlobPrefix)
+	}
+
+	epoch, err := bm.epochs.writeEpoch(ctx)
+	if err != nil {
+		return "", errors.Wrap(err, "unable to determine current index epoch")
+	}
+
+	return bm.encryptAndWriteBlobNotLocked(ctx, data, epochIndexBlobPrefixForEpoch(epoch))
 }
 
-func (bm *lockFreeManager) verifyChecksum(data, contentID []byte) error {
+func (bm *lockFreeManager) verifyChecksum(kc *keyedCrypto, data, contentID []byte) error {
 	var hashOutput [maxHashSize]byte
 
-	expected := bm.hasher(hashOutput[:0], data)
+	expected := kc.hasher(hashOutput[:0], data)
 	expected = expected[len(expected)-aes.BlockSize:]
 
 	if !bytes.HasSuffix(contentID, expected) {
@@ -455,3 +485,27 @@ func CreateHashAndEncryptor(f *FormattingOptions) (hashing.HashFunc, encryption.
 
 	return h, e, nil
 }
+
+// keyedCrypto holds hashing and encryption functions using keys for a single purpose.
+type keyedCrypto struct {
+	hasher    hashing.HashFunc
+	encryptor encryption.Encryptor
+}
+
+func newKeyedCrypto(f *FormattingOptions, purpose string) (*keyedCrypto, error) {
+	h, e, err := CreateHashAndEncryptor(f.forPurpose(purpose))
+	if err != nil {
+		return nil, err
+	}
+
+	return &keyedCrypto{hasher: h, encryptor: e}, nil
+}
+
+// cryptoForContentID returns the crypto used for a content with a given ID, manifests use separate keys.
+func (bm *lockFreeManager) cryptoForContentID(contentID ID) *keyedCrypto {
+	if contentID.Prefix() == ManifestContentPrefix {
+		return bm.manifestCrypto
+	}
+
+	return bm.contentCrypto
+}
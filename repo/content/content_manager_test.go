@@ -8,7 +8,9 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
+	"io/ioutil"
 	"math/rand"
+	"os"
 	"reflect"
 	"strings"
 	"sync"
@@ -22,6 +24,7 @@ import (
 	"github.com/kopia/kopia/internal/faketime"
 	"github.com/kopia/kopia/internal/testlogging"
 	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/blob/offline"
 )
 
 const (
@@ -480,6 +483,67 @@ func TestDeleteContent(t *testing.T) {
 	verifyContentNotFound(ctx, t, bm, content2)
 }
 
+func TestIterateIndexBlobContents(t *testing.T) {
+	ctx := testlogging.Context(t)
+	data := blobtesting.DataMap{}
+	keyTime := map[blob.ID]time.Time{}
+
+	bm := newTestContentManager(t, data, keyTime, nil)
+	defer bm.Close(ctx)
+
+	content1 := writeContentAndVerify(ctx, t, bm, seededRandomData(10, 100))
+	content2 := writeContentAndVerify(ctx, t, bm, seededRandomData(11, 100))
+
+	if err := bm.Flush(ctx); err != nil {
+		t.Fatalf("error flushing: %v", err)
+	}
+
+	if err := bm.DeleteContent(ctx, content1); err != nil {
+		t.Fatalf("unable to delete content %v: %v", content1, err)
+	}
+
+	if err := bm.Flush(ctx); err != nil {
+		t.Fatalf("error flushing: %v", err)
+	}
+
+	indexBlobs, err := bm.IndexBlobs(ctx)
+	if err != nil {
+		t.Fatalf("error listing index blobs: %v", err)
+	}
+
+	if len(indexBlobs) != 2 {
+		t.Fatalf("unexpected index blobs: %v", indexBlobs)
+	}
+
+	entries := map[ID][]Info{}
+
+	for _, ib := range indexBlobs {
+		if err := bm.IterateIndexBlobContents(ctx, ib.BlobID, "", func(i Info) error {
+			entries[i.ID] = append(entries[i.ID], i)
+			return nil
+		}); err != nil {
+			t.Fatalf("error iterating index blob %v: %v", ib.BlobID, err)
+		}
+	}
+
+	// the deleted content is present in both index blobs, once as deleted.
+	if got, want := len(entries[content1]), 2; got != want {
+		t.Fatalf("unexpected number of entries for %v: %v, want %v", content1, got, want)
+	}
+
+	if entries[content1][0].Deleted == entries[content1][1].Deleted {
+		t.Errorf("expected exactly one deleted entry for %v: %+v", content1, entries[content1])
+	}
+
+	if got, want := len(entries[content2]), 1; got != want {
+		t.Fatalf("unexpected number of entries for %v: %v, want %v", content2, got, want)
+	}
+
+	if entries[content2][0].Deleted || entries[content2][0].PackBlobID == "" {
+		t.Errorf("unexpected entry for %v: %+v", content2, entries[content2][0])
+	}
+}
+
 func TestParallelWrites(t *testing.T) {
 	t.Parallel()
 
@@ -1255,6 +1319,157 @@ func TestContentReadAliasing(t *testing.T) {
 	verifyContent(ctx, t, bm, id1, contentData)
 }
 
+func TestKeyPurposes(t *testing.T) {
+	ctx := testlogging.Context(t)
+	data := blobtesting.DataMap{}
+	st := blobtesting.NewMapStorage(data, nil, nil)
+
+	newManager := func(purposes *KeyPurposes) *Manager {
+		f := &FormattingOptions{
+			Hash:        "HMAC-SHA256",
+			Encryption:  "AES256-GCM-HMAC-SHA256",
+			HMACSecret:  hmacSecret,
+			MasterKey:   []byte("0123456789abcdef0123456789abcdef"),
+			MaxPackSize: maxPackSize,
+			Version:     KeyPurposesFormatVersion,
+			KeyPurposes: purposes,
+		}
+
+		bm, err := newManagerWithOptions(ctx, st, f, CachingOptions{}, faketime.Frozen(fakeTime), nil)
+		if err != nil {
+			t.Fatalf("can't create content manager: %v", err)
+		}
+
+		return bm
+	}
+
+	legacy := newManager(nil)
+	defer legacy.Close(ctx)
+
+	purposes := DefaultKeyPurposes
+	bm := newManager(&purposes)
+
+	payload := []byte{1, 2, 3}
+
+	contentID, err := bm.WriteContent(ctx, payload, "")
+	if err != nil {
+		t.Fatalf("unable to write content: %v", err)
+	}
+
+	manifestID, err := bm.WriteContent(ctx, payload, ManifestContentPrefix)
+	if err != nil {
+		t.Fatalf("unable to write manifest content: %v", err)
+	}
+
+	if legacyID, _ := legacy.ComputeContentID(payload, ""); legacyID == contentID {
+		t.Errorf("content ID should not depend on the HMAC secret: %v", contentID)
+	}
+
+	if manifestID[1:] == contentID {
+		t.Errorf("manifest content should use a separate key: %v", manifestID)
+	}
+
+	if err := bm.Flush(ctx); err != nil {
+		t.Fatalf("unable to flush: %v", err)
+	}
+
+	bm.Close(ctx)
+
+	// replacing the manifest key does not affect index blobs or other contents.
+	rotated := DefaultKeyPurposes
+	rotated.Manifest = "manifest-2"
+
+	bm = newManager(&rotated)
+	defer bm.Close(ctx)
+
+	verifyContent(ctx, t, bm, contentID, payload)
+
+	if _, err := bm.GetContent(ctx, manifestID); err == nil {
+		t.Errorf("unexpected success reading manifest content with a different key")
+	}
+}
+
+func TestOfflineContentManager(t *testing.T) {
+	ctx := testlogging.Context(t)
+	data := blobtesting.DataMap{}
+
+	cacheDir, err := ioutil.TempDir("", "kopia-offline")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+
+	defer os.RemoveAll(cacheDir) //nolint:errcheck
+
+	caching := CachingOptions{
+		CacheDirectory:          cacheDir,
+		MaxCacheSizeBytes:       1e6,
+		MaxListCacheDurationSec: 1,
+		HMACSecret:              hmacSecret,
+	}
+
+	f := &FormattingOptions{
+		Hash:        "HMAC-SHA256",
+		Encryption:  "AES256-GCM-HMAC-SHA256",
+		HMACSecret:  hmacSecret,
+		MaxPackSize: maxPackSize,
+		Version:     1,
+	}
+
+	bm, err := newManagerWithOptions(ctx, blobtesting.NewMapStorage(data, nil, nil), f, caching, faketime.Frozen(fakeTime), nil)
+	if err != nil {
+		t.Fatalf("can't create content manager: %v", err)
+	}
+
+	cachedID := writeContentAndVerify(ctx, t, bm, seededRandomData(1, 100))
+	uncachedID := writeContentAndVerify(ctx, t, bm, seededRandomData(2, 100))
+
+	if err := bm.Flush(ctx); err != nil {
+		t.Fatalf("unable to flush: %v", err)
+	}
+
+	bm.Close(ctx)
+
+	// reading the content from the storage stores it in the cache.
+	bm, err = newManagerWithOptions(ctx, blobtesting.NewMapStorage(data, nil, nil), f, caching, faketime.Frozen(fakeTime), nil)
+	if err != nil {
+		t.Fatalf("can't create content manager: %v", err)
+	}
+
+	verifyContent(ctx, t, bm, cachedID, seededRandomData(1, 100))
+	bm.Close(ctx)
+
+	// the list of index blobs is used in offline mode even though it has expired.
+	bm, err = newManagerWithOptions(ctx, offline.NewStorage(blob.ConnectionInfo{}), f, caching, faketime.Frozen(fakeTime.Add(time.Hour)), nil)
+	if err != nil {
+		t.Fatalf("can't create offline content manager: %v", err)
+	}
+
+	defer bm.Close(ctx)
+
+	verifyContent(ctx, t, bm, cachedID, seededRandomData(1, 100))
+
+	if _, err := bm.GetContent(ctx, uncachedID); !errors.Is(err, offline.ErrOffline) {
+		t.Errorf("unexpected error reading uncached content: %v", err)
+	}
+
+	for _, tc := range []struct {
+		contentID ID
+		want      bool
+	}{
+		{cachedID, true},
+		{uncachedID, false},
+	} {
+		got, err := bm.IsContentCached(ctx, tc.contentID)
+		if err != nil {
+			t.Fatalf("unable to check content %v: %v", tc.contentID, err)
+		}
+
+		if got != tc.want {
+			t.Errorf("unexpected IsContentCached(%v): %v, want %v", tc.contentID, got, tc.want)
+		}
+	}
+}
+
 func TestVersionCompatibility(t *testing.T) {
 	for writeVer := minSupportedReadVersion; writeVer <= currentWriteVersion; writeVer++ {
 		writeVer := writeVer
@@ -0,0 +1,575 @@
+package content
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo/blob"
+)
+
+// Epoch-based index management.
+//
+// Starting with repository format version 2, index blobs are grouped into epochs identified by
+// consecutive numbers starting at zero. Writers always write index blobs into the current epoch
+// as "xn<epoch>_<hash>". The epoch is advanced by writing an (empty) marker blob "xe<epoch>" once
+// enough index blobs have accumulated in the current epoch and it's old enough.
+//
+// Epochs older than the two most recent ones no longer receive writes and are compacted into
+// blobs named "xs<first>_<last>_<hash>", each replacing all index blobs in a range of epochs.
+// Compactions of individual epochs are in turn periodically merged into a single one covering all
+// settled epochs, so the number of index blobs to read at open time stays small regardless of
+// repository age. Explicit index optimization can additionally compact all epochs including the most recent ones
+// into a single "xs0_<current>_<hash>" blob.
+//
+// Index blobs written using the legacy scheme ("n" prefix) are treated as belonging to epoch zero.
+const (
+	epochIndexFormatVersion = 2
+
+	epochBlobPrefix          blob.ID = "x"
+	epochMarkerBlobPrefix    blob.ID = "xe"
+	epochIndexBlobPrefix     blob.ID = "xn"
+	epochCompactedBlobPrefix blob.ID = "xs"
+
+	// epoch is advanced when it has at least this many uncompacted index blobs and is old enough.
+	epochAdvanceMinBlobs = 20
+	epochAdvanceMinAge   = 1 * time.Hour
+
+	// writers re-read the current epoch when the last known one is older than this,
+	// must be well below epochAdvanceMinAge.
+	epochRefreshInterval = 10 * time.Minute
+
+	// compactions of settled epochs are merged when there are at least this many of them.
+	epochMergeMinBlobs = 10
+
+	// index blobs written shortly before a compaction may not have been included in it,
+	// so they remain active in addition to the compaction.
+	epochCompactionListingMargin = 10 * time.Minute
+
+	// superseded index blobs are deleted only after the replacement has been around for this long,
+	// so that all readers have a chance to see it.
+	epochCleanupSafetyMargin = 1 * time.Hour
+)
+
+// epochRange is an index blob covering all index blobs in a range of epochs.
+type epochRange struct {
+	first, last int
+	IndexBlobInfo
+}
+
+func (r epochRange) contains(epoch int) bool {
+	return r.first <= epoch && epoch <= r.last
+}
+
+// supersedes returns true if the given uncompacted index blob in a covered epoch is guaranteed to be included in the range.
+func (r epochRange) supersedes(b IndexBlobInfo) bool {
+	return b.Timestamp.Before(r.Timestamp.Add(-epochCompactionListingMargin))
+}
+
+// epochIndexState is the snapshot of epoch-related blobs in the storage.
+type epochIndexState struct {
+	currentEpoch     int
+	currentEpochTime time.Time // time when the current epoch started
+
+	markers     map[int]IndexBlobInfo
+	uncompacted map[int][]IndexBlobInfo
+	compacted   []epochRange
+
+	// results of computeActiveSet()
+	active        []IndexBlobInfo
+	activeRanges  []epochRange
+	activeSettled int // number of active blobs in settled epochs
+}
+
+// settledEpoch returns the latest epoch that's guaranteed not to receive any more writes.
+func (s *epochIndexState) settledEpoch() int {
+	return s.currentEpoch - 2 //nolint:gomnd
+}
+
+// coveringRange returns the active range that covers a given epoch.
+func (s *epochIndexState) coveringRange(epoch int) (epochRange, bool) {
+	for _, r := range s.activeRanges {
+		if r.contains(epoch) {
+			return r, true
+		}
+	}
+
+	return epochRange{}, false
+}
+
+func parseEpochNumber(s string) (int, bool) {
+	v, err := strconv.Atoi(s)
+	if err != nil || v < 0 {
+		return 0, false
+	}
+
+	return v, true
+}
+
+// parseEpochIndexState builds epoch index state from the list of epoch and legacy index blobs.
+func parseEpochIndexState(ctx context.Context, epochBlobs, legacyBlobs []blob.Metadata) *epochIndexState {
+	s := &epochIndexState{
+		markers:     map[int]IndexBlobInfo{},
+		uncompacted: map[int][]IndexBlobInfo{},
+	}
+
+	for _, bm := range legacyBlobs {
+		s.uncompacted[0] = append(s.uncompacted[0], IndexBlobInfo{BlobID: bm.BlobID, Length: bm.Length, Timestamp: bm.Timestamp})
+	}
+
+	for _, bm := range epochBlobs {
+		ibi := IndexBlobInfo{BlobID: bm.BlobID, Length: bm.Length, Timestamp: bm.Timestamp}
+		id := string(bm.BlobID)
+
+		switch {
+		case strings.HasPrefix(id, string(epochMarkerBlobPrefix)):
+			if n, ok := parseEpochNumber(strings.TrimPrefix(id, string(epochMarkerBlobPrefix))); ok {
+				s.markers[n] = ibi
+				continue
+			}
+
+		case strings.HasPrefix(id, string(epochIndexBlobPrefix)):
+			parts := strings.SplitN(strings.TrimPrefix(id, string(epochIndexBlobPrefix)), "_", 2) //nolint:gomnd
+			if n, ok := parseEpochNumber(parts[0]); ok && len(parts) == 2 {
+				s.uncompacted[n] = append(s.uncompacted[n], ibi)
+				continue
+			}
+
+		case strings.HasPrefix(id, string(epochCompactedBlobPrefix)):
+			parts := strings.SplitN(strings.TrimPrefix(id, string(epochCompactedBlobPrefix)), "_", 3) //nolint:gomnd
+			if len(parts) == 3 {
+				first, ok1 := parseEpochNumber(parts[0])
+				last, ok2 := parseEpochNumber(parts[1])
+
+				if ok1 && ok2 && first <= last {
+					s.compacted = append(s.compacted, epochRange{first, last, ibi})
+					continue
+				}
+			}
+		}
+
+		log(ctx).Warningf("ignoring unrecognized epoch index blob: %v", bm.BlobID)
+	}
+
+	for n := range s.markers {
+		if n > s.currentEpoch {
+			s.currentEpoch = n
+		}
+	}
+
+	for n := range s.uncompacted {
+		if n > s.currentEpoch {
+			s.currentEpoch = n
+		}
+	}
+
+	if m, ok := s.markers[s.currentEpoch]; ok {
+		s.currentEpochTime = m.Timestamp
+	} else {
+		for _, b := range s.uncompacted[s.currentEpoch] {
+			if s.currentEpochTime.IsZero() || b.Timestamp.Before(s.currentEpochTime) {
+				s.currentEpochTime = b.Timestamp
+			}
+		}
+	}
+
+	s.computeActiveSet()
+
+	return s
+}
+
+// computeActiveSet determines the minimal set of index blobs that needs to be read to get complete index.
+//
+// Starting from epoch zero, the widest compaction starting at the next uncovered epoch is chosen, and
+// the epochs not covered by any compaction use their uncompacted index blobs. Index blobs in covered epochs
+// written around or after the time of the compaction covering them are included too, since they could have
+// been missed by it or written by writers that were late to learn about epoch change.
+//
+// The choice only depends on the blobs that end up in the active set, so deleting blobs outside of it never
+// changes the result for other readers.
+func (s *epochIndexState) computeActiveSet() {
+	sort.Slice(s.compacted, func(i, j int) bool {
+		a, b := s.compacted[i], s.compacted[j]
+
+		if a.first != b.first {
+			return a.first < b.first
+		}
+
+		if a.last != b.last {
+			return a.last > b.last
+		}
+
+		return a.BlobID < b.BlobID
+	})
+
+	s.active = nil
+	s.activeRanges = nil
+	s.activeSettled = 0
+
+	epoch := 0
+
+	for epoch <= s.currentEpoch {
+		r, ok := s.findRangeStartingAt(epoch)
+		if !ok {
+			s.addActive(epoch, s.uncompacted[epoch]...)
+			epoch++
+
+			continue
+		}
+
+		s.activeRanges = append(s.activeRanges, r)
+		s.addActive(r.last, r.IndexBlobInfo)
+
+		for e := r.first; e <= r.last; e++ {
+			for _, b := range s.uncompacted[e] {
+				if !r.supersedes(b) {
+					s.addActive(e, b)
+				}
+			}
+		}
+
+		epoch = r.last + 1
+	}
+}
+
+func (s *epochIndexState) findRangeStartingAt(epoch int) (epochRange, bool) {
+	for _, r := range s.compacted {
+		if r.first == epoch {
+			return r, true
+		}
+	}
+
+	return epochRange{}, false
+}
+
+func (s *epochIndexState) addActive(epoch int, blobs ...IndexBlobInfo) {
+	s.active = append(s.active, blobs...)
+
+	if epoch <= s.settledEpoch() {
+		s.activeSettled += len(blobs)
+	}
+}
+
+// epochManager keeps track of the current index epoch.
+type epochManager struct {
+	st      blob.Storage
+	timeNow func() time.Time
+	journal *writeJournal // nil unless list consistency delay is configured
+
+	mu          sync.Mutex
+	lastState   *epochIndexState
+	lastRefresh time.Time
+}
+
+// refresh lists epoch blobs in the storage and returns the new state.
+func (e *epochManager) refresh(ctx context.Context) (*epochIndexState, error) {
+	epochBlobs, err := blob.ListAllBlobsConsistent(ctx, e.st, epochBlobPrefix, math.MaxInt32)
+	if err != nil {
+		return nil, errors.Wrap(err, "error listing epoch index blobs")
+	}
+
+	legacyBlobs, err := blob.ListAllBlobsConsistent(ctx, e.st, newIndexBlobPrefix, math.MaxInt32)
+	if err != nil {
+		return nil, errors.Wrap(err, "error listing legacy index blobs")
+	}
+
+	if e.journal != nil {
+		epochBlobs = e.journal.mergeRecentMetadata(ctx, epochBlobPrefix, epochBlobs)
+		legacyBlobs = e.journal.mergeRecentMetadata(ctx, newIndexBlobPrefix, legacyBlobs)
+	}
+
+	s := parseEpochIndexState(ctx, epochBlobs, legacyBlobs)
+
+	e.mu.Lock()
+	e.lastState = s
+	e.lastRefresh = e.timeNow()
+	e.mu.Unlock()
+
+	return s, nil
+}
+
+// activeIndexBlobs returns the list of index blobs that need to be read to get complete index.
+func (e *epochManager) activeIndexBlobs(ctx context.Context) ([]IndexBlobInfo, error) {
+	s, err := e.refresh(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.active, nil
+}
+
+// writeEpoch returns the epoch new index blobs should be written to.
+func (e *epochManager) writeEpoch(ctx context.Context) (int, error) {
+	e.mu.Lock()
+	s, lastRefresh := e.lastState, e.lastRefresh
+	e.mu.Unlock()
+
+	if s != nil && e.timeNow().Sub(lastRefresh) < epochRefreshInterval {
+		return s.currentEpoch, nil
+	}
+
+	s, err := e.refresh(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	return s.currentEpoch, nil
+}
+
+func newEpochManager(st blob.Storage, timeNow func() time.Time, journal *writeJournal) *epochManager {
+	return &epochManager{
+		st:      st,
+		timeNow: timeNow,
+		journal: journal,
+	}
+}
+
+// epochIndexBlobPrefixForEpoch returns the prefix of index blobs written in a given epoch.
+func epochIndexBlobPrefixForEpoch(epoch int) blob.ID {
+	return epochIndexBlobPrefix + blob.ID(fmt.Sprintf("%v_", epoch))
+}
+
+// compactEpochIndexes performs epoch index maintenance: advances the epoch, compacts settled epochs,
+// merges their compactions and removes index blobs that have been superseded.
+func (bm *Manager) compactEpochIndexes(ctx context.Context, opt CompactOptions) error {
+	s, err := bm.epochs.refresh(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := bm.maybeAdvanceEpoch(ctx, s); err != nil {
+		return errors.Wrap(err, "error advancing epoch")
+	}
+
+	changed := false
+
+	for epoch := 0; epoch <= s.settledEpoch(); epoch++ {
+		if _, covered := s.coveringRange(epoch); covered || len(s.uncompacted[epoch]) < 2 { //nolint:gomnd
+			continue
+		}
+
+		if err := bm.writeEpochRange(ctx, epoch, epoch, s.uncompacted[epoch], opt); err != nil {
+			return errors.Wrapf(err, "error compacting epoch %v", epoch)
+		}
+
+		changed = true
+	}
+
+	if changed {
+		if s, err = bm.epochs.refresh(ctx); err != nil {
+			return err
+		}
+	}
+
+	if s.activeSettled >= epochMergeMinBlobs || (opt.AllIndexes && s.activeSettled > 1) {
+		if err := bm.mergeSettledEpochs(ctx, s, opt); err != nil {
+			return errors.Wrap(err, "error merging settled epochs")
+		}
+
+		if s, err = bm.epochs.refresh(ctx); err != nil {
+			return err
+		}
+	}
+
+	if opt.IncludeRecentEpochs && len(s.active) > opt.MaxSmallBlobs && len(s.active) > 1 {
+		if err := bm.compactAllEpochs(ctx, s, opt); err != nil {
+			return errors.Wrap(err, "error compacting all epochs")
+		}
+
+		if s, err = bm.epochs.refresh(ctx); err != nil {
+			return err
+		}
+	}
+
+	bm.cleanupSupersededIndexBlobs(ctx, s)
+
+	return nil
+}
+
+// compactAllEpochs writes a single compaction covering all active index blobs, including those in the most recent
+// epochs, and deletes the compacted blobs right away as legacy index compaction does. Index blobs written
+// concurrently with the compaction remain active, since they are not older than it.
+func (bm *Manager) compactAllEpochs(ctx context.Context, s *epochIndexState, opt CompactOptions) error {
+	if err := bm.writeEpochRange(ctx, 0, s.currentEpoch, s.active, opt); err != nil {
+		return err
+	}
+
+	bm.listCache.deleteListCache()
+
+	for _, b := range s.active {
+		log(ctx).Debugf("deleting compacted index blob %v", b.BlobID)
+
+		if err := bm.st.DeleteBlob(ctx, b.BlobID); err != nil && err != blob.ErrBlobNotFound {
+			log(ctx).Warningf("unable to delete compacted index blob %q: %v", b.BlobID, err)
+		}
+	}
+
+	return nil
+}
+
+func (bm *Manager) maybeAdvanceEpoch(ctx context.Context, s *epochIndexState) error {
+	if len(s.uncompacted[s.currentEpoch]) < epochAdvanceMinBlobs {
+		return nil
+	}
+
+	if bm.timeNow().Sub(s.currentEpochTime) < epochAdvanceMinAge {
+		return nil
+	}
+
+	next := s.currentEpoch + 1
+
+	log(ctx).Debugf("advancing index epoch to %v", next)
+
+	bm.listCache.deleteListCache()
+
+	markerID := epochMarkerBlobPrefix + blob.ID(strconv.Itoa(next))
+
+	if err := bm.st.PutBlob(ctx, markerID, nil); err != nil {
+		return err
+	}
+
+	if bm.journal != nil {
+		bm.journal.recordWritten(ctx, IndexBlobInfo{BlobID: markerID, Timestamp: bm.timeNow()})
+	}
+
+	return nil
+}
+
+// mergeSettledEpochs writes a single compaction covering all active index blobs in settled epochs.
+func (bm *Manager) mergeSettledEpochs(ctx context.Context, s *epochIndexState, opt CompactOptions) error {
+	last := s.settledEpoch()
+
+	var blobs []IndexBlobInfo
+
+	// ranges extending past settled epochs are written by compactAllEpochs and are merged as a whole,
+	// otherwise the merge would be narrower than them and never become active.
+	for _, r := range s.activeRanges {
+		if r.first <= s.settledEpoch() {
+			blobs = append(blobs, r.IndexBlobInfo)
+
+			if r.last > last {
+				last = r.last
+			}
+		}
+	}
+
+	for epoch := 0; epoch <= last; epoch++ {
+		r, covered := s.coveringRange(epoch)
+
+		for _, b := range s.uncompacted[epoch] {
+			if !covered || !r.supersedes(b) {
+				blobs = append(blobs, b)
+			}
+		}
+	}
+
+	return bm.writeEpochRange(ctx, 0, last, blobs, opt)
+}
+
+// writeEpochRange writes an index blob that combines given index blobs and covers a range of epochs.
+func (bm *Manager) writeEpochRange(ctx context.Context, first, last int, indexBlobs []IndexBlobInfo, opt CompactOptions) error {
+	formatLog(ctx).Debugf("compacting %v index blobs in epochs %v..%v", len(indexBlobs), first, last)
+
+	if first != 0 {
+		// deleted entries can only be dropped when all older index entries are being compacted together,
+		// otherwise previous versions of deleted contents would become visible again.
+		opt.SkipDeletedOlderThan = 0
+	}
+
+	bld := make(packIndexBuilder)
+
+	for _, indexBlob := range indexBlobs {
+		if err := bm.addIndexBlobsToBuilder(ctx, bld, indexBlob); err != nil {
+			return err
+		}
+	}
+
+	bm.dropDeletedContents(ctx, bld, opt)
+
+	var buf bytes.Buffer
+	if err := bld.Build(&buf); err != nil {
+		return errors.Wrap(err, "unable to build an index")
+	}
+
+	prefix := epochCompactedBlobPrefix + blob.ID(fmt.Sprintf("%v_%v_", first, last))
+
+	blobID, err := bm.encryptAndWriteBlobNotLocked(ctx, buf.Bytes(), prefix)
+	if err != nil {
+		return errors.Wrap(err, "unable to write compacted index")
+	}
+
+	formatLog(ctx).Debugf("wrote compacted index %v", blobID)
+
+	return nil
+}
+
+// cleanupSupersededIndexBlobs deletes index blobs that have been replaced by compactions
+// and epoch markers that are no longer needed.
+func (bm *Manager) cleanupSupersededIndexBlobs(ctx context.Context, s *epochIndexState) {
+	now := bm.timeNow()
+
+	canDelete := func(r epochRange) bool {
+		return now.Sub(r.Timestamp) >= epochCleanupSafetyMargin
+	}
+
+	isActive := map[blob.ID]bool{}
+	for _, b := range s.active {
+		isActive[b.BlobID] = true
+	}
+
+	var toDelete []blob.ID
+
+	for epoch, blobs := range s.uncompacted {
+		r, covered := s.coveringRange(epoch)
+		if !covered || !canDelete(r) {
+			continue
+		}
+
+		for _, b := range blobs {
+			if !isActive[b.BlobID] {
+				toDelete = append(toDelete, b.BlobID)
+			}
+		}
+	}
+
+	for _, c := range s.compacted {
+		if isActive[c.BlobID] {
+			continue
+		}
+
+		for _, r := range s.activeRanges {
+			if r.first <= c.first && c.last <= r.last && canDelete(r) {
+				toDelete = append(toDelete, c.BlobID)
+				break
+			}
+		}
+	}
+
+	for n, m := range s.markers {
+		if n < s.currentEpoch-1 {
+			toDelete = append(toDelete, m.BlobID)
+		}
+	}
+
+	if len(toDelete) == 0 {
+		return
+	}
+
+	bm.listCache.deleteListCache()
+
+	for _, blobID := range toDelete {
+		log(ctx).Debugf("deleting superseded index blob %v", blobID)
+
+		if err := bm.st.DeleteBlob(ctx, blobID); err != nil && err != blob.ErrBlobNotFound {
+			log(ctx).Warningf("unable to delete superseded index blob %q: %v", blobID, err)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package content
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kopia/kopia/internal/blobtesting"
+	"github.com/kopia/kopia/internal/faketime"
+	"github.com/kopia/kopia/internal/testlogging"
+	"github.com/kopia/kopia/repo/blob"
+)
+
+func newTestContentManagerWithVersion(t *testing.T, st blob.Storage, timeFunc func() time.Time, version int) *Manager {
+	t.Helper()
+
+	bm, err := newManagerWithOptions(testlogging.Context(t), st, &FormattingOptions{
+		Hash:        "HMAC-SHA256",
+		Encryption:  "AES256-GCM-HMAC-SHA256",
+		HMACSecret:  hmacSecret,
+		MaxPackSize: maxPackSize,
+		Version:     version,
+	}, CachingOptions{}, timeFunc, nil)
+	if err != nil {
+		t.Fatalf("can't create content manager: %v", err)
+	}
+
+	bm.checkInvariantsOnUnlock = true
+
+	return bm
+}
+
+func TestEpochIndexManagement(t *testing.T) {
+	ctx := testlogging.Context(t)
+	data := blobtesting.DataMap{}
+	keyTime := map[blob.ID]time.Time{}
+	ta := faketime.NewTimeAdvance(fakeTime)
+	st := blobtesting.NewMapStorage(data, keyTime, ta.NowFunc())
+
+	// write some contents using legacy index format, they will end up in epoch zero.
+	bm := newTestContentManagerWithVersion(t, st, ta.NowFunc(), 1)
+	contents := map[ID][]byte{}
+
+	for i := 0; i < 5; i++ {
+		b := seededRandomData(i, 100)
+		contents[writeContentAndVerify(ctx, t, bm, b)] = b
+		assertNoError(t, bm.Flush(ctx))
+	}
+
+	bm.Close(ctx)
+
+	const flushCount = 500
+
+	for i := 5; i < flushCount; i++ {
+		// each iteration simulates separate kopia invocation, which performs index maintenance on open.
+		bm = newTestContentManagerWithVersion(t, st, ta.NowFunc(), epochIndexFormatVersion)
+
+		b := seededRandomData(i, 100)
+		contents[writeContentAndVerify(ctx, t, bm, b)] = b
+		assertNoError(t, bm.Flush(ctx))
+		bm.Close(ctx)
+
+		ta.Advance(5 * time.Minute)
+	}
+
+	if got := countBlobsWithPrefix(data, newIndexBlobPrefix); got != 0 {
+		t.Errorf("legacy index blobs were not cleaned up: %v", got)
+	}
+
+	bm = newTestContentManagerWithVersion(t, st, ta.NowFunc(), epochIndexFormatVersion)
+	defer bm.Close(ctx)
+
+	s, err := bm.epochs.refresh(ctx)
+	assertNoError(t, err)
+
+	if s.currentEpoch < 10 {
+		t.Errorf("epoch did not advance enough: %v", s.currentEpoch)
+	}
+
+	// active index blobs are at most: merged compaction + (epochMergeMinBlobs-1) epoch compactions +
+	// index blobs in the two most recent epochs.
+	if got, max := len(s.active), epochMergeMinBlobs+3*epochAdvanceMinBlobs; got > max {
+		t.Errorf("too many active index blobs: %v, want at most %v", got, max)
+	}
+
+	if got, max := countBlobsWithPrefix(data, epochBlobPrefix), 2*(epochMergeMinBlobs+3*epochAdvanceMinBlobs); got > max {
+		t.Errorf("too many epoch index blobs in storage: %v, want at most %v", got, max)
+	}
+
+	verifyContentManagerDataSet(ctx, t, bm, contents)
+
+	// full compaction merges everything except the two most recent epochs.
+	assertNoError(t, bm.CompactIndexes(ctx, CompactOptions{AllIndexes: true}))
+
+	s, err = bm.epochs.refresh(ctx)
+	assertNoError(t, err)
+
+	if got, want := s.activeSettled, 1; got != want {
+		t.Errorf("unexpected number of active index blobs in settled epochs: %v, want %v", got, want)
+	}
+
+	verifyContentManagerDataSet(ctx, t, newTestContentManagerWithVersion(t, st, ta.NowFunc(), epochIndexFormatVersion), contents)
+
+	// compaction including recent epochs leaves a single index blob.
+	assertNoError(t, bm.CompactIndexes(ctx, CompactOptions{MaxSmallBlobs: 1, IncludeRecentEpochs: true}))
+
+	s, err = bm.epochs.refresh(ctx)
+	assertNoError(t, err)
+
+	if got, want := len(s.active), 1; got != want {
+		t.Errorf("unexpected number of active index blobs: %v, want %v", got, want)
+	}
+
+	// index blobs written afterwards in the same epoch remain active.
+	b := seededRandomData(flushCount, 100)
+	contents[writeContentAndVerify(ctx, t, bm, b)] = b
+	assertNoError(t, bm.Flush(ctx))
+
+	s, err = bm.epochs.refresh(ctx)
+	assertNoError(t, err)
+
+	if got, want := len(s.active), 2; got != want {
+		t.Errorf("unexpected number of active index blobs: %v, want %v", got, want)
+	}
+
+	verifyContentManagerDataSet(ctx, t, newTestContentManagerWithVersion(t, st, ta.NowFunc(), epochIndexFormatVersion), contents)
+
+	// subsequent maintenance keeps working after the epochs settle.
+	for i := flushCount + 1; i < flushCount+200; i++ {
+		bm2 := newTestContentManagerWithVersion(t, st, ta.NowFunc(), epochIndexFormatVersion)
+
+		b := seededRandomData(i, 100)
+		contents[writeContentAndVerify(ctx, t, bm2, b)] = b
+		assertNoError(t, bm2.Flush(ctx))
+		bm2.Close(ctx)
+
+		ta.Advance(5 * time.Minute)
+	}
+
+	s, err = bm.epochs.refresh(ctx)
+	assertNoError(t, err)
+
+	if got, max := len(s.active), epochMergeMinBlobs+3*epochAdvanceMinBlobs; got > max {
+		t.Errorf("too many active index blobs: %v, want at most %v", got, max)
+	}
+
+	verifyContentManagerDataSet(ctx, t, newTestContentManagerWithVersion(t, st, ta.NowFunc(), epochIndexFormatVersion), contents)
+}
+
+func TestEpochIndexActiveSet(t *testing.T) {
+	ctx := testlogging.Context(t)
+	t0 := fakeTime
+
+	md := func(id string, dt time.Duration) blob.Metadata {
+		return blob.Metadata{BlobID: blob.ID(id), Timestamp: t0.Add(dt)}
+	}
+
+	s := parseEpochIndexState(ctx, []blob.Metadata{
+		md("xe1", 0),
+		md("xe3", 0),
+		md("xn0_aaa", 1*time.Second),
+		md("xn1_bbb", 2*time.Second),
+		md("xn1_ccc", 3*time.Second),
+		md("xs0_1_ddd", 30*time.Minute),
+		md("xs0_0_eee", 15*time.Minute),
+		md("xn1_late", 25*time.Minute), // possibly missed by the compaction
+		md("xn2_fff", 40*time.Minute),
+		md("xn3_ggg", 50*time.Minute),
+		md("xbogus", 0),
+	}, []blob.Metadata{
+		md("nlegacy", 0),
+	})
+
+	if got, want := s.currentEpoch, 3; got != want {
+		t.Errorf("invalid current epoch: %v, want %v", got, want)
+	}
+
+	var active []string
+	for _, b := range s.active {
+		active = append(active, string(b.BlobID))
+	}
+
+	if got, want := strings.Join(active, ","), "xs0_1_ddd,xn1_late,xn2_fff,xn3_ggg"; got != want {
+		t.Errorf("invalid active set: %v, want %v", got, want)
+	}
+
+	if got, want := s.activeSettled, 2; got != want {
+		t.Errorf("invalid number of settled active blobs: %v, want %v", got, want)
+	}
+}
+
+func countBlobsWithPrefix(d blobtesting.DataMap, prefix blob.ID) int {
+	var cnt int
+
+	for blobID := range d {
+		if strings.HasPrefix(string(blobID), string(prefix)) {
+			cnt++
+		}
+	}
+
+	return cnt
+}
@@ -9,6 +9,10 @@ import (
 // ID is an identifier of content in content-addressable storage.
 type ID string
 
+// ManifestContentPrefix is the prefix of contents storing manifests, which use separate keys when
+// the format specifies key purposes.
+const ManifestContentPrefix ID = "m"
+
 // Prefix returns a one-character prefix of a content ID or an empty string.
 func (i ID) Prefix() ID {
 	if i.HasPrefix() {
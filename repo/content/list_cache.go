@@ -12,23 +12,32 @@ import (
 
 	"github.com/pkg/errors"
 
+	"github.com/kopia/kopia/internal/clock"
 	"github.com/kopia/kopia/internal/hmac"
 	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/blob/offline"
 )
 
 type listCache struct {
-	st                blob.Storage
+	list              func(ctx context.Context) ([]IndexBlobInfo, error)
 	cacheFile         string
 	listCacheDuration time.Duration
 	hmacSecret        []byte
+	timeNow           func() time.Time
 }
 
 func (c *listCache) listIndexBlobs(ctx context.Context) ([]IndexBlobInfo, error) {
+	var cached *cachedList
+
 	if c.cacheFile != "" {
 		ci, err := c.readContentsFromCache(ctx)
 		if err == nil {
+			cached = ci
+			now := c.timeNow()
 			expirationTime := ci.Timestamp.Add(c.listCacheDuration)
-			if time.Now().Before(expirationTime) { // allow:no-inject-time
+
+			// a cached list from the future means the local clock went back, don't trust it.
+			if now.Before(expirationTime) && !clock.InFuture(now, ci.Timestamp) {
 				log(ctx).Debugf("retrieved list of index blobs from cache")
 				return ci.Contents, nil
 			}
@@ -37,11 +46,17 @@ func (c *listCache) listIndexBlobs(ctx context.Context) ([]IndexBlobInfo, error)
 		}
 	}
 
-	contents, err := listIndexBlobsFromStorage(ctx, c.st)
+	contents, err := c.list(ctx)
+	if errors.Is(err, offline.ErrOffline) && cached != nil {
+		// the storage can't be listed, the last known list is the best we have regardless of its age.
+		log(ctx).Debugf("using list of index blobs cached at %v in offline mode", cached.Timestamp)
+		return cached.Contents, nil
+	}
+
 	if err == nil {
 		c.saveListToCache(ctx, &cachedList{
 			Contents:  contents,
-			Timestamp: time.Now(), // allow:no-inject-time
+			Timestamp: c.timeNow(),
 		})
 	}
 
@@ -129,7 +144,7 @@ func listIndexBlobsFromStorage(ctx context.Context, st blob.Storage) ([]IndexBlo
 	return results, err
 }
 
-func newListCache(st blob.Storage, caching CachingOptions) (*listCache, error) {
+func newListCache(list func(ctx context.Context) ([]IndexBlobInfo, error), caching CachingOptions, timeNow func() time.Time) (*listCache, error) {
 	var listCacheFile string
 
 	if caching.CacheDirectory != "" {
@@ -143,10 +158,11 @@ func newListCache(st blob.Storage, caching CachingOptions) (*listCache, error) {
 	}
 
 	c := &listCache{
-		st:                st,
+		list:              list,
 		cacheFile:         listCacheFile,
 		hmacSecret:        caching.HMACSecret,
 		listCacheDuration: time.Duration(caching.MaxListCacheDurationSec) * time.Second,
+		timeNow:           timeNow,
 	}
 
 	if caching.IgnoreListCache {
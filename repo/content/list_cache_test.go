@@ -0,0 +1,70 @@
+package content
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/kopia/kopia/internal/clock"
+	"github.com/kopia/kopia/internal/faketime"
+	"github.com/kopia/kopia/internal/testlogging"
+)
+
+func TestListCacheClockSkew(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	dir, err := ioutil.TempDir("", "listcache")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+
+	defer os.RemoveAll(dir) //nolint:errcheck
+
+	listCount := 0
+	list := func(ctx context.Context) ([]IndexBlobInfo, error) {
+		listCount++
+		return []IndexBlobInfo{{BlobID: "n1"}}, nil
+	}
+
+	ta := faketime.NewTimeAdvance(fakeTime)
+
+	c, err := newListCache(list, CachingOptions{
+		CacheDirectory:          dir,
+		MaxListCacheDurationSec: 600,
+		HMACSecret:              hmacSecret,
+	}, ta.NowFunc())
+	if err != nil {
+		t.Fatalf("unable to create list cache: %v", err)
+	}
+
+	verifyListCount := func(want int) {
+		t.Helper()
+
+		if _, err := c.listIndexBlobs(ctx); err != nil {
+			t.Fatalf("list error: %v", err)
+		}
+
+		if listCount != want {
+			t.Fatalf("unexpected number of listings: %v, want %v", listCount, want)
+		}
+	}
+
+	verifyListCount(1)
+
+	// served from cache.
+	ta.Advance(time.Minute)
+	verifyListCount(1)
+
+	// expired.
+	ta.Advance(10 * time.Minute)
+	verifyListCount(2)
+
+	// local clock went back, cached list is from the future and is not trusted.
+	c.timeNow = faketime.Frozen(fakeTime.Add(-clock.MaxSkew - time.Hour))
+	verifyListCount(3)
+
+	// the list was cached again with the current time.
+	verifyListCount(3)
+}
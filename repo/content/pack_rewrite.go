@@ -0,0 +1,272 @@
+package content
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// PackRewriteOptions provides options for RewriteWastefulPacks.
+type PackRewriteOptions struct {
+	// MinWastePercent is the minimum percentage of deleted data in a pack for its remaining contents to be rewritten.
+	MinWastePercent int
+
+	// MinWasteBytes is the minimum amount of deleted data in a pack for its remaining contents to be rewritten.
+	MinWasteBytes int64
+
+	// DeletedContentMinAge is the minimum age of deleted contents dropped from indexes after rewriting,
+	// which makes packs that only contain them unreferenced. With epoch indexes, deleted contents are only
+	// dropped once their epochs are settled and merged, so such packs are deleted by later runs.
+	DeletedContentMinAge time.Duration
+
+	// BlobGC are the options of deleting unreferenced packs, which happens after the grace period, so usually in a later run.
+	BlobGC BlobGCOptions
+
+	Parallel int
+	DryRun   bool
+}
+
+// PackRewriteStats contains statistics of RewriteWastefulPacks.
+type PackRewriteStats struct {
+	PackCount  int
+	PackBytes  int64
+	WasteBytes int64
+
+	RewrittenCount int
+	RewrittenBytes int64
+
+	BlobGC BlobGCStats
+}
+
+// IterateContentInWastefulPacks invokes the provided callback for all non-deleted contents in packs containing at
+// least minWastePercent and minWasteBytes of deleted data and returns the number of such packs and their sizes.
+func (bm *Manager) IterateContentInWastefulPacks(ctx context.Context, minWastePercent int, minWasteBytes int64, callback IterateCallback) (PackRewriteStats, error) {
+	var st PackRewriteStats
+
+	err := bm.IteratePacks(
+		ctx,
+		IteratePackOptions{
+			IncludePacksWithOnlyDeletedContent: true,
+			IncludeContentInfos:                true,
+		},
+		func(pi PackInfo) error {
+			var waste int64
+
+			for _, ci := range pi.ContentInfos {
+				if ci.Deleted {
+					waste += int64(ci.Length)
+				}
+			}
+
+			if waste == 0 || waste < minWasteBytes || waste*100 < pi.TotalSize*int64(minWastePercent) { //nolint:gomnd
+				return nil
+			}
+
+			st.PackCount++
+			st.PackBytes += pi.TotalSize
+			st.WasteBytes += waste
+
+			for _, ci := range pi.ContentInfos {
+				if ci.Deleted {
+					continue
+				}
+
+				if err := callback(ci); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		},
+	)
+
+	return st, err
+}
+
+// RewriteWastefulPacks reclaims space of deleted contents in packs that also contain contents in use, which
+// can't be deleted by blob garbage collection. Remaining contents of packs with enough deleted data are rewritten
+// to new packs, deleted contents older than the minimum age are dropped from indexes and unreferenced packs
+// are deleted by blob garbage collection.
+func (bm *Manager) RewriteWastefulPacks(ctx context.Context, opt PackRewriteOptions) (PackRewriteStats, error) {
+	var toRewrite []Info
+
+	st, err := bm.IterateContentInWastefulPacks(ctx, opt.MinWastePercent, opt.MinWasteBytes, func(ci Info) error {
+		toRewrite = append(toRewrite, ci)
+		return nil
+	})
+	if err != nil {
+		return st, errors.Wrap(err, "error looking for wasteful packs")
+	}
+
+	log(ctx).Debugf("found %v packs with %v bytes of deleted contents and %v contents to rewrite", st.PackCount, st.WasteBytes, len(toRewrite))
+
+	for _, ci := range toRewrite {
+		st.RewrittenCount++
+		st.RewrittenBytes += int64(ci.Length)
+	}
+
+	if opt.DryRun {
+		return st, nil
+	}
+
+	if err := bm.rewriteContents(ctx, toRewrite, opt.Parallel); err != nil {
+		return st, err
+	}
+
+	if err := bm.Flush(ctx); err != nil {
+		return st, errors.Wrap(err, "error flushing rewritten contents")
+	}
+
+	if err := bm.CompactIndexes(ctx, CompactOptions{
+		MaxSmallBlobs:        1,
+		AllIndexes:           true,
+		SkipDeletedOlderThan: opt.DeletedContentMinAge,
+	}); err != nil {
+		return st, errors.Wrap(err, "error compacting indexes")
+	}
+
+	st.BlobGC, err = bm.DeleteUnreferencedBlobs(ctx, opt.BlobGC)
+
+	return st, err
+}
+
+func (bm *Manager) rewriteContents(ctx context.Context, contents []Info, parallel int) error {
+	if parallel <= 0 {
+		parallel = 1
+	}
+
+	ch := make(chan Info)
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+
+	for i := 0; i < parallel; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for ci := range ch {
+				if err := bm.RewriteContent(ctx, ci.ID); err != nil {
+					mu.Lock()
+					if firstErr == nil {
+						firstErr = errors.Wrapf(err, "unable to rewrite content %v from pack %v", ci.ID, ci.PackBlobID)
+					}
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+
+	for _, ci := range contents {
+		ch <- ci
+	}
+
+	close(ch)
+	wg.Wait()
+
+	return firstErr
+}
+
+// PackConsolidationOptions provides options for ConsolidateSmallPacks.
+type PackConsolidationOptions struct {
+	// SmallPackPercent is the size of packs, as percentage of the maximum pack size, below which packs are consolidated.
+	SmallPackPercent int
+
+	// MinPackCount is the minimum number of small packs to consolidate, so that each run merges enough of them.
+	MinPackCount int
+
+	// BlobGC are the options of deleting consolidated packs, which happens after the grace period, so usually in a later run.
+	BlobGC BlobGCOptions
+
+	Parallel int
+	DryRun   bool
+}
+
+// PackConsolidationStats contains statistics of ConsolidateSmallPacks.
+type PackConsolidationStats struct {
+	PackCount int
+	PackBytes int64
+
+	RewrittenCount int
+	RewrittenBytes int64
+
+	BlobGC BlobGCStats
+}
+
+// ConsolidateSmallPacks rewrites all contents of small packs, such as those written by small incremental snapshots,
+// to full-size packs and deletes the small packs, reducing the number of blobs and storage requests needed to list
+// and read them. Deleted contents are rewritten as well, so that the small packs become unreferenced immediately.
+// Small packs are only consolidated when their contents exceed the small pack size, so that the consolidated pack
+// is not small itself and is not rewritten again by each subsequent run.
+func (bm *Manager) ConsolidateSmallPacks(ctx context.Context, opt PackConsolidationOptions) (PackConsolidationStats, error) {
+	var (
+		st           PackConsolidationStats
+		toRewrite    []Info
+		contentBytes int64
+	)
+
+	threshold := int64(bm.maxPackSize) * int64(opt.SmallPackPercent) / 100 //nolint:gomnd
+
+	if err := bm.IteratePacks(
+		ctx,
+		IteratePackOptions{
+			IncludePacksWithOnlyDeletedContent: true,
+			IncludeContentInfos:                true,
+		},
+		func(pi PackInfo) error {
+			if pi.TotalSize >= threshold {
+				return nil
+			}
+
+			st.PackCount++
+			st.PackBytes += pi.TotalSize
+			toRewrite = append(toRewrite, pi.ContentInfos...)
+
+			for _, ci := range pi.ContentInfos {
+				contentBytes += int64(ci.Length)
+			}
+
+			return nil
+		},
+	); err != nil {
+		return st, errors.Wrap(err, "error looking for small packs")
+	}
+
+	log(ctx).Debugf("found %v packs smaller than %v bytes with %v contents", st.PackCount, threshold, len(toRewrite))
+
+	if st.PackCount < opt.MinPackCount || st.PackCount < 2 || contentBytes < threshold { //nolint:gomnd
+		toRewrite = nil
+	}
+
+	for _, ci := range toRewrite {
+		st.RewrittenCount++
+		st.RewrittenBytes += int64(ci.Length)
+	}
+
+	if opt.DryRun {
+		return st, nil
+	}
+
+	if len(toRewrite) > 0 {
+		if err := bm.rewriteContents(ctx, toRewrite, opt.Parallel); err != nil {
+			return st, err
+		}
+
+		if err := bm.Flush(ctx); err != nil {
+			return st, errors.Wrap(err, "error flushing rewritten contents")
+		}
+	}
+
+	// packs consolidated by previous runs are deleted after the grace period.
+	var err error
+
+	st.BlobGC, err = bm.DeleteUnreferencedBlobs(ctx, opt.BlobGC)
+
+	return st, err
+}
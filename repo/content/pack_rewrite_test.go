@@ -0,0 +1,151 @@
+package content
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kopia/kopia/internal/blobtesting"
+	"github.com/kopia/kopia/internal/faketime"
+	"github.com/kopia/kopia/internal/testlogging"
+	"github.com/kopia/kopia/repo/blob"
+)
+
+func TestRewriteWastefulPacks(t *testing.T) {
+	ctx := testlogging.Context(t)
+	data := blobtesting.DataMap{}
+	keyTime := map[blob.ID]time.Time{}
+	ta := faketime.NewTimeAdvance(fakeTime)
+
+	bm := newTestContentManager(t, data, keyTime, ta.NowFunc())
+	defer bm.Close(ctx)
+
+	var ids []ID
+
+	for i := 0; i < 4; i++ {
+		ids = append(ids, writeContentAndVerify(ctx, t, bm, seededRandomData(i, 100)))
+	}
+
+	assertNoError(t, bm.Flush(ctx))
+	ta.Advance(time.Minute)
+
+	for _, id := range ids[1:] {
+		assertNoError(t, bm.DeleteContent(ctx, id))
+	}
+
+	assertNoError(t, bm.Flush(ctx))
+
+	ta.Advance(2 * time.Hour)
+
+	opt := PackRewriteOptions{
+		MinWastePercent:      50,
+		DeletedContentMinAge: time.Hour,
+		BlobGC:               BlobGCOptions{MinAge: time.Hour, GracePeriod: time.Hour, Parallel: 1},
+		Parallel:             2,
+	}
+
+	// below the threshold.
+	st, err := bm.RewriteWastefulPacks(ctx, PackRewriteOptions{MinWastePercent: 80, DryRun: true})
+	assertNoError(t, err)
+
+	if st.PackCount != 0 {
+		t.Fatalf("unexpected stats: %+v", st)
+	}
+
+	st, err = bm.RewriteWastefulPacks(ctx, opt)
+	assertNoError(t, err)
+
+	if st.PackCount != 1 || st.WasteBytes != 3*st.RewrittenBytes || st.RewrittenCount != 1 || st.BlobGC.TombstonedCount != 1 {
+		t.Fatalf("unexpected stats: %+v", st)
+	}
+
+	ta.Advance(2 * time.Hour)
+
+	// the old pack is deleted after the grace period.
+	st, err = bm.RewriteWastefulPacks(ctx, opt)
+	assertNoError(t, err)
+
+	if st.PackCount != 0 || st.BlobGC.DeletedCount != 1 {
+		t.Fatalf("unexpected stats: %+v", st)
+	}
+
+	verifyContent(ctx, t, bm, ids[0], seededRandomData(0, 100))
+
+	// contents dropped from indexes must not become visible again.
+	for _, id := range ids[1:] {
+		verifyContentNotFound(ctx, t, bm, id)
+	}
+
+	verifyUnreferencedBlobsCount(ctx, t, bm, 0)
+}
+
+func TestConsolidateSmallPacks(t *testing.T) {
+	ctx := testlogging.Context(t)
+	data := blobtesting.DataMap{}
+	keyTime := map[blob.ID]time.Time{}
+	ta := faketime.NewTimeAdvance(fakeTime)
+
+	bm := newTestContentManager(t, data, keyTime, ta.NowFunc())
+	defer bm.Close(ctx)
+
+	var ids []ID
+
+	for i := 0; i < 3; i++ {
+		ids = append(ids, writeContentAndVerify(ctx, t, bm, seededRandomData(i, 400)))
+		assertNoError(t, bm.Flush(ctx))
+		ta.Advance(time.Minute)
+	}
+
+	assertNoError(t, bm.DeleteContent(ctx, ids[2]))
+	assertNoError(t, bm.Flush(ctx))
+
+	ta.Advance(2 * time.Hour)
+
+	opt := PackConsolidationOptions{
+		SmallPackPercent: 50,
+		MinPackCount:     4,
+		BlobGC:           BlobGCOptions{MinAge: time.Hour, GracePeriod: time.Hour, Parallel: 1},
+		Parallel:         2,
+	}
+
+	// not enough small packs.
+	st, err := bm.ConsolidateSmallPacks(ctx, opt)
+	assertNoError(t, err)
+
+	if st.PackCount != 3 || st.RewrittenCount != 0 {
+		t.Fatalf("unexpected stats: %+v", st)
+	}
+
+	opt.MinPackCount = 3
+	opt.SmallPackPercent = 70
+
+	// contents of small packs would not fill a pack that is not small.
+	st, err = bm.ConsolidateSmallPacks(ctx, opt)
+	assertNoError(t, err)
+
+	if st.PackCount != 3 || st.RewrittenCount != 0 {
+		t.Fatalf("unexpected stats: %+v", st)
+	}
+
+	opt.SmallPackPercent = 50
+
+	st, err = bm.ConsolidateSmallPacks(ctx, opt)
+	assertNoError(t, err)
+
+	if st.PackCount != 3 || st.RewrittenCount != 3 || st.BlobGC.TombstonedCount != 3 {
+		t.Fatalf("unexpected stats: %+v", st)
+	}
+
+	ta.Advance(2 * time.Hour)
+
+	// the consolidated pack is not small and small packs are deleted after the grace period.
+	st, err = bm.ConsolidateSmallPacks(ctx, opt)
+	assertNoError(t, err)
+
+	if st.PackCount != 0 || st.RewrittenCount != 0 || st.BlobGC.DeletedCount != 3 {
+		t.Fatalf("unexpected stats: %+v", st)
+	}
+
+	verifyContent(ctx, t, bm, ids[0], seededRandomData(0, 400))
+	verifyContent(ctx, t, bm, ids[1], seededRandomData(1, 400))
+	verifyContentNotFound(ctx, t, bm, ids[2])
+}
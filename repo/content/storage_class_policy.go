@@ -0,0 +1,84 @@
+package content
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo/blob"
+)
+
+// StorageClassPolicy specifies provider-specific storage classes of blobs written to the repository,
+// empty class uses the default class of the storage.
+type StorageClassPolicy struct {
+	Index    string `json:"index,omitempty"`    // index blobs
+	Metadata string `json:"metadata,omitempty"` // pack blobs holding metadata contents, such as directory listings
+	Data     string `json:"data,omitempty"`     // pack blobs holding file contents
+
+	// OldData is the storage class data pack blobs are transitioned to once they are older than OldDataAgeDays.
+	OldData        string `json:"oldData,omitempty"`
+	OldDataAgeDays int    `json:"oldDataAgeDays,omitempty"`
+}
+
+// storageClassForBlob returns the storage class of newly written blob with a given ID.
+func (p *StorageClassPolicy) storageClassForBlob(blobID blob.ID) string {
+	if p == nil {
+		return ""
+	}
+
+	switch {
+	case strings.HasPrefix(string(blobID), string(PackBlobIDPrefixRegular)):
+		return p.Data
+	case strings.HasPrefix(string(blobID), string(PackBlobIDPrefixSpecial)):
+		return p.Metadata
+	default:
+		return p.Index
+	}
+}
+
+// putBlob writes the blob using the storage class determined by the repository policy.
+func (bm *lockFreeManager) putBlob(ctx context.Context, blobID blob.ID, data []byte) error {
+	return blob.PutBlobWithOptions(ctx, bm.st, blobID, data, blob.PutOptions{
+		StorageClass: bm.Format.StorageClasses.storageClassForBlob(blobID),
+	})
+}
+
+// TransitionOldPacks moves data pack blobs older than the age specified in the repository policy
+// to the old data storage class and returns the metadata of transitioned blobs.
+// Blobs that are already in the target class are left unchanged, but are included in the results.
+func (bm *Manager) TransitionOldPacks(ctx context.Context, dryRun bool) ([]blob.Metadata, error) {
+	p := bm.Format.StorageClasses
+	if p == nil || p.OldData == "" || p.OldDataAgeDays <= 0 {
+		return nil, errors.New("repository policy does not specify storage class of old data")
+	}
+
+	cutoff := bm.timeNow().Add(-time.Duration(p.OldDataAgeDays) * 24 * time.Hour) //nolint:gomnd
+
+	var result []blob.Metadata
+
+	if err := bm.st.ListBlobs(ctx, PackBlobIDPrefixRegular, func(m blob.Metadata) error {
+		if m.Timestamp.After(cutoff) {
+			return nil
+		}
+
+		result = append(result, m)
+
+		return nil
+	}); err != nil {
+		return nil, errors.Wrap(err, "error listing pack blobs")
+	}
+
+	if dryRun {
+		return result, nil
+	}
+
+	for _, b := range result {
+		if err := blob.SetStorageClass(ctx, bm.st, b.BlobID, p.OldData); err != nil {
+			return nil, errors.Wrapf(err, "unable to transition %v", b.BlobID)
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,121 @@
+package content
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kopia/kopia/internal/blobtesting"
+	"github.com/kopia/kopia/internal/faketime"
+	"github.com/kopia/kopia/internal/testlogging"
+	"github.com/kopia/kopia/repo/blob"
+)
+
+// storageClassRecorder records storage classes of blobs written to the underlying storage.
+type storageClassRecorder struct {
+	blob.Storage
+
+	mu      sync.Mutex
+	classes map[blob.ID]string
+}
+
+func (s *storageClassRecorder) PutBlobWithOptions(ctx context.Context, id blob.ID, data []byte, opt blob.PutOptions) error {
+	s.mu.Lock()
+	s.classes[id] = opt.StorageClass
+	s.mu.Unlock()
+
+	return s.Storage.PutBlob(ctx, id, data)
+}
+
+func (s *storageClassRecorder) SetStorageClass(ctx context.Context, id blob.ID, storageClass string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.classes[id] = storageClass
+
+	return nil
+}
+
+func TestStorageClassPolicy(t *testing.T) {
+	ctx := testlogging.Context(t)
+	ta := faketime.NewTimeAdvance(fakeTime)
+	st := &storageClassRecorder{
+		Storage: blobtesting.NewMapStorage(blobtesting.DataMap{}, nil, ta.NowFunc()),
+		classes: map[blob.ID]string{},
+	}
+
+	bm, err := newManagerWithOptions(ctx, st, &FormattingOptions{
+		Hash:        "HMAC-SHA256",
+		Encryption:  "AES256-GCM-HMAC-SHA256",
+		HMACSecret:  hmacSecret,
+		MaxPackSize: maxPackSize,
+		Version:     1,
+		StorageClasses: &StorageClassPolicy{
+			Index:          "index-class",
+			Metadata:       "metadata-class",
+			Data:           "data-class",
+			OldData:        "old-data-class",
+			OldDataAgeDays: 30,
+		},
+	}, CachingOptions{}, ta.NowFunc(), nil)
+	if err != nil {
+		t.Fatalf("can't create content manager: %v", err)
+	}
+
+	defer bm.Close(ctx)
+
+	writeContentAndVerify(ctx, t, bm, seededRandomData(1, 100))
+
+	if _, err := bm.WriteContent(ctx, []byte("metadata"), "k"); err != nil {
+		t.Fatalf("unable to write metadata content: %v", err)
+	}
+
+	if err := bm.Flush(ctx); err != nil {
+		t.Fatalf("flush error: %v", err)
+	}
+
+	expected := map[string]string{
+		string(PackBlobIDPrefixRegular): "data-class",
+		string(PackBlobIDPrefixSpecial): "metadata-class",
+		newIndexBlobPrefix:              "index-class",
+	}
+
+	for prefix, class := range expected {
+		found := false
+
+		for id, c := range st.classes {
+			if strings.HasPrefix(string(id), prefix) {
+				found = true
+
+				if c != class {
+					t.Errorf("invalid storage class of %v: %q, want %q", id, c, class)
+				}
+			}
+		}
+
+		if !found {
+			t.Errorf("no blobs with prefix %q were written", prefix)
+		}
+	}
+
+	if got, err := bm.TransitionOldPacks(ctx, false); err != nil || len(got) != 0 {
+		t.Fatalf("unexpected transition of new blobs: %v, %v", got, err)
+	}
+
+	ta.Advance(31 * 24 * time.Hour)
+
+	got, err := bm.TransitionOldPacks(ctx, false)
+	if err != nil {
+		t.Fatalf("transition error: %v", err)
+	}
+
+	if len(got) != 1 {
+		t.Fatalf("unexpected transitioned blobs: %v", got)
+	}
+
+	if c := st.classes[got[0].BlobID]; c != "old-data-class" {
+		t.Errorf("invalid storage class after transition: %q", c)
+	}
+}
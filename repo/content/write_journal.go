@@ -0,0 +1,323 @@
+package content
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/clock"
+	"github.com/kopia/kopia/internal/hmac"
+	"github.com/kopia/kopia/repo/blob"
+)
+
+// writeJournal keeps track of index blobs recently written and deleted by this client in order to
+// support storage backends whose listings are only eventually consistent.
+//
+// Index blobs written in the last listConsistencyDelay are merged into the results of listing,
+// since the storage may not report them yet, and index blobs superseded by compaction are only
+// deleted once the compacted blob has been around for listConsistencyDelay, so that other clients
+// always see either the old blobs or their replacement.
+//
+// Repositories using epoch index format already delay deletion of superseded index blobs, so
+// the journal only adds blobs written recently by this client (including compactions and epoch
+// markers) to listings. Index blobs must be listed before their epoch is compacted, which limits
+// the supported delay to maxEpochListConsistencyDelay.
+//
+// When the cache directory is configured, the journal is persisted there so that it's shared by
+// subsequent invocations using the same connection. Concurrent updates are best-effort, losing an
+// update only causes superseded index blobs to be compacted again later.
+type writeJournal struct {
+	mu         sync.Mutex
+	file       string
+	hmacSecret []byte
+	delay      time.Duration
+	timeNow    func() time.Time
+
+	state writeJournalState // used when there's no journal file
+}
+
+// maxEpochListConsistencyDelay is the maximum list consistency delay supported by epoch index management.
+// Writes to an epoch may continue until writers refresh the current epoch, and the epoch is compacted
+// once the next epoch is old enough, allowing for index blobs written just before the compaction.
+const maxEpochListConsistencyDelay = epochAdvanceMinAge - epochRefreshInterval - epochCompactionListingMargin
+
+type writeJournalState struct {
+	Written        []IndexBlobInfo        `json:"written"`
+	PendingDeletes []pendingIndexDeletion `json:"pendingDeletes"`
+}
+
+// pendingIndexDeletion represents index blobs that have been superseded by a compacted index blob
+// written at the provided time.
+type pendingIndexDeletion struct {
+	Timestamp time.Time `json:"timestamp"`
+	BlobIDs   []blob.ID `json:"blobIDs"`
+}
+
+// recordWritten adds the provided index blob to the journal.
+func (j *writeJournal) recordWritten(ctx context.Context, bi IndexBlobInfo) {
+	j.update(ctx, func(st *writeJournalState) {
+		st.Written = append(st.Written, bi)
+	})
+}
+
+// isJournaledIndexBlobPrefix determines whether blobs written with the provided prefix are recorded in the journal.
+func isJournaledIndexBlobPrefix(prefix blob.ID) bool {
+	return prefix == newIndexBlobPrefix || strings.HasPrefix(string(prefix), string(epochBlobPrefix))
+}
+
+// recentNotListed returns recently written blobs with the provided prefix that are not in the listed set.
+func (j *writeJournal) recentNotListed(ctx context.Context, prefix blob.ID, listed map[blob.ID]bool) []IndexBlobInfo {
+	var recent, result []IndexBlobInfo
+
+	j.update(ctx, func(st *writeJournalState) {
+		recent = append(recent, st.Written...)
+	})
+
+	for _, bi := range recent {
+		if strings.HasPrefix(string(bi.BlobID), string(prefix)) && !listed[bi.BlobID] {
+			log(ctx).Debugf("index blob %v not listed yet, adding from write journal", bi.BlobID)
+			result = append(result, bi)
+		}
+	}
+
+	return result
+}
+
+// mergeRecent returns the provided list of index blobs with recently written blobs missing from it added.
+func (j *writeJournal) mergeRecent(ctx context.Context, listed []IndexBlobInfo) []IndexBlobInfo {
+	found := map[blob.ID]bool{}
+	for _, bi := range listed {
+		found[bi.BlobID] = true
+	}
+
+	return append(listed, j.recentNotListed(ctx, newIndexBlobPrefix, found)...)
+}
+
+// mergeRecentMetadata returns the provided list of blobs with recently written blobs with the provided prefix
+// missing from it added.
+func (j *writeJournal) mergeRecentMetadata(ctx context.Context, prefix blob.ID, listed []blob.Metadata) []blob.Metadata {
+	found := map[blob.ID]bool{}
+	for _, bm := range listed {
+		found[bm.BlobID] = true
+	}
+
+	for _, bi := range j.recentNotListed(ctx, prefix, found) {
+		listed = append(listed, blob.Metadata{BlobID: bi.BlobID, Length: bi.Length, Timestamp: bi.Timestamp})
+	}
+
+	return listed
+}
+
+// scheduleDeletion records index blobs superseded by a compacted blob written just now.
+func (j *writeJournal) scheduleDeletion(ctx context.Context, blobIDs []blob.ID) {
+	if len(blobIDs) == 0 {
+		return
+	}
+
+	j.update(ctx, func(st *writeJournalState) {
+		st.PendingDeletes = append(st.PendingDeletes, pendingIndexDeletion{
+			Timestamp: j.timeNow(),
+			BlobIDs:   blobIDs,
+		})
+	})
+}
+
+// pendingDeletions returns the set of index blobs scheduled for deletion.
+func (j *writeJournal) pendingDeletions(ctx context.Context) map[blob.ID]bool {
+	result := map[blob.ID]bool{}
+
+	j.update(ctx, func(st *writeJournalState) {
+		for _, pd := range st.PendingDeletes {
+			for _, id := range pd.BlobIDs {
+				result[id] = true
+			}
+		}
+	})
+
+	return result
+}
+
+// takeDueDeletions removes from the journal and returns index blobs whose replacement has been
+// around long enough for them to be safely deleted.
+func (j *writeJournal) takeDueDeletions(ctx context.Context) []blob.ID {
+	var result []blob.ID
+
+	j.update(ctx, func(st *writeJournalState) {
+		var remaining []pendingIndexDeletion
+
+		for _, pd := range st.PendingDeletes {
+			if j.timeNow().Sub(pd.Timestamp) < j.delay {
+				remaining = append(remaining, pd)
+				continue
+			}
+
+			result = append(result, pd.BlobIDs...)
+		}
+
+		st.PendingDeletes = remaining
+	})
+
+	return result
+}
+
+func (j *writeJournal) update(ctx context.Context, fn func(st *writeJournalState)) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	st := j.load(ctx)
+
+	// blobs written more than listConsistencyDelay ago are guaranteed to be listed.
+	var written []IndexBlobInfo
+
+	for _, bi := range st.Written {
+		if j.timeNow().Sub(bi.Timestamp) < j.delay {
+			written = append(written, bi)
+		}
+	}
+
+	st.Written = written
+
+	fn(&st)
+
+	j.save(ctx, st)
+}
+
+func (j *writeJournal) load(ctx context.Context) writeJournalState {
+	if j.file == "" {
+		return j.state
+	}
+
+	var st writeJournalState
+
+	data, err := ioutil.ReadFile(j.file)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log(ctx).Warningf("unable to read write journal: %v", err)
+		}
+
+		return st
+	}
+
+	data, err = hmac.VerifyAndStrip(data, j.hmacSecret)
+	if err != nil {
+		log(ctx).Warningf("invalid write journal %v: %v", j.file, err)
+		return st
+	}
+
+	if err := json.Unmarshal(data, &st); err != nil {
+		log(ctx).Warningf("can't unmarshal write journal: %v", err)
+	}
+
+	return st
+}
+
+func (j *writeJournal) save(ctx context.Context, st writeJournalState) {
+	if j.file == "" {
+		j.state = st
+		return
+	}
+
+	data, err := json.Marshal(st)
+	if err != nil {
+		log(ctx).Warningf("unable to marshal write journal: %v", err)
+		return
+	}
+
+	mySuffix := fmt.Sprintf(".tmp-%v-%v", os.Getpid(), time.Now().UnixNano()) // allow:no-inject-time
+	if err := ioutil.WriteFile(j.file+mySuffix, hmac.Append(data, j.hmacSecret), 0600); err != nil {
+		log(ctx).Warningf("unable to write write journal: %v", err)
+	}
+
+	os.Rename(j.file+mySuffix, j.file) //nolint:errcheck
+	os.Remove(j.file + mySuffix)       //nolint:errcheck
+}
+
+// newWriteJournal returns a write journal for the provided caching options or nil if
+// the list consistency delay is not configured.
+func newWriteJournal(caching CachingOptions, timeNow func() time.Time) *writeJournal {
+	if caching.ListConsistencyDelaySec <= 0 {
+		return nil
+	}
+
+	j := &writeJournal{
+		hmacSecret: caching.HMACSecret,
+		delay:      time.Duration(caching.ListConsistencyDelaySec) * time.Second,
+		timeNow:    timeNow,
+	}
+
+	if caching.CacheDirectory != "" {
+		j.file = filepath.Join(caching.CacheDirectory, "write-journal")
+	}
+
+	return j
+}
+
+const (
+	// listProbeBlobPrefix is the prefix of blobs written to measure the list consistency delay of the storage.
+	listProbeBlobPrefix blob.ID = "kopia.list-probe."
+
+	listProbeInterval = time.Second
+)
+
+// DetectListConsistencyDelay measures the time it takes for a newly written blob to appear in listings of
+// the provided storage, waiting for at most maxWait. Since the delay varies between writes, twice the
+// observed delay is returned, or zero if the blob was listed right away.
+func DetectListConsistencyDelay(ctx context.Context, st blob.Storage, maxWait time.Duration) (time.Duration, error) {
+	var rnd [8]byte
+
+	if _, err := rand.Read(rnd[:]); err != nil {
+		return 0, errors.Wrap(err, "unable to generate probe blob ID")
+	}
+
+	probeID := listProbeBlobPrefix + blob.ID(hex.EncodeToString(rnd[:]))
+
+	if err := st.PutBlob(ctx, probeID, []byte("list-probe")); err != nil {
+		return 0, errors.Wrap(err, "unable to write probe blob")
+	}
+
+	defer func() {
+		if err := st.DeleteBlob(ctx, probeID); err != nil {
+			log(ctx).Warningf("unable to delete probe blob %v: %v", probeID, err)
+		}
+	}()
+
+	t0 := clock.Now()
+
+	for attempt := 0; ; attempt++ {
+		listed, err := blob.ListAllBlobs(ctx, st, probeID)
+		if err != nil {
+			return 0, errors.Wrap(err, "unable to list probe blob")
+		}
+
+		elapsed := clock.Now().Sub(t0)
+
+		if len(listed) > 0 {
+			if attempt == 0 {
+				return 0, nil
+			}
+
+			return 2 * elapsed, nil //nolint:gomnd
+		}
+
+		if elapsed >= maxWait {
+			return 0, errors.Errorf("probe blob was not listed within %v", maxWait)
+		}
+
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+
+		case <-time.After(listProbeInterval):
+		}
+	}
+}
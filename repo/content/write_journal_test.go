@@ -0,0 +1,218 @@
+package content
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kopia/kopia/internal/blobtesting"
+	"github.com/kopia/kopia/internal/faketime"
+	"github.com/kopia/kopia/internal/testlogging"
+	"github.com/kopia/kopia/repo/blob"
+)
+
+func TestWriteJournal(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "kopia")
+	if err != nil {
+		t.Fatalf("error getting temp dir: %v", err)
+	}
+
+	defer os.RemoveAll(tmpDir)
+
+	for _, cacheDir := range []string{"", tmpDir} {
+		ctx := testlogging.Context(t)
+		ta := faketime.NewTimeAdvance(fakeTime)
+
+		if newWriteJournal(CachingOptions{CacheDirectory: cacheDir}, ta.NowFunc()) != nil {
+			t.Fatalf("unexpected journal without list consistency delay")
+		}
+
+		opt := CachingOptions{
+			CacheDirectory:          cacheDir,
+			ListConsistencyDelaySec: 60,
+			HMACSecret:              hmacSecret,
+		}
+
+		j := newWriteJournal(opt, ta.NowFunc())
+
+		j.recordWritten(ctx, IndexBlobInfo{BlobID: "n1", Timestamp: ta.NowFunc()()})
+
+		if got := j.mergeRecent(ctx, []IndexBlobInfo{{BlobID: "n0"}}); len(got) != 2 {
+			t.Errorf("recently written blob not merged: %v", got)
+		}
+
+		if got := j.mergeRecent(ctx, []IndexBlobInfo{{BlobID: "n0"}, {BlobID: "n1"}}); len(got) != 2 {
+			t.Errorf("listed blob merged twice: %v", got)
+		}
+
+		j.scheduleDeletion(ctx, []blob.ID{"n0"})
+
+		if !j.pendingDeletions(ctx)["n0"] {
+			t.Errorf("n0 is not pending deletion")
+		}
+
+		if got := j.takeDueDeletions(ctx); len(got) != 0 {
+			t.Errorf("deletion is not due yet, got %v", got)
+		}
+
+		ta.Advance(2 * time.Minute)
+
+		// reopen to verify journal persistence when cache directory is set.
+		if cacheDir != "" {
+			j = newWriteJournal(opt, ta.NowFunc())
+		}
+
+		if got := j.mergeRecent(ctx, nil); len(got) != 0 {
+			t.Errorf("blob written long ago still merged: %v", got)
+		}
+
+		if got := j.takeDueDeletions(ctx); len(got) != 1 || got[0] != "n0" {
+			t.Errorf("unexpected due deletions: %v", got)
+		}
+
+		if got := j.pendingDeletions(ctx); len(got) != 0 {
+			t.Errorf("unexpected pending deletions: %v", got)
+		}
+	}
+}
+
+// delayedListingStorage hides blobs from the first listings after they have been written.
+type delayedListingStorage struct {
+	blob.Storage
+
+	hideFor int
+
+	mu     sync.Mutex
+	hidden map[blob.ID]int // number of remaining listings that don't include the blob
+}
+
+func (s *delayedListingStorage) PutBlob(ctx context.Context, id blob.ID, data []byte) error {
+	s.mu.Lock()
+	s.hidden[id] = s.hideFor
+	s.mu.Unlock()
+
+	return s.Storage.PutBlob(ctx, id, data)
+}
+
+func (s *delayedListingStorage) ListBlobs(ctx context.Context, prefix blob.ID, cb func(bm blob.Metadata) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.Storage.ListBlobs(ctx, prefix, func(bm blob.Metadata) error {
+		if s.hidden[bm.BlobID] > 0 {
+			return nil
+		}
+
+		return cb(bm)
+	})
+
+	for id, n := range s.hidden {
+		if n > 0 && strings.HasPrefix(string(id), string(prefix)) {
+			s.hidden[id] = n - 1
+		}
+	}
+
+	return err
+}
+
+func TestDetectListConsistencyDelay(t *testing.T) {
+	ctx := testlogging.Context(t)
+	data := blobtesting.DataMap{}
+
+	d, err := DetectListConsistencyDelay(ctx, blobtesting.NewMapStorage(data, nil, nil), time.Minute)
+	if err != nil || d != 0 {
+		t.Fatalf("unexpected delay of consistent storage: %v, %v", d, err)
+	}
+
+	if len(data) != 0 {
+		t.Errorf("probe blob was not deleted: %v", data)
+	}
+
+	st := &delayedListingStorage{Storage: blobtesting.NewMapStorage(data, nil, nil), hideFor: 1, hidden: map[blob.ID]int{}}
+
+	d, err = DetectListConsistencyDelay(ctx, st, time.Minute)
+	if err != nil || d < listProbeInterval {
+		t.Fatalf("unexpected delay of eventually-consistent storage: %v, %v", d, err)
+	}
+
+	st.hideFor = 100
+
+	if _, err := DetectListConsistencyDelay(ctx, st, listProbeInterval); err == nil {
+		t.Fatalf("expected error when the probe blob is never listed")
+	}
+}
+
+func TestWriteJournalEpochIndexes(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	tmpDir, err := ioutil.TempDir("", "kopia")
+	if err != nil {
+		t.Fatalf("error getting temp dir: %v", err)
+	}
+
+	defer os.RemoveAll(tmpDir)
+
+	ta := faketime.NewTimeAdvance(fakeTime)
+	st := &delayedListingStorage{
+		Storage: blobtesting.NewMapStorage(blobtesting.DataMap{}, nil, ta.NowFunc()),
+		hideFor: 1000,
+		hidden:  map[blob.ID]int{},
+	}
+
+	f := &FormattingOptions{
+		Hash:        "HMAC-SHA256",
+		Encryption:  "AES256-GCM-HMAC-SHA256",
+		HMACSecret:  hmacSecret,
+		MaxPackSize: maxPackSize,
+		Version:     epochIndexFormatVersion,
+	}
+
+	caching := CachingOptions{
+		CacheDirectory:          tmpDir,
+		ListConsistencyDelaySec: 60,
+		HMACSecret:              hmacSecret,
+		IgnoreListCache:         true,
+	}
+
+	tooLong := caching
+	tooLong.ListConsistencyDelaySec = int((maxEpochListConsistencyDelay + time.Second).Seconds())
+
+	if _, err := newManagerWithOptions(ctx, st, f, tooLong, ta.NowFunc(), nil); err == nil {
+		t.Fatalf("expected error for list consistency delay exceeding the maximum")
+	}
+
+	bm, err := newManagerWithOptions(ctx, st, f, caching, ta.NowFunc(), nil)
+	if err != nil {
+		t.Fatalf("can't create content manager: %v", err)
+	}
+
+	b := seededRandomData(1, 100)
+	cid := writeContentAndVerify(ctx, t, bm, b)
+	assertNoError(t, bm.Flush(ctx))
+	bm.Close(ctx)
+
+	// the index blob is not listed yet, but it's in the write journal shared through the cache directory.
+	bm, err = newManagerWithOptions(ctx, st, f, caching, ta.NowFunc(), nil)
+	if err != nil {
+		t.Fatalf("can't create content manager: %v", err)
+	}
+
+	verifyContent(ctx, t, bm, cid, b)
+	bm.Close(ctx)
+
+	withoutJournal := caching
+	withoutJournal.ListConsistencyDelaySec = 0
+
+	bm, err = newManagerWithOptions(ctx, st, f, withoutJournal, ta.NowFunc(), nil)
+	if err != nil {
+		t.Fatalf("can't create content manager: %v", err)
+	}
+
+	defer bm.Close(ctx)
+
+	verifyContentNotFound(ctx, t, bm, cid)
+}
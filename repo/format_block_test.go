@@ -1,9 +1,14 @@
 package repo
 
 import (
+	"context"
 	"crypto/sha256"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/kopia/kopia/internal/blobtesting"
 	"github.com/kopia/kopia/internal/testlogging"
@@ -81,3 +86,46 @@ func assertNoError(t *testing.T, err error) {
 		t.Errorf("err: %v", err)
 	}
 }
+
+func TestFormatBlobCacheDuration(t *testing.T) {
+	data := blobtesting.DataMap{}
+	st := blobtesting.NewMapStorage(data, nil, nil)
+	ctx := testlogging.Context(t)
+
+	cacheDir, err := ioutil.TempDir("", "format-cache")
+	assertNoError(t, err)
+
+	defer os.RemoveAll(cacheDir) //nolint:errcheck
+
+	assertNoError(t, st.PutBlob(ctx, FormatBlobID, []byte("v1")))
+
+	if _, err = readAndCacheFormatBlobBytes(ctx, st, cacheDir, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	data[FormatBlobID] = []byte("v2")
+
+	// by default the cached copy is used regardless of its age.
+	old := time.Now().Add(-24 * time.Hour)
+	assertNoError(t, os.Chtimes(filepath.Join(cacheDir, "kopia.repository"), old, old))
+
+	verifyFormatBlobBytes(ctx, t, st, cacheDir, 0, "v1")
+	verifyFormatBlobBytes(ctx, t, st, cacheDir, 48*time.Hour, "v1")
+
+	// stale copy is re-read when the maximum duration is configured.
+	verifyFormatBlobBytes(ctx, t, st, cacheDir, time.Hour, "v2")
+	verifyFormatBlobBytes(ctx, t, st, cacheDir, 0, "v2")
+}
+
+func verifyFormatBlobBytes(ctx context.Context, t *testing.T, st blob.Storage, cacheDir string, maxCacheDuration time.Duration, want string) {
+	t.Helper()
+
+	b, err := readAndCacheFormatBlobBytes(ctx, st, cacheDir, maxCacheDuration)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := string(b); got != want {
+		t.Errorf("unexpected format blob: %q, want %q", got, want)
+	}
+}
@@ -1,13 +1,31 @@
 package hashing
 
 import (
+	"hash"
+
+	"github.com/zeebo/blake3"
 	"golang.org/x/crypto/blake2b"
 	"golang.org/x/crypto/blake2s"
 )
 
+const (
+	blake3KeySize    = 32
+	blake3KeyContext = "kopia 2020-05-01 content hash key"
+)
+
 func init() {
 	Register("BLAKE2S-128", truncatedKeyedHashFuncFactory(blake2s.New128, 16))
 	Register("BLAKE2S-256", truncatedKeyedHashFuncFactory(blake2s.New256, 32))
 	Register("BLAKE2B-256-128", truncatedKeyedHashFuncFactory(blake2b.New256, 16))
 	Register("BLAKE2B-256", truncatedKeyedHashFuncFactory(blake2b.New256, 32))
+	Register("BLAKE3-256", truncatedKeyedHashFuncFactory(newBlake3, 32))
+	Register("BLAKE3-256-128", truncatedKeyedHashFuncFactory(newBlake3, 16))
+}
+
+// newBlake3 returns keyed BLAKE3, the key of the required size is derived from the secret of any length.
+func newBlake3(secret []byte) (hash.Hash, error) {
+	key := make([]byte, blake3KeySize)
+	blake3.DeriveKey(blake3KeyContext, secret, key)
+
+	return blake3.NewKeyed(key)
 }
@@ -93,7 +93,7 @@ func formatBlobFromOptions(opt *NewRepositoryOptions) *formatBlob {
 func repositoryObjectFormatFromOptions(opt *NewRepositoryOptions) *repositoryObjectFormat {
 	f := &repositoryObjectFormat{
 		FormattingOptions: content.FormattingOptions{
-			Version:     1,
+			Version:     applyDefaultInt(opt.BlockFormat.Version, latestFormatVersion()),
 			Hash:        applyDefaultString(opt.BlockFormat.Hash, hashing.DefaultAlgorithm),
 			Encryption:  applyDefaultString(opt.BlockFormat.Encryption, encryption.DefaultAlgorithm),
 			HMACSecret:  applyDefaultRandomBytes(opt.BlockFormat.HMACSecret, hmacSecretLength), //nolint:gomnd
@@ -109,6 +109,10 @@ func repositoryObjectFormatFromOptions(opt *NewRepositoryOptions) *repositoryObj
 		f.HMACSecret = nil
 	}
 
+	if f.Version >= content.KeyPurposesFormatVersion {
+		f.KeyPurposes = applyDefaultKeyPurposes(opt.BlockFormat.KeyPurposes)
+	}
+
 	return f
 }
 
@@ -127,6 +131,15 @@ func applyDefaultInt(v, def int) int {
 	return v
 }
 
+func applyDefaultKeyPurposes(v *content.KeyPurposes) *content.KeyPurposes {
+	if v == nil {
+		p := content.DefaultKeyPurposes
+		return &p
+	}
+
+	return v
+}
+
 func applyDefaultString(v, def string) string {
 	if v == "" {
 		return def
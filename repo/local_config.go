@@ -6,6 +6,7 @@ import (
 	"os"
 
 	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/blob/throttling"
 	"github.com/kopia/kopia/repo/content"
 	"github.com/kopia/kopia/repo/object"
 )
@@ -16,6 +17,17 @@ type LocalConfig struct {
 	Caching  content.CachingOptions `json:"caching"`
 	Hostname string                 `json:"hostname"`
 	Username string                 `json:"username"`
+
+	// LocalReplicaPath is the path of a local filesystem replica of the storage used to serve reads.
+	LocalReplicaPath string `json:"localReplicaPath,omitempty"`
+
+	// AppendOnly indicates that the storage credentials only allow adding blobs, so the client must not
+	// attempt to delete or overwrite them.
+	AppendOnly bool `json:"appendOnly,omitempty"`
+
+	// RequestLimits limits the rate and concurrency of storage requests by class of request,
+	// to avoid throttling by the storage provider and costs of requests, especially during maintenance.
+	RequestLimits map[string]throttling.RequestLimit `json:"requestLimits,omitempty"`
 }
 
 // repositoryObjectFormat describes the format of objects in a repository.
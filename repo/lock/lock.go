@@ -0,0 +1,352 @@
+// Package lock implements cooperative repository locks stored as blobs.
+//
+// Each client holding a lock writes a lock blob and periodically rewrites it to prove it's still alive.
+// Locks whose blobs have not been refreshed within the expiration period are assumed to be abandoned
+// by crashed clients and are ignored.
+//
+// Since blob storage does not provide atomic operations, a lock is acquired by writing the lock blob and
+// listing the locks again afterwards. When two clients race to acquire conflicting locks both of them
+// will notice the conflict and back off.
+//
+// Lock blobs are encrypted with the repository key, so that the storage provider can't learn the names
+// of the hosts and users accessing the repository.
+package lock
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/clock"
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/logging"
+)
+
+var log = logging.GetContextLoggerFunc("kopia/lock")
+
+// Kind is the kind of lock.
+type Kind string
+
+// Supported lock kinds.
+const (
+	// Shared locks are held by operations which add data to the repository, such as snapshots.
+	Shared Kind = "shared"
+
+	// Exclusive locks are held by operations which delete data, such as garbage collection.
+	Exclusive Kind = "exclusive"
+)
+
+const (
+	// BlobPrefix is the prefix of lock blobs, which are rewritten and deleted even by clients that only add data.
+	BlobPrefix blob.ID = "l"
+
+	lockIDLength = 16
+
+	// DefaultHeartbeatInterval is the default interval between refreshes of a lock.
+	DefaultHeartbeatInterval = 1 * time.Minute
+
+	// DefaultExpiration is the default time after which locks that were not refreshed are ignored.
+	DefaultExpiration = 15 * time.Minute
+)
+
+// ErrLocked is returned when a lock cannot be acquired because of a conflicting lock held by another client.
+var ErrLocked = errors.New("repository is locked")
+
+// ErrLost is returned when a lock could not be refreshed and may have been acquired by another client.
+var ErrLost = errors.New("repository lock lost")
+
+// Crypter encrypts and decrypts payloads of lock blobs.
+type Crypter interface {
+	EncryptBlob(blobID blob.ID, data []byte) ([]byte, error)
+	DecryptBlob(blobID blob.ID, data []byte) ([]byte, error)
+}
+
+// Info describes a lock held on a repository.
+type Info struct {
+	BlobID   blob.ID   `json:"-"`
+	Kind     Kind      `json:"kind"`
+	Purpose  string    `json:"purpose"`
+	Hostname string    `json:"hostname"`
+	Username string    `json:"username"`
+	PID      int       `json:"pid"`
+	Acquired time.Time `json:"acquired"`
+
+	// Heartbeat is the time the lock blob was last written as reported by the storage.
+	Heartbeat time.Time `json:"-"`
+}
+
+func (i Info) String() string {
+	return fmt.Sprintf("%v lock %v held by %v@%v (pid %v) for %q since %v",
+		i.Kind, i.BlobID, i.Username, i.Hostname, i.PID, i.Purpose, i.Acquired.Format(time.RFC3339))
+}
+
+// Expired returns true if the lock has not been refreshed within the provided expiration period,
+// allowing for the clock of the storage to be skewed.
+func (i Info) Expired(now time.Time, expiration time.Duration) bool {
+	return clock.OlderThan(now, i.Heartbeat, expiration)
+}
+
+func (i Info) conflictsWith(k Kind) bool {
+	return k == Exclusive || i.Kind == Exclusive
+}
+
+// Options provides options for acquiring locks.
+type Options struct {
+	Purpose  string
+	Hostname string
+	Username string
+	Crypter  Crypter
+
+	HeartbeatInterval time.Duration    // defaults to DefaultHeartbeatInterval
+	Expiration        time.Duration    // defaults to DefaultExpiration
+	TimeNow           func() time.Time // defaults to clock.Now
+}
+
+func (o *Options) applyDefaults() {
+	if o.HeartbeatInterval == 0 {
+		o.HeartbeatInterval = DefaultHeartbeatInterval
+	}
+
+	if o.Expiration == 0 {
+		o.Expiration = DefaultExpiration
+	}
+
+	if o.TimeNow == nil {
+		o.TimeNow = clock.Now
+	}
+}
+
+// Lock represents a lock held by this client.
+type Lock struct {
+	st   blob.Storage
+	info Info
+	data []byte
+
+	closed chan struct{}
+	wg     sync.WaitGroup
+
+	lost    chan struct{}
+	lostErr error
+}
+
+// Info returns information about the lock.
+func (l *Lock) Info() Info {
+	return l.info
+}
+
+// Acquire acquires a lock of the provided kind, returning ErrLocked if a conflicting lock is held by another client.
+// The lock is refreshed in the background until released.
+func Acquire(ctx context.Context, st blob.Storage, kind Kind, opt Options) (*Lock, error) {
+	opt.applyDefaults()
+
+	if opt.Crypter == nil {
+		return nil, errors.New("lock crypter not provided")
+	}
+
+	if err := checkConflicts(ctx, st, kind, "", opt); err != nil {
+		return nil, err
+	}
+
+	var id [lockIDLength]byte
+
+	if _, err := rand.Read(id[:]); err != nil {
+		return nil, errors.Wrap(err, "unable to generate lock ID")
+	}
+
+	info := Info{
+		BlobID:   BlobPrefix + blob.ID(hex.EncodeToString(id[:])),
+		Kind:     kind,
+		Purpose:  opt.Purpose,
+		Hostname: opt.Hostname,
+		Username: opt.Username,
+		PID:      os.Getpid(),
+		Acquired: opt.TimeNow(),
+	}
+
+	data, err := json.Marshal(info)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to marshal lock")
+	}
+
+	data, err = opt.Crypter.EncryptBlob(info.BlobID, data)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to encrypt lock")
+	}
+
+	if err := st.PutBlob(ctx, info.BlobID, data); err != nil {
+		return nil, errors.Wrap(err, "unable to write lock")
+	}
+
+	// check again to detect clients that were acquiring conflicting locks at the same time.
+	if err := checkConflicts(ctx, st, kind, info.BlobID, opt); err != nil {
+		if derr := st.DeleteBlob(ctx, info.BlobID); derr != nil {
+			log(ctx).Warningf("unable to delete lock %v: %v", info.BlobID, derr)
+		}
+
+		return nil, err
+	}
+
+	log(ctx).Debugf("acquired %v", info)
+
+	l := &Lock{
+		st:     st,
+		info:   info,
+		data:   data,
+		closed: make(chan struct{}),
+		lost:   make(chan struct{}),
+	}
+
+	l.wg.Add(1)
+
+	go l.heartbeat(ctx, opt.HeartbeatInterval)
+
+	return l, nil
+}
+
+func checkConflicts(ctx context.Context, st blob.Storage, kind Kind, ownBlobID blob.ID, opt Options) error {
+	locks, err := List(ctx, st, opt.Crypter)
+	if err != nil {
+		return err
+	}
+
+	now := opt.TimeNow()
+
+	for _, i := range locks {
+		if i.BlobID == ownBlobID || i.Expired(now, opt.Expiration) {
+			continue
+		}
+
+		if i.conflictsWith(kind) {
+			return errors.Wrapf(ErrLocked, "%v", i)
+		}
+	}
+
+	return nil
+}
+
+func (l *Lock) heartbeat(ctx context.Context, interval time.Duration) {
+	defer l.wg.Done()
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-l.closed:
+			return
+
+		case <-ctx.Done():
+			return
+
+		case <-t.C:
+			if err := l.st.PutBlob(ctx, l.info.BlobID, l.data); err != nil {
+				// the lock may expire before the next heartbeat, so the operation it protects must not continue.
+				log(ctx).Warningf("unable to refresh lock %v: %v", l.info.BlobID, err)
+
+				l.lostErr = errors.Wrapf(ErrLost, "unable to refresh lock %v: %v", l.info.BlobID, err)
+				close(l.lost)
+
+				return
+			}
+		}
+	}
+}
+
+// Err returns ErrLost if the lock could not be refreshed, nil otherwise.
+func (l *Lock) Err() error {
+	select {
+	case <-l.lost:
+		return l.lostErr
+	default:
+		return nil
+	}
+}
+
+// Context returns a context derived from the provided one, which is canceled when the lock is lost.
+func (l *Lock) Context(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	go func() {
+		select {
+		case <-l.lost:
+			cancel()
+
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, cancel
+}
+
+// Release stops refreshing the lock and deletes it.
+func (l *Lock) Release(ctx context.Context) error {
+	close(l.closed)
+	l.wg.Wait()
+
+	if err := l.st.DeleteBlob(ctx, l.info.BlobID); err != nil && !errors.Is(err, blob.ErrBlobNotFound) {
+		return errors.Wrapf(err, "unable to delete lock %v", l.info.BlobID)
+	}
+
+	log(ctx).Debugf("released %v", l.info)
+
+	return nil
+}
+
+// List returns all locks held on the repository, including expired ones.
+func List(ctx context.Context, st blob.Storage, c Crypter) ([]Info, error) {
+	var blobs []blob.Metadata
+
+	if err := st.ListBlobs(ctx, BlobPrefix, func(m blob.Metadata) error {
+		blobs = append(blobs, m)
+		return nil
+	}); err != nil {
+		return nil, errors.Wrap(err, "unable to list locks")
+	}
+
+	var result []Info
+
+	for _, m := range blobs {
+		data, err := st.GetBlob(ctx, m.BlobID, 0, -1)
+		if errors.Is(err, blob.ErrBlobNotFound) {
+			// released in the meantime.
+			continue
+		}
+
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to read lock %v", m.BlobID)
+		}
+
+		data, err = c.DecryptBlob(m.BlobID, data)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to decrypt lock %v", m.BlobID)
+		}
+
+		var i Info
+		if err := json.Unmarshal(data, &i); err != nil {
+			return nil, errors.Wrapf(err, "invalid lock %v", m.BlobID)
+		}
+
+		i.BlobID = m.BlobID
+		i.Heartbeat = m.Timestamp
+
+		result = append(result, i)
+	}
+
+	return result, nil
+}
+
+// Break forcibly removes a lock held by another client.
+func Break(ctx context.Context, st blob.Storage, blobID blob.ID) error {
+	if len(blobID) == 0 || blobID[0:1] != BlobPrefix {
+		return errors.Errorf("invalid lock ID: %v", blobID)
+	}
+
+	return st.DeleteBlob(ctx, blobID)
+}
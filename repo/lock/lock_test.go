@@ -0,0 +1,220 @@
+package lock
+
+import (
+	"bytes"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/blobtesting"
+	"github.com/kopia/kopia/internal/faketime"
+	"github.com/kopia/kopia/internal/testlogging"
+	"github.com/kopia/kopia/repo/blob"
+)
+
+// testCrypter inverts all bits of the payload.
+type testCrypter struct{}
+
+func (testCrypter) EncryptBlob(blobID blob.ID, data []byte) ([]byte, error) {
+	result := make([]byte, len(data))
+
+	for i, b := range data {
+		result[i] = ^b
+	}
+
+	return result, nil
+}
+
+func (c testCrypter) DecryptBlob(blobID blob.ID, data []byte) ([]byte, error) {
+	return c.EncryptBlob(blobID, data)
+}
+
+func TestLockConflicts(t *testing.T) {
+	ctx := testlogging.Context(t)
+	ta := faketime.NewTimeAdvance(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	st := blobtesting.NewMapStorage(blobtesting.DataMap{}, map[blob.ID]time.Time{}, ta.NowFunc())
+
+	opt := Options{Purpose: "test", Hostname: "host", Username: "user", Crypter: testCrypter{}, TimeNow: ta.NowFunc()}
+
+	s1, err := Acquire(ctx, st, Shared, opt)
+	if err != nil {
+		t.Fatalf("unable to acquire shared lock: %v", err)
+	}
+
+	s2, err := Acquire(ctx, st, Shared, opt)
+	if err != nil {
+		t.Fatalf("unable to acquire second shared lock: %v", err)
+	}
+
+	if _, err = Acquire(ctx, st, Exclusive, opt); !errors.Is(err, ErrLocked) {
+		t.Fatalf("unexpected error acquiring exclusive lock while shared locks are held: %v", err)
+	}
+
+	locks, err := List(ctx, st, testCrypter{})
+	if err != nil {
+		t.Fatalf("unable to list locks: %v", err)
+	}
+
+	// failed attempt to acquire exclusive lock must not leave its blob behind.
+	if got, want := len(locks), 2; got != want {
+		t.Fatalf("unexpected number of locks: %v, want %v", got, want)
+	}
+
+	for _, l := range []*Lock{s1, s2} {
+		if err := l.Release(ctx); err != nil {
+			t.Fatalf("unable to release lock: %v", err)
+		}
+	}
+
+	ex, err := Acquire(ctx, st, Exclusive, opt)
+	if err != nil {
+		t.Fatalf("unable to acquire exclusive lock: %v", err)
+	}
+
+	if _, err = Acquire(ctx, st, Shared, opt); !errors.Is(err, ErrLocked) {
+		t.Fatalf("unexpected error acquiring shared lock while exclusive lock is held: %v", err)
+	}
+
+	if err := ex.Release(ctx); err != nil {
+		t.Fatalf("unable to release lock: %v", err)
+	}
+
+	s3, err := Acquire(ctx, st, Shared, opt)
+	if err != nil {
+		t.Fatalf("unable to acquire shared lock: %v", err)
+	}
+
+	defer s3.Release(ctx) //nolint:errcheck
+}
+
+func TestLockExpiration(t *testing.T) {
+	ctx := testlogging.Context(t)
+	ta := faketime.NewTimeAdvance(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	st := blobtesting.NewMapStorage(blobtesting.DataMap{}, map[blob.ID]time.Time{}, ta.NowFunc())
+
+	opt := Options{
+		Purpose:           "test",
+		HeartbeatInterval: time.Hour, // heartbeat never fires during the test
+		Expiration:        10 * time.Minute,
+		Crypter:           testCrypter{},
+		TimeNow:           ta.NowFunc(),
+	}
+
+	abandoned, err := Acquire(ctx, st, Exclusive, opt)
+	if err != nil {
+		t.Fatalf("unable to acquire exclusive lock: %v", err)
+	}
+
+	defer abandoned.Release(ctx) //nolint:errcheck
+
+	if _, err = Acquire(ctx, st, Shared, opt); !errors.Is(err, ErrLocked) {
+		t.Fatalf("unexpected error acquiring shared lock while exclusive lock is held: %v", err)
+	}
+
+	// past expiration and tolerated clock skew.
+	ta.Advance(16 * time.Minute)
+
+	s, err := Acquire(ctx, st, Shared, opt)
+	if err != nil {
+		t.Fatalf("unable to acquire shared lock after exclusive lock has expired: %v", err)
+	}
+
+	if err := s.Release(ctx); err != nil {
+		t.Fatalf("unable to release lock: %v", err)
+	}
+
+	if err := Break(ctx, st, abandoned.Info().BlobID); err != nil {
+		t.Fatalf("unable to break lock: %v", err)
+	}
+
+	locks, err := List(ctx, st, testCrypter{})
+	if err != nil {
+		t.Fatalf("unable to list locks: %v", err)
+	}
+
+	if len(locks) != 0 {
+		t.Fatalf("unexpected locks: %v", locks)
+	}
+
+	if err := Break(ctx, st, "pabcdef"); err == nil {
+		t.Fatalf("expected error breaking non-lock blob")
+	}
+}
+
+func TestLockEncrypted(t *testing.T) {
+	ctx := testlogging.Context(t)
+	data := blobtesting.DataMap{}
+	st := blobtesting.NewMapStorage(data, nil, nil)
+
+	l, err := Acquire(ctx, st, Shared, Options{Purpose: "test", Hostname: "some-host", Username: "some-user", Crypter: testCrypter{}})
+	if err != nil {
+		t.Fatalf("unable to acquire lock: %v", err)
+	}
+
+	defer l.Release(ctx) //nolint:errcheck
+
+	for id, payload := range data {
+		if bytes.Contains(payload, []byte("some-host")) || bytes.Contains(payload, []byte("some-user")) {
+			t.Errorf("lock %v is not encrypted: %s", id, payload)
+		}
+	}
+
+	locks, err := List(ctx, st, testCrypter{})
+	if err != nil {
+		t.Fatalf("unable to list locks: %v", err)
+	}
+
+	if len(locks) != 1 || locks[0].Hostname != "some-host" || locks[0].Username != "some-user" {
+		t.Fatalf("unexpected locks: %v", locks)
+	}
+}
+
+func TestLockLost(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	var failing int32
+
+	st := &blobtesting.FaultyStorage{
+		Base: blobtesting.NewMapStorage(blobtesting.DataMap{}, nil, nil),
+		Faults: map[string][]*blobtesting.Fault{
+			"PutBlob": {{
+				Repeat: 1000,
+				ErrCallback: func() error {
+					if atomic.LoadInt32(&failing) != 0 {
+						return errors.New("some error")
+					}
+
+					return nil
+				},
+			}},
+		},
+	}
+
+	l, err := Acquire(ctx, st, Shared, Options{Purpose: "test", Crypter: testCrypter{}, HeartbeatInterval: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("unable to acquire lock: %v", err)
+	}
+
+	defer l.Release(ctx) //nolint:errcheck
+
+	lockedCtx, cancel := l.Context(ctx)
+	defer cancel()
+
+	if err := l.Err(); err != nil {
+		t.Fatalf("unexpected lock error: %v", err)
+	}
+
+	atomic.StoreInt32(&failing, 1)
+
+	select {
+	case <-lockedCtx.Done():
+	case <-time.After(10 * time.Second):
+		t.Fatalf("context not canceled after lock was lost")
+	}
+
+	if err := l.Err(); !errors.Is(err, ErrLost) {
+		t.Fatalf("unexpected lock error: %v", err)
+	}
+}
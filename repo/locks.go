@@ -0,0 +1,19 @@
+package repo
+
+import (
+	"context"
+
+	"github.com/kopia/kopia/repo/lock"
+)
+
+// AcquireLock acquires a cooperative lock of the provided kind on the repository on behalf of the connected user.
+// The lock must be released by the caller, which should stop the operation if the lock is lost.
+func (r *Repository) AcquireLock(ctx context.Context, kind lock.Kind, purpose string) (*lock.Lock, error) {
+	return lock.Acquire(ctx, r.Blobs, kind, lock.Options{
+		Purpose:  purpose,
+		Hostname: r.Hostname,
+		Username: r.Username,
+		Crypter:  r.Content,
+		TimeNow:  r.timeNow,
+	})
+}
@@ -14,6 +14,8 @@ import (
 
 	"github.com/pkg/errors"
 
+	"github.com/kopia/kopia/internal/clock"
+	"github.com/kopia/kopia/repo/blob/appendonly"
 	"github.com/kopia/kopia/repo/content"
 	"github.com/kopia/kopia/repo/logging"
 )
@@ -26,7 +28,7 @@ var log = logging.GetContextLoggerFunc("kopia/manifest")
 var ErrNotFound = errors.New("not found")
 
 // ContentPrefix is the prefix of the content id for manifests
-const ContentPrefix = "m"
+const ContentPrefix = content.ManifestContentPrefix
 const autoCompactionContentCount = 16
 
 // TypeLabelKey is the label key for manifest type
@@ -57,6 +59,16 @@ type Manager struct {
 	committedContentIDs map[content.ID]bool
 
 	timeNow func() time.Time // Time provider
+
+	// mirror, if set, receives a copy of committed entries whenever they change.
+	mirror *Mirror
+
+	// offline is true when entries were loaded from the mirror at a time given by refreshed.
+	offline   bool
+	refreshed time.Time
+
+	// appendOnly is true when manifests can only be added, since the connection is not allowed to delete them.
+	appendOnly bool
 }
 
 // Put serializes the provided payload to JSON and persists it. Returns unique identifier that represents the manifest.
@@ -65,6 +77,10 @@ func (m *Manager) Put(ctx context.Context, labels map[string]string, payload int
 		return "", errors.Errorf("'type' label is required")
 	}
 
+	if m.offline {
+		return "", ErrOffline
+	}
+
 	if err := m.ensureInitialized(ctx); err != nil {
 		return "", err
 	}
@@ -254,6 +270,8 @@ func (m *Manager) flushPendingEntriesLocked(ctx context.Context) (content.ID, er
 
 	m.committedContentIDs[contentID] = true
 
+	m.saveMirrorLocked(ctx)
+
 	return contentID, nil
 }
 
@@ -265,6 +283,14 @@ func mustSucceed(e error) {
 
 // Delete marks the specified manifest ID for deletion.
 func (m *Manager) Delete(ctx context.Context, id ID) error {
+	if m.offline {
+		return ErrOffline
+	}
+
+	if m.appendOnly {
+		return errors.Wrapf(appendonly.ErrAppendOnly, "unable to delete manifest %v", id)
+	}
+
 	if err := m.ensureInitialized(ctx); err != nil {
 		return err
 	}
@@ -287,6 +313,10 @@ func (m *Manager) Delete(ctx context.Context, id ID) error {
 
 // Refresh updates the committed contents from the underlying storage.
 func (m *Manager) Refresh(ctx context.Context) error {
+	if m.offline {
+		return ErrOffline
+	}
+
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
@@ -331,14 +361,25 @@ func (m *Manager) loadCommittedContentsLocked(ctx context.Context) error {
 	}
 
 	m.loadManifestContentsLocked(manifests)
+	m.refreshed = m.timeNow()
 
 	if err := m.maybeCompactLocked(ctx); err != nil {
 		return errors.Errorf("error auto-compacting contents")
 	}
 
+	m.saveMirrorLocked(ctx)
+
 	return nil
 }
 
+func (m *Manager) saveMirrorLocked(ctx context.Context) {
+	if m.mirror == nil {
+		return
+	}
+
+	m.mirror.save(ctx, m.committedEntries, m.refreshed)
+}
+
 func (m *Manager) loadManifestContentsLocked(manifests map[content.ID]manifest) {
 	m.committedEntries = map[ID]*manifestEntry{}
 	m.committedContentIDs = map[content.ID]bool{}
@@ -385,6 +426,14 @@ func (m *Manager) loadManifestContent(ctx context.Context, contentID content.ID)
 
 // Compact performs compaction of manifest contents.
 func (m *Manager) Compact(ctx context.Context) error {
+	if m.offline {
+		return ErrOffline
+	}
+
+	if m.appendOnly {
+		return errors.Wrap(appendonly.ErrAppendOnly, "unable to compact manifests")
+	}
+
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
@@ -392,7 +441,7 @@ func (m *Manager) Compact(ctx context.Context) error {
 }
 
 func (m *Manager) maybeCompactLocked(ctx context.Context) error {
-	if len(m.committedContentIDs) < autoCompactionContentCount {
+	if m.appendOnly || len(m.committedContentIDs) < autoCompactionContentCount {
 		return nil
 	}
 
@@ -487,14 +536,16 @@ func copyLabels(m map[string]string) map[string]string {
 
 // ManagerOptions are optional parameters for Manager creation
 type ManagerOptions struct {
-	TimeNow func() time.Time // Time provider
+	TimeNow    func() time.Time // Time provider
+	Mirror     *Mirror          // Local copy of committed manifest entries to keep up-to-date
+	AppendOnly bool             // Manifests can't be deleted and their contents are never compacted
 }
 
 // NewManager returns new manifest manager for the provided content manager.
 func NewManager(ctx context.Context, b contentManager, options ManagerOptions) (*Manager, error) {
 	timeNow := options.TimeNow
 	if timeNow == nil {
-		timeNow = time.Now // allow:no-inject-time
+		timeNow = clock.Now
 	}
 
 	m := &Manager{
@@ -503,6 +554,8 @@ func NewManager(ctx context.Context, b contentManager, options ManagerOptions) (
 		committedEntries:    map[ID]*manifestEntry{},
 		committedContentIDs: map[content.ID]bool{},
 		timeNow:             timeNow,
+		mirror:              options.Mirror,
+		appendOnly:          options.AppendOnly,
 	}
 
 	return m, nil
@@ -2,14 +2,20 @@ package manifest
 
 import (
 	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"reflect"
 	"sort"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/pkg/errors"
+
 	"github.com/kopia/kopia/internal/blobtesting"
 	"github.com/kopia/kopia/internal/testlogging"
+	"github.com/kopia/kopia/repo/blob/appendonly"
 	"github.com/kopia/kopia/repo/content"
 	"github.com/kopia/kopia/repo/encryption"
 )
@@ -344,3 +350,128 @@ func TestManifestAutoCompaction(t *testing.T) {
 		mgr.Flush(ctx)
 	}
 }
+
+func TestManifestAppendOnly(t *testing.T) {
+	ctx := testlogging.Context(t)
+	data := blobtesting.DataMap{}
+
+	var ids []ID
+
+	// more contents than trigger automatic compaction, which would delete them.
+	for i := 0; i < 2*autoCompactionContentCount; i++ {
+		bm, err := content.NewManager(ctx, blobtesting.NewMapStorage(data, nil, nil), &content.FormattingOptions{
+			Hash:        "HMAC-SHA256-128",
+			Encryption:  encryption.NoneAlgorithm,
+			MaxPackSize: 100000,
+			Version:     1,
+		}, content.CachingOptions{}, content.ManagerOptions{AppendOnly: true})
+		if err != nil {
+			t.Fatalf("can't create content manager: %v", err)
+		}
+
+		mgr, err := NewManager(ctx, bm, ManagerOptions{AppendOnly: true})
+		if err != nil {
+			t.Fatalf("can't create manifest manager: %v", err)
+		}
+
+		ids = append(ids, addAndVerify(ctx, t, mgr, map[string]string{"type": "item"}, map[string]int{"i": i}))
+
+		if err := mgr.Flush(ctx); err != nil {
+			t.Fatalf("flush error: %v", err)
+		}
+
+		if err := bm.Flush(ctx); err != nil {
+			t.Fatalf("flush error: %v", err)
+		}
+
+		if err := mgr.Delete(ctx, ids[0]); !errors.Is(err, appendonly.ErrAppendOnly) {
+			t.Fatalf("unexpected error deleting manifest in append-only mode: %v", err)
+		}
+
+		if err := bm.DeleteContent(ctx, content.ID(ids[0])); !errors.Is(err, appendonly.ErrAppendOnly) {
+			t.Fatalf("unexpected error deleting content in append-only mode: %v", err)
+		}
+	}
+
+	mgr := newManagerForTesting(ctx, t, data)
+
+	entries, err := mgr.Find(ctx, map[string]string{"type": "item"})
+	if err != nil {
+		t.Fatalf("find error: %v", err)
+	}
+
+	if got, want := len(entries), len(ids); got != want {
+		t.Errorf("unexpected number of manifests: %v, want %v", got, want)
+	}
+}
+
+func TestManifestMirror(t *testing.T) {
+	ctx := testlogging.Context(t)
+	data := blobtesting.DataMap{}
+
+	td, err := ioutil.TempDir("", "kopia-manifest-mirror")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+
+	defer os.RemoveAll(td)
+
+	mirrorFile := filepath.Join(td, "manifests")
+
+	bm, err := content.NewManager(ctx, blobtesting.NewMapStorage(data, nil, nil), &content.FormattingOptions{
+		Hash:        "HMAC-SHA256-128",
+		Encryption:  encryption.NoneAlgorithm,
+		MaxPackSize: 100000,
+		Version:     1,
+	}, content.CachingOptions{}, content.ManagerOptions{})
+	if err != nil {
+		t.Fatalf("can't create content manager: %v", err)
+	}
+
+	mgr, err := NewManager(ctx, bm, ManagerOptions{Mirror: NewMirror(mirrorFile, []byte("secret"))})
+	if err != nil {
+		t.Fatalf("can't create manifest manager: %v", err)
+	}
+
+	item1 := map[string]int{"foo": 1, "bar": 2}
+	labels1 := map[string]string{"type": "item", "color": "red"}
+	id1 := addAndVerify(ctx, t, mgr, labels1, item1)
+	id2 := addAndVerify(ctx, t, mgr, map[string]string{"type": "item", "color": "blue"}, item1)
+
+	if err := mgr.Flush(ctx); err != nil {
+		t.Fatalf("flush error: %v", err)
+	}
+
+	if err := mgr.Delete(ctx, id2); err != nil {
+		t.Fatalf("delete error: %v", err)
+	}
+
+	if err := mgr.Flush(ctx); err != nil {
+		t.Fatalf("flush error: %v", err)
+	}
+
+	offline, err := NewManagerFromMirror(NewMirror(mirrorFile, []byte("secret")))
+	if err != nil {
+		t.Fatalf("unable to load mirror: %v", err)
+	}
+
+	if _, ok := offline.LoadedFromMirror(); !ok {
+		t.Errorf("manager is not marked as loaded from mirror")
+	}
+
+	if _, ok := mgr.LoadedFromMirror(); ok {
+		t.Errorf("online manager is marked as loaded from mirror")
+	}
+
+	verifyItem(ctx, t, offline, id1, labels1, item1)
+	verifyItemNotFound(ctx, t, offline, id2)
+	verifyMatches(ctx, t, offline, map[string]string{"type": "item"}, []ID{id1})
+
+	if _, err := offline.Put(ctx, labels1, item1); !errors.Is(err, ErrOffline) {
+		t.Errorf("unexpected error when putting offline: %v", err)
+	}
+
+	if _, err := NewManagerFromMirror(NewMirror(mirrorFile, []byte("wrong-secret"))); err == nil {
+		t.Errorf("expected error when loading mirror with invalid secret")
+	}
+}
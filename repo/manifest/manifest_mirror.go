@@ -0,0 +1,117 @@
+package manifest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/hmac"
+	"github.com/kopia/kopia/repo/content"
+)
+
+// ErrOffline is returned when attempting to modify manifests loaded from the local mirror.
+var ErrOffline = errors.New("manifests loaded from the local mirror are read-only")
+
+// Mirror is a local copy of committed manifest entries stored in a file protected with HMAC,
+// which allows listing manifests instantly and without access to the repository storage.
+type Mirror struct {
+	filename   string
+	hmacSecret []byte
+}
+
+type mirrorContents struct {
+	// Refreshed is the time manifests were last loaded from the repository.
+	Refreshed time.Time        `json:"refreshed"`
+	Entries   []*manifestEntry `json:"entries"`
+}
+
+// NewMirror returns a mirror stored in the provided file.
+func NewMirror(filename string, hmacSecret []byte) *Mirror {
+	return &Mirror{
+		filename:   filename,
+		hmacSecret: hmacSecret,
+	}
+}
+
+func (mm *Mirror) save(ctx context.Context, entries map[ID]*manifestEntry, refreshed time.Time) {
+	mc := mirrorContents{Refreshed: refreshed}
+
+	for _, e := range entries {
+		if !e.Deleted {
+			mc.Entries = append(mc.Entries, e)
+		}
+	}
+
+	data, err := json.Marshal(mc)
+	if err != nil {
+		log(ctx).Warningf("unable to serialize manifest mirror: %v", err)
+		return
+	}
+
+	mySuffix := fmt.Sprintf(".tmp-%v-%v", os.Getpid(), time.Now().UnixNano()) // allow:no-inject-time
+	if err := ioutil.WriteFile(mm.filename+mySuffix, hmac.Append(data, mm.hmacSecret), 0600); err != nil {
+		log(ctx).Warningf("unable to write manifest mirror: %v", err)
+		return
+	}
+
+	os.Rename(mm.filename+mySuffix, mm.filename) //nolint:errcheck
+	os.Remove(mm.filename + mySuffix)            //nolint:errcheck
+}
+
+func (mm *Mirror) load() (*mirrorContents, error) {
+	data, err := ioutil.ReadFile(mm.filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, errors.Errorf("manifest mirror has not been written yet")
+		}
+
+		return nil, errors.Wrap(err, "unable to read manifest mirror")
+	}
+
+	data, err = hmac.VerifyAndStrip(data, mm.hmacSecret)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid manifest mirror")
+	}
+
+	var mc mirrorContents
+
+	if err := json.Unmarshal(data, &mc); err != nil {
+		return nil, errors.Wrap(err, "unable to parse manifest mirror")
+	}
+
+	return &mc, nil
+}
+
+// NewManagerFromMirror returns read-only manifest manager with entries loaded from the provided mirror.
+func NewManagerFromMirror(mm *Mirror) (*Manager, error) {
+	mc, err := mm.load()
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Manager{
+		initialized:         true,
+		pendingEntries:      map[ID]*manifestEntry{},
+		committedEntries:    map[ID]*manifestEntry{},
+		committedContentIDs: map[content.ID]bool{},
+		offline:             true,
+		refreshed:           mc.Refreshed,
+	}
+
+	for _, e := range mc.Entries {
+		m.committedEntries[e.ID] = e
+	}
+
+	return m, nil
+}
+
+// LoadedFromMirror returns the time manifests were last loaded from the repository
+// if the manager is using entries from the local mirror.
+func (m *Manager) LoadedFromMirror() (refreshed time.Time, ok bool) {
+	return m.refreshed, m.offline
+}
@@ -0,0 +1,137 @@
+package object
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo/content"
+)
+
+// ChunkInfo describes a single content backing a part of an object.
+type ChunkInfo struct {
+	// Start and Length specify the range of the object stored in the chunk, Length is the uncompressed length.
+	Start  int64 `json:"start"`
+	Length int64 `json:"length"`
+
+	// Level is the indirection level at which the chunk is referenced, 0 for direct objects.
+	Level int `json:"level"`
+
+	ObjectID   ID           `json:"objectID"`
+	Compressed bool         `json:"compressed,omitempty"`
+	Content    content.Info `json:"content"`
+}
+
+// Layout describes how an object is stored in the repository.
+type Layout struct {
+	ObjectID ID `json:"objectID"`
+
+	// IndirectionLevels is the number of indirect object lists that must be read to locate the data.
+	IndirectionLevels int `json:"indirectionLevels"`
+
+	// Chunks are the contents holding object data, ordered by their position in the object.
+	Chunks []ChunkInfo `json:"chunks"`
+
+	// IndexChunks are the contents holding the lists of chunks of indirect objects.
+	IndexChunks []ChunkInfo `json:"indexChunks,omitempty"`
+
+	// InlineLength is the length of data stored inline in the object ID, which is not backed by any contents.
+	InlineLength int64 `json:"inlineLength,omitempty"`
+}
+
+// Length returns the total length of the object.
+func (l *Layout) Length() int64 {
+	total := l.InlineLength
+
+	for _, c := range l.Chunks {
+		total += c.Length
+	}
+
+	return total
+}
+
+// GetLayout returns the description of contents backing the provided object and their locations.
+func (om *Manager) GetLayout(ctx context.Context, oid ID) (*Layout, error) {
+	l := &Layout{ObjectID: oid}
+
+	if err := om.addToLayout(ctx, l, oid, 0, -1, 0, false); err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// addToLayout adds chunks of the object stored at the provided range of its parent to the layout.
+// length is -1 when the range is not known, such as for top-level objects.
+func (om *Manager) addToLayout(ctx context.Context, l *Layout, oid ID, start, length int64, level int, isIndex bool) error {
+	if indexObjectID, ok := oid.IndexObjectID(); ok {
+		if level+1 > l.IndirectionLevels {
+			l.IndirectionLevels = level + 1
+		}
+
+		if err := om.addToLayout(ctx, l, indexObjectID, 0, -1, level+1, true); err != nil {
+			return errors.Wrap(err, "unable to inspect index")
+		}
+
+		rd, err := om.Open(ctx, indexObjectID)
+		if err != nil {
+			return err
+		}
+		defer rd.Close() //nolint:errcheck
+
+		seekTable, err := om.flattenListChunk(rd)
+		if err != nil {
+			return err
+		}
+
+		for _, m := range seekTable {
+			if err := om.addToLayout(ctx, l, m.Object, start+m.Start, m.Length, level+1, isIndex); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	if data, ok := oid.InlineData(); ok {
+		l.InlineLength += int64(len(data))
+		return nil
+	}
+
+	contentID, compressed, ok := oid.ContentID()
+	if !ok {
+		return errors.Errorf("unrecognized object type: %v", oid)
+	}
+
+	ci, err := om.contentMgr.ContentInfo(ctx, contentID)
+	if err != nil {
+		return errors.Wrapf(err, "unable to get information about content %v", contentID)
+	}
+
+	if length < 0 {
+		rd, err := om.Open(ctx, oid)
+		if err != nil {
+			return err
+		}
+
+		length = rd.Length()
+		rd.Close() //nolint:errcheck
+	}
+
+	c := ChunkInfo{
+		Start:      start,
+		Length:     length,
+		Level:      level,
+		ObjectID:   oid,
+		Compressed: compressed,
+		Content:    ci,
+	}
+
+	if isIndex {
+		l.IndexChunks = append(l.IndexChunks, c)
+	} else {
+		l.Chunks = append(l.Chunks, c)
+	}
+
+	return nil
+}
@@ -0,0 +1,118 @@
+package object
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/kopia/kopia/internal/testlogging"
+	"github.com/kopia/kopia/repo/splitter"
+)
+
+func TestGetLayout(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	cases := []struct {
+		dataLength       int
+		expectedChunks   int
+		expectedIndirect int
+	}{
+		{dataLength: 200, expectedChunks: 1, expectedIndirect: 0},
+		{dataLength: 1000, expectedChunks: 1, expectedIndirect: 0},
+		{dataLength: 1001, expectedChunks: 2, expectedIndirect: 1},
+		{dataLength: 3005, expectedChunks: 4, expectedIndirect: 1},
+	}
+
+	for _, c := range cases {
+		_, om := setupTest(t)
+
+		writer := om.NewWriter(ctx, WriterOptions{})
+		writer.(*objectWriter).splitter = splitter.Fixed(1000)()
+
+		if _, err := writer.Write(makeCompressibleData(c.dataLength)); err != nil {
+			t.Fatalf("write error: %v", err)
+		}
+
+		oid, err := writer.Result()
+		if err != nil {
+			t.Fatalf("error getting writer results: %v", err)
+		}
+
+		l, err := om.GetLayout(ctx, oid)
+		if err != nil {
+			t.Fatalf("error getting layout of %v: %v", oid, err)
+		}
+
+		if got, want := len(l.Chunks), c.expectedChunks; got != want {
+			t.Errorf("unexpected number of chunks for %v: %v, want %v", c.dataLength, got, want)
+		}
+
+		if got, want := l.IndirectionLevels, c.expectedIndirect; got != want {
+			t.Errorf("unexpected indirection for %v: %v, want %v", c.dataLength, got, want)
+		}
+
+		if got, want := len(l.IndexChunks), c.expectedIndirect; got != want {
+			t.Errorf("unexpected number of index chunks for %v: %v, want %v", c.dataLength, got, want)
+		}
+
+		if got, want := l.Length(), int64(c.dataLength); got != want {
+			t.Errorf("unexpected length: %v, want %v", got, want)
+		}
+
+		var nextStart int64
+
+		for _, ch := range l.Chunks {
+			if ch.Start != nextStart {
+				t.Errorf("unexpected chunk start %v, want %v", ch.Start, nextStart)
+			}
+
+			nextStart += ch.Length
+		}
+	}
+}
+
+func TestWriterSplitPoints(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	cases := []struct {
+		splitPoints     []int64
+		expectedLengths []int64
+	}{
+		{nil, []int64{1000, 1000, 1000}},
+		// the splitter starts from scratch after each split point.
+		{[]int64{300, 700, 1500}, []int64{300, 400, 800, 1000, 500}},
+		{[]int64{1500}, []int64{1000, 500, 1000, 500}},
+		{[]int64{2000}, []int64{1000, 1000, 1000}},
+		// invalid split points are ignored.
+		{[]int64{700, 300}, []int64{1000, 1000, 1000}},
+	}
+
+	for _, c := range cases {
+		_, om := setupTest(t)
+
+		writer := om.NewWriter(ctx, WriterOptions{SplitPoints: c.splitPoints})
+		writer.(*objectWriter).splitter = splitter.Fixed(1000)()
+
+		if _, err := writer.Write(makeCompressibleData(3000)); err != nil {
+			t.Fatalf("write error: %v", err)
+		}
+
+		oid, err := writer.Result()
+		if err != nil {
+			t.Fatalf("error getting writer results: %v", err)
+		}
+
+		l, err := om.GetLayout(ctx, oid)
+		if err != nil {
+			t.Fatalf("error getting layout of %v: %v", oid, err)
+		}
+
+		var lengths []int64
+		for _, ch := range l.Chunks {
+			lengths = append(lengths, ch.Length)
+		}
+
+		if !reflect.DeepEqual(lengths, c.expectedLengths) {
+			t.Errorf("unexpected chunk lengths for split points %v: %v, want %v", c.splitPoints, lengths, c.expectedLengths)
+		}
+	}
+}
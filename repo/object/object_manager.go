@@ -6,6 +6,7 @@ import (
 	"context"
 	"encoding/json"
 	"io"
+	"sync"
 
 	"github.com/pkg/errors"
 
@@ -49,6 +50,9 @@ type Manager struct {
 
 	newSplitter splitter.Factory
 
+	splitterMutex     sync.Mutex
+	splitterOverrides map[string]splitter.Factory // splitters requested by writers, by name
+
 	bufferPool *buf.Pool
 }
 
@@ -57,10 +61,16 @@ func (om *Manager) NewWriter(ctx context.Context, opt WriterOptions) Writer {
 	w := &objectWriter{
 		ctx:         ctx,
 		om:          om,
-		splitter:    om.newSplitter(),
+		splitter:    om.splitterFactory(opt.Splitter)(),
 		description: opt.Description,
 		prefix:      opt.Prefix,
 		compressor:  compression.ByName[opt.Compressor],
+
+		adaptiveCompression: opt.AdaptiveCompression,
+	}
+
+	if validSplitPoints(opt.SplitPoints) {
+		w.splitPoints = opt.SplitPoints
 	}
 
 	w.initBuffer()
@@ -68,12 +78,64 @@ func (om *Manager) NewWriter(ctx context.Context, opt WriterOptions) Writer {
 	return w
 }
 
+// splitterFactory returns the factory of the splitter with the provided name, falling back to
+// the repository splitter when the name is empty or not supported.
+func (om *Manager) splitterFactory(name string) splitter.Factory {
+	if name == "" {
+		return om.newSplitter
+	}
+
+	om.splitterMutex.Lock()
+	defer om.splitterMutex.Unlock()
+
+	if f, ok := om.splitterOverrides[name]; ok {
+		return f
+	}
+
+	f := splitter.GetFactory(name)
+	if f == nil {
+		om.trace("unsupported splitter %q, using repository splitter", name)
+		return om.newSplitter
+	}
+
+	if om.splitterOverrides == nil {
+		om.splitterOverrides = map[string]splitter.Factory{}
+	}
+
+	om.splitterOverrides[name] = splitter.Pooled(f)
+
+	return om.splitterOverrides[name]
+}
+
+// validSplitPoints returns true if split points are positive and increasing.
+func validSplitPoints(points []int64) bool {
+	var last int64
+
+	for _, p := range points {
+		if p <= last {
+			return false
+		}
+
+		last = p
+	}
+
+	return true
+}
+
 // Open creates new ObjectReader for reading given object from a repository.
 func (om *Manager) Open(ctx context.Context, objectID ID) (Reader, error) {
 	return om.openAndAssertLength(ctx, objectID, -1)
 }
 
 func (om *Manager) openAndAssertLength(ctx context.Context, objectID ID, assertLength int64) (Reader, error) {
+	if data, ok := objectID.InlineData(); ok {
+		if assertLength != -1 && int64(len(data)) != assertLength {
+			return nil, errors.Errorf("unexpected inline object length %v, expected %v", len(data), assertLength)
+		}
+
+		return newObjectReaderWithData(data), nil
+	}
+
 	if indexObjectID, ok := objectID.IndexObjectID(); ok {
 		rd, err := om.Open(ctx, indexObjectID)
 		if err != nil {
@@ -142,6 +204,11 @@ func (om *Manager) verifyObjectInternal(ctx context.Context, oid ID, tracker *co
 		return om.verifyIndirectObjectInternal(ctx, indexObjectID, tracker)
 	}
 
+	if _, ok := oid.InlineData(); ok {
+		// inline objects are not backed by any contents.
+		return nil
+	}
+
 	if contentID, _, ok := oid.ContentID(); ok {
 		if _, err := om.contentMgr.ContentInfo(ctx, contentID); err != nil {
 			return err
@@ -285,6 +285,54 @@ func TestReader(t *testing.T) {
 	}
 }
 
+func TestInlineObject(t *testing.T) {
+	ctx := testlogging.Context(t)
+	data, om := setupTest(t)
+
+	payload := []byte("foo\nbar")
+	oid := InlineObjectID(payload)
+
+	if _, err := ParseID(oid.String()); err != nil {
+		t.Fatalf("unable to parse inline object ID %v: %v", oid, err)
+	}
+
+	reader, err := om.Open(ctx, oid)
+	if err != nil {
+		t.Fatalf("cannot create reader for %v: %v", oid, err)
+	}
+
+	if got, want := reader.Length(), int64(len(payload)); got != want {
+		t.Errorf("unexpected length: %v, want %v", got, want)
+	}
+
+	d, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("cannot read all data for %v: %v", oid, err)
+	}
+
+	if !bytes.Equal(d, payload) {
+		t.Errorf("incorrect payload for %v: expected: %v got: %v", oid, payload, d)
+	}
+
+	contentIDs, err := om.VerifyObject(ctx, oid)
+	if err != nil {
+		t.Fatalf("unable to verify %v: %v", oid, err)
+	}
+
+	if len(contentIDs) != 0 || len(data) != 0 {
+		t.Errorf("inline object should not be backed by contents: %v %v", contentIDs, data)
+	}
+
+	l, err := om.GetLayout(ctx, oid)
+	if err != nil {
+		t.Fatalf("unable to get layout of %v: %v", oid, err)
+	}
+
+	if got, want := l.Length(), int64(len(payload)); got != want || len(l.Chunks) != 0 {
+		t.Errorf("unexpected layout: %+v", l)
+	}
+}
+
 func TestReaderStoredBlockNotFound(t *testing.T) {
 	ctx := testlogging.Context(t)
 	_, om := setupTest(t)
@@ -371,6 +419,110 @@ func TestEndToEndReadAndSeekWithCompression(t *testing.T) {
 	}
 }
 
+func TestAdaptiveCompression(t *testing.T) {
+	ctx := testlogging.Context(t)
+	data, om := setupTest(t)
+
+	const size = 1 << 20
+
+	compressible := makeCompressibleData(size)
+	incompressible := make([]byte, size)
+	cryptorand.Read(incompressible) //nolint:errcheck
+
+	for _, input := range [][]byte{compressible, incompressible} {
+		writer := om.NewWriter(ctx, WriterOptions{Compressor: "zstd", AdaptiveCompression: true})
+		if _, err := writer.Write(input); err != nil {
+			t.Fatalf("write error: %v", err)
+		}
+
+		objectID, err := writer.Result()
+		writer.Close()
+
+		if err != nil {
+			t.Fatalf("cannot get writer result: %v", err)
+		}
+
+		verify(ctx, t, om, objectID, input, objectID.String())
+	}
+
+	var compressedBytes int
+	for _, d := range data {
+		compressedBytes += len(d)
+	}
+
+	// random data is stored uncompressed, which adds no compression header, compressible data shrinks to almost nothing.
+	if compressedBytes < size || compressedBytes > size+size/100 {
+		t.Errorf("unexpected number of bytes written: %v", compressedBytes)
+	}
+}
+
+func TestWriterSplitterOverride(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	cases := []struct {
+		splitter   string
+		wantChunks int
+	}{
+		{"", 3},         // repository splitter, FIXED-1M
+		{"FIXED-2M", 2}, // overridden
+		{"NO-SUCH-SPLITTER", 3},
+	}
+
+	for _, tc := range cases {
+		data, om := setupTest(t)
+
+		input := make([]byte, 5<<19)
+		cryptorand.Read(input) //nolint:errcheck
+
+		writer := om.NewWriter(ctx, WriterOptions{Splitter: tc.splitter})
+		if _, err := writer.Write(input); err != nil {
+			t.Fatalf("write error: %v", err)
+		}
+
+		objectID, err := writer.Result()
+		writer.Close()
+
+		if err != nil {
+			t.Fatalf("cannot get writer result: %v", err)
+		}
+
+		verify(ctx, t, om, objectID, input, tc.splitter)
+
+		// data contents plus the index content.
+		if got, want := len(data), tc.wantChunks+1; got != want {
+			t.Errorf("invalid number of contents for %q: %v, want %v", tc.splitter, got, want)
+		}
+	}
+}
+
+func TestWorthCompressing(t *testing.T) {
+	comp := compression.ByName["zstd"]
+
+	random := make([]byte, 100000)
+	cryptorand.Read(random) //nolint:errcheck
+
+	cases := []struct {
+		data []byte
+		want bool
+	}{
+		{make([]byte, 100000), true},
+		{makeCompressibleData(100000), true},
+		{random, false},
+		{random[0:1000], true}, // too short to sample
+	}
+
+	for i, tc := range cases {
+		got, err := worthCompressing(comp, &bytes.Buffer{}, tc.data)
+		if err != nil {
+			t.Fatalf("case %v: error: %v", i, err)
+		}
+
+		if got != tc.want {
+			t.Errorf("case %v: got %v, want %v", i, got, tc.want)
+		}
+	}
+}
+
 func makeCompressibleData(size int) []byte {
 	phrase := []byte("quick brown fox")
 	return append(append([]byte(nil), phrase[0:size%len(phrase)]...), bytes.Repeat(phrase, size/len(phrase))...)
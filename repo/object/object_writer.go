@@ -51,12 +51,24 @@ func (t *contentIDTracker) contentIDs() []content.ID {
 	return result
 }
 
+const (
+	// adaptive compression compresses this many samples of this size taken from each chunk.
+	compressionSampleSize  = 4 << 10
+	compressionSampleCount = 3
+
+	// chunks are compressed only if their samples compress to at most this percentage of their size.
+	maxSampleCompressionPercent = 90
+)
+
 type objectWriter struct {
 	ctx context.Context
 	om  *Manager
 
 	compressor compression.Compressor
 
+	// when set, chunks are compressed only if samples of them compress well.
+	adaptiveCompression bool
+
 	prefix      content.ID
 	buf         buf.Buf
 	buffer      *bytes.Buffer
@@ -68,6 +80,9 @@ type objectWriter struct {
 	description string
 
 	splitter splitter.Splitter
+
+	// remaining offsets at which the object is split in addition to the boundaries chosen by the splitter.
+	splitPoints []int64
 }
 
 func (w *objectWriter) initBuffer() {
@@ -94,7 +109,7 @@ func (w *objectWriter) Write(data []byte) (n int, err error) {
 			return 0, err
 		}
 
-		if w.splitter.ShouldSplit(d) {
+		if w.shouldSplit(d) {
 			if err := w.flushBuffer(); err != nil {
 				return 0, err
 			}
@@ -104,6 +119,32 @@ func (w *objectWriter) Write(data []byte) (n int, err error) {
 	return dataLen, nil
 }
 
+// shouldSplit determines whether the object should be split after the provided byte has been added to the buffer.
+// The object is split at boundaries chosen by the splitter and at split points, after which the splitter
+// starts from its initial state.
+func (w *objectWriter) shouldSplit(b byte) bool {
+	if w.splitter.ShouldSplit(b) {
+		w.skipSplitPoints()
+		return true
+	}
+
+	if len(w.splitPoints) == 0 || w.currentPosition+int64(w.buffer.Len()) < w.splitPoints[0] {
+		return false
+	}
+
+	w.skipSplitPoints()
+	w.splitter.Reset()
+
+	return true
+}
+
+// skipSplitPoints removes split points up to the end of the buffer.
+func (w *objectWriter) skipSplitPoints() {
+	for len(w.splitPoints) > 0 && w.splitPoints[0] <= w.currentPosition+int64(w.buffer.Len()) {
+		w.splitPoints = w.splitPoints[1:]
+	}
+}
+
 func (w *objectWriter) flushBuffer() error {
 	length := w.buffer.Len()
 	chunkID := len(w.indirectIndex)
@@ -117,7 +158,21 @@ func (w *objectWriter) flushBuffer() error {
 
 	compressedBuf := bytes.NewBuffer(b.Data[:0])
 
-	contentBytes, isCompressed, err := maybeCompressedContentBytes(w.compressor, compressedBuf, w.buffer.Bytes())
+	comp := w.compressor
+	if comp != nil && w.adaptiveCompression {
+		ok, err := worthCompressing(comp, compressedBuf, w.buffer.Bytes())
+		if err != nil {
+			return errors.Wrap(err, "unable to compress sample")
+		}
+
+		compressedBuf.Reset()
+
+		if !ok {
+			comp = nil
+		}
+	}
+
+	contentBytes, isCompressed, err := maybeCompressedContentBytes(comp, compressedBuf, w.buffer.Bytes())
 	if err != nil {
 		return errors.Wrap(err, "unable to prepare content bytes")
 	}
@@ -140,6 +195,27 @@ func (w *objectWriter) flushBuffer() error {
 	return nil
 }
 
+// worthCompressing returns true if samples taken from the beginning, middle and end of the data
+// compress well enough to justify compressing all of it.
+func worthCompressing(comp compression.Compressor, output *bytes.Buffer, data []byte) (bool, error) {
+	if len(data) <= compressionSampleSize*compressionSampleCount {
+		return true, nil
+	}
+
+	sample := make([]byte, 0, compressionSampleSize*compressionSampleCount)
+	step := (len(data) - compressionSampleSize) / (compressionSampleCount - 1)
+
+	for i := 0; i < compressionSampleCount; i++ {
+		sample = append(sample, data[i*step:i*step+compressionSampleSize]...)
+	}
+
+	if err := comp.Compress(output, sample); err != nil {
+		return false, errors.Wrap(err, "compression error")
+	}
+
+	return output.Len()*100 <= len(sample)*maxSampleCompressionPercent, nil
+}
+
 func maybeCompressedContentBytes(comp compression.Compressor, output *bytes.Buffer, input []byte) (data []byte, isCompressed bool, err error) {
 	if comp != nil {
 		if err := comp.Compress(output, input); err != nil {
@@ -200,4 +276,16 @@ type WriterOptions struct {
 	Description string
 	Prefix      content.ID // empty string or a single-character ('g'..'z')
 	Compressor  compression.Name
+
+	// Splitter overrides the splitter of the repository for this object, empty uses the repository splitter.
+	Splitter string
+
+	// AdaptiveCompression skips compression of chunks whose samples don't compress well,
+	// which saves CPU time on data that's already compressed.
+	AdaptiveCompression bool
+
+	// SplitPoints are increasing offsets at which the object is split in addition to the boundaries chosen
+	// by the splitter, such as the end of a previous version of the object that was appended to, which makes
+	// the last chunk of the previous version identical.
+	SplitPoints []int64
 }
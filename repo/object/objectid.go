@@ -14,6 +14,8 @@ import (
 // 1. In a single content block, this is the most common case for small objects.
 // 2. In a series of content blocks with an indirect block pointing at them (multiple indirections are allowed).
 //    This is used for larger files. Object IDs using indirect blocks start with "I"
+// 3. Inline in the object ID itself, which is used for very small files. Inline object IDs start with "E"
+//    followed by base-16 encoded data.
 type ID string
 
 // HasObjectID exposes the identifier of an object.
@@ -35,8 +37,32 @@ func (i ID) IndexObjectID() (ID, bool) {
 	return "", false
 }
 
+// InlineData returns the data of an object stored inline in its ID.
+func (i ID) InlineData() ([]byte, bool) {
+	if !strings.HasPrefix(string(i), "E") {
+		return nil, false
+	}
+
+	// only lowercase encoding is accepted, see InlineObjectID().
+	encoded := string(i[1:])
+	if strings.ToLower(encoded) != encoded {
+		return nil, false
+	}
+
+	data, err := hex.DecodeString(encoded)
+	if err != nil {
+		return nil, false
+	}
+
+	return data, true
+}
+
 // ContentID returns the ID of the underlying content.
 func (i ID) ContentID() (id content.ID, compressed, ok bool) {
+	if strings.HasPrefix(string(i), "E") {
+		return "", false, false
+	}
+
 	if strings.HasPrefix(string(i), "D") {
 		return content.ID(i[1:]), false, true
 	}
@@ -62,6 +88,14 @@ func (i ID) Validate() error {
 		return nil
 	}
 
+	if strings.HasPrefix(string(i), "E") {
+		if _, ok := i.InlineData(); !ok {
+			return errors.Errorf("invalid inline object ID, must be base-16 encoded: %v", i)
+		}
+
+		return nil
+	}
+
 	if contentID, _, ok := i.ContentID(); ok {
 		if len(contentID) <= 1 {
 			return errors.Errorf("missing content ID")
@@ -91,6 +125,12 @@ func DirectObjectID(contentID content.ID) ID {
 	return ID(contentID)
 }
 
+// InlineObjectID returns object ID storing the provided data inline.
+// Lowercase base-16 encoding is used, since String() strips all 'D' characters.
+func InlineObjectID(data []byte) ID {
+	return ID("E" + hex.EncodeToString(data))
+}
+
 // Compressed returns object ID with 'Z' prefix indicating it's compressed.
 func Compressed(objectID ID) ID {
 	return "Z" + objectID
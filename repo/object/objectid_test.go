@@ -33,6 +33,10 @@ func TestParseObjectID(t *testing.T) {
 		{"I1,", false},
 		{"I-1,X", false},
 		{"Xsomething", false},
+		{"E", true},
+		{"E0102ff", true},
+		{"E010", false},
+		{"E01D2", false},
 	}
 
 	for _, tc := range cases {
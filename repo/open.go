@@ -4,14 +4,22 @@ import (
 	"context"
 	"encoding/json"
 	"io/ioutil"
+	"os"
 	"path/filepath"
 	"time"
 
 	"github.com/pkg/errors"
 
 	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/blob/appendonly"
+	"github.com/kopia/kopia/repo/blob/chaos"
+	"github.com/kopia/kopia/repo/blob/filesystem"
+	"github.com/kopia/kopia/repo/blob/offline"
 	loggingwrapper "github.com/kopia/kopia/repo/blob/logging"
+	"github.com/kopia/kopia/repo/blob/replica"
+	"github.com/kopia/kopia/repo/blob/throttling"
 	"github.com/kopia/kopia/repo/content"
+	"github.com/kopia/kopia/repo/lock"
 	"github.com/kopia/kopia/repo/logging"
 	"github.com/kopia/kopia/repo/manifest"
 	"github.com/kopia/kopia/repo/object"
@@ -22,8 +30,17 @@ var log = logging.GetContextLoggerFunc("kopia/repo")
 // Options provides configuration parameters for connection to a repository.
 type Options struct {
 	TraceStorage         func(f string, args ...interface{}) // Logs all storage access using provided Printf-style function
+	StorageFaults        *chaos.Options                      // Injects faults into storage operations, for testing only
 	ObjectManagerOptions object.ManagerOptions
 	TimeNowFunc          func() time.Time // Time provider
+
+	// Offline opens the repository without accessing the storage, using only locally cached data
+	// and the local manifest mirror. Only cached contents can be read and nothing can be written.
+	Offline bool
+
+	// BandwidthLimiter limits the bandwidth of uploads to and downloads from the storage,
+	// its limits can be adjusted while the repository is open. Request limits of the connection are applied to it.
+	BandwidthLimiter *throttling.Limiter
 }
 
 // ErrInvalidPassword is returned when repository password is invalid.
@@ -51,13 +68,9 @@ func Open(ctx context.Context, configFile, password string, options *Options) (r
 		return nil, err
 	}
 
-	st, err := blob.NewStorage(ctx, lc.Storage)
+	st, err := openStorage(ctx, lc, options)
 	if err != nil {
-		return nil, errors.Wrap(err, "cannot open storage")
-	}
-
-	if options.TraceStorage != nil {
-		st = loggingwrapper.NewWrapper(st, options.TraceStorage, "[STORAGE] ")
+		return nil, err
 	}
 
 	r, err := OpenWithConfig(ctx, st, lc, password, options, lc.Caching)
@@ -66,26 +79,118 @@ func Open(ctx context.Context, configFile, password string, options *Options) (r
 		return nil, err
 	}
 
+	r.setConnectionInfo(ctx, configFile, lc)
+
+	return r, nil
+}
+
+func (r *Repository) setConnectionInfo(ctx context.Context, configFile string, lc *LocalConfig) {
 	r.Hostname = lc.Hostname
 	r.Username = lc.Username
 
 	if r.Hostname == "" {
-		r.Hostname = getDefaultHostName(ctx)
+		r.Hostname = GetDefaultHostName(ctx)
 	}
 
 	if r.Username == "" {
-		r.Username = getDefaultUserName(ctx)
+		r.Username = GetDefaultUserName(ctx)
 	}
 
 	r.ConfigFile = configFile
+}
 
-	return r, nil
+// openStorage opens the storage specified in the configuration, applying wrappers requested in the options.
+func openStorage(ctx context.Context, lc *LocalConfig, options *Options) (blob.Storage, error) {
+	if options.Offline {
+		// wrappers are not applied, since the storage is never accessed.
+		return offline.NewStorage(lc.Storage), nil
+	}
+
+	limiter := options.BandwidthLimiter
+	if limiter == nil && len(lc.RequestLimits) > 0 {
+		limiter = throttling.NewLimiter()
+	}
+
+	for class, l := range lc.RequestLimits {
+		if err := limiter.SetRequestLimit(class, l); err != nil {
+			return nil, errors.Wrap(err, "invalid request limits")
+		}
+	}
+
+	if lc.Caching.CacheDirectory != "" {
+		ctx = blob.WithLocalStateDirectory(ctx, filepath.Join(lc.Caching.CacheDirectory, "storage-state"))
+	}
+
+	st, err := blob.NewStorage(ctx, lc.Storage)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot open storage")
+	}
+
+	if limiter != nil {
+		// reads served from the local replica are not throttled.
+		st = throttling.NewWrapper(st, limiter)
+	}
+
+	if lc.LocalReplicaPath != "" {
+		st = withLocalReplica(ctx, st, lc.LocalReplicaPath)
+	}
+
+	if lc.AppendOnly {
+		st = appendonly.NewWrapper(st, []blob.ID{lock.BlobPrefix})
+	}
+
+	if options.StorageFaults != nil {
+		log(ctx).Warningf("injecting storage faults: %+v", *options.StorageFaults)
+		st = chaos.NewWrapper(st, *options.StorageFaults)
+	}
+
+	if options.TraceStorage != nil {
+		st = loggingwrapper.NewWrapper(st, options.TraceStorage, "[STORAGE] ")
+	}
+
+	return st, nil
+}
+
+// cachingHMACSecret returns the secret protecting integrity of locally cached data.
+func cachingHMACSecret(f *formatBlob, fo *content.FormattingOptions, masterKey []byte) []byte {
+	if fo.KeyPurposes != nil {
+		return fo.DeriveKey(fo.KeyPurposes.LocalCache, 16) //nolint:gomnd
+	}
+
+	return deriveKeyFromMasterKey(masterKey, f.UniqueID, []byte("local-cache-integrity"), 16) //nolint:gomnd
+}
+
+// manifestMirror returns the local mirror of manifests or nil if not enabled.
+func manifestMirror(caching content.CachingOptions) *manifest.Mirror {
+	if !caching.ManifestMirror || caching.CacheDirectory == "" {
+		return nil
+	}
+
+	return manifest.NewMirror(filepath.Join(caching.CacheDirectory, "manifests"), caching.HMACSecret)
+}
+
+// withLocalReplica returns storage wrapper reading pack blobs from the local replica at the provided path,
+// or the original storage if the replica is not available.
+func withLocalReplica(ctx context.Context, st blob.Storage, replicaPath string) blob.Storage {
+	if _, err := os.Stat(replicaPath); err != nil {
+		log(ctx).Warningf("local replica is not available: %v", err)
+		return st
+	}
+
+	rst, err := filesystem.New(ctx, &filesystem.Options{Path: replicaPath})
+	if err != nil {
+		log(ctx).Warningf("unable to open local replica: %v", err)
+		return st
+	}
+
+	// pack blobs are never modified once written, so they can be read from a replica that's out of date.
+	return replica.NewWrapper(st, rst, content.PackBlobIDPrefixes)
 }
 
 // OpenWithConfig opens the repository with a given configuration, avoiding the need for a config file.
 func OpenWithConfig(ctx context.Context, st blob.Storage, lc *LocalConfig, password string, options *Options, caching content.CachingOptions) (*Repository, error) {
 	// Read format blob, potentially from cache.
-	fb, err := readAndCacheFormatBlobBytes(ctx, st, caching.CacheDirectory)
+	fb, err := readAndCacheFormatBlobBytes(ctx, st, caching.CacheDirectory, time.Duration(caching.MaxFormatCacheDurationSec)*time.Second)
 	if err != nil {
 		return nil, errors.Wrap(err, "unable to read format blob")
 	}
@@ -110,10 +215,10 @@ func OpenWithConfig(ctx context.Context, st blob.Storage, lc *LocalConfig, passw
 		return nil, ErrInvalidPassword
 	}
 
-	caching.HMACSecret = deriveKeyFromMasterKey(masterKey, f.UniqueID, []byte("local-cache-integrity"), 16)
-
 	fo := &repoConfig.FormattingOptions
 
+	caching.HMACSecret = cachingHMACSecret(f, fo, masterKey)
+
 	if fo.MaxPackSize == 0 {
 		// legacy only, apply default
 		fo.MaxPackSize = 20 << 20 // nolint:gomnd
@@ -122,6 +227,7 @@ func OpenWithConfig(ctx context.Context, st blob.Storage, lc *LocalConfig, passw
 	cmOpts := content.ManagerOptions{
 		RepositoryFormatBytes: fb,
 		TimeNow:               defaultTime(options.TimeNowFunc),
+		AppendOnly:            lc.AppendOnly,
 	}
 
 	cm, err := content.NewManager(ctx, st, fo, caching, cmOpts)
@@ -134,9 +240,9 @@ func OpenWithConfig(ctx context.Context, st blob.Storage, lc *LocalConfig, passw
 		return nil, errors.Wrap(err, "unable to open object manager")
 	}
 
-	manifests, err := manifest.NewManager(ctx, cm, manifest.ManagerOptions{TimeNow: cmOpts.TimeNow})
+	manifests, err := openManifests(ctx, st, cm, caching, cmOpts.TimeNow, lc.AppendOnly)
 	if err != nil {
-		return nil, errors.Wrap(err, "unable to open manifests")
+		return nil, err
 	}
 
 	return &Repository{
@@ -149,9 +255,33 @@ func OpenWithConfig(ctx context.Context, st blob.Storage, lc *LocalConfig, passw
 		formatBlob: f,
 		masterKey:  masterKey,
 		timeNow:    cmOpts.TimeNow,
+		offline:    offline.IsOffline(st),
 	}, nil
 }
 
+func openManifests(ctx context.Context, st blob.Storage, cm *content.Manager, caching content.CachingOptions, timeNow func() time.Time, appendOnly bool) (*manifest.Manager, error) {
+	mirror := manifestMirror(caching)
+
+	if !offline.IsOffline(st) {
+		m, err := manifest.NewManager(ctx, cm, manifest.ManagerOptions{
+			TimeNow:    timeNow,
+			Mirror:     mirror,
+			AppendOnly: appendOnly,
+		})
+
+		return m, errors.Wrap(err, "unable to open manifests")
+	}
+
+	// manifests can't be loaded from the storage, so the mirror is required.
+	if mirror == nil {
+		return nil, errors.Errorf("manifest mirror is not enabled, reconnect with --manifest-mirror or use 'kopia cache set --manifest-mirror=true'")
+	}
+
+	m, err := manifest.NewManagerFromMirror(mirror)
+
+	return m, errors.Wrap(err, "unable to load manifest mirror")
+}
+
 // SetCachingConfig changes caching configuration for a given repository.
 func (r *Repository) SetCachingConfig(ctx context.Context, opt content.CachingOptions) error {
 	lc, err := loadConfigFromFile(r.ConfigFile)
@@ -175,18 +305,28 @@ func (r *Repository) SetCachingConfig(ctx context.Context, opt content.CachingOp
 	return nil
 }
 
-func readAndCacheFormatBlobBytes(ctx context.Context, st blob.Storage, cacheDirectory string) ([]byte, error) {
+func readAndCacheFormatBlobBytes(ctx context.Context, st blob.Storage, cacheDirectory string, maxCacheDuration time.Duration) ([]byte, error) {
 	cachedFile := filepath.Join(cacheDirectory, "kopia.repository")
 
 	if cacheDirectory != "" {
-		b, err := ioutil.ReadFile(cachedFile) //nolint:gosec
-		if err == nil {
-			// read from cache.
-			return b, nil
+		// when configured, cached copy is only used while fresh, so that format upgrades performed by other clients are noticed.
+		if st, err := os.Stat(cachedFile); err == nil && (maxCacheDuration == 0 || time.Since(st.ModTime()) < maxCacheDuration) { // allow:no-inject-time
+			b, err := ioutil.ReadFile(cachedFile) //nolint:gosec
+			if err == nil {
+				// read from cache.
+				return b, nil
+			}
 		}
 	}
 
 	b, err := st.GetBlob(ctx, FormatBlobID, 0, -1)
+	if errors.Is(err, offline.ErrOffline) && cacheDirectory != "" {
+		// the cached copy is used regardless of its age, since the storage can't be accessed.
+		if b, cerr := ioutil.ReadFile(cachedFile); cerr == nil { //nolint:gosec
+			return b, nil
+		}
+	}
+
 	if err != nil {
 		return nil, err
 	}
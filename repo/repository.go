@@ -6,6 +6,7 @@ import (
 
 	"github.com/pkg/errors"
 
+	"github.com/kopia/kopia/internal/clock"
 	"github.com/kopia/kopia/repo/blob"
 	"github.com/kopia/kopia/repo/content"
 	"github.com/kopia/kopia/repo/manifest"
@@ -28,6 +29,9 @@ type Repository struct {
 	timeNow    func() time.Time
 	formatBlob *formatBlob
 	masterKey  []byte
+
+	// offline is set for repositories opened using only locally cached data.
+	offline bool
 }
 
 // Close closes the repository and releases all resources.
@@ -60,8 +64,17 @@ func (r *Repository) Flush(ctx context.Context) error {
 	return r.Content.Flush(ctx)
 }
 
+// IsOffline returns true if the repository was opened using only locally cached data.
+func (r *Repository) IsOffline() bool {
+	return r.offline
+}
+
 // Refresh periodically makes external changes visible to repository.
 func (r *Repository) Refresh(ctx context.Context) error {
+	if r.offline {
+		return nil
+	}
+
 	updated, err := r.Content.Refresh(ctx)
 	if err != nil {
 		return errors.Wrap(err, "error refreshing content index")
@@ -107,5 +120,5 @@ func defaultTime(f func() time.Time) func() time.Time {
 		return f
 	}
 
-	return time.Now // allow:no-inject-time
+	return clock.Now
 }
@@ -169,11 +169,11 @@ func TestUpgrade(t *testing.T) {
 	ctx := testlogging.Context(t)
 	defer env.Setup(t).Close(ctx, t)
 
-	if err := env.Repository.Upgrade(ctx); err != nil {
+	if err := env.Repository.Upgrade(ctx, repo.UpgradeOptions{}); err != nil {
 		t.Errorf("upgrade error: %v", err)
 	}
 
-	if err := env.Repository.Upgrade(ctx); err != nil {
+	if err := env.Repository.Upgrade(ctx, repo.UpgradeOptions{}); err != nil {
 		t.Errorf("2nd upgrade error: %v", err)
 	}
 }
@@ -255,6 +255,9 @@ func TestFormats(t *testing.T) {
 			n.BlockFormat.Encryption = encryption
 			n.BlockFormat.HMACSecret = []byte("key")
 			n.ObjectFormat.Splitter = "FIXED-1M"
+
+			// known HMAC values require the secret to be used directly, not derived for each purpose.
+			n.BlockFormat.Version = 1
 		}
 	}
 
@@ -0,0 +1,34 @@
+package repo
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo/content"
+)
+
+// SetStorageClassPolicy updates the storage classes of blobs written to the repository.
+// The new policy takes effect when clients open the repository again, nil restores default classes.
+func (r *Repository) SetStorageClassPolicy(ctx context.Context, p *content.StorageClassPolicy) error {
+	f := r.formatBlob
+
+	repoConfig, err := f.decryptFormatBytes(r.masterKey)
+	if err != nil {
+		return errors.Wrap(err, "unable to decrypt repository config")
+	}
+
+	repoConfig.StorageClasses = p
+
+	if err := encryptFormatBytes(f, repoConfig, r.masterKey, f.UniqueID); err != nil {
+		return errors.Errorf("unable to encrypt format bytes")
+	}
+
+	if err := writeFormatBlob(ctx, r.Blobs, f); err != nil {
+		return errors.Wrap(err, "unable to write format blob")
+	}
+
+	r.invalidateCachedFormatBlob(ctx)
+
+	return nil
+}
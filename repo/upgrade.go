@@ -2,12 +2,80 @@ package repo
 
 import (
 	"context"
+	"os"
+	"path/filepath"
 
 	"github.com/pkg/errors"
 )
 
+// formatMigration describes a single step rolling the repository format forward by one version.
+type formatMigration struct {
+	// version is the repository format version after the migration has been applied.
+	version int
+
+	description string
+
+	// apply performs data changes required by the new version and updates the repository configuration in place.
+	// It must be safe to re-run if interrupted, since the version is only recorded after it succeeds.
+	apply func(ctx context.Context, r *Repository, cfg *repositoryObjectFormat) error
+}
+
+// initialFormatVersion is the format version of repositories created before any migration was introduced.
+const initialFormatVersion = 1
+
+// formatMigrations is the ordered list of format migrations, versions must be consecutive.
+//
+// Each migration must bump the version understood by the content manager, which causes clients
+// that don't know about the new version to refuse to open the repository instead of writing data
+// in the old format.
+var formatMigrations = []formatMigration{
+	{
+		// existing index blobs are treated as belonging to the first epoch, so no data needs to be rewritten.
+		version:     2,
+		description: "epoch-based index management",
+	},
+	{
+		// keys of existing repositories are not changed, only new repositories derive keys for each purpose.
+		version:     3,
+		description: "support for keys derived from the master key for each purpose",
+	},
+}
+
+// UpgradeOptions controls the behavior of Upgrade.
+type UpgradeOptions struct {
+	// DryRun only reports pending migrations without applying them.
+	DryRun bool
+}
+
+// latestFormatVersion returns the repository format version that repositories are upgraded to.
+func latestFormatVersion() int {
+	if len(formatMigrations) == 0 {
+		return initialFormatVersion
+	}
+
+	return formatMigrations[len(formatMigrations)-1].version
+}
+
+// pendingMigrations returns migrations that need to be applied to the repository at a given version.
+func pendingMigrations(current int) []formatMigration {
+	var result []formatMigration
+
+	for _, m := range formatMigrations {
+		if m.version > current {
+			result = append(result, m)
+		}
+	}
+
+	return result
+}
+
+// FormatVersion returns the current format version of the repository and the latest version supported by this build.
+func (r *Repository) FormatVersion() (current, latest int) {
+	return r.Content.Format.Version, latestFormatVersion()
+}
+
 // Upgrade upgrades repository data structures to the latest version.
-func (r *Repository) Upgrade(ctx context.Context) error {
+func (r *Repository) Upgrade(ctx context.Context, opt UpgradeOptions) error {
 	f := r.formatBlob
 
 	repoConfig, err := f.decryptFormatBytes(r.masterKey)
@@ -15,19 +83,62 @@ func (r *Repository) Upgrade(ctx context.Context) error {
 		return errors.Wrap(err, "unable to decrypt repository config")
 	}
 
-	var migrated bool
+	if repoConfig.Version > latestFormatVersion() {
+		return errors.Errorf("repository format version %v is newer than the latest version supported by this build (%v), please upgrade kopia", repoConfig.Version, latestFormatVersion())
+	}
 
-	// add migration code here
-	if !migrated {
-		log(ctx).Infof("nothing to do")
+	pending := pendingMigrations(repoConfig.Version)
+	if len(pending) == 0 {
+		log(ctx).Infof("repository format version %v is up-to-date, nothing to do", repoConfig.Version)
 		return nil
 	}
 
-	if err := encryptFormatBytes(f, repoConfig, r.masterKey, f.UniqueID); err != nil {
-		return errors.Errorf("unable to encrypt format bytes")
+	for _, m := range pending {
+		if m.version != repoConfig.Version+1 {
+			return errors.Errorf("invalid migration sequence, can't upgrade from version %v to %v", repoConfig.Version, m.version)
+		}
+
+		log(ctx).Infof("upgrading repository format from version %v to %v: %v", repoConfig.Version, m.version, m.description)
+
+		if opt.DryRun {
+			repoConfig.Version = m.version
+			continue
+		}
+
+		if m.apply != nil {
+			if err := m.apply(ctx, r, repoConfig); err != nil {
+				return errors.Wrapf(err, "unable to upgrade to version %v", m.version)
+			}
+		}
+
+		repoConfig.Version = m.version
+
+		// write the format blob after each step, so that interrupted upgrade can be resumed.
+		if err := encryptFormatBytes(f, repoConfig, r.masterKey, f.UniqueID); err != nil {
+			return errors.Errorf("unable to encrypt format bytes")
+		}
+
+		log(ctx).Infof("writing updated format content...")
+
+		if err := writeFormatBlob(ctx, r.Blobs, f); err != nil {
+			return errors.Wrap(err, "unable to write format blob")
+		}
+
+		r.invalidateCachedFormatBlob(ctx)
+	}
+
+	if opt.DryRun {
+		log(ctx).Infof("dry run, repository format not changed")
 	}
 
-	log(ctx).Infof("writing updated format content...")
+	return nil
+}
 
-	return writeFormatBlob(ctx, r.Blobs, f)
+// invalidateCachedFormatBlob removes the local copy of format blob, so that it's re-read on next open.
+func (r *Repository) invalidateCachedFormatBlob(ctx context.Context) {
+	if dir := r.Content.CachingOptions.CacheDirectory; dir != "" {
+		if err := os.Remove(filepath.Join(dir, FormatBlobID)); err != nil && !os.IsNotExist(err) {
+			log(ctx).Warningf("unable to remove cached format blob: %v", err)
+		}
+	}
 }
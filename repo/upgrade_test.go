@@ -0,0 +1,77 @@
+package repo
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/kopia/kopia/internal/testlogging"
+	"github.com/kopia/kopia/repo/blob/filesystem"
+	"github.com/kopia/kopia/repo/content"
+)
+
+func TestUpgradeMigrations(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	dir, err := ioutil.TempDir("", "upgrade")
+	assertNoError(t, err)
+
+	defer os.RemoveAll(dir)
+
+	// map storage does not support overwriting blobs, which is needed to update format blob.
+	st, err := filesystem.New(ctx, &filesystem.Options{Path: dir})
+	assertNoError(t, err)
+
+	assertNoError(t, Initialize(ctx, st, &NewRepositoryOptions{}, "password"))
+
+	r, err := OpenWithConfig(ctx, st, &LocalConfig{}, "password", &Options{}, content.CachingOptions{})
+	assertNoError(t, err)
+
+	defer func(old []formatMigration) { formatMigrations = old }(formatMigrations)
+
+	var applied int
+
+	formatMigrations = append(formatMigrations, formatMigration{
+		version:     latestFormatVersion() + 1,
+		description: "test migration",
+		apply: func(ctx context.Context, r *Repository, cfg *repositoryObjectFormat) error {
+			applied++
+			return nil
+		},
+	})
+
+	assertNoError(t, r.Upgrade(ctx, UpgradeOptions{DryRun: true}))
+
+	if applied != 0 {
+		t.Fatalf("migration applied during dry run")
+	}
+
+	assertNoError(t, r.Upgrade(ctx, UpgradeOptions{}))
+
+	if applied != 1 {
+		t.Fatalf("migration not applied")
+	}
+
+	// the migration is recorded, so the second upgrade is a no-op.
+	assertNoError(t, r.Upgrade(ctx, UpgradeOptions{}))
+
+	if applied != 1 {
+		t.Fatalf("migration applied twice")
+	}
+
+	// content manager in this build does not understand the new version, so it must refuse to open
+	// the repository, just like older clients would.
+	_, err = OpenWithConfig(ctx, st, &LocalConfig{}, "password", &Options{}, content.CachingOptions{})
+	if err == nil || !strings.Contains(err.Error(), "can't handle repositories created using version") {
+		t.Fatalf("unexpected error opening upgraded repository: %v", err)
+	}
+
+	// repository newer than the client can't be upgraded.
+	formatMigrations = formatMigrations[0 : len(formatMigrations)-1]
+
+	if err := r.Upgrade(ctx, UpgradeOptions{}); err == nil {
+		t.Fatalf("expected error upgrading repository newer than supported")
+	}
+}
@@ -0,0 +1,221 @@
+// Package bom builds bills of materials of snapshots - lists of all files with their sizes and SHA-256 hashes,
+// optionally signed, which are stored independently of the repository so that auditors can verify restored
+// files without trusting kopia or the repository.
+package bom
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/fs"
+	"github.com/kopia/kopia/repo/manifest"
+	"github.com/kopia/kopia/repo/object"
+	"github.com/kopia/kopia/snapshot"
+)
+
+// File describes a single file of the snapshot.
+type File struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// BOM is the bill of materials of a snapshot.
+type BOM struct {
+	Source       snapshot.SourceInfo `json:"source"`
+	SnapshotID   manifest.ID         `json:"snapshotID"`
+	StartTime    time.Time           `json:"startTime"`
+	RootObjectID object.ID           `json:"rootObjectID"`
+	CreatedTime  time.Time           `json:"created"`
+	Files        []*File             `json:"files"`
+
+	Signature *snapshot.Signature `json:"signature,omitempty"`
+}
+
+// Build reads all files of the snapshot with the provided root and returns its bill of materials.
+// Paths use forward slashes and are relative to the root, symbolic links are not included.
+func Build(ctx context.Context, man *snapshot.Manifest, root fs.Entry) (*BOM, error) {
+	b := &BOM{
+		Source:       man.Source,
+		SnapshotID:   man.ID,
+		StartTime:    man.StartTime,
+		RootObjectID: man.RootObjectID(),
+		CreatedTime:  time.Now(),
+		Files:        []*File{},
+	}
+
+	if err := b.addEntry(ctx, root, ""); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(b.Files, func(i, j int) bool {
+		return b.Files[i].Path < b.Files[j].Path
+	})
+
+	return b, nil
+}
+
+func (b *BOM) addEntry(ctx context.Context, e fs.Entry, p string) error {
+	switch e := e.(type) {
+	case fs.Directory:
+		entries, err := e.Readdir(ctx)
+		if err != nil {
+			return errors.Wrapf(err, "unable to read directory %q", p)
+		}
+
+		for _, c := range entries {
+			if err := b.addEntry(ctx, c, path.Join(p, c.Name())); err != nil {
+				return err
+			}
+		}
+
+	case fs.File:
+		if p == "" {
+			// snapshot of a single file.
+			p = e.Name()
+		}
+
+		r, err := e.Open(ctx)
+		if err != nil {
+			return errors.Wrapf(err, "unable to open %q", p)
+		}
+		defer r.Close() //nolint:errcheck
+
+		h, n, err := hashReader(r)
+		if err != nil {
+			return errors.Wrapf(err, "unable to read %q", p)
+		}
+
+		b.Files = append(b.Files, &File{Path: p, Size: n, SHA256: h})
+	}
+
+	return nil
+}
+
+func hashReader(r io.Reader) (string, int64, error) {
+	h := sha256.New()
+
+	n, err := io.Copy(h, r)
+	if err != nil {
+		return "", 0, err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), n, nil
+}
+
+// signedPayload returns the serialized bill of materials without its signature.
+func (b *BOM) signedPayload() ([]byte, error) {
+	unsigned := *b
+	unsigned.Signature = nil
+
+	data, err := json.Marshal(&unsigned)
+
+	return data, errors.Wrap(err, "unable to serialize bill of materials")
+}
+
+// Sign signs the bill of materials with the provided key, it must not be modified afterwards.
+func (b *BOM) Sign(key ed25519.PrivateKey) error {
+	payload, err := b.signedPayload()
+	if err != nil {
+		return err
+	}
+
+	b.Signature = snapshot.NewSignature(key, payload)
+
+	return nil
+}
+
+// VerifySignature returns nil if the bill of materials has a valid signature made with one of the trusted keys.
+func (b *BOM) VerifySignature(trustedKeys []ed25519.PublicKey) error {
+	payload, err := b.signedPayload()
+	if err != nil {
+		return err
+	}
+
+	return b.Signature.Verify(payload, trustedKeys)
+}
+
+// Kinds of differences between a bill of materials and a directory.
+const (
+	DifferenceMissing    = "missing"
+	DifferenceModified   = "modified"
+	DifferenceUnexpected = "unexpected"
+)
+
+// Difference describes a file of the directory that doesn't match the bill of materials.
+type Difference struct {
+	Path string `json:"path"`
+	Kind string `json:"kind"`
+}
+
+// VerifyDirectory compares files in the provided directory, such as the target of a restore,
+// with the bill of materials and returns the differences.
+func (b *BOM) VerifyDirectory(dir string) ([]*Difference, error) {
+	var diffs []*Difference
+
+	expected := map[string]bool{}
+
+	for _, f := range b.Files {
+		expected[f.Path] = true
+
+		same, err := fileMatches(filepath.Join(dir, filepath.FromSlash(f.Path)), f)
+
+		switch {
+		case os.IsNotExist(err):
+			diffs = append(diffs, &Difference{Path: f.Path, Kind: DifferenceMissing})
+		case err != nil:
+			return nil, err
+		case !same:
+			diffs = append(diffs, &Difference{Path: f.Path, Kind: DifferenceModified})
+		}
+	}
+
+	err := filepath.Walk(dir, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+
+		if rel = filepath.ToSlash(rel); !expected[rel] {
+			diffs = append(diffs, &Difference{Path: rel, Kind: DifferenceUnexpected})
+		}
+
+		return nil
+	})
+
+	return diffs, errors.Wrap(err, "unable to list directory")
+}
+
+func fileMatches(fname string, f *File) (bool, error) {
+	r, err := os.Open(fname) //nolint:gosec
+	if err != nil {
+		return false, err
+	}
+	defer r.Close() //nolint:errcheck
+
+	h, n, err := hashReader(r)
+	if err != nil {
+		return false, errors.Wrapf(err, "unable to read %v", fname)
+	}
+
+	return n == f.Size && h == f.SHA256, nil
+}
@@ -0,0 +1,112 @@
+package bom
+
+import (
+	"crypto/ed25519"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/mockfs"
+	"github.com/kopia/kopia/internal/testlogging"
+	"github.com/kopia/kopia/snapshot"
+)
+
+func TestBuildSignAndVerify(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	root := mockfs.NewDirectory()
+	root.AddFile("f1", []byte("hello"), 0644)
+	root.AddDir("d1", 0755)
+	root.AddFile("d1/f2", []byte("world"), 0600)
+
+	man := &snapshot.Manifest{ID: "some-id", Source: snapshot.SourceInfo{Host: "host", UserName: "user", Path: "/data"}}
+
+	b, err := Build(ctx, man, root)
+	if err != nil {
+		t.Fatalf("unable to build: %v", err)
+	}
+
+	want := []*File{
+		{Path: "d1/f2", Size: 5, SHA256: "486ea46224d1bb4fb680f34f7c9ad96a8f24ec88be73ea8e5a6c65260e9cb8a7"},
+		{Path: "f1", Size: 5, SHA256: "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"},
+	}
+
+	if !reflect.DeepEqual(b.Files, want) {
+		t.Errorf("unexpected files: %v", b.Files)
+	}
+
+	key, _, err := snapshot.GenerateSigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	trusted := []ed25519.PublicKey{key.Public().(ed25519.PublicKey)}
+
+	if err := b.VerifySignature(trusted); !errors.Is(err, snapshot.ErrNotSigned) {
+		t.Errorf("unexpected error verifying unsigned bill of materials: %v", err)
+	}
+
+	if err := b.Sign(key); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.VerifySignature(trusted); err != nil {
+		t.Errorf("unable to verify signature: %v", err)
+	}
+
+	b.Files[0].SHA256 = b.Files[1].SHA256
+
+	if err := b.VerifySignature(trusted); !errors.Is(err, snapshot.ErrInvalidSignature) {
+		t.Errorf("unexpected error verifying modified bill of materials: %v", err)
+	}
+}
+
+func TestVerifyDirectory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kopia-bom")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	for name, contents := range map[string]string{"f1": "hello", "d1/f2": "changed", "extra": "x"} {
+		fname := filepath.Join(dir, filepath.FromSlash(name))
+
+		if err := os.MkdirAll(filepath.Dir(fname), 0o700); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := ioutil.WriteFile(fname, []byte(contents), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	b := &BOM{Files: []*File{
+		{Path: "d1/f2", Size: 5, SHA256: "486ea46224d1bb4fb680f34f7c9ad96a8f24ec88be73ea8e5a6c65260e9cb8a7"},
+		{Path: "f1", Size: 5, SHA256: "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"},
+		{Path: "f3", Size: 1, SHA256: "00"},
+	}}
+
+	diffs, err := b.VerifyDirectory(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []*Difference{
+		{Path: "d1/f2", Kind: DifferenceModified},
+		{Path: "f3", Kind: DifferenceMissing},
+		{Path: "extra", Kind: DifferenceUnexpected},
+	}
+
+	if !reflect.DeepEqual(diffs, want) {
+		for _, d := range diffs {
+			t.Logf("difference: %v", *d)
+		}
+
+		t.Errorf("unexpected differences")
+	}
+}
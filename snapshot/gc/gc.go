@@ -3,12 +3,14 @@ package gc
 
 import (
 	"context"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/pkg/errors"
 
 	"github.com/kopia/kopia/fs"
+	"github.com/kopia/kopia/internal/clock"
 	"github.com/kopia/kopia/internal/stats"
 	"github.com/kopia/kopia/internal/units"
 	"github.com/kopia/kopia/repo"
@@ -26,17 +28,33 @@ func oidOf(entry fs.Entry) object.ID {
 	return entry.(object.HasObjectID).ObjectID()
 }
 
-func findInUseContentIDs(ctx context.Context, rep *repo.Repository, used *sync.Map) error {
+func loadAllSnapshots(ctx context.Context, rep *repo.Repository) ([]*snapshot.Manifest, error) {
 	ids, err := snapshot.ListSnapshotManifests(ctx, rep, nil)
 	if err != nil {
-		return errors.Wrap(err, "unable to list snapshot manifest IDs")
+		return nil, errors.Wrap(err, "unable to list snapshot manifest IDs")
 	}
 
 	manifests, err := snapshot.LoadSnapshots(ctx, rep, ids)
 	if err != nil {
-		return errors.Wrap(err, "unable to load manifest IDs")
+		return nil, errors.Wrap(err, "unable to load manifest IDs")
+	}
+
+	return manifests, nil
+}
+
+func findInUseContentIDs(ctx context.Context, rep *repo.Repository, used *sync.Map) error {
+	manifests, err := loadAllSnapshots(ctx, rep)
+	if err != nil {
+		return err
 	}
 
+	log(ctx).Infof("looking for active contents")
+
+	return findContentIDs(ctx, rep, manifests, used)
+}
+
+// findContentIDs stores IDs of all contents referenced by the provided snapshots.
+func findContentIDs(ctx context.Context, rep *repo.Repository, manifests []*snapshot.Manifest, used *sync.Map) error {
 	w := snapshotfs.NewTreeWalker()
 	w.EntryID = func(e fs.Entry) interface{} { return oidOf(e) }
 
@@ -50,22 +68,31 @@ func findInUseContentIDs(ctx context.Context, rep *repo.Repository, used *sync.M
 	}
 
 	w.ObjectCallback = func(entry fs.Entry) error {
-		oid := oidOf(entry)
-		contentIDs, err := rep.Objects.VerifyObject(ctx, oid)
+		oids := []object.ID{oidOf(entry)}
 
-		if err != nil {
-			return errors.Wrapf(err, "error verifying %v", oid)
+		// pages of large directories are stored in separate objects.
+		if dir, ok := entry.(fs.Directory); ok {
+			var err error
+
+			if oids, err = snapshotfs.DirectoryObjectIDs(ctx, dir); err != nil {
+				return err
+			}
 		}
 
-		for _, cid := range contentIDs {
-			used.Store(cid, nil)
+		for _, oid := range oids {
+			contentIDs, err := rep.Objects.VerifyObject(ctx, oid)
+			if err != nil {
+				return errors.Wrapf(err, "error verifying %v", oid)
+			}
+
+			for _, cid := range contentIDs {
+				used.Store(cid, nil)
+			}
 		}
 
 		return nil
 	}
 
-	log(ctx).Infof("looking for active contents")
-
 	if err := w.Run(ctx); err != nil {
 		return errors.Wrap(err, "error walking snapshot tree")
 	}
@@ -74,14 +101,35 @@ func findInUseContentIDs(ctx context.Context, rep *repo.Repository, used *sync.M
 }
 
 // Run performs garbage collection on all the snapshots in the repository.
-// nolint:gocognit
 func Run(ctx context.Context, rep *repo.Repository, minContentAge time.Duration, gcDelete bool) (Stats, error) {
+	st, _, err := RunWithPlan(ctx, rep, minContentAge, gcDelete, nil)
+	return st, err
+}
+
+// RunWithPlan performs garbage collection like Run and, if plan options are provided, estimates its plan
+// before deleting any contents. Nothing is deleted if the plan exceeds the limits in the options.
+// nolint:gocognit
+func RunWithPlan(ctx context.Context, rep *repo.Repository, minContentAge time.Duration, gcDelete bool, popt *PlanOptions) (Stats, *Plan, error) {
 	var used sync.Map
 
 	var st Stats
 
 	if err := findInUseContentIDs(ctx, rep, &used); err != nil {
-		return st, errors.Wrap(err, "unable to find in-use content ID")
+		return st, nil, errors.Wrap(err, "unable to find in-use content ID")
+	}
+
+	var plan *Plan
+
+	if popt != nil {
+		var err error
+
+		if plan, err = computePlan(ctx, rep, &used, minContentAge, *popt); err != nil {
+			return st, nil, err
+		}
+
+		if len(plan.Violations) > 0 && gcDelete {
+			return st, plan, errors.Wrap(ErrPlanLimitsExceeded, strings.Join(plan.Violations, ", "))
+		}
 	}
 
 	var unused, inUse, system, tooRecent stats.CountSum
@@ -99,7 +147,7 @@ func Run(ctx context.Context, rep *repo.Repository, minContentAge time.Duration,
 			return nil
 		}
 
-		if rep.Time().Sub(ci.Timestamp()) < minContentAge {
+		if !clock.OlderThan(rep.Time(), ci.Timestamp(), minContentAge) {
 			log(ctx).Debugf("recent unreferenced content %v (%v bytes, modified %v)", ci.ID, ci.Length, ci.Timestamp())
 			tooRecent.Add(int64(ci.Length))
 			return nil
@@ -132,12 +180,12 @@ func Run(ctx context.Context, rep *repo.Repository, minContentAge time.Duration,
 	st.TooRecentCount, st.TooRecentBytes = tooRecent.Approximate()
 
 	if err != nil {
-		return st, errors.Wrap(err, "error iterating contents")
+		return st, plan, errors.Wrap(err, "error iterating contents")
 	}
 
 	if st.UnusedCount > 0 && !gcDelete {
-		return st, errors.Errorf("Not deleting because '--delete' flag was not set")
+		return st, plan, errors.Errorf("Not deleting because '--delete' flag was not set")
 	}
 
-	return st, nil
+	return st, plan, nil
 }
@@ -0,0 +1,204 @@
+package gc
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/clock"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/content"
+	"github.com/kopia/kopia/repo/manifest"
+)
+
+// ErrPlanLimitsExceeded is returned when GC is aborted because its plan exceeds the provided limits.
+var ErrPlanLimitsExceeded = errors.New("GC plan exceeds limits")
+
+const bytesPerGB = 1e9
+
+// Pricing describes the prices charged by the storage provider in arbitrary currency.
+type Pricing struct {
+	PutPerThousand    float64 `json:"putPerThousand"`
+	GetPerThousand    float64 `json:"getPerThousand"`
+	DeletePerThousand float64 `json:"deletePerThousand"`
+	EgressPerGB       float64 `json:"egressPerGB"`
+	StoragePerGBMonth float64 `json:"storagePerGBMonth"`
+}
+
+// PlanLimits are the limits of the plan above which GC is aborted, zero means unlimited.
+type PlanLimits struct {
+	MaxDeleteRequests int     `json:"maxDeleteRequests,omitempty"`
+	MaxRewrittenPacks int     `json:"maxRewrittenPacks,omitempty"`
+	MaxEgressBytes    int64   `json:"maxEgressBytes,omitempty"`
+	MaxCost           float64 `json:"maxCost,omitempty"`
+}
+
+// PlanOptions describes how to estimate the plan.
+type PlanOptions struct {
+	// RewriteThresholdPercent is the minimum percentage of unused data in a pack for its remaining contents
+	// to be rewritten, so that the pack can be deleted.
+	RewriteThresholdPercent int
+
+	Pricing Pricing
+	Limits  PlanLimits
+}
+
+// Plan estimates the work, storage requests and costs of reclaiming space of unused contents,
+// which are deleted by GC, after which their packs are deleted or rewritten by later maintenance.
+type Plan struct {
+	UnusedContents int   `json:"unusedContents"`
+	UnusedBytes    int64 `json:"unusedBytes"`
+
+	// packs containing only unused contents, which are deleted.
+	DeletedPacks     int   `json:"deletedPacks"`
+	DeletedPackBytes int64 `json:"deletedPackBytes"`
+
+	// packs with enough unused data to rewrite their remaining contents to new packs.
+	RewrittenPacks     int   `json:"rewrittenPacks"`
+	RewrittenPackBytes int64 `json:"rewrittenPackBytes"`
+	RewrittenContents  int   `json:"rewrittenContents"`
+	RewrittenBytes     int64 `json:"rewrittenBytes"`
+
+	// unused data in packs that are not rewritten.
+	RetainedUnusedBytes int64 `json:"retainedUnusedBytes"`
+
+	ReclaimedBytes int64 `json:"reclaimedBytes"`
+
+	DeleteRequests int   `json:"deleteRequests"`
+	GetRequests    int   `json:"getRequests"`
+	PutRequests    int   `json:"putRequests"`
+	EgressBytes    int64 `json:"egressBytes"`
+
+	EstimatedCost           float64 `json:"estimatedCost"`
+	EstimatedMonthlySavings float64 `json:"estimatedMonthlySavings"`
+
+	// Violations lists the limits exceeded by the plan.
+	Violations []string `json:"violations,omitempty"`
+}
+
+type packUsage struct {
+	contentBytes int64
+	liveBytes    int64
+	liveCount    int
+	unusedBytes  int64
+}
+
+// computePlan estimates the plan of deleting unused contents that are older than minContentAge.
+func computePlan(ctx context.Context, rep *repo.Repository, used *sync.Map, minContentAge time.Duration, opt PlanOptions) (*Plan, error) {
+	p := &Plan{}
+	packs := map[blob.ID]*packUsage{}
+
+	log(ctx).Infof("estimating GC plan")
+
+	if err := rep.Content.IterateContents(ctx, content.IterateOptions{IncludeDeleted: true}, func(ci content.Info) error {
+		pu := packs[ci.PackBlobID]
+		if pu == nil {
+			pu = &packUsage{}
+			packs[ci.PackBlobID] = pu
+		}
+
+		pu.contentBytes += int64(ci.Length)
+
+		_, inUse := used.Load(ci.ID)
+
+		switch {
+		case ci.Deleted:
+			pu.unusedBytes += int64(ci.Length)
+
+		case inUse || manifest.ContentPrefix == ci.ID.Prefix() || !clock.OlderThan(rep.Time(), ci.Timestamp(), minContentAge):
+			pu.liveBytes += int64(ci.Length)
+			pu.liveCount++
+
+		default:
+			pu.unusedBytes += int64(ci.Length)
+			p.UnusedContents++
+			p.UnusedBytes += int64(ci.Length)
+		}
+
+		return nil
+	}); err != nil {
+		return nil, errors.Wrap(err, "error iterating contents")
+	}
+
+	packSizes := map[blob.ID]int64{}
+
+	for _, prefix := range content.PackBlobIDPrefixes {
+		if err := rep.Blobs.ListBlobs(ctx, prefix, func(m blob.Metadata) error {
+			packSizes[m.BlobID] = m.Length
+			return nil
+		}); err != nil {
+			return nil, errors.Wrap(err, "error listing packs")
+		}
+	}
+
+	for packID, pu := range packs {
+		if pu.unusedBytes == 0 {
+			continue
+		}
+
+		size, ok := packSizes[packID]
+		if !ok {
+			size = pu.contentBytes
+		}
+
+		switch {
+		case pu.liveBytes == 0:
+			p.DeletedPacks++
+			p.DeletedPackBytes += size
+
+		case pu.unusedBytes*100 >= pu.contentBytes*int64(opt.RewriteThresholdPercent): //nolint:gomnd
+			p.RewrittenPacks++
+			p.RewrittenPackBytes += size
+			p.RewrittenContents += pu.liveCount
+			p.RewrittenBytes += pu.liveBytes
+
+		default:
+			p.RetainedUnusedBytes += pu.unusedBytes
+		}
+	}
+
+	p.ReclaimedBytes = p.DeletedPackBytes + p.RewrittenPackBytes - p.RewrittenBytes
+
+	// rewritten contents are read individually and written to packs of maximum size.
+	p.DeleteRequests = p.DeletedPacks + p.RewrittenPacks
+	p.GetRequests = p.RewrittenContents
+	p.PutRequests = int((p.RewrittenBytes + int64(rep.Content.Format.MaxPackSize) - 1) / int64(rep.Content.Format.MaxPackSize))
+	p.EgressBytes = p.RewrittenBytes
+
+	pr := opt.Pricing
+	p.EstimatedCost = float64(p.DeleteRequests)/1000*pr.DeletePerThousand + //nolint:gomnd
+		float64(p.GetRequests)/1000*pr.GetPerThousand + //nolint:gomnd
+		float64(p.PutRequests)/1000*pr.PutPerThousand + //nolint:gomnd
+		float64(p.EgressBytes)/bytesPerGB*pr.EgressPerGB
+	p.EstimatedMonthlySavings = float64(p.ReclaimedBytes) / bytesPerGB * pr.StoragePerGBMonth
+
+	p.Violations = opt.Limits.violations(p)
+
+	return p, nil
+}
+
+func (l PlanLimits) violations(p *Plan) []string {
+	var result []string
+
+	if l.MaxDeleteRequests > 0 && p.DeleteRequests > l.MaxDeleteRequests {
+		result = append(result, fmt.Sprintf("%v delete requests exceed the limit of %v", p.DeleteRequests, l.MaxDeleteRequests))
+	}
+
+	if l.MaxRewrittenPacks > 0 && p.RewrittenPacks > l.MaxRewrittenPacks {
+		result = append(result, fmt.Sprintf("%v pack rewrites exceed the limit of %v", p.RewrittenPacks, l.MaxRewrittenPacks))
+	}
+
+	if l.MaxEgressBytes > 0 && p.EgressBytes > l.MaxEgressBytes {
+		result = append(result, fmt.Sprintf("%v bytes of egress exceed the limit of %v", p.EgressBytes, l.MaxEgressBytes))
+	}
+
+	if l.MaxCost > 0 && p.EstimatedCost > l.MaxCost {
+		result = append(result, fmt.Sprintf("estimated cost of %.2f exceeds the limit of %.2f", p.EstimatedCost, l.MaxCost))
+	}
+
+	return result
+}
@@ -0,0 +1,79 @@
+package gc
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/stats"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/content"
+	"github.com/kopia/kopia/repo/manifest"
+	"github.com/kopia/kopia/snapshot"
+)
+
+// ReclaimEstimate describes contents referenced only by snapshots about to be deleted.
+type ReclaimEstimate struct {
+	Bytes int64
+	Count uint32
+}
+
+// EstimateReclaimed returns the contents referenced by the provided snapshots and by no other snapshot,
+// which garbage collection deletes once the snapshots have been deleted. Space of deleted contents in
+// packs that also contain contents in use is only released when the packs are rewritten.
+func EstimateReclaimed(ctx context.Context, rep *repo.Repository, deleted []*snapshot.Manifest) (ReclaimEstimate, error) {
+	var est ReclaimEstimate
+
+	all, err := loadAllSnapshots(ctx, rep)
+	if err != nil {
+		return est, err
+	}
+
+	deletedIDs := map[manifest.ID]bool{}
+	for _, m := range deleted {
+		deletedIDs[m.ID] = true
+	}
+
+	var remaining []*snapshot.Manifest
+
+	for _, m := range all {
+		if !deletedIDs[m.ID] {
+			remaining = append(remaining, m)
+		}
+	}
+
+	var used, candidates sync.Map
+
+	if err := findContentIDs(ctx, rep, remaining, &used); err != nil {
+		return est, errors.Wrap(err, "unable to find contents of remaining snapshots")
+	}
+
+	if err := findContentIDs(ctx, rep, deleted, &candidates); err != nil {
+		return est, errors.Wrap(err, "unable to find contents of deleted snapshots")
+	}
+
+	var reclaimed stats.CountSum
+
+	candidates.Range(func(k, _ interface{}) bool {
+		cid := k.(content.ID)
+
+		if _, ok := used.Load(cid); ok {
+			return true
+		}
+
+		ci, cerr := rep.Content.ContentInfo(ctx, cid)
+		if cerr != nil {
+			err = errors.Wrapf(cerr, "unable to get content info for %v", cid)
+			return false
+		}
+
+		reclaimed.Add(int64(ci.Length))
+
+		return true
+	})
+
+	est.Count, est.Bytes = reclaimed.Approximate()
+
+	return est, err
+}
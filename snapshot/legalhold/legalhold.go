@@ -0,0 +1,270 @@
+// Package legalhold exports subtrees of snapshots as ZIP archives for legal holds and e-discovery,
+// along with a machine-readable chain-of-custody report describing what was exported, by whom and when,
+// the hashes of all files and the results of verifying the written archive.
+package legalhold
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/fs"
+	"github.com/kopia/kopia/repo/manifest"
+	"github.com/kopia/kopia/repo/object"
+	"github.com/kopia/kopia/snapshot"
+	"github.com/kopia/kopia/snapshot/bom"
+	"github.com/kopia/kopia/snapshot/snapshotfs"
+)
+
+// Options describes the export.
+type Options struct {
+	// Case identifies the legal matter the export was made for.
+	Case string
+
+	// Operator identifies the person making the export.
+	Operator string
+
+	// Host is the name of the machine making the export.
+	Host string
+
+	// SigningKey signs the report if set.
+	SigningKey ed25519.PrivateKey
+}
+
+// Event is an entry of the chain-of-custody log.
+type Event struct {
+	Time    time.Time `json:"time"`
+	Action  string    `json:"action"`
+	Details string    `json:"details,omitempty"`
+}
+
+// Archive describes the written archive.
+type Archive struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Verification describes the result of comparing files in the written archive with the snapshot.
+type Verification struct {
+	Verified      bool     `json:"verified"`
+	FilesVerified int      `json:"filesVerified"`
+	Errors        []string `json:"errors,omitempty"`
+}
+
+// Report is the chain-of-custody report of an export.
+type Report struct {
+	Case     string `json:"case,omitempty"`
+	Operator string `json:"operator"`
+	Host     string `json:"host,omitempty"`
+
+	SnapshotID   manifest.ID         `json:"snapshotID"`
+	Source       snapshot.SourceInfo `json:"source"`
+	SnapshotTime time.Time           `json:"snapshotTime"`
+	RootObjectID object.ID           `json:"rootObjectID"`
+	Path         string              `json:"path"`
+	ObjectID     object.ID           `json:"objectID,omitempty"`
+
+	StartTime time.Time `json:"startTime"`
+	EndTime   time.Time `json:"endTime"`
+
+	Archive      Archive       `json:"archive"`
+	Files        []*bom.File   `json:"files"`
+	Verification *Verification `json:"verification"`
+	Events       []*Event      `json:"events"`
+
+	Signature *snapshot.Signature `json:"signature,omitempty"`
+}
+
+func (r *Report) log(action, format string, args ...interface{}) {
+	r.Events = append(r.Events, &Event{Time: time.Now(), Action: action, Details: fmt.Sprintf(format, args...)})
+}
+
+// Export writes the directory at the provided path within the snapshot to a new ZIP archive
+// and returns the chain-of-custody report, which is signed if a signing key is provided.
+// The export fails if the archive can't be written, files that don't match the snapshot are
+// reported in the verification results.
+func Export(ctx context.Context, man *snapshot.Manifest, p string, dir fs.Directory, archiveFile string, opt Options) (*Report, error) {
+	r := &Report{
+		Case:         opt.Case,
+		Operator:     opt.Operator,
+		Host:         opt.Host,
+		SnapshotID:   man.ID,
+		Source:       man.Source,
+		SnapshotTime: man.StartTime,
+		RootObjectID: man.RootObjectID(),
+		Path:         p,
+		StartTime:    time.Now(),
+	}
+
+	if h, ok := dir.(object.HasObjectID); ok {
+		r.ObjectID = h.ObjectID()
+	}
+
+	r.log("export-started", "exporting %q of snapshot %v of %v", p, man.ID, man.Source)
+
+	b, err := bom.Build(ctx, man, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	r.Files = b.Files
+	r.log("files-hashed", "%v files", len(r.Files))
+
+	if r.Archive, err = writeArchive(ctx, dir, archiveFile); err != nil {
+		return nil, err
+	}
+
+	r.log("archive-written", "%v (%v bytes, sha256 %v)", r.Archive.Name, r.Archive.Size, r.Archive.SHA256)
+
+	r.Verification = verifyArchive(archiveFile, r.Files)
+	r.log("archive-verified", "%v files verified, %v errors", r.Verification.FilesVerified, len(r.Verification.Errors))
+
+	r.EndTime = time.Now()
+
+	if opt.SigningKey != nil {
+		if err := r.Sign(opt.SigningKey); err != nil {
+			return nil, err
+		}
+	}
+
+	return r, nil
+}
+
+func writeArchive(ctx context.Context, dir fs.Directory, archiveFile string) (Archive, error) {
+	a := Archive{Name: filepath.Base(archiveFile)}
+
+	f, err := os.OpenFile(archiveFile, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600) //nolint:gosec
+	if err != nil {
+		return a, errors.Wrap(err, "unable to create archive")
+	}
+
+	h := sha256.New()
+	cw := &countingWriter{w: io.MultiWriter(f, h)}
+
+	if err := snapshotfs.RestoreZip(ctx, cw, dir); err != nil {
+		f.Close() //nolint:errcheck
+		return a, errors.Wrap(err, "unable to write archive")
+	}
+
+	if err := f.Close(); err != nil {
+		return a, errors.Wrap(err, "unable to close archive")
+	}
+
+	a.Size = cw.n
+	a.SHA256 = hex.EncodeToString(h.Sum(nil))
+
+	return a, nil
+}
+
+// verifyArchive compares the contents of files in the archive with their hashes.
+func verifyArchive(archiveFile string, files []*bom.File) *Verification {
+	v := &Verification{}
+
+	zr, err := zip.OpenReader(archiveFile)
+	if err != nil {
+		v.Errors = append(v.Errors, errors.Wrap(err, "unable to open archive").Error())
+		return v
+	}
+	defer zr.Close() //nolint:errcheck
+
+	archived := map[string]*zip.File{}
+
+	for _, f := range zr.File {
+		archived[f.Name] = f
+	}
+
+	for _, want := range files {
+		f := archived[want.Path]
+		if f == nil {
+			v.Errors = append(v.Errors, fmt.Sprintf("%v: missing from archive", want.Path))
+			continue
+		}
+
+		if err := verifyArchivedFile(f, want); err != nil {
+			v.Errors = append(v.Errors, fmt.Sprintf("%v: %v", want.Path, err))
+			continue
+		}
+
+		v.FilesVerified++
+	}
+
+	v.Verified = len(v.Errors) == 0
+
+	return v
+}
+
+func verifyArchivedFile(f *zip.File, want *bom.File) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close() //nolint:errcheck
+
+	h := sha256.New()
+
+	n, err := io.Copy(h, rc)
+	if err != nil {
+		return err
+	}
+
+	if n != want.Size || hex.EncodeToString(h.Sum(nil)) != want.SHA256 {
+		return errors.New("contents don't match the snapshot")
+	}
+
+	return nil
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+
+	return n, err
+}
+
+// signedPayload returns the serialized report without its signature.
+func (r *Report) signedPayload() ([]byte, error) {
+	unsigned := *r
+	unsigned.Signature = nil
+
+	data, err := json.Marshal(&unsigned)
+
+	return data, errors.Wrap(err, "unable to serialize report")
+}
+
+// Sign signs the report with the provided key, it must not be modified afterwards.
+func (r *Report) Sign(key ed25519.PrivateKey) error {
+	payload, err := r.signedPayload()
+	if err != nil {
+		return err
+	}
+
+	r.Signature = snapshot.NewSignature(key, payload)
+
+	return nil
+}
+
+// VerifySignature returns nil if the report has a valid signature made with one of the trusted keys.
+func (r *Report) VerifySignature(trustedKeys []ed25519.PublicKey) error {
+	payload, err := r.signedPayload()
+	if err != nil {
+		return err
+	}
+
+	return r.Signature.Verify(payload, trustedKeys)
+}
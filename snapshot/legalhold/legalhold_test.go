@@ -0,0 +1,82 @@
+package legalhold
+
+import (
+	"crypto/ed25519"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kopia/kopia/internal/mockfs"
+	"github.com/kopia/kopia/internal/testlogging"
+	"github.com/kopia/kopia/snapshot"
+)
+
+func TestExport(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	dir, err := ioutil.TempDir("", "kopia-legalhold")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	root := mockfs.NewDirectory()
+	root.AddFile("f1", []byte("hello"), 0644)
+	root.AddDir("d1", 0755)
+	root.AddFile("d1/f2", []byte("world"), 0600)
+
+	key, _, err := snapshot.GenerateSigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	man := &snapshot.Manifest{ID: "some-id", Source: snapshot.SourceInfo{Host: "host", UserName: "user", Path: "/data"}}
+	archiveFile := filepath.Join(dir, "export.zip")
+
+	r, err := Export(ctx, man, "/", root, archiveFile, Options{Case: "case-1", Operator: "alice", SigningKey: key})
+	if err != nil {
+		t.Fatalf("unable to export: %v", err)
+	}
+
+	if !r.Verification.Verified || r.Verification.FilesVerified != 2 {
+		t.Errorf("unexpected verification: %+v", r.Verification)
+	}
+
+	st, err := os.Stat(archiveFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r.Archive.Size != st.Size() || r.Archive.Name != "export.zip" {
+		t.Errorf("unexpected archive: %+v, size %v", r.Archive, st.Size())
+	}
+
+	if got, want := len(r.Events), 4; got != want {
+		t.Errorf("unexpected number of events: %v, want %v", got, want)
+	}
+
+	trusted := []ed25519.PublicKey{key.Public().(ed25519.PublicKey)}
+
+	if err := r.VerifySignature(trusted); err != nil {
+		t.Errorf("unable to verify signature: %v", err)
+	}
+
+	r.Operator = "bob"
+
+	if err := r.VerifySignature(trusted); err == nil {
+		t.Errorf("signature of modified report was verified")
+	}
+
+	if _, err := Export(ctx, man, "/", root, archiveFile, Options{}); err == nil {
+		t.Errorf("existing archive was overwritten")
+	}
+
+	// files changed after hashing are reported.
+	r.Files[0].SHA256 = r.Files[1].SHA256
+
+	if v := verifyArchive(archiveFile, r.Files); v.Verified || len(v.Errors) != 1 {
+		t.Errorf("unexpected verification of modified file list: %+v", v)
+	}
+}
@@ -3,6 +3,7 @@ package snapshot
 
 import (
 	"context"
+	"time"
 
 	"github.com/pkg/errors"
 
@@ -76,6 +77,10 @@ func LoadSnapshot(ctx context.Context, rep *repo.Repository, manifestID manifest
 
 	sm.ID = manifestID
 
+	if sm.IsNewerSchema() {
+		log(ctx).Debugf("snapshot manifest %v was written by a newer version of kopia (schema version %v)", manifestID, sm.SchemaVersion)
+	}
+
 	return sm, nil
 }
 
@@ -103,6 +108,24 @@ func SaveSnapshot(ctx context.Context, rep *repo.Repository, man *Manifest) (man
 	return id, nil
 }
 
+// UpdateSnapshot replaces the manifest of an existing snapshot with the provided one, which gets a new ID.
+func UpdateSnapshot(ctx context.Context, rep *repo.Repository, man *Manifest) (manifest.ID, error) {
+	oldID := man.ID
+
+	id, err := SaveSnapshot(ctx, rep, man)
+	if err != nil {
+		return "", err
+	}
+
+	if oldID != "" {
+		if err := rep.Manifests.Delete(ctx, oldID); err != nil {
+			return "", errors.Wrapf(err, "unable to delete previous manifest %v", oldID)
+		}
+	}
+
+	return id, nil
+}
+
 // LoadSnapshots efficiently loads and parses a given list of snapshot IDs.
 func LoadSnapshots(ctx context.Context, rep *repo.Repository, manifestIDs []manifest.ID) ([]*Manifest, error) {
 	result := make([]*Manifest, len(manifestIDs))
@@ -166,3 +189,47 @@ func entryIDs(entries []*manifest.EntryMetadata) []manifest.ID {
 
 	return ids
 }
+
+// FindPreviousManifests returns the list of previous snapshots for a given source, including
+// last complete snapshot and possibly some number of incomplete snapshots following it.
+func FindPreviousManifests(ctx context.Context, rep *repo.Repository, sourceInfo SourceInfo, noLaterThan *time.Time) ([]*Manifest, error) {
+	man, err := ListSnapshots(ctx, rep, sourceInfo)
+	if err != nil {
+		return nil, errors.Wrap(err, "error listing previous snapshots")
+	}
+
+	// phase 1 - find latest complete snapshot.
+	var previousComplete *Manifest
+
+	var previousCompleteStartTime time.Time
+
+	var result []*Manifest
+
+	for _, p := range man {
+		if noLaterThan != nil && p.StartTime.After(*noLaterThan) {
+			continue
+		}
+
+		if p.IncompleteReason == "" && (previousComplete == nil || p.StartTime.After(previousComplete.StartTime)) {
+			previousComplete = p
+			previousCompleteStartTime = p.StartTime
+		}
+	}
+
+	if previousComplete != nil {
+		result = append(result, previousComplete)
+	}
+
+	// add all incomplete snapshots after that
+	for _, p := range man {
+		if noLaterThan != nil && p.StartTime.After(*noLaterThan) {
+			continue
+		}
+
+		if p.IncompleteReason != "" && p.StartTime.After(previousCompleteStartTime) {
+			result = append(result, p)
+		}
+	}
+
+	return result, nil
+}
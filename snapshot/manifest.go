@@ -2,6 +2,7 @@ package snapshot
 
 import (
 	"encoding/json"
+	"fmt"
 	"sort"
 	"strconv"
 	"time"
@@ -16,18 +17,106 @@ type Manifest struct {
 	ID     manifest.ID `json:"-"`
 	Source SourceInfo  `json:"source"`
 
+	// SchemaVersion is the version of the format of the manifest, zero for manifests written before versioning.
+	SchemaVersion int `json:"schemaVersion,omitempty"`
+
 	Description string    `json:"description"`
 	StartTime   time.Time `json:"startTime"`
 	EndTime     time.Time `json:"endTime"`
 
+	// labels attached by the client that created the snapshot, such as labels of a Kubernetes volume.
+	Tags map[string]string `json:"tags,omitempty"`
+
+	// structured data emitted by the hook run before the snapshot, such as the position in the database log.
+	HookOutput json.RawMessage `json:"hookOutput,omitempty"`
+
+	// notes and annotations added by operators after the snapshot was created, which are not signed.
+	Notes       []*Note           `json:"notes,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+
 	Stats            Stats  `json:"stats"`
 	IncompleteReason string `json:"incomplete,omitempty"`
 
+	// number of snapshots of the source taken since the last one that rehashed all files.
+	SnapshotsSinceFullRehash int `json:"sinceFullRehash,omitempty"`
+
 	RootEntry *DirEntry `json:"rootEntry"`
 
+	// files detected as sensitive according to the screening policy.
+	SensitiveFiles []*SensitiveFile `json:"sensitiveFiles,omitempty"`
+
+	// unusually large amount of changes detected according to the anomaly policy.
+	Anomaly *Anomaly `json:"anomaly,omitempty"`
+
+	// canary files designated by the canary policy that were modified or removed.
+	CanaryChanges []*CanaryChange `json:"canaryChanges,omitempty"`
+
+	// signature of the manifest made by the host that created the snapshot.
+	Signature *Signature `json:"signature,omitempty"`
+
+	// fields written by newer versions of kopia, which are preserved when the manifest is rewritten.
+	UnknownFields UnknownFields `json:"-"`
+
 	RetentionReasons []string `json:"-"`
 }
 
+// Note is a free-text note attached to a snapshot after it was created.
+type Note struct {
+	Time   time.Time `json:"time"`
+	Author string    `json:"author,omitempty"`
+	Text   string    `json:"text"`
+}
+
+// SensitiveFile describes a file that was detected as sensitive when taking the snapshot.
+type SensitiveFile struct {
+	Path    string `json:"path"`
+	Reason  string `json:"reason"`
+	Skipped bool   `json:"skipped,omitempty"`
+}
+
+// Anomaly describes a snapshot that modified unusually large fraction of files compared to previous snapshots.
+type Anomaly struct {
+	ModifiedFiles          int     `json:"modifiedFiles"`
+	ModifiedPercent        float64 `json:"modifiedPercent"`
+	TypicalModifiedPercent float64 `json:"typicalModifiedPercent"`
+}
+
+func (a *Anomaly) String() string {
+	return fmt.Sprintf("%v files (%.1f%%) modified, typically %.1f%%", a.ModifiedFiles, a.ModifiedPercent, a.TypicalModifiedPercent)
+}
+
+// Canary file changes.
+const (
+	CanaryModified = "modified"
+	CanaryRemoved  = "removed"
+)
+
+// CanaryChange describes a change to a canary file detected when taking the snapshot.
+type CanaryChange struct {
+	Path   string `json:"path"`
+	Change string `json:"change"`
+}
+
+// Suspicious returns true if the snapshot shows signs of ransomware or other unauthorized activity.
+func (m *Manifest) Suspicious() bool {
+	return m.Anomaly != nil || len(m.CanaryChanges) > 0
+}
+
+// SuspicionReasons returns human-readable descriptions of signs of ransomware or other unauthorized activity.
+func (m *Manifest) SuspicionReasons() []string {
+	var result []string
+
+	if m.Anomaly != nil {
+		result = append(result, "anomalous changes: "+m.Anomaly.String())
+	}
+
+	for _, c := range m.CanaryChanges {
+		result = append(result, fmt.Sprintf("canary file %v %v", c.Path, c.Change))
+	}
+
+	return result
+}
+
 // EntryType is a type of a filesystem entry.
 type EntryType string
 
@@ -92,10 +181,34 @@ type HasDirEntry interface {
 // DirManifest represents serialized contents of a directory.
 // The entries are sorted lexicographically and summary only refers to properties of
 // entries, so directory with the same contents always serializes to exactly the same JSON.
+//
+// Entries of very large directories are stored in separate objects referenced by Pages instead of
+// Entries, which allows reading a single entry without downloading the entire listing.
+//
+// Directories can also be delta-encoded against the directory object identified by Base, in which
+// case Entries only holds entries added or changed since the base and Removed holds names of entries
+// that were removed.
 type DirManifest struct {
-	StreamType string               `json:"stream"` // legacy
-	Entries    []*DirEntry          `json:"entries"`
-	Summary    *fs.DirectorySummary `json:"summary"`
+	StreamType    string               `json:"stream"` // legacy
+	SchemaVersion int                  `json:"schemaVersion,omitempty"`
+	Entries       []*DirEntry          `json:"entries"`
+	Summary       *fs.DirectorySummary `json:"summary"`
+	Pages         []*DirPage           `json:"pages,omitempty"`
+	Base          object.ID            `json:"base,omitempty"`
+	Removed       []string             `json:"removed,omitempty"`
+	DeltaDepth    int                  `json:"deltaDepth,omitempty"`
+
+	// fields written by newer versions of kopia, which are preserved when the directory is rewritten.
+	UnknownFields UnknownFields `json:"-"`
+}
+
+// DirPage references an object storing a range of entries of a large directory, ordered by name.
+// The object is either a DirManifest with the entries or a DirManifest with further pages.
+type DirPage struct {
+	FirstName  string    `json:"first"`
+	LastName   string    `json:"last"`
+	EntryCount int       `json:"count"`
+	ObjectID   object.ID `json:"obj"`
 }
 
 // RootObjectID returns the ID of a root object.
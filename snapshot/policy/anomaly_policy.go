@@ -0,0 +1,156 @@
+package policy
+
+import (
+	"context"
+	"sort"
+
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/snapshot"
+)
+
+// Supported actions taken when a snapshot shows anomalous amount of changes.
+const (
+	// AnomalyNone disables anomaly detection.
+	AnomalyNone = "none"
+
+	// AnomalyWarn reports the anomaly and records it in the snapshot manifest.
+	AnomalyWarn = "warn"
+
+	// AnomalyFail refuses to save anomalous snapshots unless they are explicitly accepted.
+	AnomalyFail = "fail"
+)
+
+// anomalyHistorySize is the number of previous snapshots used to determine typical amount of changes.
+const anomalyHistorySize = 10
+
+// AnomalyPolicy describes detection of snapshots modifying unusually large fraction of files,
+// which often indicates ransomware encryption or a misconfigured exclusion.
+type AnomalyPolicy struct {
+	// Action is one of AnomalyNone, AnomalyWarn or AnomalyFail.
+	Action string `json:"action,omitempty"`
+
+	// ModifiedFilesPercent is the minimum percentage of modified files considered anomalous.
+	ModifiedFilesPercent *int `json:"modifiedFilesPercent,omitempty"`
+
+	// HistoryFactor is how many times the percentage of modified files must exceed the average of previous snapshots.
+	HistoryFactor *int `json:"historyFactor,omitempty"`
+
+	// MinFileCount is the minimum number of files in a snapshot for the anomaly detection to apply.
+	MinFileCount *int `json:"minFileCount,omitempty"`
+}
+
+// Merge applies default values from the provided policy.
+func (p *AnomalyPolicy) Merge(src AnomalyPolicy) {
+	if p.Action == "" {
+		p.Action = src.Action
+	}
+
+	if p.ModifiedFilesPercent == nil && src.ModifiedFilesPercent != nil {
+		p.ModifiedFilesPercent = intPtr(*src.ModifiedFilesPercent)
+	}
+
+	if p.HistoryFactor == nil && src.HistoryFactor != nil {
+		p.HistoryFactor = intPtr(*src.HistoryFactor)
+	}
+
+	if p.MinFileCount == nil && src.MinFileCount != nil {
+		p.MinFileCount = intPtr(*src.MinFileCount)
+	}
+}
+
+// Enabled returns true if snapshots should be checked for anomalies.
+func (p *AnomalyPolicy) Enabled() bool {
+	return p.Action != "" && p.Action != AnomalyNone
+}
+
+// DetectAnomaly compares the fraction of files modified by the provided snapshot with previous complete snapshots
+// of the same source and returns the description of the anomaly or nil if the amount of changes is typical.
+func (p *AnomalyPolicy) DetectAnomaly(ctx context.Context, rep *repo.Repository, man *snapshot.Manifest) (*snapshot.Anomaly, error) {
+	if !p.Enabled() || man.IncompleteReason != "" {
+		return nil, nil
+	}
+
+	snapshots, err := snapshot.ListSnapshots(ctx, rep, man.Source)
+	if err != nil {
+		return nil, err
+	}
+
+	return p.detectAnomaly(man, snapshots), nil
+}
+
+// RejectsSnapshot returns true if the suspicious snapshot must not be saved according to anomaly and canary policies.
+func (p *Policy) RejectsSnapshot(man *snapshot.Manifest) bool {
+	if man.Anomaly != nil && p.AnomalyPolicy.Action == AnomalyFail {
+		return true
+	}
+
+	return len(man.CanaryChanges) > 0 && p.CanaryPolicy.Action == AnomalyFail
+}
+
+func (p *AnomalyPolicy) detectAnomaly(man *snapshot.Manifest, previous []*snapshot.Manifest) *snapshot.Anomaly {
+	if man.Stats.ModifiedFiles == 0 || man.Stats.TotalFileCount < intOrZero(p.MinFileCount) {
+		return nil
+	}
+
+	modified := modifiedFilesPercent(man)
+	if modified < float64(intOrZero(p.ModifiedFilesPercent)) {
+		return nil
+	}
+
+	var history []*snapshot.Manifest
+
+	for _, m := range previous {
+		if m.IncompleteReason == "" && m.Stats.TotalFileCount > 0 && m.StartTime.Before(man.StartTime) {
+			history = append(history, m)
+		}
+	}
+
+	sort.Slice(history, func(i, j int) bool {
+		return history[i].StartTime.After(history[j].StartTime)
+	})
+
+	if len(history) > anomalyHistorySize {
+		history = history[0:anomalyHistorySize]
+	}
+
+	var typical float64
+
+	for _, m := range history {
+		typical += modifiedFilesPercent(m)
+	}
+
+	if len(history) > 0 {
+		typical /= float64(len(history))
+	}
+
+	if modified < typical*float64(intOrZero(p.HistoryFactor)) {
+		return nil
+	}
+
+	return &snapshot.Anomaly{
+		ModifiedFiles:          int(man.Stats.ModifiedFiles),
+		ModifiedPercent:        modified,
+		TypicalModifiedPercent: typical,
+	}
+}
+
+func modifiedFilesPercent(m *snapshot.Manifest) float64 {
+	//nolint:gomnd
+	return 100 * float64(m.Stats.ModifiedFiles) / float64(m.Stats.TotalFileCount)
+}
+
+func intOrZero(v *int) int {
+	if v == nil {
+		return 0
+	}
+
+	return *v
+}
+
+// defaultAnomalyPolicy is the default anomaly detection policy.
+var defaultAnomalyPolicy = AnomalyPolicy{
+	Action:               AnomalyWarn,
+	ModifiedFilesPercent: intPtr(50),  //nolint:gomnd
+	HistoryFactor:        intPtr(3),   //nolint:gomnd
+	MinFileCount:         intPtr(100), //nolint:gomnd
+}
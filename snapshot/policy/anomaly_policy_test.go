@@ -0,0 +1,58 @@
+package policy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kopia/kopia/snapshot"
+)
+
+func TestAnomalyPolicy(t *testing.T) {
+	p := defaultAnomalyPolicy
+	t0 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	snap := func(hour, files, modified int) *snapshot.Manifest {
+		return &snapshot.Manifest{
+			StartTime: t0.Add(time.Duration(hour) * time.Hour),
+			Stats: snapshot.Stats{
+				TotalFileCount: files,
+				ModifiedFiles:  int32(modified),
+			},
+		}
+	}
+
+	quiet := []*snapshot.Manifest{snap(0, 1000, 10), snap(1, 1000, 20), snap(2, 1000, 30)}
+	busy := []*snapshot.Manifest{snap(0, 1000, 600), snap(1, 1000, 700), snap(2, 1000, 800)}
+
+	cases := []struct {
+		desc      string
+		current   *snapshot.Manifest
+		previous  []*snapshot.Manifest
+		anomalous bool
+	}{
+		{"typical changes", snap(3, 1000, 25), quiet, false},
+		{"below threshold", snap(3, 1000, 400), quiet, false},
+		{"mass modification", snap(3, 1000, 900), quiet, true},
+		{"no history", snap(3, 1000, 900), nil, true},
+		{"routinely busy", snap(3, 1000, 900), busy, false},
+		{"too few files", snap(3, 50, 50), quiet, false},
+		{"later snapshots ignored", snap(-1, 1000, 900), busy, true},
+	}
+
+	for _, tc := range cases {
+		got := p.detectAnomaly(tc.current, tc.previous)
+		if (got != nil) != tc.anomalous {
+			t.Errorf("%v: unexpected anomaly %v", tc.desc, got)
+		}
+	}
+
+	got := p.detectAnomaly(snap(3, 1000, 900), quiet)
+	if got.ModifiedFiles != 900 || got.ModifiedPercent != 90 || got.TypicalModifiedPercent != 2 {
+		t.Errorf("unexpected anomaly: %+v", got)
+	}
+
+	p.Action = AnomalyNone
+	if p.Enabled() {
+		t.Errorf("anomaly detection should be disabled")
+	}
+}
@@ -0,0 +1,49 @@
+package policy
+
+import "path/filepath"
+
+// CanaryPolicy designates canary files, which are never expected to change, so their modification or removal
+// indicates ransomware or other unauthorized activity.
+type CanaryPolicy struct {
+	// Action is one of AnomalyNone, AnomalyWarn or AnomalyFail.
+	Action string `json:"action,omitempty"`
+
+	// Files are patterns of names of canary files in the directory and its subdirectories.
+	Files []string `json:"files,omitempty"`
+}
+
+// Merge applies default values from the provided policy.
+func (p *CanaryPolicy) Merge(src CanaryPolicy) {
+	if p.Action == "" {
+		p.Action = src.Action
+	}
+
+	if len(p.Files) == 0 {
+		p.Files = src.Files
+	}
+}
+
+// Enabled returns true if any canary files are designated.
+func (p *CanaryPolicy) Enabled() bool {
+	return len(p.Files) > 0 && p.Action != AnomalyNone
+}
+
+// IsCanary returns true if the file with the provided name is a canary file.
+func (p *CanaryPolicy) IsCanary(name string) bool {
+	if !p.Enabled() {
+		return false
+	}
+
+	for _, pattern := range p.Files {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// defaultCanaryPolicy is the default canary policy.
+var defaultCanaryPolicy = CanaryPolicy{
+	Action: AnomalyWarn,
+}
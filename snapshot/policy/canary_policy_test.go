@@ -0,0 +1,52 @@
+package policy
+
+import (
+	"testing"
+
+	"github.com/kopia/kopia/snapshot"
+)
+
+func TestCanaryPolicy(t *testing.T) {
+	p := CanaryPolicy{
+		Action: AnomalyFail,
+		Files:  []string{"canary.*", "*.honeypot"},
+	}
+
+	cases := map[string]bool{
+		"canary.docx":     true,
+		"budget.honeypot": true,
+		"canary":          false,
+		"notes.txt":       false,
+	}
+
+	for name, want := range cases {
+		if got := p.IsCanary(name); got != want {
+			t.Errorf("IsCanary(%v) = %v, want %v", name, got, want)
+		}
+	}
+
+	pol := &Policy{CanaryPolicy: p}
+	man := &snapshot.Manifest{}
+
+	if pol.RejectsSnapshot(man) {
+		t.Errorf("snapshot without canary changes should not be rejected")
+	}
+
+	man.CanaryChanges = []*snapshot.CanaryChange{{Path: "canary.docx", Change: snapshot.CanaryModified}}
+
+	if !pol.RejectsSnapshot(man) {
+		t.Errorf("snapshot with modified canary should be rejected")
+	}
+
+	pol.CanaryPolicy.Action = AnomalyWarn
+
+	if pol.RejectsSnapshot(man) {
+		t.Errorf("snapshot with modified canary should only cause a warning")
+	}
+
+	pol.CanaryPolicy.Action = AnomalyNone
+
+	if pol.CanaryPolicy.IsCanary("canary.docx") {
+		t.Errorf("canary policy should be disabled")
+	}
+}
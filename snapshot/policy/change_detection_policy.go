@@ -0,0 +1,49 @@
+package policy
+
+// Supported change detection modes.
+const (
+	// ChangeDetectionMetadata reuses contents of files from previous snapshots when their size, modification time, mode and owner are unchanged.
+	ChangeDetectionMetadata = "metadata"
+
+	// ChangeDetectionRehash reads and hashes contents of all files on every snapshot.
+	ChangeDetectionRehash = "rehash"
+)
+
+// ChangeDetectionPolicy controls how snapshots determine which files have changed since the previous snapshot.
+type ChangeDetectionPolicy struct {
+	// Mode is either ChangeDetectionMetadata or ChangeDetectionRehash.
+	Mode string `json:"mode,omitempty"`
+
+	// FullRehashEvery causes every N-th snapshot of a source to rehash all files even when using metadata-based change detection.
+	FullRehashEvery *int `json:"fullRehashEvery,omitempty"`
+}
+
+// Merge applies default values from the provided policy.
+func (p *ChangeDetectionPolicy) Merge(src ChangeDetectionPolicy) {
+	if p.Mode == "" {
+		p.Mode = src.Mode
+	}
+
+	if p.FullRehashEvery == nil && src.FullRehashEvery != nil {
+		p.FullRehashEvery = intPtr(*src.FullRehashEvery)
+	}
+}
+
+// ShouldRehashAll returns true if the snapshot taken after the given number of snapshots since last full rehash
+// should rehash all files instead of relying on file metadata.
+func (p *ChangeDetectionPolicy) ShouldRehashAll(snapshotsSinceFullRehash int) bool {
+	if p.Mode == ChangeDetectionRehash {
+		return true
+	}
+
+	if p.FullRehashEvery == nil || *p.FullRehashEvery <= 0 {
+		return false
+	}
+
+	return snapshotsSinceFullRehash+1 >= *p.FullRehashEvery
+}
+
+// defaultChangeDetectionPolicy is the default change detection policy.
+var defaultChangeDetectionPolicy = ChangeDetectionPolicy{
+	Mode: ChangeDetectionMetadata,
+}
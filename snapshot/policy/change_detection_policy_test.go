@@ -0,0 +1,40 @@
+package policy
+
+import "testing"
+
+func TestChangeDetectionPolicyShouldRehashAll(t *testing.T) {
+	cases := []struct {
+		policy   ChangeDetectionPolicy
+		since    int
+		expected bool
+	}{
+		{ChangeDetectionPolicy{}, 100, false},
+		{ChangeDetectionPolicy{Mode: ChangeDetectionMetadata}, 100, false},
+		{ChangeDetectionPolicy{Mode: ChangeDetectionRehash}, 0, true},
+		{ChangeDetectionPolicy{Mode: ChangeDetectionMetadata, FullRehashEvery: intPtr(0)}, 100, false},
+		{ChangeDetectionPolicy{Mode: ChangeDetectionMetadata, FullRehashEvery: intPtr(1)}, 0, true},
+		{ChangeDetectionPolicy{Mode: ChangeDetectionMetadata, FullRehashEvery: intPtr(3)}, 0, false},
+		{ChangeDetectionPolicy{Mode: ChangeDetectionMetadata, FullRehashEvery: intPtr(3)}, 1, false},
+		{ChangeDetectionPolicy{Mode: ChangeDetectionMetadata, FullRehashEvery: intPtr(3)}, 2, true},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		if got := tc.policy.ShouldRehashAll(tc.since); got != tc.expected {
+			t.Errorf("unexpected result of ShouldRehashAll(%v) for %+v: %v, want %v", tc.since, tc.policy, got, tc.expected)
+		}
+	}
+}
+
+func TestChangeDetectionPolicyMerge(t *testing.T) {
+	p := ChangeDetectionPolicy{FullRehashEvery: intPtr(5)}
+	p.Merge(ChangeDetectionPolicy{Mode: ChangeDetectionRehash, FullRehashEvery: intPtr(7)})
+
+	if p.Mode != ChangeDetectionRehash {
+		t.Errorf("unexpected mode: %v", p.Mode)
+	}
+
+	if *p.FullRehashEvery != 5 {
+		t.Errorf("unexpected full rehash interval: %v", *p.FullRehashEvery)
+	}
+}
@@ -3,6 +3,7 @@ package policy
 import (
 	"path/filepath"
 	"sort"
+	"strings"
 
 	"github.com/kopia/kopia/fs"
 	"github.com/kopia/kopia/repo/compression"
@@ -15,6 +16,107 @@ type CompressionPolicy struct {
 	NeverCompress  []string         `json:"neverCompress,omitempty"`
 	MinSize        int64            `json:"minSize,omitempty"`
 	MaxSize        int64            `json:"maxSize,omitempty"`
+
+	// ExtensionCompressors overrides the compressor for files with the provided extensions (such as ".log")
+	// or belonging to extension classes (such as "media"), "none" disables compression.
+	ExtensionCompressors map[string]compression.Name `json:"extensionCompressors,omitempty"`
+
+	// AdaptiveCompression compresses a sample of each chunk first and stores the chunk uncompressed
+	// when the sample does not compress well.
+	AdaptiveCompression *bool `json:"adaptiveCompression,omitempty"`
+
+	// MetadataCompressorName is the compressor used for directory listings.
+	MetadataCompressorName compression.Name `json:"metadataCompressorName,omitempty"`
+
+	// DeltaEncodeDirectories stores changed directories as differences against their listing in the previous snapshot.
+	DeltaEncodeDirectories *bool `json:"deltaEncodeDirectories,omitempty"`
+
+	// InlineFilesMaxSize is the maximum size of files stored inline in directory listings instead of separate contents, 0 disables inlining.
+	InlineFilesMaxSize *int64 `json:"inlineFilesMaxSize,omitempty"`
+}
+
+// ExtensionClasses are named groups of file extensions that can be assigned a compressor together.
+var ExtensionClasses = map[string][]string{
+	"archives": {".7z", ".bz2", ".gz", ".rar", ".tgz", ".xz", ".zip", ".zst"},
+	"media":    {".avi", ".flac", ".gif", ".heic", ".jpeg", ".jpg", ".m4a", ".mkv", ".mov", ".mp3", ".mp4", ".ogg", ".png", ".webm", ".webp"},
+	"text":     {".csv", ".htm", ".html", ".json", ".log", ".md", ".txt", ".xml", ".yaml", ".yml"},
+}
+
+// extensionCompressor returns the compressor assigned to the extension directly or through its class.
+func (p *CompressionPolicy) extensionCompressor(ext string) (compression.Name, bool) {
+	if len(p.ExtensionCompressors) == 0 || ext == "" {
+		return "", false
+	}
+
+	ext = strings.ToLower(ext)
+
+	if c, ok := p.ExtensionCompressors[ext]; ok {
+		return c, true
+	}
+
+	var classes []string
+
+	for k := range p.ExtensionCompressors {
+		if _, ok := ExtensionClasses[k]; ok {
+			classes = append(classes, k)
+		}
+	}
+
+	sort.Strings(classes)
+
+	for _, class := range classes {
+		if isInSortedSlice(ext, ExtensionClasses[class]) {
+			return p.ExtensionCompressors[class], true
+		}
+	}
+
+	return "", false
+}
+
+// MetadataCompressor returns compression name to be used for compressing directory listings.
+func (p *CompressionPolicy) MetadataCompressor() compression.Name {
+	if p.MetadataCompressorName == "none" {
+		return ""
+	}
+
+	return p.MetadataCompressorName
+}
+
+// DeltaEncodeDirectoriesOrDefault returns the delta-encode-directories setting if it is set,
+// and returns the passed default if not
+func (p *CompressionPolicy) DeltaEncodeDirectoriesOrDefault(def bool) bool {
+	if p.DeltaEncodeDirectories == nil {
+		return def
+	}
+
+	return *p.DeltaEncodeDirectories
+}
+
+// AdaptiveCompressionOrDefault returns the adaptive-compression setting if it is set,
+// and returns the passed default if not
+func (p *CompressionPolicy) AdaptiveCompressionOrDefault(def bool) bool {
+	if p.AdaptiveCompression == nil {
+		return def
+	}
+
+	return *p.AdaptiveCompression
+}
+
+// InlineFilesMaxSizeOrDefault returns the maximum size of files stored inline if it is set,
+// and returns the passed default if not
+func (p *CompressionPolicy) InlineFilesMaxSizeOrDefault(def int64) int64 {
+	if p.InlineFilesMaxSize == nil {
+		return def
+	}
+
+	return *p.InlineFilesMaxSize
+}
+
+// ShouldInlineFile returns true if the contents of a given file should be stored inline in its directory listing.
+func (p *CompressionPolicy) ShouldInlineFile(e fs.File) bool {
+	maxSize := p.InlineFilesMaxSizeOrDefault(0)
+
+	return maxSize > 0 && e.Size() <= maxSize
 }
 
 // CompressorForFile returns compression name to be used for compressing a given file according to policy, using attributes such as name or size.
@@ -22,15 +124,23 @@ func (p *CompressionPolicy) CompressorForFile(e fs.File) compression.Name {
 	ext := filepath.Ext(e.Name())
 	size := e.Size()
 
-	if p.CompressorName == "none" {
+	if v := p.MinSize; v > 0 && size < v {
 		return ""
 	}
 
-	if v := p.MinSize; v > 0 && size < v {
+	if v := p.MaxSize; v > 0 && size > v {
 		return ""
 	}
 
-	if v := p.MaxSize; v > 0 && size > v {
+	if c, ok := p.extensionCompressor(ext); ok {
+		if c == "none" {
+			return ""
+		}
+
+		return c
+	}
+
+	if p.CompressorName == "none" {
 		return ""
 	}
 
@@ -60,12 +170,43 @@ func (p *CompressionPolicy) Merge(src CompressionPolicy) {
 		p.MaxSize = src.MaxSize
 	}
 
+	for k, v := range src.ExtensionCompressors {
+		if _, ok := p.ExtensionCompressors[k]; ok {
+			continue
+		}
+
+		if p.ExtensionCompressors == nil {
+			p.ExtensionCompressors = map[string]compression.Name{}
+		}
+
+		p.ExtensionCompressors[k] = v
+	}
+
 	p.OnlyCompress = mergeStrings(p.OnlyCompress, src.OnlyCompress)
 	p.NeverCompress = mergeStrings(p.NeverCompress, src.NeverCompress)
+
+	if p.AdaptiveCompression == nil && src.AdaptiveCompression != nil {
+		p.AdaptiveCompression = newBool(*src.AdaptiveCompression)
+	}
+
+	if p.MetadataCompressorName == "" {
+		p.MetadataCompressorName = src.MetadataCompressorName
+	}
+
+	if p.DeltaEncodeDirectories == nil && src.DeltaEncodeDirectories != nil {
+		p.DeltaEncodeDirectories = newBool(*src.DeltaEncodeDirectories)
+	}
+
+	if p.InlineFilesMaxSize == nil && src.InlineFilesMaxSize != nil {
+		p.InlineFilesMaxSize = int64Ptr(*src.InlineFilesMaxSize)
+	}
 }
 
 var defaultCompressionPolicy = CompressionPolicy{
-	CompressorName: "none",
+	CompressorName:         "none",
+	AdaptiveCompression:    newBool(false),
+	MetadataCompressorName: "none",
+	DeltaEncodeDirectories: newBool(false),
 }
 
 func mergeStrings(s1, s2 []string) []string {
@@ -0,0 +1,86 @@
+package policy
+
+import (
+	"testing"
+
+	"github.com/kopia/kopia/internal/mockfs"
+	"github.com/kopia/kopia/repo/compression"
+)
+
+func TestCompressionPolicyExtensionCompressors(t *testing.T) {
+	parent := CompressionPolicy{
+		CompressorName: "none",
+		ExtensionCompressors: map[string]compression.Name{
+			"text": "zstd-19",
+			".gz":  "gzip",
+		},
+	}
+
+	var p CompressionPolicy
+
+	p.Merge(CompressionPolicy{
+		CompressorName: "zstd",
+		MinSize:        10,
+		ExtensionCompressors: map[string]compression.Name{
+			"media": "none",
+			".gz":   "none",
+		},
+	})
+	p.Merge(parent)
+
+	dir := mockfs.NewDirectory()
+	content := make([]byte, 100)
+
+	cases := map[string]compression.Name{
+		"app.log":    "zstd-19",
+		"NOTES.TXT":  "zstd-19",
+		"photo.JPG":  "",
+		"movie.mp4":  "",
+		"backup.gz":  "",
+		"main.go":    "zstd",
+		"no-ext":     "zstd",
+		"archive.7z": "zstd",
+	}
+
+	for name, want := range cases {
+		if got := p.CompressorForFile(dir.AddFile(name, content, 0o644)); got != want {
+			t.Errorf("unexpected compressor for %v: %q, want %q", name, got, want)
+		}
+	}
+
+	// size limits apply to files with extension compressors too.
+	if got := p.CompressorForFile(dir.AddFile("small.log", []byte{1}, 0o644)); got != "" {
+		t.Errorf("unexpected compressor for small file: %q", got)
+	}
+
+	if _, ok := parent.ExtensionCompressors["media"]; ok {
+		t.Errorf("merge modified the parent policy")
+	}
+}
+
+func TestCompressionPolicyInlineFilesMaxSize(t *testing.T) {
+	dir := mockfs.NewDirectory()
+	f := dir.AddFile("small", []byte{1, 2, 3}, 0o644)
+
+	parent := CompressionPolicy{InlineFilesMaxSize: int64Ptr(100)}
+
+	var inherited CompressionPolicy
+
+	inherited.Merge(parent)
+
+	if !inherited.ShouldInlineFile(f) {
+		t.Errorf("inlining enabled by parent policy was not inherited")
+	}
+
+	// child policy disables inlining enabled by the parent.
+	child := CompressionPolicy{InlineFilesMaxSize: int64Ptr(0)}
+	child.Merge(parent)
+
+	if child.ShouldInlineFile(f) {
+		t.Errorf("inlining disabled by child policy was enabled")
+	}
+
+	if got := child.InlineFilesMaxSizeOrDefault(-1); got != 0 {
+		t.Errorf("unexpected maximum size of inline files: %v", got)
+	}
+}
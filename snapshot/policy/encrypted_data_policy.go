@@ -0,0 +1,37 @@
+package policy
+
+// EncryptedDataPolicy marks directories holding files that are already encrypted at the source, such as
+// Cryptomator vaults. Such files can neither be compressed nor deduplicated, so they are stored as-is in large chunks.
+type EncryptedDataPolicy struct {
+	// Encrypted indicates that files in the directory and its subdirectories contain encrypted or random data.
+	Encrypted *bool `json:"encrypted,omitempty"`
+
+	// Splitter is the name of the splitter used for encrypted files.
+	Splitter string `json:"splitter,omitempty"`
+}
+
+// Merge applies default values from the provided policy.
+func (p *EncryptedDataPolicy) Merge(src EncryptedDataPolicy) {
+	if p.Encrypted == nil && src.Encrypted != nil {
+		p.Encrypted = newBool(*src.Encrypted)
+	}
+
+	if p.Splitter == "" {
+		p.Splitter = src.Splitter
+	}
+}
+
+// EncryptedOrDefault returns the encrypted setting if it is set, and returns the passed default if not.
+func (p *EncryptedDataPolicy) EncryptedOrDefault(def bool) bool {
+	if p.Encrypted == nil {
+		return def
+	}
+
+	return *p.Encrypted
+}
+
+// defaultEncryptedDataPolicy is the default encrypted data policy.
+var defaultEncryptedDataPolicy = EncryptedDataPolicy{
+	Encrypted: newBool(false),
+	Splitter:  "FIXED-8M",
+}
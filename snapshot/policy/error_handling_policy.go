@@ -1,5 +1,7 @@
 package policy
 
+import "time"
+
 // ErrorHandlingPolicy controls error hadnling behavior when taking snapshots.
 type ErrorHandlingPolicy struct {
 	// IgnoreFileErrors controls whether or not snapshot operation should terminate when a file throws an error on being read
@@ -7,6 +9,10 @@ type ErrorHandlingPolicy struct {
 
 	// IgnoreDirectoryErrors controls whether or not snapshot operation should terminate when a directory throws an error on being read or opened
 	IgnoreDirectoryErrors *bool `json:"ignoreDirectoryErrors,omitempty"`
+
+	// IOTimeoutSeconds is the time after which an unresponsive file system operation fails the file or directory
+	// being read, which allows snapshots of hung network file systems to complete. Zero disables the timeout.
+	IOTimeoutSeconds *int `json:"ioTimeoutSeconds,omitempty"`
 }
 
 // Merge applies default values from the provided policy.
@@ -18,6 +24,10 @@ func (p *ErrorHandlingPolicy) Merge(src ErrorHandlingPolicy) {
 	if p.IgnoreDirectoryErrors == nil && src.IgnoreDirectoryErrors != nil {
 		p.IgnoreDirectoryErrors = newBool(*src.IgnoreDirectoryErrors)
 	}
+
+	if p.IOTimeoutSeconds == nil && src.IOTimeoutSeconds != nil {
+		p.IOTimeoutSeconds = intPtr(*src.IOTimeoutSeconds)
+	}
 }
 
 // IgnoreFileErrorsOrDefault returns the ignore-file-error setting if it is set,
@@ -40,10 +50,16 @@ func (p *ErrorHandlingPolicy) IgnoreDirectoryErrorsOrDefault(def bool) bool {
 	return *p.IgnoreDirectoryErrors
 }
 
+// IOTimeout returns the timeout of file system operations or zero if they are not subject to timeout.
+func (p *ErrorHandlingPolicy) IOTimeout() time.Duration {
+	return time.Duration(intOrZero(p.IOTimeoutSeconds)) * time.Second
+}
+
 // defaultErrorHandlingPolicy is the default error handling policy.
 var defaultErrorHandlingPolicy = ErrorHandlingPolicy{
 	IgnoreFileErrors:      newBool(false),
 	IgnoreDirectoryErrors: newBool(false),
+	IOTimeoutSeconds:      intPtr(0),
 }
 
 func newBool(b bool) *bool {
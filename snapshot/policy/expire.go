@@ -54,7 +54,7 @@ func getExpiredSnapshotsForSource(ctx context.Context, rep *repo.Repository, sna
 		return nil, err
 	}
 
-	pol.RetentionPolicy.ComputeRetentionReasons(snapshots)
+	pol.RetentionPolicy.ComputeRetentionReasons(snapshots, rep.Time())
 
 	var toDelete []*snapshot.Manifest
 
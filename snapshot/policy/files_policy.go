@@ -9,6 +9,14 @@ type FilesPolicy struct {
 	NoParentDotIgnoreFiles bool     `json:"noParentDotFiles,omitempty"`
 
 	MaxFileSize int64 `json:"maxFileSize,omitempty"`
+
+	// OneFileSystem prevents descending into directories on other file systems, such as mount points of
+	// pseudo file systems, bind mounts and external drives, except for IncludedMounts.
+	OneFileSystem *bool `json:"oneFileSystem,omitempty"`
+
+	// IncludedMounts are paths of mount points relative to the directory the policy is defined for,
+	// which are snapshotted even when OneFileSystem is set.
+	IncludedMounts []string `json:"includedMounts,omitempty"`
 }
 
 // Merge applies default values from the provided policy.
@@ -24,9 +32,27 @@ func (p *FilesPolicy) Merge(src FilesPolicy) {
 	if len(p.DotIgnoreFiles) == 0 {
 		p.DotIgnoreFiles = src.DotIgnoreFiles
 	}
+
+	if p.OneFileSystem == nil && src.OneFileSystem != nil {
+		p.OneFileSystem = newBool(*src.OneFileSystem)
+	}
+
+	if len(p.IncludedMounts) == 0 {
+		p.IncludedMounts = src.IncludedMounts
+	}
+}
+
+// OneFileSystemOrDefault returns the one-file-system setting if it is set, and returns the passed default if not.
+func (p *FilesPolicy) OneFileSystemOrDefault(def bool) bool {
+	if p.OneFileSystem == nil {
+		return def
+	}
+
+	return *p.OneFileSystem
 }
 
 // defaultFilesPolicy is the default file ignore policy.
 var defaultFilesPolicy = FilesPolicy{
 	DotIgnoreFiles: []string{".kopiaignore"},
+	OneFileSystem:  newBool(false),
 }
@@ -0,0 +1,43 @@
+package policy
+
+// Types of file system snapshots.
+const (
+	FilesystemSnapshotNone  = "none"
+	FilesystemSnapshotLVM   = "lvm"
+	FilesystemSnapshotBtrfs = "btrfs"
+	FilesystemSnapshotZFS   = "zfs"
+)
+
+// FilesystemSnapshotPolicy describes the file system snapshot created before snapshotting a source,
+// so that files are read from a consistent point-in-time view of the file system. The snapshot is
+// removed when the snapshot of the source has finished.
+type FilesystemSnapshotPolicy struct {
+	// Type is the type of the file system snapshot - 'lvm', 'btrfs', 'zfs' or 'none'.
+	Type string `json:"type,omitempty"`
+
+	// LVMSnapshotSize is the size of LVM snapshot volumes, which must hold all changes to the
+	// logical volume made while the snapshot exists, such as '1G' or '10%ORIGIN'.
+	LVMSnapshotSize string `json:"lvmSnapshotSize,omitempty"`
+}
+
+// Merge applies default values from the provided policy.
+func (p *FilesystemSnapshotPolicy) Merge(src FilesystemSnapshotPolicy) {
+	if p.Type == "" {
+		p.Type = src.Type
+	}
+
+	if p.LVMSnapshotSize == "" {
+		p.LVMSnapshotSize = src.LVMSnapshotSize
+	}
+}
+
+// Enabled returns true if a file system snapshot should be created.
+func (p *FilesystemSnapshotPolicy) Enabled() bool {
+	return p.Type != "" && p.Type != FilesystemSnapshotNone
+}
+
+// defaultFilesystemSnapshotPolicy is the default file system snapshot policy.
+var defaultFilesystemSnapshotPolicy = FilesystemSnapshotPolicy{
+	Type:            FilesystemSnapshotNone,
+	LVMSnapshotSize: "1G",
+}
@@ -13,13 +13,23 @@ var ErrPolicyNotFound = errors.New("policy not found")
 
 // Policy describes snapshot policy for a single source.
 type Policy struct {
-	Labels              map[string]string   `json:"-"`
-	RetentionPolicy     RetentionPolicy     `json:"retention,omitempty"`
-	FilesPolicy         FilesPolicy         `json:"files,omitempty"`
-	ErrorHandlingPolicy ErrorHandlingPolicy `json:"errorHandling,omitempty"`
-	SchedulingPolicy    SchedulingPolicy    `json:"scheduling,omitempty"`
-	CompressionPolicy   CompressionPolicy   `json:"compression,omitempty"`
-	NoParent            bool                `json:"noParent,omitempty"`
+	Labels                   map[string]string        `json:"-"`
+	RetentionPolicy          RetentionPolicy          `json:"retention,omitempty"`
+	FilesPolicy              FilesPolicy              `json:"files,omitempty"`
+	ErrorHandlingPolicy      ErrorHandlingPolicy      `json:"errorHandling,omitempty"`
+	SchedulingPolicy         SchedulingPolicy         `json:"scheduling,omitempty"`
+	CompressionPolicy        CompressionPolicy        `json:"compression,omitempty"`
+	ChangeDetectionPolicy    ChangeDetectionPolicy    `json:"changeDetection,omitempty"`
+	ThrottlingPolicy         ThrottlingPolicy         `json:"throttling,omitempty"`
+	ScreeningPolicy          ScreeningPolicy          `json:"screening,omitempty"`
+	AnomalyPolicy            AnomalyPolicy            `json:"anomaly,omitempty"`
+	CanaryPolicy             CanaryPolicy             `json:"canary,omitempty"`
+	EncryptedDataPolicy      EncryptedDataPolicy      `json:"encryptedData,omitempty"`
+	FilesystemSnapshotPolicy FilesystemSnapshotPolicy `json:"filesystemSnapshot,omitempty"`
+	NoParent                 bool                     `json:"noParent,omitempty"`
+
+	// Enforced policies take precedence over more specific policies, which can only set values the enforced policy doesn't.
+	Enforced bool `json:"enforced,omitempty"`
 }
 
 func (p *Policy) String() string {
@@ -53,16 +63,21 @@ func (p *Policy) Target() snapshot.SourceInfo {
 func MergePolicies(policies []*Policy) *Policy {
 	var merged Policy
 
+	// enforced policies are merged first, so that more specific policies can't override them.
+	for _, p := range policies {
+		if p.Enforced {
+			merged.merge(p)
+		}
+	}
+
 	for _, p := range policies {
 		if p.NoParent {
 			return &merged
 		}
 
-		merged.RetentionPolicy.Merge(p.RetentionPolicy)
-		merged.FilesPolicy.Merge(p.FilesPolicy)
-		merged.ErrorHandlingPolicy.Merge(p.ErrorHandlingPolicy)
-		merged.SchedulingPolicy.Merge(p.SchedulingPolicy)
-		merged.CompressionPolicy.Merge(p.CompressionPolicy)
+		if !p.Enforced {
+			merged.merge(p)
+		}
 	}
 
 	// Merge default expiration policy.
@@ -71,10 +86,36 @@ func MergePolicies(policies []*Policy) *Policy {
 	merged.ErrorHandlingPolicy.Merge(defaultErrorHandlingPolicy)
 	merged.SchedulingPolicy.Merge(defaultSchedulingPolicy)
 	merged.CompressionPolicy.Merge(defaultCompressionPolicy)
+	merged.ChangeDetectionPolicy.Merge(defaultChangeDetectionPolicy)
+	merged.ThrottlingPolicy.Merge(defaultThrottlingPolicy)
+	merged.ScreeningPolicy.Merge(defaultScreeningPolicy)
+	merged.AnomalyPolicy.Merge(defaultAnomalyPolicy)
+	merged.CanaryPolicy.Merge(defaultCanaryPolicy)
+	merged.EncryptedDataPolicy.Merge(defaultEncryptedDataPolicy)
+	merged.FilesystemSnapshotPolicy.Merge(defaultFilesystemSnapshotPolicy)
 
 	return &merged
 }
 
+func (p *Policy) merge(src *Policy) {
+	p.RetentionPolicy.Merge(src.RetentionPolicy)
+	p.FilesPolicy.Merge(src.FilesPolicy)
+	p.ErrorHandlingPolicy.Merge(src.ErrorHandlingPolicy)
+	p.SchedulingPolicy.Merge(src.SchedulingPolicy)
+	p.CompressionPolicy.Merge(src.CompressionPolicy)
+	p.ChangeDetectionPolicy.Merge(src.ChangeDetectionPolicy)
+	p.ThrottlingPolicy.Merge(src.ThrottlingPolicy)
+	p.ScreeningPolicy.Merge(src.ScreeningPolicy)
+	p.AnomalyPolicy.Merge(src.AnomalyPolicy)
+	p.CanaryPolicy.Merge(src.CanaryPolicy)
+	p.EncryptedDataPolicy.Merge(src.EncryptedDataPolicy)
+	p.FilesystemSnapshotPolicy.Merge(src.FilesystemSnapshotPolicy)
+}
+
 func intPtr(n int) *int {
 	return &n
 }
+
+func int64Ptr(n int64) *int64 {
+	return &n
+}
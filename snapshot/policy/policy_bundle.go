@@ -0,0 +1,236 @@
+package policy
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/snapshot"
+)
+
+// Bundle holds all policies of a repository keyed by the string representation of their targets,
+// such as "(global)", "@host", "user@host" or "user@host:/path".
+//
+// Targets can use variables, such as "{{.Username}}@{{.Hostname}}:{{.HomeDir}}/Documents", which are
+// replaced with values of the machine importing the bundle, so one bundle can be applied across many machines.
+type Bundle struct {
+	Policies map[string]*Policy `json:"policies"`
+}
+
+// TargetVariables holds values of variables that can be used in targets of policies in bundles.
+type TargetVariables struct {
+	Hostname string
+	Username string
+	HomeDir  string
+}
+
+// LocalTargetVariables returns values of variables describing the local machine connected to the repository.
+func LocalTargetVariables(rep *repo.Repository) TargetVariables {
+	home, _ := os.UserHomeDir()
+
+	return TargetVariables{
+		Hostname: rep.Hostname,
+		Username: rep.Username,
+		HomeDir:  home,
+	}
+}
+
+// expand replaces variables in the provided target with their values.
+func (v TargetVariables) expand(target string) (string, error) {
+	if !strings.Contains(target, "{{") {
+		return target, nil
+	}
+
+	t, err := template.New("target").Parse(target)
+	if err != nil {
+		return "", errors.Wrapf(err, "invalid policy target %q", target)
+	}
+
+	var buf bytes.Buffer
+
+	if err := t.Execute(&buf, v); err != nil {
+		return "", errors.Wrapf(err, "invalid policy target %q", target)
+	}
+
+	return buf.String(), nil
+}
+
+// templatize returns the string representation of the target where the values of variables are replaced with the variables.
+func (v TargetVariables) templatize(si snapshot.SourceInfo) string {
+	if si == GlobalPolicySourceInfo {
+		return si.String()
+	}
+
+	local := si.Host == v.Hostname && si.UserName == v.Username
+
+	if si.Host == v.Hostname {
+		si.Host = "{{.Hostname}}"
+	}
+
+	if si.UserName == v.Username {
+		si.UserName = "{{.Username}}"
+	}
+
+	// home directory only has a meaning for the same user on the same machine.
+	if local && v.HomeDir != "" {
+		if si.Path == v.HomeDir || strings.HasPrefix(si.Path, v.HomeDir+string(filepath.Separator)) {
+			si.Path = "{{.HomeDir}}" + si.Path[len(v.HomeDir):]
+		}
+	}
+
+	return si.String()
+}
+
+// ExportPolicies returns the bundle of all policies defined in the repository. When vars is provided,
+// values of variables in targets are replaced with the variables.
+func ExportPolicies(ctx context.Context, rep *repo.Repository, vars *TargetVariables) (*Bundle, error) {
+	policies, err := ListPolicies(ctx, rep)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &Bundle{
+		Policies: map[string]*Policy{},
+	}
+
+	for _, pol := range policies {
+		target := pol.Target().String()
+		if vars != nil {
+			target = vars.templatize(pol.Target())
+		}
+
+		if _, ok := b.Policies[target]; ok {
+			return nil, errors.Errorf("ambiguous policy for %v", target)
+		}
+
+		b.Policies[target] = pol
+	}
+
+	return b, nil
+}
+
+// ImportOptions controls importing of bundles of policies.
+type ImportOptions struct {
+	// RemoveOther removes policies of targets not present in the bundle, so that the repository ends up
+	// with exactly the policies of the bundle.
+	RemoveOther bool
+
+	// DryRun only reports the changes.
+	DryRun bool
+
+	// Variables are values of variables used in targets.
+	Variables TargetVariables
+}
+
+// ImportResult describes changes made by importing a bundle of policies.
+type ImportResult struct {
+	Set     []snapshot.SourceInfo
+	Removed []snapshot.SourceInfo
+}
+
+// ImportPolicies sets all policies from the bundle according to the provided options.
+func ImportPolicies(ctx context.Context, rep *repo.Repository, b *Bundle, opts ImportOptions) (*ImportResult, error) {
+	result := &ImportResult{}
+	targets := map[snapshot.SourceInfo]bool{}
+
+	for _, target := range sortedTargets(b) {
+		expanded, err := opts.Variables.expand(target)
+		if err != nil {
+			return nil, err
+		}
+
+		si, err := snapshot.ParseSourceInfo(expanded, rep.Hostname, rep.Username)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid policy target %q", target)
+		}
+
+		if targets[si] {
+			return nil, errors.Errorf("duplicate policy for %v", si)
+		}
+
+		targets[si] = true
+
+		pol := b.Policies[target]
+		if pol == nil {
+			pol = &Policy{}
+		}
+
+		unchanged, err := isPolicyDefined(ctx, rep, si, pol)
+		if err != nil {
+			return nil, err
+		}
+
+		if unchanged {
+			continue
+		}
+
+		if !opts.DryRun {
+			if err := SetPolicy(ctx, rep, si, pol); err != nil {
+				return nil, errors.Wrapf(err, "unable to set policy for %v", si)
+			}
+		}
+
+		result.Set = append(result.Set, si)
+	}
+
+	if !opts.RemoveOther {
+		return result, nil
+	}
+
+	existing, err := ListPolicies(ctx, rep)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, pol := range existing {
+		si := pol.Target()
+		if targets[si] {
+			continue
+		}
+
+		targets[si] = true
+
+		if !opts.DryRun {
+			if err := RemovePolicy(ctx, rep, si); err != nil {
+				return nil, errors.Wrapf(err, "unable to remove policy for %v", si)
+			}
+		}
+
+		result.Removed = append(result.Removed, si)
+	}
+
+	return result, nil
+}
+
+// isPolicyDefined returns true if the provided policy is already defined for the target.
+func isPolicyDefined(ctx context.Context, rep *repo.Repository, si snapshot.SourceInfo, pol *Policy) (bool, error) {
+	existing, err := GetDefinedPolicy(ctx, rep, si)
+	if err == ErrPolicyNotFound {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	return existing.String() == pol.String(), nil
+}
+
+func sortedTargets(b *Bundle) []string {
+	var result []string
+
+	for target := range b.Policies {
+		result = append(result, target)
+	}
+
+	sort.Strings(result)
+
+	return result
+}
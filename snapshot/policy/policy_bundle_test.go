@@ -0,0 +1,58 @@
+package policy
+
+import (
+	"testing"
+
+	"github.com/kopia/kopia/snapshot"
+)
+
+func TestTargetVariables(t *testing.T) {
+	vars := TargetVariables{
+		Hostname: "laptop",
+		Username: "alice",
+		HomeDir:  "/home/alice",
+	}
+
+	cases := []struct {
+		si   snapshot.SourceInfo
+		want string
+	}{
+		{GlobalPolicySourceInfo, "(global)"},
+		{snapshot.SourceInfo{Host: "laptop"}, "@{{.Hostname}}"},
+		{snapshot.SourceInfo{Host: "laptop", UserName: "alice"}, "{{.Username}}@{{.Hostname}}"},
+		{snapshot.SourceInfo{Host: "laptop", UserName: "alice", Path: "/home/alice"}, "{{.Username}}@{{.Hostname}}:{{.HomeDir}}"},
+		{snapshot.SourceInfo{Host: "laptop", UserName: "alice", Path: "/home/alice/docs"}, "{{.Username}}@{{.Hostname}}:{{.HomeDir}}/docs"},
+		{snapshot.SourceInfo{Host: "laptop", UserName: "alice", Path: "/home/alicia"}, "{{.Username}}@{{.Hostname}}:/home/alicia"},
+		{snapshot.SourceInfo{Host: "laptop", UserName: "bob", Path: "/home/alice/docs"}, "bob@{{.Hostname}}:/home/alice/docs"},
+		{snapshot.SourceInfo{Host: "server", UserName: "alice", Path: "/data"}, "{{.Username}}@server:/data"},
+	}
+
+	for _, tc := range cases {
+		got := vars.templatize(tc.si)
+		if got != tc.want {
+			t.Errorf("invalid template for %v: %v, want %v", tc.si, got, tc.want)
+		}
+
+		expanded, err := vars.expand(got)
+		if err != nil {
+			t.Fatalf("unable to expand %v: %v", got, err)
+		}
+
+		if want := tc.si.String(); expanded != want {
+			t.Errorf("invalid expansion of %v: %v, want %v", got, expanded, want)
+		}
+	}
+
+	if _, err := vars.expand("{{.NoSuchVariable}}@host"); err == nil {
+		t.Errorf("expected error for unknown variable")
+	}
+
+	got, err := vars.expand("{{.Username}}@{{.Hostname}}:{{.HomeDir}}/docs")
+	if err != nil {
+		t.Fatalf("unable to expand: %v", err)
+	}
+
+	if want := "alice@laptop:/home/alice/docs"; got != want {
+		t.Errorf("invalid expansion: %v, want %v", got, want)
+	}
+}
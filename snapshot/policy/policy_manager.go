@@ -214,13 +214,22 @@ func (m SubdirectoryPolicyMap) GetPolicyForPath(relativePath string) (*Policy, e
 func TreeForSource(ctx context.Context, rep *repo.Repository, si snapshot.SourceInfo) (*Tree, error) {
 	result := map[string]*Policy{}
 
-	pol, _, err := GetEffectivePolicy(ctx, rep, si)
+	pol, sources, err := GetEffectivePolicy(ctx, rep, si)
 	if err != nil {
 		return nil, err
 	}
 
 	result["."] = pol
 
+	// policies of subdirectories can't override enforced policies of the source and its parents.
+	var enforced []*Policy
+
+	for _, src := range sources {
+		if src.Enforced {
+			enforced = append(enforced, src)
+		}
+	}
+
 	// Find all policies for this host and user
 	policies, err := rep.Manifests.Find(ctx, map[string]string{
 		typeKey:      "policy",
@@ -259,6 +268,10 @@ func TreeForSource(ctx context.Context, rep *repo.Repository, si snapshot.Source
 			return nil, errors.Wrapf(err, "unable to load policy %v", id.ID)
 		}
 
+		if len(enforced) > 0 {
+			pol = MergePolicies(append([]*Policy{pol}, enforced...))
+		}
+
 		result[rel] = pol
 	}
 
@@ -0,0 +1,51 @@
+package policy
+
+import (
+	"testing"
+)
+
+func TestMergePoliciesEnforced(t *testing.T) {
+	specific := &Policy{
+		FilesPolicy:     FilesPolicy{MaxFileSize: 100},
+		RetentionPolicy: RetentionPolicy{KeepLatest: intPtr(1)},
+	}
+
+	// stops inheritance before itself.
+	user := &Policy{
+		RetentionPolicy: RetentionPolicy{KeepDaily: intPtr(5)},
+		NoParent:        true,
+	}
+
+	global := &Policy{
+		FilesPolicy:     FilesPolicy{MaxFileSize: 200},
+		RetentionPolicy: RetentionPolicy{KeepDaily: intPtr(7)},
+	}
+
+	merged := MergePolicies([]*Policy{specific, user, global})
+
+	if got, want := merged.FilesPolicy.MaxFileSize, int64(100); got != want {
+		t.Errorf("unexpected max file size: %v, want %v", got, want)
+	}
+
+	if merged.RetentionPolicy.KeepDaily != nil {
+		t.Errorf("unexpected inherited retention: %v", *merged.RetentionPolicy.KeepDaily)
+	}
+
+	global.Enforced = true
+
+	merged = MergePolicies([]*Policy{specific, user, global})
+
+	// enforced values win over more specific policies, even those not inheriting from parents.
+	if got, want := merged.FilesPolicy.MaxFileSize, int64(200); got != want {
+		t.Errorf("unexpected max file size: %v, want %v", got, want)
+	}
+
+	if got, want := *merged.RetentionPolicy.KeepDaily, 7; got != want {
+		t.Errorf("unexpected daily snapshots: %v, want %v", got, want)
+	}
+
+	// values not set by the enforced policy can still be overridden.
+	if got, want := *merged.RetentionPolicy.KeepLatest, 1; got != want {
+		t.Errorf("unexpected latest snapshots: %v, want %v", got, want)
+	}
+}
@@ -4,11 +4,18 @@ import "strings"
 
 // DefaultPolicy is a default policy returned by policy tree in absence of other policies.
 var DefaultPolicy = &Policy{
-	FilesPolicy:         defaultFilesPolicy,
-	RetentionPolicy:     defaultRetentionPolicy,
-	CompressionPolicy:   defaultCompressionPolicy,
-	ErrorHandlingPolicy: defaultErrorHandlingPolicy,
-	SchedulingPolicy:    defaultSchedulingPolicy,
+	FilesPolicy:              defaultFilesPolicy,
+	RetentionPolicy:          defaultRetentionPolicy,
+	CompressionPolicy:        defaultCompressionPolicy,
+	ErrorHandlingPolicy:      defaultErrorHandlingPolicy,
+	SchedulingPolicy:         defaultSchedulingPolicy,
+	ChangeDetectionPolicy:    defaultChangeDetectionPolicy,
+	ThrottlingPolicy:         defaultThrottlingPolicy,
+	ScreeningPolicy:          defaultScreeningPolicy,
+	AnomalyPolicy:            defaultAnomalyPolicy,
+	CanaryPolicy:             defaultCanaryPolicy,
+	EncryptedDataPolicy:      defaultEncryptedDataPolicy,
+	FilesystemSnapshotPolicy: defaultFilesystemSnapshotPolicy,
 }
 
 // Tree represents a node in the policy tree, where a policy can be
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/kopia/kopia/internal/clock"
 	"github.com/kopia/kopia/snapshot"
 )
 
@@ -17,10 +18,13 @@ type RetentionPolicy struct {
 	KeepAnnual  *int `json:"keepAnnual,omitempty"`
 }
 
-// ComputeRetentionReasons computes the reasons why each snapshot is retained, based on
+// ComputeRetentionReasons computes the reasons why each snapshot is retained as of the provided time, based on
 // the settings in retention policy and stores them in RetentionReason field.
-func (r *RetentionPolicy) ComputeRetentionReasons(manifests []*snapshot.Manifest) {
-	now := time.Now() // allow:no-inject-time
+//
+// Cutoff times are moved back by the maximum tolerated clock skew, so that snapshots created by clients
+// whose clocks are behind are not expired prematurely.
+func (r *RetentionPolicy) ComputeRetentionReasons(manifests []*snapshot.Manifest, now time.Time) {
+	now = now.Add(-clock.MaxSkew)
 	maxTime := now.Add(365 * 24 * time.Hour)
 
 	cutoffTime := func(setting *int, add func(time.Time, int) time.Time) time.Time {
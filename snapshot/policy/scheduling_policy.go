@@ -52,6 +52,10 @@ func SortAndDedupeTimesOfDay(tod []TimeOfDay) []TimeOfDay {
 type SchedulingPolicy struct {
 	IntervalSeconds int64       `json:"intervalSeconds,omitempty"`
 	TimesOfDay      []TimeOfDay `json:"timeOfDay,omitempty"`
+
+	// UploadPriority is the relative share of upload throughput of the source when multiple sources
+	// are snapshotted at the same time by the server, defaults to 1.
+	UploadPriority *int `json:"uploadPriority,omitempty"`
 }
 
 // Interval returns the snapshot interval or zero if not specified.
@@ -72,6 +76,19 @@ func (p *SchedulingPolicy) Merge(src SchedulingPolicy) {
 
 	p.TimesOfDay = SortAndDedupeTimesOfDay(
 		append(append([]TimeOfDay(nil), src.TimesOfDay...), p.TimesOfDay...))
+
+	if p.UploadPriority == nil && src.UploadPriority != nil {
+		p.UploadPriority = intPtr(*src.UploadPriority)
+	}
+}
+
+// Priority returns the upload priority of the source.
+func (p *SchedulingPolicy) Priority() int {
+	if p.UploadPriority == nil || *p.UploadPriority < 1 {
+		return 1
+	}
+
+	return *p.UploadPriority
 }
 
 var defaultSchedulingPolicy = SchedulingPolicy{}
@@ -0,0 +1,139 @@
+package policy
+
+import (
+	"path/filepath"
+	"regexp"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Supported screening actions.
+const (
+	// ScreeningNone disables screening of files.
+	ScreeningNone = "none"
+
+	// ScreeningFlag uploads files with sensitive contents and reports them in the snapshot manifest.
+	ScreeningFlag = "flag"
+
+	// ScreeningSkip reports files with sensitive contents in the snapshot manifest without uploading them.
+	ScreeningSkip = "skip"
+)
+
+// ScreeningHeadSize is the number of bytes at the beginning of each file examined for sensitive contents.
+const ScreeningHeadSize = 64 << 10
+
+// builtinSensitiveNames are patterns of names of files which usually hold secrets.
+var builtinSensitiveNames = []string{
+	".env",
+	".env.*",
+	".git-credentials",
+	".netrc",
+	".pgpass",
+	"id_dsa",
+	"id_ecdsa",
+	"id_ed25519",
+	"id_rsa",
+	"*.p12",
+	"*.pfx",
+}
+
+// builtinSensitiveContents are patterns of file contents which reveal secrets.
+var builtinSensitiveContents = []string{
+	`-----BEGIN [A-Z ]*PRIVATE KEY( BLOCK)?-----`,
+	`\bAKIA[0-9A-Z]{16}\b`,
+	`(?m)^(export\s+)?[A-Z0-9_]*(SECRET|PASSWORD|PASSWD|TOKEN|API_KEY)[A-Z0-9_]*\s*=\s*\S+`,
+}
+
+// compiledPatterns caches compiled regular expressions by their source.
+var compiledPatterns sync.Map
+
+// ScreeningPolicy controls detection of files with sensitive contents, such as private keys or secrets in .env files,
+// before they are uploaded. Files which haven't changed since the previous snapshot are only screened by name.
+type ScreeningPolicy struct {
+	// Action is one of ScreeningNone, ScreeningFlag or ScreeningSkip.
+	Action string `json:"action,omitempty"`
+
+	// NamePatterns are patterns of names of sensitive files in addition to the built-in ones.
+	NamePatterns []string `json:"namePatterns,omitempty"`
+
+	// ContentPatterns are regular expressions matching sensitive contents in addition to the built-in ones.
+	ContentPatterns []string `json:"contentPatterns,omitempty"`
+}
+
+// Merge applies default values from the provided policy.
+func (p *ScreeningPolicy) Merge(src ScreeningPolicy) {
+	if p.Action == "" {
+		p.Action = src.Action
+	}
+
+	if len(p.NamePatterns) == 0 {
+		p.NamePatterns = src.NamePatterns
+	}
+
+	if len(p.ContentPatterns) == 0 {
+		p.ContentPatterns = src.ContentPatterns
+	}
+}
+
+// Enabled returns true if files should be screened.
+func (p *ScreeningPolicy) Enabled() bool {
+	return p.Action == ScreeningFlag || p.Action == ScreeningSkip
+}
+
+// ScreenName returns the reason why a file with the provided name is considered sensitive or an empty string.
+func (p *ScreeningPolicy) ScreenName(name string) string {
+	for _, patterns := range [][]string{builtinSensitiveNames, p.NamePatterns} {
+		for _, pattern := range patterns {
+			if ok, _ := filepath.Match(pattern, name); ok {
+				return "file name matches " + pattern
+			}
+		}
+	}
+
+	return ""
+}
+
+// ScreenContents returns the reason why a file starting with the provided data is considered sensitive or an empty string.
+func (p *ScreeningPolicy) ScreenContents(head []byte) (string, error) {
+	for _, patterns := range [][]string{builtinSensitiveContents, p.ContentPatterns} {
+		for _, pattern := range patterns {
+			re, err := compilePattern(pattern)
+			if err != nil {
+				return "", err
+			}
+
+			if re.Match(head) {
+				return "contents match " + pattern, nil
+			}
+		}
+	}
+
+	return "", nil
+}
+
+// ValidateContentPattern returns an error if the provided content pattern is not a valid regular expression.
+func ValidateContentPattern(pattern string) error {
+	_, err := compilePattern(pattern)
+	return err
+}
+
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	if re, ok := compiledPatterns.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid content pattern %q", pattern)
+	}
+
+	compiledPatterns.Store(pattern, re)
+
+	return re, nil
+}
+
+// defaultScreeningPolicy is the default screening policy.
+var defaultScreeningPolicy = ScreeningPolicy{
+	Action: ScreeningNone,
+}
@@ -0,0 +1,94 @@
+package policy
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// BandwidthWindow specifies bandwidth limits in effect during a part of the day.
+type BandwidthWindow struct {
+	// Start and End specify the window, which wraps around midnight if End is earlier than Start.
+	Start TimeOfDay `json:"start"`
+	End   TimeOfDay `json:"end"`
+
+	// MaxUploadBytesPerSecond and MaxDownloadBytesPerSecond limit the bandwidth during the window, zero means unlimited.
+	MaxUploadBytesPerSecond   int64 `json:"maxUploadBytesPerSecond,omitempty"`
+	MaxDownloadBytesPerSecond int64 `json:"maxDownloadBytesPerSecond,omitempty"`
+}
+
+// ParseWindow parses the window in the HH:MM-HH:MM format.
+func (w *BandwidthWindow) ParseWindow(s string) error {
+	parts := strings.Split(s, "-")
+	if len(parts) != 2 { //nolint:gomnd
+		return errors.Errorf("invalid bandwidth window %q, must be HH:MM-HH:MM", s)
+	}
+
+	if err := w.Start.Parse(parts[0]); err != nil {
+		return err
+	}
+
+	return w.End.Parse(parts[1])
+}
+
+// Contains returns true if the time of day falls within the window.
+func (w BandwidthWindow) Contains(tod TimeOfDay) bool {
+	start, end, m := w.Start.minutes(), w.End.minutes(), tod.minutes()
+
+	if start <= end {
+		return start <= m && m < end
+	}
+
+	return m >= start || m < end
+}
+
+func (w BandwidthWindow) String() string {
+	return fmt.Sprintf("%v-%v", w.Start, w.End)
+}
+
+func (t TimeOfDay) minutes() int {
+	return t.Hour*60 + t.Minute //nolint:gomnd
+}
+
+// ThrottlingPolicy describes bandwidth limits of the storage applied while taking snapshots.
+type ThrottlingPolicy struct {
+	// MaxUploadBytesPerSecond and MaxDownloadBytesPerSecond limit the bandwidth outside of windows, zero means unlimited.
+	MaxUploadBytesPerSecond   int64 `json:"maxUploadBytesPerSecond,omitempty"`
+	MaxDownloadBytesPerSecond int64 `json:"maxDownloadBytesPerSecond,omitempty"`
+
+	// Windows override the limits during parts of the day, the first window containing the time of day applies.
+	Windows []BandwidthWindow `json:"windows,omitempty"`
+}
+
+// Merge applies default values from the provided policy.
+func (p *ThrottlingPolicy) Merge(src ThrottlingPolicy) {
+	if p.MaxUploadBytesPerSecond == 0 {
+		p.MaxUploadBytesPerSecond = src.MaxUploadBytesPerSecond
+	}
+
+	if p.MaxDownloadBytesPerSecond == 0 {
+		p.MaxDownloadBytesPerSecond = src.MaxDownloadBytesPerSecond
+	}
+
+	if len(p.Windows) == 0 {
+		p.Windows = append([]BandwidthWindow(nil), src.Windows...)
+	}
+}
+
+// LimitsAt returns the upload and download limits in bytes per second in effect at the provided time, zero means unlimited.
+func (p *ThrottlingPolicy) LimitsAt(t time.Time) (upload, download int64) {
+	tod := TimeOfDay{Hour: t.Hour(), Minute: t.Minute()}
+
+	for _, w := range p.Windows {
+		if w.Contains(tod) {
+			return w.MaxUploadBytesPerSecond, w.MaxDownloadBytesPerSecond
+		}
+	}
+
+	return p.MaxUploadBytesPerSecond, p.MaxDownloadBytesPerSecond
+}
+
+// defaultThrottlingPolicy is the default throttling policy.
+var defaultThrottlingPolicy = ThrottlingPolicy{}
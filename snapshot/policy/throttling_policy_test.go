@@ -0,0 +1,55 @@
+package policy
+
+import (
+	"testing"
+	"time"
+)
+
+func TestThrottlingPolicyLimitsAt(t *testing.T) {
+	p := ThrottlingPolicy{
+		MaxUploadBytesPerSecond: 1000000,
+		Windows: []BandwidthWindow{
+			{Start: TimeOfDay{0, 0}, End: TimeOfDay{6, 0}},
+			{Start: TimeOfDay{22, 30}, End: TimeOfDay{0, 0}, MaxUploadBytesPerSecond: 5000000, MaxDownloadBytesPerSecond: 100},
+		},
+	}
+
+	cases := []struct {
+		hour, min    int
+		wantUpload   int64
+		wantDownload int64
+	}{
+		{0, 0, 0, 0},
+		{5, 59, 0, 0},
+		{6, 0, 1000000, 0},
+		{12, 0, 1000000, 0},
+		{22, 29, 1000000, 0},
+		{22, 30, 5000000, 100},
+		{23, 59, 5000000, 100},
+	}
+
+	for _, tc := range cases {
+		up, down := p.LimitsAt(time.Date(2020, 1, 1, tc.hour, tc.min, 0, 0, time.Local))
+		if up != tc.wantUpload || down != tc.wantDownload {
+			t.Errorf("unexpected limits at %v:%02v: %v/%v, want %v/%v", tc.hour, tc.min, up, down, tc.wantUpload, tc.wantDownload)
+		}
+	}
+}
+
+func TestBandwidthWindowParse(t *testing.T) {
+	var w BandwidthWindow
+
+	if err := w.ParseWindow("22:00-6:30"); err != nil {
+		t.Fatalf("error: %v", err)
+	}
+
+	if got, want := w.String(), "22:00-6:30"; got != want {
+		t.Errorf("unexpected window %v, want %v", got, want)
+	}
+
+	for _, s := range []string{"", "22:00", "22:00-", "22:00-25:00", "1:00-2:00-3:00"} {
+		if err := w.ParseWindow(s); err == nil {
+			t.Errorf("expected error parsing %q", s)
+		}
+	}
+}
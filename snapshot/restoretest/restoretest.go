@@ -0,0 +1,340 @@
+// Package restoretest verifies that snapshots can actually be restored by fully reading randomly selected
+// files from recent snapshots, which exercises downloading, decryption, decompression and reassembly of
+// their contents, and records the results in the repository as a continuous restore canary.
+package restoretest
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/fs"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/logging"
+	"github.com/kopia/kopia/repo/manifest"
+	"github.com/kopia/kopia/repo/object"
+	"github.com/kopia/kopia/snapshot"
+	"github.com/kopia/kopia/snapshot/snapshotfs"
+)
+
+var log = logging.GetContextLoggerFunc("kopia/restoretest")
+
+// ManifestType is the value of the "type" label for restore test results.
+const ManifestType = "restoreTest"
+
+const (
+	// MaxRecordedResults is the number of most recent results kept in the repository.
+	MaxRecordedResults = 30
+
+	defaultFiles           = 5
+	defaultRecentSnapshots = 3
+
+	// maxPickAttempts is the number of random walks from the root of a snapshot looking for a file.
+	maxPickAttempts = 10
+)
+
+// Options controls which files are tested.
+type Options struct {
+	// Files is the number of files to read.
+	Files int
+
+	// RecentSnapshots is the number of most recent complete snapshots of each source to pick files from.
+	RecentSnapshots int
+
+	// Sources limits the test to the provided sources, all sources are tested if empty.
+	Sources []snapshot.SourceInfo
+
+	// Rand is the source of randomness used to pick files, defaults to one seeded with the current time.
+	Rand *rand.Rand
+}
+
+// FileResult describes the result of reading a single file.
+type FileResult struct {
+	Source       snapshot.SourceInfo `json:"source"`
+	SnapshotID   manifest.ID         `json:"snapshotID"`
+	SnapshotTime time.Time           `json:"snapshotTime"`
+	Path         string              `json:"path"`
+	ObjectID     object.ID           `json:"objectID,omitempty"`
+	Size         int64               `json:"size"`
+	BytesRead    int64               `json:"bytesRead"`
+	Duration     time.Duration       `json:"duration"`
+	Error        string              `json:"error,omitempty"`
+}
+
+// Result is the result of a single restore test.
+type Result struct {
+	ID manifest.ID `json:"-"`
+
+	StartTime time.Time     `json:"startTime"`
+	EndTime   time.Time     `json:"endTime"`
+	Files     []*FileResult `json:"files"`
+}
+
+// FailedCount returns the number of files that could not be read.
+func (r *Result) FailedCount() int {
+	n := 0
+
+	for _, f := range r.Files {
+		if f.Error != "" {
+			n++
+		}
+	}
+
+	return n
+}
+
+// Run reads randomly selected files from recent snapshots. Failures to read files are recorded in
+// the result, the returned error indicates that the test itself could not be performed.
+func Run(ctx context.Context, rep *repo.Repository, opt Options) (*Result, error) {
+	if opt.Files <= 0 {
+		opt.Files = defaultFiles
+	}
+
+	if opt.RecentSnapshots <= 0 {
+		opt.RecentSnapshots = defaultRecentSnapshots
+	}
+
+	rnd := opt.Rand
+	if rnd == nil {
+		rnd = rand.New(rand.NewSource(time.Now().UnixNano())) //nolint:gosec
+	}
+
+	result := &Result{StartTime: time.Now()}
+
+	candidates, err := recentSnapshots(ctx, rep, opt)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(candidates) > 0 {
+		for i := 0; i < opt.Files; i++ {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+
+			man := candidates[rnd.Intn(len(candidates))]
+
+			if fr := testRandomFile(ctx, rep, man, rnd); fr != nil {
+				result.Files = append(result.Files, fr)
+			}
+		}
+	}
+
+	result.EndTime = time.Now()
+
+	return result, nil
+}
+
+// recentSnapshots returns the most recent complete snapshots of the tested sources.
+func recentSnapshots(ctx context.Context, rep *repo.Repository, opt Options) ([]*snapshot.Manifest, error) {
+	sources := opt.Sources
+	if len(sources) == 0 {
+		var err error
+
+		if sources, err = snapshot.ListSources(ctx, rep); err != nil {
+			return nil, errors.Wrap(err, "unable to list sources")
+		}
+	}
+
+	var result []*snapshot.Manifest
+
+	for _, src := range sources {
+		snapshots, err := snapshot.ListSnapshots(ctx, rep, src)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to list snapshots of %v", src)
+		}
+
+		var complete []*snapshot.Manifest
+
+		for _, m := range snapshots {
+			if m.IncompleteReason == "" && m.RootEntry != nil {
+				complete = append(complete, m)
+			}
+		}
+
+		sort.Slice(complete, func(i, j int) bool {
+			return complete[i].StartTime.After(complete[j].StartTime)
+		})
+
+		if len(complete) > opt.RecentSnapshots {
+			complete = complete[0:opt.RecentSnapshots]
+		}
+
+		result = append(result, complete...)
+	}
+
+	return result, nil
+}
+
+// testRandomFile picks a random file of the snapshot and reads it, returns nil if the snapshot has no files.
+func testRandomFile(ctx context.Context, rep *repo.Repository, man *snapshot.Manifest, rnd *rand.Rand) *FileResult {
+	fr := &FileResult{
+		Source:       man.Source,
+		SnapshotID:   man.ID,
+		SnapshotTime: man.StartTime,
+		Path:         ".",
+	}
+
+	root, err := snapshotfs.SnapshotRoot(rep, man)
+	if err != nil {
+		fr.Error = err.Error()
+		return fr
+	}
+
+	for attempt := 0; attempt < maxPickAttempts; attempt++ {
+		f, p, err := pickFile(ctx, root, ".", rnd)
+
+		switch {
+		case err != nil:
+			fr.Path = p
+			fr.Error = err.Error()
+
+			return fr
+
+		case f != nil:
+			fr.Path = p
+			readFile(ctx, f, fr)
+
+			return fr
+		}
+	}
+
+	log(ctx).Debugf("no files found in snapshot %v of %v", man.ID, man.Source)
+
+	return nil
+}
+
+// pickFile walks randomly from the provided entry until it finds a file, returns nil file when it reached
+// an empty directory, or an error along with the path of the directory that could not be read.
+func pickFile(ctx context.Context, e fs.Entry, p string, rnd *rand.Rand) (fs.File, string, error) {
+	for {
+		switch v := e.(type) {
+		case fs.File:
+			return v, p, nil
+
+		case fs.Directory:
+			entries, err := v.Readdir(ctx)
+			if err != nil {
+				return nil, p, errors.Wrap(err, "unable to read directory")
+			}
+
+			var candidates fs.Entries
+
+			for _, c := range entries {
+				switch c.(type) {
+				case fs.File, fs.Directory:
+					candidates = append(candidates, c)
+				}
+			}
+
+			if len(candidates) == 0 {
+				return nil, p, nil
+			}
+
+			e = candidates[rnd.Intn(len(candidates))]
+			p = path.Join(p, e.Name())
+
+		default:
+			return nil, p, nil
+		}
+	}
+}
+
+// readFile reads the entire file and records the outcome in the file result.
+func readFile(ctx context.Context, f fs.File, fr *FileResult) {
+	t0 := time.Now()
+
+	defer func() {
+		fr.Duration = time.Since(t0)
+	}()
+
+	fr.Size = f.Size()
+
+	if h, ok := f.(object.HasObjectID); ok {
+		fr.ObjectID = h.ObjectID()
+	}
+
+	r, err := f.Open(ctx)
+	if err != nil {
+		fr.Error = errors.Wrap(err, "unable to open file").Error()
+		return
+	}
+	defer r.Close() //nolint:errcheck
+
+	fr.BytesRead, err = io.Copy(ioutil.Discard, r)
+	if err != nil {
+		fr.Error = errors.Wrap(err, "unable to read file").Error()
+		return
+	}
+
+	if fr.BytesRead != fr.Size {
+		fr.Error = errors.Errorf("read %v bytes, expected %v", fr.BytesRead, fr.Size).Error()
+	}
+}
+
+// Save records the result in the repository and removes the oldest results beyond MaxRecordedResults.
+func Save(ctx context.Context, rep *repo.Repository, r *Result) error {
+	id, err := rep.Manifests.Put(ctx, map[string]string{manifest.TypeLabelKey: ManifestType}, r)
+	if err != nil {
+		return errors.Wrap(err, "unable to save restore test result")
+	}
+
+	r.ID = id
+
+	entries, err := findResults(ctx, rep)
+	if err != nil {
+		return err
+	}
+
+	for len(entries) > MaxRecordedResults {
+		if err := rep.Manifests.Delete(ctx, entries[0].ID); err != nil {
+			return errors.Wrap(err, "unable to delete old restore test result")
+		}
+
+		entries = entries[1:]
+	}
+
+	return nil
+}
+
+// List returns the results recorded in the repository, oldest first.
+func List(ctx context.Context, rep *repo.Repository) ([]*Result, error) {
+	entries, err := findResults(ctx, rep)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []*Result
+
+	for _, e := range entries {
+		r := &Result{}
+		if err := rep.Manifests.Get(ctx, e.ID, r); err != nil {
+			return nil, errors.Wrapf(err, "unable to load restore test result %v", e.ID)
+		}
+
+		r.ID = e.ID
+
+		results = append(results, r)
+	}
+
+	return results, nil
+}
+
+func findResults(ctx context.Context, rep *repo.Repository) ([]*manifest.EntryMetadata, error) {
+	entries, err := rep.Manifests.Find(ctx, map[string]string{manifest.TypeLabelKey: ManifestType})
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to find restore test results")
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].ModTime.Before(entries[j].ModTime)
+	})
+
+	return entries, nil
+}
@@ -0,0 +1,94 @@
+package restoretest
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/kopia/kopia/internal/mockfs"
+	"github.com/kopia/kopia/internal/repotesting"
+	"github.com/kopia/kopia/internal/testlogging"
+	"github.com/kopia/kopia/snapshot"
+	"github.com/kopia/kopia/snapshot/snapshotfs"
+)
+
+func TestRunAndSave(t *testing.T) {
+	var env repotesting.Environment
+
+	ctx := testlogging.Context(t)
+	defer env.Setup(t).Close(ctx, t)
+
+	rep := env.Repository
+
+	dir := mockfs.NewDirectory()
+	dir.AddFile("a", []byte("contents of a"), 0o644)
+	dir.AddDir("empty", 0o755)
+	dir.AddDir("sub", 0o755).AddFile("b", []byte("contents of b"), 0o644)
+
+	src := snapshot.SourceInfo{Host: "host", UserName: "user", Path: "/data"}
+
+	man, err := snapshotfs.NewUploader(rep).Upload(ctx, dir, nil, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := snapshot.SaveSnapshot(ctx, rep, man); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := Run(ctx, rep, Options{Files: 10, Rand: rand.New(rand.NewSource(1))})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(r.Files) == 0 || r.FailedCount() != 0 {
+		t.Fatalf("unexpected result: %+v", r.Files)
+	}
+
+	for _, f := range r.Files {
+		if f.Path != "a" && f.Path != "sub/b" {
+			t.Errorf("unexpected file: %v", f.Path)
+		}
+
+		if f.BytesRead != 13 || f.ObjectID == "" || f.SnapshotID != man.ID {
+			t.Errorf("unexpected file result: %+v", f)
+		}
+	}
+
+	// snapshot whose root directory can't be read.
+	broken := *man
+	broken.ID = ""
+	broken.Source.Path = "/broken"
+	broken.RootEntry = &snapshot.DirEntry{Type: snapshot.EntryTypeDirectory, ObjectID: "k0123456789abcdef0123456789abcdef"}
+
+	if _, err := snapshot.SaveSnapshot(ctx, rep, &broken); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err = Run(ctx, rep, Options{Sources: []snapshot.SourceInfo{broken.Source}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(r.Files) != defaultFiles || r.FailedCount() != defaultFiles {
+		t.Fatalf("expected failures, got %+v", r.Files)
+	}
+
+	for i := 0; i < MaxRecordedResults+2; i++ {
+		if err := Save(ctx, rep, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	results, err := List(ctx, rep)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results) != MaxRecordedResults {
+		t.Errorf("unexpected number of recorded results: %v", len(results))
+	}
+
+	if last := results[len(results)-1]; last.FailedCount() != defaultFiles {
+		t.Errorf("unexpected last result: %+v", last)
+	}
+}
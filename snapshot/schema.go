@@ -0,0 +1,227 @@
+package snapshot
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Schema versions of manifests and directory objects written by this version of kopia.
+// Readers accept any schema version and keep fields they don't understand, so that older
+// and newer clients can share a repository and rewriting a manifest doesn't lose information.
+//
+// Since the schema version is part of every directory object, introducing it changed the object IDs of all
+// directories, so the first snapshot taken after upgrading writes new objects for unchanged directories too.
+const (
+	ManifestSchemaVersion    = 1
+	DirManifestSchemaVersion = 1
+)
+
+// UnknownFields holds JSON fields of a manifest that were not understood by this version of kopia, by name.
+type UnknownFields map[string]json.RawMessage
+
+// jsonFieldNames returns the names of JSON fields of the provided struct type.
+func jsonFieldNames(t reflect.Type) map[string]bool {
+	result := map[string]bool{}
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+
+		switch name {
+		case "-":
+			continue
+		case "":
+			name = f.Name
+		}
+
+		result[name] = true
+	}
+
+	return result
+}
+
+// unknownFields returns the fields of the provided JSON object whose names are not among known names.
+func unknownFields(data []byte, known map[string]bool) (UnknownFields, error) {
+	var all map[string]json.RawMessage
+
+	if err := json.Unmarshal(data, &all); err != nil {
+		return nil, err
+	}
+
+	var result UnknownFields
+
+	for k, v := range all {
+		if known[k] {
+			continue
+		}
+
+		if result == nil {
+			result = UnknownFields{}
+		}
+
+		result[k] = v
+	}
+
+	return result, nil
+}
+
+// appendUnknownFields appends unknown fields sorted by name to the provided serialized JSON object.
+func appendUnknownFields(data []byte, unknown UnknownFields) ([]byte, error) {
+	if len(unknown) == 0 {
+		return data, nil
+	}
+
+	data = bytes.TrimRight(data, " \n")
+	if len(data) < 2 || data[len(data)-1] != '}' {
+		return nil, errors.New("not a JSON object")
+	}
+
+	var names []string
+	for k := range unknown {
+		names = append(names, k)
+	}
+
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+
+	buf.Write(data[0 : len(data)-1])
+
+	for _, k := range names {
+		if buf.Len() > 1 {
+			buf.WriteByte(',')
+		}
+
+		n, err := json.Marshal(k)
+		if err != nil {
+			return nil, err
+		}
+
+		buf.Write(n)
+		buf.WriteByte(':')
+		buf.Write(unknown[k])
+	}
+
+	buf.WriteByte('}')
+
+	return buf.Bytes(), nil
+}
+
+type manifestFields Manifest
+
+var knownManifestFields = jsonFieldNames(reflect.TypeOf(Manifest{}))
+
+// UnmarshalJSON parses the manifest keeping fields not understood by this version of kopia.
+func (m *Manifest) UnmarshalJSON(b []byte) error {
+	if err := json.Unmarshal(b, (*manifestFields)(m)); err != nil {
+		return err
+	}
+
+	u, err := unknownFields(b, knownManifestFields)
+	if err != nil {
+		return err
+	}
+
+	m.UnknownFields = u
+
+	if m.Signature != nil {
+		if m.Signature.storedPayload, err = signedPayload(b); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// MarshalJSON serializes the manifest including fields not understood by this version of kopia.
+// Signed fields that were not modified are written exactly as they were stored, so that the signature
+// remains valid when the manifest is rewritten by a version of kopia that doesn't understand all of them.
+func (m *Manifest) MarshalJSON() ([]byte, error) {
+	b, err := m.marshalFields()
+	if err != nil || m.Signature == nil || m.Signature.storedPayload == nil {
+		return b, err
+	}
+
+	unchanged, err := m.signedFieldsUnchanged()
+	if err != nil || !unchanged {
+		return b, err
+	}
+
+	return replaceFields(b, m.Signature.storedPayload)
+}
+
+// marshalFields serializes the manifest fields including the unknown ones.
+func (m *Manifest) marshalFields() ([]byte, error) {
+	b, err := json.Marshal((*manifestFields)(m))
+	if err != nil {
+		return nil, err
+	}
+
+	return appendUnknownFields(b, m.UnknownFields)
+}
+
+// replaceFields replaces fields of the serialized JSON object with the ones in the other object.
+func replaceFields(data, replacement []byte) ([]byte, error) {
+	var fields, replaced map[string]json.RawMessage
+
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(replacement, &replaced); err != nil {
+		return nil, err
+	}
+
+	for k, v := range replaced {
+		fields[k] = v
+	}
+
+	return json.Marshal(fields)
+}
+
+// IsNewerSchema returns true if the manifest was written by a newer version of kopia,
+// which may have stored information this version does not understand.
+func (m *Manifest) IsNewerSchema() bool {
+	return m.SchemaVersion > ManifestSchemaVersion
+}
+
+type dirManifestFields DirManifest
+
+var knownDirManifestFields = jsonFieldNames(reflect.TypeOf(DirManifest{}))
+
+// UnmarshalJSON parses the directory object keeping fields not understood by this version of kopia.
+func (m *DirManifest) UnmarshalJSON(b []byte) error {
+	if err := json.Unmarshal(b, (*dirManifestFields)(m)); err != nil {
+		return err
+	}
+
+	u, err := unknownFields(b, knownDirManifestFields)
+	if err != nil {
+		return err
+	}
+
+	m.UnknownFields = u
+
+	return nil
+}
+
+// MarshalJSON serializes the directory object including fields not understood by this version of kopia.
+func (m *DirManifest) MarshalJSON() ([]byte, error) {
+	b, err := json.Marshal((*dirManifestFields)(m))
+	if err != nil {
+		return nil, err
+	}
+
+	return appendUnknownFields(b, m.UnknownFields)
+}
+
+// IsNewerSchema returns true if the directory object was written by a newer version of kopia.
+func (m *DirManifest) IsNewerSchema() bool {
+	return m.SchemaVersion > DirManifestSchemaVersion
+}
@@ -0,0 +1,159 @@
+package snapshot
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"testing"
+)
+
+func TestManifestPreservesUnknownFields(t *testing.T) {
+	input := `{"source":{"host":"h","userName":"u","path":"/p"},"schemaVersion":7,"description":"d",` +
+		`"futureField":{"a":[1,2]},"anotherField":"x"}`
+
+	var m Manifest
+
+	if err := json.Unmarshal([]byte(input), &m); err != nil {
+		t.Fatalf("unable to parse manifest: %v", err)
+	}
+
+	if !m.IsNewerSchema() {
+		t.Errorf("manifest should have newer schema")
+	}
+
+	if got, want := len(m.UnknownFields), 2; got != want {
+		t.Fatalf("unexpected unknown fields: %v, want %v", got, want)
+	}
+
+	m.Description = "changed"
+
+	b, err := json.Marshal(&m)
+	if err != nil {
+		t.Fatalf("unable to serialize manifest: %v", err)
+	}
+
+	var rewritten map[string]json.RawMessage
+	if err := json.Unmarshal(b, &rewritten); err != nil {
+		t.Fatalf("invalid JSON %s: %v", b, err)
+	}
+
+	if got, want := string(rewritten["futureField"]), `{"a":[1,2]}`; got != want {
+		t.Errorf("unexpected future field: %v, want %v", got, want)
+	}
+
+	if got, want := string(rewritten["anotherField"]), `"x"`; got != want {
+		t.Errorf("unexpected another field: %v, want %v", got, want)
+	}
+
+	if got, want := string(rewritten["description"]), `"changed"`; got != want {
+		t.Errorf("unexpected description: %v, want %v", got, want)
+	}
+
+	if got, want := string(rewritten["schemaVersion"]), `7`; got != want {
+		t.Errorf("unexpected schema version: %v, want %v", got, want)
+	}
+}
+
+func TestSignatureOfManifestWithUnknownFields(t *testing.T) {
+	key, _, err := GenerateSigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	trusted := []ed25519.PublicKey{key.Public().(ed25519.PublicKey)}
+
+	// manifest serialized by a newer version of kopia, which has unknown fields among the known ones.
+	stored := `{"source":{"host":"h","userName":"u","path":"/p"},"schemaVersion":7,"futureField":{"b":1,"a":[1,2]},` +
+		`"description":"d","startTime":"2020-01-01T00:00:00Z","endTime":"2020-01-01T00:00:00Z","anotherField":"x",` +
+		`"stats":{},"rootEntry":null}`
+
+	payload, err := signedPayload([]byte(stored))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sig, err := json.Marshal(NewSignature(key, payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored = stored[0:len(stored)-1] + `,"signature":` + string(sig) + `}`
+
+	var m Manifest
+
+	if err := json.Unmarshal([]byte(stored), &m); err != nil {
+		t.Fatalf("unable to parse manifest: %v", err)
+	}
+
+	if err := m.VerifySignature(trusted); err != nil {
+		t.Fatalf("unable to verify signature of manifest with unknown fields: %v", err)
+	}
+
+	// manifest annotated and rewritten by this version is still verified.
+	m.Notes = append(m.Notes, &Note{Text: "some note"})
+
+	rewritten, err := json.Marshal(&m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var m2 Manifest
+
+	if err := json.Unmarshal(rewritten, &m2); err != nil {
+		t.Fatalf("unable to parse manifest: %v", err)
+	}
+
+	if err := m2.VerifySignature(trusted); err != nil {
+		t.Errorf("unable to verify signature of rewritten manifest: %v", err)
+	}
+
+	m2.UnknownFields["futureField"] = json.RawMessage(`{}`)
+
+	if err := m2.VerifySignature(trusted); err != ErrInvalidSignature {
+		t.Errorf("unexpected error verifying modified manifest: %v", err)
+	}
+}
+
+func TestDirManifestSerializationIsStable(t *testing.T) {
+	dm := &DirManifest{
+		StreamType:    "kopia:directory",
+		SchemaVersion: DirManifestSchemaVersion,
+		Entries:       []*DirEntry{{Name: "a", Type: EntryTypeFile}},
+	}
+
+	b1, err := json.Marshal(dm)
+	if err != nil {
+		t.Fatalf("unable to serialize: %v", err)
+	}
+
+	var dm2 DirManifest
+	if err := json.Unmarshal(b1, &dm2); err != nil {
+		t.Fatalf("unable to parse: %v", err)
+	}
+
+	if dm2.UnknownFields != nil || dm2.IsNewerSchema() {
+		t.Errorf("unexpected unknown fields or newer schema: %v", dm2.UnknownFields)
+	}
+
+	b2, err := json.Marshal(&dm2)
+	if err != nil {
+		t.Fatalf("unable to serialize: %v", err)
+	}
+
+	if string(b1) != string(b2) {
+		t.Errorf("serialization not stable: %s vs %s", b1, b2)
+	}
+
+	var dm3 DirManifest
+	if err := json.Unmarshal([]byte(`{"stream":"kopia:directory","entries":[],"xattrs":{}}`), &dm3); err != nil {
+		t.Fatalf("unable to parse: %v", err)
+	}
+
+	b3, err := json.Marshal(&dm3)
+	if err != nil {
+		t.Fatalf("unable to serialize: %v", err)
+	}
+
+	if got, want := string(b3), `{"stream":"kopia:directory","entries":[],"summary":null,"xattrs":{}}`; got != want {
+		t.Errorf("unexpected serialization: %v, want %v", got, want)
+	}
+}
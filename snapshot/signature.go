@@ -0,0 +1,212 @@
+package snapshot
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+
+	"github.com/pkg/errors"
+)
+
+const signingKeyPEMType = "PRIVATE KEY"
+
+// Errors returned when verifying snapshot signatures.
+var (
+	ErrNotSigned        = errors.New("snapshot is not signed")
+	ErrUntrustedKey     = errors.New("snapshot is signed with an untrusted key")
+	ErrInvalidSignature = errors.New("invalid snapshot signature")
+)
+
+// Signature is an Ed25519 signature of a snapshot manifest, which proves that the snapshot was created by the holder
+// of the private key independently of the repository password.
+type Signature struct {
+	PublicKey []byte `json:"publicKey"`
+	Value     []byte `json:"value"`
+
+	// signed part of the manifest as it was stored, set when the manifest is loaded.
+	storedPayload []byte
+}
+
+// unsignedManifestFields are the fields of the serialized manifest that are not signed, notes and annotations
+// can be added after the snapshot was signed.
+var unsignedManifestFields = []string{"signature", "notes", "annotations"}
+
+// signedPayload returns the signed part of the serialized manifest: its top-level fields except the unsigned ones
+// sorted by name, with values exactly as they were serialized. Since it's computed from the stored bytes, clients
+// that don't understand some of the fields verify the same payload as the client that signed the manifest.
+func signedPayload(data []byte) ([]byte, error) {
+	var fields map[string]json.RawMessage
+
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, errors.Wrap(err, "unable to parse manifest")
+	}
+
+	for _, k := range unsignedManifestFields {
+		delete(fields, k)
+	}
+
+	b, err := json.Marshal(fields)
+
+	return b, errors.Wrap(err, "unable to serialize manifest")
+}
+
+// currentSignedPayload returns the signed part of the manifest as serialized by this version of kopia.
+func (m *Manifest) currentSignedPayload() ([]byte, error) {
+	b, err := m.marshalFields()
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to serialize manifest")
+	}
+
+	return signedPayload(b)
+}
+
+// Sign signs the manifest with the provided key, the manifest must not be modified afterwards.
+func (m *Manifest) Sign(key ed25519.PrivateKey) error {
+	m.Signature = nil
+
+	payload, err := m.currentSignedPayload()
+	if err != nil {
+		return err
+	}
+
+	m.Signature = NewSignature(key, payload)
+
+	return nil
+}
+
+// VerifySignature returns nil if the manifest has a valid signature made with one of the trusted keys.
+// Manifests loaded from the repository are verified using the bytes they were stored as.
+func (m *Manifest) VerifySignature(trustedKeys []ed25519.PublicKey) error {
+	if m.Signature == nil || m.Signature.storedPayload == nil {
+		payload, err := m.currentSignedPayload()
+		if err != nil {
+			return err
+		}
+
+		return m.Signature.Verify(payload, trustedKeys)
+	}
+
+	if err := m.Signature.Verify(m.Signature.storedPayload, trustedKeys); err != nil {
+		return err
+	}
+
+	// the signature covers stored bytes, make sure the manifest was not modified after it was loaded.
+	unchanged, err := m.signedFieldsUnchanged()
+	if err != nil {
+		return err
+	}
+
+	if !unchanged {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
+
+// signedFieldsUnchanged returns true if the signed fields of the loaded manifest were not modified.
+func (m *Manifest) signedFieldsUnchanged() (bool, error) {
+	var stored Manifest
+
+	if err := json.Unmarshal(m.Signature.storedPayload, &stored); err != nil {
+		return false, errors.Wrap(err, "unable to parse manifest")
+	}
+
+	want, err := stored.currentSignedPayload()
+	if err != nil {
+		return false, err
+	}
+
+	got, err := m.currentSignedPayload()
+	if err != nil {
+		return false, err
+	}
+
+	return bytes.Equal(got, want), nil
+}
+
+// NewSignature signs the provided payload with the key.
+func NewSignature(key ed25519.PrivateKey, payload []byte) *Signature {
+	return &Signature{
+		PublicKey: key.Public().(ed25519.PublicKey),
+		Value:     ed25519.Sign(key, payload),
+	}
+}
+
+// Verify returns nil if the signature of the payload is valid and made with one of the trusted keys.
+// It can be used to sign other documents describing snapshots, such as bills of materials.
+func (s *Signature) Verify(payload []byte, trustedKeys []ed25519.PublicKey) error {
+	if s == nil {
+		return ErrNotSigned
+	}
+
+	trusted := false
+
+	for _, k := range trustedKeys {
+		if bytes.Equal(k, s.PublicKey) {
+			trusted = true
+		}
+	}
+
+	if !trusted {
+		return errors.Wrapf(ErrUntrustedKey, "key %v", FormatPublicKey(s.PublicKey))
+	}
+
+	if !ed25519.Verify(s.PublicKey, payload, s.Value) {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
+
+// GenerateSigningKey returns a new signing key encoded as PEM.
+func GenerateSigningKey() (ed25519.PrivateKey, []byte, error) {
+	_, key, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "unable to generate key")
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "unable to encode key")
+	}
+
+	return key, pem.EncodeToMemory(&pem.Block{Type: signingKeyPEMType, Bytes: der}), nil
+}
+
+// ParseSigningKey parses the signing key encoded as PEM.
+func ParseSigningKey(data []byte) (ed25519.PrivateKey, error) {
+	b, _ := pem.Decode(data)
+	if b == nil || b.Type != signingKeyPEMType {
+		return nil, errors.New("signing key must be a PEM-encoded private key")
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(b.Bytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to parse signing key")
+	}
+
+	edKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, errors.Errorf("unsupported signing key type %T, must be Ed25519", key)
+	}
+
+	return edKey, nil
+}
+
+// FormatPublicKey returns the textual representation of the public key used to sign snapshots.
+func FormatPublicKey(key ed25519.PublicKey) string {
+	return base64.StdEncoding.EncodeToString(key)
+}
+
+// ParsePublicKey parses the textual representation of the public key used to sign snapshots.
+func ParsePublicKey(s string) (ed25519.PublicKey, error) {
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil || len(b) != ed25519.PublicKeySize {
+		return nil, errors.Errorf("invalid public key %q", s)
+	}
+
+	return ed25519.PublicKey(b), nil
+}
@@ -0,0 +1,100 @@
+package snapshot_test
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/repotesting"
+	"github.com/kopia/kopia/internal/testlogging"
+	"github.com/kopia/kopia/snapshot"
+)
+
+func TestSnapshotSignature(t *testing.T) {
+	var env repotesting.Environment
+
+	ctx := testlogging.Context(t)
+	defer env.Setup(t).Close(ctx, t)
+
+	key, keyPEM, err := snapshot.GenerateSigningKey()
+	if err != nil {
+		t.Fatalf("unable to generate key: %v", err)
+	}
+
+	parsedKey, err := snapshot.ParseSigningKey(keyPEM)
+	if err != nil || !bytes.Equal(parsedKey, key) {
+		t.Fatalf("unable to parse key: %v", err)
+	}
+
+	trusted := []ed25519.PublicKey{key.Public().(ed25519.PublicKey)}
+
+	man := &snapshot.Manifest{
+		Source:      snapshot.SourceInfo{Host: "host-1", UserName: "user-1", Path: "/some/path"},
+		Description: "some-description",
+		StartTime:   time.Now(),
+		EndTime:     time.Now(),
+		RootEntry: &snapshot.DirEntry{
+			Name:        "root",
+			Type:        snapshot.EntryTypeDirectory,
+			Permissions: 0755,
+			ObjectID:    "k1234",
+		},
+	}
+
+	if err := man.VerifySignature(trusted); !errors.Is(err, snapshot.ErrNotSigned) {
+		t.Errorf("unexpected error verifying unsigned manifest: %v", err)
+	}
+
+	if err := man.Sign(key); err != nil {
+		t.Fatalf("unable to sign: %v", err)
+	}
+
+	id := mustSaveSnapshot(t, env.Repository, man)
+
+	loaded, err := snapshot.LoadSnapshot(ctx, env.Repository, id)
+	if err != nil {
+		t.Fatalf("unable to load snapshot: %v", err)
+	}
+
+	if err := loaded.VerifySignature(trusted); err != nil {
+		t.Errorf("unable to verify signature: %v", err)
+	}
+
+	loaded.Notes = append(loaded.Notes, &snapshot.Note{Time: time.Now(), Author: "admin@host", Text: "pre-upgrade state"})
+	loaded.Annotations = map[string]string{"ticket": "OPS-123"}
+
+	newID, err := snapshot.UpdateSnapshot(ctx, env.Repository, loaded)
+	if err != nil {
+		t.Fatalf("unable to update snapshot: %v", err)
+	}
+
+	if _, err := snapshot.LoadSnapshot(ctx, env.Repository, id); err == nil {
+		t.Errorf("previous manifest was not deleted")
+	}
+
+	if loaded, err = snapshot.LoadSnapshot(ctx, env.Repository, newID); err != nil {
+		t.Fatalf("unable to load updated snapshot: %v", err)
+	}
+
+	if len(loaded.Notes) != 1 || loaded.Annotations["ticket"] != "OPS-123" {
+		t.Errorf("unexpected notes and annotations: %v %v", loaded.Notes, loaded.Annotations)
+	}
+
+	if err := loaded.VerifySignature(trusted); err != nil {
+		t.Errorf("unable to verify signature of annotated snapshot: %v", err)
+	}
+
+	otherKey, _, _ := snapshot.GenerateSigningKey()
+	if err := loaded.VerifySignature([]ed25519.PublicKey{otherKey.Public().(ed25519.PublicKey)}); !errors.Is(err, snapshot.ErrUntrustedKey) {
+		t.Errorf("unexpected error verifying with untrusted key: %v", err)
+	}
+
+	loaded.RootEntry.ObjectID = "k5678"
+
+	if err := loaded.VerifySignature(trusted); !errors.Is(err, snapshot.ErrInvalidSignature) {
+		t.Errorf("unexpected error verifying modified manifest: %v", err)
+	}
+}
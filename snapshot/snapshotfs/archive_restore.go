@@ -0,0 +1,122 @@
+package snapshotfs
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/fs"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/object"
+)
+
+// ArchiveRestoreOptions controls restoring of archived blobs before reading the snapshot.
+type ArchiveRestoreOptions struct {
+	// Days is the number of days restored blobs should remain readable.
+	Days int
+
+	// PollInterval is the time between checks whether restores have completed.
+	PollInterval time.Duration
+
+	// Progress is invoked after each check with the number of blobs that are ready.
+	Progress func(ready, total int)
+}
+
+// RestoreFromArchive requests restore of all archived pack blobs holding the contents of files
+// in the provided directory and waits until all of them can be read.
+//
+// Directory listings themselves must remain readable, so storage lifecycle rules moving
+// blobs to archival tiers should only apply to data pack blobs.
+func RestoreFromArchive(ctx context.Context, rep *repo.Repository, oid object.ID, opt ArchiveRestoreOptions) error {
+	pending, err := findPackBlobs(ctx, rep, oid)
+	if err != nil {
+		return err
+	}
+
+	total := len(pending)
+
+	for {
+		var stillPending []blob.ID
+
+		for _, blobID := range pending {
+			ready, err := blob.RestoreArchivedBlob(ctx, rep.Blobs, blobID, opt.Days)
+			if err != nil {
+				return errors.Wrapf(err, "unable to restore %v", blobID)
+			}
+
+			if !ready {
+				stillPending = append(stillPending, blobID)
+			}
+		}
+
+		pending = stillPending
+
+		if opt.Progress != nil {
+			opt.Progress(total-len(pending), total)
+		}
+
+		if len(pending) == 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(opt.PollInterval):
+		}
+	}
+}
+
+// findPackBlobs returns sorted IDs of pack blobs holding the contents of all files in the provided directory.
+func findPackBlobs(ctx context.Context, rep *repo.Repository, oid object.ID) ([]blob.ID, error) {
+	var (
+		mu    sync.Mutex
+		packs = map[blob.ID]bool{}
+	)
+
+	w := NewTreeWalker()
+	w.RootEntries = []fs.Entry{DirectoryEntry(rep, oid, nil)}
+	w.EntryID = func(e fs.Entry) interface{} { return e.(object.HasObjectID).ObjectID() }
+	w.ObjectCallback = func(e fs.Entry) error {
+		if e.IsDir() {
+			return nil
+		}
+
+		contentIDs, err := rep.Objects.VerifyObject(ctx, e.(object.HasObjectID).ObjectID())
+		if err != nil {
+			return errors.Wrapf(err, "unable to get contents of %v", e.Name())
+		}
+
+		for _, cid := range contentIDs {
+			ci, err := rep.Content.ContentInfo(ctx, cid)
+			if err != nil {
+				return errors.Wrapf(err, "unable to get information about content %v", cid)
+			}
+
+			mu.Lock()
+			packs[ci.PackBlobID] = true
+			mu.Unlock()
+		}
+
+		return nil
+	}
+
+	if err := w.Run(ctx); err != nil {
+		return nil, err
+	}
+
+	var result []blob.ID
+	for b := range packs {
+		result = append(result, b)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i] < result[j]
+	})
+
+	return result, nil
+}
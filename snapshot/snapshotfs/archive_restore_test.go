@@ -0,0 +1,76 @@
+package snapshotfs
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kopia/kopia/internal/testlogging"
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/snapshot"
+	"github.com/kopia/kopia/snapshot/policy"
+)
+
+// archivedStorage simulates storage where each blob becomes readable on the second restore request.
+type archivedStorage struct {
+	blob.Storage
+
+	mu        sync.Mutex
+	requested map[blob.ID]int
+}
+
+func (s *archivedStorage) RestoreArchivedBlob(ctx context.Context, id blob.ID, days int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requested[id]++
+
+	return s.requested[id] > 1, nil
+}
+
+func TestRestoreFromArchive(t *testing.T) {
+	ctx := testlogging.Context(t)
+	th := newUploadTestHarness(ctx)
+
+	defer th.cleanup()
+
+	man, err := NewUploader(th.repo).Upload(ctx, th.sourceDir, policy.BuildTree(nil, policy.DefaultPolicy), snapshot.SourceInfo{})
+	if err != nil {
+		t.Fatalf("upload error: %v", err)
+	}
+
+	st := &archivedStorage{Storage: th.repo.Blobs, requested: map[blob.ID]int{}}
+	th.repo.Blobs = st
+
+	var progress []int
+
+	if err := RestoreFromArchive(ctx, th.repo, man.RootObjectID(), ArchiveRestoreOptions{
+		Days:         1,
+		PollInterval: time.Millisecond,
+		Progress: func(ready, total int) {
+			progress = append(progress, ready)
+		},
+	}); err != nil {
+		t.Fatalf("restore error: %v", err)
+	}
+
+	if len(st.requested) == 0 {
+		t.Fatalf("no blobs were restored")
+	}
+
+	for id, cnt := range st.requested {
+		if !strings.HasPrefix(string(id), "p") {
+			t.Errorf("unexpected restore of non-data blob %v", id)
+		}
+
+		if cnt != 2 {
+			t.Errorf("unexpected number of restore requests for %v: %v", id, cnt)
+		}
+	}
+
+	if len(progress) != 2 || progress[0] != 0 || progress[1] != len(st.requested) {
+		t.Errorf("unexpected progress: %v", progress)
+	}
+}
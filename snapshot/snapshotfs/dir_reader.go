@@ -1,28 +1,302 @@
 package snapshotfs
 
 import (
+	"context"
 	"encoding/json"
 	"io"
+	"sort"
 
 	"github.com/pkg/errors"
 
-	"github.com/kopia/kopia/fs"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/object"
 	"github.com/kopia/kopia/snapshot"
 )
 
-const directoryStreamType = "kopia:directory"
+const (
+	directoryStreamType = "kopia:directory"
+
+	// pagedDirectoryStreamType is the stream type of objects referencing pages of entries of directories
+	// too large to be stored in a single object. Using a separate stream type makes older readers fail
+	// instead of showing such directories as empty.
+	pagedDirectoryStreamType = "kopia:paged-directory"
+
+	// deltaDirectoryStreamType is the stream type of objects storing differences between the directory
+	// and the listing of its base directory object.
+	deltaDirectoryStreamType = "kopia:directory-delta"
+)
+
+func isValidDirectoryStreamType(st string) bool {
+	return st == directoryStreamType || st == pagedDirectoryStreamType || st == deltaDirectoryStreamType
+}
+
+// readDirManifest reads the directory object with a given ID, without following its pages.
+func readDirManifest(ctx context.Context, rep *repo.Repository, oid object.ID) (*snapshot.DirManifest, error) {
+	r, err := rep.Objects.Open(ctx, oid)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close() //nolint:errcheck
 
-// readDirEntries reads all directory entries from the specified reader.
-func readDirEntries(r io.Reader) ([]*snapshot.DirEntry, *fs.DirectorySummary, error) {
 	var dir snapshot.DirManifest
 
 	if err := json.NewDecoder(r).Decode(&dir); err != nil {
-		return nil, nil, errors.Wrap(err, "unable to parse directory object")
+		return nil, errors.Wrap(err, "unable to parse directory object")
+	}
+
+	if !isValidDirectoryStreamType(dir.StreamType) {
+		return nil, errors.Errorf("invalid directory stream type")
+	}
+
+	return &dir, nil
+}
+
+// findDirEntry returns the entry with a given name from the directory object or nil if not found.
+// For paged directories only the pages which may contain the entry are read.
+func findDirEntry(ctx context.Context, rep *repo.Repository, oid object.ID, name string) (*snapshot.DirEntry, error) {
+	dir, err := readDirManifest(ctx, rep, oid)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, de := range dir.Entries {
+		if de.Name == name {
+			return de, nil
+		}
+	}
+
+	if dir.Base != "" {
+		for _, n := range dir.Removed {
+			if n == name {
+				return nil, nil
+			}
+		}
+
+		return findDirEntry(ctx, rep, dir.Base, name)
+	}
+
+	// pages are sorted by name and don't overlap.
+	i := sort.Search(len(dir.Pages), func(i int) bool {
+		return dir.Pages[i].LastName >= name
+	})
+
+	if i < len(dir.Pages) && dir.Pages[i].FirstName <= name {
+		return findDirEntry(ctx, rep, dir.Pages[i].ObjectID, name)
+	}
+
+	return nil, nil
+}
+
+// dirListingObjectIDs returns the IDs of all objects other than the directory object itself needed
+// to read its listing - pages of large directories and bases of delta-encoded directories.
+func dirListingObjectIDs(ctx context.Context, rep *repo.Repository, oid object.ID) ([]object.ID, error) {
+	dir, err := readDirManifest(ctx, rep, oid)
+	if err != nil {
+		return nil, err
+	}
+
+	var referenced []object.ID
+
+	for _, p := range dir.Pages {
+		referenced = append(referenced, p.ObjectID)
+	}
+
+	if dir.Base != "" {
+		referenced = append(referenced, dir.Base)
+	}
+
+	var result []object.ID
+
+	for _, ref := range referenced {
+		sub, err := dirListingObjectIDs(ctx, rep, ref)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(append(result, ref), sub...)
+	}
+
+	return result, nil
+}
+
+// iterateDirEntries invokes the callback for each entry of the directory object with a given ID,
+// following its pages and base, without decoding the entire directory into memory.
+func iterateDirEntries(ctx context.Context, rep *repo.Repository, oid object.ID, cb func(de *snapshot.DirEntry) error) error {
+	r, err := rep.Objects.Open(ctx, oid)
+	if err != nil {
+		return err
+	}
+
+	info, err := iterateDirStream(r, cb)
+
+	r.Close() //nolint:errcheck
+
+	if err != nil {
+		return err
+	}
+
+	for _, p := range info.pages {
+		if err := iterateDirEntries(ctx, rep, p.ObjectID, cb); err != nil {
+			return err
+		}
+	}
+
+	if info.base == "" {
+		return nil
+	}
+
+	// entries of the base directory that were removed or replaced are skipped.
+	skip := map[string]bool{}
+
+	for _, n := range info.removed {
+		skip[n] = true
+	}
+
+	for _, de := range info.deltaEntries {
+		skip[de.Name] = true
+	}
+
+	if err := iterateDirEntries(ctx, rep, info.base, func(de *snapshot.DirEntry) error {
+		if skip[de.Name] {
+			return nil
+		}
+
+		return cb(de)
+	}); err != nil {
+		return err
+	}
+
+	for _, de := range info.deltaEntries {
+		if err := cb(de); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// dirStreamInfo holds the parts of a directory object other than the entries reported while reading it.
+type dirStreamInfo struct {
+	pages []*snapshot.DirPage
+
+	base         object.ID
+	removed      []string
+	deltaEntries []*snapshot.DirEntry
+}
+
+// iterateDirStream invokes the callback for each directory entry read from the specified reader
+// and returns the remaining information about the directory object. Entries of delta-encoded directories
+// are not reported, but returned since they must be merged with the entries of the base.
+func iterateDirStream(r io.Reader, cb func(de *snapshot.DirEntry) error) (*dirStreamInfo, error) {
+	d := json.NewDecoder(r)
+
+	if err := expectDelim(d, '{'); err != nil {
+		return nil, err
+	}
+
+	var (
+		streamType string
+		info       dirStreamInfo
+	)
+
+	for d.More() {
+		t, err := d.Token()
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to parse directory object")
+		}
+
+		switch t {
+		case "stream":
+			if err := d.Decode(&streamType); err != nil {
+				return nil, errors.Wrap(err, "unable to parse directory stream type")
+			}
+
+		case "entries":
+			// the stream type precedes the entries, make sure it's a directory before reporting them.
+			if !isValidDirectoryStreamType(streamType) {
+				return nil, errors.Errorf("invalid directory stream type")
+			}
+
+			entryCallback := cb
+			if streamType == deltaDirectoryStreamType {
+				entryCallback = func(de *snapshot.DirEntry) error {
+					info.deltaEntries = append(info.deltaEntries, de)
+					return nil
+				}
+			}
+
+			if err := iterateDirEntriesArray(d, entryCallback); err != nil {
+				return nil, err
+			}
+
+		case "pages":
+			if err := d.Decode(&info.pages); err != nil {
+				return nil, errors.Wrap(err, "unable to parse directory pages")
+			}
+
+		case "base":
+			if err := d.Decode(&info.base); err != nil {
+				return nil, errors.Wrap(err, "unable to parse directory base")
+			}
+
+		case "removed":
+			if err := d.Decode(&info.removed); err != nil {
+				return nil, errors.Wrap(err, "unable to parse removed directory entries")
+			}
+
+		default:
+			var ignored json.RawMessage
+			if err := d.Decode(&ignored); err != nil {
+				return nil, errors.Wrap(err, "unable to parse directory object")
+			}
+		}
+	}
+
+	if !isValidDirectoryStreamType(streamType) {
+		return nil, errors.Errorf("invalid directory stream type")
+	}
+
+	return &info, nil
+}
+
+func iterateDirEntriesArray(d *json.Decoder, cb func(de *snapshot.DirEntry) error) error {
+	t, err := d.Token()
+	if err != nil {
+		return errors.Wrap(err, "unable to parse directory entries")
+	}
+
+	if t == nil {
+		// no entries
+		return nil
+	}
+
+	if t != json.Delim('[') {
+		return errors.Errorf("unexpected token %v, expected array of entries", t)
+	}
+
+	for d.More() {
+		de := &snapshot.DirEntry{}
+		if err := d.Decode(de); err != nil {
+			return errors.Wrap(err, "unable to parse directory entry")
+		}
+
+		if err := cb(de); err != nil {
+			return err
+		}
+	}
+
+	return expectDelim(d, ']')
+}
+
+func expectDelim(d *json.Decoder, delim json.Delim) error {
+	t, err := d.Token()
+	if err != nil {
+		return errors.Wrap(err, "unable to parse directory object")
 	}
 
-	if dir.StreamType != directoryStreamType {
-		return nil, nil, errors.Errorf("invalid directory stream type")
+	if t != delim {
+		return errors.Errorf("unexpected token %v, expected %v", t, delim)
 	}
 
-	return dir.Entries, dir.Summary, nil
+	return nil
 }
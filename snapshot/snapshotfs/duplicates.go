@@ -0,0 +1,97 @@
+package snapshotfs
+
+import (
+	"context"
+	"sort"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/fs"
+	"github.com/kopia/kopia/repo/object"
+)
+
+// DuplicateGroup is a group of files with identical contents.
+type DuplicateGroup struct {
+	ObjectID object.ID `json:"objectID"`
+	Size     int64     `json:"size"`
+	Paths    []string  `json:"paths"`
+}
+
+// ReclaimableBytes returns the logical size that would be freed by keeping a single copy of the file.
+func (g *DuplicateGroup) ReclaimableBytes() int64 {
+	return g.Size * int64(len(g.Paths)-1)
+}
+
+// FindDuplicateFiles walks the provided snapshot directories, keyed by the path under which their files
+// are reported, and returns groups of files at least minSize bytes long sharing the same object ID.
+// The groups are sorted by decreasing reclaimable size.
+func FindDuplicateFiles(ctx context.Context, roots map[string]fs.Directory, minSize int64) ([]DuplicateGroup, error) {
+	groups := map[object.ID]*DuplicateGroup{}
+
+	var rootPaths []string
+	for p := range roots {
+		rootPaths = append(rootPaths, p)
+	}
+
+	sort.Strings(rootPaths)
+
+	for _, p := range rootPaths {
+		if err := findDuplicatesInDirectory(ctx, roots[p], p, minSize, groups); err != nil {
+			return nil, err
+		}
+	}
+
+	var result []DuplicateGroup
+
+	for _, g := range groups {
+		if len(g.Paths) > 1 {
+			result = append(result, *g)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if ri, rj := result[i].ReclaimableBytes(), result[j].ReclaimableBytes(); ri != rj {
+			return ri > rj
+		}
+
+		return result[i].ObjectID < result[j].ObjectID
+	})
+
+	return result, nil
+}
+
+func findDuplicatesInDirectory(ctx context.Context, dir fs.Directory, path string, minSize int64, groups map[object.ID]*DuplicateGroup) error {
+	entries, err := dir.Readdir(ctx)
+	if err != nil {
+		return errors.Wrapf(err, "error reading directory %v", path)
+	}
+
+	for _, e := range entries {
+		childPath := path + "/" + e.Name()
+
+		switch e := e.(type) {
+		case fs.Directory:
+			if err := findDuplicatesInDirectory(ctx, e, childPath, minSize, groups); err != nil {
+				return err
+			}
+
+		case fs.File:
+			h, ok := e.(object.HasObjectID)
+			if !ok || e.Size() < minSize {
+				continue
+			}
+
+			oid := h.ObjectID()
+
+			g := groups[oid]
+			if g == nil {
+				g = &DuplicateGroup{ObjectID: oid, Size: e.Size()}
+				groups[oid] = g
+			}
+
+			g.Paths = append(g.Paths, childPath)
+		}
+	}
+
+	return nil
+}
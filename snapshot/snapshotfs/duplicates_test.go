@@ -0,0 +1,56 @@
+package snapshotfs
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/kopia/kopia/fs"
+	"github.com/kopia/kopia/internal/testlogging"
+	"github.com/kopia/kopia/snapshot"
+	"github.com/kopia/kopia/snapshot/policy"
+)
+
+func TestFindDuplicateFiles(t *testing.T) {
+	ctx := testlogging.Context(t)
+	th := newUploadTestHarness(ctx)
+
+	defer th.cleanup()
+
+	man, err := NewUploader(th.repo).Upload(ctx, th.sourceDir, policy.BuildTree(nil, policy.DefaultPolicy), snapshot.SourceInfo{})
+	if err != nil {
+		t.Fatalf("upload error: %v", err)
+	}
+
+	root := DirectoryEntry(th.repo, man.RootObjectID(), nil).(fs.Directory)
+
+	groups, err := FindDuplicateFiles(ctx, map[string]fs.Directory{"root": root}, 1)
+	if err != nil {
+		t.Fatalf("error finding duplicates: %v", err)
+	}
+
+	if len(groups) != 2 {
+		t.Fatalf("unexpected groups: %+v", groups)
+	}
+
+	if got, want := groups[0].Paths, []string{"root/d1/d1/f2", "root/d1/d2/f2", "root/d1/f2", "root/d2/d1/f2", "root/f2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected paths: %v, want %v", got, want)
+	}
+
+	if got, want := groups[0].ReclaimableBytes(), int64(16); got != want {
+		t.Errorf("unexpected reclaimable bytes: %v, want %v", got, want)
+	}
+
+	if got, want := groups[1].ReclaimableBytes(), int64(9); got != want {
+		t.Errorf("unexpected reclaimable bytes: %v, want %v", got, want)
+	}
+
+	// files smaller than the minimum size are not reported.
+	groups, err = FindDuplicateFiles(ctx, map[string]fs.Directory{"root": root}, 4)
+	if err != nil {
+		t.Fatalf("error finding duplicates: %v", err)
+	}
+
+	if len(groups) != 1 || groups[0].Size != 4 {
+		t.Errorf("unexpected groups: %+v", groups)
+	}
+}
@@ -0,0 +1,267 @@
+package snapshotfs
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/fs"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/object"
+	"github.com/kopia/kopia/snapshot"
+)
+
+// Types of graph nodes other than snapshot entry types.
+const (
+	// GraphNodeListing is an object storing a part of the listing of a directory, such as a page or a delta base.
+	GraphNodeListing = "listing"
+
+	// GraphNodeChunk is a content storing a part of an object split into multiple chunks.
+	GraphNodeChunk = "chunk"
+)
+
+// GraphNode is a node of the object graph, which is a snapshot entry, a directory listing object or a chunk.
+// Nodes are identified by object or content IDs, so entries with identical contents share a single node.
+type GraphNode struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+	Size int64  `json:"size"`
+
+	// Chunks is the number of contents storing the object and IndirectionLevels is the number
+	// of levels of indirect object lists, only set when chunks are included in the graph.
+	Chunks            int `json:"chunks,omitempty"`
+	IndirectionLevels int `json:"indirectionLevels,omitempty"`
+}
+
+// GraphEdge is a reference from one node of the object graph to another.
+type GraphEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+
+	// Name is the name of the directory entry for references from directories to their entries.
+	Name string `json:"name,omitempty"`
+}
+
+// ObjectGraph is the graph of objects referenced by a snapshot directory.
+type ObjectGraph struct {
+	Nodes []*GraphNode `json:"nodes"`
+	Edges []GraphEdge  `json:"edges"`
+
+	nodesByID map[string]*GraphNode
+}
+
+// ObjectGraphOptions specifies which parts of the snapshot are included in the object graph.
+type ObjectGraphOptions struct {
+	// MaxDepth limits the depth of directories included in the graph, 0 means unlimited.
+	MaxDepth int
+
+	// Chunks includes chunks of objects split into multiple contents in the graph.
+	Chunks bool
+}
+
+// BuildObjectGraph returns the graph of objects referenced by the provided snapshot directory.
+func BuildObjectGraph(ctx context.Context, rep *repo.Repository, root fs.Directory, opt ObjectGraphOptions) (*ObjectGraph, error) {
+	g := &ObjectGraph{
+		nodesByID: map[string]*GraphNode{},
+	}
+
+	h, ok := root.(object.HasObjectID)
+	if !ok {
+		return nil, errors.Errorf("directory does not have an object ID")
+	}
+
+	if _, err := g.addEntry(ctx, rep, root, h.ObjectID(), 1, opt); err != nil {
+		return nil, err
+	}
+
+	return g, nil
+}
+
+// addEntry adds the node of the entry and, unless it was already added, nodes of objects it references.
+func (g *ObjectGraph) addEntry(ctx context.Context, rep *repo.Repository, e fs.Entry, oid object.ID, depth int, opt ObjectGraphOptions) (string, error) {
+	id := string(oid)
+
+	if g.nodesByID[id] != nil {
+		return id, nil
+	}
+
+	n := &GraphNode{
+		ID:   id,
+		Type: string(graphEntryType(e)),
+		Size: e.Size(),
+	}
+
+	g.addNode(n)
+
+	if err := g.addChunks(ctx, rep, n, oid, opt); err != nil {
+		return "", err
+	}
+
+	dir, ok := e.(fs.Directory)
+	if !ok {
+		return id, nil
+	}
+
+	if err := g.addListingObjects(ctx, rep, dir, opt); err != nil {
+		return "", err
+	}
+
+	if opt.MaxDepth > 0 && depth >= opt.MaxDepth {
+		return id, nil
+	}
+
+	entries, err := dir.Readdir(ctx)
+	if err != nil {
+		return "", errors.Wrapf(err, "error reading directory %v", oid)
+	}
+
+	for _, child := range entries {
+		h, ok := child.(object.HasObjectID)
+		if !ok {
+			continue
+		}
+
+		childID, err := g.addEntry(ctx, rep, child, h.ObjectID(), depth+1, opt)
+		if err != nil {
+			return "", err
+		}
+
+		g.Edges = append(g.Edges, GraphEdge{From: id, To: childID, Name: child.Name()})
+	}
+
+	return id, nil
+}
+
+// addListingObjects adds nodes of pages and delta bases of the directory.
+func (g *ObjectGraph) addListingObjects(ctx context.Context, rep *repo.Repository, dir fs.Directory, opt ObjectGraphOptions) error {
+	oids, err := DirectoryObjectIDs(ctx, dir)
+	if err != nil {
+		return err
+	}
+
+	if len(oids) == 0 {
+		return nil
+	}
+
+	for _, oid := range oids[1:] {
+		id := string(oid)
+
+		if g.nodesByID[id] == nil {
+			n := &GraphNode{ID: id, Type: GraphNodeListing}
+
+			g.addNode(n)
+
+			if err := g.addChunks(ctx, rep, n, oid, opt); err != nil {
+				return err
+			}
+		}
+
+		g.Edges = append(g.Edges, GraphEdge{From: string(oids[0]), To: id})
+	}
+
+	return nil
+}
+
+// addChunks records the layout of the object in its node and adds nodes of its chunks when it's split into multiple contents.
+func (g *ObjectGraph) addChunks(ctx context.Context, rep *repo.Repository, n *GraphNode, oid object.ID, opt ObjectGraphOptions) error {
+	if !opt.Chunks {
+		return nil
+	}
+
+	l, err := rep.Objects.GetLayout(ctx, oid)
+	if err != nil {
+		return errors.Wrapf(err, "unable to get layout of %v", oid)
+	}
+
+	n.Chunks = len(l.Chunks)
+	n.IndirectionLevels = l.IndirectionLevels
+
+	if n.Type == GraphNodeListing {
+		n.Size = l.Length()
+	}
+
+	if l.IndirectionLevels == 0 {
+		// direct objects are stored in a single content.
+		return nil
+	}
+
+	for _, c := range l.Chunks {
+		id := string(c.Content.ID)
+
+		if g.nodesByID[id] == nil {
+			g.addNode(&GraphNode{ID: id, Type: GraphNodeChunk, Size: c.Length})
+		}
+
+		g.Edges = append(g.Edges, GraphEdge{From: n.ID, To: id})
+	}
+
+	return nil
+}
+
+func (g *ObjectGraph) addNode(n *GraphNode) {
+	g.nodesByID[n.ID] = n
+	g.Nodes = append(g.Nodes, n)
+}
+
+// WriteDOT writes the graph in the DOT format understood by Graphviz.
+func (g *ObjectGraph) WriteDOT(w io.Writer) error {
+	var sb strings.Builder
+
+	sb.WriteString("digraph kopia {\n")
+	sb.WriteString("  rankdir=LR;\n")
+	sb.WriteString("  node [fontname=\"monospace\", fontsize=10];\n")
+
+	for _, n := range g.Nodes {
+		label := fmt.Sprintf("%v\\n%v bytes", n.ID, n.Size)
+		if n.Chunks > 1 {
+			label += fmt.Sprintf("\\n%v chunks", n.Chunks)
+		}
+
+		fmt.Fprintf(&sb, "  %q [label=\"%v\", shape=%v];\n", n.ID, label, dotShape(n.Type))
+	}
+
+	for _, e := range g.Edges {
+		if e.Name != "" {
+			fmt.Fprintf(&sb, "  %q -> %q [label=%q];\n", e.From, e.To, e.Name)
+		} else {
+			fmt.Fprintf(&sb, "  %q -> %q [style=dashed];\n", e.From, e.To)
+		}
+	}
+
+	sb.WriteString("}\n")
+
+	_, err := io.WriteString(w, sb.String())
+
+	return err
+}
+
+func dotShape(nodeType string) string {
+	switch nodeType {
+	case string(snapshot.EntryTypeDirectory):
+		return "folder"
+	case string(snapshot.EntryTypeSymlink):
+		return "cds"
+	case GraphNodeListing:
+		return "note"
+	case GraphNodeChunk:
+		return "box3d"
+	default:
+		return "box"
+	}
+}
+
+func graphEntryType(e fs.Entry) snapshot.EntryType {
+	switch e.(type) {
+	case fs.Directory:
+		return snapshot.EntryTypeDirectory
+	case fs.Symlink:
+		return snapshot.EntryTypeSymlink
+	case fs.File:
+		return snapshot.EntryTypeFile
+	default:
+		return snapshot.EntryTypeUnknown
+	}
+}
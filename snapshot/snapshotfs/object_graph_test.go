@@ -0,0 +1,69 @@
+package snapshotfs
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/kopia/kopia/internal/testlogging"
+	"github.com/kopia/kopia/snapshot"
+	"github.com/kopia/kopia/snapshot/policy"
+)
+
+func TestBuildObjectGraph(t *testing.T) {
+	ctx := testlogging.Context(t)
+	th := newUploadTestHarness(ctx)
+
+	defer th.cleanup()
+
+	man, err := NewUploader(th.repo).Upload(ctx, th.sourceDir, policy.BuildTree(nil, policy.DefaultPolicy), snapshot.SourceInfo{})
+	if err != nil {
+		t.Fatalf("upload error: %v", err)
+	}
+
+	root := DirectoryEntry(th.repo, man.RootObjectID(), nil)
+
+	cases := []struct {
+		opt       ObjectGraphOptions
+		wantNodes int
+		wantEdges int
+	}{
+		// 3 distinct files, root, d1, d2 and a single node shared by the identical d1/d1, d1/d2 and d2/d1.
+		{ObjectGraphOptions{}, 7, 11},
+		{ObjectGraphOptions{Chunks: true}, 7, 11},
+		{ObjectGraphOptions{MaxDepth: 2}, 6, 5},
+		{ObjectGraphOptions{MaxDepth: 1}, 1, 0},
+	}
+
+	for _, tc := range cases {
+		g, err := BuildObjectGraph(ctx, th.repo, root, tc.opt)
+		if err != nil {
+			t.Fatalf("unable to build graph: %v", err)
+		}
+
+		if got, want := len(g.Nodes), tc.wantNodes; got != want {
+			t.Errorf("unexpected number of nodes with %+v: %v, want %v", tc.opt, got, want)
+		}
+
+		if got, want := len(g.Edges), tc.wantEdges; got != want {
+			t.Errorf("unexpected number of edges with %+v: %v, want %v", tc.opt, got, want)
+		}
+
+		if tc.opt.Chunks {
+			for _, n := range g.Nodes {
+				if n.Chunks != 1 {
+					t.Errorf("unexpected number of chunks of %v: %v", n.ID, n.Chunks)
+				}
+			}
+		}
+
+		var buf bytes.Buffer
+		if err := g.WriteDOT(&buf); err != nil {
+			t.Fatalf("unable to write DOT: %v", err)
+		}
+
+		if got, want := strings.Count(buf.String(), " -> "), tc.wantEdges; got != want {
+			t.Errorf("unexpected number of DOT edges: %v, want %v", got, want)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package snapshotfs
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/fs"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/content"
+	"github.com/kopia/kopia/repo/object"
+)
+
+// ReferencedContents returns sorted IDs of all contents needed to read the provided directory in its entirety,
+// including directory listings and contents of all files.
+func ReferencedContents(ctx context.Context, rep *repo.Repository, oid object.ID) ([]content.ID, error) {
+	var (
+		mu       sync.Mutex
+		contents = map[content.ID]bool{}
+	)
+
+	w := NewTreeWalker()
+	w.RootEntries = []fs.Entry{DirectoryEntry(rep, oid, nil)}
+	w.EntryID = func(e fs.Entry) interface{} { return e.(object.HasObjectID).ObjectID() }
+	w.ObjectCallback = func(e fs.Entry) error {
+		oids := []object.ID{e.(object.HasObjectID).ObjectID()}
+
+		// pages of large directories are stored in separate objects.
+		if dir, ok := e.(fs.Directory); ok {
+			var err error
+
+			if oids, err = DirectoryObjectIDs(ctx, dir); err != nil {
+				return err
+			}
+		}
+
+		for _, oid := range oids {
+			contentIDs, err := rep.Objects.VerifyObject(ctx, oid)
+			if err != nil {
+				return errors.Wrapf(err, "unable to get contents of %v", e.Name())
+			}
+
+			mu.Lock()
+			for _, cid := range contentIDs {
+				contents[cid] = true
+			}
+			mu.Unlock()
+		}
+
+		return nil
+	}
+
+	if err := w.Run(ctx); err != nil {
+		return nil, err
+	}
+
+	var result []content.ID
+	for cid := range contents {
+		result = append(result, cid)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i] < result[j]
+	})
+
+	return result, nil
+}
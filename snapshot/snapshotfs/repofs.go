@@ -3,6 +3,7 @@ package snapshotfs
 
 import (
 	"context"
+	"io"
 	"io/ioutil"
 	"os"
 	"time"
@@ -84,27 +85,26 @@ func (rd *repositoryDirectory) Summary() *fs.DirectorySummary {
 }
 
 func (rd *repositoryDirectory) Child(ctx context.Context, name string) (fs.Entry, error) {
-	return fs.ReadDirAndFindChild(ctx, rd, name)
-}
-
-func (rd *repositoryDirectory) Readdir(ctx context.Context) (fs.Entries, error) {
-	r, err := rd.repo.Objects.Open(ctx, rd.metadata.ObjectID)
+	de, err := findDirEntry(ctx, rd.repo, rd.metadata.ObjectID, name)
 	if err != nil {
 		return nil, err
 	}
-	defer r.Close() //nolint:errcheck
 
-	metadata, _, err := readDirEntries(r)
-	if err != nil {
-		return nil, err
+	if de == nil {
+		return nil, fs.ErrEntryNotFound
 	}
 
-	entries := make(fs.Entries, len(metadata))
-	for i, m := range metadata {
-		entries[i], err = EntryFromDirEntry(rd.repo, m)
-		if err != nil {
-			return nil, errors.Wrapf(err, "error parsing entry %v", m)
-		}
+	return EntryFromDirEntry(rd.repo, de)
+}
+
+func (rd *repositoryDirectory) Readdir(ctx context.Context) (fs.Entries, error) {
+	var entries fs.Entries
+
+	if err := rd.IterateEntries(ctx, func(ctx context.Context, e fs.Entry) error {
+		entries = append(entries, e)
+		return nil
+	}); err != nil {
+		return nil, err
 	}
 
 	entries.Sort()
@@ -112,6 +112,17 @@ func (rd *repositoryDirectory) Readdir(ctx context.Context) (fs.Entries, error)
 	return entries, nil
 }
 
+func (rd *repositoryDirectory) IterateEntries(ctx context.Context, cb fs.IterateEntriesCallback) error {
+	return iterateDirEntries(ctx, rd.repo, rd.metadata.ObjectID, func(m *snapshot.DirEntry) error {
+		e, err := EntryFromDirEntry(rd.repo, m)
+		if err != nil {
+			return errors.Wrapf(err, "error parsing entry %v", m)
+		}
+
+		return cb(ctx, e)
+	})
+}
+
 func (rf *repositoryFile) Open(ctx context.Context) (fs.Reader, error) {
 	r, err := rf.repo.Objects.Open(ctx, rf.metadata.ObjectID)
 	if err != nil {
@@ -121,6 +132,70 @@ func (rf *repositoryFile) Open(ctx context.Context) (fs.Reader, error) {
 	return withFileInfo(r, rf), nil
 }
 
+// ChangedRanges returns the ranges of the existing file whose contents differ from the chunks of the file,
+// which are found by comparing the content IDs of the chunks with hashes of data at the same positions.
+// Compressed chunks are always reported as changed since their IDs are computed from the compressed data.
+func (rf *repositoryFile) ChangedRanges(ctx context.Context, existing io.ReaderAt, existingSize int64) ([]fs.FileRange, error) {
+	l, err := rf.repo.Objects.GetLayout(ctx, rf.metadata.ObjectID)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to get file layout")
+	}
+
+	if l.InlineLength > 0 {
+		// inline objects are not split into chunks, the whole file is rewritten.
+		return []fs.FileRange{{Start: 0, Length: l.InlineLength}}, nil
+	}
+
+	var (
+		result []fs.FileRange
+		buf    []byte
+	)
+
+	for _, c := range l.Chunks {
+		same, err := rf.chunkMatches(c, existing, existingSize, &buf)
+		if err != nil {
+			return nil, err
+		}
+
+		if same {
+			continue
+		}
+
+		// merge with the previous range if adjacent.
+		if n := len(result); n > 0 && result[n-1].Start+result[n-1].Length == c.Start {
+			result[n-1].Length += c.Length
+			continue
+		}
+
+		result = append(result, fs.FileRange{Start: c.Start, Length: c.Length})
+	}
+
+	return result, nil
+}
+
+func (rf *repositoryFile) chunkMatches(c object.ChunkInfo, existing io.ReaderAt, existingSize int64, buf *[]byte) (bool, error) {
+	if c.Compressed || c.Start+c.Length > existingSize {
+		return false, nil
+	}
+
+	if int64(cap(*buf)) < c.Length {
+		*buf = make([]byte, c.Length)
+	}
+
+	data := (*buf)[0:c.Length]
+
+	if _, err := existing.ReadAt(data, c.Start); err != nil {
+		return false, errors.Wrap(err, "unable to read existing file")
+	}
+
+	cid, err := rf.repo.Content.ComputeContentID(data, c.Content.ID.Prefix())
+	if err != nil {
+		return false, err
+	}
+
+	return cid == c.Content.ID, nil
+}
+
 func (rsl *repositorySymlink) Readlink(ctx context.Context) (string, error) {
 	r, err := rsl.repo.Objects.Open(ctx, rsl.metadata.ObjectID)
 	if err != nil {
@@ -191,6 +266,27 @@ func DirectoryEntry(rep *repo.Repository, objectID object.ID, dirSummary *fs.Dir
 	return d.(fs.Directory)
 }
 
+// DirectoryObjectIDs returns the IDs of all objects storing the listing of a directory, which are the object
+// of the directory itself, the objects storing pages of large directories and the base objects of
+// delta-encoded directories.
+func DirectoryObjectIDs(ctx context.Context, d fs.Directory) ([]object.ID, error) {
+	rd, ok := d.(*repositoryDirectory)
+	if !ok {
+		if h, ok := d.(object.HasObjectID); ok {
+			return []object.ID{h.ObjectID()}, nil
+		}
+
+		return nil, nil
+	}
+
+	referenced, err := dirListingObjectIDs(ctx, rd.repo, rd.metadata.ObjectID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to read objects referenced by directory %v", rd.metadata.ObjectID)
+	}
+
+	return append([]object.ID{rd.metadata.ObjectID}, referenced...), nil
+}
+
 // SnapshotRoot returns fs.Entry representing the root of a snapshot.
 func SnapshotRoot(rep *repo.Repository, man *snapshot.Manifest) (fs.Entry, error) {
 	oid := man.RootObjectID()
@@ -202,7 +298,9 @@ func SnapshotRoot(rep *repo.Repository, man *snapshot.Manifest) (fs.Entry, error
 }
 
 var _ fs.Directory = (*repositoryDirectory)(nil)
+var _ fs.DirectoryIterator = (*repositoryDirectory)(nil)
 var _ fs.File = (*repositoryFile)(nil)
+var _ fs.ChangedRangesFinder = (*repositoryFile)(nil)
 var _ fs.Symlink = (*repositorySymlink)(nil)
 
 var _ snapshot.HasDirEntry = (*repositoryDirectory)(nil)
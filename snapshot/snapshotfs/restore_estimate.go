@@ -0,0 +1,89 @@
+package snapshotfs
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/object"
+)
+
+// RestoreEstimate describes how much data must be fetched from the storage to restore a directory.
+type RestoreEstimate struct {
+	ContentCount       int   `json:"contentCount"`
+	CachedContentCount int   `json:"cachedContentCount"`
+	CachedBytes        int64 `json:"cachedBytes"`
+	DownloadBytes      int64 `json:"downloadBytes"`
+
+	// BytesPerSecond is the throughput of downloading sample contents from the storage, zero if nothing was downloaded.
+	BytesPerSecond float64 `json:"bytesPerSecond"`
+}
+
+// EstimatedDownloadTime returns the expected time of downloading contents that are not cached
+// at the measured throughput, or zero when the throughput is unknown.
+func (e *RestoreEstimate) EstimatedDownloadTime() time.Duration {
+	if e.BytesPerSecond <= 0 {
+		return 0
+	}
+
+	return time.Duration(float64(e.DownloadBytes) / e.BytesPerSecond * float64(time.Second))
+}
+
+// EstimateRestore returns the amounts of data restoring the provided directory would read from the cache
+// and from the storage. To measure the throughput, contents that aren't cached are downloaded until
+// their total size reaches sampleBytes.
+func EstimateRestore(ctx context.Context, rep *repo.Repository, oid object.ID, sampleBytes int64) (*RestoreEstimate, error) {
+	contentIDs, err := ReferencedContents(ctx, rep, oid)
+	if err != nil {
+		return nil, err
+	}
+
+	est := &RestoreEstimate{
+		ContentCount: len(contentIDs),
+	}
+
+	var (
+		sampledBytes int64
+		sampleTime   time.Duration
+	)
+
+	for _, cid := range contentIDs {
+		ci, err := rep.Content.ContentInfo(ctx, cid)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to get information about content %v", cid)
+		}
+
+		cached, err := rep.Content.IsContentCached(ctx, cid)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to check content %v", cid)
+		}
+
+		if cached {
+			est.CachedContentCount++
+			est.CachedBytes += int64(ci.Length)
+
+			continue
+		}
+
+		est.DownloadBytes += int64(ci.Length)
+
+		if sampledBytes < sampleBytes {
+			t0 := time.Now() // allow:no-inject-time
+
+			if _, err := rep.Content.GetContent(ctx, cid); err != nil {
+				return nil, errors.Wrapf(err, "unable to read content %v", cid)
+			}
+
+			sampleTime += time.Since(t0) // allow:no-inject-time
+			sampledBytes += int64(ci.Length)
+		}
+	}
+
+	if sampleTime > 0 {
+		est.BytesPerSecond = float64(sampledBytes) / sampleTime.Seconds()
+	}
+
+	return est, nil
+}
@@ -0,0 +1,59 @@
+package snapshotfs
+
+import (
+	"testing"
+
+	"github.com/kopia/kopia/internal/testlogging"
+	"github.com/kopia/kopia/snapshot"
+	"github.com/kopia/kopia/snapshot/policy"
+)
+
+func TestEstimateRestore(t *testing.T) {
+	ctx := testlogging.Context(t)
+	th := newUploadTestHarness(ctx)
+
+	defer th.cleanup()
+
+	man, err := NewUploader(th.repo).Upload(ctx, th.sourceDir, policy.BuildTree(nil, policy.DefaultPolicy), snapshot.SourceInfo{})
+	if err != nil {
+		t.Fatalf("upload error: %v", err)
+	}
+
+	// contents that have not been written to the storage yet don't need to be downloaded.
+	if err := th.repo.Flush(ctx); err != nil {
+		t.Fatalf("flush error: %v", err)
+	}
+
+	contentIDs, err := ReferencedContents(ctx, th.repo, man.RootObjectID())
+	if err != nil {
+		t.Fatalf("unable to find contents: %v", err)
+	}
+
+	// 3 distinct files, root, d1, d2 and the directory shared by the identical d1/d1, d1/d2 and d2/d1.
+	if got, want := len(contentIDs), 7; got != want {
+		t.Errorf("unexpected number of contents: %v, want %v", got, want)
+	}
+
+	est, err := EstimateRestore(ctx, th.repo, man.RootObjectID(), 0)
+	if err != nil {
+		t.Fatalf("unable to estimate restore: %v", err)
+	}
+
+	// the repository does not use a cache, so everything must be downloaded.
+	if est.ContentCount != len(contentIDs) || est.CachedContentCount != 0 || est.CachedBytes != 0 || est.DownloadBytes == 0 {
+		t.Errorf("unexpected estimate: %+v", est)
+	}
+
+	if est.BytesPerSecond != 0 || est.EstimatedDownloadTime() != 0 {
+		t.Errorf("throughput should not be measured without sampling: %+v", est)
+	}
+
+	est, err = EstimateRestore(ctx, th.repo, man.RootObjectID(), 1<<20)
+	if err != nil {
+		t.Fatalf("unable to estimate restore: %v", err)
+	}
+
+	if est.BytesPerSecond <= 0 {
+		t.Errorf("throughput was not measured: %+v", est)
+	}
+}
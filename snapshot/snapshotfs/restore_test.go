@@ -0,0 +1,94 @@
+package snapshotfs
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kopia/kopia/fs"
+	"github.com/kopia/kopia/fs/localfs"
+	"github.com/kopia/kopia/internal/testlogging"
+	"github.com/kopia/kopia/snapshot"
+	"github.com/kopia/kopia/snapshot/policy"
+)
+
+func TestRestoreInPlace(t *testing.T) {
+	ctx := testlogging.Context(t)
+	th := newUploadTestHarness(ctx)
+
+	defer th.cleanup()
+
+	data := make([]byte, 20<<20)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	th.sourceDir.AddFile("large", data, defaultPermissions)
+
+	man, err := NewUploader(th.repo).Upload(ctx, th.sourceDir, policy.BuildTree(nil, policy.DefaultPolicy), snapshot.SourceInfo{})
+	if err != nil {
+		t.Fatalf("upload error: %v", err)
+	}
+
+	targetDir, err := ioutil.TempDir("", "kopia-restore")
+	if err != nil {
+		t.Fatalf("unable to create temp directory: %v", err)
+	}
+
+	defer os.RemoveAll(targetDir) //nolint:errcheck
+
+	opts := localfs.CopyOptions{
+		OverwriteDirectories: true,
+		OverwriteFiles:       true,
+		InPlaceUpdateMinSize: 1 << 20,
+	}
+
+	if err := RestoreRoot(ctx, th.repo, targetDir, man.RootObjectID(), opts); err != nil {
+		t.Fatalf("restore error: %v", err)
+	}
+
+	targetFile := filepath.Join(targetDir, "large")
+
+	// modify the beginning of the restored file and append some data.
+	modified := append(append([]byte{}, data...), "trailing data"...)
+	modified[100] ^= 0xff
+
+	if err := ioutil.WriteFile(targetFile, modified, 0600); err != nil {
+		t.Fatalf("unable to modify file: %v", err)
+	}
+
+	e, err := DirectoryEntry(th.repo, man.RootObjectID(), nil).Child(ctx, "large")
+	if err != nil {
+		t.Fatalf("unable to get file: %v", err)
+	}
+
+	f, err := os.Open(targetFile)
+	if err != nil {
+		t.Fatalf("unable to open file: %v", err)
+	}
+
+	ranges, err := e.(fs.ChangedRangesFinder).ChangedRanges(ctx, f, int64(len(modified)))
+	f.Close() //nolint:errcheck
+
+	if err != nil {
+		t.Fatalf("unable to get changed ranges: %v", err)
+	}
+
+	if len(ranges) != 1 || ranges[0].Start != 0 || ranges[0].Length >= int64(len(data)) {
+		t.Errorf("unexpected changed ranges: %v", ranges)
+	}
+
+	if err := RestoreRoot(ctx, th.repo, targetDir, man.RootObjectID(), opts); err != nil {
+		t.Fatalf("restore error: %v", err)
+	}
+
+	restored, err := ioutil.ReadFile(targetFile)
+	if err != nil {
+		t.Fatalf("unable to read restored file: %v", err)
+	}
+
+	if !bytes.Equal(restored, data) {
+		t.Errorf("unexpected contents of file updated in place")
+	}
+}
@@ -0,0 +1,113 @@
+package snapshotfs
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"path"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/fs"
+)
+
+// VerifyRestoreFailure describes an entry that could not be restored.
+type VerifyRestoreFailure struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+
+// VerifyRestoreStats describes the result of a verification-only restore.
+type VerifyRestoreStats struct {
+	Directories int                     `json:"directories"`
+	Files       int                     `json:"files"`
+	Symlinks    int                     `json:"symlinks"`
+	Bytes       int64                   `json:"bytes"`
+	Duration    time.Duration           `json:"duration"`
+	Failures    []*VerifyRestoreFailure `json:"failures,omitempty"`
+}
+
+// BytesPerSecond returns the throughput of reading files.
+func (s *VerifyRestoreStats) BytesPerSecond() float64 {
+	if s.Duration <= 0 {
+		return 0
+	}
+
+	return float64(s.Bytes) / s.Duration.Seconds()
+}
+
+// VerifyRestore goes through the restore of the provided entry, reading all directories, symbolic links and
+// the complete contents of files, which downloads, decrypts, decompresses and verifies the hashes of all contents
+// like a restore does, but without writing anything. Entries that can't be restored are reported in the
+// returned stats instead of stopping the verification.
+func VerifyRestore(ctx context.Context, root fs.Entry) (*VerifyRestoreStats, error) {
+	t0 := time.Now()
+	stats := &VerifyRestoreStats{}
+
+	if err := verifyRestoreEntry(ctx, root, ".", stats); err != nil {
+		return nil, err
+	}
+
+	stats.Duration = time.Since(t0)
+
+	return stats, nil
+}
+
+func verifyRestoreEntry(ctx context.Context, e fs.Entry, p string, stats *VerifyRestoreStats) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	var err error
+
+	switch e := e.(type) {
+	case fs.Directory:
+		stats.Directories++
+
+		var entries fs.Entries
+
+		if entries, err = e.Readdir(ctx); err == nil {
+			for _, c := range entries {
+				if err := verifyRestoreEntry(ctx, c, path.Join(p, c.Name()), stats); err != nil {
+					return err
+				}
+			}
+		}
+
+	case fs.Symlink:
+		stats.Symlinks++
+		_, err = e.Readlink(ctx)
+
+	case fs.File:
+		stats.Files++
+		err = verifyRestoreFile(ctx, e, stats)
+	}
+
+	if err != nil {
+		stats.Failures = append(stats.Failures, &VerifyRestoreFailure{Path: p, Error: err.Error()})
+	}
+
+	return nil
+}
+
+func verifyRestoreFile(ctx context.Context, f fs.File, stats *VerifyRestoreStats) error {
+	r, err := f.Open(ctx)
+	if err != nil {
+		return errors.Wrap(err, "unable to open file")
+	}
+	defer r.Close() //nolint:errcheck
+
+	n, err := io.Copy(ioutil.Discard, r)
+	stats.Bytes += n
+
+	if err != nil {
+		return errors.Wrap(err, "unable to read file")
+	}
+
+	if n != f.Size() {
+		return errors.Errorf("read %v bytes, expected %v", n, f.Size())
+	}
+
+	return nil
+}
@@ -0,0 +1,42 @@
+package snapshotfs
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/mockfs"
+	"github.com/kopia/kopia/internal/testlogging"
+)
+
+func TestVerifyRestore(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	root := mockfs.NewDirectory()
+	root.AddFile("f1", []byte("hello"), 0644)
+	root.AddDir("d1", 0755)
+	root.AddFile("d1/f2", []byte("world"), 0600)
+	root.AddDir("d1/d2", 0755).FailReaddir(errors.New("some error"))
+	root.AddFile("d1/f3", []byte("truncated"), 0600).SetContents([]byte("trunc"))
+
+	stats, err := VerifyRestore(ctx, root)
+	if err != nil {
+		t.Fatalf("unable to verify restore: %v", err)
+	}
+
+	if stats.Directories != 3 || stats.Files != 3 || stats.Bytes != 15 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+
+	if len(stats.Failures) != 2 {
+		t.Fatalf("unexpected failures: %v", len(stats.Failures))
+	}
+
+	if got, want := stats.Failures[0].Path, "d1/d2"; got != want {
+		t.Errorf("unexpected failure path: %v, want %v", got, want)
+	}
+
+	if got, want := stats.Failures[1].Error, "read 5 bytes, expected 9"; got != want {
+		t.Errorf("unexpected failure: %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,96 @@
+package snapshotfs
+
+import (
+	"archive/zip"
+	"context"
+	"io"
+	"path"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/fs"
+	"github.com/kopia/kopia/internal/iocopy"
+)
+
+// RestoreZip writes the contents of the provided directory as a ZIP archive to the given writer.
+// Symbolic links are stored as entries whose contents are the link targets.
+func RestoreZip(ctx context.Context, w io.Writer, dir fs.Directory) error {
+	zw := zip.NewWriter(w)
+
+	if err := writeZipDirectory(ctx, zw, "", dir); err != nil {
+		return err
+	}
+
+	return errors.Wrap(zw.Close(), "error finishing ZIP archive")
+}
+
+func writeZipDirectory(ctx context.Context, zw *zip.Writer, prefix string, dir fs.Directory) error {
+	entries, err := dir.Readdir(ctx)
+	if err != nil {
+		return errors.Wrapf(err, "error reading directory %q", prefix)
+	}
+
+	for _, e := range entries {
+		if err := writeZipEntry(ctx, zw, path.Join(prefix, e.Name()), e); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func writeZipEntry(ctx context.Context, zw *zip.Writer, name string, e fs.Entry) error {
+	hdr, err := zip.FileInfoHeader(e)
+	if err != nil {
+		return errors.Wrapf(err, "unable to create ZIP header for %q", name)
+	}
+
+	hdr.Name = name
+
+	switch e := e.(type) {
+	case fs.Directory:
+		hdr.Name += "/"
+
+		if _, err := zw.CreateHeader(hdr); err != nil {
+			return errors.Wrapf(err, "unable to write ZIP entry %q", name)
+		}
+
+		return writeZipDirectory(ctx, zw, name, e)
+
+	case fs.Symlink:
+		target, err := e.Readlink(ctx)
+		if err != nil {
+			return errors.Wrapf(err, "unable to read symlink %q", name)
+		}
+
+		w, err := zw.CreateHeader(hdr)
+		if err != nil {
+			return errors.Wrapf(err, "unable to write ZIP entry %q", name)
+		}
+
+		_, err = io.WriteString(w, target)
+
+		return errors.Wrapf(err, "unable to write symlink %q", name)
+
+	case fs.File:
+		hdr.Method = zip.Deflate
+
+		r, err := e.Open(ctx)
+		if err != nil {
+			return errors.Wrapf(err, "unable to open %q", name)
+		}
+		defer r.Close() //nolint:errcheck
+
+		w, err := zw.CreateHeader(hdr)
+		if err != nil {
+			return errors.Wrapf(err, "unable to write ZIP entry %q", name)
+		}
+
+		_, err = iocopy.Copy(w, r)
+
+		return errors.Wrapf(err, "unable to copy contents of %q", name)
+
+	default:
+		return errors.Errorf("unsupported entry type %T for %q", e, name)
+	}
+}
@@ -0,0 +1,67 @@
+package snapshotfs
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/kopia/kopia/internal/mockfs"
+	"github.com/kopia/kopia/internal/testlogging"
+)
+
+func TestRestoreZip(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	root := mockfs.NewDirectory()
+	root.AddFile("f1", []byte("hello"), 0644)
+	root.AddDir("d1", 0755)
+	root.AddFile("d1/f2", []byte("world"), 0600)
+	root.AddDir("d1/d2", 0755)
+
+	var buf bytes.Buffer
+
+	if err := RestoreZip(ctx, &buf, root); err != nil {
+		t.Fatalf("unable to create ZIP: %v", err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("invalid ZIP: %v", err)
+	}
+
+	want := map[string]string{
+		"f1":     "hello",
+		"d1/":    "",
+		"d1/f2":  "world",
+		"d1/d2/": "",
+	}
+
+	got := map[string]string{}
+
+	for _, f := range zr.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatalf("unable to open %v: %v", f.Name, err)
+		}
+
+		b, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatalf("unable to read %v: %v", f.Name, err)
+		}
+
+		r.Close() //nolint:errcheck
+
+		got[f.Name] = string(b)
+	}
+
+	if len(got) != len(want) {
+		t.Errorf("unexpected entries: %v, want %v", got, want)
+	}
+
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("invalid contents of %v: %q, want %q", k, got[k], v)
+		}
+	}
+}
@@ -14,6 +14,9 @@ import (
 	"github.com/kopia/kopia/snapshot"
 )
 
+// latestSnapshotName is the name of the symbolic link to the latest snapshot of a source.
+const latestSnapshotName = "latest"
+
 type sourceSnapshots struct {
 	rep *repo.Repository
 	src snapshot.SourceInfo
@@ -66,12 +69,16 @@ func (s *sourceSnapshots) Readdir(ctx context.Context) (fs.Entries, error) {
 		return nil, err
 	}
 
-	var result fs.Entries
+	var (
+		result fs.Entries
+		latest *snapshot.Manifest
+	)
 
 	for _, m := range manifests {
-		name := m.StartTime.Format("20060102-150405")
-		if m.IncompleteReason != "" {
-			name += fmt.Sprintf(" (%v)", m.IncompleteReason)
+		name := snapshotDirectoryName(m)
+
+		if m.IncompleteReason == "" && (latest == nil || m.StartTime.After(latest.StartTime)) {
+			latest = m
 		}
 
 		de := &snapshot.DirEntry{
@@ -94,9 +101,70 @@ func (s *sourceSnapshots) Readdir(ctx context.Context) (fs.Entries, error) {
 		result = append(result, e)
 	}
 
+	if latest != nil {
+		result = append(result, &latestSnapshotSymlink{
+			target:  snapshotDirectoryName(latest),
+			modTime: latest.StartTime,
+		})
+	}
+
 	result.Sort()
 
 	return result, nil
 }
 
+func snapshotDirectoryName(m *snapshot.Manifest) string {
+	name := m.StartTime.Format("20060102-150405")
+	if m.IncompleteReason != "" {
+		name += fmt.Sprintf(" (%v)", m.IncompleteReason)
+	}
+
+	return name
+}
+
+// latestSnapshotSymlink is a symbolic link pointing at the directory of the latest complete snapshot of a source.
+type latestSnapshotSymlink struct {
+	target  string
+	modTime time.Time
+}
+
+func (l *latestSnapshotSymlink) IsDir() bool {
+	return false
+}
+
+func (l *latestSnapshotSymlink) Name() string {
+	return latestSnapshotName
+}
+
+func (l *latestSnapshotSymlink) Mode() os.FileMode {
+	return 0555 | os.ModeSymlink
+}
+
+func (l *latestSnapshotSymlink) Size() int64 {
+	return int64(len(l.target))
+}
+
+func (l *latestSnapshotSymlink) Sys() interface{} {
+	return nil
+}
+
+func (l *latestSnapshotSymlink) ModTime() time.Time {
+	return l.modTime
+}
+
+func (l *latestSnapshotSymlink) Owner() fs.OwnerInfo {
+	return fs.OwnerInfo{}
+}
+
+func (l *latestSnapshotSymlink) Readlink(ctx context.Context) (string, error) {
+	return l.target, nil
+}
+
+// SourceSnapshotsEntry returns fs.Directory that contains one subdirectory per snapshot of the provided source,
+// named after the snapshot start time, and a 'latest' symbolic link pointing at the latest complete snapshot.
+func SourceSnapshotsEntry(rep *repo.Repository, src snapshot.SourceInfo) fs.Directory {
+	return &sourceSnapshots{rep, src}
+}
+
 var _ fs.Directory = (*sourceSnapshots)(nil)
+var _ fs.Symlink = (*latestSnapshotSymlink)(nil)
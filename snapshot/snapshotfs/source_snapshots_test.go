@@ -0,0 +1,61 @@
+package snapshotfs
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/kopia/kopia/fs"
+	"github.com/kopia/kopia/internal/testlogging"
+	"github.com/kopia/kopia/snapshot"
+	"github.com/kopia/kopia/snapshot/policy"
+)
+
+func TestSourceSnapshotsEntry(t *testing.T) {
+	ctx := testlogging.Context(t)
+	th := newUploadTestHarness(ctx)
+
+	defer th.cleanup()
+
+	src := snapshot.SourceInfo{Host: "host", UserName: "user", Path: "/some/path"}
+	t0 := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	for i, incomplete := range []string{"", "", "canceled"} {
+		man, err := NewUploader(th.repo).Upload(ctx, th.sourceDir, policy.BuildTree(nil, policy.DefaultPolicy), src)
+		if err != nil {
+			t.Fatalf("upload error: %v", err)
+		}
+
+		man.StartTime = t0.Add(time.Duration(i) * time.Hour)
+		man.IncompleteReason = incomplete
+
+		if _, err := snapshot.SaveSnapshot(ctx, th.repo, man); err != nil {
+			t.Fatalf("unable to save snapshot: %v", err)
+		}
+	}
+
+	dir := SourceSnapshotsEntry(th.repo, src)
+
+	entries, err := dir.Readdir(ctx)
+	if err != nil {
+		t.Fatalf("unable to read directory: %v", err)
+	}
+
+	if got, want := entryNames(entries), []string{"20200102-030405", "20200102-040405", "20200102-050405 (canceled)", "latest"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected entries: %v, want %v", got, want)
+	}
+
+	// incomplete snapshots are not considered the latest.
+	target, err := entries[3].(fs.Symlink).Readlink(ctx)
+	if err != nil {
+		t.Fatalf("unable to read link: %v", err)
+	}
+
+	if got, want := target, "20200102-040405"; got != want {
+		t.Errorf("unexpected latest snapshot: %v, want %v", got, want)
+	}
+
+	if _, ok := entries[0].(fs.Directory); !ok {
+		t.Errorf("snapshot entry is not a directory: %v", entries[0])
+	}
+}
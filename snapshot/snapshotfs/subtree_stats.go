@@ -0,0 +1,221 @@
+package snapshotfs
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/fs"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/content"
+	"github.com/kopia/kopia/repo/object"
+)
+
+// SubtreeStats describes the storage used by contents referenced by a directory subtree.
+type SubtreeStats struct {
+	// Path is the path of the subtree relative to the root directory, empty for the root itself.
+	Path string `json:"path"`
+
+	// ContentCount is the number of distinct contents referenced by the subtree.
+	ContentCount int `json:"contentCount"`
+
+	// TotalBytes is the stored size of distinct contents referenced by the subtree.
+	TotalBytes int64 `json:"totalBytes"`
+
+	// UniqueBytes is the stored size of contents that are not referenced anywhere else in the tree,
+	// which is the amount of storage attributable to the subtree alone.
+	UniqueBytes int64 `json:"uniqueBytes"`
+}
+
+// SharedBytes returns the stored size of contents that are also referenced outside of the subtree.
+func (s *SubtreeStats) SharedBytes() int64 {
+	return s.TotalBytes - s.UniqueBytes
+}
+
+// subtreeContent tracks the subtrees referencing a single content.
+type subtreeContent struct {
+	length int64
+	paths  map[string]bool // paths truncated to the maximum depth
+}
+
+type subtreeStatsCalculator struct {
+	rep      *repo.Repository
+	maxDepth int
+	contents map[content.ID]*subtreeContent
+}
+
+// CalculateSubtreeStats returns statistics of subtrees of the provided directory up to the given depth,
+// sorted by path. Contents are attributed to a subtree based on where they are referenced from,
+// with each content counted only once, so that subtrees responsible for most of the storage can be found.
+func CalculateSubtreeStats(ctx context.Context, rep *repo.Repository, root fs.Directory, maxDepth int) ([]SubtreeStats, error) {
+	c := &subtreeStatsCalculator{
+		rep:      rep,
+		maxDepth: maxDepth,
+		contents: map[content.ID]*subtreeContent{},
+	}
+
+	if err := c.walk(ctx, root, nil); err != nil {
+		return nil, err
+	}
+
+	return c.stats(), nil
+}
+
+func (c *subtreeStatsCalculator) walk(ctx context.Context, e fs.Entry, path []string) error {
+	if err := c.addObject(ctx, e, path); err != nil {
+		return err
+	}
+
+	dir, ok := e.(fs.Directory)
+	if !ok {
+		return nil
+	}
+
+	entries, err := dir.Readdir(ctx)
+	if err != nil {
+		return errors.Wrapf(err, "error reading directory %v", strings.Join(path, "/"))
+	}
+
+	for _, child := range entries {
+		if err := c.walk(ctx, child, append(path[0:len(path):len(path)], child.Name())); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// addObject records contents of the entry as referenced from the subtree containing it.
+func (c *subtreeStatsCalculator) addObject(ctx context.Context, e fs.Entry, path []string) error {
+	h, ok := e.(object.HasObjectID)
+	if !ok {
+		return nil
+	}
+
+	oids := []object.ID{h.ObjectID()}
+
+	// pages of large directories are stored in separate objects.
+	if dir, ok := e.(fs.Directory); ok {
+		var err error
+
+		if oids, err = DirectoryObjectIDs(ctx, dir); err != nil {
+			return err
+		}
+	}
+
+	var contentIDs []content.ID
+
+	for _, oid := range oids {
+		cids, err := c.rep.Objects.VerifyObject(ctx, oid)
+		if err != nil {
+			return errors.Wrapf(err, "unable to get contents of %v", strings.Join(path, "/"))
+		}
+
+		contentIDs = append(contentIDs, cids...)
+	}
+
+	if !e.IsDir() && len(path) > 0 {
+		// files are attributed to the directory containing them.
+		path = path[0 : len(path)-1]
+	}
+
+	if len(path) > c.maxDepth {
+		path = path[0:c.maxDepth]
+	}
+
+	p := strings.Join(path, "/")
+
+	for _, cid := range contentIDs {
+		sc := c.contents[cid]
+		if sc == nil {
+			ci, err := c.rep.Content.ContentInfo(ctx, cid)
+			if err != nil {
+				return errors.Wrapf(err, "unable to get information about content %v", cid)
+			}
+
+			sc = &subtreeContent{length: int64(ci.Length), paths: map[string]bool{}}
+			c.contents[cid] = sc
+		}
+
+		sc.paths[p] = true
+	}
+
+	return nil
+}
+
+func (c *subtreeStatsCalculator) stats() []SubtreeStats {
+	byPath := map[string]*SubtreeStats{}
+
+	get := func(p string) *SubtreeStats {
+		s := byPath[p]
+		if s == nil {
+			s = &SubtreeStats{Path: p}
+			byPath[p] = s
+		}
+
+		return s
+	}
+
+	for _, sc := range c.contents {
+		var (
+			referencing = map[string]bool{}
+			common      []string
+			first       = true
+		)
+
+		for p := range sc.paths {
+			parts := splitSubtreePath(p)
+
+			for i := 0; i <= len(parts); i++ {
+				referencing[strings.Join(parts[0:i], "/")] = true
+			}
+
+			if first {
+				common, first = parts, false
+			} else {
+				common = commonPathPrefix(common, parts)
+			}
+		}
+
+		for p := range referencing {
+			s := get(p)
+			s.ContentCount++
+			s.TotalBytes += sc.length
+		}
+
+		// the content is unique to the deepest subtree containing all references and its parents.
+		for i := 0; i <= len(common); i++ {
+			get(strings.Join(common[0:i], "/")).UniqueBytes += sc.length
+		}
+	}
+
+	var result []SubtreeStats
+	for _, s := range byPath {
+		result = append(result, *s)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Path < result[j].Path
+	})
+
+	return result
+}
+
+func splitSubtreePath(p string) []string {
+	if p == "" {
+		return nil
+	}
+
+	return strings.Split(p, "/")
+}
+
+func commonPathPrefix(a, b []string) []string {
+	n := 0
+	for n < len(a) && n < len(b) && a[n] == b[n] {
+		n++
+	}
+
+	return a[0:n]
+}
@@ -0,0 +1,71 @@
+package snapshotfs
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/kopia/kopia/fs"
+	"github.com/kopia/kopia/internal/testlogging"
+	"github.com/kopia/kopia/snapshot"
+	"github.com/kopia/kopia/snapshot/policy"
+)
+
+func TestCalculateSubtreeStats(t *testing.T) {
+	ctx := testlogging.Context(t)
+	th := newUploadTestHarness(ctx)
+
+	defer th.cleanup()
+
+	const uniqueLength = 1000
+
+	th.sourceDir.AddFile("d1/unique", bytes.Repeat([]byte{7}, uniqueLength), defaultPermissions)
+
+	man, err := NewUploader(th.repo).Upload(ctx, th.sourceDir, policy.BuildTree(nil, policy.DefaultPolicy), snapshot.SourceInfo{})
+	if err != nil {
+		t.Fatalf("upload error: %v", err)
+	}
+
+	root := DirectoryEntry(th.repo, man.RootObjectID(), nil).(fs.Directory)
+
+	stats, err := CalculateSubtreeStats(ctx, th.repo, root, 1)
+	if err != nil {
+		t.Fatalf("error calculating stats: %v", err)
+	}
+
+	byPath := map[string]SubtreeStats{}
+	for _, s := range stats {
+		byPath[s.Path] = s
+	}
+
+	if len(stats) != 3 {
+		t.Fatalf("unexpected subtrees: %+v", stats)
+	}
+
+	if s := byPath[""]; s.UniqueBytes != s.TotalBytes || s.TotalBytes == 0 {
+		t.Errorf("unexpected root stats: %+v", s)
+	}
+
+	d1, d2 := byPath["d1"], byPath["d2"]
+
+	// both subtrees reference files that also exist elsewhere.
+	if d1.SharedBytes() <= 0 || d2.SharedBytes() <= 0 {
+		t.Errorf("shared bytes not reported: %+v %+v", d1, d2)
+	}
+
+	if d1.UniqueBytes < uniqueLength {
+		t.Errorf("unique file not attributed to d1: %+v", d1)
+	}
+
+	if d2.UniqueBytes >= uniqueLength {
+		t.Errorf("unique file attributed to d2: %+v", d2)
+	}
+
+	deeper, err := CalculateSubtreeStats(ctx, th.repo, root, 2)
+	if err != nil {
+		t.Fatalf("error calculating stats: %v", err)
+	}
+
+	if len(deeper) != 6 {
+		t.Errorf("unexpected subtrees: %+v", deeper)
+	}
+}
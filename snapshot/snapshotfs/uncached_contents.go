@@ -0,0 +1,117 @@
+package snapshotfs
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/fs"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/content"
+	"github.com/kopia/kopia/repo/object"
+)
+
+type uncachedContentsFinder struct {
+	rep     *repo.Repository
+	checked map[content.ID]bool
+	missing []content.ID
+}
+
+// FindUncachedContents returns sorted IDs of contents referenced by the entry and its descendants which are not
+// available in the local cache, so the entry can't be read in its entirety without accessing the storage.
+// Descendants of directories that can't be read locally are not examined.
+func FindUncachedContents(ctx context.Context, rep *repo.Repository, e fs.Entry) ([]content.ID, error) {
+	f := &uncachedContentsFinder{
+		rep:     rep,
+		checked: map[content.ID]bool{},
+	}
+
+	if err := f.walk(ctx, e, nil); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(f.missing, func(i, j int) bool {
+		return f.missing[i] < f.missing[j]
+	})
+
+	return f.missing, nil
+}
+
+func (f *uncachedContentsFinder) walk(ctx context.Context, e fs.Entry, path []string) error {
+	dir, isDir := e.(fs.Directory)
+
+	// virtual directories, such as lists of snapshots, don't have object IDs but their entries do.
+	if h, ok := e.(object.HasObjectID); ok {
+		cached, err := f.checkObject(ctx, h.ObjectID(), path)
+		if err != nil || !cached || !isDir {
+			return err
+		}
+
+		// pages of large directories are stored in separate objects.
+		oids, err := DirectoryObjectIDs(ctx, dir)
+		if err != nil {
+			return err
+		}
+
+		for i := 1; i < len(oids); i++ {
+			if cached, err := f.checkObject(ctx, oids[i], path); err != nil || !cached {
+				return err
+			}
+		}
+	}
+
+	if !isDir {
+		return nil
+	}
+
+	entries, err := dir.Readdir(ctx)
+	if err != nil {
+		return errors.Wrapf(err, "error reading directory %v", strings.Join(path, "/"))
+	}
+
+	for _, child := range entries {
+		if err := f.walk(ctx, child, append(path[0:len(path):len(path)], child.Name())); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkObject records uncached contents of the object and returns true if all of them are cached.
+func (f *uncachedContentsFinder) checkObject(ctx context.Context, oid object.ID, path []string) (bool, error) {
+	if indexObjectID, ok := oid.IndexObjectID(); ok {
+		// contents of the object can only be determined after reading its index.
+		if cached, err := f.checkObject(ctx, indexObjectID, path); err != nil || !cached {
+			return cached, err
+		}
+	}
+
+	contentIDs, err := f.rep.Objects.VerifyObject(ctx, oid)
+	if err != nil {
+		return false, errors.Wrapf(err, "unable to get contents of %v", strings.Join(path, "/"))
+	}
+
+	allCached := true
+
+	for _, cid := range contentIDs {
+		cached, ok := f.checked[cid]
+		if !ok {
+			if cached, err = f.rep.Content.IsContentCached(ctx, cid); err != nil {
+				return false, errors.Wrapf(err, "unable to check content %v", cid)
+			}
+
+			f.checked[cid] = cached
+
+			if !cached {
+				f.missing = append(f.missing, cid)
+			}
+		}
+
+		allCached = allCached && cached
+	}
+
+	return allCached, nil
+}
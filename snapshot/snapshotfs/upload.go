@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"hash/fnv"
 	"io"
+	"io/ioutil"
 	"os"
 	"path"
 	"path/filepath"
@@ -13,6 +14,7 @@ import (
 	"sort"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/pkg/errors"
 	"golang.org/x/sync/errgroup"
@@ -20,6 +22,7 @@ import (
 	"github.com/kopia/kopia/fs"
 	"github.com/kopia/kopia/fs/ignorefs"
 	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/compression"
 	"github.com/kopia/kopia/repo/logging"
 	"github.com/kopia/kopia/repo/object"
 	"github.com/kopia/kopia/snapshot"
@@ -32,11 +35,27 @@ var log = logging.GetContextLoggerFunc("kopia/upload")
 
 var errCancelled = errors.New("canceled")
 
+// errSensitiveFileSkipped is returned when a file is not uploaded because of the screening policy.
+var errSensitiveFileSkipped = errors.New("sensitive file skipped")
+
+// DefaultDirectoryPageSize is the default maximum number of entries stored in a single directory object.
+const DefaultDirectoryPageSize = 10000
+
+const minDirectoryPageSize = 2
+
+// maxDirectoryDeltaDepth is the maximum length of the chain of delta-encoded directories
+// that must be read to list a directory, after which the directory is stored in full again.
+const maxDirectoryDeltaDepth = 4
+
+// DeterministicTime is the timestamp recorded in deterministic snapshots instead of modification,
+// start and end times.
+var DeterministicTime = time.Unix(0, 0).UTC()
+
 // Uploader supports efficient uploading files and directories to repository.
 type Uploader struct {
 	Progress UploadProgress
 
-	// automatically cancel the Upload after certain number of bytes
+	// automatically cancel the Upload after certain number of bytes of new contents
 	MaxUploadBytes int64
 
 	// ignore read errors
@@ -50,10 +69,38 @@ type Uploader struct {
 	// Number of files to hash and upload in parallel.
 	ParallelUploads int
 
-	repo *repo.Repository
+	// compute what would be uploaded without writing anything to the repository
+	DryRun bool
+
+	// make snapshots of identical trees produce identical object IDs by replacing timestamps with
+	// DeterministicTime, clearing ownership and not reusing entries of previous snapshots
+	Deterministic bool
+
+	// maximum number of entries stored in a single directory object, larger directories are split into pages.
+	// defaults to DefaultDirectoryPageSize
+	DirectoryPageSize int
 
-	stats    snapshot.Stats
-	canceled int32
+	// if set, file data is written in turns with other uploaders sharing the same FairScheduler.
+	FairShare *FairShare
+
+	repo     *repo.Repository
+	objects  *object.Manager
+	contents *uploadContentManager
+
+	statsMutex     sync.Mutex
+	stats          snapshot.Stats
+	sensitiveFiles []*snapshot.SensitiveFile
+	canaryChanges  []*snapshot.CanaryChange
+	canceled       int32
+
+	// when rehashing all files, previous snapshots are only used to report changes.
+	rehashAll bool
+
+	// limits the number of files uploaded in parallel across all directories
+	uploadSemaphore chan struct{}
+
+	// maximum number of entries of a directory held in memory, defaults to defaultMaxInMemoryDirEntries
+	maxInMemoryEntries int
 
 	uploadBufPool sync.Pool
 }
@@ -68,31 +115,71 @@ func (u *Uploader) cancelReason() string {
 		return "canceled"
 	}
 
-	_, wb := u.repo.Content.Stats.WrittenContent()
-	if mub := u.MaxUploadBytes; mub > 0 && wb > mub {
-		return "limit reached"
+	if mub := u.MaxUploadBytes; mub > 0 && u.contents != nil {
+		// only count contents written by this upload, the repository may be shared by concurrent uploads.
+		if _, wb, _ := u.contents.stats(); wb > mub {
+			return "limit reached"
+		}
 	}
 
 	return ""
 }
 
-func (u *Uploader) uploadFileInternal(ctx context.Context, relativePath string, f fs.File, pol *policy.Policy) (*snapshot.DirEntry, error) {
+func (u *Uploader) uploadFileInternal(ctx context.Context, relativePath string, f fs.File, pol *policy.Policy, splitPoints []int64) (*snapshot.DirEntry, error) {
 	u.Progress.HashingFile(relativePath)
 	defer u.Progress.FinishedHashingFile(relativePath, f.Size())
 
-	file, err := f.Open(ctx)
+	file, err := openWithTimeout(ctx, f, pol.ErrorHandlingPolicy.IOTimeout())
 	if err != nil {
 		return nil, errors.Wrap(err, "unable to open file")
 	}
 	defer file.Close() //nolint:errcheck
 
-	writer := u.repo.Objects.NewWriter(ctx, object.WriterOptions{
+	var src io.Reader = file
+
+	if pol.ScreeningPolicy.Enabled() {
+		if src, err = u.screenFile(relativePath, f, file, &pol.ScreeningPolicy); err != nil {
+			return nil, err
+		}
+	}
+
+	if pol.CompressionPolicy.ShouldInlineFile(f) {
+		maxSize := pol.CompressionPolicy.InlineFilesMaxSizeOrDefault(0)
+
+		data, err := ioutil.ReadAll(io.LimitReader(src, maxSize+1))
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to read file")
+		}
+
+		if int64(len(data)) <= maxSize {
+			u.Progress.HashedBytes(int64(len(data)))
+			return inlineFileEntry(file, data)
+		}
+
+		// the file has grown past the inline size limit since it was listed.
+		src = io.MultiReader(bytes.NewReader(data), src)
+	}
+
+	opts := object.WriterOptions{
 		Description: "FILE:" + f.Name(),
 		Compressor:  pol.CompressionPolicy.CompressorForFile(f),
-	})
+		SplitPoints: splitPoints,
+
+		AdaptiveCompression: pol.CompressionPolicy.AdaptiveCompressionOrDefault(false),
+	}
+
+	if pol.EncryptedDataPolicy.EncryptedOrDefault(false) {
+		// encrypted data won't compress and won't deduplicate with content-defined chunks.
+		opts.Compressor = ""
+		opts.AdaptiveCompression = false
+		opts.SplitPoints = nil
+		opts.Splitter = pol.EncryptedDataPolicy.Splitter
+	}
+
+	writer := u.objects.NewWriter(ctx, opts)
 	defer writer.Close() //nolint:errcheck
 
-	written, err := u.copyWithProgress(writer, file, 0, f.Size())
+	written, err := u.copyWithProgress(ctx, writer, src, 0, f.Size())
 	if err != nil {
 		return nil, err
 	}
@@ -117,21 +204,43 @@ func (u *Uploader) uploadFileInternal(ctx context.Context, relativePath string,
 	return de, nil
 }
 
-func (u *Uploader) uploadSymlinkInternal(ctx context.Context, relativePath string, f fs.Symlink) (*snapshot.DirEntry, error) {
+// inlineFileEntry returns the directory entry of a file whose contents are stored inline in its object ID.
+func inlineFileEntry(file fs.Reader, data []byte) (*snapshot.DirEntry, error) {
+	fi, err := file.Entry()
+	if err != nil {
+		return nil, err
+	}
+
+	de, err := newDirEntry(fi, object.InlineObjectID(data))
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to create dir entry")
+	}
+
+	de.FileSize = int64(len(data))
+
+	return de, nil
+}
+
+func (u *Uploader) uploadSymlinkInternal(ctx context.Context, relativePath string, f fs.Symlink, ioTimeout time.Duration) (*snapshot.DirEntry, error) {
 	u.Progress.HashingFile(relativePath)
 	defer u.Progress.FinishedHashingFile(relativePath, f.Size())
 
-	target, err := f.Readlink(ctx)
-	if err != nil {
+	var target string
+
+	if err := withIOTimeout(ctx, "reading symlink", ioTimeout, func() error {
+		var err error
+		target, err = f.Readlink(ctx)
+		return err
+	}); err != nil {
 		return nil, errors.Wrap(err, "unable to read symlink")
 	}
 
-	writer := u.repo.Objects.NewWriter(ctx, object.WriterOptions{
+	writer := u.objects.NewWriter(ctx, object.WriterOptions{
 		Description: "SYMLINK:" + f.Name(),
 	})
 	defer writer.Close() //nolint:errcheck
 
-	written, err := u.copyWithProgress(writer, bytes.NewBufferString(target), 0, f.Size())
+	written, err := u.copyWithProgress(ctx, writer, bytes.NewBufferString(target), 0, f.Size())
 	if err != nil {
 		return nil, err
 	}
@@ -151,7 +260,7 @@ func (u *Uploader) uploadSymlinkInternal(ctx context.Context, relativePath strin
 	return de, nil
 }
 
-func (u *Uploader) copyWithProgress(dst io.Writer, src io.Reader, completed, length int64) (int64, error) {
+func (u *Uploader) copyWithProgress(ctx context.Context, dst io.Writer, src io.Reader, completed, length int64) (int64, error) {
 	uploadBufPtr := u.uploadBufPool.Get().(*[]byte)
 	defer u.uploadBufPool.Put(uploadBufPtr)
 
@@ -166,7 +275,7 @@ func (u *Uploader) copyWithProgress(dst io.Writer, src io.Reader, completed, len
 
 		readBytes, readErr := src.Read(uploadBuf)
 		if readBytes > 0 {
-			wroteBytes, writeErr := dst.Write(uploadBuf[0:readBytes])
+			wroteBytes, writeErr := u.writeChunk(ctx, dst, uploadBuf[0:readBytes])
 			if wroteBytes > 0 {
 				written += int64(wroteBytes)
 				completed += int64(wroteBytes)
@@ -198,6 +307,23 @@ func (u *Uploader) copyWithProgress(dst io.Writer, src io.Reader, completed, len
 	return written, nil
 }
 
+// writeChunk writes the chunk of data, waiting for the turn if the uploader has a FairShare.
+func (u *Uploader) writeChunk(ctx context.Context, dst io.Writer, chunk []byte) (int, error) {
+	if u.FairShare == nil {
+		return dst.Write(chunk)
+	}
+
+	if err := u.FairShare.acquire(ctx); err != nil {
+		return 0, err
+	}
+
+	n, err := dst.Write(chunk)
+
+	u.FairShare.release(int64(n))
+
+	return n, err
+}
+
 func newDirEntry(md fs.Entry, oid object.ID) (*snapshot.DirEntry, error) {
 	var entryType snapshot.EntryType
 
@@ -226,7 +352,11 @@ func newDirEntry(md fs.Entry, oid object.ID) (*snapshot.DirEntry, error) {
 
 // uploadFile uploads the specified File to the repository.
 func (u *Uploader) uploadFile(ctx context.Context, relativePath string, file fs.File, pol *policy.Policy) (*snapshot.DirEntry, error) {
-	res, err := u.uploadFileInternal(ctx, relativePath, file, pol)
+	res, err := u.uploadFileInternal(ctx, relativePath, file, pol, nil)
+	if err == errSensitiveFileSkipped {
+		return nil, errors.Errorf("%v was not uploaded because it is sensitive", relativePath)
+	}
+
 	if err != nil {
 		return nil, err
 	}
@@ -264,62 +394,19 @@ func (u *Uploader) uploadDir(ctx context.Context, rootDir fs.Directory, policyTr
 	return de, err
 }
 
-func (u *Uploader) foreachEntryUnlessCancelled(ctx context.Context, parallel int, relativePath string, entries fs.Entries, cb func(ctx context.Context, entry fs.Entry, entryRelativePath string) error) error {
-	if parallel > len(entries) {
-		// don't launch more goroutines than needed
-		parallel = len(entries)
-	}
-
-	if parallel == 0 {
-		return nil
-	}
-
-	ch := make(chan fs.Entry)
-	eg, ctx := errgroup.WithContext(ctx)
-
-	// one goroutine to pump entries into channel until ctx is closed.
-	eg.Go(func() error {
-		defer close(ch)
-
-		for _, e := range entries {
-			select {
-			case ch <- e: // sent to channel
-			case <-ctx.Done(): // context closed
-				return nil
-			}
-		}
-		return nil
-	})
-
-	// launch N workers in parallel
-	for i := 0; i < parallel; i++ {
-		eg.Go(func() error {
-			for entry := range ch {
-				if u.IsCancelled() {
-					return errCancelled
-				}
-
-				entryRelativePath := path.Join(relativePath, entry.Name())
-				if err := cb(ctx, entry, entryRelativePath); err != nil {
-					return err
-				}
-			}
-
-			return nil
-		})
-	}
-
-	return eg.Wait()
-}
-
-func (u *Uploader) populateChildEntries(parent *snapshot.DirManifest, children <-chan *snapshot.DirEntry) {
+func (u *Uploader) populateChildEntries(parent *snapshot.DirManifest, entries *dirEntryCollector, children <-chan *snapshot.DirEntry) {
 	parentSummary := parent.Summary
 
 	for de := range children {
+		u.maybeNormalizeEntry(de)
+
 		switch de.Type {
 		case snapshot.EntryTypeFile:
+			u.statsMutex.Lock()
 			u.stats.TotalFileCount++
 			u.stats.TotalFileSize += de.FileSize
+			u.statsMutex.Unlock()
+
 			parentSummary.TotalFileCount++
 			parentSummary.TotalFileSize += de.FileSize
 
@@ -332,6 +419,7 @@ func (u *Uploader) populateChildEntries(parent *snapshot.DirManifest, children <
 				parentSummary.TotalFileCount += childSummary.TotalFileCount
 				parentSummary.TotalFileSize += childSummary.TotalFileSize
 				parentSummary.TotalDirCount += childSummary.TotalDirCount
+				parentSummary.AddFailedEntries(childSummary.FailedEntryCount, childSummary.FailedEntries...)
 
 				if childSummary.MaxModTime.After(parentSummary.MaxModTime) {
 					parentSummary.MaxModTime = childSummary.MaxModTime
@@ -339,25 +427,33 @@ func (u *Uploader) populateChildEntries(parent *snapshot.DirManifest, children <
 			}
 		}
 
-		parent.Entries = append(parent.Entries, de)
+		entries.add(de)
 	}
+}
 
-	// sort the result, directories first, then non-directories, ordered by name
-	sort.Slice(parent.Entries, func(i, j int) bool {
-		if leftDir, rightDir := isDir(parent.Entries[i]), isDir(parent.Entries[j]); leftDir != rightDir {
-			// directories get sorted before non-directories
-			return leftDir
-		}
+// maybeNormalizeEntry removes metadata that differs between identical trees from the entry in deterministic mode.
+func (u *Uploader) maybeNormalizeEntry(de *snapshot.DirEntry) {
+	if !u.Deterministic {
+		return
+	}
 
-		return parent.Entries[i].Name < parent.Entries[j].Name
-	})
+	de.ModTime = DeterministicTime
+	de.UserID = 0
+	de.GroupID = 0
+
+	if de.DirSummary != nil {
+		de.DirSummary.MaxModTime = DeterministicTime
+	}
 }
 
 func isDir(e *snapshot.DirEntry) bool {
 	return e.Type == snapshot.EntryTypeDirectory
 }
 
-func (u *Uploader) processChildren(ctx context.Context, dirManifest *snapshot.DirManifest, relativePath string, entries fs.Entries, policyTree *policy.Tree, previousEntries []fs.Entries) error {
+// processChildren uploads the entries of a directory as they are listed, so that the listing does not need to be
+// held in memory. Subdirectories are uploaded one at a time as they are encountered, while files and symlinks are
+// handed to a pool of workers.
+func (u *Uploader) processChildren(ctx context.Context, dirManifest *snapshot.DirManifest, entries *dirEntryCollector, relativePath string, directory fs.Directory, policyTree *policy.Tree, previousEntries *previousEntries) error {
 	var wg sync.WaitGroup
 
 	// channel where we will add directory and file entries, possibly in parallel
@@ -368,73 +464,145 @@ func (u *Uploader) processChildren(ctx context.Context, dirManifest *snapshot.Di
 
 	go func() {
 		defer wg.Done()
-		u.populateChildEntries(dirManifest, output)
+		u.populateChildEntries(dirManifest, entries, output)
 	}()
 
+	// entries that timed out, which fail only themselves instead of the entire snapshot.
+	var (
+		failedMutex sync.Mutex
+		failed      []*fs.EntryWithError
+	)
+
+	recordFailure := func(entryPath string, err error) {
+		log(ctx).Warningf("unable to read %v: %v", entryPath, err)
+
+		u.statsMutex.Lock()
+		u.stats.ReadErrors++
+		u.statsMutex.Unlock()
+
+		failedMutex.Lock()
+		failed = append(failed, &fs.EntryWithError{EntryPath: entryPath, Error: err.Error()})
+		failedMutex.Unlock()
+	}
+
 	defer func() {
 		// before this function returns, close the output channel and wait for the goroutine above to complete.
 		close(output)
 		wg.Wait()
+
+		dirManifest.Summary.AddFailedEntries(len(failed), failed...)
 	}()
 
-	if err := u.processSubdirectories(ctx, output, relativePath, entries, policyTree, previousEntries); err != nil {
-		return err
-	}
+	nonDirectories := make(chan fs.Entry)
+	eg, ctx := errgroup.WithContext(ctx)
 
-	if err := u.processNonDirectories(ctx, output, relativePath, entries, policyTree, previousEntries); err != nil {
-		return err
-	}
+	// launch workers processing non-directories, the number of files being uploaded at the same time
+	// across all directories is limited by u.uploadSemaphore.
+	for i := 0; i < cap(u.uploadSemaphore); i++ {
+		eg.Go(func() error {
+			for entry := range nonDirectories {
+				if u.IsCancelled() {
+					return errCancelled
+				}
 
-	return nil
-}
+				u.uploadSemaphore <- struct{}{}
+				err := u.processNonDirectory(ctx, output, relativePath, entry, policyTree, previousEntries)
+				<-u.uploadSemaphore
+
+				if isIOTimeout(err) {
+					recordFailure(path.Join(relativePath, entry.Name()), err)
+					continue
+				}
 
-func (u *Uploader) processSubdirectories(ctx context.Context, output chan *snapshot.DirEntry, relativePath string, entries fs.Entries, policyTree *policy.Tree, previousEntries []fs.Entries) error {
-	// for now don't process subdirectories in parallel, we need a mechanism to
-	// prevent explosion of parallelism
-	const parallelism = 1
+				if err != nil {
+					return err
+				}
+			}
 
-	return u.foreachEntryUnlessCancelled(ctx, parallelism, relativePath, entries, func(ctx context.Context, entry fs.Entry, entryRelativePath string) error {
-		dir, ok := entry.(fs.Directory)
-		if !ok {
-			// skip non-directories
 			return nil
-		}
+		})
+	}
 
-		var previousDirs []fs.Directory
-		for _, e := range previousEntries {
-			if d, _ := e.FindByName(entry.Name()).(fs.Directory); d != nil {
-				previousDirs = append(previousDirs, d)
-			}
-		}
+	eg.Go(func() error {
+		defer close(nonDirectories)
 
-		previousDirs = uniqueDirectories(previousDirs)
+		var cbErr error
 
-		oid, subdirsumm, err := uploadDirInternal(ctx, u, dir, policyTree.Child(entry.Name()), previousDirs, entryRelativePath)
-		if err == errCancelled {
-			return err
-		}
+		ioTimeout := policyTree.EffectivePolicy().ErrorHandlingPolicy.IOTimeout()
 
-		if err != nil {
-			// Note: This only catches errors in subdirectories of the snapshot root, not on the snapshot
-			// root itself. The intention is to always fail if the top level directory can't be read,
-			// otherwise a meaningless, empty snapshot is created that can't be restored.
-			ignoreDirErr := u.shouldIgnoreDirectoryReadErrors(policyTree)
-			if _, ok := err.(dirReadError); ok && ignoreDirErr {
-				log(ctx).Warningf("unable to read directory %q: %s, ignoring", dir.Name(), err)
-				return nil
+		if err := iterateEntriesWithTimeout(ctx, directory, ioTimeout, func(ctx context.Context, entry fs.Entry) error {
+			cbErr = u.processChild(ctx, output, nonDirectories, relativePath, entry, policyTree, previousEntries)
+			if isIOTimeout(cbErr) {
+				// the subdirectory has timed out.
+				recordFailure(path.Join(relativePath, entry.Name()), cbErr)
+				cbErr = nil
 			}
-			return errors.Errorf("unable to process directory %q: %s", entry.Name(), err)
-		}
 
-		de, err := newDirEntry(dir, oid)
-		if err != nil {
-			return errors.Wrap(err, "unable to create dir entry")
+			return cbErr
+		}); err != nil {
+			if cbErr != nil {
+				return cbErr
+			}
+
+			return dirReadError{err}
 		}
 
-		de.DirSummary = &subdirsumm
-		output <- de
 		return nil
 	})
+
+	return eg.Wait()
+}
+
+func (u *Uploader) processChild(ctx context.Context, output chan *snapshot.DirEntry, nonDirectories chan fs.Entry, relativePath string, entry fs.Entry, policyTree *policy.Tree, previousEntries *previousEntries) error {
+	if u.IsCancelled() {
+		return errCancelled
+	}
+
+	if dir, ok := entry.(fs.Directory); ok {
+		// for now don't process subdirectories in parallel, we need a mechanism to
+		// prevent explosion of parallelism
+		return u.processSubdirectory(ctx, output, path.Join(relativePath, entry.Name()), dir, policyTree, previousEntries)
+	}
+
+	select {
+	case nonDirectories <- entry:
+		return nil
+
+	case <-ctx.Done():
+		// one of the workers has failed and will report the error.
+		return ctx.Err()
+	}
+}
+
+func (u *Uploader) processSubdirectory(ctx context.Context, output chan *snapshot.DirEntry, entryRelativePath string, dir fs.Directory, policyTree *policy.Tree, previousEntries *previousEntries) error {
+	previousDirs := previousEntries.directories(ctx, dir.Name())
+
+	oid, subdirsumm, err := uploadDirInternal(ctx, u, dir, policyTree.Child(dir.Name()), previousDirs, entryRelativePath)
+	if err == errCancelled || isIOTimeout(err) {
+		return err
+	}
+
+	if err != nil {
+		// Note: This only catches errors in subdirectories of the snapshot root, not on the snapshot
+		// root itself. The intention is to always fail if the top level directory can't be read,
+		// otherwise a meaningless, empty snapshot is created that can't be restored.
+		ignoreDirErr := u.shouldIgnoreDirectoryReadErrors(policyTree)
+		if _, ok := err.(dirReadError); ok && ignoreDirErr {
+			log(ctx).Warningf("unable to read directory %q: %s, ignoring", dir.Name(), err)
+			return nil
+		}
+		return errors.Errorf("unable to process directory %q: %s", dir.Name(), err)
+	}
+
+	de, err := newDirEntry(dir, oid)
+	if err != nil {
+		return errors.Wrap(err, "unable to create dir entry")
+	}
+
+	de.DirSummary = &subdirsumm
+	output <- de
+
+	return nil
 }
 
 func metadataEquals(e1, e2 fs.Entry) bool {
@@ -457,15 +625,13 @@ func metadataEquals(e1, e2 fs.Entry) bool {
 	return true
 }
 
-func findCachedEntry(ctx context.Context, entry fs.Entry, prevEntries []fs.Entries) fs.Entry {
-	for _, e := range prevEntries {
-		if ent := e.FindByName(entry.Name()); ent != nil {
-			if metadataEquals(entry, ent) {
-				return ent
-			}
-
-			log(ctx).Debugf("found non-matching entry for %v: %v %v %v", entry.Name(), ent.Mode(), ent.Size(), ent.ModTime())
+func findCachedEntry(ctx context.Context, entry fs.Entry, prevEntries *previousEntries) fs.Entry {
+	for _, ent := range prevEntries.findAll(ctx, entry.Name()) {
+		if metadataEquals(entry, ent) {
+			return ent
 		}
+
+		log(ctx).Debugf("found non-matching entry for %v: %v %v %v", entry.Name(), ent.Mode(), ent.Size(), ent.ModTime())
 	}
 
 	log(ctx).Debugf("could not find cache entry for %v", entry.Name())
@@ -482,6 +648,10 @@ func objectIDPercent(obj object.ID) int {
 }
 
 func (u *Uploader) maybeIgnoreCachedEntry(ctx context.Context, ent fs.Entry) fs.Entry {
+	if u.rehashAll {
+		return nil
+	}
+
 	if h, ok := ent.(object.HasObjectID); ok {
 		if objectIDPercent(h.ObjectID()) < u.ForceHashPercentage {
 			log(ctx).Debugf("ignoring valid cached object: %v", h.ObjectID())
@@ -494,58 +664,108 @@ func (u *Uploader) maybeIgnoreCachedEntry(ctx context.Context, ent fs.Entry) fs.
 	return nil
 }
 
-func (u *Uploader) processNonDirectories(ctx context.Context, output chan *snapshot.DirEntry, dirRelativePath string, entries fs.Entries, policyTree *policy.Tree, prevEntries []fs.Entries) error {
-	workerCount := u.ParallelUploads
-	if workerCount == 0 {
-		workerCount = runtime.NumCPU()
-	}
+func (u *Uploader) processNonDirectory(ctx context.Context, output chan *snapshot.DirEntry, dirRelativePath string, entry fs.Entry, policyTree *policy.Tree, prevEntries *previousEntries) error {
+	// note this function runs in parallel and updates 'u.stats', which must be done using atomic operations.
 
-	return u.foreachEntryUnlessCancelled(ctx, workerCount, dirRelativePath, entries, func(ctx context.Context, entry fs.Entry, entryRelativePath string) error {
-		// note this function runs in parallel and updates 'u.stats', which must be done using atomic operations.
-		if _, ok := entry.(fs.Directory); ok {
-			// skip directories
+	// See if we had this name during either of previous passes.
+	if cachedEntry := u.maybeIgnoreCachedEntry(ctx, findCachedEntry(ctx, entry, prevEntries)); cachedEntry != nil {
+		// contents of unchanged files are not read, so they can only be screened by name.
+		if u.screenCachedFileName(filepath.Join(dirRelativePath, entry.Name()), entry, policyTree.Child(entry.Name()).EffectivePolicy()) {
 			return nil
 		}
 
-		// See if we had this name during either of previous passes.
-		if cachedEntry := u.maybeIgnoreCachedEntry(ctx, findCachedEntry(ctx, entry, prevEntries)); cachedEntry != nil {
-			atomic.AddInt32(&u.stats.CachedFiles, 1)
-			u.Progress.CachedFile(filepath.Join(dirRelativePath, entry.Name()), entry.Size())
+		atomic.AddInt32(&u.stats.CachedFiles, 1)
+		u.Progress.CachedFile(filepath.Join(dirRelativePath, entry.Name()), entry.Size())
 
-			// compute entryResult now, cachedEntry is short-lived
-			cachedDirEntry, err := newDirEntry(entry, cachedEntry.(object.HasObjectID).ObjectID())
-			if err != nil {
-				return errors.Wrap(err, "unable to create dir entry")
-			}
+		// compute entryResult now, cachedEntry is short-lived
+		cachedDirEntry, err := newDirEntry(entry, cachedEntry.(object.HasObjectID).ObjectID())
+		if err != nil {
+			return errors.Wrap(err, "unable to create dir entry")
+		}
 
-			output <- cachedDirEntry
-			return nil
+		output <- cachedDirEntry
+		return nil
+	}
+
+	switch entry := entry.(type) {
+	case fs.Symlink:
+		de, err := u.uploadSymlinkInternal(ctx, filepath.Join(dirRelativePath, entry.Name()), entry, policyTree.EffectivePolicy().ErrorHandlingPolicy.IOTimeout())
+		if err != nil {
+			return u.maybeIgnoreFileReadError(err, policyTree)
 		}
 
-		switch entry := entry.(type) {
-		case fs.Symlink:
-			de, err := u.uploadSymlinkInternal(ctx, filepath.Join(dirRelativePath, entry.Name()), entry)
-			if err != nil {
-				return u.maybeIgnoreFileReadError(err, policyTree)
-			}
+		output <- de
+		return nil
 
-			output <- de
+	case fs.File:
+		atomic.AddInt32(&u.stats.NonCachedFiles, 1)
+
+		pol := policyTree.Child(entry.Name()).EffectivePolicy()
+
+		var splitPoints []int64
+		if !pol.EncryptedDataPolicy.EncryptedOrDefault(false) {
+			splitPoints = u.previousVersionSplitPoints(ctx, entry, prevEntries)
+		}
+
+		de, err := u.uploadFileInternal(ctx, filepath.Join(dirRelativePath, entry.Name()), entry, pol, splitPoints)
+		if err == errSensitiveFileSkipped {
 			return nil
+		}
 
-		case fs.File:
-			atomic.AddInt32(&u.stats.NonCachedFiles, 1)
-			de, err := u.uploadFileInternal(ctx, filepath.Join(dirRelativePath, entry.Name()), entry, policyTree.Child(entry.Name()).EffectivePolicy())
-			if err != nil {
-				return u.maybeIgnoreFileReadError(err, policyTree)
+		if err != nil {
+			return u.maybeIgnoreFileReadError(err, policyTree)
+		}
+
+		if isModifiedFile(ctx, entry, de, prevEntries) {
+			atomic.AddInt32(&u.stats.ModifiedFiles, 1)
+
+			if policyTree.Child(entry.Name()).EffectivePolicy().CanaryPolicy.IsCanary(entry.Name()) {
+				u.reportCanaryChange(filepath.Join(dirRelativePath, entry.Name()), snapshot.CanaryModified)
 			}
+		}
 
-			output <- de
-			return nil
+		output <- de
+		return nil
+
+	default:
+		return errors.Errorf("file type not supported: %v", entry.Mode())
+	}
+}
 
-		default:
-			return errors.Errorf("file type not supported: %v", entry.Mode())
+// isModifiedFile returns true if the previous snapshot had a file with the same name and different contents.
+func isModifiedFile(ctx context.Context, f fs.File, de *snapshot.DirEntry, prevEntries *previousEntries) bool {
+	for _, e := range prevEntries.findAll(ctx, f.Name()) {
+		if prev, ok := e.(*repositoryFile); ok {
+			return prev.metadata.ObjectID != de.ObjectID
 		}
-	})
+	}
+
+	return false
+}
+
+// previousVersionSplitPoints returns the end of the previous version of a file that has grown, so that the last chunk
+// of the previous version is stored identically when the data was appended to. Other chunks of unchanged data are
+// identical, because the splitter chooses the same boundaries for them, also after data was inserted or removed.
+func (u *Uploader) previousVersionSplitPoints(ctx context.Context, f fs.File, prevEntries *previousEntries) []int64 {
+	if u.Deterministic || u.rehashAll {
+		return nil
+	}
+
+	for _, e := range prevEntries.findAll(ctx, f.Name()) {
+		prev, ok := e.(*repositoryFile)
+		if !ok || prev.Size() >= f.Size() {
+			continue
+		}
+
+		// splitting objects stored in a single content would turn small files into indirect objects.
+		if _, ok := prev.metadata.ObjectID.IndexObjectID(); !ok {
+			continue
+		}
+
+		return []int64{prev.Size()}
+	}
+
+	return nil
 }
 
 func maybeReadDirectoryEntries(ctx context.Context, dir fs.Directory) fs.Entries {
@@ -597,7 +817,9 @@ func uploadDirInternal(
 	previousDirs []fs.Directory,
 	dirRelativePath string,
 ) (object.ID, fs.DirectorySummary, error) {
+	u.statsMutex.Lock()
 	u.stats.TotalDirectoryCount++
+	u.statsMutex.Unlock()
 
 	u.Progress.StartedDirectory(dirRelativePath)
 	defer u.Progress.FinishedDirectory(dirRelativePath)
@@ -613,51 +835,313 @@ func uploadDirInternal(
 		dirManifest.Summary.IncompleteReason = u.cancelReason()
 	}()
 
+	prevEntries := u.readPreviousEntries(ctx, previousDirs)
+
+	entries := &dirEntryCollector{
+		maxInMemory: u.maxInMemoryDirEntries(),
+		isCanary: func(name string) bool {
+			return policyTree.Child(name).EffectivePolicy().CanaryPolicy.IsCanary(name)
+		},
+		presentCanaries: map[string]bool{},
+	}
+	defer entries.close()
+
 	t0 := u.repo.Time()
-	entries, direrr := directory.Readdir(ctx)
-	log(ctx).Debugf("finished reading directory %v in %v", dirRelativePath, u.repo.Time().Sub(t0))
 
-	if direrr != nil {
-		return "", fs.DirectorySummary{}, dirReadError{direrr}
+	if err := u.processChildren(ctx, dirManifest, entries, dirRelativePath, directory, policyTree, prevEntries); err != nil && err != errCancelled {
+		return "", fs.DirectorySummary{}, err
+	}
+
+	if entries.err != nil {
+		return "", fs.DirectorySummary{}, entries.err
 	}
 
-	var prevEntries []fs.Entries
+	log(ctx).Debugf("finished processing directory %v in %v", dirRelativePath, u.repo.Time().Sub(t0))
+
+	u.checkRemovedCanaries(ctx, dirRelativePath, entries.presentCanaries, policyTree, prevEntries)
+
+	if entries.count == 0 {
+		dirManifest.Summary.MaxModTime = directory.ModTime()
 
-	for _, d := range uniqueDirectories(previousDirs) {
-		if ent := maybeReadDirectoryEntries(ctx, d); ent != nil {
-			prevEntries = append(prevEntries, ent)
+		if u.Deterministic {
+			dirManifest.Summary.MaxModTime = DeterministicTime
 		}
 	}
 
-	if err := u.processChildren(ctx, dirManifest, dirRelativePath, entries, policyTree, prevEntries); err != nil && err != errCancelled {
-		return "", fs.DirectorySummary{}, err
+	compressionPolicy := policyTree.EffectivePolicy().CompressionPolicy
+	comp := compressionPolicy.MetadataCompressor()
+
+	if entries.spilled() {
+		next, err := entries.merged()
+		if err != nil {
+			return "", fs.DirectorySummary{}, err
+		}
+
+		oid, err := u.writePagedDirectory(ctx, dirRelativePath, dirManifest.Summary, next, comp)
+
+		return oid, *dirManifest.Summary, err
 	}
 
-	if len(dirManifest.Entries) == 0 {
-		dirManifest.Summary.MaxModTime = directory.ModTime()
+	// sort the entries, directories first, then non-directories, ordered by name
+	dirManifest.Entries = entries.entries
+	sort.Slice(dirManifest.Entries, func(i, j int) bool {
+		if leftDir, rightDir := isDir(dirManifest.Entries[i]), isDir(dirManifest.Entries[j]); leftDir != rightDir {
+			// directories get sorted before non-directories
+			return leftDir
+		}
+
+		return dirManifest.Entries[i].Name < dirManifest.Entries[j].Name
+	})
+
+	if compressionPolicy.DeltaEncodeDirectoriesOrDefault(false) {
+		if delta := u.maybeDeltaEncode(ctx, dirManifest, previousDirs); delta != nil {
+			oid, err := u.writeDirObject(ctx, "DIR:"+dirRelativePath, delta, comp)
+			return oid, *dirManifest.Summary, err
+		}
 	}
 
 	// at this point dirManifest is ready to go
+	oid, err := u.writeDirManifest(ctx, dirRelativePath, dirManifest, comp)
+
+	return oid, *dirManifest.Summary, err
+}
+
+// maybeDeltaEncode returns the manifest of the directory delta-encoded against its listing in the previous snapshot
+// or nil if the directory should be stored in full.
+func (u *Uploader) maybeDeltaEncode(ctx context.Context, dirManifest *snapshot.DirManifest, previousDirs []fs.Directory) *snapshot.DirManifest {
+	if u.Deterministic || u.rehashAll || len(previousDirs) == 0 || len(dirManifest.Entries) > u.directoryPageSize() {
+		return nil
+	}
+
+	prev, ok := previousDirs[0].(*repositoryDirectory)
+	if !ok {
+		return nil
+	}
+
+	baseOID := prev.metadata.ObjectID
+
+	base, err := readDirManifest(ctx, u.repo, baseOID)
+	if err != nil {
+		log(ctx).Debugf("unable to read previous directory %v: %v", baseOID, err)
+		return nil
+	}
+
+	if len(base.Pages) > 0 || base.DeltaDepth >= maxDirectoryDeltaDepth {
+		return nil
+	}
+
+	baseEntries := map[string][]byte{}
+
+	if err := iterateDirEntries(ctx, u.repo, baseOID, func(de *snapshot.DirEntry) error {
+		b, err := json.Marshal(de)
+		if err != nil {
+			return err
+		}
+
+		baseEntries[de.Name] = b
+
+		return nil
+	}); err != nil {
+		log(ctx).Debugf("unable to read entries of previous directory %v: %v", baseOID, err)
+		return nil
+	}
+
+	delta := &snapshot.DirManifest{
+		StreamType: deltaDirectoryStreamType,
+		Summary:    dirManifest.Summary,
+		Base:       baseOID,
+		DeltaDepth: base.DeltaDepth + 1,
+	}
+
+	for _, de := range dirManifest.Entries {
+		b, err := json.Marshal(de)
+		if err != nil {
+			return nil
+		}
+
+		if prevEntry, ok := baseEntries[de.Name]; !ok || !bytes.Equal(prevEntry, b) {
+			delta.Entries = append(delta.Entries, de)
+		}
+
+		delete(baseEntries, de.Name)
+	}
+
+	for name := range baseEntries {
+		delta.Removed = append(delta.Removed, name)
+	}
+
+	sort.Strings(delta.Removed)
+
+	changes := len(delta.Entries) + len(delta.Removed)
+
+	// unchanged directories are stored in full, so that they keep having the same object ID
+	// and directories with many changes are cheaper to store in full.
+	if changes == 0 || changes > len(dirManifest.Entries)/2 {
+		return nil
+	}
+
+	return delta
+}
+
+func (u *Uploader) maxInMemoryDirEntries() int {
+	if u.maxInMemoryEntries > 0 {
+		return u.maxInMemoryEntries
+	}
+
+	return defaultMaxInMemoryDirEntries
+}
 
-	writer := u.repo.Objects.NewWriter(ctx, object.WriterOptions{
-		Description: "DIR:" + dirRelativePath,
+func (u *Uploader) directoryPageSize() int {
+	pageSize := u.DirectoryPageSize
+	if pageSize == 0 {
+		pageSize = DefaultDirectoryPageSize
+	}
+
+	if pageSize < minDirectoryPageSize {
+		pageSize = minDirectoryPageSize
+	}
+
+	return pageSize
+}
+
+// writeDirManifest writes the directory manifest, splitting entries of directories larger than the page size
+// into pages stored in separate objects.
+func (u *Uploader) writeDirManifest(ctx context.Context, dirRelativePath string, dirManifest *snapshot.DirManifest, comp compression.Name) (object.ID, error) {
+	pageSize := u.directoryPageSize()
+
+	if len(dirManifest.Entries) <= pageSize {
+		return u.writeDirObject(ctx, "DIR:"+dirRelativePath, dirManifest, comp)
+	}
+
+	// pages are looked up by name, so entries of paged directories are sorted by name only.
+	sortEntriesByName(dirManifest.Entries)
+
+	return u.writePagedDirectory(ctx, dirRelativePath, dirManifest.Summary, sliceEntryIterator(dirManifest.Entries), comp)
+}
+
+// writePagedDirectory writes the directory with entries returned by next in the order of names, which
+// are written in pages as they are returned, so that they don't need to be held in memory.
+func (u *Uploader) writePagedDirectory(ctx context.Context, dirRelativePath string, summary *fs.DirectorySummary, next func() (*snapshot.DirEntry, error), comp compression.Name) (object.ID, error) {
+	pageSize := u.directoryPageSize()
+
+	var (
+		pages []*snapshot.DirPage
+		page  []*snapshot.DirEntry
+	)
+
+	writePage := func() error {
+		oid, err := u.writeDirObject(ctx, "DIRPAGE:"+dirRelativePath, &snapshot.DirManifest{
+			StreamType: directoryStreamType,
+			Entries:    page,
+		}, comp)
+		if err != nil {
+			return err
+		}
+
+		pages = append(pages, &snapshot.DirPage{
+			FirstName:  page[0].Name,
+			LastName:   page[len(page)-1].Name,
+			EntryCount: len(page),
+			ObjectID:   oid,
+		})
+
+		page = nil
+
+		return nil
+	}
+
+	for {
+		de, err := next()
+		if err != nil {
+			return "", err
+		}
+
+		if de == nil {
+			break
+		}
+
+		page = append(page, de)
+
+		if len(page) == pageSize {
+			if err := writePage(); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	if len(page) > 0 {
+		if err := writePage(); err != nil {
+			return "", err
+		}
+	}
+
+	// group pages into further levels until they fit in a single object.
+	for len(pages) > pageSize {
+		var parents []*snapshot.DirPage
+
+		for start := 0; start < len(pages); start += pageSize {
+			end := start + pageSize
+			if end > len(pages) {
+				end = len(pages)
+			}
+
+			oid, err := u.writeDirObject(ctx, "DIRPAGE:"+dirRelativePath, &snapshot.DirManifest{
+				StreamType: pagedDirectoryStreamType,
+				Pages:      pages[start:end],
+			}, comp)
+			if err != nil {
+				return "", err
+			}
+
+			parent := &snapshot.DirPage{
+				FirstName: pages[start].FirstName,
+				LastName:  pages[end-1].LastName,
+				ObjectID:  oid,
+			}
+
+			for _, p := range pages[start:end] {
+				parent.EntryCount += p.EntryCount
+			}
+
+			parents = append(parents, parent)
+		}
+
+		pages = parents
+	}
+
+	return u.writeDirObject(ctx, "DIR:"+dirRelativePath, &snapshot.DirManifest{
+		StreamType: pagedDirectoryStreamType,
+		Summary:    summary,
+		Pages:      pages,
+	}, comp)
+}
+
+func (u *Uploader) writeDirObject(ctx context.Context, description string, dirManifest *snapshot.DirManifest, comp compression.Name) (object.ID, error) {
+	writer := u.objects.NewWriter(ctx, object.WriterOptions{
+		Description: description,
 		Prefix:      "k",
+		Compressor:  comp,
 	})
 
 	defer writer.Close() //nolint:errcheck
 
+	dirManifest.SchemaVersion = snapshot.DirManifestSchemaVersion
+
 	if err := json.NewEncoder(writer).Encode(dirManifest); err != nil {
-		return "", fs.DirectorySummary{}, errors.Wrap(err, "unable to encode directory JSON")
+		return "", errors.Wrap(err, "unable to encode directory JSON")
 	}
 
-	oid, err := writer.Result()
-
-	return oid, *dirManifest.Summary, err
+	return writer.Result()
 }
 
 func (u *Uploader) maybeIgnoreFileReadError(err error, policyTree *policy.Tree) error {
 	errHandlingPolicy := policyTree.EffectivePolicy().ErrorHandlingPolicy
 
+	// timeouts are reported as failed entries by the caller.
+	if isIOTimeout(err) {
+		return err
+	}
+
 	if u.IgnoreReadErrors || errHandlingPolicy.IgnoreFileErrorsOrDefault(false) {
 		return nil
 	}
@@ -679,6 +1163,7 @@ func (u *Uploader) shouldIgnoreDirectoryReadErrors(policyTree *policy.Tree) bool
 func NewUploader(r *repo.Repository) *Uploader {
 	return &Uploader{
 		repo:             r,
+		objects:          r.Objects,
 		Progress:         &NullUploadProgress{},
 		IgnoreReadErrors: false,
 		ParallelUploads:  1,
@@ -728,8 +1213,28 @@ func (u *Uploader) Upload(
 ) (*snapshot.Manifest, error) {
 	log(ctx).Debugf("Uploading %v", sourceInfo)
 
+	// canceling the context cancels the upload the same way as Cancel() does, the caller should save
+	// the resulting partial snapshot and flush the repository using a context that is not canceled.
+	uploadDone := make(chan struct{})
+	defer close(uploadDone)
+
+	if ctx.Err() != nil {
+		u.Cancel()
+	}
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			log(ctx).Infof("context canceled, canceling upload of %v", sourceInfo)
+			u.Cancel()
+
+		case <-uploadDone:
+		}
+	}()
+
 	s := &snapshot.Manifest{
-		Source: sourceInfo,
+		Source:        sourceInfo,
+		SchemaVersion: snapshot.ManifestSchemaVersion,
 	}
 
 	maxPreviousTotalFileSize := int64(0)
@@ -749,23 +1254,56 @@ func (u *Uploader) Upload(
 	defer u.Progress.UploadFinished()
 
 	u.stats = snapshot.Stats{}
+	u.sensitiveFiles = nil
+	u.canaryChanges = nil
+
+	parallelUploads := u.ParallelUploads
+	if parallelUploads == 0 {
+		parallelUploads = runtime.NumCPU()
+	}
+
+	u.uploadSemaphore = make(chan struct{}, parallelUploads)
 
 	var err error
 
+	// all writes go through a separate object manager, which tracks contents written by this upload.
+	u.contents = newUploadContentManager(u.repo.Content, u.DryRun)
+
+	u.objects, err = object.NewObjectManager(ctx, u.contents, u.repo.Objects.Format, object.ManagerOptions{})
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to initialize object manager")
+	}
+
+	defer func() {
+		u.objects.Close() //nolint:errcheck
+		u.objects = u.repo.Objects
+	}()
+
+	sinceFullRehash, hasPrevious := snapshotsSinceFullRehash(previousManifests)
+
+	u.rehashAll = hasPrevious && policyTree.EffectivePolicy().ChangeDetectionPolicy.ShouldRehashAll(sinceFullRehash)
+	if u.rehashAll {
+		log(ctx).Debugf("rehashing all files of %v", sourceInfo)
+	}
+
 	s.StartTime = u.repo.Time()
 
 	switch entry := source.(type) {
 	case fs.Directory:
 		var previousDirs []fs.Directory
 
-		for _, m := range previousManifests {
-			if d := u.maybeOpenDirectoryFromManifest(ctx, m); d != nil {
-				previousDirs = append(previousDirs, d)
+		if !u.Deterministic {
+			for _, m := range previousManifests {
+				if d := u.maybeOpenDirectoryFromManifest(ctx, m); d != nil {
+					previousDirs = append(previousDirs, d)
+				}
 			}
 		}
 
 		entry = ignorefs.New(entry, policyTree, ignorefs.ReportIgnoredFiles(func(_ string, md fs.Entry) {
+			u.statsMutex.Lock()
 			u.stats.AddExcluded(md)
+			u.statsMutex.Unlock()
 		}))
 		s.RootEntry, err = u.uploadDir(ctx, entry, policyTree, previousDirs)
 
@@ -782,7 +1320,47 @@ func (u *Uploader) Upload(
 
 	s.IncompleteReason = u.cancelReason()
 	s.EndTime = u.repo.Time()
+
+	if u.Deterministic {
+		u.maybeNormalizeEntry(s.RootEntry)
+		s.StartTime = DeterministicTime
+		s.EndTime = DeterministicTime
+	}
 	s.Stats = u.stats
+	s.SensitiveFiles = u.sensitiveFiles
+	sort.Slice(s.SensitiveFiles, func(i, j int) bool {
+		return s.SensitiveFiles[i].Path < s.SensitiveFiles[j].Path
+	})
+
+	s.CanaryChanges = u.canaryChanges
+	sort.Slice(s.CanaryChanges, func(i, j int) bool {
+		return s.CanaryChanges[i].Path < s.CanaryChanges[j].Path
+	})
+
+	s.Stats.NewContentCount, s.Stats.NewContentBytes, s.Stats.DedupedBytes = u.contents.stats()
+
+	// incomplete snapshot has not rehashed all files, so the next one still needs to.
+	if hasPrevious && (!u.rehashAll || s.IncompleteReason != "") {
+		s.SnapshotsSinceFullRehash = sinceFullRehash + 1
+	}
 
 	return s, nil
 }
+
+// snapshotsSinceFullRehash returns the number of snapshots taken since the last one that rehashed all files,
+// based on the most recent of the provided manifests.
+func snapshotsSinceFullRehash(previousManifests []*snapshot.Manifest) (int, bool) {
+	var latest *snapshot.Manifest
+
+	for _, m := range previousManifests {
+		if latest == nil || m.StartTime.After(latest.StartTime) {
+			latest = m
+		}
+	}
+
+	if latest == nil {
+		return 0, false
+	}
+
+	return latest.SnapshotsSinceFullRehash, true
+}
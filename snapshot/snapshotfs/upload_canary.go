@@ -0,0 +1,45 @@
+package snapshotfs
+
+import (
+	"context"
+	"path"
+
+	"github.com/kopia/kopia/fs"
+	"github.com/kopia/kopia/snapshot"
+	"github.com/kopia/kopia/snapshot/policy"
+)
+
+// reportCanaryChange records the change to a canary file.
+func (u *Uploader) reportCanaryChange(relativePath, change string) {
+	u.statsMutex.Lock()
+	u.canaryChanges = append(u.canaryChanges, &snapshot.CanaryChange{
+		Path:   relativePath,
+		Change: change,
+	})
+	u.statsMutex.Unlock()
+}
+
+// checkRemovedCanaries reports canary files present in the previous snapshot that are missing from the directory.
+// Only names of canaries present in the directory are provided, since the directory may be too large
+// to hold all its names in memory.
+func (u *Uploader) checkRemovedCanaries(ctx context.Context, dirRelativePath string, presentCanaries map[string]bool, policyTree *policy.Tree, prevEntries *previousEntries) {
+	if u.IsCancelled() {
+		// the directory has not been read in its entirety.
+		return
+	}
+
+	reported := map[string]bool{}
+
+	prevEntries.iterate(ctx, func(e fs.Entry) {
+		name := e.Name()
+
+		if e.IsDir() || presentCanaries[name] || reported[name] || !policyTree.Child(name).EffectivePolicy().CanaryPolicy.IsCanary(name) {
+			return
+		}
+
+		// only report each removed canary once when there are multiple previous snapshots.
+		reported[name] = true
+
+		u.reportCanaryChange(path.Join(dirRelativePath, name), snapshot.CanaryRemoved)
+	})
+}
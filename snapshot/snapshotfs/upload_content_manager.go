@@ -0,0 +1,103 @@
+package snapshotfs
+
+import (
+	"context"
+	"sync"
+
+	"github.com/kopia/kopia/repo/content"
+)
+
+// uploadContentManager tracks contents written during a single upload and determines which of them
+// were not already present in the repository. In dry-run mode nothing is actually written.
+type uploadContentManager struct {
+	cm     *content.Manager
+	dryRun bool
+
+	mu           sync.Mutex
+	written      map[content.ID]int // only used in dry-run mode
+	newCount     int64
+	newBytes     int64
+	dedupedBytes int64
+}
+
+func (d *uploadContentManager) ContentInfo(ctx context.Context, contentID content.ID) (content.Info, error) {
+	if d.dryRun {
+		d.mu.Lock()
+		length, ok := d.written[contentID]
+		d.mu.Unlock()
+
+		if ok {
+			return content.Info{ID: contentID, Length: uint32(length)}, nil
+		}
+	}
+
+	return d.cm.ContentInfo(ctx, contentID)
+}
+
+func (d *uploadContentManager) GetContent(ctx context.Context, contentID content.ID) ([]byte, error) {
+	return d.cm.GetContent(ctx, contentID)
+}
+
+func (d *uploadContentManager) WriteContent(ctx context.Context, data []byte, prefix content.ID) (content.ID, error) {
+	if !d.dryRun {
+		contentID, isNew, err := d.cm.WriteContentIfMissing(ctx, data, prefix)
+		if err != nil {
+			return "", err
+		}
+
+		d.recordWrite(contentID, len(data), isNew)
+
+		return contentID, nil
+	}
+
+	contentID, err := d.cm.ComputeContentID(data, prefix)
+	if err != nil {
+		return "", err
+	}
+
+	isNew := true
+
+	if bi, err := d.cm.ContentInfo(ctx, contentID); err == nil && !bi.Deleted {
+		isNew = false
+	}
+
+	d.recordWrite(contentID, len(data), isNew)
+
+	return contentID, nil
+}
+
+func (d *uploadContentManager) recordWrite(contentID content.ID, length int, isNew bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.dryRun && isNew {
+		if _, ok := d.written[contentID]; ok {
+			isNew = false
+		} else {
+			d.written[contentID] = length
+		}
+	}
+
+	if isNew {
+		d.newCount++
+		d.newBytes += int64(length)
+	} else {
+		d.dedupedBytes += int64(length)
+	}
+}
+
+// stats returns the number and total size of new contents and total size of contents that were already present.
+func (d *uploadContentManager) stats() (newCount, newBytes, dedupedBytes int64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.newCount, d.newBytes, d.dedupedBytes
+}
+
+func newUploadContentManager(cm *content.Manager, dryRun bool) *uploadContentManager {
+	return &uploadContentManager{
+		cm:      cm,
+		dryRun:  dryRun,
+		written: map[content.ID]int{},
+	}
+}
@@ -0,0 +1,221 @@
+package snapshotfs
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/snapshot"
+)
+
+// defaultMaxInMemoryDirEntries is the maximum number of entries of a directory held in memory during upload.
+// Entries of larger directories are spilled to temporary files in sorted runs, which are merged
+// when the directory is written.
+const defaultMaxInMemoryDirEntries = 100000
+
+// dirEntryCollector collects entries of a directory being uploaded.
+type dirEntryCollector struct {
+	maxInMemory int
+
+	entries []*snapshot.DirEntry
+	count   int
+
+	// names of canary files, which are remembered to detect removed canaries.
+	isCanary        func(name string) bool
+	presentCanaries map[string]bool
+
+	spillFile *os.File
+	runs      []spilledRun
+	err       error
+}
+
+// spilledRun is a part of the spill file containing JSON-encoded entries sorted by name.
+type spilledRun struct {
+	offset int64
+	length int64
+}
+
+// add adds the entry, spilling entries held in memory to a temporary file when there are too many of them.
+func (c *dirEntryCollector) add(de *snapshot.DirEntry) {
+	c.entries = append(c.entries, de)
+	c.count++
+
+	if c.isCanary != nil && c.isCanary(de.Name) {
+		c.presentCanaries[de.Name] = true
+	}
+
+	if len(c.entries) >= c.maxInMemory && c.err == nil {
+		c.err = c.spill()
+	}
+}
+
+func (c *dirEntryCollector) spilled() bool {
+	return len(c.runs) > 0
+}
+
+func (c *dirEntryCollector) spill() error {
+	if c.spillFile == nil {
+		f, err := ioutil.TempFile("", "kopia-dir-entries")
+		if err != nil {
+			return errors.Wrap(err, "unable to create temporary file for directory entries")
+		}
+
+		c.spillFile = f
+	}
+
+	offset, err := c.spillFile.Seek(0, io.SeekEnd)
+	if err != nil {
+		return errors.Wrap(err, "unable to seek temporary file")
+	}
+
+	sortEntriesByName(c.entries)
+
+	bw := bufio.NewWriter(c.spillFile)
+	enc := json.NewEncoder(bw)
+
+	for _, de := range c.entries {
+		if err := enc.Encode(de); err != nil {
+			return errors.Wrap(err, "unable to write directory entries")
+		}
+	}
+
+	if err := bw.Flush(); err != nil {
+		return errors.Wrap(err, "unable to write directory entries")
+	}
+
+	end, err := c.spillFile.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return errors.Wrap(err, "unable to seek temporary file")
+	}
+
+	c.runs = append(c.runs, spilledRun{offset, end - offset})
+	c.entries = nil
+
+	return nil
+}
+
+// merged returns the function returning entries of a spilled directory sorted by name and nil at the end.
+func (c *dirEntryCollector) merged() (func() (*snapshot.DirEntry, error), error) {
+	sortEntriesByName(c.entries)
+
+	var h entryRunHeap
+
+	for _, r := range c.runs {
+		dec := json.NewDecoder(bufio.NewReader(io.NewSectionReader(c.spillFile, r.offset, r.length)))
+		next := func() (*snapshot.DirEntry, error) {
+			de := &snapshot.DirEntry{}
+
+			err := dec.Decode(de)
+			if err == io.EOF {
+				return nil, nil
+			}
+
+			return de, errors.Wrap(err, "unable to read directory entries")
+		}
+
+		if err := h.push(next); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := h.push(sliceEntryIterator(c.entries)); err != nil {
+		return nil, err
+	}
+
+	heap.Init(&h)
+
+	return func() (*snapshot.DirEntry, error) {
+		if len(h) == 0 {
+			return nil, nil
+		}
+
+		run := h[0]
+		de := run.current
+
+		next, err := run.next()
+		if err != nil {
+			return nil, err
+		}
+
+		if next == nil {
+			heap.Pop(&h)
+		} else {
+			run.current = next
+			heap.Fix(&h, 0)
+		}
+
+		return de, nil
+	}, nil
+}
+
+// close removes the temporary file.
+func (c *dirEntryCollector) close() {
+	if c.spillFile != nil {
+		c.spillFile.Close()           //nolint:errcheck
+		os.Remove(c.spillFile.Name()) //nolint:errcheck
+	}
+}
+
+func sortEntriesByName(entries []*snapshot.DirEntry) {
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name < entries[j].Name
+	})
+}
+
+func sliceEntryIterator(entries []*snapshot.DirEntry) func() (*snapshot.DirEntry, error) {
+	return func() (*snapshot.DirEntry, error) {
+		if len(entries) == 0 {
+			return nil, nil
+		}
+
+		de := entries[0]
+		entries = entries[1:]
+
+		return de, nil
+	}
+}
+
+// entryRun is a sorted sequence of entries being merged.
+type entryRun struct {
+	current *snapshot.DirEntry
+	next    func() (*snapshot.DirEntry, error)
+}
+
+// entryRunHeap orders runs by the name of their current entry.
+type entryRunHeap []*entryRun
+
+func (h *entryRunHeap) push(next func() (*snapshot.DirEntry, error)) error {
+	de, err := next()
+	if err != nil {
+		return err
+	}
+
+	if de != nil {
+		*h = append(*h, &entryRun{de, next})
+	}
+
+	return nil
+}
+
+func (h entryRunHeap) Len() int           { return len(h) }
+func (h entryRunHeap) Less(i, j int) bool { return h[i].current.Name < h[j].current.Name }
+func (h entryRunHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *entryRunHeap) Push(x interface{}) {
+	*h = append(*h, x.(*entryRun))
+}
+
+func (h *entryRunHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[0 : n-1]
+
+	return x
+}
@@ -0,0 +1,132 @@
+package snapshotfs
+
+import (
+	"context"
+	"sync"
+)
+
+// FairScheduler divides the throughput of the upload pipeline between uploaders snapshotting different sources
+// at the same time. Uploaders take turns writing chunks of file data and an uploader with weight N gets N times
+// as much data written as an uploader with weight 1, so that one large source doesn't starve the others.
+type FairScheduler struct {
+	mu      sync.Mutex
+	slots   int
+	busy    int
+	waiting []*fairWaiter
+
+	// virtualTime is the pass of the most recently granted turn, shares becoming active start from it,
+	// so that idle shares don't accumulate credit.
+	virtualTime float64
+}
+
+// FairShare represents a participant of FairScheduler.
+type FairShare struct {
+	s      *FairScheduler
+	weight int
+
+	// pass is the virtual time of the next turn, which advances by the amount of data written divided by weight.
+	pass float64
+}
+
+type fairWaiter struct {
+	share *FairShare
+	ready chan struct{}
+}
+
+// NewFairScheduler returns a FairScheduler which lets the provided number of chunks be written concurrently.
+func NewFairScheduler(slots int) *FairScheduler {
+	if slots < 1 {
+		slots = 1
+	}
+
+	return &FairScheduler{slots: slots}
+}
+
+// Join returns a new share of the scheduler with the provided weight, which must be used by a single Uploader.
+func (s *FairScheduler) Join(weight int) *FairShare {
+	if weight < 1 {
+		weight = 1
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return &FairShare{s: s, weight: weight, pass: s.virtualTime}
+}
+
+// acquire waits for the turn to write a chunk of data.
+func (sh *FairShare) acquire(ctx context.Context) error {
+	s := sh.s
+
+	s.mu.Lock()
+
+	if sh.pass < s.virtualTime {
+		sh.pass = s.virtualTime
+	}
+
+	if s.busy < s.slots && len(s.waiting) == 0 {
+		s.busy++
+		s.virtualTime = sh.pass
+		s.mu.Unlock()
+
+		return nil
+	}
+
+	w := &fairWaiter{sh, make(chan struct{})}
+	s.waiting = append(s.waiting, w)
+	s.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return nil
+
+	case <-ctx.Done():
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		for i, other := range s.waiting {
+			if other == w {
+				s.waiting = append(s.waiting[:i], s.waiting[i+1:]...)
+				return ctx.Err()
+			}
+		}
+
+		// the turn was granted concurrently with cancellation, give it to someone else.
+		s.busy--
+		s.grantLocked()
+
+		return ctx.Err()
+	}
+}
+
+// release ends the turn after writing the provided number of bytes.
+func (sh *FairShare) release(written int64) {
+	s := sh.s
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sh.pass += float64(written) / float64(sh.weight)
+	s.busy--
+	s.grantLocked()
+}
+
+// grantLocked gives free slots to waiters with the lowest pass, earlier waiters first in case of a tie.
+func (s *FairScheduler) grantLocked() {
+	for s.busy < s.slots && len(s.waiting) > 0 {
+		best := 0
+
+		for i, w := range s.waiting {
+			if w.share.pass < s.waiting[best].share.pass {
+				best = i
+			}
+		}
+
+		w := s.waiting[best]
+		s.waiting = append(s.waiting[:best], s.waiting[best+1:]...)
+		s.busy++
+		s.virtualTime = w.share.pass
+
+		close(w.ready)
+	}
+}
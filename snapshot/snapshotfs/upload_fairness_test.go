@@ -0,0 +1,105 @@
+package snapshotfs
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"testing"
+
+	"github.com/kopia/kopia/internal/testlogging"
+)
+
+func TestFairSchedulerWeights(t *testing.T) {
+	ctx := testlogging.Context(t)
+	s := NewFairScheduler(1)
+
+	const totalTurns = 4000
+
+	var (
+		mu    sync.Mutex
+		turns = map[*FairShare]int{}
+		total int
+		wg    sync.WaitGroup
+	)
+
+	heavy := s.Join(3)
+	light := s.Join(1)
+
+	// hold the only slot until all workers are waiting, so that they compete from the start.
+	holder := s.Join(1)
+	if err := holder.acquire(ctx); err != nil {
+		t.Fatalf("acquire error: %v", err)
+	}
+
+	for _, sh := range []*FairShare{heavy, light, heavy, light} {
+		wg.Add(1)
+
+		go func(sh *FairShare) {
+			defer wg.Done()
+
+			for {
+				if err := sh.acquire(ctx); err != nil {
+					t.Errorf("acquire error: %v", err)
+					return
+				}
+
+				mu.Lock()
+				done := total >= totalTurns
+				if !done {
+					turns[sh]++
+					total++
+				}
+				mu.Unlock()
+
+				sh.release(1)
+
+				if done {
+					return
+				}
+			}
+		}(sh)
+	}
+
+	for waiting := 0; waiting < 4; {
+		runtime.Gosched()
+
+		s.mu.Lock()
+		waiting = len(s.waiting)
+		s.mu.Unlock()
+	}
+
+	holder.release(0)
+	wg.Wait()
+
+	ratio := float64(turns[heavy]) / float64(turns[light])
+	if ratio < 2 || ratio > 4 {
+		t.Errorf("unexpected ratio of turns %v (%v vs %v), want ~3", ratio, turns[heavy], turns[light])
+	}
+}
+
+func TestFairSchedulerCancel(t *testing.T) {
+	ctx := testlogging.Context(t)
+	s := NewFairScheduler(1)
+
+	a := s.Join(1)
+	b := s.Join(1)
+
+	if err := a.acquire(ctx); err != nil {
+		t.Fatalf("acquire error: %v", err)
+	}
+
+	canceledCtx, cancel := context.WithCancel(ctx)
+	cancel()
+
+	if err := b.acquire(canceledCtx); err == nil {
+		t.Fatalf("expected error acquiring with canceled context")
+	}
+
+	a.release(1)
+
+	if err := b.acquire(ctx); err != nil {
+		t.Fatalf("acquire error: %v", err)
+	}
+
+	b.release(1)
+}
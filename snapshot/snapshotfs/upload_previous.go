@@ -0,0 +1,207 @@
+package snapshotfs
+
+import (
+	"container/list"
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/kopia/kopia/fs"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/object"
+	"github.com/kopia/kopia/snapshot"
+)
+
+// previousEntries provides the entries of a directory in previous snapshots.
+// Listings of regular directories are held in memory, while entries of paged directories are looked up
+// in the pages that may contain them, which are cached up to a limited number of entries, so that memory
+// usage does not grow with the size of the directory.
+type previousEntries struct {
+	rep      *repo.Repository
+	listings []previousListing
+
+	mu         sync.Mutex
+	maxEntries int
+	cached     int
+	lru        *list.List // of *cachedDirObject, most recently used first
+	byID       map[object.ID]*list.Element
+}
+
+// previousListing is a listing of a single previous directory.
+type previousListing struct {
+	entries fs.Entries
+
+	// set for paged directories, whose entries are not held in memory.
+	dir   fs.Directory
+	pages []*snapshot.DirPage
+}
+
+type cachedDirObject struct {
+	oid object.ID
+	dir *snapshot.DirManifest
+}
+
+func (u *Uploader) readPreviousEntries(ctx context.Context, previousDirs []fs.Directory) *previousEntries {
+	p := &previousEntries{
+		rep:        u.repo,
+		maxEntries: u.maxInMemoryDirEntries(),
+		lru:        list.New(),
+		byID:       map[object.ID]*list.Element{},
+	}
+
+	for _, d := range uniqueDirectories(previousDirs) {
+		if rd, ok := d.(*repositoryDirectory); ok {
+			dir, err := readDirManifest(ctx, rd.repo, rd.metadata.ObjectID)
+			if err != nil {
+				log(ctx).Warningf("unable to read previous directory: %v", err)
+				continue
+			}
+
+			if len(dir.Pages) > 0 {
+				p.listings = append(p.listings, previousListing{dir: d, pages: dir.Pages})
+				continue
+			}
+		}
+
+		if ent := maybeReadDirectoryEntries(ctx, d); ent != nil {
+			p.listings = append(p.listings, previousListing{entries: ent})
+		}
+	}
+
+	return p
+}
+
+// findAll returns the entries with the provided name in the order of previous directories.
+func (p *previousEntries) findAll(ctx context.Context, name string) []fs.Entry {
+	var result []fs.Entry
+
+	for _, l := range p.listings {
+		if l.dir == nil {
+			if e := l.entries.FindByName(name); e != nil {
+				result = append(result, e)
+			}
+
+			continue
+		}
+
+		de, err := p.findInPages(ctx, l.pages, name)
+		if err != nil {
+			log(ctx).Warningf("unable to look up %v in previous directory: %v", name, err)
+			continue
+		}
+
+		if de == nil {
+			continue
+		}
+
+		e, err := EntryFromDirEntry(p.rep, de)
+		if err != nil {
+			log(ctx).Warningf("invalid previous entry %v: %v", name, err)
+			continue
+		}
+
+		result = append(result, e)
+	}
+
+	return result
+}
+
+// findInPages returns the entry with the provided name from the pages of a paged directory or nil if not found.
+func (p *previousEntries) findInPages(ctx context.Context, pages []*snapshot.DirPage, name string) (*snapshot.DirEntry, error) {
+	for {
+		// pages are sorted by name and don't overlap.
+		i := sort.Search(len(pages), func(i int) bool {
+			return pages[i].LastName >= name
+		})
+
+		if i >= len(pages) || pages[i].FirstName > name {
+			return nil, nil
+		}
+
+		dir, err := p.readPage(ctx, pages[i].ObjectID)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(dir.Pages) == 0 {
+			i := sort.Search(len(dir.Entries), func(i int) bool {
+				return dir.Entries[i].Name >= name
+			})
+
+			if i < len(dir.Entries) && dir.Entries[i].Name == name {
+				return dir.Entries[i], nil
+			}
+
+			return nil, nil
+		}
+
+		pages = dir.Pages
+	}
+}
+
+// readPage returns the page object with the provided ID, evicting least recently used pages
+// when the cached pages hold more than the maximum number of entries.
+func (p *previousEntries) readPage(ctx context.Context, oid object.ID) (*snapshot.DirManifest, error) {
+	p.mu.Lock()
+	if e := p.byID[oid]; e != nil {
+		p.lru.MoveToFront(e)
+		p.mu.Unlock()
+
+		return e.Value.(*cachedDirObject).dir, nil
+	}
+	p.mu.Unlock()
+
+	dir, err := readDirManifest(ctx, p.rep, oid)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.byID[oid] == nil {
+		p.byID[oid] = p.lru.PushFront(&cachedDirObject{oid, dir})
+		p.cached += len(dir.Entries) + len(dir.Pages)
+	}
+
+	for p.cached > p.maxEntries && p.lru.Len() > 1 {
+		c := p.lru.Remove(p.lru.Back()).(*cachedDirObject)
+		delete(p.byID, c.oid)
+		p.cached -= len(c.dir.Entries) + len(c.dir.Pages)
+	}
+
+	return dir, nil
+}
+
+// iterate invokes the callback for each entry of each previous directory, entries of paged directories are streamed.
+func (p *previousEntries) iterate(ctx context.Context, cb func(e fs.Entry)) {
+	for _, l := range p.listings {
+		if l.dir == nil {
+			for _, e := range l.entries {
+				cb(e)
+			}
+
+			continue
+		}
+
+		if err := fs.IterateEntries(ctx, l.dir, func(ctx context.Context, e fs.Entry) error {
+			cb(e)
+			return nil
+		}); err != nil {
+			log(ctx).Warningf("unable to read previous directory entries: %v", err)
+		}
+	}
+}
+
+// directories returns the previous versions of the subdirectory with the provided name.
+func (p *previousEntries) directories(ctx context.Context, name string) []fs.Directory {
+	var result []fs.Directory
+
+	for _, e := range p.findAll(ctx, name) {
+		if d, ok := e.(fs.Directory); ok {
+			result = append(result, d)
+		}
+	}
+
+	return uniqueDirectories(result)
+}
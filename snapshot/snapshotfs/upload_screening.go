@@ -0,0 +1,67 @@
+package snapshotfs
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/fs"
+	"github.com/kopia/kopia/snapshot"
+	"github.com/kopia/kopia/snapshot/policy"
+)
+
+// reportSensitiveFile records the file detected as sensitive and returns true if it must not be uploaded.
+func (u *Uploader) reportSensitiveFile(relativePath, reason string, pol *policy.ScreeningPolicy) bool {
+	sf := &snapshot.SensitiveFile{
+		Path:    relativePath,
+		Reason:  reason,
+		Skipped: pol.Action == policy.ScreeningSkip,
+	}
+
+	u.statsMutex.Lock()
+	u.sensitiveFiles = append(u.sensitiveFiles, sf)
+	u.statsMutex.Unlock()
+
+	return sf.Skipped
+}
+
+// screenCachedFileName returns true if the file reused from the previous snapshot must not be uploaded because of its name.
+func (u *Uploader) screenCachedFileName(relativePath string, e fs.Entry, pol *policy.Policy) bool {
+	if !pol.ScreeningPolicy.Enabled() || e.IsDir() {
+		return false
+	}
+
+	reason := pol.ScreeningPolicy.ScreenName(e.Name())
+	if reason == "" {
+		return false
+	}
+
+	return u.reportSensitiveFile(relativePath, reason, &pol.ScreeningPolicy)
+}
+
+// screenFile screens the file by name and by the beginning of its contents and returns the reader of the entire file,
+// or errSensitiveFileSkipped if the file must not be uploaded.
+func (u *Uploader) screenFile(relativePath string, f fs.File, r io.Reader, pol *policy.ScreeningPolicy) (io.Reader, error) {
+	reason := pol.ScreenName(f.Name())
+
+	if reason == "" {
+		head, err := ioutil.ReadAll(io.LimitReader(r, policy.ScreeningHeadSize))
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to read file")
+		}
+
+		if reason, err = pol.ScreenContents(head); err != nil {
+			return nil, err
+		}
+
+		r = io.MultiReader(bytes.NewReader(head), r)
+	}
+
+	if reason != "" && u.reportSensitiveFile(relativePath, reason, pol) {
+		return nil, errSensitiveFileSkipped
+	}
+
+	return r, nil
+}
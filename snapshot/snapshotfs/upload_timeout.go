@@ -0,0 +1,206 @@
+package snapshotfs
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/fs"
+)
+
+// ioTimeoutError is returned when a file system operation does not complete within the I/O timeout
+// of the error handling policy, which usually indicates a hung network file system.
+type ioTimeoutError struct {
+	op      string
+	timeout time.Duration
+}
+
+func (e ioTimeoutError) Error() string {
+	return fmt.Sprintf("%v did not complete within %v, the file system may be unresponsive", e.op, e.timeout)
+}
+
+// isIOTimeout returns true if the error was caused by an I/O timeout.
+func isIOTimeout(err error) bool {
+	if dre, ok := err.(dirReadError); ok {
+		err = dre.error
+	}
+
+	_, ok := errors.Cause(err).(ioTimeoutError)
+
+	return ok
+}
+
+var errIterationAbandoned = errors.New("iteration abandoned")
+
+// withIOTimeout invokes the provided function, returning ioTimeoutError if it does not complete within the timeout.
+// Operations blocked in the kernel can't be interrupted, so after a timeout the function keeps running in
+// the background and its results must not be used.
+func withIOTimeout(ctx context.Context, op string, timeout time.Duration, f func() error) error {
+	if timeout <= 0 {
+		return f()
+	}
+
+	result := make(chan error, 1)
+
+	go func() {
+		result <- f()
+	}()
+
+	select {
+	case err := <-result:
+		return err
+
+	case <-ctx.Done():
+		return ctx.Err()
+
+	case <-time.After(timeout):
+		return ioTimeoutError{op, timeout}
+	}
+}
+
+// openWithTimeout opens the file for reading with all operations on the returned reader subject to the timeout.
+func openWithTimeout(ctx context.Context, f fs.File, timeout time.Duration) (fs.Reader, error) {
+	if timeout <= 0 {
+		return f.Open(ctx)
+	}
+
+	type openResult struct {
+		r   fs.Reader
+		err error
+	}
+
+	result := make(chan openResult, 1)
+
+	go func() {
+		r, err := f.Open(ctx)
+		result <- openResult{r, err}
+	}()
+
+	select {
+	case res := <-result:
+		if res.err != nil {
+			return nil, res.err
+		}
+
+		return &timeoutReader{Reader: res.r, ctx: ctx, timeout: timeout}, nil
+
+	case <-ctx.Done():
+		return nil, ctx.Err()
+
+	case <-time.After(timeout):
+		// close the file if it eventually opens.
+		go func() {
+			if res := <-result; res.r != nil {
+				res.r.Close() //nolint:errcheck
+			}
+		}()
+
+		return nil, ioTimeoutError{"opening file", timeout}
+	}
+}
+
+// timeoutReader is a file reader whose operations fail with ioTimeoutError when they don't complete in time.
+type timeoutReader struct {
+	fs.Reader
+
+	ctx     context.Context
+	timeout time.Duration
+
+	// buf receives the data read in the background, so that reads completing after a timeout don't write to
+	// the buffers of the caller.
+	buf []byte
+
+	// err is set after a timeout, from which the reader can't recover.
+	err error
+}
+
+func (r *timeoutReader) Read(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+
+	if cap(r.buf) < len(p) {
+		r.buf = make([]byte, len(p))
+	}
+
+	buf := r.buf[0:len(p)]
+
+	var n int
+
+	err := withIOTimeout(r.ctx, "reading file", r.timeout, func() error {
+		var err error
+		n, err = r.Reader.Read(buf)
+		return err
+	})
+
+	if isIOTimeout(err) || r.ctx.Err() != nil {
+		// the read may have been abandoned and can still write to the buffer.
+		r.buf = nil
+		r.err = err
+
+		return 0, err
+	}
+
+	return copy(p, buf[0:n]), err
+}
+
+func (r *timeoutReader) Entry() (fs.Entry, error) {
+	var e fs.Entry
+
+	err := withIOTimeout(r.ctx, "reading file metadata", r.timeout, func() error {
+		var err error
+		e, err = r.Reader.Entry()
+		return err
+	})
+
+	return e, err
+}
+
+func (r *timeoutReader) Close() error {
+	return withIOTimeout(r.ctx, "closing file", r.timeout, r.Reader.Close)
+}
+
+// iterateEntriesWithTimeout is like fs.IterateEntries, but fails with ioTimeoutError when the directory
+// doesn't produce the next entry within the timeout. The time spent in the callback is not subject to the timeout.
+func iterateEntriesWithTimeout(ctx context.Context, dir fs.Directory, timeout time.Duration, cb fs.IterateEntriesCallback) error {
+	if timeout <= 0 {
+		return fs.IterateEntries(ctx, dir, cb)
+	}
+
+	entries := make(chan fs.Entry)
+	result := make(chan error, 1)
+	abandoned := make(chan struct{})
+
+	defer close(abandoned)
+
+	go func() {
+		result <- fs.IterateEntries(ctx, dir, func(ctx context.Context, e fs.Entry) error {
+			select {
+			case entries <- e:
+				return nil
+			case <-abandoned:
+				return errIterationAbandoned
+			}
+		})
+	}()
+
+	for {
+		select {
+		case e := <-entries:
+			if err := cb(ctx, e); err != nil {
+				return err
+			}
+
+		case err := <-result:
+			return err
+
+		case <-ctx.Done():
+			return ctx.Err()
+
+		case <-time.After(timeout):
+			return ioTimeoutError{"listing directory", timeout}
+		}
+	}
+}
@@ -17,6 +17,16 @@ type Stats struct {
 	CachedFiles    int32 `json:"cachedFiles"`
 	NonCachedFiles int32 `json:"nonCachedFiles"`
 
+	// files whose contents differ from the file with the same name in the previous snapshot.
+	ModifiedFiles int32 `json:"modifiedFiles,omitempty"`
+
+	// contents that were not present in the repository before the snapshot and their total size.
+	NewContentCount int64 `json:"newContentCount,omitempty"`
+	NewContentBytes int64 `json:"newContentBytes,omitempty"`
+
+	// total size of contents produced by the snapshot that were already present in the repository.
+	DedupedBytes int64 `json:"dedupedBytes,omitempty"`
+
 	ReadErrors int `json:"readErrors"`
 }
 
@@ -0,0 +1,123 @@
+package volumesnapshot
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/kopia/kopia/repo/manifest"
+	"github.com/kopia/kopia/snapshot"
+	"github.com/kopia/kopia/snapshot/snapshotfs"
+)
+
+// Exit codes of the volume snapshot, which allow Jobs to distinguish failures worth retrying,
+// for example using pod failure policies.
+const (
+	// snapshot was saved.
+	ExitSuccess = 0
+
+	// snapshot failed, retrying may succeed.
+	ExitFailed = 1
+
+	// volume identity, path or repository connection is invalid, retrying won't succeed.
+	ExitInvalidConfiguration = 2
+
+	// snapshot was saved, but it is incomplete or some entries could not be read.
+	ExitIncomplete = 3
+
+	// snapshot was not saved because the policy rejects suspicious snapshots.
+	ExitRejected = 4
+)
+
+// EventType is the type of the Event.
+type EventType string
+
+// Types of events emitted by the volume snapshot.
+const (
+	EventStarted  EventType = "started"
+	EventProgress EventType = "progress"
+	EventFinished EventType = "finished"
+	EventFailed   EventType = "failed"
+)
+
+// Event is emitted as a single line of JSON when the volume snapshot starts, periodically during the upload
+// and when it finishes or fails, which is the last event.
+type Event struct {
+	Type   EventType           `json:"type"`
+	Time   time.Time           `json:"time"`
+	Source snapshot.SourceInfo `json:"source"`
+
+	// EventStarted
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// EventProgress
+	Progress *snapshotfs.UploadCounters `json:"progress,omitempty"`
+
+	// EventFinished
+	SnapshotID    manifest.ID     `json:"snapshotID,omitempty"`
+	RootObjectID  string          `json:"rootID,omitempty"`
+	Stats         *snapshot.Stats `json:"stats,omitempty"`
+	Incomplete    string          `json:"incomplete,omitempty"`
+	FailedEntries int             `json:"failedEntries,omitempty"`
+	Suspicious    []string        `json:"suspicious,omitempty"`
+
+	// EventFinished and EventFailed
+	Error    string `json:"error,omitempty"`
+	ExitCode int    `json:"exitCode"`
+}
+
+// IsFinal returns true if the event is the last event of the volume snapshot.
+func (e *Event) IsFinal() bool {
+	return e.Type == EventFinished || e.Type == EventFailed
+}
+
+// FailedEvent returns the final event of the volume snapshot of the source that failed with the provided error.
+func FailedEvent(src snapshot.SourceInfo, err error, exitCode int) *Event {
+	return &Event{
+		Type:     EventFailed,
+		Time:     clock(),
+		Source:   src,
+		Error:    err.Error(),
+		ExitCode: exitCode,
+	}
+}
+
+// ReadEvents invokes the callback for each event in the output of the volume snapshot, such as logs of
+// the sidecar container, ignoring lines that are not events.
+func ReadEvents(r io.Reader, cb func(e *Event) error) error {
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if !strings.HasPrefix(line, "{") {
+			continue
+		}
+
+		e := &Event{}
+		if err := json.Unmarshal([]byte(line), e); err != nil || e.Type == "" {
+			continue
+		}
+
+		if err := cb(e); err != nil {
+			return err
+		}
+	}
+
+	return s.Err()
+}
+
+// LastEvent returns the final event in the output of the volume snapshot or nil if it did not finish.
+func LastEvent(r io.Reader) (*Event, error) {
+	var last *Event
+
+	err := ReadEvents(r, func(e *Event) error {
+		if e.IsFinal() {
+			last = e
+		}
+
+		return nil
+	})
+
+	return last, err
+}
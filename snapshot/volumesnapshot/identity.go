@@ -0,0 +1,117 @@
+package volumesnapshot
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/snapshot"
+)
+
+// Environment variables describing the volume, which are usually set from the pod spec or using the downward API.
+const (
+	ClusterEnvar    = "KOPIA_VOLUME_CLUSTER"
+	NamespaceEnvar  = "KOPIA_VOLUME_NAMESPACE"
+	ClaimEnvar      = "KOPIA_VOLUME_CLAIM"
+	LabelsFileEnvar = "KOPIA_VOLUME_LABELS_FILE"
+
+	// namespace of the pod, commonly exposed by the downward API.
+	podNamespaceEnvar = "POD_NAMESPACE"
+)
+
+// Identity identifies the volume independently of the pod it is mounted in, so that snapshots taken by
+// short-lived pods chain with previous snapshots of the same volume.
+type Identity struct {
+	Cluster   string            `json:"cluster,omitempty"`
+	Namespace string            `json:"namespace"`
+	Claim     string            `json:"claim"`
+	Labels    map[string]string `json:"labels,omitempty"`
+}
+
+// IdentityFromEnv returns the identity of the volume from environment variables and the downward API labels file.
+func IdentityFromEnv(getenv func(string) string) (*Identity, error) {
+	id := &Identity{
+		Cluster:   getenv(ClusterEnvar),
+		Namespace: getenv(NamespaceEnvar),
+		Claim:     getenv(ClaimEnvar),
+	}
+
+	if id.Namespace == "" {
+		id.Namespace = getenv(podNamespaceEnvar)
+	}
+
+	if fname := getenv(LabelsFileEnvar); fname != "" {
+		f, err := os.Open(fname) //nolint:gosec
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to open labels file")
+		}
+		defer f.Close() //nolint:errcheck
+
+		if id.Labels, err = ParseDownwardAPILabels(f); err != nil {
+			return nil, errors.Wrapf(err, "invalid labels file %v", fname)
+		}
+	}
+
+	return id, nil
+}
+
+// Validate returns an error if the identity is incomplete.
+func (id *Identity) Validate() error {
+	if id.Namespace == "" {
+		return errors.Errorf("namespace of the volume is not set, set %v or %v", NamespaceEnvar, podNamespaceEnvar)
+	}
+
+	if id.Claim == "" {
+		return errors.Errorf("claim of the volume is not set, set %v", ClaimEnvar)
+	}
+
+	return nil
+}
+
+// SourceInfo returns the snapshot source of the volume mounted at the provided path. Snapshots are attributed to
+// the claim in its namespace, qualified by the cluster name if provided.
+func (id *Identity) SourceInfo(mountPath string) snapshot.SourceInfo {
+	host := id.Namespace
+	if id.Cluster != "" {
+		host = id.Namespace + "." + id.Cluster
+	}
+
+	return snapshot.SourceInfo{
+		Host:     host,
+		UserName: id.Claim,
+		Path:     filepath.Clean(mountPath),
+	}
+}
+
+// ParseDownwardAPILabels parses labels in the format written to files by the Kubernetes downward API,
+// one key="value" pair per line with the value quoted as a Go string.
+func ParseDownwardAPILabels(r io.Reader) (map[string]string, error) {
+	result := map[string]string{}
+
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" {
+			continue
+		}
+
+		p := strings.Index(line, "=")
+		if p <= 0 {
+			return nil, errors.Errorf("invalid label: %q", line)
+		}
+
+		v, err := strconv.Unquote(line[p+1:])
+		if err != nil {
+			return nil, errors.Errorf("invalid value of label: %q", line)
+		}
+
+		result[line[0:p]] = v
+	}
+
+	return result, s.Err()
+}
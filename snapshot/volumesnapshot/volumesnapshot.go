@@ -0,0 +1,203 @@
+// Package volumesnapshot snapshots volumes mounted in Kubernetes pods by sidecar containers or Jobs and
+// defines the events and exit codes through which controllers observe the result.
+package volumesnapshot
+
+import (
+	"context"
+	"crypto/ed25519"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/fs"
+	"github.com/kopia/kopia/fs/localfs"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/snapshot"
+	"github.com/kopia/kopia/snapshot/policy"
+	"github.com/kopia/kopia/snapshot/snapshotfs"
+)
+
+const defaultProgressInterval = 10 * time.Second
+
+var clock = time.Now
+
+// Options of the volume snapshot.
+type Options struct {
+	// Path where the volume is mounted.
+	Path     string
+	Identity *Identity
+
+	Description string
+	SigningKey  ed25519.PrivateKey
+
+	// ProgressInterval is the interval of progress events, 0 for the default interval.
+	ProgressInterval time.Duration
+
+	// OnEvent is invoked with all events, including the final event returned by Run.
+	OnEvent func(e *Event)
+
+	// Cancel stops the upload when closed, such as when the pod is being terminated, saving an incomplete snapshot.
+	Cancel <-chan struct{}
+}
+
+func (o *Options) emit(e *Event) *Event {
+	if o.OnEvent != nil {
+		o.OnEvent(e)
+	}
+
+	return e
+}
+
+// Run snapshots the volume and returns the final event with its exit code.
+func Run(ctx context.Context, rep *repo.Repository, opt *Options) *Event {
+	src := opt.Identity.SourceInfo(opt.Path)
+
+	if err := opt.Identity.Validate(); err != nil {
+		return opt.emit(FailedEvent(src, err, ExitInvalidConfiguration))
+	}
+
+	localEntry, err := localfs.NewEntry(src.Path)
+	if err != nil {
+		return opt.emit(FailedEvent(src, errors.Wrap(err, "unable to read volume"), ExitInvalidConfiguration))
+	}
+
+	opt.emit(&Event{Type: EventStarted, Time: clock(), Source: src, Labels: opt.Identity.Labels})
+
+	man, err := upload(ctx, rep, opt, src, localEntry)
+	if err != nil {
+		return opt.emit(FailedEvent(src, err, ExitFailed))
+	}
+
+	return opt.emit(finishedEvent(src, man))
+}
+
+func upload(ctx context.Context, rep *repo.Repository, opt *Options, src snapshot.SourceInfo, localEntry fs.Entry) (*snapshot.Manifest, error) {
+	previous, err := snapshot.FindPreviousManifests(ctx, rep, src, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	policyTree, err := policy.TreeForSource(ctx, rep, src)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to get policy tree")
+	}
+
+	progress := &snapshotfs.CountingUploadProgress{}
+
+	u := snapshotfs.NewUploader(rep)
+	u.Progress = progress
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+		reportProgress(opt, src, u, progress, done)
+	}()
+
+	defer func() {
+		// no progress events can be emitted after the final event.
+		close(done)
+		<-stopped
+	}()
+
+	man, err := u.Upload(ctx, localEntry, policyTree, src, previous...)
+	if err != nil {
+		return nil, errors.Wrap(err, "upload error")
+	}
+
+	pol := policyTree.EffectivePolicy()
+
+	if man.Anomaly, err = pol.AnomalyPolicy.DetectAnomaly(ctx, rep, man); err != nil {
+		return nil, errors.Wrap(err, "unable to check snapshot for anomalies")
+	}
+
+	if pol.RejectsSnapshot(man) {
+		return man, nil
+	}
+
+	man.Description = opt.Description
+	man.Tags = opt.Identity.Labels
+
+	if opt.SigningKey != nil {
+		if err := man.Sign(opt.SigningKey); err != nil {
+			return nil, errors.Wrap(err, "unable to sign snapshot")
+		}
+	}
+
+	if _, err := snapshot.SaveSnapshot(ctx, rep, man); err != nil {
+		return nil, errors.Wrap(err, "unable to save snapshot")
+	}
+
+	if _, err := policy.ApplyRetentionPolicy(ctx, rep, src, true); err != nil {
+		return nil, errors.Wrap(err, "unable to apply retention policy")
+	}
+
+	if err := rep.Flush(ctx); err != nil {
+		return nil, errors.Wrap(err, "unable to flush")
+	}
+
+	return man, nil
+}
+
+// reportProgress emits progress events until done is closed and cancels the upload when requested.
+func reportProgress(opt *Options, src snapshot.SourceInfo, u *snapshotfs.Uploader, progress *snapshotfs.CountingUploadProgress, done chan struct{}) {
+	interval := opt.ProgressInterval
+	if interval <= 0 {
+		interval = defaultProgressInterval
+	}
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	cancel := opt.Cancel
+
+	for {
+		select {
+		case <-done:
+			return
+
+		case <-cancel:
+			u.Cancel()
+
+			// closed channel is always ready.
+			cancel = nil
+
+		case <-t.C:
+			c := progress.Snapshot()
+			opt.emit(&Event{Type: EventProgress, Time: clock(), Source: src, Progress: &c})
+		}
+	}
+}
+
+func finishedEvent(src snapshot.SourceInfo, man *snapshot.Manifest) *Event {
+	e := &Event{
+		Type:         EventFinished,
+		Time:         clock(),
+		Source:       src,
+		SnapshotID:   man.ID,
+		RootObjectID: man.RootObjectID().String(),
+		Stats:        &man.Stats,
+		Incomplete:   man.IncompleteReason,
+		Suspicious:   man.SuspicionReasons(),
+	}
+
+	if ds := man.RootEntry.DirSummary; ds != nil {
+		e.FailedEntries = ds.FailedEntryCount
+	}
+
+	switch {
+	case man.ID == "":
+		e.Error = "snapshot not saved because it is suspicious: " + strings.Join(e.Suspicious, ", ")
+		e.ExitCode = ExitRejected
+
+	case e.Incomplete != "" || e.FailedEntries > 0:
+		e.ExitCode = ExitIncomplete
+
+	default:
+		e.ExitCode = ExitSuccess
+	}
+
+	return e
+}
@@ -0,0 +1,142 @@
+package volumesnapshot
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/kopia/kopia/internal/repotesting"
+	"github.com/kopia/kopia/internal/testlogging"
+	"github.com/kopia/kopia/snapshot"
+)
+
+func TestParseDownwardAPILabels(t *testing.T) {
+	labels, err := ParseDownwardAPILabels(strings.NewReader("app=\"web\"\n\nteam=\"a \\\"b\\\"\"\n"))
+	if err != nil {
+		t.Fatalf("unable to parse labels: %v", err)
+	}
+
+	if want := map[string]string{"app": "web", "team": `a "b"`}; !reflect.DeepEqual(labels, want) {
+		t.Errorf("unexpected labels: %v, want %v", labels, want)
+	}
+
+	for _, invalid := range []string{"app", "=\"x\"", "app=web"} {
+		if _, err := ParseDownwardAPILabels(strings.NewReader(invalid)); err == nil {
+			t.Errorf("expected error parsing %q", invalid)
+		}
+	}
+}
+
+func TestIdentityFromEnv(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kopia-labels")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	labelsFile := filepath.Join(dir, "labels")
+	if err := ioutil.WriteFile(labelsFile, []byte(`app="web"`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	env := map[string]string{
+		podNamespaceEnvar: "prod",
+		ClaimEnvar:        "data",
+		ClusterEnvar:      "east",
+		LabelsFileEnvar:   labelsFile,
+	}
+
+	id, err := IdentityFromEnv(func(k string) string { return env[k] })
+	if err != nil {
+		t.Fatalf("unable to get identity: %v", err)
+	}
+
+	if err := id.Validate(); err != nil {
+		t.Errorf("unexpected validation error: %v", err)
+	}
+
+	if got, want := id.SourceInfo("/mnt/data/"), (snapshot.SourceInfo{Host: "prod.east", UserName: "data", Path: "/mnt/data"}); got != want {
+		t.Errorf("unexpected source: %v, want %v", got, want)
+	}
+
+	if got, want := id.Labels, map[string]string{"app": "web"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected labels: %v, want %v", got, want)
+	}
+
+	if err := (&Identity{Namespace: "prod"}).Validate(); err == nil {
+		t.Errorf("expected validation error without claim")
+	}
+}
+
+func TestRun(t *testing.T) {
+	var env repotesting.Environment
+
+	ctx := testlogging.Context(t)
+	defer env.Setup(t).Close(ctx, t)
+
+	dir, err := ioutil.TempDir("", "kopia-volume")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "file"), []byte("contents"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+
+	enc := json.NewEncoder(&out)
+
+	opt := &Options{
+		Path:     dir,
+		Identity: &Identity{Namespace: "prod", Claim: "data", Labels: map[string]string{"app": "web"}},
+		OnEvent: func(e *Event) {
+			enc.Encode(e) //nolint:errcheck
+		},
+	}
+
+	final := Run(ctx, env.Repository, opt)
+	if final.ExitCode != ExitSuccess || final.SnapshotID == "" {
+		t.Fatalf("unexpected final event: %+v", final)
+	}
+
+	out.WriteString("some log line\n")
+
+	last, err := LastEvent(&out)
+	if err != nil || last == nil {
+		t.Fatalf("unable to read last event: %v", err)
+	}
+
+	if last.Type != EventFinished || last.SnapshotID != final.SnapshotID {
+		t.Errorf("unexpected last event: %+v", last)
+	}
+
+	man, err := snapshot.LoadSnapshot(ctx, env.Repository, final.SnapshotID)
+	if err != nil {
+		t.Fatalf("unable to load snapshot: %v", err)
+	}
+
+	if man.Source != opt.Identity.SourceInfo(dir) || man.Tags["app"] != "web" {
+		t.Errorf("unexpected snapshot: %v %v", man.Source, man.Tags)
+	}
+
+	opt.Path = filepath.Join(dir, "missing")
+	if e := Run(ctx, env.Repository, opt); e.Type != EventFailed || e.ExitCode != ExitInvalidConfiguration {
+		t.Errorf("unexpected event for missing volume: %+v", e)
+	}
+
+	opt.Path = dir
+	opt.Identity = &Identity{}
+
+	if e := Run(ctx, env.Repository, opt); e.ExitCode != ExitInvalidConfiguration {
+		t.Errorf("unexpected event for invalid identity: %+v", e)
+	}
+}
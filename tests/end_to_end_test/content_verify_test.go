@@ -0,0 +1,150 @@
+package endtoend_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kopia/kopia/tests/testenv"
+)
+
+func TestContentVerifyReplica(t *testing.T) {
+	t.Parallel()
+
+	e := testenv.NewCLITest(t)
+	defer e.Cleanup(t)
+	defer e.RunAndExpectSuccess(t, "repo", "disconnect")
+
+	e.RunAndExpectSuccess(t, "repo", "create", "filesystem", "--path", e.RepoDir)
+	e.RunAndExpectSuccess(t, "snapshot", "create", sharedTestDataDir1)
+
+	replicaDir := makeScratchDir(t)
+	replicaConfig := filepath.Join(e.ConfigDir, "replica.config")
+
+	writeFilesystemConfig(t, replicaConfig, replicaDir)
+
+	copyDirectory(t, e.RepoDir, replicaDir)
+	e.RunAndExpectSuccess(t, "content", "verify", "all", "--replica-config", replicaConfig)
+
+	// pack blob removed from the replica.
+	packs := packBlobFiles(t, replicaDir)
+	if len(packs) == 0 {
+		t.Fatalf("no pack blobs in %v", replicaDir)
+	}
+
+	if err := os.Remove(packs[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	e.RunAndExpectFailure(t, "content", "verify", "all", "--replica-config", replicaConfig)
+
+	// pack blob corrupted in the replica.
+	copyDirectory(t, e.RepoDir, replicaDir)
+
+	data, err := ioutil.ReadFile(packs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data[len(data)/2] ^= 1
+
+	if err := ioutil.WriteFile(packs[0], data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	e.RunAndExpectFailure(t, "content", "verify", "all", "--replica-config", replicaConfig)
+
+	copyDirectory(t, e.RepoDir, replicaDir)
+	e.RunAndExpectSuccess(t, "content", "verify", "all", "--replica-config", replicaConfig)
+
+	// replica of a different repository.
+	other := testenv.NewCLITest(t)
+	defer other.Cleanup(t)
+
+	other.RunAndExpectSuccess(t, "repo", "create", "filesystem", "--path", other.RepoDir)
+	other.RunAndExpectSuccess(t, "repo", "disconnect")
+
+	otherConfig := filepath.Join(e.ConfigDir, "other.config")
+	writeFilesystemConfig(t, otherConfig, other.RepoDir)
+
+	e.RunAndExpectFailure(t, "content", "verify", "all", "--replica-config", otherConfig)
+}
+
+// writeFilesystemConfig writes the config of a connection to the filesystem repository in the provided directory.
+func writeFilesystemConfig(t *testing.T, fname, dir string) {
+	t.Helper()
+
+	b, err := json.Marshal(map[string]interface{}{
+		"storage": map[string]interface{}{
+			"type":   "filesystem",
+			"config": map[string]interface{}{"path": dir},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(fname, b, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// copyDirectory copies the files of the source directory to the destination directory, overwriting existing files.
+func copyDirectory(t *testing.T, src, dst string) {
+	t.Helper()
+
+	if err := filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			return os.MkdirAll(filepath.Join(dst, rel), 0700)
+		}
+
+		data, err := ioutil.ReadFile(path) //nolint:gosec
+		if err != nil {
+			return err
+		}
+
+		return ioutil.WriteFile(filepath.Join(dst, rel), data, 0600)
+	}); err != nil {
+		t.Fatalf("unable to copy %v: %v", src, err)
+	}
+}
+
+// packBlobFiles returns the files of pack blobs in the filesystem repository.
+func packBlobFiles(t *testing.T, dir string) []string {
+	t.Helper()
+
+	var result []string
+
+	if err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		if !info.IsDir() && strings.HasPrefix(rel, "p") {
+			result = append(result, path)
+		}
+
+		return nil
+	}); err != nil {
+		t.Fatalf("unable to list %v: %v", dir, err)
+	}
+
+	return result
+}
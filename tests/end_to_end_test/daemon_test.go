@@ -0,0 +1,92 @@
+package endtoend_test
+
+import (
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/kopia/kopia/tests/testenv"
+)
+
+func TestDaemon(t *testing.T) {
+	e := testenv.NewCLITest(t)
+	defer e.Cleanup(t)
+	defer e.RunAndExpectSuccess(t, "repo", "disconnect")
+
+	e.RunAndExpectSuccess(t, "repo", "create", "filesystem", "--path", e.RepoDir)
+	e.RunAndExpectSuccess(t, "snapshot", "create", sharedTestDataDir1)
+
+	e.RunAndExpectFailure(t, "daemon", "status")
+
+	var socketPath string
+
+	c := e.RunAndProcessStderr(t, func(l string) bool {
+		if strings.HasPrefix(l, "DAEMON SOCKET: ") {
+			socketPath = strings.TrimPrefix(l, "DAEMON SOCKET: ")
+			return false
+		}
+
+		return true
+	}, "daemon", "start")
+
+	if runtime.GOOS != "windows" {
+		// the socket must only be accessible to the current user.
+		if st, err := os.Stat(socketPath); err != nil || st.Mode().Perm()&0077 != 0 {
+			t.Errorf("unexpected socket permissions: %v %v", st, err)
+		}
+	}
+
+	e.RunAndExpectSuccess(t, "daemon", "status")
+	e.RunAndExpectFailure(t, "daemon", "start")
+
+	// server commands talk to the daemon when no address is provided.
+	if lines := e.RunAndExpectSuccess(t, "server", "status"); len(lines) != 1 || !strings.Contains(lines[0], sharedTestDataDir1) {
+		t.Errorf("unexpected server status: %v", lines)
+	}
+
+	e.RunAndExpectSuccess(t, "server", "upload", "--source", sharedTestDataDir1, "--wait")
+
+	if got, want := len(e.ListSnapshotsAndExpectSuccess(t, sharedTestDataDir1)[0].Snapshots), 2; got != want {
+		t.Errorf("unexpected number of snapshots: %v, want %v", got, want)
+	}
+
+	// snapshot commands without command-specific flags are performed by the daemon.
+	_, stderr := e.RunAndExpectSuccessWithErrOut(t, "snapshot", "create", sharedTestDataDir2)
+	if !strings.Contains(strings.Join(stderr, "\n"), "using the daemon") {
+		t.Errorf("snapshot was not created using the daemon: %v", stderr)
+	}
+
+	e.RunAndExpectSuccess(t, "snapshot", "create", sharedTestDataDir2, "--no-daemon")
+
+	if got, want := len(e.ListSnapshotsAndExpectSuccess(t, sharedTestDataDir2)[0].Snapshots), 2; got != want {
+		t.Errorf("unexpected number of snapshots: %v, want %v", got, want)
+	}
+
+	lines := e.RunAndExpectSuccess(t, "snapshot", "list")
+
+	var sources, snapshots int
+
+	for _, l := range lines {
+		switch {
+		case strings.HasPrefix(l, "  +"):
+		case strings.HasPrefix(l, "  "):
+			snapshots++
+		case l != "":
+			sources++
+		}
+	}
+
+	// identical snapshots of each source are shown once.
+	if sources != 2 || snapshots != 2 {
+		t.Errorf("unexpected snapshots listed using the daemon: %v", lines)
+	}
+
+	e.RunAndExpectSuccess(t, "daemon", "stop")
+
+	if err := c.Wait(); err != nil {
+		t.Errorf("daemon did not exit cleanly: %v", err)
+	}
+
+	e.RunAndExpectFailure(t, "daemon", "status")
+}
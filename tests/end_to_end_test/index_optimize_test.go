@@ -31,4 +31,8 @@ func TestIndexOptimize(t *testing.T) {
 
 	// we flush individually after each snapshot source, so this adds 3 indexes
 	e.RunAndVerifyOutputLineCount(t, 4, "index", "ls")
+
+	// when flushes are batched, manifests and indexes of all sources are written once.
+	e.RunAndExpectSuccess(t, "snapshot", "create", ".", sharedTestDataDir1, sharedTestDataDir2, "--flush-every=0")
+	e.RunAndVerifyOutputLineCount(t, 5, "index", "ls")
 }
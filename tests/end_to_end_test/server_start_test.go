@@ -1,6 +1,7 @@
 package endtoend_test
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"strings"
@@ -144,6 +145,20 @@ func TestServerStart(t *testing.T) {
 		t.Fatalf("invalid JSON received: %v", err)
 	}
 
+	// directory objects are stored in a single content, so the raw content must match the object payload.
+	contentPayload, err := cli.GetContent(ctx, snaps[0].RootEntry)
+	if err != nil {
+		t.Fatalf("getContent %v", err)
+	}
+
+	if !bytes.Equal(contentPayload, rootPayload) {
+		t.Errorf("content payload does not match object payload")
+	}
+
+	if _, err := cli.GetContent(ctx, "no-such-content"); err == nil {
+		t.Errorf("expected error when getting invalid content")
+	}
+
 	keepDaily := 77
 
 	createResp, err = cli.CreateSnapshotSource(ctx, &serverapi.CreateSnapshotSourceRequest{
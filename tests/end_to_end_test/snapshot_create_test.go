@@ -1,6 +1,9 @@
 package endtoend_test
 
 import (
+	"reflect"
+	"sort"
+	"strings"
 	"testing"
 	"time"
 
@@ -38,6 +41,115 @@ func TestSnapshotCreate(t *testing.T) {
 	}
 }
 
+func TestSnapshotCreateParallelSources(t *testing.T) {
+	t.Parallel()
+
+	e := testenv.NewCLITest(t)
+	defer e.Cleanup(t)
+	defer e.RunAndExpectSuccess(t, "repo", "disconnect")
+
+	e.RunAndExpectSuccess(t, "repo", "create", "filesystem", "--path", e.RepoDir)
+	e.RunAndExpectSuccess(t, "snapshot", "create", sharedTestDataDir1, sharedTestDataDir2, sharedTestDataDir3, "--parallel-sources=2", "--parallel=3")
+
+	sources := e.ListSnapshotsAndExpectSuccess(t)
+	if got, want := len(sources), 3; got != want {
+		t.Errorf("unexpected number of sources: %v, want %v in %#v", got, want, sources)
+	}
+
+	for _, s := range sources {
+		if got, want := len(s.Snapshots), 1; got != want {
+			t.Errorf("unexpected number of snapshots of %v: %v, want %v", s.Path, got, want)
+		}
+	}
+}
+
+func TestSnapshotCreateDryRun(t *testing.T) {
+	t.Parallel()
+
+	e := testenv.NewCLITest(t)
+	defer e.Cleanup(t)
+	defer e.RunAndExpectSuccess(t, "repo", "disconnect")
+
+	e.RunAndExpectSuccess(t, "repo", "create", "filesystem", "--path", e.RepoDir)
+
+	blobsBefore := len(e.RunAndExpectSuccess(t, "blob", "list"))
+
+	lines := e.RunAndExpectSuccess(t, "snapshot", "create", sharedTestDataDir1, "--dry-run")
+	if !strings.Contains(strings.Join(lines, "\n"), "Would upload:") {
+		t.Errorf("dry run report not found in output: %v", lines)
+	}
+
+	if got := len(e.RunAndExpectSuccess(t, "blob", "list")); got != blobsBefore {
+		t.Errorf("dry run wrote blobs: %v, want %v", got, blobsBefore)
+	}
+
+	if sources := e.ListSnapshotsAndExpectSuccess(t); len(sources) != 0 {
+		t.Errorf("dry run created snapshots: %v", sources)
+	}
+}
+
+func TestSnapshotCreateOverrideIdentity(t *testing.T) {
+	t.Parallel()
+
+	e := testenv.NewCLITest(t)
+	defer e.Cleanup(t)
+	defer e.RunAndExpectSuccess(t, "repo", "disconnect")
+
+	e.RunAndExpectSuccess(t, "repo", "create", "filesystem", "--path", e.RepoDir, "--override-hostname=foo", "--override-username=foo")
+	e.RunAndExpectSuccess(t, "snapshot", "create", sharedTestDataDir1, "--override-hostname=bar")
+	e.RunAndExpectSuccess(t, "snapshot", "create", sharedTestDataDir1, "--override-username=bar")
+
+	e.Environment = append(e.Environment, "KOPIA_OVERRIDE_HOSTNAME=baz", "KOPIA_OVERRIDE_USERNAME=baz")
+	e.RunAndExpectSuccess(t, "snapshot", "create", sharedTestDataDir1)
+
+	var got []string
+
+	for _, s := range e.ListSnapshotsAndExpectSuccess(t, "--all") {
+		got = append(got, s.User+"@"+s.Host)
+	}
+
+	sort.Strings(got)
+
+	if want := []string{"bar@foo", "baz@baz", "foo@bar"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected sources: %v, want %v", got, want)
+	}
+}
+
+func TestSnapshotCreateSourceAlias(t *testing.T) {
+	t.Parallel()
+
+	e := testenv.NewCLITest(t)
+	defer e.Cleanup(t)
+	defer e.RunAndExpectSuccess(t, "repo", "disconnect")
+
+	e.RunAndExpectSuccess(t, "repo", "create", "filesystem", "--path", e.RepoDir, "--override-hostname=foo", "--override-username=foo")
+	e.RunAndExpectSuccess(t, "snapshot", "create", sharedTestDataDir1)
+	e.RunAndExpectSuccess(t, "snapshot", "create", sharedTestDataDir2, "--source-alias", sharedTestDataDir1)
+	e.RunAndExpectSuccess(t, "snapshot", "create", sharedTestDataDir2, "--source-alias", "bar@baz:/staged")
+
+	e.RunAndExpectFailure(t, "snapshot", "create", sharedTestDataDir1, sharedTestDataDir2, "--source-alias", sharedTestDataDir1)
+	e.RunAndExpectFailure(t, "snapshot", "create", sharedTestDataDir2, "--source-alias", "bar@baz")
+
+	sources := e.ListSnapshotsAndExpectSuccess(t, "--all")
+	if got, want := len(sources), 2; got != want {
+		t.Fatalf("unexpected number of sources: %v, want %v in %#v", got, want, sources)
+	}
+
+	for _, s := range sources {
+		switch {
+		case s.User == "foo" && s.Host == "foo":
+			if got, want := len(s.Snapshots), 2; got != want {
+				t.Errorf("unexpected number of snapshots of %v: %v, want %v", s.Path, got, want)
+			}
+
+		case s.User == "bar" && s.Host == "baz" && s.Path == "/staged":
+
+		default:
+			t.Errorf("unexpected source: %v@%v:%v", s.User, s.Host, s.Path)
+		}
+	}
+}
+
 func TestStartTimeOverride(t *testing.T) {
 	t.Parallel()
 
@@ -0,0 +1,100 @@
+package endtoend_test
+
+import (
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/kopia/kopia/tests/testenv"
+)
+
+func TestSnapshotForgetSource(t *testing.T) {
+	t.Parallel()
+
+	e := testenv.NewCLITest(t)
+	defer e.Cleanup(t)
+	defer e.RunAndExpectSuccess(t, "repo", "disconnect")
+
+	e.RunAndExpectSuccess(t, "repo", "create", "filesystem", "--path", e.RepoDir, "--override-hostname=foo", "--override-username=foo")
+	e.RunAndExpectSuccess(t, "snapshot", "create", sharedTestDataDir1)
+
+	barDir := makeScratchDir(t)
+	testenv.MustCreateRandomFile(t, filepath.Join(barDir, "file"), testenv.DirectoryTreeOptions{}, nil)
+
+	e.RunAndExpectSuccess(t, "snapshot", "create", barDir, "--override-hostname=bar", "--override-username=bar")
+	e.RunAndExpectSuccess(t, "policy", "set", "bar@bar", "--keep-latest=5")
+
+	// snapshots are within the default grace period.
+	e.RunAndExpectFailure(t, "snapshot", "forget-source", "foo@bar", "--all-users")
+
+	out := e.RunAndExpectSuccess(t, "snapshot", "forget-source", "foo@bar", "--all-users", "--grace-period=0")
+	if !containsLineWithPrefix(out, "Policy to remove: bar@bar") {
+		t.Errorf("policy of the host is not reported: %v", out)
+	}
+
+	if containsLineWithPrefix(out, "Contents to reclaim at next GC: 0 ") {
+		t.Errorf("contents referenced only by the forgotten source are not reported: %v", out)
+	}
+
+	if got := snapshotSources(t, e); len(got) != 2 {
+		t.Fatalf("snapshots deleted without --delete: %v", got)
+	}
+
+	// policies of sources with kept snapshots are not removed.
+	out = e.RunAndExpectSuccess(t, "snapshot", "forget-source", "bar@bar", "--grace-period=0", "--keep-latest=1", "--delete")
+	if containsLineWithPrefix(out, "Policy to remove:") {
+		t.Errorf("policy of the source with kept snapshots is reported: %v", out)
+	}
+
+	if !policyListContains(t, e, "bar@bar") {
+		t.Errorf("policy of the source with kept snapshots was removed")
+	}
+
+	e.RunAndExpectSuccess(t, "snapshot", "forget-source", "bar@bar", "--grace-period=0", "--delete")
+
+	if got, want := snapshotSources(t, e), []string{"foo@foo"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected sources: %v, want %v", got, want)
+	}
+
+	if policyListContains(t, e, "bar@bar") {
+		t.Errorf("policy of the forgotten host was not removed")
+	}
+}
+
+func policyListContains(t *testing.T, e *testenv.CLITest, s string) bool {
+	t.Helper()
+
+	for _, l := range e.RunAndExpectSuccess(t, "policy", "list") {
+		if strings.Contains(l, s) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func snapshotSources(t *testing.T, e *testenv.CLITest) []string {
+	t.Helper()
+
+	var got []string
+
+	for _, s := range e.ListSnapshotsAndExpectSuccess(t, "--all") {
+		got = append(got, s.User+"@"+s.Host)
+	}
+
+	sort.Strings(got)
+
+	return got
+}
+
+func containsLineWithPrefix(lines []string, prefix string) bool {
+	for _, l := range lines {
+		if strings.HasPrefix(l, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
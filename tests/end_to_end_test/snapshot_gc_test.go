@@ -62,6 +62,10 @@ how are you
 	// data block + directory block + manifest block + manifest block from manifest deletion
 	e.RunAndVerifyOutputLineCount(t, expectedContentCount, "content", "list")
 
+	// garbage-collect is aborted because the estimated cost of deleting packs exceeds the limit
+	e.RunAndExpectFailure(t, "snapshot", "gc", "--delete", "--min-age", "0s", "--delete-price", "1000", "--max-cost", "0.01")
+	e.RunAndVerifyOutputLineCount(t, expectedContentCount, "content", "list")
+
 	// garbage-collect for real, this time without age limit
 	e.RunAndExpectSuccess(t, "snapshot", "gc", "--delete", "--min-age", "0s")
 